@@ -0,0 +1,268 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// DefaultAdminServiceName is the service name used for admin operations if
+// AdminOptions.ServiceName is not set.
+const DefaultAdminServiceName = "admin"
+
+// The operations served by the admin service. Arguments and responses are JSON.
+const (
+	// AdminSetLogLevel sets the minimum level of the channel's logger, e.g. {"level": "debug"}.
+	// The level is one of all, debug, info, warn, error or fatal.
+	AdminSetLogLevel = "setLogLevel"
+
+	// AdminSetDraining starts or stops draining the channel, e.g. {"draining": true}.
+	AdminSetDraining = "setDraining"
+
+	// AdminDumpState returns the channel's runtime state, see IntrospectionOptions.
+	// Exchanges and empty peers are included unless the arguments override them.
+	AdminDumpState = "dumpState"
+
+	// AdminSetQuotas replaces the channel's quotas, e.g.
+	// {"callers": {"svc": [{"Limit": 10, "Period": 1000000000}]}, "default": []}.
+	AdminSetQuotas = "setQuotas"
+
+	// AdminSetRuntimeOptions updates the channel's RuntimeOptions, and returns the updated
+	// options. Options that are not in the arguments are unchanged, e.g.
+	// {"payloadSampleRate": 0.1, "timeouts": {"svc": {"Default": 1000000000}}}.
+	AdminSetRuntimeOptions = "setRuntimeOptions"
+
+	// AdminCloseIdleConnections gracefully closes connections with no calls in progress,
+	// and returns the number of connections closed, e.g. {"closed": 2}.
+	AdminCloseIdleConnections = "closeIdleConnections"
+)
+
+// AdminOptions configure the admin service, which exposes privileged operations to
+// change the behavior of a channel at runtime.
+type AdminOptions struct {
+	// ServiceName is the service name that admin operations are called on.
+	// Defaults to DefaultAdminServiceName.
+	ServiceName string
+
+	// Authorizer decides whether admin calls are allowed, in addition to the channel's
+	// Authorizer. By default, admin calls are only allowed from connections that were
+	// authenticated by the channel's Authenticator, or from callers with a verified
+	// TLS client certificate.
+	Authorizer Authorizer
+}
+
+// adminService serves the admin operations for a channel.
+type adminService struct {
+	ch          *Channel
+	serviceName string
+	authorizer  Authorizer
+	logger      dynamicLevelLogger
+}
+
+func newAdminService(ch *Channel, opts *AdminOptions, logger Logger) *adminService {
+	if opts == nil {
+		return nil
+	}
+
+	a := &adminService{
+		ch:          ch,
+		serviceName: opts.ServiceName,
+		authorizer:  opts.Authorizer,
+		logger:      newDynamicLevelLogger(logger, LogLevelAll),
+	}
+	if a.serviceName == "" {
+		a.serviceName = DefaultAdminServiceName
+	}
+	return a
+}
+
+// register registers the admin operations on the admin service's subchannel.
+func (a *adminService) register() {
+	sc := a.ch.GetSubChannel(a.serviceName)
+	sc.Register(adminHandler(a.setLogLevel), AdminSetLogLevel)
+	sc.Register(adminHandler(a.setDraining), AdminSetDraining)
+	sc.Register(adminHandler(a.dumpState), AdminDumpState)
+	sc.Register(adminHandler(a.setQuotas), AdminSetQuotas)
+	sc.Register(adminHandler(a.setRuntimeOptions), AdminSetRuntimeOptions)
+	sc.Register(adminHandler(a.closeIdleConnections), AdminCloseIdleConnections)
+}
+
+// authorize returns nil if the call is not an admin call, or if the caller is allowed
+// to make admin calls.
+func (a *adminService) authorize(c *Connection, call *InboundCall) error {
+	if a == nil || call.ServiceName() != a.serviceName {
+		return nil
+	}
+
+	if a.authorizer == nil {
+		if c.authenticated || call.CallerIdentity() != "" {
+			return nil
+		}
+		return newPermissionDeniedError("admin calls require an authenticated caller")
+	}
+
+	allow, reason := a.authorizer.Authorize(AuthorizationRequest{
+		Service:       call.ServiceName(),
+		Operation:     string(call.Operation()),
+		Caller:        call.CallerName(),
+		CallerPeer:    c.remotePeerInfo,
+		Identity:      call.CallerIdentity(),
+		Authenticated: c.authenticated,
+	})
+	if allow {
+		return nil
+	}
+	return newPermissionDeniedError(reason)
+}
+
+var logLevelNames = map[string]LogLevel{
+	"all":   LogLevelAll,
+	"debug": LogLevelDebug,
+	"info":  LogLevelInfo,
+	"warn":  LogLevelWarn,
+	"error": LogLevelError,
+	"fatal": LogLevelFatal,
+}
+
+type adminLogLevel struct {
+	Level string `json:"level"`
+}
+
+func (a *adminService) setLogLevel(arg3 []byte) (interface{}, error) {
+	var req adminLogLevel
+	if err := json.Unmarshal(arg3, &req); err != nil {
+		return nil, err
+	}
+
+	level, ok := logLevelNames[strings.ToLower(req.Level)]
+	if !ok {
+		return nil, fmt.Errorf("unknown log level %q", req.Level)
+	}
+
+	a.logger.setLevel(level)
+	a.ch.log.Infof("Log level set to %v by admin call", req.Level)
+	return req, nil
+}
+
+type adminDraining struct {
+	Draining bool `json:"draining"`
+}
+
+func (a *adminService) setDraining(arg3 []byte) (interface{}, error) {
+	var req adminDraining
+	if err := json.Unmarshal(arg3, &req); err != nil {
+		return nil, err
+	}
+
+	if req.Draining {
+		a.ch.StartDrain()
+	} else {
+		a.ch.StopDrain()
+	}
+	return adminDraining{a.ch.Draining()}, nil
+}
+
+func (a *adminService) dumpState(arg3 []byte) (interface{}, error) {
+	opts := IntrospectionOptions{
+		IncludeExchanges:  true,
+		IncludeEmptyPeers: true,
+	}
+	if len(arg3) > 0 {
+		if err := json.Unmarshal(arg3, &opts); err != nil {
+			return nil, err
+		}
+	}
+	return a.ch.IntrospectState(&opts), nil
+}
+
+type adminQuotas struct {
+	Callers map[string][]Quota `json:"callers"`
+	Default []Quota            `json:"default"`
+}
+
+func (a *adminService) setQuotas(arg3 []byte) (interface{}, error) {
+	var req adminQuotas
+	if err := json.Unmarshal(arg3, &req); err != nil {
+		return nil, err
+	}
+
+	if err := a.ch.SetQuotas(req.Callers, req.Default); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (a *adminService) setRuntimeOptions(arg3 []byte) (interface{}, error) {
+	var unmarshalErr error
+	err := a.ch.UpdateRuntimeOptions(func(opts *RuntimeOptions) {
+		orig := opts.copy()
+		if unmarshalErr = json.Unmarshal(arg3, opts); unmarshalErr != nil {
+			// Leave the options unchanged if the arguments are invalid.
+			*opts = orig
+		}
+	})
+	if unmarshalErr != nil {
+		return nil, unmarshalErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a.ch.RuntimeOptions(), nil
+}
+
+type adminClosedConnections struct {
+	Closed int `json:"closed"`
+}
+
+func (a *adminService) closeIdleConnections(arg3 []byte) (interface{}, error) {
+	return adminClosedConnections{a.ch.CloseIdleConnections()}, nil
+}
+
+// adminHandler is a handler for admin operations. It is passed the raw arg3, and the
+// returned value is written as JSON to arg3 of the response. If an error is returned,
+// the call fails with a bad request error.
+type adminHandler func(arg3 []byte) (interface{}, error)
+
+// Handle reads the arguments of the call and responds with the result of f.
+func (f adminHandler) Handle(ctx context.Context, call *InboundCall) {
+	var arg2, arg3 []byte
+	if err := NewArgReader(call.Arg2Reader()).Read(&arg2); err != nil {
+		return
+	}
+	if err := NewArgReader(call.Arg3Reader()).Read(&arg3); err != nil {
+		return
+	}
+
+	result, err := f(arg3)
+	response := call.Response()
+	if err != nil {
+		response.SendSystemError(NewSystemError(ErrCodeBadRequest, "admin %v failed: %v", call.Operation(), err))
+		return
+	}
+	if err := NewArgWriter(response.Arg2Writer()).Write(nil); err != nil {
+		return
+	}
+	NewArgWriter(response.Arg3Writer()).WriteJSON(result)
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func adminCall(t *testing.T, client *Channel, hostPort, operation string, arg3 interface{}, resp interface{}) error {
+	req, err := json.Marshal(arg3)
+	require.NoError(t, err, "Marshal failed")
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	_, respArg3, _, err := raw.Call(ctx, client, hostPort, DefaultAdminServiceName, operation, nil, req)
+	if err != nil {
+		return err
+	}
+	if resp != nil {
+		require.NoError(t, json.Unmarshal(respArg3, resp), "Unmarshal response failed")
+	}
+	return nil
+}
+
+func TestAdmin(t *testing.T) {
+	var logs SyncBuffer
+	secret := SharedSecretAuthenticator{Secret: []byte("secret")}
+	server, err := NewChannel("admin-svc", &ChannelOptions{
+		Logger:         NewLogger(&logs),
+		Authenticator:  secret,
+		Admin:          &AdminOptions{},
+		Quotas:         &QuotaOptions{},
+		PayloadSampler: &PayloadSamplerOptions{Rate: 0.5},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+	hostPort := server.PeerInfo().HostPort
+	testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{}, nil
+	})
+
+	clients := make(map[string]*Channel)
+	for _, name := range []string{"admin-client", "quota-client"} {
+		client, err := NewChannel(name, &ChannelOptions{Authenticator: secret})
+		require.NoError(t, err, "NewChannel failed")
+		defer client.Close()
+		clients[name] = client
+	}
+	admin := clients["admin-client"]
+
+	// Log level
+	require.NoError(t, adminCall(t, admin, hostPort, AdminSetLogLevel, map[string]string{"level": "error"}, nil),
+		"setLogLevel failed")
+	server.Logger().Warnf("hidden-warning")
+	server.Logger().Errorf("visible-error")
+	assert.False(t, strings.Contains(logs.String(), "hidden-warning"), "warnings should not be logged at error level")
+	assert.True(t, strings.Contains(logs.String(), "visible-error"), "errors should be logged at error level")
+
+	err = adminCall(t, admin, hostPort, AdminSetLogLevel, map[string]string{"level": "verbose"}, nil)
+	assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(err), "unknown log level should fail, got %v", err)
+
+	// Draining
+	var draining struct {
+		Draining bool `json:"draining"`
+	}
+	require.NoError(t, adminCall(t, admin, hostPort, AdminSetDraining, map[string]bool{"draining": true}, &draining),
+		"setDraining failed")
+	assert.True(t, draining.Draining, "response should report draining")
+	assert.True(t, server.Draining(), "channel should be draining")
+	require.NoError(t, adminCall(t, admin, hostPort, AdminSetDraining, map[string]bool{"draining": false}, &draining),
+		"setDraining failed")
+	assert.False(t, server.Draining(), "channel should no longer be draining")
+
+	// State
+	var state RuntimeState
+	require.NoError(t, adminCall(t, admin, hostPort, AdminDumpState, nil, &state), "dumpState failed")
+	assert.Equal(t, "admin-svc", state.LocalPeer.ServiceName, "state should be for the server")
+	assert.NotEmpty(t, state.Peers, "state should include peers")
+
+	// Quotas
+	quotas := map[string]interface{}{
+		"callers": map[string][]Quota{"quota-client": {{Limit: 1, Period: time.Hour}}},
+	}
+	require.NoError(t, adminCall(t, admin, hostPort, AdminSetQuotas, quotas, nil), "setQuotas failed")
+	echo := func() error {
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		_, _, _, err := raw.Call(ctx, clients["quota-client"], hostPort, "admin-svc", "echo", nil, nil)
+		return err
+	}
+	assert.NoError(t, echo(), "call within quota failed")
+	assert.True(t, IsQuotaExceeded(echo()), "call over the updated quota should fail")
+
+	// Runtime options
+	var runtimeOpts RuntimeOptions
+	require.NoError(t, adminCall(t, admin, hostPort, AdminSetRuntimeOptions, map[string]float64{"payloadSampleRate": 0.25},
+		&runtimeOpts), "setRuntimeOptions failed")
+	assert.Equal(t, 0.25, runtimeOpts.PayloadSampleRate, "response should include the updated options")
+	assert.NotEmpty(t, runtimeOpts.Quotas, "options that were not set should be unchanged")
+	err = adminCall(t, admin, hostPort, AdminSetRuntimeOptions, map[string]float64{"payloadSampleRate": 2}, nil)
+	assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(err), "invalid options should fail, got %v", err)
+	assert.Equal(t, 0.25, server.RuntimeOptions().PayloadSampleRate, "invalid options should not be applied")
+
+	// Idle connections. The admin client's connection has the admin call in progress.
+	var closed struct {
+		Closed int `json:"closed"`
+	}
+	require.NoError(t, adminCall(t, admin, hostPort, AdminCloseIdleConnections, nil, &closed),
+		"closeIdleConnections failed")
+	assert.Equal(t, 1, closed.Closed, "only the quota client's connection should be closed")
+}
+
+func TestAdminAuthorization(t *testing.T) {
+	tests := []struct {
+		msg           string
+		authenticator Authenticator
+		admin         *AdminOptions
+		caller        string
+		wantDenied    bool
+	}{
+		{
+			msg:        "unauthenticated callers are denied by default",
+			admin:      &AdminOptions{},
+			caller:     "ops",
+			wantDenied: true,
+		},
+		{
+			msg:           "authenticated callers are allowed by default",
+			authenticator: SharedSecretAuthenticator{Secret: []byte("secret")},
+			admin:         &AdminOptions{},
+			caller:        "ops",
+		},
+		{
+			msg: "authorizer allows caller",
+			admin: &AdminOptions{Authorizer: AuthorizerFunc(func(req AuthorizationRequest) (bool, string) {
+				return req.Caller == "ops", "admin requires ops"
+			})},
+			caller: "ops",
+		},
+		{
+			msg: "authorizer denies caller",
+			admin: &AdminOptions{Authorizer: AuthorizerFunc(func(req AuthorizationRequest) (bool, string) {
+				return req.Caller == "ops", "admin requires ops"
+			})},
+			caller:     "other",
+			wantDenied: true,
+		},
+		{
+			msg:           "admin service disabled",
+			authenticator: SharedSecretAuthenticator{Secret: []byte("secret")},
+			caller:        "ops",
+		},
+	}
+
+	for _, tt := range tests {
+		server, err := NewChannel("admin-svc", &ChannelOptions{
+			Authenticator: tt.authenticator,
+			Admin:         tt.admin,
+		})
+		require.NoError(t, err, "NewChannel failed")
+		require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+
+		client, err := NewChannel(tt.caller, &ChannelOptions{Authenticator: tt.authenticator})
+		require.NoError(t, err, "NewChannel failed")
+
+		err = adminCall(t, client, server.PeerInfo().HostPort, AdminSetDraining, map[string]bool{"draining": true}, nil)
+		switch {
+		case tt.wantDenied:
+			assert.True(t, IsPermissionDenied(err), "%v: expected permission denied, got %v", tt.msg, err)
+			assert.False(t, server.Draining(), "%v: denied call should not drain", tt.msg)
+		case tt.admin == nil:
+			assert.Error(t, err, "%v: admin calls should fail without the admin service", tt.msg)
+			assert.False(t, IsPermissionDenied(err), "%v: unexpected permission denied", tt.msg)
+		default:
+			assert.NoError(t, err, "%v: admin call failed", tt.msg)
+			assert.True(t, server.Draining(), "%v: channel should be draining", tt.msg)
+		}
+
+		client.Close()
+		server.Close()
+	}
+}
+
+func TestAdminSetQuotasWithoutQuotas(t *testing.T) {
+	server, err := NewChannel("admin-svc", &ChannelOptions{
+		Authenticator: SharedSecretAuthenticator{Secret: []byte("secret")},
+		Admin:         &AdminOptions{},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+
+	assert.Error(t, server.SetQuotas(nil, nil), "SetQuotas should fail if quotas are not enabled")
+
+	client, err := NewChannel("ops", &ChannelOptions{Authenticator: SharedSecretAuthenticator{Secret: []byte("secret")}})
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	err = adminCall(t, client, server.PeerInfo().HostPort, AdminSetQuotas, map[string]interface{}{}, nil)
+	assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(err), "setQuotas should fail, got %v", err)
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import "sync"
+
+// AdmissionSignals are load signals supplied by the application using
+// Channel.SetAdmissionSignals, which are passed to the admission controller.
+type AdmissionSignals struct {
+	// CPU is the CPU utilization of the process, between 0 and 1.
+	CPU float64
+
+	// Memory is the memory utilization of the process, between 0 and 1.
+	Memory float64
+
+	// QueueLength is the length of the application's work queue.
+	QueueLength int
+}
+
+// AdmissionRequest describes an inbound call that is about to be dispatched.
+type AdmissionRequest struct {
+	Service   string
+	Operation string
+	Caller    string
+
+	// Signals are the signals most recently supplied by the application.
+	Signals AdmissionSignals
+}
+
+// AdmissionDecision is the decision of an admission controller for an inbound call.
+type AdmissionDecision int
+
+const (
+	// AdmitCall dispatches the call to its handler.
+	AdmitCall AdmissionDecision = iota
+
+	// RejectBusy rejects the call with ErrServerBusy, which tells callers to send
+	// less traffic to this peer.
+	RejectBusy
+
+	// RejectDeclined rejects the call with ErrAdmissionDeclined, which tells callers
+	// to retry the call on another peer without reweighting their traffic.
+	RejectDeclined
+)
+
+// ErrAdmissionDeclined is a SystemError indicating that the admission controller declined the call.
+var ErrAdmissionDeclined = NewSystemError(ErrCodeDeclined, "call declined by admission controller")
+
+// AdmissionController is consulted before each inbound call is dispatched, so applications
+// can shed load using their own overload detection. Admit is called concurrently, from
+// the goroutine that handles the call before the handler runs, so it should be fast as
+// it adds to the latency of every call.
+type AdmissionController interface {
+	Admit(req AdmissionRequest) AdmissionDecision
+}
+
+// AdmissionThresholds is an AdmissionController that rejects calls with RejectBusy when any
+// signal is over its threshold. A zero threshold is ignored.
+type AdmissionThresholds struct {
+	MaxCPU         float64
+	MaxMemory      float64
+	MaxQueueLength int
+}
+
+// Admit implements AdmissionController.
+func (t AdmissionThresholds) Admit(req AdmissionRequest) AdmissionDecision {
+	s := req.Signals
+	switch {
+	case t.MaxCPU > 0 && s.CPU > t.MaxCPU,
+		t.MaxMemory > 0 && s.Memory > t.MaxMemory,
+		t.MaxQueueLength > 0 && s.QueueLength > t.MaxQueueLength:
+		return RejectBusy
+	}
+	return AdmitCall
+}
+
+// admission holds a channel's admission controller and the latest signals.
+type admission struct {
+	controller AdmissionController
+
+	mut     sync.RWMutex
+	signals AdmissionSignals
+}
+
+func newAdmission(controller AdmissionController) *admission {
+	if controller == nil {
+		return nil
+	}
+	return &admission{controller: controller}
+}
+
+// SetAdmissionSignals updates the load signals passed to the channel's admission controller.
+// It has no effect if the channel does not have an admission controller.
+func (ch *Channel) SetAdmissionSignals(signals AdmissionSignals) {
+	a := ch.admission
+	if a == nil {
+		return
+	}
+
+	a.mut.Lock()
+	a.signals = signals
+	a.mut.Unlock()
+}
+
+// admit returns nil if the call is admitted, or the error to reject the call with.
+func (a *admission) admit(call *InboundCall) error {
+	if a == nil {
+		return nil
+	}
+
+	a.mut.RLock()
+	signals := a.signals
+	a.mut.RUnlock()
+
+	switch a.controller.Admit(AdmissionRequest{
+		Service:   call.ServiceName(),
+		Operation: string(call.Operation()),
+		Caller:    call.CallerName(),
+		Signals:   signals,
+	}) {
+	case RejectBusy:
+		return ErrServerBusy
+	case RejectDeclined:
+		return ErrAdmissionDeclined
+	}
+	return nil
+}
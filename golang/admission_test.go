@@ -0,0 +1,120 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+type recordingAdmission struct {
+	sync.Mutex
+	requests []AdmissionRequest
+	decision AdmissionDecision
+}
+
+func (a *recordingAdmission) Admit(req AdmissionRequest) AdmissionDecision {
+	a.Lock()
+	defer a.Unlock()
+	a.requests = append(a.requests, req)
+	return a.decision
+}
+
+func (a *recordingAdmission) setDecision(d AdmissionDecision) {
+	a.Lock()
+	a.decision = d
+	a.Unlock()
+}
+
+func TestAdmissionController(t *testing.T) {
+	controller := &recordingAdmission{}
+	stats := newRecordingStatsReporter()
+	server, err := NewChannel("admission-svc", &ChannelOptions{
+		StatsReporter:       stats,
+		AdmissionController: controller,
+	})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "op", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{}, nil
+	})
+
+	client, err := testutils.NewClient(&testutils.ChannelOpts{ServiceName: "admission-client"})
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	call := func() error {
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		_, _, _, err := raw.Call(ctx, client, server.PeerInfo().HostPort, "admission-svc", "op", nil, nil)
+		return err
+	}
+
+	signals := AdmissionSignals{CPU: 0.5, Memory: 0.25, QueueLength: 3}
+	server.SetAdmissionSignals(signals)
+	require.NoError(t, call(), "admitted call failed")
+
+	controller.setDecision(RejectBusy)
+	assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(call()), "RejectBusy should fail with busy")
+
+	controller.setDecision(RejectDeclined)
+	assert.Equal(t, ErrCodeDeclined, GetSystemErrorCode(call()), "RejectDeclined should fail with declined")
+
+	controller.Lock()
+	require.Len(t, controller.requests, 3, "controller should be consulted for each call")
+	assert.Equal(t, AdmissionRequest{
+		Service:   "admission-svc",
+		Operation: "op",
+		Caller:    "admission-client",
+		Signals:   signals,
+	}, controller.requests[0], "admission request mismatch")
+	controller.Unlock()
+
+	rejected := counterValue(stats, "inbound.calls.rejected")
+	assert.EqualValues(t, 2, rejected, "rejected calls should be counted")
+}
+
+func TestAdmissionThresholds(t *testing.T) {
+	thresholds := AdmissionThresholds{MaxCPU: 0.9, MaxQueueLength: 100}
+	tests := []struct {
+		signals AdmissionSignals
+		want    AdmissionDecision
+	}{
+		{AdmissionSignals{}, AdmitCall},
+		{AdmissionSignals{CPU: 0.8, Memory: 1, QueueLength: 100}, AdmitCall},
+		{AdmissionSignals{CPU: 0.95}, RejectBusy},
+		{AdmissionSignals{QueueLength: 101}, RejectBusy},
+	}
+
+	for _, tt := range tests {
+		got := thresholds.Admit(AdmissionRequest{Signals: tt.signals})
+		assert.Equal(t, tt.want, got, "Admit(%+v) mismatch", tt.signals)
+	}
+}
@@ -58,6 +58,14 @@ func (r ArgReadHelper) Read(bs *[]byte) error {
 	})
 }
 
+// ReadTo copies the argument to w as it is received, without buffering the whole value.
+func (r ArgReadHelper) ReadTo(w io.Writer) error {
+	return r.read(func() error {
+		_, err := io.Copy(w, r.reader)
+		return err
+	})
+}
+
 // ReadJSON deserializes JSON from the underlying reader into data.
 func (r ArgReadHelper) ReadJSON(data interface{}) error {
 	return r.read(func() error {
@@ -108,6 +116,15 @@ func (w ArgWriteHelper) Write(bs []byte) error {
 	})
 }
 
+// WriteFrom copies the argument from r until EOF, sending it as each frame fills up,
+// without buffering the whole value.
+func (w ArgWriteHelper) WriteFrom(r io.Reader) error {
+	return w.write(func() error {
+		_, err := io.Copy(w.writer, r)
+		return err
+	})
+}
+
 // WriteJSON writes the given object as JSON.
 func (w ArgWriteHelper) WriteJSON(data interface{}) error {
 	return w.write(func() error {
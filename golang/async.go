@@ -0,0 +1,233 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/context"
+)
+
+// DefaultAsyncWorkers is the number of workers used if ChannelOptions does not specify one.
+const DefaultAsyncWorkers = 4
+
+// AsyncResult is the result of a call made using CallAsync.
+type AsyncResult struct {
+	// Arg2 and Arg3 are the response args. They are set for application errors, and
+	// are nil if Err is set.
+	Arg2 []byte
+	Arg3 []byte
+
+	// Response is the response to the call, which can be used to check for an
+	// application error. It is nil if Err is set.
+	Response *OutboundCallResponse
+
+	// Err is set if the call could not be made, or failed without a response.
+	Err error
+}
+
+// A Future is a call made using CallAsync, which completes once the response has
+// been received, the call's context is done, or the connection fails.
+type Future struct {
+	ctx      context.Context
+	pool     *asyncPool
+	call     *OutboundCall
+	callback func(*AsyncResult)
+	result   AsyncResult
+	done     chan struct{}
+
+	// triggeredCh is closed once the call is triggered, which stops watching the call.
+	triggeredCh chan struct{}
+
+	// pending counts the events needed before the future is ready: the request being
+	// sent, and the call being triggered by its response, context or connection.
+	pending   int32
+	triggered int32
+}
+
+// Done returns a channel that is closed once the call completes, after its callback
+// has returned.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result waits for the call to complete and returns its result.
+func (f *Future) Result() *AsyncResult {
+	<-f.done
+	return &f.result
+}
+
+// CallAsync makes a call with the given arguments, without waiting for the response.
+// It returns once the request has been sent, and the result is delivered using the
+// returned Future. If callback is non-nil, it is called with the result once the call
+// completes. The callback must not wait for the Future it is called for.
+//
+// Results are read and callbacks are called by a small pool of workers shared by the
+// channel (see ChannelOptions.AsyncWorkers), rather than a goroutine per call, so many
+// calls can be outstanding on a connection at once. Calls are passed to the workers in
+// the order that they complete, but with more than one worker, callbacks may run
+// concurrently and in any order. Set ChannelOptions.AsyncWorkers to 1 to call callbacks
+// one at a time, in the order that calls complete. Callbacks should not block, as they
+// delay the results of other calls.
+//
+// The whole response is buffered before it is read, so CallAsync is intended for small
+// requests. Cancelling the call's context fails the call with the context's error.
+func (ch *Channel) CallAsync(ctx context.Context, hostPort, serviceName, operation string,
+	arg2, arg3 []byte, callOptions *CallOptions, callback func(*AsyncResult)) *Future {
+
+	f := &Future{
+		ctx:         ctx,
+		pool:        ch.asyncPool,
+		callback:    callback,
+		done:        make(chan struct{}),
+		triggeredCh: make(chan struct{}),
+		pending:     2,
+	}
+
+	call, err := ch.BeginCall(ctx, hostPort, serviceName, operation, callOptions)
+	if err != nil {
+		f.fail(err)
+		return f
+	}
+	f.call = call
+	call.conn.outbound.setResponseHook(call.mex, f.trigger)
+	go f.watch()
+
+	if err := NewArgWriter(call.Arg2Writer()).Write(arg2); err != nil {
+		f.fail(err)
+		return f
+	}
+	if err := NewArgWriter(call.Arg3Writer()).Write(arg3); err != nil {
+		f.fail(err)
+		return f
+	}
+
+	f.sent()
+	return f
+}
+
+// fail completes the call with an error, once it is triggered if it was started.
+func (f *Future) fail(err error) {
+	f.result.Err = err
+	f.trigger()
+	f.sent()
+}
+
+// sent records that the request has been sent.
+func (f *Future) sent() {
+	if atomic.AddInt32(&f.pending, -1) == 0 {
+		f.pool.enqueue(f)
+	}
+}
+
+// trigger records that the call can complete without blocking. It may be called
+// multiple times, by the response, the context or the connection.
+func (f *Future) trigger() {
+	if !atomic.CompareAndSwapInt32(&f.triggered, 0, 1) {
+		return
+	}
+	close(f.triggeredCh)
+	if atomic.AddInt32(&f.pending, -1) == 0 {
+		f.pool.enqueue(f)
+	}
+}
+
+// watch triggers the call if its context is done or its connection is lost before
+// the response is received.
+func (f *Future) watch() {
+	select {
+	case <-f.ctx.Done():
+	case <-f.call.mex.lost:
+	case <-f.triggeredCh:
+		return
+	}
+	f.trigger()
+}
+
+// complete reads the response, if the call was sent, and delivers the result.
+func (f *Future) complete() {
+	if f.result.Err == nil {
+		f.readResponse()
+	}
+	if f.callback != nil {
+		f.callback(&f.result)
+	}
+	close(f.done)
+}
+
+func (f *Future) readResponse() {
+	response := f.call.Response()
+	var arg2, arg3 []byte
+	if err := NewArgReader(response.Arg2Reader()).Read(&arg2); err != nil {
+		f.result.Err = err
+		return
+	}
+	if err := NewArgReader(response.Arg3Reader()).Read(&arg3); err != nil {
+		f.result.Err = err
+		return
+	}
+	f.result = AsyncResult{Arg2: arg2, Arg3: arg3, Response: response}
+}
+
+// asyncPool runs the workers that complete async calls. Workers only run while there
+// is work for them, so an idle pool has no goroutines.
+type asyncPool struct {
+	maxWorkers int
+
+	mut     sync.Mutex
+	queue   []*Future
+	workers int
+}
+
+func newAsyncPool(workers int) *asyncPool {
+	if workers <= 0 {
+		workers = DefaultAsyncWorkers
+	}
+	return &asyncPool{maxWorkers: workers}
+}
+
+// enqueue queues a call to be completed, starting a worker if needed.
+func (p *asyncPool) enqueue(f *Future) {
+	p.mut.Lock()
+	p.queue = append(p.queue, f)
+	if p.workers < p.maxWorkers {
+		p.workers++
+		go p.work()
+	}
+	p.mut.Unlock()
+}
+
+func (p *asyncPool) work() {
+	for {
+		p.mut.Lock()
+		if len(p.queue) == 0 {
+			p.workers--
+			p.mut.Unlock()
+			return
+		}
+		f := p.queue[0]
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+		p.mut.Unlock()
+
+		f.complete()
+	}
+}
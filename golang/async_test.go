@@ -0,0 +1,195 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestCallAsync(t *testing.T) {
+	testutils.WithTestClientServer(t, nil, func(client, server *Channel, hostPort string) {
+		testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+		})
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		const numCalls = 1000
+		var (
+			wg      sync.WaitGroup
+			futures []*Future
+		)
+		wg.Add(numCalls)
+		for i := 0; i < numCalls; i++ {
+			arg3 := []byte(fmt.Sprint("call-", i))
+			f := client.CallAsync(ctx, hostPort, testutils.DefaultServerName, "echo", []byte("arg2"), arg3, nil,
+				func(result *AsyncResult) {
+					assert.NoError(t, result.Err, "Callback got an error")
+					wg.Done()
+				})
+			futures = append(futures, f)
+		}
+		wg.Wait()
+
+		for i, f := range futures {
+			result := f.Result()
+			require.NoError(t, result.Err, "Call %v failed", i)
+			assert.False(t, result.Response.ApplicationError(), "Call %v should not be an application error", i)
+			assert.Equal(t, "arg2", string(result.Arg2), "Call %v arg2 mismatch", i)
+			assert.Equal(t, fmt.Sprint("call-", i), string(result.Arg3), "Call %v arg3 mismatch", i)
+		}
+	})
+}
+
+func TestCallAsyncCompletionOrder(t *testing.T) {
+	testutils.WithTestClientServer(t, nil, func(client, server *Channel, hostPort string) {
+		release := make(chan struct{})
+		testutils.RegisterFunc(t, server, "op", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			if string(args.Arg3) == "slow" {
+				<-release
+			}
+			return &raw.Res{Arg3: args.Arg3}, nil
+		})
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		var (
+			mut   sync.Mutex
+			order []string
+		)
+		callback := func(result *AsyncResult) {
+			mut.Lock()
+			defer mut.Unlock()
+			order = append(order, string(result.Arg3))
+			if len(order) == 1 {
+				close(release)
+			}
+		}
+		slow := client.CallAsync(ctx, hostPort, testutils.DefaultServerName, "op", nil, []byte("slow"), nil, callback)
+		fast := client.CallAsync(ctx, hostPort, testutils.DefaultServerName, "op", nil, []byte("fast"), nil, callback)
+		require.NoError(t, fast.Result().Err, "fast call failed")
+		require.NoError(t, slow.Result().Err, "slow call failed")
+
+		mut.Lock()
+		defer mut.Unlock()
+		assert.Equal(t, []string{"fast", "slow"}, order, "Callbacks should be called in completion order")
+	})
+}
+
+func TestCallAsyncErrors(t *testing.T) {
+	testutils.WithTestClientServer(t, nil, func(client, server *Channel, hostPort string) {
+		testutils.RegisterFunc(t, server, "app", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			return &raw.Res{IsErr: true, Arg3: []byte("failed")}, nil
+		})
+		testutils.RegisterFunc(t, server, "busy", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			return &raw.Res{SystemErr: ErrServerBusy}, nil
+		})
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		result := client.CallAsync(ctx, hostPort, testutils.DefaultServerName, "app", nil, nil, nil, nil).Result()
+		require.NoError(t, result.Err, "Application errors should return a response")
+		assert.True(t, result.Response.ApplicationError(), "Expected an application error")
+		assert.Equal(t, "failed", string(result.Arg3), "Unexpected arg3")
+
+		result = client.CallAsync(ctx, hostPort, testutils.DefaultServerName, "busy", nil, nil, nil, nil).Result()
+		assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(result.Err), "Unexpected error: %v", result.Err)
+		assert.Nil(t, result.Response, "System errors should not return a response")
+
+		var called bool
+		result = client.CallAsync(context.Background(), hostPort, testutils.DefaultServerName, "app", nil, nil, nil,
+			func(*AsyncResult) { called = true }).Result()
+		assert.Equal(t, ErrTimeoutRequired, result.Err, "Calls without a deadline should fail")
+		assert.True(t, called, "Callback should be called for calls that fail to start")
+	})
+}
+
+func TestCallAsyncContext(t *testing.T) {
+	// The handler's response is abandoned once the call times out, which the leak checks
+	// report as a frame that was not released, so the server is not leak checked.
+	require.NoError(t, testutils.WithServer(nil, func(server *Channel, hostPort string) {
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		release := make(chan struct{})
+		var handlers sync.WaitGroup
+		handlers.Add(2)
+		testutils.RegisterFunc(t, server, "block", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			defer handlers.Done()
+			<-release
+			return &raw.Res{}, nil
+		})
+
+		// The timeout is either noticed by the client, or reported by the server.
+		ctx, cancel := NewContext(50 * time.Millisecond)
+		defer cancel()
+		result := client.CallAsync(ctx, hostPort, testutils.DefaultServerName, "block", nil, nil, nil, nil).Result()
+		assert.Equal(t, ErrCodeTimeout, ErrorClass(result.Err).Code, "Expected the call to time out, got %v", result.Err)
+
+		ctx, cancel = NewContext(time.Second)
+		f := client.CallAsync(ctx, hostPort, testutils.DefaultServerName, "block", nil, nil, nil, nil)
+		started := time.Now()
+		cancel()
+		result = f.Result()
+		assert.Equal(t, context.Canceled, result.Err, "Expected the call to be cancelled")
+		assert.True(t, time.Since(started) < 500*time.Millisecond, "Cancelled call should complete quickly")
+
+		// Release the handlers before the channels are closed.
+		close(release)
+		handlers.Wait()
+	}))
+}
+
+func TestCallAsyncConnectionLost(t *testing.T) {
+	// The server closes its connection instead of writing the response.
+	server, err := NewChannel("svc", &ChannelOptions{Faults: &FaultOptions{CloseRate: 1}})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{}, nil
+	})
+
+	client, err := NewChannel("client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	ctx, cancel := NewContext(5 * time.Second)
+	defer cancel()
+	started := time.Now()
+	result := client.CallAsync(ctx, server.PeerInfo().HostPort, "svc", "echo", nil, nil, nil, nil).Result()
+	assert.Error(t, result.Err, "Call should fail when the connection is lost")
+	assert.True(t, time.Since(started) < time.Second, "Call should fail before its deadline")
+}
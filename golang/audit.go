@@ -0,0 +1,155 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// AuditRecord describes a single audited inbound call.
+type AuditRecord struct {
+	Service   string
+	Operation string
+
+	// Caller is the service name of the caller, from the caller name transport header.
+	Caller string
+
+	// CallerPeer is the peer information the caller sent when initializing the connection.
+	CallerPeer PeerInfo
+
+	// RequestID is the request ID of the call.
+	RequestID string
+
+	// Headers are the transport headers of the call, after redaction.
+	Headers map[string]string
+
+	StartedAt time.Time
+	Latency   time.Duration
+
+	// Outcome is "success", "app-error", or the system error type if the call failed.
+	Outcome string
+}
+
+// AuditSink receives audit records. It is called once the call has completed,
+// and may be called concurrently for different calls.
+type AuditSink interface {
+	Audit(record AuditRecord)
+}
+
+// AuditSinkFunc is an adapter that allows a function to be used as an AuditSink.
+type AuditSinkFunc func(record AuditRecord)
+
+// Audit calls f(record).
+func (f AuditSinkFunc) Audit(record AuditRecord) {
+	f(record)
+}
+
+// AuditOptions configure auditing of inbound calls to sensitive operations.
+type AuditOptions struct {
+	// Sink receives a record for each audited call.
+	Sink AuditSink
+
+	// Operations maps a service name to the operations that are audited for that service.
+	// If the list of operations for a service is empty, all of its operations are audited.
+	Operations map[string][]string
+}
+
+// auditor decides which inbound calls are audited.
+type auditor struct {
+	sink       AuditSink
+	operations map[string]map[string]struct{}
+	redaction  *RedactionOptions
+}
+
+func newAuditor(opts *AuditOptions, redaction *RedactionOptions) *auditor {
+	if opts == nil || opts.Sink == nil {
+		return nil
+	}
+
+	a := &auditor{
+		sink:       opts.Sink,
+		operations: make(map[string]map[string]struct{}, len(opts.Operations)),
+		redaction:  redaction,
+	}
+	for service, operations := range opts.Operations {
+		ops := make(map[string]struct{}, len(operations))
+		for _, op := range operations {
+			ops[op] = struct{}{}
+		}
+		a.operations[service] = ops
+	}
+	return a
+}
+
+// audits returns whether calls to the given service and operation are audited.
+func (a *auditor) audits(service, operation string) bool {
+	ops, ok := a.operations[service]
+	if !ok {
+		return false
+	}
+	if len(ops) == 0 {
+		return true
+	}
+	_, ok = ops[operation]
+	return ok
+}
+
+// auditCall is the audit state for a single inbound call.
+type auditCall struct {
+	sink   AuditSink
+	ctx    context.Context
+	record AuditRecord
+}
+
+// forCall returns an auditCall if the call should be audited, or nil otherwise.
+func (a *auditor) forCall(ctx context.Context, call *InboundCall, callerPeer PeerInfo) *auditCall {
+	if a == nil || !a.audits(call.ServiceName(), string(call.Operation())) {
+		return nil
+	}
+
+	return &auditCall{
+		sink: a.sink,
+		ctx:  ctx,
+		record: AuditRecord{
+			Service:    call.ServiceName(),
+			Operation:  string(call.Operation()),
+			Caller:     call.CallerName(),
+			CallerPeer: callerPeer,
+			Headers:    a.redaction.redactHeaders(call.headers),
+		},
+	}
+}
+
+// finish completes the audit record with the outcome of the call and passes it to the sink.
+func (a *auditCall) finish(startedAt time.Time, outcome string, latency time.Duration) {
+	if a == nil {
+		return
+	}
+
+	record := a.record
+	record.RequestID = CurrentRequestID(a.ctx)
+	record.StartedAt = startedAt
+	record.Outcome = outcome
+	record.Latency = latency
+	a.sink.Audit(record)
+}
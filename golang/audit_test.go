@@ -0,0 +1,142 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+type recordingAuditSink struct {
+	sync.Mutex
+	records []AuditRecord
+}
+
+func (s *recordingAuditSink) Audit(record AuditRecord) {
+	s.Lock()
+	defer s.Unlock()
+	s.records = append(s.records, record)
+}
+
+func (s *recordingAuditSink) getRecords() []AuditRecord {
+	s.Lock()
+	defer s.Unlock()
+	return append([]AuditRecord(nil), s.records...)
+}
+
+func TestAudit(t *testing.T) {
+	sink := &recordingAuditSink{}
+	serverCh, err := NewChannel("audit-server", &ChannelOptions{
+		Audit: &AuditOptions{
+			Sink:       sink,
+			Operations: map[string][]string{"audit-server": {"sensitive", "busy"}},
+		},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer serverCh.Close()
+	require.NoError(t, serverCh.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	hostPort := serverCh.PeerInfo().HostPort
+
+	for _, op := range []string{"sensitive", "public"} {
+		testutils.RegisterFunc(t, serverCh, op, func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			return &raw.Res{Arg3: args.Arg3}, nil
+		})
+	}
+	testutils.RegisterFunc(t, serverCh, "busy", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{SystemErr: ErrServerBusy}, nil
+	})
+
+	clientCh, err := NewChannel("audit-client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer clientCh.Close()
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+
+	for _, op := range []string{"public", "sensitive", "busy"} {
+		raw.Call(ctx, clientCh, hostPort, "audit-server", op, nil, nil)
+	}
+
+	require.True(t, testutils.WaitFor(time.Second, func() bool {
+		return len(sink.getRecords()) == 2
+	}), "expected audit records for the configured operations only, got %v", sink.getRecords())
+
+	records := sink.getRecords()
+	success, busy := records[0], records[1]
+	if success.Operation != "sensitive" {
+		success, busy = busy, success
+	}
+
+	assert.Equal(t, "audit-server", success.Service)
+	assert.Equal(t, "sensitive", success.Operation)
+	assert.Equal(t, "audit-client", success.Caller)
+	assert.Equal(t, clientCh.PeerInfo().ProcessName, success.CallerPeer.ProcessName)
+	assert.NotEqual(t, "", success.RequestID, "audit record should contain the request ID")
+	assert.Equal(t, "success", success.Outcome)
+	assert.False(t, success.StartedAt.IsZero(), "audit record should contain the start time")
+
+	assert.Equal(t, "busy", busy.Operation)
+	assert.Equal(t, "busy", busy.Outcome)
+}
+
+func TestAuditAllOperations(t *testing.T) {
+	var records []AuditRecord
+	var mut sync.Mutex
+	sink := AuditSinkFunc(func(record AuditRecord) {
+		mut.Lock()
+		records = append(records, record)
+		mut.Unlock()
+	})
+
+	ch, err := NewChannel("audit-all", &ChannelOptions{
+		Audit: &AuditOptions{Sink: sink, Operations: map[string][]string{"audit-all": nil}},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+	require.NoError(t, ch.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+
+	testutils.RegisterFunc(t, ch, "op", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{IsErr: true}, nil
+	})
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	_, _, _, err = raw.Call(ctx, ch, ch.PeerInfo().HostPort, "audit-all", "op", nil, nil)
+	require.NoError(t, err, "Call failed")
+
+	require.True(t, testutils.WaitFor(time.Second, func() bool {
+		mut.Lock()
+		defer mut.Unlock()
+		return len(records) == 1
+	}), "expected a single audit record")
+	mut.Lock()
+	assert.Equal(t, "app-error", records[0].Outcome)
+	mut.Unlock()
+}
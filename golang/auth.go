@@ -0,0 +1,113 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Authenticator authenticates connections during the init handshake, using a token
+// sent in the init request by the peer initiating the connection.
+type Authenticator interface {
+	// Token returns the token to send when the local peer initiates a connection.
+	Token(local PeerInfo) (string, error)
+
+	// Authenticate validates the token sent by a remote peer that initiated a connection.
+	// The token is empty if the peer did not send one.
+	Authenticate(remote PeerInfo, token string) error
+}
+
+const defaultAuthMaxSkew = 5 * time.Minute
+
+var (
+	errAuthTokenMissing = errors.New("auth token missing")
+	errAuthTokenInvalid = errors.New("auth token invalid")
+	errAuthTokenExpired = errors.New("auth token expired")
+)
+
+// SharedSecretAuthenticator is an Authenticator for peers that share a secret. Tokens
+// contain a timestamp and an HMAC-SHA256 of the peer's information and the timestamp.
+//
+// Tokens are sent in the init request headers, which are not encrypted unless the
+// connection uses TLS, and they are not bound to the connection or the remote peer. Anyone
+// who observes a token can replay it to any peer that shares the secret until it is older
+// than MaxSkew. SharedSecretAuthenticator must only be used for connections that use TLS,
+// see TLSOptions and ListenTLS. Encryption does not protect the token, as the Noise
+// handshake starts after the init request is sent.
+type SharedSecretAuthenticator struct {
+	// Secret is the secret shared by all peers.
+	Secret []byte
+
+	// MaxSkew is how far a token's timestamp may be from the current time.
+	// Defaults to 5 minutes.
+	MaxSkew time.Duration
+}
+
+// Token implements Authenticator.
+func (a SharedSecretAuthenticator) Token(local PeerInfo) (string, error) {
+	timestamp := strconv.FormatInt(timeNow().Unix(), 10)
+	return timestamp + "." + a.sign(local, timestamp), nil
+}
+
+// Authenticate implements Authenticator.
+func (a SharedSecretAuthenticator) Authenticate(remote PeerInfo, token string) error {
+	if token == "" {
+		return errAuthTokenMissing
+	}
+
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return errAuthTokenInvalid
+	}
+	timestamp, signature := parts[0], parts[1]
+
+	expected := a.sign(remote, timestamp)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return errAuthTokenInvalid
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errAuthTokenInvalid
+	}
+
+	maxSkew := a.MaxSkew
+	if maxSkew <= 0 {
+		maxSkew = defaultAuthMaxSkew
+	}
+	skew := timeNow().Sub(time.Unix(seconds, 0))
+	if skew > maxSkew || skew < -maxSkew {
+		return errAuthTokenExpired
+	}
+	return nil
+}
+
+func (a SharedSecretAuthenticator) sign(peer PeerInfo, timestamp string) string {
+	mac := hmac.New(sha256.New, a.Secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s", peer.HostPort, peer.ProcessName, timestamp)
+	return hex.EncodeToString(mac.Sum(nil))
+}
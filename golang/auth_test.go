@@ -0,0 +1,88 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestSharedSecretAuthenticator(t *testing.T) {
+	auth := SharedSecretAuthenticator{Secret: []byte("secret")}
+	peer := PeerInfo{HostPort: "1.1.1.1:1", ProcessName: "client"}
+
+	nowFn := testutils.NowStub(GetTimeNow(), time.Unix(1000, 0))
+	defer testutils.ResetNowStub(GetTimeNow())
+
+	token, err := auth.Token(peer)
+	require.NoError(t, err, "Token failed")
+	assert.NoError(t, auth.Authenticate(peer, token), "valid token should be accepted")
+
+	other := PeerInfo{HostPort: "2.2.2.2:2", ProcessName: "client"}
+	assert.Error(t, auth.Authenticate(other, token), "token for another peer should be rejected")
+	assert.Error(t, SharedSecretAuthenticator{Secret: []byte("other")}.Authenticate(peer, token),
+		"token with a different secret should be rejected")
+	assert.Error(t, auth.Authenticate(peer, ""), "missing token should be rejected")
+	assert.Error(t, auth.Authenticate(peer, "garbage"), "malformed token should be rejected")
+
+	nowFn(10 * time.Minute)
+	assert.Error(t, auth.Authenticate(peer, token), "expired token should be rejected")
+}
+
+func TestInitAuthentication(t *testing.T) {
+	stats := newRecordingStatsReporter()
+	server, err := NewChannel("auth-svc", &ChannelOptions{
+		StatsReporter: stats,
+		Authenticator: SharedSecretAuthenticator{Secret: []byte("secret")},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+
+	ping := func(auth Authenticator) error {
+		client, err := NewChannel("auth-client", &ChannelOptions{Authenticator: auth})
+		require.NoError(t, err, "NewChannel failed")
+		defer client.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		return client.Ping(ctx, server.PeerInfo().HostPort)
+	}
+
+	assert.NoError(t, ping(SharedSecretAuthenticator{Secret: []byte("secret")}), "authenticated ping failed")
+
+	for _, auth := range []Authenticator{nil, SharedSecretAuthenticator{Secret: []byte("wrong")}} {
+		err := ping(auth)
+		require.Error(t, err, "unauthenticated connections should be rejected")
+		assert.Equal(t, ErrCodeProtocol, GetSystemErrorCode(err), "rejection should be a protocol error")
+		assert.True(t, strings.Contains(err.Error(), "authentication failed"), "unexpected error: %v", err)
+	}
+
+	failed := counterValue(stats, "inbound.connections.auth-failed")
+	assert.EqualValues(t, 2, failed, "failed authentications should be counted")
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPermissionDenied is a SystemError returned for calls that are not authorized.
+// The reason a call was denied is logged by the server, but not sent to the caller.
+var ErrPermissionDenied = NewSystemError(ErrCodeBadRequest, "permission denied")
+
+// AuthorizationRequest describes an inbound call that is checked by an Authorizer.
+type AuthorizationRequest struct {
+	Service   string
+	Operation string
+
+	// Caller is the service name of the caller, from the caller name transport header.
+	Caller string
+
+	// CallerPeer is the peer information the caller sent when initializing the connection.
+	CallerPeer PeerInfo
+
+	// Identity is the identity from the caller's verified TLS client certificate,
+	// or empty if the caller did not connect using mutual TLS.
+	Identity string
+
+	// Authenticated is whether the caller's connection was authenticated by the
+	// channel's Authenticator during the init handshake.
+	Authenticated bool
+}
+
+// Authorizer decides whether inbound calls are allowed. Calls that are denied fail with
+// ErrPermissionDenied, and the reason is logged. Authorize is called concurrently.
+type Authorizer interface {
+	Authorize(req AuthorizationRequest) (allow bool, reason string)
+}
+
+// AuthorizerFunc is an adapter that allows a function to be used as an Authorizer.
+type AuthorizerFunc func(req AuthorizationRequest) (allow bool, reason string)
+
+// Authorize calls f(req).
+func (f AuthorizerFunc) Authorize(req AuthorizationRequest) (bool, string) {
+	return f(req)
+}
+
+// permissionDeniedError is returned by authorize with the reason that a call is not
+// authorized. The caller is sent ErrPermissionDenied instead.
+type permissionDeniedError struct {
+	reason string
+}
+
+func newPermissionDeniedError(reason string) error {
+	return permissionDeniedError{reason}
+}
+
+func (e permissionDeniedError) Error() string {
+	return "permission denied: " + e.reason
+}
+
+// IsPermissionDenied returns whether the error is ErrPermissionDenied, returned for a
+// call that was not authorized.
+func IsPermissionDenied(err error) bool {
+	return errors.Is(err, ErrPermissionDenied)
+}
+
+// authorize returns nil if the call is authorized, or an error with the reason it is not.
+func (c *Connection) authorize(call *InboundCall) error {
+	if !c.tlsOptions.authorized(call) {
+		return newPermissionDeniedError(fmt.Sprintf("caller identity %q is not allowed", call.CallerIdentity()))
+	}
+	if err := c.admin.authorize(c, call); err != nil {
+		return err
+	}
+	if c.authorizer == nil {
+		return nil
+	}
+
+	allow, reason := c.authorizer.Authorize(AuthorizationRequest{
+		Service:       call.ServiceName(),
+		Operation:     string(call.Operation()),
+		Caller:        call.CallerName(),
+		CallerPeer:    c.remotePeerInfo,
+		Identity:      call.CallerIdentity(),
+		Authenticated: c.authenticated,
+	})
+	if allow {
+		return nil
+	}
+	return newPermissionDeniedError(reason)
+}
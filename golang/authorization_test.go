@@ -0,0 +1,107 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestAuthorizer(t *testing.T) {
+	var (
+		mut      sync.Mutex
+		requests []AuthorizationRequest
+	)
+	authorizer := AuthorizerFunc(func(req AuthorizationRequest) (bool, string) {
+		mut.Lock()
+		requests = append(requests, req)
+		mut.Unlock()
+
+		if req.Operation == "admin" && req.Caller != "admin-client" {
+			return false, "admin requires admin-client"
+		}
+		return true, ""
+	})
+
+	stats := newRecordingStatsReporter()
+	secret := SharedSecretAuthenticator{Secret: []byte("secret")}
+	server, err := NewChannel("authz-svc", &ChannelOptions{
+		StatsReporter: stats,
+		Authenticator: secret,
+		Authorizer:    authorizer,
+	})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+	for _, op := range []string{"admin", "public"} {
+		testutils.RegisterFunc(t, server, op, func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			return &raw.Res{}, nil
+		})
+	}
+
+	call := func(callerName, operation string) error {
+		client, err := NewChannel(callerName, &ChannelOptions{Authenticator: secret})
+		require.NoError(t, err, "NewChannel failed")
+		defer client.Close()
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		_, _, _, err = raw.Call(ctx, client, server.PeerInfo().HostPort, "authz-svc", operation, nil, nil)
+		return err
+	}
+
+	assert.NoError(t, call("user-client", "public"), "public call failed")
+	assert.NoError(t, call("admin-client", "admin"), "admin call failed")
+
+	err = call("user-client", "admin")
+	assert.True(t, IsPermissionDenied(err), "unauthorized call should be denied, got %v", err)
+	assert.NotContains(t, err.Error(), "admin requires admin-client", "the reason should not be sent to the caller")
+
+	mut.Lock()
+	require.Len(t, requests, 3, "authorizer should be consulted for each call")
+	assert.Equal(t, "authz-svc", requests[0].Service, "service mismatch")
+	assert.Equal(t, "public", requests[0].Operation, "operation mismatch")
+	assert.Equal(t, "user-client", requests[0].Caller, "caller mismatch")
+	assert.NotEmpty(t, requests[0].CallerPeer.HostPort, "caller peer should be set")
+	assert.True(t, requests[0].Authenticated, "connection should be authenticated")
+	mut.Unlock()
+
+	denied := counterValue(stats, "inbound.calls.permission-denied")
+	assert.EqualValues(t, 1, denied, "denied calls should be counted")
+}
+
+func TestIsPermissionDenied(t *testing.T) {
+	assert.False(t, IsPermissionDenied(nil), "nil is not permission denied")
+	assert.False(t, IsPermissionDenied(errors.New("permission denied: no")), "only system errors are permission denied")
+	assert.False(t, IsPermissionDenied(ErrTimeoutRequired), "other bad requests are not permission denied")
+	assert.False(t, IsPermissionDenied(NewSystemError(ErrCodeBadRequest, "permission denied: no")),
+		"errors with a similar message are not permission denied")
+	assert.True(t, IsPermissionDenied(ErrPermissionDenied), "ErrPermissionDenied mismatch")
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// Package batch coalesces many small, independent calls to the same peer and
+// operation into fewer calls.
+//
+// A Batcher queues calls made using Batcher.Call, and sends them as a single batch
+// call once MaxBatchSize calls are queued or MaxDelay has passed since the first one
+// was queued. The batch call has an empty arg2, and its arg3 holds the arg2 and arg3
+// of each call in the batch. The response's arg3 holds the result of each call, in
+// the same order.
+//
+// Handlers are registered using Wrap, which unbatches each batch call and passes the
+// calls to a raw.Handler one at a time, as if they had been sent individually. Calls
+// in a batch succeed or fail independently: an application or system error returned
+// for one call is only returned to that call's caller.
+package batch
+
+import (
+	"errors"
+	"math"
+
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/typed"
+)
+
+const (
+	// MaxBatchSize is the largest number of calls that can be sent in a single batch.
+	MaxBatchSize = math.MaxUint16
+
+	// statusOK, statusAppError and statusSystemError are the status of each result in
+	// a batch response.
+	statusOK          byte = 0
+	statusAppError    byte = 1
+	statusSystemError byte = 2
+)
+
+// ErrMalformedBatch is returned when a batch call or response cannot be decoded.
+var ErrMalformedBatch = errors.New("malformed batch")
+
+// entry is the arguments of a single call in a batch.
+type entry struct {
+	arg2, arg3 []byte
+}
+
+// result is the response to a single call in a batch.
+type result struct {
+	status byte
+
+	// code is the system error code, if status is statusSystemError.
+	code tchannel.SystemErrCode
+
+	arg2, arg3 []byte
+}
+
+// err returns the error that the caller of the call should see for the result.
+func (r result) err() error {
+	switch r.status {
+	case statusOK:
+		return nil
+	case statusAppError:
+		return raw.ErrAppError
+	default:
+		return tchannel.NewSystemError(r.code, "%s", r.arg3)
+	}
+}
+
+// encodeEntries encodes the arguments of the calls in a batch as a 2 byte count,
+// followed by the arg2 and arg3 of each call, each prefixed by a 4 byte length.
+func encodeEntries(entries []entry) []byte {
+	size := 2
+	for _, e := range entries {
+		size += 4 + len(e.arg2) + 4 + len(e.arg3)
+	}
+
+	buf := make([]byte, size)
+	wbuf := typed.NewWriteBuffer(buf)
+	wbuf.WriteUint16(uint16(len(entries)))
+	for _, e := range entries {
+		writeBytes(wbuf, e.arg2)
+		writeBytes(wbuf, e.arg3)
+	}
+	return buf
+}
+
+func decodeEntries(buf []byte) ([]entry, error) {
+	rbuf := typed.NewReadBuffer(buf)
+	entries := make([]entry, rbuf.ReadUint16())
+	for i := range entries {
+		entries[i].arg2 = readBytes(rbuf)
+		entries[i].arg3 = readBytes(rbuf)
+	}
+	if rbuf.Err() != nil || rbuf.BytesRemaining() > 0 {
+		return nil, ErrMalformedBatch
+	}
+	return entries, nil
+}
+
+// encodeResults encodes the results of the calls in a batch as a 2 byte count,
+// followed by the status, system error code, arg2 and arg3 of each result. The
+// args are prefixed by a 4 byte length.
+func encodeResults(results []result) []byte {
+	size := 2
+	for _, r := range results {
+		size += 1 + 1 + 4 + len(r.arg2) + 4 + len(r.arg3)
+	}
+
+	buf := make([]byte, size)
+	wbuf := typed.NewWriteBuffer(buf)
+	wbuf.WriteUint16(uint16(len(results)))
+	for _, r := range results {
+		wbuf.WriteSingleByte(r.status)
+		wbuf.WriteSingleByte(byte(r.code))
+		writeBytes(wbuf, r.arg2)
+		writeBytes(wbuf, r.arg3)
+	}
+	return buf
+}
+
+func decodeResults(buf []byte) ([]result, error) {
+	rbuf := typed.NewReadBuffer(buf)
+	results := make([]result, rbuf.ReadUint16())
+	for i := range results {
+		results[i].status = rbuf.ReadSingleByte()
+		results[i].code = tchannel.SystemErrCode(rbuf.ReadSingleByte())
+		results[i].arg2 = readBytes(rbuf)
+		results[i].arg3 = readBytes(rbuf)
+		if results[i].status > statusSystemError {
+			return nil, ErrMalformedBatch
+		}
+	}
+	if rbuf.Err() != nil || rbuf.BytesRemaining() > 0 {
+		return nil, ErrMalformedBatch
+	}
+	return results, nil
+}
+
+func writeBytes(wbuf *typed.WriteBuffer, b []byte) {
+	wbuf.WriteUint32(uint32(len(b)))
+	wbuf.WriteBytes(b)
+}
+
+func readBytes(rbuf *typed.ReadBuffer) []byte {
+	n := rbuf.ReadUint32()
+	if uint64(n) > uint64(rbuf.BytesRemaining()) {
+		// Read past the end so that the buffer records the error.
+		return rbuf.ReadBytes(rbuf.BytesRemaining() + 1)
+	}
+	return rbuf.ReadBytes(int(n))
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+type testHandler struct {
+	t *testing.T
+	f func(ctx context.Context, args *raw.Args) (*raw.Res, error)
+}
+
+func (h testHandler) Handle(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+	return h.f(ctx, args)
+}
+
+func (h testHandler) OnError(ctx context.Context, err error) {
+	h.t.Errorf("OnError(%v)", err)
+}
+
+func echo(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+	return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+}
+
+// withBatchServer registers f as the "batch" operation on a server, and runs test with
+// a client channel, the server's hostPort and a counter of the batch calls received.
+func withBatchServer(t *testing.T, f func(ctx context.Context, args *raw.Args) (*raw.Res, error),
+	test func(client *tchannel.Channel, hostPort string, batches *int32)) {
+
+	testutils.WithTestClientServer(t, nil, func(client, server *tchannel.Channel, hostPort string) {
+		var batches int32
+		h := Wrap(testHandler{t, f})
+		server.Register(tchannel.HandlerFunc(func(ctx context.Context, call *tchannel.InboundCall) {
+			atomic.AddInt32(&batches, 1)
+			h.Handle(ctx, call)
+		}), "batch")
+
+		test(client, hostPort, &batches)
+	})
+}
+
+func TestEncoding(t *testing.T) {
+	entries := []entry{{nil, nil}, {[]byte("a2"), []byte("a3")}, {nil, []byte("only arg3")}}
+	decoded, err := decodeEntries(encodeEntries(entries))
+	require.NoError(t, err, "decodeEntries failed")
+	require.Equal(t, len(entries), len(decoded), "Unexpected number of entries")
+	for i := range entries {
+		assert.Equal(t, string(entries[i].arg2), string(decoded[i].arg2), "Entry %v arg2 mismatch", i)
+		assert.Equal(t, string(entries[i].arg3), string(decoded[i].arg3), "Entry %v arg3 mismatch", i)
+	}
+
+	results := []result{
+		{status: statusOK, arg2: []byte("r2"), arg3: []byte("r3")},
+		{status: statusAppError, arg3: []byte("app")},
+		{status: statusSystemError, code: tchannel.ErrCodeBusy, arg3: []byte("busy")},
+	}
+	decodedResults, err := decodeResults(encodeResults(results))
+	require.NoError(t, err, "decodeResults failed")
+	require.Equal(t, len(results), len(decodedResults), "Unexpected number of results")
+	for i := range results {
+		assert.Equal(t, results[i].status, decodedResults[i].status, "Result %v status mismatch", i)
+		assert.Equal(t, results[i].code, decodedResults[i].code, "Result %v code mismatch", i)
+		assert.Equal(t, string(results[i].arg3), string(decodedResults[i].arg3), "Result %v arg3 mismatch", i)
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	valid := encodeEntries([]entry{{[]byte("arg2"), []byte("arg3")}})
+	tests := []struct {
+		msg string
+		buf []byte
+	}{
+		{"empty", nil},
+		{"truncated", valid[:len(valid)-1]},
+		{"trailing bytes", append(valid, 0)},
+		{"length past end", []byte{0, 1, 0xff, 0xff, 0xff, 0xff}},
+	}
+
+	for _, tt := range tests {
+		_, err := decodeEntries(tt.buf)
+		assert.Equal(t, ErrMalformedBatch, err, "%v: unexpected error", tt.msg)
+	}
+
+	_, err := decodeResults([]byte{0, 1, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	assert.Equal(t, ErrMalformedBatch, err, "Unknown status should fail")
+}
+
+func TestBatcherCoalescesCalls(t *testing.T) {
+	withBatchServer(t, echo, func(client *tchannel.Channel, hostPort string, batches *int32) {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		defer cancel()
+
+		const numCalls = 25
+		b := NewBatcher(client, hostPort, testutils.DefaultServerName, "batch", &Options{
+			MaxBatchSize: 10,
+			MaxDelay:     20 * time.Millisecond,
+		})
+		defer b.Close()
+
+		var wg sync.WaitGroup
+		for i := 0; i < numCalls; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				arg2, arg3 := []byte(fmt.Sprint("arg2-", i)), []byte(fmt.Sprint("arg3-", i))
+				respArg2, respArg3, err := b.Call(ctx, arg2, arg3)
+				if assert.NoError(t, err, "Call %v failed", i) {
+					assert.Equal(t, arg2, respArg2, "Call %v arg2 mismatch", i)
+					assert.Equal(t, arg3, respArg3, "Call %v arg3 mismatch", i)
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		n := atomic.LoadInt32(batches)
+		assert.True(t, n >= 3, "Batches are limited to 10 calls, got %v batches", n)
+		assert.True(t, n < numCalls, "Calls should be batched, got %v batches", n)
+	})
+}
+
+func TestBatcherMaxDelay(t *testing.T) {
+	withBatchServer(t, echo, func(client *tchannel.Channel, hostPort string, batches *int32) {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		defer cancel()
+
+		const maxDelay = 50 * time.Millisecond
+		b := NewBatcher(client, hostPort, testutils.DefaultServerName, "batch", &Options{MaxDelay: maxDelay})
+		defer b.Close()
+
+		started := time.Now()
+		_, arg3, err := b.Call(ctx, nil, []byte("hello"))
+		require.NoError(t, err, "Call failed")
+		assert.Equal(t, "hello", string(arg3), "Unexpected arg3")
+		assert.True(t, time.Since(started) >= maxDelay, "Call should wait for MaxDelay")
+		assert.Equal(t, int32(1), atomic.LoadInt32(batches), "Unexpected number of batches")
+	})
+}
+
+func TestBatcherErrors(t *testing.T) {
+	f := func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		switch string(args.Arg3) {
+		case "app":
+			return &raw.Res{IsErr: true, Arg3: []byte("app failed")}, nil
+		case "sys":
+			return &raw.Res{SystemErr: tchannel.ErrServerBusy}, nil
+		case "err":
+			return nil, errors.New("handler failed")
+		}
+		return echo(ctx, args)
+	}
+
+	withBatchServer(t, f, func(client *tchannel.Channel, hostPort string, batches *int32) {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		defer cancel()
+
+		tests := []struct {
+			arg3     string
+			wantErr  error
+			wantArg3 string
+		}{
+			{"ok", nil, "ok"},
+			{"app", raw.ErrAppError, "app failed"},
+			{"sys", tchannel.ErrServerBusy, ""},
+			{"err", raw.ErrAppError, "handler failed"},
+		}
+
+		b := NewBatcher(client, hostPort, testutils.DefaultServerName, "batch", &Options{
+			MaxBatchSize: len(tests),
+			MaxDelay:     time.Second,
+		})
+		defer b.Close()
+
+		var wg sync.WaitGroup
+		for _, tt := range tests {
+			wg.Add(1)
+			go func(arg3, wantArg3 string, wantErr error) {
+				defer wg.Done()
+				_, respArg3, err := b.Call(ctx, nil, []byte(arg3))
+				assert.Equal(t, wantErr, err, "%v: unexpected error", arg3)
+				assert.Equal(t, wantArg3, string(respArg3), "%v: unexpected arg3", arg3)
+			}(tt.arg3, tt.wantArg3, tt.wantErr)
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), atomic.LoadInt32(batches), "All calls should be in a single batch")
+	})
+}
+
+func TestBatcherClosed(t *testing.T) {
+	withBatchServer(t, echo, func(client *tchannel.Channel, hostPort string, batches *int32) {
+		b := NewBatcher(client, hostPort, testutils.DefaultServerName, "batch", nil)
+		_, _, err := b.Call(context.Background(), nil, nil)
+		assert.Equal(t, tchannel.ErrTimeoutRequired, err, "Calls without a deadline should fail")
+
+		b.Close()
+		ctx, cancel := tchannel.NewContext(time.Second)
+		defer cancel()
+		_, _, err = b.Call(ctx, nil, nil)
+		assert.Equal(t, ErrBatcherClosed, err, "Calls after Close should fail")
+	})
+}
+
+func TestMalformedBatchCall(t *testing.T) {
+	withBatchServer(t, echo, func(client *tchannel.Channel, hostPort string, batches *int32) {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		defer cancel()
+
+		_, _, _, err := raw.Call(ctx, client, hostPort, testutils.DefaultServerName, "batch", nil, []byte{0, 5})
+		assert.Equal(t, tchannel.ErrCodeBadRequest, tchannel.GetSystemErrorCode(err), "Unexpected error: %v", err)
+	})
+}
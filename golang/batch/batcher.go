@@ -0,0 +1,231 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/raw"
+	"golang.org/x/net/context"
+)
+
+const (
+	// DefaultMaxBatchSize is the batch size used if Options does not specify one.
+	DefaultMaxBatchSize = 100
+
+	// DefaultMaxDelay is the delay used if Options does not specify one.
+	DefaultMaxDelay = 5 * time.Millisecond
+)
+
+// ErrBatcherClosed is returned when Call is called after the Batcher is closed.
+var ErrBatcherClosed = errors.New("batcher is closed")
+
+// Options are options for a Batcher.
+type Options struct {
+	// MaxBatchSize is the number of queued calls that causes a batch to be sent
+	// immediately. It is capped at the package's MaxBatchSize.
+	MaxBatchSize int
+
+	// MaxDelay is the longest a call is queued before its batch is sent.
+	MaxDelay time.Duration
+}
+
+func (o *Options) maxBatchSize() int {
+	if o == nil || o.MaxBatchSize <= 0 {
+		return DefaultMaxBatchSize
+	}
+	if o.MaxBatchSize > MaxBatchSize {
+		return MaxBatchSize
+	}
+	return o.MaxBatchSize
+}
+
+func (o *Options) maxDelay() time.Duration {
+	if o == nil || o.MaxDelay <= 0 {
+		return DefaultMaxDelay
+	}
+	return o.MaxDelay
+}
+
+// pendingCall is a call that is queued or waiting for its batch's response.
+type pendingCall struct {
+	ctx   context.Context
+	entry entry
+	done  chan result
+
+	// err is set instead of sending a result if the batch call fails.
+	err error
+}
+
+// Batcher coalesces calls to an operation on a single peer into batch calls.
+// A Batcher is safe for concurrent use.
+type Batcher struct {
+	ch          *tchannel.Channel
+	hostPort    string
+	serviceName string
+	operation   string
+
+	maxBatchSize int
+	maxDelay     time.Duration
+
+	mut     sync.Mutex
+	pending []*pendingCall
+	timer   *time.Timer
+	closed  bool
+}
+
+// NewBatcher returns a Batcher that sends batches of calls to the given operation on
+// the peer at hostPort. The operation must be registered using Wrap.
+func NewBatcher(ch *tchannel.Channel, hostPort, serviceName, operation string, opts *Options) *Batcher {
+	return &Batcher{
+		ch:           ch,
+		hostPort:     hostPort,
+		serviceName:  serviceName,
+		operation:    operation,
+		maxBatchSize: opts.maxBatchSize(),
+		maxDelay:     opts.maxDelay(),
+	}
+}
+
+// Call queues a call with the given arguments, and returns the response args once the
+// batch containing the call completes. If the handler returns an application error,
+// the response args are returned with raw.ErrAppError. Like any other call, the
+// context must have a deadline.
+func (b *Batcher) Call(ctx context.Context, arg2, arg3 []byte) ([]byte, []byte, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		return nil, nil, tchannel.ErrTimeoutRequired
+	}
+
+	call := &pendingCall{
+		ctx:   ctx,
+		entry: entry{arg2, arg3},
+		done:  make(chan result, 1),
+	}
+
+	b.mut.Lock()
+	if b.closed {
+		b.mut.Unlock()
+		return nil, nil, ErrBatcherClosed
+	}
+	b.pending = append(b.pending, call)
+	if len(b.pending) >= b.maxBatchSize {
+		b.flushLocked()
+	} else if len(b.pending) == 1 {
+		b.timer = time.AfterFunc(b.maxDelay, b.Flush)
+	}
+	b.mut.Unlock()
+
+	select {
+	case res := <-call.done:
+		if call.err != nil {
+			return nil, nil, call.err
+		}
+		if res.status == statusSystemError {
+			return nil, nil, res.err()
+		}
+		return res.arg2, res.arg3, res.err()
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+// Flush sends any queued calls without waiting for MaxDelay.
+func (b *Batcher) Flush() {
+	b.mut.Lock()
+	b.flushLocked()
+	b.mut.Unlock()
+}
+
+// Close sends any queued calls. Calls made after Close return ErrBatcherClosed.
+func (b *Batcher) Close() {
+	b.mut.Lock()
+	b.closed = true
+	b.flushLocked()
+	b.mut.Unlock()
+}
+
+func (b *Batcher) flushLocked() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.pending) == 0 {
+		return
+	}
+
+	calls := b.pending
+	b.pending = nil
+	go b.send(calls)
+}
+
+// send sends a batch call for the given calls, and passes each call its result.
+func (b *Batcher) send(calls []*pendingCall) {
+	// Calls that have already timed out or been cancelled are not sent. The batch
+	// call uses the earliest deadline of the remaining calls.
+	var (
+		live     []*pendingCall
+		entries  []entry
+		deadline time.Time
+	)
+	for _, call := range calls {
+		if call.ctx.Err() != nil {
+			continue
+		}
+		live = append(live, call)
+		entries = append(entries, call.entry)
+		if d, _ := call.ctx.Deadline(); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+	if len(live) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	results, err := b.call(ctx, entries)
+	if err == nil && len(results) != len(live) {
+		err = ErrMalformedBatch
+	}
+	for i, call := range live {
+		if err != nil {
+			call.err = err
+			call.done <- result{}
+			continue
+		}
+		call.done <- results[i]
+	}
+}
+
+func (b *Batcher) call(ctx context.Context, entries []entry) ([]result, error) {
+	_, arg3, resp, err := raw.Call(ctx, b.ch, b.hostPort, b.serviceName, b.operation, nil, encodeEntries(entries))
+	if err != nil {
+		return nil, err
+	}
+	if resp.ApplicationError() {
+		return nil, fmt.Errorf("batch call failed: %s", arg3)
+	}
+	return decodeResults(arg3)
+}
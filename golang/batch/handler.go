@@ -0,0 +1,98 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package batch
+
+import (
+	"sync"
+
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/raw"
+	"golang.org/x/net/context"
+)
+
+// Wrap wraps a raw.Handler as a tchannel.Handler for batch calls sent by a Batcher.
+// Each call in a batch is passed to the handler with its own Args, and the calls in
+// a batch are handled concurrently.
+func Wrap(handler raw.Handler) tchannel.Handler {
+	return tchannel.HandlerFunc(func(ctx context.Context, call *tchannel.InboundCall) {
+		var arg2, arg3 []byte
+		if err := tchannel.NewArgReader(call.Arg2Reader()).Read(&arg2); err != nil {
+			handler.OnError(ctx, err)
+			return
+		}
+		if err := tchannel.NewArgReader(call.Arg3Reader()).Read(&arg3); err != nil {
+			handler.OnError(ctx, err)
+			return
+		}
+
+		response := call.Response()
+		entries, err := decodeEntries(arg3)
+		if err != nil {
+			err = tchannel.NewBadRequestError("invalid batch", err)
+			if err := response.SendSystemError(err); err != nil {
+				handler.OnError(ctx, err)
+			}
+			return
+		}
+
+		results := make([]result, len(entries))
+		var wg sync.WaitGroup
+		for i, e := range entries {
+			args := &raw.Args{
+				Caller:    call.CallerName(),
+				Format:    call.Format(),
+				Operation: string(call.Operation()),
+				Arg2:      e.arg2,
+				Arg3:      e.arg3,
+			}
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i] = handle(ctx, handler, args)
+			}(i)
+		}
+		wg.Wait()
+
+		if err := tchannel.NewArgWriter(response.Arg2Writer()).Write(nil); err != nil {
+			handler.OnError(ctx, err)
+			return
+		}
+		if err := tchannel.NewArgWriter(response.Arg3Writer()).Write(encodeResults(results)); err != nil {
+			handler.OnError(ctx, err)
+		}
+	})
+}
+
+// handle runs the handler for a single call in a batch, and returns its result.
+func handle(ctx context.Context, handler raw.Handler, args *raw.Args) result {
+	resp, err := handler.Handle(ctx, args)
+	if err != nil {
+		return result{status: statusAppError, arg3: []byte(err.Error())}
+	}
+
+	if resp.SystemErr != nil {
+		code := tchannel.GetSystemErrorCode(resp.SystemErr)
+		return result{status: statusSystemError, code: code, arg3: []byte(resp.SystemErr.Error())}
+	}
+	if resp.IsErr {
+		return result{status: statusAppError, arg2: resp.Arg2, arg3: resp.Arg3}
+	}
+	return result{status: statusOK, arg2: resp.Arg2, arg3: resp.Arg3}
+}
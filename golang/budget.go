@@ -0,0 +1,110 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// ErrBudgetExhausted is a SystemError indicating that the time remaining for a call is
+// below the minimum timeout for downstream calls, so the call was not made.
+var ErrBudgetExhausted = NewSystemError(ErrCodeTimeout, "timeout budget exhausted")
+
+// BudgetOptions configure how a TimeoutBudget assigns timeouts to downstream calls.
+type BudgetOptions struct {
+	// Reserve is the time kept back from downstream calls so the handler has time
+	// to process their responses and reply before its own deadline.
+	Reserve time.Duration
+
+	// Floor is the minimum timeout for a downstream call. Calls that would have a shorter
+	// timeout fail with ErrBudgetExhausted instead of being made.
+	Floor time.Duration
+}
+
+// TimeoutBudget assigns timeouts to the downstream calls made while handling a call,
+// based on the time remaining before the call's deadline.
+type TimeoutBudget struct {
+	ctx      context.Context
+	deadline time.Time
+	opts     BudgetOptions
+}
+
+// NewTimeoutBudget returns a budget for downstream calls made using the given context,
+// which is typically the context of an inbound call. The context must have a deadline.
+func NewTimeoutBudget(ctx context.Context, opts BudgetOptions) (*TimeoutBudget, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil, ErrTimeoutRequired
+	}
+	return &TimeoutBudget{ctx: ctx, deadline: deadline, opts: opts}, nil
+}
+
+// Remaining returns the time available for downstream calls, which excludes the reserve.
+func (b *TimeoutBudget) Remaining() time.Duration {
+	remaining := b.deadline.Sub(timeNow()) - b.opts.Reserve
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// Fixed returns a context for a downstream call with the given timeout, or the
+// remaining budget if it is shorter.
+func (b *TimeoutBudget) Fixed(timeout time.Duration) (ContextWithHeaders, context.CancelFunc, error) {
+	if remaining := b.Remaining(); timeout > remaining {
+		timeout = remaining
+	}
+	return b.withTimeout(timeout)
+}
+
+// Fraction returns a context for a downstream call with the given fraction of the remaining budget.
+func (b *TimeoutBudget) Fraction(fraction float64) (ContextWithHeaders, context.CancelFunc, error) {
+	if fraction > 1 {
+		fraction = 1
+	}
+	return b.withTimeout(time.Duration(float64(b.Remaining()) * fraction))
+}
+
+// Split returns a context for the next of the given number of sequential downstream calls,
+// splitting the remaining budget evenly between them. As calls that finish early leave
+// more time for later calls, callers should pass the number of calls left to make.
+func (b *TimeoutBudget) Split(calls int) (ContextWithHeaders, context.CancelFunc, error) {
+	if calls < 1 {
+		calls = 1
+	}
+	return b.withTimeout(b.Remaining() / time.Duration(calls))
+}
+
+// withTimeout returns a context derived from the budget's context with the given timeout,
+// which keeps the application headers of the budget's context.
+func (b *TimeoutBudget) withTimeout(timeout time.Duration) (ContextWithHeaders, context.CancelFunc, error) {
+	if timeout <= 0 || timeout < b.opts.Floor {
+		return nil, nil, ErrBudgetExhausted
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, timeout)
+	var headers map[string]string
+	if headerCtx, ok := b.ctx.(ContextWithHeaders); ok {
+		headers = headerCtx.Headers()
+	}
+	return WrapWithHeaders(ctx, headers), cancel, nil
+}
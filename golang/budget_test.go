@@ -0,0 +1,93 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+// budgetTimeout returns the timeout of a context returned by a TimeoutBudget.
+func budgetTimeout(t *testing.T, ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok, "budget context should have a deadline")
+	return deadline.Sub(time.Now())
+}
+
+func TestTimeoutBudget(t *testing.T) {
+	ctx, cancel := NewContextBuilder(time.Second).AddHeader("k", "v").Build()
+	defer cancel()
+
+	budget, err := NewTimeoutBudget(ctx, BudgetOptions{Reserve: 200 * time.Millisecond})
+	require.NoError(t, err, "NewTimeoutBudget failed")
+	assert.InDelta(t, 800*time.Millisecond, budget.Remaining(), float64(50*time.Millisecond), "Remaining should exclude the reserve")
+
+	fixedCtx, fixedCancel, err := budget.Fixed(100 * time.Millisecond)
+	require.NoError(t, err, "Fixed failed")
+	defer fixedCancel()
+	assert.InDelta(t, 100*time.Millisecond, budgetTimeout(t, fixedCtx), float64(50*time.Millisecond), "Fixed timeout mismatch")
+	assert.Equal(t, map[string]string{"k": "v"}, fixedCtx.Headers(), "headers should be kept")
+
+	cappedCtx, cappedCancel, err := budget.Fixed(time.Minute)
+	require.NoError(t, err, "Fixed failed")
+	defer cappedCancel()
+	assert.InDelta(t, 800*time.Millisecond, budgetTimeout(t, cappedCtx), float64(50*time.Millisecond), "Fixed should be capped by the budget")
+
+	fractionCtx, fractionCancel, err := budget.Fraction(0.5)
+	require.NoError(t, err, "Fraction failed")
+	defer fractionCancel()
+	assert.InDelta(t, 400*time.Millisecond, budgetTimeout(t, fractionCtx), float64(50*time.Millisecond), "Fraction timeout mismatch")
+
+	splitCtx, splitCancel, err := budget.Split(4)
+	require.NoError(t, err, "Split failed")
+	defer splitCancel()
+	assert.InDelta(t, 200*time.Millisecond, budgetTimeout(t, splitCtx), float64(50*time.Millisecond), "Split timeout mismatch")
+
+	cancel()
+	<-fixedCtx.Done()
+	assert.Equal(t, context.Canceled, fixedCtx.Err(), "cancelling the parent should cancel budget contexts")
+}
+
+func TestTimeoutBudgetFloor(t *testing.T) {
+	ctx, cancel := NewContext(100 * time.Millisecond)
+	defer cancel()
+
+	budget, err := NewTimeoutBudget(ctx, BudgetOptions{Reserve: 50 * time.Millisecond, Floor: 20 * time.Millisecond})
+	require.NoError(t, err, "NewTimeoutBudget failed")
+
+	_, _, err = budget.Fraction(0.1)
+	assert.Equal(t, ErrBudgetExhausted, err, "calls below the floor should be refused")
+
+	_, _, err = budget.Split(10)
+	assert.Equal(t, ErrBudgetExhausted, err, "calls below the floor should be refused")
+
+	_, fixedCancel, err := budget.Fixed(30 * time.Millisecond)
+	assert.NoError(t, err, "calls above the floor should be allowed")
+	fixedCancel()
+
+	_, err = NewTimeoutBudget(context.Background(), BudgetOptions{})
+	assert.Equal(t, ErrTimeoutRequired, err, "budgets require a deadline")
+}
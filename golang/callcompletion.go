@@ -0,0 +1,73 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// callCompletion releases the resources held by a call once it completes, whether or not
+// its stats are recorded. Only the first outcome for a call is used, since a failing call
+// may fail on multiple paths.
+type callCompletion struct {
+	clock       Clock
+	startedAt   time.Time
+	limiter     *concurrencyLimiter
+	tagPolicy   *tagPolicy
+	dedup       *dedupCall
+	intercepted *interceptedCall
+	completed   uint32
+}
+
+// tryComplete returns whether this is the first outcome for the call.
+func (c *callCompletion) tryComplete() bool {
+	return c != nil && atomic.CompareAndSwapUint32(&c.completed, 0, 1)
+}
+
+// succeeded releases the call's resources after it completed, possibly with an
+// application error.
+func (c *callCompletion) succeeded(appError bool, latency time.Duration) {
+	if !c.tryComplete() {
+		return
+	}
+
+	c.limiter.release(latency)
+	c.tagPolicy.release()
+	c.dedup.finish(true, appError)
+	c.intercepted.after(CallOutcome{ApplicationError: appError, Latency: latency})
+}
+
+// failed releases the call's resources after it failed with the given error.
+func (c *callCompletion) failed(err error) {
+	if !c.tryComplete() {
+		return
+	}
+
+	// Calls that fail before they are dispatched have no latency.
+	var latency time.Duration
+	if !c.startedAt.IsZero() {
+		latency = c.clock.Now().Sub(c.startedAt)
+	}
+	c.limiter.release(latency)
+	c.tagPolicy.release()
+	c.dedup.finish(false, false)
+	c.intercepted.after(CallOutcome{Err: err, Latency: latency})
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+type recordingInterceptor struct {
+	outcomes []CallOutcome
+}
+
+func (i *recordingInterceptor) Before(ctx context.Context, call *CallInfo) (context.Context, error) {
+	return ctx, nil
+}
+
+func (i *recordingInterceptor) After(ctx context.Context, call *CallInfo, outcome CallOutcome) {
+	i.outcomes = append(i.outcomes, outcome)
+}
+
+func TestCallCompletion(t *testing.T) {
+	policy := &tagPolicy{ConnectionPolicy: ConnectionPolicy{MaxConcurrentCalls: 1}}
+	interceptor := &recordingInterceptor{}
+	newCompletion := func(startedAt time.Time) *callCompletion {
+		assert.NoError(t, policy.acquire(), "acquire failed")
+		return &callCompletion{
+			clock:       systemClock{},
+			startedAt:   startedAt,
+			tagPolicy:   policy,
+			intercepted: &interceptedCall{inbound: []InboundInterceptor{interceptor}},
+		}
+	}
+
+	// A call that fails before it is dispatched has no latency, and is only released once.
+	c := newCompletion(time.Time{})
+	c.failed(ErrServerBusy)
+	c.failed(ErrTimeout)
+	c.succeeded(false, time.Second)
+	assert.Equal(t, int32(0), policy.inFlight, "tag policy should be released once")
+	assert.Equal(t, []CallOutcome{{Err: ErrServerBusy}}, interceptor.outcomes, "unexpected outcomes")
+
+	c = newCompletion(time.Now())
+	c.succeeded(true, time.Second)
+	c.failed(ErrTimeout)
+	assert.Equal(t, int32(0), policy.inFlight, "tag policy should be released once")
+	assert.Equal(t, CallOutcome{ApplicationError: true, Latency: time.Second}, interceptor.outcomes[1],
+		"unexpected outcome")
+}
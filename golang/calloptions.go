@@ -20,6 +20,13 @@
 
 package tchannel
 
+import (
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
 // Format is the arg scheme used for a specific call.
 type Format string
 
@@ -43,10 +50,96 @@ type CallOptions struct {
 
 	// ShardKey determines where this call request belongs, used with ringpop applications.
 	ShardKey string
+
+	// RoutingDelegate is the service that the call should be routed through, sent in the
+	// "rd" header.
+	RoutingDelegate string
+
+	// CallerName overrides the caller name sent in the "cn" header, which defaults to the
+	// channel's service name. It is used by services that make calls on behalf of others.
+	CallerName string
+
+	// IdempotencyKey identifies retries of the same request, sent in the "ik" header.
+	IdempotencyKey string
+
+	// PayloadSignature is the signature of the call's arguments, sent in the "ps" header.
+	// Signatures are created using Channel.SignPayload.
+	PayloadSignature string
+
+	// ContentHash is the hash of the call's arg3, sent in the "ch" header. Hashes are
+	// created using Channel.HashContent.
+	ContentHash string
+
+	// Heartbeat requests progress messages from the handler's peer while the call is
+	// handled, sent in the "hb" header. It is used by calls that may legitimately take
+	// a long time, so they can fail quickly if the peer stops responding.
+	Heartbeat *HeartbeatOptions
+
+	// Stream configures flow control for calls that stream arguments, limiting how much
+	// of the response is buffered and failing the call if the stream stalls.
+	Stream *StreamOptions
+
+	// The following options are used by the call helpers in the raw, json and thrift
+	// packages, and are ignored by BeginCall. See WithCallOptions.
+
+	// Timeout limits the time allowed for the call, including any retries. The context's
+	// deadline is used if it is earlier.
+	Timeout time.Duration
+
+	// RetryOptions replaces the retry options in the context. Helpers that make calls
+	// using a subchannel retry calls when this is set.
+	RetryOptions *RetryOptions
+
+	// Headers are application headers sent in addition to the headers in the context,
+	// replacing any context headers with the same name. They are not used by raw calls,
+	// as raw arg2 is opaque.
+	Headers map[string]string
 }
 
 var defaultCallOptions = &CallOptions{}
 
+// WithCallOptions returns a copy of ctx for making a call with the given options using a
+// call helper: the deadline is limited by opts.Timeout, and opts.RetryOptions replaces the
+// context's retry options. The cancel function must be called once the call completes.
+func WithCallOptions(ctx context.Context, opts *CallOptions) (context.Context, context.CancelFunc) {
+	if opts == nil {
+		return ctx, func() {}
+	}
+
+	cancel := context.CancelFunc(func() {})
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+	if opts.RetryOptions != nil {
+		params := &tchannelCtxParams{retryOptions: opts.RetryOptions}
+		if prev := getTChannelParams(ctx); prev != nil {
+			params.span = prev.span
+			params.call = prev.call
+			params.options = prev.options
+			params.requestID = prev.getRequestID()
+		}
+		ctx = context.WithValue(ctx, contextKeyTChannel, params)
+	}
+	return ctx, cancel
+}
+
+// AppHeaders returns the application headers for a call made by a call helper, which are
+// the headers in the context with the options' Headers added.
+func (c *CallOptions) AppHeaders(ctxHeaders map[string]string) map[string]string {
+	if c == nil || len(c.Headers) == 0 {
+		return ctxHeaders
+	}
+
+	headers := make(map[string]string, len(ctxHeaders)+len(c.Headers))
+	for k, v := range ctxHeaders {
+		headers[k] = v
+	}
+	for k, v := range c.Headers {
+		headers[k] = v
+	}
+	return headers
+}
+
 func (c *CallOptions) setHeaders(headers transportHeaders) {
 	headers[ArgScheme] = Raw.String()
 	c.overrideHeaders(headers)
@@ -60,6 +153,24 @@ func (c *CallOptions) overrideHeaders(headers transportHeaders) {
 	if c.ShardKey != "" {
 		headers[ShardKey] = c.ShardKey
 	}
+	if c.RoutingDelegate != "" {
+		headers[RoutingDelegate] = c.RoutingDelegate
+	}
+	if c.CallerName != "" {
+		headers[CallerName] = c.CallerName
+	}
+	if c.IdempotencyKey != "" {
+		headers[IdempotencyKey] = c.IdempotencyKey
+	}
+	if c.PayloadSignature != "" {
+		headers[PayloadSignature] = c.PayloadSignature
+	}
+	if c.ContentHash != "" {
+		headers[ContentHash] = c.ContentHash
+	}
+	if c.Heartbeat != nil && c.Heartbeat.Interval > 0 {
+		headers[Heartbeat] = strconv.FormatInt(int64(c.Heartbeat.interval()/time.Millisecond), 10)
+	}
 }
 
 // setResponseHeaders copies some headers from the incoming call request to the response.
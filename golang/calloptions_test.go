@@ -22,8 +22,10 @@ package tchannel
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSetHeaders(t *testing.T) {
@@ -51,3 +53,49 @@ func TestSetHeaders(t *testing.T) {
 		assert.Equal(t, tt.expectedHeaders, headers)
 	}
 }
+
+func TestWithCallOptions(t *testing.T) {
+	ctx, cancel := NewContextBuilder(time.Minute).
+		SetShardKey("shard").
+		SetRequestID("request-id").
+		SetRetryOptions(&RetryOptions{MaxAttempts: 2}).
+		Build()
+	defer cancel()
+
+	callCtx, callCancel := WithCallOptions(ctx, nil)
+	callCancel()
+	assert.Equal(t, ctx, callCtx, "nil options should not change the context")
+
+	retryOpts := &RetryOptions{MaxAttempts: 7}
+	callCtx, callCancel = WithCallOptions(ctx, &CallOptions{Timeout: time.Second, RetryOptions: retryOpts})
+	deadline, ok := callCtx.Deadline()
+	require.True(t, ok, "context should have a deadline")
+	assert.WithinDuration(t, time.Now().Add(time.Second), deadline, 100*time.Millisecond, "timeout should limit the deadline")
+	assert.Equal(t, retryOpts, currentRetryOptions(callCtx), "retry options should be replaced")
+	assert.Equal(t, "shard", currentCallOptions(callCtx).ShardKey, "call options should be kept")
+	assert.Equal(t, "request-id", CurrentRequestID(callCtx), "request ID should be kept")
+	callCancel()
+	assert.Error(t, callCtx.Err(), "cancel should cancel the call context")
+	assert.NoError(t, ctx.Err(), "cancel should not cancel the original context")
+
+	// The timeout cannot extend the context's deadline.
+	shortCtx, shortCancel := NewContext(time.Millisecond)
+	defer shortCancel()
+	callCtx, callCancel = WithCallOptions(shortCtx, &CallOptions{Timeout: time.Minute})
+	defer callCancel()
+	shortDeadline, _ := shortCtx.Deadline()
+	deadline, _ = callCtx.Deadline()
+	assert.Equal(t, shortDeadline, deadline, "earlier context deadline should be used")
+}
+
+func TestAppHeaders(t *testing.T) {
+	ctxHeaders := map[string]string{"a": "ctx", "b": "ctx"}
+	var nilOpts *CallOptions
+	assert.Equal(t, ctxHeaders, nilOpts.AppHeaders(ctxHeaders))
+	assert.Equal(t, ctxHeaders, (&CallOptions{}).AppHeaders(ctxHeaders))
+
+	opts := &CallOptions{Headers: map[string]string{"b": "opts", "c": "opts"}}
+	assert.Equal(t, map[string]string{"a": "ctx", "b": "opts", "c": "opts"}, opts.AppHeaders(ctxHeaders))
+	assert.Equal(t, map[string]string{"a": "ctx", "b": "ctx"}, ctxHeaders, "context headers should not be modified")
+	assert.Equal(t, opts.Headers, opts.AppHeaders(nil))
+}
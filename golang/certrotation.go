@@ -0,0 +1,169 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+)
+
+var errNoCertificate = errors.New("certificate loader returned no certificate")
+
+// CertificateReloader holds a TLS certificate that can be reloaded from disk or a callback
+// without restarting the channel. New TLS connections use the most recently loaded certificate.
+type CertificateReloader struct {
+	load func() (*tls.Certificate, error)
+
+	mut  sync.RWMutex
+	cert *tls.Certificate
+}
+
+// NewCertificateReloader returns a CertificateReloader that loads certificates using the
+// given function. The certificate is loaded immediately, and an error is returned if it
+// cannot be loaded.
+func NewCertificateReloader(load func() (*tls.Certificate, error)) (*CertificateReloader, error) {
+	r := &CertificateReloader{load: load}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// NewFileCertificateReloader returns a CertificateReloader that loads a PEM encoded
+// certificate and key from the given files.
+func NewFileCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	return NewCertificateReloader(func() (*tls.Certificate, error) {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return &cert, nil
+	})
+}
+
+// Reload loads the certificate again. If the certificate cannot be loaded, the
+// previous certificate continues to be used.
+func (r *CertificateReloader) Reload() error {
+	_, err := r.reload()
+	return err
+}
+
+// reload loads the certificate, and returns whether the certificate changed.
+func (r *CertificateReloader) reload() (bool, error) {
+	cert, err := r.load()
+	if err != nil {
+		return false, err
+	}
+	if cert == nil || len(cert.Certificate) == 0 {
+		return false, errNoCertificate
+	}
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	changed := r.cert == nil || !bytes.Equal(r.cert.Certificate[0], cert.Certificate[0])
+	r.cert = cert
+	return changed, nil
+}
+
+// Certificate returns the current certificate.
+func (r *CertificateReloader) Certificate() *tls.Certificate {
+	r.mut.RLock()
+	defer r.mut.RUnlock()
+	return r.cert
+}
+
+// GetCertificate returns the current certificate, and can be used as tls.Config.GetCertificate.
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// GetClientCertificate returns the current certificate, and can be used as
+// tls.Config.GetClientCertificate.
+func (r *CertificateReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// withCertificates returns a copy of the config that uses the reloadable certificate,
+// if there is one.
+func (o *TLSOptions) withCertificates(config *tls.Config) *tls.Config {
+	if o == nil || o.Certificates == nil {
+		return config
+	}
+	config = config.Clone()
+	config.Certificates = nil
+	config.GetCertificate = o.Certificates.GetCertificate
+	config.GetClientCertificate = o.Certificates.GetClientCertificate
+	return config
+}
+
+func isTLSConn(conn net.Conn) bool {
+	_, ok := conn.(*tls.Conn)
+	return ok
+}
+
+// RotateCertificates reloads the certificate in the channel's TLS options, which is used
+// for all new TLS connections. If CycleConnections is set and the certificate changed,
+// existing TLS connections are closed gracefully, so that peers reconnect using the
+// new certificate.
+func (ch *Channel) RotateCertificates() error {
+	if ch.tlsOptions == nil || ch.tlsOptions.Certificates == nil {
+		return errors.New("channel does not have reloadable certificates")
+	}
+
+	changed, err := ch.tlsOptions.Certificates.reload()
+	if err != nil {
+		ch.statsReporter.IncCounter("tls.rotation.failed", ch.commonStatsTags, 1)
+		return err
+	}
+	if !changed {
+		return nil
+	}
+
+	ch.log.Infof("Rotated TLS certificate")
+	ch.statsReporter.IncCounter("tls.rotation.succeeded", ch.commonStatsTags, 1)
+	if ch.tlsOptions.CycleConnections {
+		ch.cycleTLSConnections()
+	}
+	return nil
+}
+
+// cycleTLSConnections gracefully closes all active TLS connections.
+func (ch *Channel) cycleTLSConnections() {
+	var conns []*Connection
+	ch.mutable.mut.RLock()
+	conns = append(conns, ch.mutable.conns...)
+	ch.mutable.mut.RUnlock()
+	for _, peer := range ch.peers.Copy() {
+		peer.mut.RLock()
+		conns = append(conns, peer.connections...)
+		peer.mut.RUnlock()
+	}
+
+	for _, c := range conns {
+		if c.usesTLS && c.IsActive() {
+			c.log.Debugf("Closing TLS connection after certificate rotation")
+			c.Close()
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func writeCertificate(t *testing.T, cert tls.Certificate, certFile, keyFile string) {
+	keyDER, err := x509.MarshalECPrivateKey(cert.PrivateKey.(*ecdsa.PrivateKey))
+	require.NoError(t, err, "MarshalECPrivateKey failed")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	require.NoError(t, ioutil.WriteFile(certFile, certPEM, 0600), "failed to write certificate")
+	require.NoError(t, ioutil.WriteFile(keyFile, keyPEM, 0600), "failed to write key")
+}
+
+func TestFileCertificateReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tchannel-certs")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	ca := newTestCA(t)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	_, err = NewFileCertificateReloader(certFile, keyFile)
+	assert.Error(t, err, "reloader should fail if the files do not exist")
+
+	first := ca.issue(t)
+	writeCertificate(t, first, certFile, keyFile)
+	reloader, err := NewFileCertificateReloader(certFile, keyFile)
+	require.NoError(t, err, "NewFileCertificateReloader failed")
+	assert.Equal(t, first.Certificate, reloader.Certificate().Certificate, "certificate mismatch")
+
+	second := ca.issue(t)
+	writeCertificate(t, second, certFile, keyFile)
+	require.NoError(t, reloader.Reload(), "Reload failed")
+	assert.Equal(t, second.Certificate, reloader.Certificate().Certificate, "certificate should be reloaded")
+
+	require.NoError(t, ioutil.WriteFile(certFile, []byte("invalid"), 0600), "failed to write certificate")
+	assert.Error(t, reloader.Reload(), "Reload should fail for an invalid certificate")
+	assert.Equal(t, second.Certificate, reloader.Certificate().Certificate, "previous certificate should still be used")
+}
+
+func TestRotateCertificates(t *testing.T) {
+	ca := newTestCA(t)
+	server, err := testutils.NewServer(&testutils.ChannelOpts{
+		ServiceName:     "tls-svc",
+		TLS:             &TLSOptions{ClientCAs: ca.pool},
+		ServerTLSConfig: &tls.Config{Certificates: []tls.Certificate{ca.issue(t)}},
+	})
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "whoami", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg3: []byte(CallerIdentity(ctx))}, nil
+	})
+
+	tests := []struct {
+		cycle        bool
+		wantIdentity string
+	}{
+		{cycle: false, wantIdentity: "spiffe://test/old"},
+		{cycle: true, wantIdentity: "spiffe://test/new"},
+	}
+
+	for _, tt := range tests {
+		var mut sync.Mutex
+		current := ca.issue(t, "spiffe://test/old")
+		reloader, err := NewCertificateReloader(func() (*tls.Certificate, error) {
+			mut.Lock()
+			defer mut.Unlock()
+			cert := current
+			return &cert, nil
+		})
+		require.NoError(t, err, "NewCertificateReloader failed")
+
+		client, err := NewChannel("tls-client", &ChannelOptions{
+			TLS: &TLSOptions{
+				Config:           &tls.Config{RootCAs: ca.pool},
+				Certificates:     reloader,
+				CycleConnections: tt.cycle,
+			},
+		})
+		require.NoError(t, err, "NewChannel failed")
+
+		whoami := func() string {
+			ctx, cancel := NewContext(time.Second)
+			defer cancel()
+			_, arg3, _, err := raw.Call(ctx, client, server.PeerInfo().HostPort, "tls-svc", "whoami", nil, nil)
+			require.NoError(t, err, "whoami failed")
+			return string(arg3)
+		}
+		assert.Equal(t, "spiffe://test/old", whoami(), "identity mismatch before rotation")
+
+		mut.Lock()
+		current = ca.issue(t, "spiffe://test/new")
+		mut.Unlock()
+		require.NoError(t, client.RotateCertificates(), "RotateCertificates failed")
+
+		// Calls made while the old connection is closing may still use it.
+		var identity string
+		for i := 0; i < 10; i++ {
+			if identity = whoami(); identity == tt.wantIdentity {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Equal(t, tt.wantIdentity, identity, "identity mismatch after rotation with cycle = %v", tt.cycle)
+		client.Close()
+	}
+}
+
+func TestRotateCertificatesWithoutReloader(t *testing.T) {
+	ch, err := NewChannel("svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+	assert.Error(t, ch.RotateCertificates(), "RotateCertificates should fail without a reloader")
+}
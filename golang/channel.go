@@ -21,12 +21,15 @@
 package tchannel
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/context"
@@ -45,6 +48,9 @@ const (
 	ephemeralHostPort = "0.0.0.0:0"
 )
 
+// nextChannelID gives an ID for each channel for debugging purposes.
+var nextChannelID uint32
+
 // TraceReporterFactory is the interface of the method to generate TraceReporter instance.
 type TraceReporterFactory func(*Channel) TraceReporter
 
@@ -56,6 +62,15 @@ type ChannelOptions struct {
 	// The name of the process, for logging and reporting to peers
 	ProcessName string
 
+	// ProcessInfo is structured information about the process that is sent to peers
+	// during the init handshake. If set, unset fields use defaults, and the default
+	// process name includes the host and version.
+	ProcessInfo *ProcessInfo
+
+	// PeerPolicy validates the information that remote peers send during the init
+	// handshake, such as requiring a non-empty process name.
+	PeerPolicy *PeerPolicy
+
 	// The logger to use for this channel
 	Logger Logger
 
@@ -67,6 +82,156 @@ type ChannelOptions struct {
 
 	// Trace reporter factory to generate trace reporter instance.
 	TraceReporterFactory TraceReporterFactory
+
+	// SlowCallThreshold is the duration after which a call is considered slow.
+	// Inbound calls whose handler takes longer, and outbound calls whose round trip
+	// takes longer, are logged and counted. Slow call detection is disabled if zero.
+	SlowCallThreshold time.Duration
+
+	// PayloadSampler enables sampling of call payloads for debugging. Sampled calls
+	// can be retrieved using PayloadSamples or the introspection endpoint.
+	PayloadSampler *PayloadSamplerOptions
+
+	// EnableIntrospection exposes the channel's runtime state to peers using the
+	// IntrospectOperation endpoint. The endpoint is disabled by default, as it reveals
+	// internal details such as peers and sampled payloads to any caller that passes
+	// the Authorizer.
+	EnableIntrospection bool
+
+	// LatencyAwarePeerSelection prefers peers with a lower round trip time when selecting
+	// a peer for a call. Round trip times are measured using the PingInterval connection option.
+	LatencyAwarePeerSelection bool
+
+	// FrameTap observes every frame sent and received on the channel's connections,
+	// which can be used to build wire-level debugging and traffic recording tools.
+	FrameTap *FrameTapOptions
+
+	// Faults injects faults such as latency, dropped frames and closed connections into
+	// the channel's connections, for resilience testing. They can be changed using SetFaults.
+	Faults *FaultOptions
+
+	// StrictConformance checks every frame received on the channel's connections against
+	// the protocol spec. Violations are logged and counted, and call requests that violate
+	// the spec are rejected with a bad request error. See CheckConformance.
+	StrictConformance bool
+
+	// DevMode enables checks that reject outbound calls made with contexts that have no
+	// deadline, a very long deadline, or no tchannel metadata. It is intended for use in
+	// development and tests.
+	DevMode *DevModeOptions
+
+	// Audit configures an audit hook that records each inbound call to the configured
+	// operations, including the caller's identity and the outcome of the call.
+	Audit *AuditOptions
+
+	// LeakDetector enables a background watchdog that logs and counts message exchanges
+	// that are still active long after their deadline, along with the stack that created them.
+	LeakDetector *LeakDetectorOptions
+
+	// RetryBudget limits the retries made using SubChannel.RunWithRetry. Each subchannel
+	// has a separate budget. Retries are not limited if RetryBudget is nil.
+	RetryBudget *RetryBudgetOptions
+
+	// OutboundScheduler queues outbound calls to peers that have too many calls in
+	// progress, sending interactive calls before batch calls. Calls are not queued if
+	// OutboundScheduler is nil.
+	OutboundScheduler *OutboundSchedulerOptions
+
+	// CircuitBreaker enables circuit breakers for outbound calls, which fail calls to a peer
+	// and operation fast with ErrCircuitOpen when the calls' error rate is too high.
+	CircuitBreaker *CircuitBreakerOptions
+
+	// ConcurrencyLimiter enables an adaptive limit on the number of inbound calls handled
+	// concurrently, rejecting calls over the limit with ErrServerBusy.
+	ConcurrencyLimiter *ConcurrencyLimiterOptions
+
+	// Deduplication enables deduplication of inbound calls that set the idempotency key
+	// transport header, returning the original response for repeated calls.
+	Deduplication *DeduplicationOptions
+
+	// AdmissionController is consulted before each inbound call is dispatched, and may
+	// reject calls based on load signals supplied using SetAdmissionSignals.
+	AdmissionController AdmissionController
+
+	// TLS enables TLS for outbound connections. Inbound TLS connections are accepted
+	// using ListenTLS.
+	TLS *TLSOptions
+
+	// Authenticator authenticates connections during the init handshake. Outbound
+	// connections send a token from the authenticator, and inbound connections that
+	// fail authentication are rejected with a protocol error. Tokens are sent in
+	// cleartext unless the connection uses TLS.
+	Authenticator Authenticator
+
+	// Authorizer is consulted for each inbound call, and calls that it denies fail
+	// with ErrPermissionDenied.
+	Authorizer Authorizer
+
+	// DuplicateRegistration is how a handler registered for an operation that already
+	// has a handler is handled. By default, the handler is replaced and a warning is logged.
+	DuplicateRegistration DuplicateRegistrationPolicy
+
+	// Admin enables the admin service, which exposes privileged operations such as
+	// changing the log level or draining the channel, see AdminOptions.
+	Admin *AdminOptions
+
+	// IPFilter accepts or rejects inbound connections by their remote address, before
+	// the init handshake. The ranges can be updated using SetIPFilter.
+	IPFilter *IPFilterOptions
+
+	// Redaction removes sensitive information from call headers and payloads before
+	// they are captured by the payload sampler or included in audit records.
+	Redaction *RedactionOptions
+
+	// PayloadSigning enables verification of payload signatures on inbound calls, and
+	// signing of outbound calls made using the raw package or SignPayload.
+	PayloadSigning *PayloadSigningOptions
+
+	// ContentHash enables verification of content hashes on inbound calls, and sending
+	// content hashes for outbound calls made using the raw package or HashContent.
+	ContentHash *ContentHashOptions
+
+	// Encryption enables encryption of connections using a Noise handshake during the
+	// init handshake, for environments where TLS is not available.
+	Encryption *EncryptionOptions
+
+	// Quotas enforces per-caller quotas for inbound calls. Calls over a quota fail
+	// with ErrQuotaExceeded.
+	Quotas *QuotaOptions
+
+	// ConnectionTagging tags connections when they are accepted or dialed, and applies
+	// limits, timeouts and logging verbosity to inbound calls based on the tag.
+	ConnectionTagging *ConnectionTaggingOptions
+
+	// RelayHosts enables relaying. Calls for services that RelayHosts returns a
+	// destination for are forwarded frame by frame to that destination, instead of
+	// being handled by this channel. Relayed calls are not checked by this channel, so
+	// RelayHosts cannot be used with the options that check inbound calls: Authorizer,
+	// TLS authorization policies, required payload signatures, Quotas, AdmissionController
+	// and ConcurrencyLimiter. These checks should be configured on the destination instead.
+	RelayHosts RelayHosts
+
+	// Dialer creates outbound connections to peers, instead of connecting over TCP. It can
+	// be used to reach peers through other transports, such as WebSocket. If TLS is
+	// configured for a peer, the TLS handshake is done over the returned connection.
+	Dialer func(hostPort string) (net.Conn, error)
+
+	// Proxy configures SOCKS5 or HTTP CONNECT proxies for outbound connections. If a
+	// Dialer is also set, it is used to connect to the proxy.
+	Proxy *ProxyOptions
+
+	// AsyncWorkers is the number of workers that deliver the results of calls made
+	// using CallAsync. Defaults to DefaultAsyncWorkers. Set it to 1 to call the
+	// callbacks one at a time, in the order that calls complete.
+	AsyncWorkers int
+
+	// Clock is the source of time for backoffs, pings, and other timing behavior, see Clock.
+	// Defaults to SystemClock.
+	Clock Clock
+
+	// Profile is a preset of options for a common kind of workload, such as
+	// ProfileLowLatency, which is used for any of its options that are not set.
+	Profile *ChannelProfile
 }
 
 // ChannelState is the state of a channel.
@@ -99,13 +264,53 @@ const (
 // want to receive requests should call one of Serve or ListenAndServe
 // TODO(prashant): Shutdown all subchannels + peers when channel is closed.
 type Channel struct {
+	chID                 uint32
 	log                  Logger
 	commonStatsTags      map[string]string
 	statsReporter        StatsReporter
 	traceReporter        TraceReporter
 	traceReporterFactory TraceReporterFactory
 	connectionOptions    ConnectionOptions
+	framePoolStats       *statsFramePool
+	inboundStats         *endpointStatsMap
+	outboundStats        *endpointStatsMap
+	slowCallThreshold    time.Duration
+	payloadSampler       *payloadSampler
+	latencyAwarePeers    bool
+	frameTap             *FrameTapOptions
+	faults               *faultInjector
+	strictConformance    bool
+	devMode              *devMode
+	auditor              *auditor
+	leakDetector         *leakDetector
+	retryBudgetOptions   *RetryBudgetOptions
+	outboundScheduler    *outboundScheduler
+	duplicates           DuplicateRegistrationPolicy
+	circuitBreakers      *circuitBreakers
+	inboundLimiter       *concurrencyLimiter
+	deduplicator         *deduplicator
+	admission            *admission
+	tlsOptions           *TLSOptions
+	authenticator        Authenticator
+	peerPolicy           *PeerPolicy
+	authorizer           Authorizer
+	admin                *adminService
+	ipFilter             ipFilter
+	payloadSigning       *PayloadSigningOptions
+	contentHash          *ContentHashOptions
+	encryption           *EncryptionOptions
+	quotas               *quotaEnforcer
+	connTagger           *connectionTagger
+	relayHosts           RelayHosts
+	dialer               func(hostPort string) (net.Conn, error)
+	proxyOptions         *ProxyOptions
+	clock                Clock
+	asyncPool            *asyncPool
+	interceptors         *interceptors
+	profile              *ChannelProfile
 	handlers             *handlerMap
+	internalHandlers     map[string]Handler
+	runtimeOptions       *runtimeOptionsStore
 	peers                *PeerList
 	subChannels          *subChannelMap
 
@@ -116,6 +321,7 @@ type Channel struct {
 		peerInfo LocalPeerInfo // May be ephemeral if this is a client only channel
 		l        net.Listener  // May be nil if this is a client only channel
 		conns    []*Connection
+		draining bool
 	}
 }
 
@@ -130,14 +336,23 @@ func NewChannel(serviceName string, opts *ChannelOptions) (*Channel, error) {
 	if opts == nil {
 		opts = &ChannelOptions{}
 	}
+	if opts.Profile != nil {
+		opts = opts.Profile.apply(opts)
+	}
+	if err := checkRelayOptions(opts); err != nil {
+		return nil, err
+	}
 
 	logger := opts.Logger
 	if logger == nil {
 		logger = NullLogger
 	}
 
+	processInfo := opts.ProcessInfo.withDefaults()
 	processName := opts.ProcessName
-	if processName == "" {
+	if processName == "" && processInfo != nil {
+		processName = processInfo.processName()
+	} else if processName == "" {
 		processName = fmt.Sprintf("%s[%d]", filepath.Base(os.Args[0]), os.Getpid())
 	}
 
@@ -146,12 +361,61 @@ func NewChannel(serviceName string, opts *ChannelOptions) (*Channel, error) {
 		statsReporter = NullStatsReporter
 	}
 
+	clock := opts.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+
 	ch := &Channel{
+		chID:              atomic.AddUint32(&nextChannelID, 1),
 		connectionOptions: opts.DefaultConnectionOptions,
 		log:               logger.WithFields(LogField{"service", serviceName}),
 		statsReporter:     statsReporter,
 		handlers:          &handlerMap{},
 		subChannels:       &subChannelMap{},
+		inboundStats:      newEndpointStatsMap(),
+		outboundStats:     newEndpointStatsMap(),
+		slowCallThreshold: opts.SlowCallThreshold,
+		payloadSampler:    newPayloadSampler(opts.PayloadSampler, opts.Redaction),
+		latencyAwarePeers: opts.LatencyAwarePeerSelection,
+		frameTap:          opts.FrameTap,
+		faults:            newFaultInjector(opts.Faults),
+		strictConformance: opts.StrictConformance,
+		auditor:           newAuditor(opts.Audit, opts.Redaction),
+
+		retryBudgetOptions: opts.RetryBudget,
+		outboundScheduler:  newOutboundScheduler(opts.OutboundScheduler),
+		duplicates:         opts.DuplicateRegistration,
+		profile:            opts.Profile,
+		circuitBreakers:    newCircuitBreakers(opts.CircuitBreaker, statsReporter, clock),
+		inboundLimiter:     newConcurrencyLimiter(opts.ConcurrencyLimiter, clock),
+		deduplicator:       newDeduplicator(opts.Deduplication, clock),
+		admission:          newAdmission(opts.AdmissionController),
+		tlsOptions:         opts.TLS,
+		authenticator:      opts.Authenticator,
+		peerPolicy:         opts.PeerPolicy,
+		authorizer:         opts.Authorizer,
+		payloadSigning:     opts.PayloadSigning,
+		contentHash:        opts.ContentHash,
+		encryption:         opts.Encryption,
+		quotas:             newQuotaEnforcer(opts.Quotas),
+		connTagger:         newConnectionTagger(opts.ConnectionTagging),
+		relayHosts:         opts.RelayHosts,
+		dialer:             opts.Dialer,
+		proxyOptions:       opts.Proxy,
+		clock:              clock,
+		asyncPool:          newAsyncPool(opts.AsyncWorkers),
+		interceptors:       &interceptors{},
+	}
+
+	if err := ch.ipFilter.update(opts.IPFilter); err != nil {
+		return nil, err
+	}
+
+	// The admin service can change the log level, so all logging goes through its logger.
+	ch.admin = newAdminService(ch, opts.Admin, ch.log)
+	if ch.admin != nil {
+		ch.log = ch.admin.logger
 	}
 
 	traceReporter := opts.TraceReporter
@@ -162,17 +426,36 @@ func NewChannel(serviceName string, opts *ChannelOptions) (*Channel, error) {
 		traceReporter = NullReporter
 	}
 	ch.traceReporter = traceReporter
+	ch.handlers.onDuplicate = ch.duplicates.onDuplicate(ch.log)
+	ch.devMode = newDevMode(opts.DevMode, ch.log)
 
 	ch.mutable.peerInfo = LocalPeerInfo{
 		PeerInfo: PeerInfo{
 			ProcessName: processName,
 			HostPort:    ephemeralHostPort,
+			Process:     processInfo,
 		},
 		ServiceName: serviceName,
 	}
 	ch.mutable.state = ChannelClient
 	ch.peers = newPeerList(ch)
+	if opts.EnableIntrospection {
+		ch.internalHandlers = ch.createInternalHandlers()
+	}
+	ch.runtimeOptions = newRuntimeOptionsStore(ch, opts)
+
+	// Track frame pool usage for the connections that use the default connection options.
+	ch.framePoolStats = newStatsFramePool(ch.connectionOptions.FramePool)
+	ch.connectionOptions.FramePool = ch.framePoolStats
+
+	ch.leakDetector = newLeakDetector(ch, opts.LeakDetector)
+	if ch.admin != nil {
+		ch.admin.register()
+	}
+
+	registerChannel(ch)
 	ch.createCommonStats()
+	ch.leakDetector.start()
 	return ch, nil
 }
 
@@ -245,9 +528,35 @@ type Registrar interface {
 	Peers() *PeerList
 }
 
-// Register registers a handler for a service+operation pair
+// OperationRegistrar is a Registrar that also records the arg scheme and metadata of
+// each operation, which are listed by SubChannel.Operations.
+type OperationRegistrar interface {
+	Registrar
+
+	// RegisterOperation registers a handler for ServiceName and the given operation.
+	RegisterOperation(h Handler, op OperationInfo)
+}
+
+// RegisterOperation registers a handler for the given operation with the registrar,
+// recording the operation's information if the registrar is an OperationRegistrar.
+func RegisterOperation(registrar Registrar, h Handler, op OperationInfo) {
+	if r, ok := registrar.(OperationRegistrar); ok {
+		r.RegisterOperation(h, op)
+		return
+	}
+	registrar.Register(h, op.Name)
+}
+
+// Register registers a handler for a service+operation pair. The operation name may be
+// a pattern such as "admin::*", see SubChannel.Register for details.
 func (ch *Channel) Register(h Handler, operationName string) {
-	ch.handlers.register(h, ch.PeerInfo().ServiceName, operationName)
+	ch.RegisterOperation(h, OperationInfo{Name: operationName})
+}
+
+// RegisterOperation registers a handler for an operation, like Register, and records
+// the operation's arg scheme and metadata.
+func (ch *Channel) RegisterOperation(h Handler, op OperationInfo) {
+	ch.handlers.registerOperation(h, ch.PeerInfo().ServiceName, op)
 }
 
 // PeerInfo returns the current peer info for the channel
@@ -310,7 +619,7 @@ func (ch *Channel) serve() {
 					acceptBackoff = max
 				}
 				ch.log.Warnf("accept error: %v; retrying in %v", err, acceptBackoff)
-				time.Sleep(acceptBackoff)
+				ch.clock.Sleep(acceptBackoff)
 				continue
 			} else {
 				// Only log an error if this didn't happen due to a Close.
@@ -324,17 +633,34 @@ func (ch *Channel) serve() {
 
 		acceptBackoff = 0
 
-		// Register the connection in the peer once the channel is set up.
-		events := connectionEvents{
-			OnActive:           ch.incomingConnectionActive,
-			OnCloseStateChange: ch.connectionCloseStateChange,
-		}
-		if _, err := ch.newInboundConnection(netConn, events, &ch.connectionOptions); err != nil {
-			// Server is getting overloaded - begin rejecting new connections
-			ch.log.Errorf("could not create new TChannelConnection for incoming conn: %v", err)
+		if !ch.ipFilter.allowed(netConn.RemoteAddr()) {
+			ch.log.Debugf("Rejecting connection from %v as it is not allowed by the IP filter", netConn.RemoteAddr())
+			ch.statsReporter.IncCounter("inbound.connections.rejected", ch.commonStatsTags, 1)
 			netConn.Close()
 			continue
 		}
+
+		if tlsConn, ok := netConn.(*tls.Conn); ok {
+			// Handshake in a separate goroutine so slow clients do not block new connections.
+			go ch.serveTLSConnection(tlsConn)
+			continue
+		}
+		ch.serveConnection(netConn)
+	}
+}
+
+// serveConnection creates a Connection for an accepted connection.
+func (ch *Channel) serveConnection(netConn net.Conn) {
+	// Register the connection in the peer once the channel is set up.
+	events := connectionEvents{
+		OnActive:              ch.incomingConnectionActive,
+		OnCloseStateChange:    ch.connectionCloseStateChange,
+		OnMessageIDsExhausted: ch.cycleInboundConnection,
+	}
+	if _, err := ch.newInboundConnection(netConn, events, &ch.connectionOptions); err != nil {
+		// Server is getting overloaded - begin rejecting new connections
+		ch.log.Errorf("could not create new TChannelConnection for incoming conn: %v", err)
+		netConn.Close()
 	}
 }
 
@@ -369,6 +695,22 @@ func (ch *Channel) StatsTags() map[string]string {
 	return m
 }
 
+// ServiceNames returns the sorted names of the services that the channel serves: the
+// channel's own service, and the services of subchannels that have handlers registered
+// or a NotFound handler set. A channel can serve any number of services over the same
+// listener, and inbound calls are dispatched to the subchannel for the called service.
+func (ch *Channel) ServiceNames() []string {
+	own := ch.PeerInfo().ServiceName
+	names := []string{own}
+	for _, serviceName := range ch.subChannels.serviceNames() {
+		if serviceName != own && ch.subChannels.serves(serviceName) {
+			names = append(names, serviceName)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 // ServiceName returns the serviceName that this channel was created for.
 func (ch *Channel) ServiceName() string {
 	return ch.PeerInfo().ServiceName
@@ -387,7 +729,12 @@ func (ch *Channel) Connect(ctx context.Context, hostPort string, connectionOptio
 		return nil, errInvalidStateForOp
 	}
 
-	events := connectionEvents{OnCloseStateChange: ch.connectionCloseStateChange}
+	events := connectionEvents{
+		OnCloseStateChange: ch.connectionCloseStateChange,
+		OnMessageIDsExhausted: func(c *Connection) {
+			ch.cycleOutboundConnection(c, hostPort)
+		},
+	}
 	c, err := ch.newOutboundConnection(hostPort, events, connectionOptions)
 	if err != nil {
 		return nil, err
@@ -473,6 +820,55 @@ func (ch *Channel) State() ChannelState {
 	return state
 }
 
+// StartDrain marks the channel as draining. A draining channel continues to serve calls,
+// but health checks report it as not ready, so load balancers and routers can stop
+// sending it traffic before it is closed. Connected peers that support drain notices
+// are notified, and stop selecting the channel for new calls.
+func (ch *Channel) StartDrain() {
+	ch.mutable.mut.Lock()
+	ch.mutable.draining = true
+	ch.mutable.mut.Unlock()
+	ch.notifyDraining(true)
+}
+
+// StopDrain stops draining a channel that was marked as draining by StartDrain. It has
+// no effect on a channel that is closing.
+func (ch *Channel) StopDrain() {
+	ch.mutable.mut.Lock()
+	ch.mutable.draining = false
+	ch.mutable.mut.Unlock()
+	ch.notifyDraining(false)
+}
+
+// Draining returns whether the channel is draining, either because StartDrain
+// was called or because the channel is closing.
+func (ch *Channel) Draining() bool {
+	ch.mutable.mut.RLock()
+	draining := ch.mutable.draining || ch.mutable.state >= ChannelStartClose
+	ch.mutable.mut.RUnlock()
+	return draining
+}
+
+// CloseIdleConnections gracefully closes all active connections that have no inbound or
+// outbound calls in progress, and returns the number of connections that were closed.
+// New connections are created as needed for later calls.
+func (ch *Channel) CloseIdleConnections() int {
+	ch.mutable.mut.RLock()
+	conns := append([]*Connection(nil), ch.mutable.conns...)
+	ch.mutable.mut.RUnlock()
+
+	closed := 0
+	for _, c := range conns {
+		if !c.IsActive() || c.inbound.count() > 0 || c.outbound.count() > 0 {
+			continue
+		}
+		if err := c.Close(); err == nil {
+			closed++
+		}
+	}
+	return closed
+}
+
 // Close starts a graceful Close for the channel. This does not happen immediately:
 // 1. This call closes the Listener and starts closing connections.
 // 2. When all incoming connections are drainged, the connection blocks new outgoing calls.
@@ -490,5 +886,7 @@ func (ch *Channel) Close() {
 	}
 	ch.mutable.mut.Unlock()
 
+	unregisterChannel(ch)
+	ch.leakDetector.stop()
 	ch.peers.Close()
 }
@@ -0,0 +1,171 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import "time"
+
+// ChannelProfile is a preset of channel options for a common kind of workload, which can
+// be set as ChannelOptions.Profile. Options that are set explicitly in ChannelOptions take
+// precedence over the profile's options.
+type ChannelProfile struct {
+	// Name identifies the profile.
+	Name string
+
+	// ConnectionOptions are used for any fields of ChannelOptions.DefaultConnectionOptions
+	// that are not set.
+	ConnectionOptions ConnectionOptions
+
+	// Timeouts are the initial timeouts of the channel's subchannels, see SubChannel.SetTimeouts.
+	Timeouts TimeoutOptions
+
+	// SlowCallThreshold is used if ChannelOptions.SlowCallThreshold is not set.
+	SlowCallThreshold time.Duration
+
+	// LatencyAwarePeerSelection enables latency aware peer selection if it is set.
+	LatencyAwarePeerSelection bool
+
+	// ConcurrencyLimiter is used if ChannelOptions.ConcurrencyLimiter is not set.
+	ConcurrencyLimiter *ConcurrencyLimiterOptions
+
+	// RetryBudget is used if ChannelOptions.RetryBudget is not set.
+	RetryBudget *RetryBudgetOptions
+}
+
+var (
+	// ProfileLowLatency is for services that handle small requests with tight latency
+	// requirements. It uses short timeouts, and an adaptive concurrency limit that rejects
+	// calls rather than queueing them, so callers can retry on another peer.
+	ProfileLowLatency = ChannelProfile{
+		Name: "low-latency",
+		ConnectionOptions: ConnectionOptions{
+			FramePool:      NewSyncFramePool(),
+			RecvBufferSize: 512,
+			SendBufferSize: 512,
+			ChecksumType:   ChecksumTypeCrc32C,
+			PingInterval:   5 * time.Second,
+		},
+		Timeouts: TimeoutOptions{
+			Default:    500 * time.Millisecond,
+			MaxInbound: time.Second,
+		},
+		SlowCallThreshold:         100 * time.Millisecond,
+		LatencyAwarePeerSelection: true,
+		ConcurrencyLimiter: &ConcurrencyLimiterOptions{
+			InitialLimit: 20,
+			MinLimit:     5,
+			MaxLimit:     500,
+		},
+	}
+
+	// ProfileBulkTransfer is for services that send large or streamed payloads. It uses
+	// large send and receive buffers and long timeouts, and does not limit concurrency.
+	ProfileBulkTransfer = ChannelProfile{
+		Name: "bulk-transfer",
+		ConnectionOptions: ConnectionOptions{
+			FramePool:      NewSyncFramePool(),
+			RecvBufferSize: 4096,
+			SendBufferSize: 4096,
+			ChecksumType:   ChecksumTypeCrc32C,
+		},
+		Timeouts: TimeoutOptions{
+			Default: 30 * time.Second,
+		},
+		SlowCallThreshold: 10 * time.Second,
+	}
+
+	// ProfileHighFanout is for services that call many peers for each request. It uses
+	// small buffers to limit the memory used by its many connections, a retry budget so
+	// retries cannot amplify an outage across peers, and an adaptive concurrency limit
+	// that queues a small number of calls.
+	ProfileHighFanout = ChannelProfile{
+		Name: "high-fanout",
+		ConnectionOptions: ConnectionOptions{
+			FramePool:      NewSyncFramePool(),
+			RecvBufferSize: 128,
+			SendBufferSize: 128,
+			ChecksumType:   ChecksumTypeCrc32,
+			PingInterval:   30 * time.Second,
+		},
+		Timeouts: TimeoutOptions{
+			Default:    time.Second,
+			MaxInbound: 5 * time.Second,
+		},
+		SlowCallThreshold:         time.Second,
+		LatencyAwarePeerSelection: true,
+		ConcurrencyLimiter: &ConcurrencyLimiterOptions{
+			InitialLimit: 100,
+			MinLimit:     20,
+			MaxLimit:     2000,
+			MaxQueueSize: 100,
+		},
+		RetryBudget: &RetryBudgetOptions{
+			Ratio:               0.1,
+			MinRetriesPerSecond: 10,
+		},
+	}
+)
+
+// apply returns a copy of opts with the profile's options used for any options that
+// are not set.
+func (p *ChannelProfile) apply(opts *ChannelOptions) *ChannelOptions {
+	applied := *opts
+
+	connOpts := &applied.DefaultConnectionOptions
+	if connOpts.FramePool == nil {
+		connOpts.FramePool = p.ConnectionOptions.FramePool
+	}
+	if connOpts.RecvBufferSize == 0 {
+		connOpts.RecvBufferSize = p.ConnectionOptions.RecvBufferSize
+	}
+	if connOpts.SendBufferSize == 0 {
+		connOpts.SendBufferSize = p.ConnectionOptions.SendBufferSize
+	}
+	if connOpts.ChecksumType == ChecksumTypeNone {
+		connOpts.ChecksumType = p.ConnectionOptions.ChecksumType
+	}
+	if connOpts.PingInterval == 0 {
+		connOpts.PingInterval = p.ConnectionOptions.PingInterval
+	}
+	if connOpts.StallTimeout == 0 {
+		connOpts.StallTimeout = p.ConnectionOptions.StallTimeout
+	}
+	if connOpts.ReadTimeout == 0 {
+		connOpts.ReadTimeout = p.ConnectionOptions.ReadTimeout
+	}
+	if connOpts.WriteTimeout == 0 {
+		connOpts.WriteTimeout = p.ConnectionOptions.WriteTimeout
+	}
+
+	if applied.SlowCallThreshold == 0 {
+		applied.SlowCallThreshold = p.SlowCallThreshold
+	}
+	if p.LatencyAwarePeerSelection {
+		applied.LatencyAwarePeerSelection = true
+	}
+	if applied.ConcurrencyLimiter == nil && p.ConcurrencyLimiter != nil {
+		limiter := *p.ConcurrencyLimiter
+		applied.ConcurrencyLimiter = &limiter
+	}
+	if applied.RetryBudget == nil && p.RetryBudget != nil {
+		budget := *p.RetryBudget
+		applied.RetryBudget = &budget
+	}
+	return &applied
+}
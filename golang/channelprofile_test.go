@@ -0,0 +1,68 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelProfileApply(t *testing.T) {
+	profile := &ProfileLowLatency
+	limiter := &ConcurrencyLimiterOptions{InitialLimit: 1}
+	opts := &ChannelOptions{
+		DefaultConnectionOptions: ConnectionOptions{SendBufferSize: 10},
+		ConcurrencyLimiter:       limiter,
+		Profile:                  profile,
+	}
+
+	applied := profile.apply(opts)
+	assert.Equal(t, 10, applied.DefaultConnectionOptions.SendBufferSize, "explicit options should take precedence")
+	assert.Equal(t, 512, applied.DefaultConnectionOptions.RecvBufferSize, "unset options should use the profile")
+	assert.Equal(t, ChecksumTypeCrc32C, applied.DefaultConnectionOptions.ChecksumType, "checksum should use the profile")
+	assert.Equal(t, profile.ConnectionOptions.FramePool, applied.DefaultConnectionOptions.FramePool, "frame pool should use the profile")
+	assert.Equal(t, profile.SlowCallThreshold, applied.SlowCallThreshold, "slow call threshold should use the profile")
+	assert.True(t, applied.LatencyAwarePeerSelection, "latency aware peer selection should be enabled")
+	assert.True(t, limiter == applied.ConcurrencyLimiter, "explicit limiter should take precedence")
+	assert.Nil(t, applied.RetryBudget, "profile without a retry budget should not set one")
+
+	assert.Equal(t, 0, opts.DefaultConnectionOptions.RecvBufferSize, "apply should not modify the given options")
+
+	applied = ProfileHighFanout.apply(&ChannelOptions{})
+	require.NotNil(t, applied.RetryBudget, "retry budget should use the profile")
+	assert.Equal(t, *ProfileHighFanout.RetryBudget, *applied.RetryBudget, "retry budget mismatch")
+	assert.False(t, ProfileHighFanout.RetryBudget == applied.RetryBudget, "profile options should be copied")
+}
+
+func TestChannelProfileTimeouts(t *testing.T) {
+	ch, err := NewChannel("svc", &ChannelOptions{Profile: &ProfileBulkTransfer})
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+
+	sc := ch.GetSubChannel("downstream")
+	assert.Equal(t, 30*time.Second, sc.defaultTimeout("op"), "subchannel should use the profile's timeouts")
+
+	sc.SetTimeouts(TimeoutOptions{Default: time.Second})
+	assert.Equal(t, time.Second, sc.defaultTimeout("op"), "SetTimeouts should override the profile")
+	assert.Equal(t, 4096, ch.connectionOptions.SendBufferSize, "connection options should use the profile")
+}
@@ -0,0 +1,425 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is a SystemError returned for calls that are rejected without being
+// sent because the circuit breaker for the peer and operation is open.
+var ErrCircuitOpen = NewSystemError(ErrCodeDeclined, "circuit breaker open")
+
+const (
+	defaultCircuitErrorThreshold = 0.5
+	defaultCircuitMinRequests    = 20
+	defaultCircuitWindow         = 10 * time.Second
+	defaultCircuitOpenDuration   = 5 * time.Second
+	defaultCircuitProbes         = 1
+)
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed is the state of a healthy circuit, where all calls are allowed.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen is the state of a failing circuit, where calls fail fast with ErrCircuitOpen.
+	CircuitOpen
+
+	// CircuitHalfOpen is the state of a circuit that was open, where a limited number of
+	// probe calls are allowed to check whether the peer has recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerOptions configure circuit breakers for outbound calls. A separate circuit
+// breaker is used for each peer and operation, all sharing the same configuration.
+// Circuit breakers that are closed and have not been used for a Window are removed,
+// so peers that are no longer called do not keep their circuit breakers forever.
+type CircuitBreakerOptions struct {
+	// ErrorThreshold is the error rate (between 0 and 1) at which the circuit opens.
+	// Defaults to 0.5.
+	ErrorThreshold float64
+
+	// MinRequests is the number of calls that must complete within a window before the
+	// circuit can open. Defaults to 20.
+	MinRequests int64
+
+	// Window is the period over which the error rate is measured. Defaults to 10 seconds.
+	Window time.Duration
+
+	// OpenDuration is how long the circuit stays open before probe calls are allowed.
+	// Defaults to 5 seconds.
+	OpenDuration time.Duration
+
+	// Probes is the number of probe calls allowed while the circuit is half-open. The
+	// circuit closes once they all succeed, and opens again if any fails. Defaults to 1.
+	Probes int
+}
+
+// SubChannelHealth summarizes whether the peers of a SubChannel can be reached.
+type SubChannelHealth struct {
+	// Peers is the number of peers in the SubChannel's peer list.
+	Peers int
+
+	// OpenCircuits is the number of those peers that have an open circuit for any
+	// operation of the SubChannel's service.
+	OpenCircuits int
+}
+
+// CircuitBreakerRuntimeState is the runtime state of a single circuit breaker.
+type CircuitBreakerRuntimeState struct {
+	HostPort  string `json:"hostPort"`
+	Service   string `json:"service"`
+	Operation string `json:"operation"`
+	State     string `json:"state"`
+
+	// Requests and Failures are the number of calls completed and failed in the current window.
+	Requests int64 `json:"requests"`
+	Failures int64 `json:"failures"`
+}
+
+type circuitBreakerKey struct {
+	hostPort  string
+	service   string
+	operation string
+}
+
+// circuitBreakers holds the circuit breaker for each peer and operation.
+type circuitBreakers struct {
+	opts          CircuitBreakerOptions
+	statsReporter StatsReporter
+	clock         Clock
+
+	mut       sync.RWMutex
+	breakers  map[circuitBreakerKey]*circuitBreaker
+	lastSweep time.Time
+}
+
+func newCircuitBreakers(opts *CircuitBreakerOptions, statsReporter StatsReporter, clock Clock) *circuitBreakers {
+	if opts == nil {
+		return nil
+	}
+
+	cbs := &circuitBreakers{
+		opts:          *opts,
+		statsReporter: statsReporter,
+		clock:         clock,
+		breakers:      make(map[circuitBreakerKey]*circuitBreaker),
+		lastSweep:     clock.Now(),
+	}
+	if cbs.opts.ErrorThreshold <= 0 {
+		cbs.opts.ErrorThreshold = defaultCircuitErrorThreshold
+	}
+	if cbs.opts.MinRequests <= 0 {
+		cbs.opts.MinRequests = defaultCircuitMinRequests
+	}
+	if cbs.opts.Window <= 0 {
+		cbs.opts.Window = defaultCircuitWindow
+	}
+	if cbs.opts.OpenDuration <= 0 {
+		cbs.opts.OpenDuration = defaultCircuitOpenDuration
+	}
+	if cbs.opts.Probes <= 0 {
+		cbs.opts.Probes = defaultCircuitProbes
+	}
+	return cbs
+}
+
+// get returns the circuit breaker for the given peer and operation, creating it if it
+// does not exist. commonStatsTags are used for the breaker's stats when it is created.
+func (cbs *circuitBreakers) get(hostPort, service, operation string, commonStatsTags map[string]string) *circuitBreaker {
+	if cbs == nil {
+		return nil
+	}
+
+	key := circuitBreakerKey{hostPort, service, operation}
+	cbs.mut.RLock()
+	cb, ok := cbs.breakers[key]
+	cbs.mut.RUnlock()
+	if ok {
+		return cb
+	}
+
+	cbs.mut.Lock()
+	defer cbs.mut.Unlock()
+	if cb, ok := cbs.breakers[key]; ok {
+		return cb
+	}
+
+	now := cbs.clock.Now()
+	if now.Sub(cbs.lastSweep) >= cbs.opts.Window {
+		cbs.removeIdleLocked(now)
+	}
+
+	tags := make(map[string]string, len(commonStatsTags)+3)
+	for k, v := range commonStatsTags {
+		tags[k] = v
+	}
+	tags["peer"] = hostPort
+	tags["target-service"] = service
+	tags["target-endpoint"] = operation
+
+	cb = &circuitBreaker{
+		key:           key,
+		opts:          &cbs.opts,
+		statsReporter: cbs.statsReporter,
+		statsTags:     tags,
+		clock:         cbs.clock,
+		windowStart:   now,
+		lastUsed:      now,
+	}
+	cbs.breakers[key] = cb
+	return cb
+}
+
+// removeIdleLocked removes circuit breakers that are closed and have not been used for
+// a window. Calls that already hold a removed breaker can still record their results,
+// which are discarded. mut must be held.
+func (cbs *circuitBreakers) removeIdleLocked(now time.Time) {
+	cbs.lastSweep = now
+	for key, cb := range cbs.breakers {
+		if cb.isIdle(now) {
+			delete(cbs.breakers, key)
+		}
+	}
+}
+
+// IntrospectState returns the runtime state of all circuit breakers.
+func (cbs *circuitBreakers) IntrospectState() []CircuitBreakerRuntimeState {
+	if cbs == nil {
+		return nil
+	}
+
+	cbs.mut.RLock()
+	defer cbs.mut.RUnlock()
+
+	states := make([]CircuitBreakerRuntimeState, 0, len(cbs.breakers))
+	for _, cb := range cbs.breakers {
+		states = append(states, cb.IntrospectState())
+	}
+	return states
+}
+
+// openPeers returns the host:ports of peers that have an open circuit for any operation of service.
+func (cbs *circuitBreakers) openPeers(service string) map[string]struct{} {
+	open := make(map[string]struct{})
+	if cbs == nil {
+		return open
+	}
+
+	now := cbs.clock.Now()
+	cbs.mut.RLock()
+	defer cbs.mut.RUnlock()
+	for key, cb := range cbs.breakers {
+		if key.service == service && cb.isOpen(now) {
+			open[key.hostPort] = struct{}{}
+		}
+	}
+	return open
+}
+
+// circuitBreaker tracks the error rate of calls to a single peer and operation.
+type circuitBreaker struct {
+	key           circuitBreakerKey
+	opts          *CircuitBreakerOptions
+	statsReporter StatsReporter
+	statsTags     map[string]string
+	clock         Clock
+
+	mut         sync.Mutex
+	state       CircuitState
+	windowStart time.Time
+	requests    int64
+	failures    int64
+	lastUsed    time.Time
+	openedAt    time.Time
+	halfOpenAt  time.Time
+	probes      int
+	probesOK    int
+}
+
+// allow returns whether a call can be made, reserving a probe if the circuit is half-open.
+func (cb *circuitBreaker) allow() bool {
+	if cb == nil {
+		return true
+	}
+
+	now := cb.clock.Now()
+	cb.mut.Lock()
+	cb.lastUsed = now
+	allowed := cb.allowLocked(now)
+	cb.mut.Unlock()
+
+	if !allowed {
+		cb.statsReporter.IncCounter("outbound.circuit-breaker.rejected", cb.statsTags, 1)
+	}
+	return allowed
+}
+
+// allowLocked implements allow. mut must be held.
+func (cb *circuitBreaker) allowLocked(now time.Time) bool {
+	switch cb.state {
+	case CircuitOpen:
+		if now.Sub(cb.openedAt) < cb.opts.OpenDuration {
+			return false
+		}
+		cb.state = CircuitHalfOpen
+		cb.halfOpenAt = now
+		cb.probes, cb.probesOK = 0, 0
+	case CircuitHalfOpen:
+		// Probes whose outcome is never recorded should not keep the circuit half-open forever.
+		if now.Sub(cb.halfOpenAt) >= cb.opts.OpenDuration {
+			cb.halfOpenAt = now
+			cb.probes, cb.probesOK = 0, 0
+		}
+	default:
+		return true
+	}
+
+	if cb.probes >= cb.opts.Probes {
+		return false
+	}
+	cb.probes++
+	return true
+}
+
+// isOpen returns whether the circuit is open and calls are being rejected without probes.
+func (cb *circuitBreaker) isOpen(now time.Time) bool {
+	cb.mut.Lock()
+	defer cb.mut.Unlock()
+	return cb.state == CircuitOpen && now.Sub(cb.openedAt) < cb.opts.OpenDuration
+}
+
+// isIdle returns whether the circuit is closed and has not been used for a window.
+func (cb *circuitBreaker) isIdle(now time.Time) bool {
+	cb.mut.Lock()
+	defer cb.mut.Unlock()
+	return cb.state == CircuitClosed && now.Sub(cb.lastUsed) >= cb.opts.Window
+}
+
+// success records a call that completed, possibly with an application error.
+func (cb *circuitBreaker) success() {
+	if cb == nil {
+		return
+	}
+
+	cb.mut.Lock()
+	closed := false
+	switch cb.state {
+	case CircuitClosed:
+		cb.addResult(cb.clock.Now(), false)
+	case CircuitHalfOpen:
+		cb.probesOK++
+		if cb.probesOK >= cb.opts.Probes {
+			cb.state = CircuitClosed
+			cb.resetWindow(cb.clock.Now())
+			closed = true
+		}
+	}
+	cb.mut.Unlock()
+
+	if closed {
+		cb.statsReporter.IncCounter("outbound.circuit-breaker.closed", cb.statsTags, 1)
+	}
+}
+
+// failure records a call that failed with an error of the given class. Only errors that
+// are the server's fault count towards opening the circuit.
+func (cb *circuitBreaker) failure(class ErrClass) {
+	if cb == nil {
+		return
+	}
+
+	cb.mut.Lock()
+	now := cb.clock.Now()
+	opened := false
+	switch {
+	case class.Fault != ErrFaultServer:
+		// The outcome says nothing about the peer, so release the probe for another call.
+		if cb.state == CircuitHalfOpen && cb.probes > 0 {
+			cb.probes--
+		}
+	case cb.state == CircuitClosed:
+		cb.addResult(now, true)
+		if cb.requests >= cb.opts.MinRequests &&
+			float64(cb.failures) >= cb.opts.ErrorThreshold*float64(cb.requests) {
+			opened = true
+		}
+	case cb.state == CircuitHalfOpen:
+		opened = true
+	}
+	if opened {
+		cb.state = CircuitOpen
+		cb.openedAt = now
+	}
+	cb.mut.Unlock()
+
+	if opened {
+		cb.statsReporter.IncCounter("outbound.circuit-breaker.opened", cb.statsTags, 1)
+	}
+}
+
+// addResult adds a call result to the current window. mut must be held.
+func (cb *circuitBreaker) addResult(now time.Time, failed bool) {
+	if now.Sub(cb.windowStart) >= cb.opts.Window {
+		cb.resetWindow(now)
+	}
+	cb.requests++
+	if failed {
+		cb.failures++
+	}
+}
+
+// resetWindow starts a new window for measuring the error rate. mut must be held.
+func (cb *circuitBreaker) resetWindow(now time.Time) {
+	cb.windowStart = now
+	cb.requests, cb.failures = 0, 0
+}
+
+// IntrospectState returns the runtime state of the circuit breaker.
+func (cb *circuitBreaker) IntrospectState() CircuitBreakerRuntimeState {
+	cb.mut.Lock()
+	defer cb.mut.Unlock()
+
+	return CircuitBreakerRuntimeState{
+		HostPort:  cb.key.hostPort,
+		Service:   cb.key.service,
+		Operation: cb.key.operation,
+		State:     cb.state.String(),
+		Requests:  cb.requests,
+		Failures:  cb.failures,
+	}
+}
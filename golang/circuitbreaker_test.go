@@ -0,0 +1,146 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var calls, failing int32 = 0, 1
+	server, err := testutils.NewServer(&testutils.ChannelOpts{ServiceName: "breaker-svc"})
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+	handler := func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			return &raw.Res{SystemErr: ErrServerBusy}, nil
+		}
+		return &raw.Res{}, nil
+	}
+	testutils.RegisterFunc(t, server, "op", handler)
+	testutils.RegisterFunc(t, server, "other", handler)
+	testutils.RegisterFunc(t, server, "new", handler)
+
+	stats := newRecordingStatsReporter()
+	clock := testutils.NewFakeClock(time.Unix(1000, 0))
+	client, err := NewChannel("breaker-client", &ChannelOptions{
+		StatsReporter: stats,
+		Clock:         clock,
+		CircuitBreaker: &CircuitBreakerOptions{
+			MinRequests:  4,
+			OpenDuration: 50 * time.Millisecond,
+		},
+	})
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	hostPort := server.PeerInfo().HostPort
+	call := func(operation string) error {
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		_, _, _, err := raw.Call(ctx, client, hostPort, "breaker-svc", operation, nil, nil)
+		return err
+	}
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(call("op")), "call %v should reach the server", i)
+	}
+	assert.Equal(t, ErrCircuitOpen, call("op"), "circuit should be open after too many errors")
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls), "calls should fail fast while the circuit is open")
+
+	// Circuit breakers are scoped to the operation.
+	assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(call("other")), "other operations should not be affected")
+
+	// Once the circuit half-opens, a failed probe opens it again.
+	clock.Advance(60 * time.Millisecond)
+	assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(call("op")), "probe should reach the server")
+	assert.Equal(t, ErrCircuitOpen, call("op"), "failed probe should open the circuit")
+
+	// A successful probe closes the circuit.
+	atomic.StoreInt32(&failing, 0)
+	clock.Advance(60 * time.Millisecond)
+	assert.NoError(t, call("op"), "probe should succeed")
+	assert.NoError(t, call("op"), "circuit should be closed after a successful probe")
+
+	assert.Equal(t, int64(2), counterValue(stats, "outbound.circuit-breaker.opened"), "opened counter mismatch")
+	assert.Equal(t, int64(2), counterValue(stats, "outbound.circuit-breaker.rejected"), "rejected counter mismatch")
+	assert.Equal(t, int64(1), counterValue(stats, "outbound.circuit-breaker.closed"), "closed counter mismatch")
+
+	states := client.IntrospectState(nil).CircuitBreakers
+	require.Len(t, states, 2, "expected a circuit breaker for each operation")
+	for _, state := range states {
+		assert.Equal(t, "closed", state.State, "unexpected state for %v", state.Operation)
+	}
+
+	// Closed circuit breakers that are not used for a window are removed once another
+	// circuit breaker is created.
+	clock.Advance(10 * time.Second)
+	assert.NoError(t, call("new"), "call should succeed")
+	states = client.IntrospectState(nil).CircuitBreakers
+	require.Len(t, states, 1, "idle circuit breakers should be removed")
+	assert.Equal(t, "new", states[0].Operation, "unexpected circuit breaker")
+}
+
+func TestSubChannelHealth(t *testing.T) {
+	server, err := testutils.NewServer(&testutils.ChannelOpts{ServiceName: "breaker-svc"})
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "op", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{SystemErr: ErrServerBusy}, nil
+	})
+
+	client, err := NewChannel("breaker-client", &ChannelOptions{
+		CircuitBreaker: &CircuitBreakerOptions{
+			MinRequests:  2,
+			OpenDuration: time.Minute,
+		},
+	})
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	sc := client.GetSubChannel("breaker-svc")
+	assert.Equal(t, SubChannelHealth{}, sc.Health(), "SubChannel without peers")
+
+	hostPort := server.PeerInfo().HostPort
+	sc.Peers().Add(hostPort)
+	sc.Peers().Add("1.1.1.1:1")
+	assert.Equal(t, SubChannelHealth{Peers: 2}, sc.Health(), "SubChannel with closed circuits")
+
+	for i := 0; i < 2; i++ {
+		ctx, cancel := NewContext(time.Second)
+		_, _, _, err := raw.Call(ctx, client, hostPort, "breaker-svc", "op", nil, nil)
+		cancel()
+		assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(err), "call %v should reach the server", i)
+	}
+	assert.Equal(t, SubChannelHealth{Peers: 2, OpenCircuits: 1}, sc.Health(), "SubChannel with an open circuit")
+	assert.Equal(t, 0, client.GetSubChannel("other-svc").Health().OpenCircuits,
+		"Open circuits should be scoped to the service")
+}
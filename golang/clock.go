@@ -0,0 +1,86 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import "time"
+
+// Clock is the source of time used by a channel for backoffs, hedging delays, pings,
+// leak checks, injected latency, call latencies, and the time windows of circuit
+// breakers, retry budgets, quotas and deduplication. Tests can use a fake Clock, such
+// as testutils.FakeClock, to advance time deterministically instead of sleeping.
+//
+// Context deadlines are not affected by the Clock, and always use real time.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After returns a channel that receives the current time once d has elapsed.
+	After(d time.Duration) <-chan time.Time
+
+	// Sleep blocks until d has elapsed.
+	Sleep(d time.Duration)
+
+	// NewTimer returns a Timer that fires once d has elapsed.
+	NewTimer(d time.Duration) Timer
+
+	// NewTicker returns a Ticker that fires every d.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a single event created by a Clock.
+type Timer interface {
+	// C returns the channel that receives the time when the timer fires.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing, and returns false if it had already fired
+	// or been stopped.
+	Stop() bool
+}
+
+// Ticker delivers ticks at intervals, created by a Clock.
+type Ticker interface {
+	// C returns the channel that receives the time of each tick.
+	C() <-chan time.Time
+
+	// Stop turns off the ticker.
+	Stop()
+}
+
+// SystemClock is the Clock that uses real time, which is the default Clock for channels.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+// Now uses timeNow so that the time can be stubbed in unit tests.
+func (systemClock) Now() time.Time                         { return timeNow() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (systemClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (systemClock) NewTimer(d time.Duration) Timer         { return systemTimer{time.NewTimer(d)} }
+func (systemClock) NewTicker(d time.Duration) Ticker       { return systemTicker{time.NewTicker(d)} }
+
+type systemTimer struct{ t *time.Timer }
+
+func (t systemTimer) C() <-chan time.Time { return t.t.C }
+func (t systemTimer) Stop() bool          { return t.t.Stop() }
+
+type systemTicker struct{ t *time.Ticker }
+
+func (t systemTicker) C() <-chan time.Time { return t.t.C }
+func (t systemTicker) Stop()               { t.t.Stop() }
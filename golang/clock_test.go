@@ -0,0 +1,146 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Unix(1000, 0)
+	clock := testutils.NewFakeClock(start)
+
+	timer := clock.NewTimer(time.Second)
+	ticker := clock.NewTicker(400 * time.Millisecond)
+	stopped := clock.NewTimer(time.Second)
+	assert.True(t, stopped.Stop(), "Stop should stop a pending timer")
+
+	clock.Advance(500 * time.Millisecond)
+	assert.Equal(t, start.Add(500*time.Millisecond), clock.Now(), "Now mismatch")
+	assert.Equal(t, start.Add(400*time.Millisecond), <-ticker.C(), "first tick mismatch")
+	select {
+	case <-timer.C():
+		t.Errorf("timer fired early")
+	default:
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	assert.Equal(t, start.Add(time.Second), <-timer.C(), "timer fired at the wrong time")
+	assert.Equal(t, start.Add(800*time.Millisecond), <-ticker.C(), "second tick mismatch")
+	assert.False(t, timer.Stop(), "Stop should return false after the timer fired")
+	assert.False(t, stopped.Stop(), "Stop should return false for a stopped timer")
+	ticker.Stop()
+
+	select {
+	case <-clock.After(0):
+	default:
+		t.Errorf("After(0) should fire immediately")
+	}
+}
+
+func TestClockRetryBackoff(t *testing.T) {
+	var calls int32
+	server, err := testutils.NewServer(&testutils.ChannelOpts{ServiceName: "clock-svc"})
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "op", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return &raw.Res{SystemErr: ErrServerBusy}, nil
+		}
+		return &raw.Res{}, nil
+	})
+
+	clock := testutils.NewFakeClock(time.Unix(1000, 0))
+	client, err := testutils.NewClient(&testutils.ChannelOpts{Clock: clock})
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+	sc := client.GetSubChannel("clock-svc")
+	sc.Peers().Add(server.PeerInfo().HostPort)
+
+	// The backoff is longer than the timeout, so the retry only happens if the
+	// backoff uses the fake clock.
+	ctx, cancel := NewContextBuilder(time.Second).
+		SetRetryOptions(&RetryOptions{MaxAttempts: 2, BackoffBase: time.Hour, BackoffMax: time.Hour}).
+		Build()
+	defer cancel()
+
+	errC := make(chan error)
+	go func() {
+		_, _, _, err := raw.CallSC(ctx, sc, "op", nil, nil)
+		errC <- err
+	}()
+
+	// Wait for the retry to wait on the backoff timer.
+	clock.WaitForTimers(1)
+	select {
+	case err := <-errC:
+		t.Fatalf("CallSC should wait for the backoff, got %v", err)
+	default:
+	}
+
+	clock.Advance(time.Hour)
+	require.NoError(t, <-errC, "CallSC should succeed once the clock advances")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "unexpected number of attempts")
+}
+
+func TestClockCircuitBreaker(t *testing.T) {
+	server, err := testutils.NewServer(&testutils.ChannelOpts{ServiceName: "clock-svc"})
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "op", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{SystemErr: ErrServerBusy}, nil
+	})
+
+	clock := testutils.NewFakeClock(time.Unix(1000, 0))
+	client, err := NewChannel("clock-client", &ChannelOptions{
+		Clock:          clock,
+		CircuitBreaker: &CircuitBreakerOptions{MinRequests: 2, OpenDuration: time.Minute},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	call := func() error {
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		_, _, _, err := raw.Call(ctx, client, server.PeerInfo().HostPort, "clock-svc", "op", nil, nil)
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(call()), "call %v should reach the server", i)
+	}
+	assert.Equal(t, ErrCircuitOpen, call(), "circuit should be open")
+
+	clock.Advance(59 * time.Second)
+	assert.Equal(t, ErrCircuitOpen, call(), "circuit should stay open until OpenDuration elapses")
+
+	clock.Advance(time.Second)
+	assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(call()), "probe should reach the server once the circuit half-opens")
+}
@@ -71,6 +71,33 @@ func TestCloseNewClient(t *testing.T) {
 	assert.True(t, ch.Closed(), "Channel should be closed")
 }
 
+func TestDrain(t *testing.T) {
+	WithVerifiedServer(t, nil, func(ch *Channel, hostPort string) {
+		testutils.RegisterFunc(t, ch, "test", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			return &raw.Res{}, nil
+		})
+		assert.False(t, ch.Draining(), "New channel should not be draining")
+
+		ch.StartDrain()
+		assert.True(t, ch.Draining(), "Channel should be draining after StartDrain")
+		assert.True(t, ch.GetSubChannel("other").Draining(), "SubChannel should report the channel's drain state")
+		assert.Equal(t, ChannelListening, ch.State(), "StartDrain should not close the channel")
+
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+		assert.NoError(t, makeCall(client, hostPort, ch.PeerInfo().ServiceName), "Draining channel should still serve calls")
+	})
+}
+
+func TestDrainOnClose(t *testing.T) {
+	ch, err := testutils.NewServer(nil)
+	require.NoError(t, err, "NewServer failed")
+
+	ch.Close()
+	assert.True(t, ch.Draining(), "Closed channel should be draining")
+}
+
 // TestCloseStress ensures that once a Channel is closed, it cannot be reached.
 func TestCloseStress(t *testing.T) {
 	CheckStress(t)
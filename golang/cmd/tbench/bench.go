@@ -0,0 +1,256 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/thrift/dynamic"
+)
+
+// rateInterval is how often the rate limiter releases calls when a QPS is specified.
+const rateInterval = 10 * time.Millisecond
+
+// errApplication is the error key used for calls that return an application error.
+const errApplication = "application-error"
+
+// options are the options for a benchmark run.
+type options struct {
+	Peers       []string
+	Service     string
+	Method      string
+	Head        string
+	Body        string
+	PayloadSize int
+	JSON        bool
+	Thrift      string
+	QPS         int
+	Duration    time.Duration
+	Connections int
+	Concurrency int
+	Timeout     time.Duration
+	Caller      string
+}
+
+// request is the encoded args that are sent for each call.
+type request struct {
+	format     tchannel.Format
+	arg2, arg3 []byte
+}
+
+func newRequest(opts options) (*request, error) {
+	if opts.Body != "" && opts.PayloadSize > 0 {
+		return nil, errors.New("only one of -3 and -payloadSize can be specified")
+	}
+
+	switch {
+	case opts.JSON && opts.Thrift != "":
+		return nil, errors.New("only one of -json and -thrift can be specified")
+	case opts.JSON:
+		head, body := opts.Head, opts.Body
+		if head == "" {
+			head = "{}"
+		}
+		if opts.PayloadSize > 0 {
+			body = `"` + strings.Repeat("a", opts.PayloadSize) + `"`
+		} else if body == "" {
+			body = "null"
+		}
+		for _, s := range []string{head, body} {
+			var v interface{}
+			if err := json.Unmarshal([]byte(s), &v); err != nil {
+				return nil, fmt.Errorf("invalid JSON %q: %v", s, err)
+			}
+		}
+		return &request{tchannel.JSON, []byte(head), []byte(body)}, nil
+	case opts.Thrift != "":
+		if opts.PayloadSize > 0 {
+			return nil, errors.New("-payloadSize cannot be used with -thrift")
+		}
+		return newThriftRequest(opts)
+	default:
+		body := []byte(opts.Body)
+		if opts.PayloadSize > 0 {
+			body = make([]byte, opts.PayloadSize)
+		}
+		return &request{tchannel.Raw, []byte(opts.Head), body}, nil
+	}
+}
+
+func newThriftRequest(opts options) (*request, error) {
+	idl, err := dynamic.Parse(opts.Thrift)
+	if err != nil {
+		return nil, err
+	}
+	method, err := idl.Method(opts.Method)
+	if err != nil {
+		return nil, err
+	}
+
+	var headers map[string]string
+	if opts.Head != "" {
+		if err := json.Unmarshal([]byte(opts.Head), &headers); err != nil {
+			return nil, fmt.Errorf("invalid head, must be a JSON object of strings: %v", err)
+		}
+	}
+	var args map[string]interface{}
+	if opts.Body != "" {
+		d := json.NewDecoder(strings.NewReader(opts.Body))
+		d.UseNumber()
+		if err := d.Decode(&args); err != nil {
+			return nil, fmt.Errorf("invalid body, must be a JSON object of arguments: %v", err)
+		}
+	}
+	arg3, err := method.EncodeArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	return &request{tchannel.Thrift, dynamic.EncodeHeaders(headers), arg3}, nil
+}
+
+// run runs the benchmark described by opts, and returns the results.
+func run(opts options) (*results, error) {
+	req, err := newRequest(opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Connections < 1 || opts.Concurrency < 1 {
+		return nil, errors.New("connections and concurrency must be at least 1")
+	}
+
+	// Each channel creates its own connection to each peer.
+	var subChannels []*tchannel.SubChannel
+	for i := 0; i < opts.Connections; i++ {
+		ch, err := tchannel.NewChannel(opts.Caller, &tchannel.ChannelOptions{
+			Logger: tchannel.NullLogger,
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer ch.Close()
+
+		sc := ch.GetSubChannel(opts.Service)
+		for _, hostPort := range opts.Peers {
+			sc.Peers().Add(hostPort)
+		}
+		subChannels = append(subChannels, sc)
+	}
+
+	r := newResults()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	var tokens chan struct{}
+	if opts.QPS > 0 {
+		tokens = make(chan struct{}, opts.Connections*opts.Concurrency)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			limitRate(opts.QPS, tokens, done, r)
+		}()
+	}
+
+	started := time.Now()
+	for i := 0; i < opts.Connections*opts.Concurrency; i++ {
+		wg.Add(1)
+		go func(sc *tchannel.SubChannel) {
+			defer wg.Done()
+			worker(sc, opts, req, tokens, done, r)
+		}(subChannels[i%opts.Connections])
+	}
+
+	time.Sleep(opts.Duration)
+	close(done)
+	wg.Wait()
+	r.elapsed = time.Since(started)
+	return r, nil
+}
+
+// limitRate releases qps tokens per second until done is closed. Tokens that cannot be
+// released because all workers are busy are dropped, and counted as missed calls.
+func limitRate(qps int, tokens chan<- struct{}, done <-chan struct{}, r *results) {
+	ticker := time.NewTicker(rateInterval)
+	defer ticker.Stop()
+
+	started := time.Now()
+	released := 0
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			expected := int(now.Sub(started).Seconds() * float64(qps))
+			for ; released < expected; released++ {
+				select {
+				case tokens <- struct{}{}:
+				default:
+					r.recordMissed()
+				}
+			}
+		}
+	}
+}
+
+func worker(sc *tchannel.SubChannel, opts options, req *request, tokens <-chan struct{}, done <-chan struct{}, r *results) {
+	for {
+		if tokens != nil {
+			select {
+			case <-tokens:
+			case <-done:
+				return
+			}
+		} else {
+			select {
+			case <-done:
+				return
+			default:
+			}
+		}
+
+		started := time.Now()
+		errKey := makeCall(sc, opts, req)
+		r.record(time.Since(started), errKey)
+	}
+}
+
+// makeCall makes a single call, and returns the error key if the call failed.
+func makeCall(sc *tchannel.SubChannel, opts options, req *request) string {
+	ctx, cancel := tchannel.NewContext(opts.Timeout)
+	defer cancel()
+
+	call, err := sc.BeginCall(ctx, opts.Method, &tchannel.CallOptions{Format: req.format})
+	if err != nil {
+		return tchannel.ErrorClass(err).Code.MetricsKey()
+	}
+	_, _, res, err := raw.WriteArgs(call, req.arg2, req.arg3)
+	if err != nil {
+		return tchannel.ErrorClass(err).Code.MetricsKey()
+	}
+	if res.ApplicationError() {
+		return errApplication
+	}
+	return ""
+}
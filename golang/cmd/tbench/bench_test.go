@@ -0,0 +1,129 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func withServer(t *testing.T, f func(opts options)) {
+	ch, err := testutils.NewServer(nil)
+	require.NoError(t, err, "NewServer failed")
+	defer ch.Close()
+
+	testutils.RegisterFunc(t, ch, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+	var calls int
+	testutils.RegisterFunc(t, ch, "flaky", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		calls++
+		if calls%2 == 0 {
+			return &raw.Res{IsErr: true}, nil
+		}
+		return &raw.Res{}, nil
+	})
+
+	f(options{
+		Peers:       []string{ch.PeerInfo().HostPort},
+		Service:     ch.PeerInfo().ServiceName,
+		Duration:    100 * time.Millisecond,
+		Connections: 1,
+		Concurrency: 1,
+		Timeout:     time.Second,
+		Caller:      "tbench",
+	})
+}
+
+func TestRun(t *testing.T) {
+	withServer(t, func(opts options) {
+		opts.Method = "echo"
+		opts.PayloadSize = 1024
+		opts.Connections = 2
+		opts.Concurrency = 2
+
+		r, err := run(opts)
+		require.NoError(t, err, "run failed")
+		assert.True(t, r.total() > 0, "expected calls to be made")
+		assert.Empty(t, r.errors, "unexpected errors")
+
+		buf := &bytes.Buffer{}
+		r.print(buf)
+		assert.Contains(t, buf.String(), "p99:", "missing latency percentiles")
+	})
+}
+
+func TestRunQPS(t *testing.T) {
+	withServer(t, func(opts options) {
+		opts.Method = "echo"
+		opts.JSON = true
+		opts.QPS = 100
+		opts.Duration = 300 * time.Millisecond
+
+		r, err := run(opts)
+		require.NoError(t, err, "run failed")
+		assert.True(t, r.total() > 10 && r.total() <= 30, "expected about 30 calls, got %v", r.total())
+	})
+}
+
+func TestRunErrors(t *testing.T) {
+	withServer(t, func(opts options) {
+		opts.Method = "flaky"
+		r, err := run(opts)
+		require.NoError(t, err, "run failed")
+		assert.True(t, r.errors[errApplication] > 0, "expected application errors")
+
+		opts.Method = "unknown"
+		r, err = run(opts)
+		require.NoError(t, err, "run failed")
+		assert.Equal(t, r.total(), r.errors["bad-request"], "expected all calls to fail with bad-request")
+
+		buf := &bytes.Buffer{}
+		r.print(buf)
+		assert.Contains(t, buf.String(), "bad-request:", "missing error breakdown")
+
+		opts.JSON = true
+		opts.Body = "{"
+		_, err = run(opts)
+		assert.Error(t, err, "run should fail for invalid JSON")
+	})
+}
+
+func TestPercentile(t *testing.T) {
+	r := newResults()
+	for i := 100; i > 0; i-- {
+		r.record(time.Duration(i)*time.Millisecond, "")
+	}
+
+	buf := &bytes.Buffer{}
+	r.print(buf)
+	assert.Equal(t, 50*time.Millisecond, r.percentile(50), "p50 mismatch")
+	assert.Equal(t, 99*time.Millisecond, r.percentile(99), "p99 mismatch")
+	assert.Equal(t, 100*time.Millisecond, r.percentile(99.9), "p99.9 mismatch")
+	assert.Contains(t, buf.String(), "min: 1ms", "min mismatch")
+	assert.Contains(t, buf.String(), "max: 100ms", "max mismatch")
+}
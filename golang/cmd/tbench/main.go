@@ -0,0 +1,86 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// tbench drives load against a TChannel service and reports the latency percentiles and
+// the breakdown of errors, so that performance can be measured consistently. For example:
+//
+//	tbench -p localhost:12345 -qps 1000 -duration 30s -payloadSize 4096 benchmark echo
+//	tbench -p localhost:12345 -connections 4 -concurrency 16 -json -3 '{"key": "foo"}' keyvalue get
+//	tbench -p localhost:12345 -thrift keyvalue.thrift -3 '{"key": "foo"}' keyvalue KeyValue::Get
+//
+// Options must be specified before the service and method.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// peerList is a flag that can be specified multiple times.
+type peerList []string
+
+func (l *peerList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *peerList) Set(hostPort string) error {
+	*l = append(*l, hostPort)
+	return nil
+}
+
+func main() {
+	var peers peerList
+	flag.Var(&peers, "p", "The host:port of a peer to call. May be specified multiple times")
+	var opts options
+	flag.StringVar(&opts.Head, "2", "", "The head (arg2) for each call. For json and thrift calls, a JSON object of application headers")
+	flag.StringVar(&opts.Body, "3", "", "The body (arg3) for each call. For json and thrift calls, a JSON value")
+	flag.IntVar(&opts.PayloadSize, "payloadSize", 0, "The size of a generated body for raw and json calls, if -3 is not specified")
+	flag.BoolVar(&opts.JSON, "json", false, "Use the json arg scheme")
+	flag.StringVar(&opts.Thrift, "thrift", "", "Use the thrift arg scheme with the given Thrift IDL file. The method must be Service::method")
+	flag.IntVar(&opts.QPS, "qps", 0, "The total number of calls per second to make. 0 makes calls as fast as possible")
+	flag.DurationVar(&opts.Duration, "duration", 10*time.Second, "How long to run the benchmark")
+	flag.IntVar(&opts.Connections, "connections", 1, "The number of connections to each peer")
+	flag.IntVar(&opts.Concurrency, "concurrency", 1, "The number of concurrent calls on each connection")
+	flag.DurationVar(&opts.Timeout, "timeout", time.Second, "The timeout for each call")
+	flag.StringVar(&opts.Caller, "caller", "tbench", "The caller name for the calls")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s -p host:port [options] service method\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if len(peers) == 0 || flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	opts.Peers = peers
+	opts.Service = flag.Arg(0)
+	opts.Method = flag.Arg(1)
+
+	r, err := run(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tbench: %v\n", err)
+		os.Exit(2)
+	}
+	r.print(os.Stdout)
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// percentiles are the latency percentiles that are reported.
+var percentiles = []float64{50, 90, 95, 99, 99.9}
+
+// results collects the latency and errors for the calls made by a benchmark.
+type results struct {
+	sync.Mutex
+
+	// latencies contains the latency of each successful call.
+	latencies []time.Duration
+	// errors is the number of failed calls for each error key.
+	errors map[string]int
+	// missed is the number of calls that could not be made at the requested QPS.
+	missed  int
+	elapsed time.Duration
+}
+
+func newResults() *results {
+	return &results{errors: make(map[string]int)}
+}
+
+// record records the result of a single call. errKey is empty if the call succeeded.
+func (r *results) record(latency time.Duration, errKey string) {
+	r.Lock()
+	if errKey == "" {
+		r.latencies = append(r.latencies, latency)
+	} else {
+		r.errors[errKey]++
+	}
+	r.Unlock()
+}
+
+func (r *results) recordMissed() {
+	r.Lock()
+	r.missed++
+	r.Unlock()
+}
+
+// total returns the total number of calls made.
+func (r *results) total() int {
+	total := len(r.latencies)
+	for _, n := range r.errors {
+		total += n
+	}
+	return total
+}
+
+// percentile returns the latency at the given percentile using the nearest-rank method.
+// The latencies must be sorted.
+func (r *results) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(r.latencies))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(r.latencies) {
+		rank = len(r.latencies) - 1
+	}
+	return r.latencies[rank]
+}
+
+type byDuration []time.Duration
+
+func (l byDuration) Len() int           { return len(l) }
+func (l byDuration) Less(i, j int) bool { return l[i] < l[j] }
+func (l byDuration) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// print writes a summary of the results.
+func (r *results) print(w io.Writer) {
+	r.Lock()
+	defer r.Unlock()
+
+	sort.Sort(byDuration(r.latencies))
+	total := r.total()
+	fmt.Fprintf(w, "Calls: %v in %v (%.1f calls/s)\n", total, r.elapsed, float64(total)/r.elapsed.Seconds())
+	fmt.Fprintf(w, "Successful: %v\n", len(r.latencies))
+	if r.missed > 0 {
+		fmt.Fprintf(w, "Missed: %v calls could not be made at the requested QPS\n", r.missed)
+	}
+
+	if len(r.errors) > 0 {
+		var keys []string
+		for k := range r.errors {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		fmt.Fprintf(w, "Errors: %v\n", total-len(r.latencies))
+		for _, k := range keys {
+			fmt.Fprintf(w, "  %v: %v\n", k, r.errors[k])
+		}
+	}
+
+	if len(r.latencies) > 0 {
+		fmt.Fprintf(w, "Latency:\n")
+		fmt.Fprintf(w, "  min: %v\n", r.latencies[0])
+		for _, p := range percentiles {
+			fmt.Fprintf(w, "  p%v: %v\n", p, r.percentile(p))
+		}
+		fmt.Fprintf(w, "  max: %v\n", r.latencies[len(r.latencies)-1])
+	}
+}
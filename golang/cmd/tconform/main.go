@@ -0,0 +1,108 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// tconform checks captured TChannel traffic against the protocol spec, which is useful when
+// bringing up a new language implementation against this one. Each file contains the raw
+// bytes sent by one side of a connection, such as a TCP stream exported from a packet capture:
+//
+//	tconform client-to-server.bin server-to-client.bin
+//
+// A file name of "-" reads from stdin. tconform prints a report for each file, and exits with
+// status 0 if all files conform to the spec, 1 if any violations were found, and 2 if a file
+// could not be read.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/uber/tchannel/golang"
+)
+
+const (
+	exitConformant = 0
+	exitViolations = 1
+	exitFailed     = 2
+)
+
+func main() {
+	jsonOutput := flag.Bool("json", false, "Print the reports as JSON")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: tconform [-json] file...")
+		flag.PrintDefaults()
+		os.Exit(exitFailed)
+	}
+
+	conformant, err := checkFiles(os.Stdout, flag.Args(), *jsonOutput)
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "conformance check failed: %v\n", err)
+		os.Exit(exitFailed)
+	case !conformant:
+		os.Exit(exitViolations)
+	}
+	os.Exit(exitConformant)
+}
+
+// checkFiles checks each file and writes the reports to out. It returns whether all the
+// files conform to the spec.
+func checkFiles(out io.Writer, files []string, jsonOutput bool) (bool, error) {
+	reports := make(map[string]*tchannel.ConformanceReport, len(files))
+	conformant := true
+	for _, file := range files {
+		report, err := checkFile(file)
+		if err != nil {
+			return false, fmt.Errorf("%v: %v", file, err)
+		}
+		reports[file] = report
+		conformant = conformant && report.Conformant()
+
+		if !jsonOutput {
+			fmt.Fprintf(out, "%v: %v", file, report)
+		}
+	}
+
+	if jsonOutput {
+		enc := json.NewEncoder(out)
+		if err := enc.Encode(reports); err != nil {
+			return false, err
+		}
+	}
+	return conformant, nil
+}
+
+func checkFile(file string) (*tchannel.ConformanceReport, error) {
+	if file == "-" {
+		return tchannel.CheckConformance(os.Stdin)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return tchannel.CheckConformance(f)
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+)
+
+// initReqFrame is an init req frame with the required init params.
+var initReqFrame = []byte{
+	0x00, 0x3e, // size:2
+	0x01,                   // type:1 -- init req
+	0x00,                   // reserved:1
+	0x00, 0x00, 0x00, 0x01, // id:4
+	0x00, 0x00, 0x00, 0x00, // reserved:4
+	0x00, 0x00, 0x00, 0x00, // reserved:4
+	0x00, 0x02, // version:2
+	0x00, 0x02, // nh:2
+	0x00, 0x09, 'h', 'o', 's', 't', '_', 'p', 'o', 'r', 't', // key~2
+	0x00, 0x09, '1', '.', '2', '.', '3', '.', '4', ':', '5', // value~2
+	0x00, 0x0c, 'p', 'r', 'o', 'c', 'e', 's', 's', '_', 'n', 'a', 'm', 'e', // key~2
+	0x00, 0x04, 'n', 'o', 'd', 'e', // value~2
+}
+
+// pingReqFrame is a ping req frame.
+var pingReqFrame = []byte{
+	0x00, 0x10, // size:2
+	0xd0,                   // type:1 -- ping req
+	0x00,                   // reserved:1
+	0x00, 0x00, 0x00, 0x02, // id:4
+	0x00, 0x00, 0x00, 0x00, // reserved:4
+	0x00, 0x00, 0x00, 0x00, // reserved:4
+}
+
+func writeCapture(t *testing.T, dir, name string, frames ...[]byte) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, bytes.Join(frames, nil), 0644), "WriteFile failed")
+	return path
+}
+
+func TestCheckFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tconform")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	valid := writeCapture(t, dir, "valid.bin", initReqFrame, pingReqFrame)
+	noInit := writeCapture(t, dir, "noinit.bin", pingReqFrame)
+
+	var out bytes.Buffer
+	conformant, err := checkFiles(&out, []string{valid}, false)
+	require.NoError(t, err, "checkFiles failed")
+	assert.True(t, conformant, "valid capture should conform")
+	assert.Contains(t, out.String(), "checked 2 frames, found 0 violations")
+
+	out.Reset()
+	conformant, err = checkFiles(&out, []string{valid, noInit}, true)
+	require.NoError(t, err, "checkFiles failed")
+	assert.False(t, conformant, "capture without an init req should not conform")
+
+	var reports map[string]*tchannel.ConformanceReport
+	require.NoError(t, json.Unmarshal(out.Bytes(), &reports), "failed to parse JSON output")
+	require.Len(t, reports[noInit].Violations, 1, "expected a violation")
+	assert.Equal(t, "init.first", reports[noInit].Violations[0].Rule, "violation rule mismatch")
+
+	_, err = checkFiles(&out, []string{filepath.Join(dir, "missing.bin")}, false)
+	assert.Error(t, err, "checkFiles should fail for a missing file")
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/thrift/dynamic"
+)
+
+// encoding converts the head and body given on the command line to the call's
+// args, and converts the response args to values that are printed.
+type encoding interface {
+	format() tchannel.Format
+	encode(head, body string) (arg2, arg3 []byte, err error)
+	decode(arg2, arg3 []byte, success bool) (head, body interface{}, err error)
+}
+
+func newEncoding(opts options) (encoding, error) {
+	switch {
+	case opts.JSON && opts.Thrift != "":
+		return nil, errors.New("only one of -json and -thrift can be specified")
+	case opts.JSON:
+		return jsonEncoding{}, nil
+	case opts.Thrift != "":
+		idl, err := dynamic.Parse(opts.Thrift)
+		if err != nil {
+			return nil, err
+		}
+		method, err := idl.Method(opts.Method)
+		if err != nil {
+			return nil, err
+		}
+		return thriftEncoding{method}, nil
+	default:
+		return rawEncoding{}, nil
+	}
+}
+
+// rawEncoding passes the head and body through as-is, and prints the response as strings.
+type rawEncoding struct{}
+
+func (rawEncoding) format() tchannel.Format {
+	return tchannel.Raw
+}
+
+func (rawEncoding) encode(head, body string) ([]byte, []byte, error) {
+	return []byte(head), []byte(body), nil
+}
+
+func (rawEncoding) decode(arg2, arg3 []byte, success bool) (interface{}, interface{}, error) {
+	return string(arg2), string(arg3), nil
+}
+
+// jsonEncoding sends the head and body as JSON, and prints the response as JSON.
+type jsonEncoding struct{}
+
+func (jsonEncoding) format() tchannel.Format {
+	return tchannel.JSON
+}
+
+func (jsonEncoding) encode(head, body string) ([]byte, []byte, error) {
+	arg2, err := normalizeJSON(head, "{}")
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid head: %v", err)
+	}
+	arg3, err := normalizeJSON(body, "null")
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid body: %v", err)
+	}
+	return arg2, arg3, nil
+}
+
+func (jsonEncoding) decode(arg2, arg3 []byte, success bool) (interface{}, interface{}, error) {
+	var head, body interface{}
+	if err := unmarshalJSON(arg2, &head); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode response head: %v", err)
+	}
+	if err := unmarshalJSON(arg3, &body); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode response body: %v", err)
+	}
+	return head, body, nil
+}
+
+// thriftEncoding sends a Thrift call using an IDL that is parsed at runtime.
+type thriftEncoding struct {
+	method *dynamic.Method
+}
+
+func (thriftEncoding) format() tchannel.Format {
+	return tchannel.Thrift
+}
+
+func (e thriftEncoding) encode(head, body string) ([]byte, []byte, error) {
+	var headers map[string]string
+	if head != "" {
+		if err := json.Unmarshal([]byte(head), &headers); err != nil {
+			return nil, nil, fmt.Errorf("invalid head, must be a JSON object of strings: %v", err)
+		}
+	}
+
+	var args map[string]interface{}
+	if err := unmarshalJSON([]byte(body), &args); err != nil {
+		return nil, nil, fmt.Errorf("invalid body, must be a JSON object of arguments: %v", err)
+	}
+	arg3, err := e.method.EncodeArgs(args)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dynamic.EncodeHeaders(headers), arg3, nil
+}
+
+func (e thriftEncoding) decode(arg2, arg3 []byte, success bool) (interface{}, interface{}, error) {
+	headers, err := dynamic.DecodeHeaders(arg2)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode response headers: %v", err)
+	}
+	_, result, err := e.method.DecodeResult(arg3)
+	return headers, result, err
+}
+
+// normalizeJSON verifies that s is valid JSON, and uses defaultValue if s is empty.
+func normalizeJSON(s, defaultValue string) ([]byte, error) {
+	if s == "" {
+		s = defaultValue
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, err
+	}
+	return []byte(s), nil
+}
+
+// unmarshalJSON decodes JSON, keeping numbers as json.Number so large integers are not rounded.
+// Empty data is treated as null.
+func unmarshalJSON(data []byte, v interface{}) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	return d.Decode(v)
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// tcurl makes ad-hoc calls to TChannel services and prints the response, similar to
+// the tcurl tool in tchannel-node. Options must be specified before the service and method:
+//
+//	tcurl -p localhost:12345 -3 'hello' myservice echo
+//	tcurl -p localhost:12345 -json -3 '{"id": 1}' myservice getUser
+//	tcurl -p localhost:12345 -thrift user.thrift -3 '{"id": 1}' myservice UserService::get
+//
+// The response is printed as JSON containing the response head (arg2), body (arg3),
+// the peer that handled the call, and the tracing information for the call.
+// tcurl exits with a non-zero status if the call fails or returns an application error.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/raw"
+)
+
+// peerList is a flag that can be specified multiple times.
+type peerList []string
+
+func (l *peerList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *peerList) Set(hostPort string) error {
+	*l = append(*l, hostPort)
+	return nil
+}
+
+// options are the options for a single call.
+type options struct {
+	Peers    []string
+	Service  string
+	Method   string
+	Head     string
+	Body     string
+	JSON     bool
+	Thrift   string
+	Timeout  time.Duration
+	ShardKey string
+	Caller   string
+	Trace    bool
+}
+
+// output is the result of a call, which is printed as JSON.
+type output struct {
+	OK        bool        `json:"ok"`
+	Peer      string      `json:"peer,omitempty"`
+	Head      interface{} `json:"head,omitempty"`
+	Body      interface{} `json:"body,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	ErrorCode string      `json:"errorCode,omitempty"`
+	Trace     *traceInfo  `json:"trace,omitempty"`
+}
+
+// traceInfo is the tracing information reported for the call.
+type traceInfo struct {
+	TraceID  string `json:"traceID"`
+	SpanID   string `json:"spanID"`
+	ParentID string `json:"parentID"`
+	Enabled  bool   `json:"enabled"`
+	Duration string `json:"duration,omitempty"`
+}
+
+// traceRecorder is a TraceReporter that records the span of the outbound call.
+type traceRecorder struct {
+	sync.Mutex
+	trace *traceInfo
+	peer  string
+}
+
+func (r *traceRecorder) Report(span tchannel.Span, annotations []tchannel.Annotation,
+	_ []tchannel.BinaryAnnotation, targetEndpoint tchannel.TargetEndpoint) {
+	trace := &traceInfo{
+		TraceID:  strconv.FormatUint(span.TraceID(), 16),
+		SpanID:   strconv.FormatUint(span.SpanID(), 16),
+		ParentID: strconv.FormatUint(span.ParentID(), 16),
+		Enabled:  span.TracingEnabled(),
+	}
+
+	var sent, received time.Time
+	for _, a := range annotations {
+		switch a.Key {
+		case tchannel.AnnotationKeyClientSend:
+			sent = a.Timestamp
+		case tchannel.AnnotationKeyClientReceive:
+			received = a.Timestamp
+		}
+	}
+	if !sent.IsZero() && !received.IsZero() {
+		trace.Duration = received.Sub(sent).String()
+	}
+
+	r.Lock()
+	r.trace = trace
+	r.peer = targetEndpoint.HostPort
+	r.Unlock()
+}
+
+func (r *traceRecorder) get() (*traceInfo, string) {
+	r.Lock()
+	defer r.Unlock()
+	return r.trace, r.peer
+}
+
+func main() {
+	var peers peerList
+	flag.Var(&peers, "p", "The host:port of a peer to call. May be specified multiple times")
+	var opts options
+	flag.StringVar(&opts.Head, "2", "", "The head (arg2) for the call. For json and thrift calls, a JSON object of application headers")
+	flag.StringVar(&opts.Body, "3", "", "The body (arg3) for the call. For json and thrift calls, a JSON value")
+	flag.BoolVar(&opts.JSON, "json", false, "Use the json arg scheme")
+	flag.StringVar(&opts.Thrift, "thrift", "", "Use the thrift arg scheme with the given Thrift IDL file. The method must be Service::method")
+	flag.DurationVar(&opts.Timeout, "timeout", time.Second, "The timeout for the call")
+	flag.StringVar(&opts.ShardKey, "shardKey", "", "The shard key for the call")
+	flag.StringVar(&opts.Caller, "caller", "tcurl", "The caller name for the call")
+	flag.BoolVar(&opts.Trace, "trace", false, "Enable tracing for the call")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s -p host:port [options] service method\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if len(peers) == 0 || flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	opts.Peers = peers
+	opts.Service = flag.Arg(0)
+	opts.Method = flag.Arg(1)
+
+	out, err := run(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tcurl: %v\n", err)
+		os.Exit(2)
+	}
+
+	bs, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "tcurl: failed to encode output: %v\n", err)
+		os.Exit(2)
+	}
+	fmt.Println(string(bs))
+	if !out.OK {
+		os.Exit(1)
+	}
+}
+
+// run makes the call described by opts. Errors returned by the call are reported
+// in the output, and the error is only returned if the call could not be made.
+func run(opts options) (*output, error) {
+	enc, err := newEncoding(opts)
+	if err != nil {
+		return nil, err
+	}
+	arg2, arg3, err := enc.encode(opts.Head, opts.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	recorder := &traceRecorder{}
+	ch, err := tchannel.NewChannel(opts.Caller, &tchannel.ChannelOptions{
+		Logger:        tchannel.NullLogger,
+		TraceReporter: recorder,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer ch.Close()
+
+	sc := ch.GetSubChannel(opts.Service)
+	for _, hostPort := range opts.Peers {
+		sc.Peers().Add(hostPort)
+	}
+
+	ctx, cancel := tchannel.NewContext(opts.Timeout)
+	defer cancel()
+	if opts.Trace {
+		tchannel.CurrentSpan(ctx).EnableTracing(true)
+	}
+
+	out := &output{}
+	call, err := sc.BeginCall(ctx, opts.Method, &tchannel.CallOptions{
+		Format:   enc.format(),
+		ShardKey: opts.ShardKey,
+	})
+	var resArg2, resArg3 []byte
+	var res *tchannel.OutboundCallResponse
+	if err == nil {
+		resArg2, resArg3, res, err = raw.WriteArgs(call, arg2, arg3)
+	}
+	out.Trace, out.Peer = recorder.get()
+	if err != nil {
+		out.Error = err.Error()
+		out.ErrorCode = tchannel.ErrorClass(err).Code.MetricsKey()
+		return out, nil
+	}
+
+	out.OK = !res.ApplicationError()
+	out.Head, out.Body, err = enc.decode(resArg2, resArg3, out.OK)
+	if err != nil {
+		out.OK = false
+		out.Error = err.Error()
+	}
+	return out, nil
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func withServer(t *testing.T, f func(ch *tchannel.Channel, opts options)) {
+	ch, err := testutils.NewServer(nil)
+	require.NoError(t, err, "NewServer failed")
+	defer ch.Close()
+
+	echo := func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	}
+	testutils.RegisterFunc(t, ch, "echo", echo)
+	testutils.RegisterFunc(t, ch, "appError", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{IsErr: true, Arg3: []byte("app error")}, nil
+	})
+	testutils.RegisterFunc(t, ch, "Base::Health", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		// The result struct with success set to "ok".
+		return &raw.Res{Arg2: args.Arg2, Arg3: []byte{0x0b, 0, 0, 0, 0, 0, 2, 'o', 'k', 0}}, nil
+	})
+
+	f(ch, options{
+		Peers:   []string{ch.PeerInfo().HostPort},
+		Service: ch.PeerInfo().ServiceName,
+		Timeout: time.Second,
+		Caller:  "tcurl",
+	})
+}
+
+func TestRunRaw(t *testing.T) {
+	withServer(t, func(ch *tchannel.Channel, opts options) {
+		opts.Method = "echo"
+		opts.Head = "head"
+		opts.Body = "body"
+		opts.Trace = true
+
+		out, err := run(opts)
+		require.NoError(t, err, "run failed")
+		assert.True(t, out.OK, "call should succeed")
+		assert.Equal(t, "head", out.Head, "head mismatch")
+		assert.Equal(t, "body", out.Body, "body mismatch")
+		assert.Equal(t, ch.PeerInfo().HostPort, out.Peer, "peer mismatch")
+		require.NotNil(t, out.Trace, "missing trace")
+		assert.True(t, out.Trace.Enabled, "tracing should be enabled")
+		assert.NotEqual(t, "0", out.Trace.TraceID, "missing trace ID")
+		assert.NotEmpty(t, out.Trace.Duration, "missing duration")
+	})
+}
+
+func TestRunJSON(t *testing.T) {
+	withServer(t, func(ch *tchannel.Channel, opts options) {
+		opts.Method = "echo"
+		opts.JSON = true
+		opts.Head = `{"user": "tcurl"}`
+		opts.Body = `{"id": 12345678901234567890, "name": "x"}`
+
+		out, err := run(opts)
+		require.NoError(t, err, "run failed")
+		assert.True(t, out.OK, "call should succeed")
+
+		bs, err := json.Marshal(out.Body)
+		require.NoError(t, err, "Marshal failed")
+		assert.Equal(t, `{"id":12345678901234567890,"name":"x"}`, string(bs), "body mismatch")
+		assert.Equal(t, map[string]interface{}{"user": "tcurl"}, out.Head, "head mismatch")
+
+		opts.Body = "{"
+		_, err = run(opts)
+		assert.Error(t, err, "run should fail for invalid JSON")
+	})
+}
+
+func TestRunThrift(t *testing.T) {
+	withServer(t, func(ch *tchannel.Channel, opts options) {
+		opts.Method = "Base::Health"
+		opts.Thrift = "../../thrift/dynamic/test.thrift"
+		opts.Head = `{"k": "v"}`
+
+		out, err := run(opts)
+		require.NoError(t, err, "run failed")
+		assert.True(t, out.OK, "call should succeed")
+		assert.Equal(t, map[string]string{"k": "v"}, out.Head, "headers mismatch")
+		assert.Equal(t, "ok", out.Body, "result mismatch")
+
+		opts.Method = "Base::Unknown"
+		_, err = run(opts)
+		assert.Error(t, err, "run should fail for unknown methods")
+	})
+}
+
+func TestRunErrors(t *testing.T) {
+	withServer(t, func(ch *tchannel.Channel, opts options) {
+		opts.Method = "appError"
+		out, err := run(opts)
+		require.NoError(t, err, "run failed")
+		assert.False(t, out.OK, "application errors should not be OK")
+		assert.Equal(t, "app error", out.Body, "body mismatch")
+
+		opts.Method = "unknown"
+		out, err = run(opts)
+		require.NoError(t, err, "run failed")
+		assert.False(t, out.OK, "system errors should not be OK")
+		assert.Equal(t, "bad-request", out.ErrorCode, "error code mismatch")
+		assert.NotEmpty(t, out.Error, "missing error")
+	})
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// thealth calls the Meta::health endpoint of a TChannel Thrift service, and can be used as
+// a container liveness or readiness probe, or as a load balancer health check script:
+//
+//	thealth -hostPort 127.0.0.1:12345 -service keyvalue -timeout 500ms
+//
+// By default, thealth makes a readiness check, which fails while the service is draining
+// or any of its dependencies are unhealthy. Use -type liveness to only check that the
+// process is up.
+//
+// thealth exits with status 0 if the service is healthy, 1 if the service reports that
+// it is not healthy, and 2 if the health check could not be made.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/thrift"
+)
+
+const (
+	exitHealthy   = 0
+	exitUnhealthy = 1
+	exitFailed    = 2
+)
+
+// options are the options for a health check.
+type options struct {
+	HostPort string
+	Service  string
+	Timeout  time.Duration
+	Caller   string
+	Type     string
+}
+
+func main() {
+	var opts options
+	flag.StringVar(&opts.HostPort, "hostPort", "", "The host:port of the service to check")
+	flag.StringVar(&opts.Service, "service", "", "The service name to check")
+	flag.DurationVar(&opts.Timeout, "timeout", time.Second, "The timeout for the health check")
+	flag.StringVar(&opts.Caller, "caller", "thealth", "The caller name for the health check")
+	flag.StringVar(&opts.Type, "type", "readiness", "The type of health check: liveness or readiness")
+	flag.Parse()
+
+	if opts.HostPort == "" || opts.Service == "" {
+		flag.Usage()
+		os.Exit(exitFailed)
+	}
+
+	ok, message, err := check(opts)
+	switch {
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "health check failed: %v\n", err)
+		os.Exit(exitFailed)
+	case !ok:
+		printStatus("unhealthy", message)
+		os.Exit(exitUnhealthy)
+	}
+	printStatus("healthy", message)
+	os.Exit(exitHealthy)
+}
+
+func printStatus(status, message string) {
+	if message == "" {
+		fmt.Println(status)
+	} else {
+		fmt.Printf("%v: %v\n", status, message)
+	}
+}
+
+// check makes a health check call to the service specified in opts.
+func check(opts options) (ok bool, message string, err error) {
+	var req thrift.HealthRequest
+	switch opts.Type {
+	case "liveness":
+		req.Type = thrift.Process
+	case "readiness", "":
+		req.Type = thrift.Traffic
+	default:
+		return false, "", fmt.Errorf("unknown health check type %q", opts.Type)
+	}
+
+	ch, err := tchannel.NewChannel(opts.Caller, &tchannel.ChannelOptions{
+		Logger: tchannel.NullLogger,
+	})
+	if err != nil {
+		return false, "", err
+	}
+	defer ch.Close()
+
+	ctx, cancel := thrift.NewContext(opts.Timeout)
+	defer cancel()
+
+	client := thrift.NewClient(ch, opts.Service, &thrift.ClientOptions{HostPort: opts.HostPort})
+	return thrift.CheckHealthRequest(ctx, client, req)
+}
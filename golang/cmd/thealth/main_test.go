@@ -0,0 +1,83 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/testutils"
+	"github.com/uber/tchannel/golang/thrift"
+)
+
+func TestCheck(t *testing.T) {
+	ch, err := testutils.NewServer(nil)
+	require.NoError(t, err, "NewServer failed")
+	defer ch.Close()
+	server := thrift.NewServer(ch)
+
+	opts := options{
+		HostPort: ch.PeerInfo().HostPort,
+		Service:  ch.PeerInfo().ServiceName,
+		Timeout:  time.Second,
+		Caller:   "thealth",
+	}
+	ok, _, err := check(opts)
+	require.NoError(t, err, "check failed")
+	assert.True(t, ok, "service should be healthy")
+
+	server.RegisterHealthHandler(func(ctx thrift.Context) (bool, string) {
+		return false, "draining"
+	})
+	ok, message, err := check(opts)
+	require.NoError(t, err, "check failed")
+	assert.False(t, ok, "service should be unhealthy")
+	assert.Equal(t, "draining", message, "message mismatch")
+
+	opts.Type = "liveness"
+	ch.StartDrain()
+	ok, _, err = check(opts)
+	require.NoError(t, err, "check failed")
+	assert.False(t, ok, "liveness should use the registered handler")
+
+	server.RegisterHealthHandler(func(ctx thrift.Context) (bool, string) {
+		return true, ""
+	})
+	ok, _, err = check(opts)
+	require.NoError(t, err, "check failed")
+	assert.True(t, ok, "liveness should not depend on draining")
+
+	opts.Type = "readiness"
+	ok, message, err = check(opts)
+	require.NoError(t, err, "check failed")
+	assert.False(t, ok, "readiness should fail while draining")
+	assert.Equal(t, "draining", message, "message mismatch")
+
+	opts.Type = "unknown"
+	_, _, err = check(opts)
+	assert.Error(t, err, "check should fail for an unknown type")
+
+	opts.Type = "readiness"
+	ch.Close()
+	_, _, err = check(opts)
+	assert.Error(t, err, "check should fail when the service is down")
+}
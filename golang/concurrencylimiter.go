@@ -0,0 +1,264 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultConcurrencyInitialLimit = 20
+	defaultConcurrencyMinLimit     = 1
+	defaultConcurrencyMaxLimit     = 1000
+	defaultConcurrencyTolerance    = 1.5
+	defaultConcurrencySmoothing    = 0.2
+	defaultConcurrencyLongWindow   = 600
+)
+
+// ConcurrencyLimiterOptions configure an adaptive limit on the number of inbound calls that
+// are handled concurrently. Calls over the limit are queued if MaxQueueSize is set, and are
+// otherwise rejected with ErrServerBusy. The limit is adjusted by comparing the latency
+// of each call against a long-term baseline: it shrinks as latency rises above the
+// baseline, and grows while latency stays close to it.
+type ConcurrencyLimiterOptions struct {
+	// InitialLimit is the limit used before any calls have completed. Defaults to 20.
+	InitialLimit int
+
+	// MinLimit is the lowest the limit can go. Defaults to 1.
+	MinLimit int
+
+	// MaxLimit is the highest the limit can go. Defaults to 1000.
+	MaxLimit int
+
+	// Tolerance is the ratio of call latency to the baseline latency that is tolerated
+	// before the limit is reduced. Defaults to 1.5.
+	Tolerance float64
+
+	// Smoothing is the weight (between 0 and 1) given to each new limit estimate. Defaults to 0.2.
+	Smoothing float64
+
+	// LongWindow is the number of calls over which the baseline latency is averaged.
+	// Defaults to 600.
+	LongWindow int
+
+	// MaxQueueSize is the number of calls over the limit that can wait for another call to
+	// complete. A call is only queued if its remaining time to live is longer than the expected
+	// wait, and is otherwise rejected with ErrTimeout. Calls are not queued if this is zero.
+	MaxQueueSize int
+}
+
+// concurrencyLimiter is a gradient-based adaptive concurrency limiter.
+type concurrencyLimiter struct {
+	opts       ConcurrencyLimiterOptions
+	longFactor float64
+	clock      Clock
+
+	mut      sync.Mutex
+	limit    float64
+	inFlight int
+	longRTT  float64
+	samples  int64
+
+	// waiters are the calls waiting for a slot, in order. A waiter's channel is closed
+	// once it has been given a slot.
+	waiters []chan struct{}
+}
+
+func newConcurrencyLimiter(opts *ConcurrencyLimiterOptions, clock Clock) *concurrencyLimiter {
+	if opts == nil {
+		return nil
+	}
+
+	l := &concurrencyLimiter{opts: *opts, clock: clock}
+	if l.opts.InitialLimit <= 0 {
+		l.opts.InitialLimit = defaultConcurrencyInitialLimit
+	}
+	if l.opts.MinLimit <= 0 {
+		l.opts.MinLimit = defaultConcurrencyMinLimit
+	}
+	if l.opts.MaxLimit <= 0 {
+		l.opts.MaxLimit = defaultConcurrencyMaxLimit
+	}
+	if l.opts.Tolerance <= 0 {
+		l.opts.Tolerance = defaultConcurrencyTolerance
+	}
+	if l.opts.Smoothing <= 0 || l.opts.Smoothing > 1 {
+		l.opts.Smoothing = defaultConcurrencySmoothing
+	}
+	if l.opts.LongWindow <= 0 {
+		l.opts.LongWindow = defaultConcurrencyLongWindow
+	}
+	l.longFactor = 2 / float64(l.opts.LongWindow+1)
+	l.limit = float64(l.opts.InitialLimit)
+	return l
+}
+
+// acquire reserves a slot for a new call, waiting in the queue if the limit has been
+// reached. It returns ErrServerBusy if the queue is full, or ErrTimeout if the call's
+// deadline will pass before it is expected to get a slot.
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mut.Lock()
+	if l.inFlight < int(l.limit) && len(l.waiters) == 0 {
+		l.inFlight++
+		l.mut.Unlock()
+		return nil
+	}
+	if len(l.waiters) >= l.opts.MaxQueueSize {
+		l.mut.Unlock()
+		return ErrServerBusy
+	}
+	deadline, ok := ctx.Deadline()
+	if ok && deadline.Sub(l.clock.Now()) < l.expectedWait(len(l.waiters)+1) {
+		l.mut.Unlock()
+		return ErrTimeout
+	}
+
+	waiter := make(chan struct{})
+	l.waiters = append(l.waiters, waiter)
+	l.mut.Unlock()
+
+	select {
+	case <-waiter:
+		return nil
+	case <-ctx.Done():
+	}
+
+	l.mut.Lock()
+	removed := l.removeWaiter(waiter)
+	l.mut.Unlock()
+	if !removed {
+		// The slot was given to this call as the context finished, so pass it on.
+		l.release(0)
+	}
+	return ErrTimeout
+}
+
+// expectedWait estimates how long the call at the given queue position will wait for
+// a slot, using the baseline latency. mut must be held.
+func (l *concurrencyLimiter) expectedWait(position int) time.Duration {
+	return time.Duration(float64(position) * l.longRTT / l.limit)
+}
+
+// removeWaiter removes the given waiter from the queue, returning false if it had
+// already been given a slot. mut must be held.
+func (l *concurrencyLimiter) removeWaiter(waiter chan struct{}) bool {
+	for i, w := range l.waiters {
+		if w == waiter {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// release releases the slot for a completed call, and updates the limit using its latency.
+// Latencies that are not positive do not update the limit.
+func (l *concurrencyLimiter) release(latency time.Duration) {
+	if l == nil {
+		return
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	inFlight := l.inFlight
+	l.inFlight--
+	if latency > 0 {
+		l.updateLimit(latency, inFlight)
+	}
+
+	for len(l.waiters) > 0 && l.inFlight < int(l.limit) {
+		waiter := l.waiters[0]
+		l.waiters = l.waiters[1:]
+		l.inFlight++
+		close(waiter)
+	}
+}
+
+// updateLimit updates the limit using the latency of a call that completed while there
+// were inFlight calls. mut must be held.
+func (l *concurrencyLimiter) updateLimit(latency time.Duration, inFlight int) {
+	rtt := float64(latency)
+	if l.samples == 0 {
+		l.longRTT = rtt
+	} else {
+		l.longRTT += l.longFactor * (rtt - l.longRTT)
+	}
+	l.samples++
+
+	// If latency has dropped well below the baseline, such as after a period of overload,
+	// decay the baseline faster so the limit can recover.
+	if l.longRTT/rtt > 2 {
+		l.longRTT *= 0.95
+	}
+
+	gradient := math.Max(0.5, math.Min(1, l.opts.Tolerance*l.longRTT/rtt))
+	newLimit := l.limit*gradient + math.Sqrt(l.limit)
+
+	// Only grow the limit if the server is making use of the current limit.
+	if newLimit > l.limit && float64(inFlight) < l.limit/2 {
+		return
+	}
+
+	newLimit = l.limit*(1-l.opts.Smoothing) + newLimit*l.opts.Smoothing
+	newLimit = math.Max(float64(l.opts.MinLimit), math.Min(float64(l.opts.MaxLimit), newLimit))
+	l.limit = newLimit
+}
+
+// setMaxLimit changes the highest the limit can go, lowering the current limit if needed.
+func (l *concurrencyLimiter) setMaxLimit(maxLimit int) error {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	if maxLimit < l.opts.MinLimit {
+		return fmt.Errorf("max concurrency %v is below the minimum limit %v", maxLimit, l.opts.MinLimit)
+	}
+	l.opts.MaxLimit = maxLimit
+	l.limit = math.Min(l.limit, float64(maxLimit))
+	return nil
+}
+
+// maxLimit returns the highest the limit can go.
+func (l *concurrencyLimiter) maxLimit() int {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	return l.opts.MaxLimit
+}
+
+// currentLimit returns the current concurrency limit and the number of queued calls,
+// or zeros if there is no limiter.
+func (l *concurrencyLimiter) currentLimit() (limit int, queued int) {
+	if l == nil {
+		return 0, 0
+	}
+
+	l.mut.Lock()
+	defer l.mut.Unlock()
+	return int(l.limit), len(l.waiters)
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func callLimitedServer(client, server *Channel) error {
+	_, err := callWithTimeout(client, server.PeerInfo().HostPort, "limited-svc", "op", nil, nil)
+	return err
+}
+
+func TestConcurrencyLimiterSheds(t *testing.T) {
+	var started sync.WaitGroup
+	release := make(chan struct{})
+	stats := newRecordingStatsReporter()
+	server, err := testutils.NewServer(&testutils.ChannelOpts{
+		ServiceName:        "limited-svc",
+		StatsReporter:      stats,
+		ConcurrencyLimiter: &ConcurrencyLimiterOptions{InitialLimit: 2, MinLimit: 2, MaxLimit: 2},
+	})
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "op", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		started.Done()
+		<-release
+		return &raw.Res{}, nil
+	})
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	started.Add(2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, callLimitedServer(client, server), "calls within the limit should succeed")
+		}()
+	}
+	started.Wait()
+
+	err = callLimitedServer(client, server)
+	assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(err), "calls over the limit should be rejected")
+	close(release)
+	wg.Wait()
+
+	shed := counterValue(stats, "inbound.calls.shed")
+	assert.Equal(t, int64(1), shed, "shed counter mismatch")
+	assert.Equal(t, 2, server.Gauges().ConcurrencyLimit, "concurrency limit mismatch")
+}
+
+func TestConcurrencyLimiterAdapts(t *testing.T) {
+	var delay int64
+	server, err := testutils.NewServer(&testutils.ChannelOpts{
+		ServiceName:        "limited-svc",
+		ConcurrencyLimiter: &ConcurrencyLimiterOptions{InitialLimit: 10, LongWindow: 100},
+	})
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "op", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		time.Sleep(time.Duration(atomic.LoadInt64(&delay)))
+		return &raw.Res{}, nil
+	})
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	atomic.StoreInt64(&delay, int64(5*time.Millisecond))
+	for i := 0; i < 20; i++ {
+		require.NoError(t, callLimitedServer(client, server), "call failed")
+	}
+	before := server.Gauges().ConcurrencyLimit
+	assert.True(t, before > 0 && before <= 10, "limit should not grow while calls are sequential, got %v", before)
+
+	atomic.StoreInt64(&delay, int64(50*time.Millisecond))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, callLimitedServer(client, server), "call failed")
+	}
+	after := server.Gauges().ConcurrencyLimit
+	assert.True(t, after < before, "limit should shrink as latency rises, went from %v to %v", before, after)
+}
+
+func TestConcurrencyLimiterQueue(t *testing.T) {
+	var block int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	clock := testutils.NewFakeClock(time.Now())
+	server, err := testutils.NewServer(&testutils.ChannelOpts{
+		ServiceName:        "limited-svc",
+		Clock:              clock,
+		ConcurrencyLimiter: &ConcurrencyLimiterOptions{InitialLimit: 1, MinLimit: 1, MaxLimit: 1, MaxQueueSize: 1},
+	})
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "op", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		if atomic.CompareAndSwapInt32(&block, 1, 0) {
+			started <- struct{}{}
+			<-release
+			return &raw.Res{}, nil
+		}
+		clock.Advance(100 * time.Millisecond)
+		return &raw.Res{}, nil
+	})
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	callWithTTL := func(ttl time.Duration) error {
+		ctx, cancel := NewContext(ttl)
+		defer cancel()
+		_, _, _, err := raw.Call(ctx, client, server.PeerInfo().HostPort, "limited-svc", "op", nil, nil)
+		return err
+	}
+
+	// Establish the baseline latency for calls.
+	require.NoError(t, callWithTTL(time.Second), "call failed")
+
+	atomic.StoreInt32(&block, 1)
+	blockedErr := make(chan error)
+	go func() { blockedErr <- callWithTTL(time.Second) }()
+	<-started
+
+	// A call that would expire before it gets a slot is rejected immediately. The server's
+	// clock is moved so the call has 50ms left, and it would otherwise wait for a minute.
+	clock.Advance(time.Minute - 150*time.Millisecond)
+	err = callWithTTL(time.Minute)
+	assert.Equal(t, ErrCodeTimeout, GetSystemErrorCode(err), "call with a short TTL should be rejected")
+
+	// A call with enough time left waits for the blocked call to complete.
+	queuedErr := make(chan error)
+	go func() { queuedErr <- callWithTTL(2 * time.Minute) }()
+	require.True(t, testutils.WaitFor(time.Second, func() bool {
+		return server.Gauges().ConcurrencyQueued == 1
+	}), "call was not queued")
+
+	// The queue is full, so further calls are rejected.
+	err = callWithTTL(time.Second)
+	assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(err), "calls should be rejected when the queue is full")
+
+	close(release)
+	assert.NoError(t, <-blockedErr, "blocked call failed")
+	assert.NoError(t, <-queuedErr, "queued call failed")
+}
@@ -0,0 +1,375 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package config builds channel options and subchannel policies from a YAML or JSON
+// document, and applies changes to a running channel when the document is reloaded.
+//
+// A document looks like:
+//
+//	processName: keyvalue-server
+//	profile: lowLatency
+//	peers: ["10.0.0.1:21300", "10.0.0.2:21300"]
+//	tls:
+//	  certFile: /etc/tchannel/cert.pem
+//	  keyFile: /etc/tchannel/key.pem
+//	  caFile: ${TCHANNEL_CA_FILE}
+//	concurrencyLimit:
+//	  maxLimit: 200
+//	services:
+//	  keyvalue:
+//	    timeout: 500ms
+//	    operationTimeouts: {"KeyValue::scan": 5s}
+//	    retry: {maxAttempts: 3, retryOn: unexpected}
+//
+// Environment variables referenced as ${NAME} are replaced before the document is parsed,
+// and ${NAME:-default} uses the default if the variable is not set. This allows values to
+// be overridden by the environment, such as per deployment.
+//
+// Only some settings can be changed while the channel is running: see Watcher for the
+// settings that are applied when the document is reloaded.
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/uber/tchannel/golang"
+	"go.yaml.in/yaml/v3"
+)
+
+// Config is the configuration for a channel.
+type Config struct {
+	// ProcessName is the process name used by the channel.
+	ProcessName string `yaml:"processName"`
+
+	// Profile is the name of the preset of channel options to use: lowLatency, bulkTransfer
+	// or highFanout. Options that are set explicitly take precedence.
+	Profile string `yaml:"profile"`
+
+	// Peers are added to the channel's root peer list.
+	Peers []string `yaml:"peers"`
+
+	// TLS configures TLS using certificates and keys loaded from files.
+	TLS *TLSConfig `yaml:"tls"`
+
+	// IPFilter restricts the addresses that can connect to the channel.
+	IPFilter *IPFilterConfig `yaml:"ipFilter"`
+
+	// RetryBudget limits the ratio of retries to calls.
+	RetryBudget *RetryBudgetConfig `yaml:"retryBudget"`
+
+	// ConcurrencyLimit limits the number of concurrent inbound calls.
+	ConcurrencyLimit *ConcurrencyLimitConfig `yaml:"concurrencyLimit"`
+
+	// Services are the policies for calls to each service, keyed by service name.
+	Services map[string]ServiceConfig `yaml:"services"`
+}
+
+// TLSConfig is the configuration for TLS.
+type TLSConfig struct {
+	// CertFile and KeyFile are the PEM encoded certificate and key used for both
+	// inbound and outbound connections. The certificate is reloaded when the
+	// configuration is reloaded.
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+
+	// CAFile contains the PEM encoded CAs used to verify peers for outbound connections.
+	// Outbound connections use TLS only if CAFile is set.
+	CAFile string `yaml:"caFile"`
+
+	// ClientCAFile contains the PEM encoded CAs used to verify clients, which enables mutual TLS.
+	ClientCAFile string `yaml:"clientCAFile"`
+
+	// HandshakeTimeout is the time allowed for the TLS handshake.
+	HandshakeTimeout time.Duration `yaml:"handshakeTimeout"`
+
+	// CycleConnections closes existing connections when the certificate changes.
+	CycleConnections bool `yaml:"cycleConnections"`
+}
+
+// IPFilterConfig is the configuration for the IP filter, see tchannel.IPFilterOptions.
+type IPFilterConfig struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// RetryBudgetConfig is the configuration for the retry budget, see tchannel.RetryBudgetOptions.
+type RetryBudgetConfig struct {
+	Ratio               float64 `yaml:"ratio"`
+	MinRetriesPerSecond float64 `yaml:"minRetriesPerSecond"`
+	MaxTokens           float64 `yaml:"maxTokens"`
+}
+
+// ConcurrencyLimitConfig is the configuration for the concurrency limiter, see
+// tchannel.ConcurrencyLimiterOptions.
+type ConcurrencyLimitConfig struct {
+	InitialLimit int `yaml:"initialLimit"`
+	MinLimit     int `yaml:"minLimit"`
+	MaxLimit     int `yaml:"maxLimit"`
+	MaxQueueSize int `yaml:"maxQueueSize"`
+}
+
+// ServiceConfig is the configuration for calls to a service.
+type ServiceConfig struct {
+	// Timeout is the default timeout for calls made using the service's subchannel.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// OperationTimeouts overrides Timeout for specific operations.
+	OperationTimeouts map[string]time.Duration `yaml:"operationTimeouts"`
+
+	// MaxInboundTimeout caps the time to live of inbound calls to the service.
+	MaxInboundTimeout time.Duration `yaml:"maxInboundTimeout"`
+
+	// Retry is the retry policy for calls to the service.
+	Retry *RetryConfig `yaml:"retry"`
+}
+
+// RetryConfig is the configuration for retries, see tchannel.RetryOptions.
+type RetryConfig struct {
+	MaxAttempts       int           `yaml:"maxAttempts"`
+	RetryOn           string        `yaml:"retryOn"`
+	TimeoutPerAttempt time.Duration `yaml:"timeoutPerAttempt"`
+	BackoffBase       time.Duration `yaml:"backoffBase"`
+	BackoffMax        time.Duration `yaml:"backoffMax"`
+}
+
+// retryOnValues are the valid values of RetryConfig.RetryOn.
+var retryOnValues = map[string]tchannel.RetryOn{
+	"":           tchannel.RetryDefault,
+	"connection": tchannel.RetryConnectionError,
+	"never":      tchannel.RetryNever,
+	"unexpected": tchannel.RetryUnexpected,
+	"idempotent": tchannel.RetryIdempotent,
+}
+
+var profileValues = map[string]*tchannel.ChannelProfile{
+	"lowLatency":   &tchannel.ProfileLowLatency,
+	"bulkTransfer": &tchannel.ProfileBulkTransfer,
+	"highFanout":   &tchannel.ProfileHighFanout,
+}
+
+// Options are options for loading configuration.
+type Options struct {
+	// LookupEnv looks up environment variables. Defaults to os.LookupEnv.
+	LookupEnv func(name string) (string, bool)
+
+	// Logger is used to log reloads. Defaults to the channel's logger.
+	Logger tchannel.Logger
+
+	// ReloadInterval is how often Watcher checks whether the file has changed.
+	// Defaults to 5 seconds.
+	ReloadInterval time.Duration
+
+	// OnReload is called after Watcher reloads the configuration because the file
+	// changed, with the error if the configuration could not be loaded or applied.
+	OnReload func(cfg *Config, err error)
+}
+
+func (o *Options) lookupEnv() func(string) (string, bool) {
+	if o == nil || o.LookupEnv == nil {
+		return os.LookupEnv
+	}
+	return o.LookupEnv
+}
+
+// Parse parses a YAML or JSON document. Unknown fields are rejected, so that misspelt
+// settings are not silently ignored.
+func Parse(data []byte, opts *Options) (*Config, error) {
+	data, err := expandEnv(data, opts.lookupEnv())
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadFile reads and parses the document in the given file.
+func LoadFile(path string, opts *Options) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, opts)
+}
+
+// expandEnv replaces ${NAME} and ${NAME:-default} with the value of the environment variable.
+func expandEnv(data []byte, lookupEnv func(string) (string, bool)) ([]byte, error) {
+	var err error
+	expanded := os.Expand(string(data), func(name string) string {
+		var defaultValue string
+		hasDefault := false
+		if i := strings.Index(name, ":-"); i >= 0 {
+			name, defaultValue, hasDefault = name[:i], name[i+2:], true
+		}
+		if v, ok := lookupEnv(name); ok {
+			return v
+		}
+		if !hasDefault && err == nil {
+			err = fmt.Errorf("environment variable %q is not set", name)
+		}
+		return defaultValue
+	})
+	return []byte(expanded), err
+}
+
+func (c *Config) validate() error {
+	if _, ok := profileValues[c.Profile]; c.Profile != "" && !ok {
+		return fmt.Errorf("invalid profile %q", c.Profile)
+	}
+	if c.TLS != nil && (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return fmt.Errorf("tls: certFile and keyFile must be set together")
+	}
+	for serviceName, svc := range c.Services {
+		if svc.Retry == nil {
+			continue
+		}
+		if _, ok := retryOnValues[svc.Retry.RetryOn]; !ok {
+			return fmt.Errorf("services.%v.retry: invalid retryOn %q", serviceName, svc.Retry.RetryOn)
+		}
+	}
+	return nil
+}
+
+// ChannelOptions returns a copy of opts with the options set by the configuration.
+// Certificates and CAs are loaded from the configured files.
+func (c *Config) ChannelOptions(opts *tchannel.ChannelOptions) (*tchannel.ChannelOptions, error) {
+	var chOpts tchannel.ChannelOptions
+	if opts != nil {
+		chOpts = *opts
+	}
+
+	if c.ProcessName != "" {
+		chOpts.ProcessName = c.ProcessName
+	}
+	if c.Profile != "" {
+		chOpts.Profile = profileValues[c.Profile]
+	}
+	if c.TLS != nil {
+		tlsOpts, err := c.TLS.options()
+		if err != nil {
+			return nil, err
+		}
+		chOpts.TLS = tlsOpts
+	}
+	if c.IPFilter != nil {
+		chOpts.IPFilter = &tchannel.IPFilterOptions{Allow: c.IPFilter.Allow, Deny: c.IPFilter.Deny}
+	}
+	if c.RetryBudget != nil {
+		chOpts.RetryBudget = &tchannel.RetryBudgetOptions{
+			Ratio:               c.RetryBudget.Ratio,
+			MinRetriesPerSecond: c.RetryBudget.MinRetriesPerSecond,
+			MaxTokens:           c.RetryBudget.MaxTokens,
+		}
+	}
+	if c.ConcurrencyLimit != nil {
+		chOpts.ConcurrencyLimiter = &tchannel.ConcurrencyLimiterOptions{
+			InitialLimit: c.ConcurrencyLimit.InitialLimit,
+			MinLimit:     c.ConcurrencyLimit.MinLimit,
+			MaxLimit:     c.ConcurrencyLimit.MaxLimit,
+			MaxQueueSize: c.ConcurrencyLimit.MaxQueueSize,
+		}
+	}
+	return &chOpts, nil
+}
+
+func (c *TLSConfig) options() (*tchannel.TLSOptions, error) {
+	opts := &tchannel.TLSOptions{
+		HandshakeTimeout: c.HandshakeTimeout,
+		CycleConnections: c.CycleConnections,
+	}
+
+	if c.CertFile != "" {
+		certs, err := tchannel.NewFileCertificateReloader(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: failed to load certificate: %v", err)
+		}
+		opts.Certificates = certs
+	}
+	if c.CAFile != "" {
+		pool, err := loadCertPool(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: caFile: %v", err)
+		}
+		opts.Config = &tls.Config{RootCAs: pool}
+	}
+	if c.ClientCAFile != "" {
+		pool, err := loadCertPool(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("tls: clientCAFile: %v", err)
+		}
+		opts.ClientCAs = pool
+	}
+	return opts, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %v", path)
+	}
+	return pool, nil
+}
+
+// TimeoutOptions returns the timeouts for the given service.
+func (c *Config) TimeoutOptions(serviceName string) tchannel.TimeoutOptions {
+	svc := c.Services[serviceName]
+	return tchannel.TimeoutOptions{
+		Default:      svc.Timeout,
+		PerOperation: svc.OperationTimeouts,
+		MaxInbound:   svc.MaxInboundTimeout,
+	}
+}
+
+// RetryOptions returns the retry options for calls to the given service, or nil
+// if the service does not have a retry policy. They can be used with
+// tchannel.ContextBuilder.SetRetryOptions, and are applied to the channel by Watcher.
+func (c *Config) RetryOptions(serviceName string) *tchannel.RetryOptions {
+	retry := c.Services[serviceName].Retry
+	if retry == nil {
+		return nil
+	}
+	return &tchannel.RetryOptions{
+		MaxAttempts:       retry.MaxAttempts,
+		RetryOn:           retryOnValues[retry.RetryOn],
+		TimeoutPerAttempt: retry.TimeoutPerAttempt,
+		BackoffBase:       retry.BackoffBase,
+		BackoffMax:        retry.BackoffMax,
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+)
+
+const testYAML = `
+processName: kv-server
+profile: highFanout
+peers: ["127.0.0.1:1", "127.0.0.1:2"]
+ipFilter:
+  deny: ["10.0.0.0/8"]
+retryBudget:
+  ratio: 0.1
+concurrencyLimit:
+  maxLimit: 200
+  maxQueueSize: 10
+services:
+  keyvalue:
+    timeout: 500ms
+    operationTimeouts:
+      "KeyValue::scan": 5s
+    maxInboundTimeout: 2s
+    retry:
+      maxAttempts: 3
+      retryOn: unexpected
+      backoffBase: 5ms
+`
+
+const testJSON = `{
+  "processName": "kv-server",
+  "profile": "highFanout",
+  "peers": ["127.0.0.1:1", "127.0.0.1:2"],
+  "ipFilter": {"deny": ["10.0.0.0/8"]},
+  "retryBudget": {"ratio": 0.1},
+  "concurrencyLimit": {"maxLimit": 200, "maxQueueSize": 10},
+  "services": {
+    "keyvalue": {
+      "timeout": "500ms",
+      "operationTimeouts": {"KeyValue::scan": "5s"},
+      "maxInboundTimeout": "2s",
+      "retry": {"maxAttempts": 3, "retryOn": "unexpected", "backoffBase": "5ms"}
+    }
+  }
+}`
+
+// noEnv is an Options that does not look up any environment variables.
+var noEnv = &Options{LookupEnv: func(string) (string, bool) { return "", false }}
+
+func TestParse(t *testing.T) {
+	want := &Config{
+		ProcessName:      "kv-server",
+		Profile:          "highFanout",
+		Peers:            []string{"127.0.0.1:1", "127.0.0.1:2"},
+		IPFilter:         &IPFilterConfig{Deny: []string{"10.0.0.0/8"}},
+		RetryBudget:      &RetryBudgetConfig{Ratio: 0.1},
+		ConcurrencyLimit: &ConcurrencyLimitConfig{MaxLimit: 200, MaxQueueSize: 10},
+		Services: map[string]ServiceConfig{
+			"keyvalue": {
+				Timeout:           500 * time.Millisecond,
+				OperationTimeouts: map[string]time.Duration{"KeyValue::scan": 5 * time.Second},
+				MaxInboundTimeout: 2 * time.Second,
+				Retry:             &RetryConfig{MaxAttempts: 3, RetryOn: "unexpected", BackoffBase: 5 * time.Millisecond},
+			},
+		},
+	}
+
+	for _, doc := range []string{testYAML, testJSON} {
+		cfg, err := Parse([]byte(doc), noEnv)
+		require.NoError(t, err, "Parse failed")
+		assert.Equal(t, want, cfg, "unexpected config for:\n%v", doc)
+	}
+
+	cfg, err := Parse(nil, noEnv)
+	require.NoError(t, err, "Parse of an empty document failed")
+	assert.Equal(t, &Config{}, cfg)
+}
+
+func TestParseEnv(t *testing.T) {
+	env := map[string]string{"PROCESS": "from-env", "PEER": "127.0.0.1:3"}
+	opts := &Options{LookupEnv: func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}}
+
+	cfg, err := Parse([]byte(`
+processName: ${PROCESS}
+peers: ["${PEER}", "${OTHER_PEER:-127.0.0.1:4}"]
+`), opts)
+	require.NoError(t, err, "Parse failed")
+	assert.Equal(t, "from-env", cfg.ProcessName)
+	assert.Equal(t, []string{"127.0.0.1:3", "127.0.0.1:4"}, cfg.Peers)
+
+	_, err = Parse([]byte("processName: ${MISSING}"), opts)
+	if assert.Error(t, err, "Parse should fail for missing environment variables") {
+		assert.Contains(t, err.Error(), `"MISSING" is not set`)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		doc    string
+		errMsg string
+	}{
+		{"procesName: typo", "field procesName not found"},
+		{"processName: [", "invalid configuration"},
+		{"services: {svc: {timeout: soon}}", "invalid configuration"},
+		{"services: {svc: {retry: {retryOn: always}}}", `invalid retryOn "always"`},
+		{"tls: {certFile: cert.pem}", "certFile and keyFile must be set together"},
+		{"profile: fast", `invalid profile "fast"`},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.doc), noEnv)
+		if assert.Error(t, err, "Parse(%q) should fail", tt.doc) {
+			assert.Contains(t, err.Error(), tt.errMsg, "Parse(%q) error mismatch", tt.doc)
+		}
+	}
+}
+
+// writeSelfSignedCert writes a self-signed certificate and key to the given files.
+func writeSelfSignedCert(t *testing.T, certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "GenerateKey failed")
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err, "CreateCertificate failed")
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err, "MarshalECPrivateKey failed")
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	require.NoError(t, ioutil.WriteFile(certFile, certPEM, 0600), "failed to write certificate")
+	require.NoError(t, ioutil.WriteFile(keyFile, keyPEM, 0600), "failed to write key")
+}
+
+func TestChannelOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tchannel-config")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeSelfSignedCert(t, certFile, keyFile)
+
+	cfg, err := Parse([]byte(testYAML+`
+tls:
+  certFile: ${DIR}/cert.pem
+  keyFile: ${DIR}/key.pem
+  caFile: ${DIR}/cert.pem
+  clientCAFile: ${DIR}/cert.pem
+  handshakeTimeout: 3s
+`), &Options{LookupEnv: func(name string) (string, bool) { return dir, name == "DIR" }})
+	require.NoError(t, err, "Parse failed")
+
+	logger := tchannel.NewLogger(ioutil.Discard)
+	opts, err := cfg.ChannelOptions(&tchannel.ChannelOptions{Logger: logger, ProcessName: "default"})
+	require.NoError(t, err, "ChannelOptions failed")
+
+	assert.Equal(t, logger, opts.Logger, "existing options should be kept")
+	assert.Equal(t, "kv-server", opts.ProcessName)
+	assert.True(t, opts.Profile == &tchannel.ProfileHighFanout, "profile mismatch")
+	assert.Equal(t, &tchannel.IPFilterOptions{Deny: []string{"10.0.0.0/8"}}, opts.IPFilter)
+	assert.Equal(t, &tchannel.RetryBudgetOptions{Ratio: 0.1}, opts.RetryBudget)
+	assert.Equal(t, &tchannel.ConcurrencyLimiterOptions{MaxLimit: 200, MaxQueueSize: 10}, opts.ConcurrencyLimiter)
+	if assert.NotNil(t, opts.TLS, "TLS options should be set") {
+		assert.Equal(t, 3*time.Second, opts.TLS.HandshakeTimeout)
+		assert.NotNil(t, opts.TLS.Certificates.Certificate(), "certificate should be loaded")
+		assert.NotNil(t, opts.TLS.Config.RootCAs, "CAs should be loaded")
+		assert.NotNil(t, opts.TLS.ClientCAs, "client CAs should be loaded")
+	}
+
+	ch, err := tchannel.NewChannel("svc", opts)
+	require.NoError(t, err, "NewChannel failed")
+	ch.Close()
+
+	cfg.TLS.CAFile = keyFile
+	_, err = cfg.ChannelOptions(nil)
+	assert.Error(t, err, "ChannelOptions should fail if the CA file has no certificates")
+}
+
+func TestServiceOptions(t *testing.T) {
+	cfg, err := Parse([]byte(testYAML), noEnv)
+	require.NoError(t, err, "Parse failed")
+
+	assert.Equal(t, tchannel.TimeoutOptions{
+		Default:      500 * time.Millisecond,
+		PerOperation: map[string]time.Duration{"KeyValue::scan": 5 * time.Second},
+		MaxInbound:   2 * time.Second,
+	}, cfg.TimeoutOptions("keyvalue"))
+	assert.Equal(t, &tchannel.RetryOptions{
+		MaxAttempts: 3,
+		RetryOn:     tchannel.RetryUnexpected,
+		BackoffBase: 5 * time.Millisecond,
+	}, cfg.RetryOptions("keyvalue"))
+
+	assert.Equal(t, tchannel.TimeoutOptions{}, cfg.TimeoutOptions("unknown"))
+	assert.Nil(t, cfg.RetryOptions("unknown"))
+}
@@ -0,0 +1,255 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/uber/tchannel/golang"
+)
+
+const defaultReloadInterval = 5 * time.Second
+
+// Watcher applies the configuration in a file to a channel, and reloads it when the
+// file changes or Reload is called.
+//
+// The following settings are applied to the running channel when they change:
+// service timeouts and retry policies (through the channel's RuntimeOptions, so retry
+// policies are used by SubChannel.RunWithRetry), peers (which are added to or removed
+// from the root peer list), the IP filter, and the contents of the TLS certificate files.
+// Changes to other settings are logged, and take effect when the channel is recreated.
+type Watcher struct {
+	ch   *tchannel.Channel
+	path string
+	opts *Options
+	log  tchannel.Logger
+
+	// reloadMut serializes reloads.
+	reloadMut sync.Mutex
+	data      []byte
+
+	cfgMut sync.RWMutex
+	cfg    *Config
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// NewWatcher loads the configuration in the file at path, applies it to the channel,
+// and starts watching the file for changes. The channel should have been created using
+// the ChannelOptions from the same configuration.
+func NewWatcher(ch *tchannel.Channel, path string, opts *Options) (*Watcher, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	w := &Watcher{
+		ch:     ch,
+		path:   path,
+		opts:   opts,
+		log:    opts.Logger,
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+	if w.log == nil {
+		w.log = ch.Logger()
+	}
+
+	if _, err := w.reload(true); err != nil {
+		return nil, err
+	}
+
+	interval := opts.ReloadInterval
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+	go w.watch(interval)
+	return w, nil
+}
+
+// Config returns the configuration that was last applied.
+func (w *Watcher) Config() *Config {
+	w.cfgMut.RLock()
+	defer w.cfgMut.RUnlock()
+	return w.cfg
+}
+
+// Reload loads the configuration from the file and applies it, even if the file has not
+// changed. The TLS certificate is reloaded, so Reload can be used after certificates are
+// renewed. If the configuration cannot be loaded, the current configuration is kept.
+func (w *Watcher) Reload() error {
+	_, err := w.reload(true)
+	return err
+}
+
+// Close stops watching the file for changes.
+func (w *Watcher) Close() {
+	select {
+	case <-w.stopCh:
+	default:
+		close(w.stopCh)
+	}
+	<-w.doneCh
+}
+
+func (w *Watcher) watch(interval time.Duration) {
+	defer close(w.doneCh)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := w.reload(false)
+		if err != nil {
+			w.log.Warnf("Failed to reload configuration from %v: %v", w.path, err)
+		} else if changed {
+			w.log.Infof("Reloaded configuration from %v", w.path)
+		}
+		if (changed || err != nil) && w.opts.OnReload != nil {
+			w.opts.OnReload(w.Config(), err)
+		}
+	}
+}
+
+// reload loads the file and applies the configuration if the file changed, or if force
+// is set. It returns whether the configuration was applied.
+func (w *Watcher) reload(force bool) (bool, error) {
+	w.reloadMut.Lock()
+	defer w.reloadMut.Unlock()
+
+	data, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		return false, err
+	}
+	if !force && bytes.Equal(data, w.data) {
+		return false, nil
+	}
+
+	cfg, err := Parse(data, w.opts)
+	if err != nil {
+		// Don't parse the same contents again until they change.
+		w.data = data
+		return false, err
+	}
+
+	prev := w.Config()
+	err = w.apply(prev, cfg)
+	w.data = data
+	w.cfgMut.Lock()
+	w.cfg = cfg
+	w.cfgMut.Unlock()
+	return true, err
+}
+
+// apply applies the settings that can be changed at runtime. prev is the previously
+// applied configuration, or nil if this is the initial configuration.
+func (w *Watcher) apply(prev, cfg *Config) error {
+	initial := prev == nil
+	if initial {
+		prev = &Config{}
+	} else if changed := restartSettings(prev, cfg); len(changed) > 0 {
+		w.log.Warnf("Configuration changes to %v require the channel to be recreated, and were not applied", changed)
+	}
+
+	if err := w.ch.UpdateRuntimeOptions(func(opts *tchannel.RuntimeOptions) {
+		for serviceName := range prev.Services {
+			if _, ok := cfg.Services[serviceName]; !ok {
+				delete(opts.Timeouts, serviceName)
+				delete(opts.Retries, serviceName)
+			}
+		}
+		for serviceName := range cfg.Services {
+			opts.Timeouts[serviceName] = cfg.TimeoutOptions(serviceName)
+			if retry := cfg.RetryOptions(serviceName); retry != nil {
+				opts.Retries[serviceName] = *retry
+			} else {
+				delete(opts.Retries, serviceName)
+			}
+		}
+	}); err != nil {
+		return err
+	}
+
+	peers := make(map[string]struct{}, len(cfg.Peers))
+	for _, hostPort := range cfg.Peers {
+		peers[hostPort] = struct{}{}
+		w.ch.Peers().GetOrAdd(hostPort)
+	}
+	for _, hostPort := range prev.Peers {
+		if _, ok := peers[hostPort]; !ok {
+			w.ch.Peers().Remove(hostPort)
+		}
+	}
+
+	if !reflect.DeepEqual(prev.IPFilter, cfg.IPFilter) {
+		var filter tchannel.IPFilterOptions
+		if cfg.IPFilter != nil {
+			filter = tchannel.IPFilterOptions{Allow: cfg.IPFilter.Allow, Deny: cfg.IPFilter.Deny}
+		}
+		if err := w.ch.SetIPFilter(filter); err != nil {
+			return err
+		}
+	}
+
+	// The channel's certificates were loaded when it was created from the same files,
+	// so they only need to be reloaded after the initial configuration.
+	if !initial && hasCertificate(prev) && hasCertificate(cfg) {
+		if err := w.ch.RotateCertificates(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasCertificate(cfg *Config) bool {
+	return cfg.TLS != nil && cfg.TLS.CertFile != ""
+}
+
+// restartSettings returns the names of the settings that changed between prev and cfg
+// which cannot be changed while the channel is running.
+func restartSettings(prev, cfg *Config) []string {
+	var changed []string
+	if prev.ProcessName != cfg.ProcessName {
+		changed = append(changed, "processName")
+	}
+	if prev.Profile != cfg.Profile {
+		changed = append(changed, "profile")
+	}
+	if !reflect.DeepEqual(prev.TLS, cfg.TLS) {
+		changed = append(changed, "tls")
+	}
+	if !reflect.DeepEqual(prev.RetryBudget, cfg.RetryBudget) {
+		changed = append(changed, "retryBudget")
+	}
+	if !reflect.DeepEqual(prev.ConcurrencyLimit, cfg.ConcurrencyLimit) {
+		changed = append(changed, "concurrencyLimit")
+	}
+	return changed
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+// ttlHandler responds with the time remaining before the call's deadline.
+type ttlHandler struct{}
+
+func (ttlHandler) Handle(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+	deadline, _ := ctx.Deadline()
+	return &raw.Res{Arg3: []byte(deadline.Sub(time.Now()).String())}, nil
+}
+
+func (ttlHandler) OnError(ctx context.Context, err error) {}
+
+type reloadResult struct {
+	cfg *Config
+	err error
+}
+
+func TestWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tchannel-config")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+
+	server, err := testutils.NewServer(nil)
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+	server.Register(raw.Wrap(ttlHandler{}), "ttl")
+	serverInfo := server.PeerInfo()
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	writeConfig := func(timeout string, peers ...string) {
+		peerList := ""
+		for _, p := range peers {
+			peerList += fmt.Sprintf("%q,", p)
+		}
+		doc := fmt.Sprintf("peers: [%v]\nservices: {%v: {timeout: %v, retry: {maxAttempts: 2}}}\n",
+			peerList, serverInfo.ServiceName, timeout)
+		require.NoError(t, ioutil.WriteFile(path, []byte(doc), 0600), "failed to write config")
+	}
+	callTTL := func() time.Duration {
+		_, arg3, _, err := raw.CallSC(context.Background(), client.GetSubChannel(serverInfo.ServiceName), "ttl", nil, nil)
+		require.NoError(t, err, "Call failed")
+		ttl, err := time.ParseDuration(string(arg3))
+		require.NoError(t, err, "failed to parse ttl")
+		return ttl
+	}
+
+	reloaded := make(chan reloadResult, 10)
+	writeConfig("1s", serverInfo.HostPort)
+	w, err := NewWatcher(client, path, &Options{
+		ReloadInterval: 10 * time.Millisecond,
+		OnReload: func(cfg *Config, err error) {
+			reloaded <- reloadResult{cfg, err}
+		},
+	})
+	require.NoError(t, err, "NewWatcher failed")
+	defer w.Close()
+
+	assert.Contains(t, client.Peers().Copy(), serverInfo.HostPort, "configured peer should be added")
+	assert.True(t, callTTL() <= time.Second, "call should use the configured timeout")
+	runtimeOpts := client.RuntimeOptions()
+	assert.Equal(t, time.Second, runtimeOpts.Timeouts[serverInfo.ServiceName].Default,
+		"timeouts should be applied to the runtime options")
+	assert.Equal(t, 2, runtimeOpts.Retries[serverInfo.ServiceName].MaxAttempts,
+		"retry policy should be applied to the runtime options")
+
+	waitReload := func() reloadResult {
+		select {
+		case r := <-reloaded:
+			return r
+		case <-time.After(time.Second):
+			t.Fatalf("configuration was not reloaded")
+			return reloadResult{}
+		}
+	}
+
+	writeConfig("3s", serverInfo.HostPort)
+	r := waitReload()
+	require.NoError(t, r.err, "reload failed")
+	assert.Equal(t, 3*time.Second, r.cfg.Services[serverInfo.ServiceName].Timeout)
+	assert.Equal(t, r.cfg, w.Config())
+	assert.True(t, callTTL() > 2*time.Second, "call should use the reloaded timeout")
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("peers: ["), 0600), "failed to write config")
+	r = waitReload()
+	assert.Error(t, r.err, "reload of an invalid config should fail")
+	assert.Error(t, w.Reload(), "Reload of an invalid config should fail")
+	assert.Equal(t, 3*time.Second, w.Config().Services[serverInfo.ServiceName].Timeout,
+		"previous config should be kept")
+
+	writeConfig("1s")
+	r = waitReload()
+	require.NoError(t, r.err, "reload failed")
+	assert.NotContains(t, client.Peers().Copy(), serverInfo.HostPort, "removed peer should be removed")
+
+	select {
+	case r := <-reloaded:
+		t.Errorf("unexpected reload without changes: %+v", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestWatcherRotatesCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tchannel-config")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeSelfSignedCert(t, certFile, keyFile)
+	doc := fmt.Sprintf("tls: {certFile: %q, keyFile: %q}\n", certFile, keyFile)
+	require.NoError(t, ioutil.WriteFile(path, []byte(doc), 0600), "failed to write config")
+
+	cfg, err := LoadFile(path, nil)
+	require.NoError(t, err, "LoadFile failed")
+	opts, err := cfg.ChannelOptions(nil)
+	require.NoError(t, err, "ChannelOptions failed")
+	ch, err := tchannel.NewChannel("svc", opts)
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+
+	w, err := NewWatcher(ch, path, nil)
+	require.NoError(t, err, "NewWatcher failed")
+	defer w.Close()
+
+	first := opts.TLS.Certificates.Certificate()
+	writeSelfSignedCert(t, certFile, keyFile)
+	require.NoError(t, w.Reload(), "Reload failed")
+	assert.NotEqual(t, first.Certificate, opts.TLS.Certificates.Certificate().Certificate,
+		"certificate should be reloaded")
+
+	require.NoError(t, os.Remove(keyFile))
+	assert.Error(t, w.Reload(), "Reload should fail if the certificate cannot be loaded")
+	_, err = NewWatcher(ch, filepath.Join(dir, "missing.yaml"), nil)
+	assert.Error(t, err, "NewWatcher should fail if the file does not exist")
+}
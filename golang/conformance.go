@@ -0,0 +1,443 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/uber/tchannel/golang/typed"
+)
+
+const (
+	// maxConformantHeaders is the maximum number of transport headers in a call.
+	maxConformantHeaders = 128
+
+	// maxConformantHeaderKeyLen is the maximum length of a transport header key.
+	maxConformantHeaderKeyLen = 16
+
+	// maxConformantArg1Len is the maximum size of arg1.
+	maxConformantArg1Len = 16 * 1024
+
+	// fatalErrorID is the message ID for fatal protocol errors.
+	fatalErrorID = 0xFFFFFFFF
+
+	// Message types in the spec that this implementation does not send.
+	messageTypeCancel messageType = 0xc0
+	messageTypeClaim  messageType = 0xc1
+
+	// errCodeUnhealthy is an error code in the spec that this implementation does not send.
+	errCodeUnhealthy SystemErrCode = 0x08
+)
+
+// requestOnlyHeaders are the transport headers that are only valid in call requests.
+var requestOnlyHeaders = map[TransportHeaderName]struct{}{
+	ClaimAtStart:         {},
+	ClaimAtFinish:        {},
+	CallerName:           {},
+	RetryFlags:           {},
+	SpeculativeExecution: {},
+	ShardKey:             {},
+	RoutingDelegate:      {},
+}
+
+// ConformanceViolation describes a frame that does not conform to the TChannel protocol
+// specification in docs/protocol.md.
+type ConformanceViolation struct {
+	// Frame is the index of the frame in the stream, starting at 0.
+	Frame int `json:"frame"`
+
+	// MessageID is the message ID in the frame header.
+	MessageID uint32 `json:"messageID"`
+
+	// MessageType is the message type in the frame header.
+	MessageType byte `json:"messageType"`
+
+	// Rule identifies the rule in the spec that was violated, such as "init.required-param",
+	// "header.key-length", "fragment.checksum-type" or "error.code".
+	Rule string `json:"rule"`
+
+	// Message describes the violation.
+	Message string `json:"message"`
+}
+
+func (v ConformanceViolation) String() string {
+	return fmt.Sprintf("frame %v (type 0x%02x, id %v): %v: %v", v.Frame, v.MessageType, v.MessageID, v.Rule, v.Message)
+}
+
+// ConformanceReport is the result of checking the frames sent by one side of a connection.
+type ConformanceReport struct {
+	// Frames is the number of frames that were checked.
+	Frames int `json:"frames"`
+
+	// Violations is the list of violations, in the order of the frames.
+	Violations []ConformanceViolation `json:"violations"`
+}
+
+// Conformant returns whether no violations were found.
+func (r *ConformanceReport) Conformant() bool {
+	return len(r.Violations) == 0
+}
+
+func (r *ConformanceReport) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "checked %v frames, found %v violations\n", r.Frames, len(r.Violations))
+	for _, v := range r.Violations {
+		fmt.Fprintf(&buf, "  %v\n", v)
+	}
+	return buf.String()
+}
+
+// CheckConformance reads the frames sent by one side of a connection from r until EOF, and
+// checks them against the TChannel protocol specification: the init handshake and its
+// required params, transport header limits, fragmentation and checksum rules, and error codes.
+// Frames that cannot be read are reported as violations, and an error is only returned if
+// reading from r fails.
+func CheckConformance(r io.Reader) (*ConformanceReport, error) {
+	checker := newConformanceChecker()
+	report := &ConformanceReport{}
+	frame := NewFrame(MaxFramePayloadSize)
+	for {
+		err := frame.ReadIn(r)
+		switch err {
+		case nil:
+			report.Violations = append(report.Violations, checker.check(frame)...)
+			continue
+		case io.EOF:
+			report.Violations = append(report.Violations, checker.finish()...)
+		case io.ErrUnexpectedEOF:
+			report.Violations = append(report.Violations, checker.violation(frame, "frame.truncated",
+				"stream ended in the middle of a frame"))
+		case errFrameTooSmall:
+			report.Violations = append(report.Violations, checker.violation(frame, "frame.size",
+				"frame size %v is smaller than the frame header", frame.Header.FrameSize()))
+		default:
+			return nil, err
+		}
+		report.Frames = checker.frames
+		return report, nil
+	}
+}
+
+// conformanceMessage is the state of a call request or response that has more fragments.
+type conformanceMessage struct {
+	checksum Checksum
+	arg      int
+	arg1Len  int
+}
+
+// conformanceChecker checks the frames sent by one side of a connection, in order.
+type conformanceChecker struct {
+	frames     int
+	violations []ConformanceViolation
+	requests   map[uint32]*conformanceMessage
+	responses  map[uint32]*conformanceMessage
+}
+
+func newConformanceChecker() *conformanceChecker {
+	return &conformanceChecker{
+		requests:  make(map[uint32]*conformanceMessage),
+		responses: make(map[uint32]*conformanceMessage),
+	}
+}
+
+// violation returns a violation for the given frame.
+func (c *conformanceChecker) violation(frame *Frame, rule string, format string, args ...interface{}) ConformanceViolation {
+	return ConformanceViolation{
+		Frame:       c.frames,
+		MessageID:   frame.Header.ID,
+		MessageType: byte(frame.Header.messageType),
+		Rule:        rule,
+		Message:     fmt.Sprintf(format, args...),
+	}
+}
+
+// check checks the next frame in the stream, and returns any violations.
+func (c *conformanceChecker) check(frame *Frame) []ConformanceViolation {
+	c.violations = nil
+	report := func(rule string, format string, args ...interface{}) {
+		c.violations = append(c.violations, c.violation(frame, rule, format, args...))
+	}
+
+	if frame.Header.reserved1 != 0 || frame.Header.reserved != [8]byte{} {
+		report("frame.reserved", "reserved fields must be zero")
+	}
+
+	msgType := frame.Header.messageType
+	isInit := msgType == messageTypeInitReq || msgType == messageTypeInitRes
+	if c.frames == 0 && !isInit {
+		report("init.first", "the first frame must be an init req or init res, got %v", msgType)
+	} else if c.frames > 0 && isInit {
+		report("init.repeated", "init messages can only be sent as the first frame")
+	}
+
+	rbuf := typed.NewReadBuffer(frame.SizedPayload())
+	switch msgType {
+	case messageTypeInitReq, messageTypeInitRes:
+		c.checkInit(rbuf, report)
+	case messageTypeCallReq, messageTypeCallRes, messageTypeCallReqContinue, messageTypeCallResContinue:
+		c.checkCall(frame.Header.ID, msgType, rbuf, report)
+	case messageTypeError:
+		c.checkError(frame.Header.ID, rbuf, report)
+	case messageTypePingReq, messageTypePingRes, messageTypeCancel, messageTypeClaim, messageTypeCallProgress,
+		messageTypeDrainNotice, messageTypeWindowUpdate:
+	default:
+		report("frame.type", "unknown message type 0x%02x", byte(msgType))
+	}
+
+	c.frames++
+	return c.violations
+}
+
+// finish returns violations for messages that were not completed when the stream ended.
+func (c *conformanceChecker) finish() []ConformanceViolation {
+	var violations []ConformanceViolation
+	for _, m := range []map[uint32]*conformanceMessage{c.requests, c.responses} {
+		for id := range m {
+			violations = append(violations, ConformanceViolation{
+				Frame:     c.frames,
+				MessageID: id,
+				Rule:      "fragment.incomplete",
+				Message:   "stream ended before the last fragment of the message",
+			})
+		}
+	}
+	return violations
+}
+
+func (c *conformanceChecker) checkInit(rbuf *typed.ReadBuffer, report func(string, string, ...interface{})) {
+	version := rbuf.ReadUint16()
+	params := make(map[string]string)
+	numParams := rbuf.ReadUint16()
+	for i := 0; i < int(numParams); i++ {
+		k := rbuf.ReadLen16String()
+		v := rbuf.ReadLen16String()
+		if _, ok := params[k]; ok {
+			report("init.duplicate-param", "init param %q is repeated", k)
+		}
+		params[k] = v
+	}
+	if err := rbuf.Err(); err != nil {
+		report("frame.malformed", "failed to read init message: %v", err)
+		return
+	}
+
+	if version != CurrentProtocolVersion {
+		report("init.version", "version %v is not supported, expected %v", version, CurrentProtocolVersion)
+	}
+	for _, required := range []string{InitParamHostPort, InitParamProcessName} {
+		if _, ok := params[required]; !ok {
+			report("init.required-param", "required init param %q is missing", required)
+		}
+	}
+	if hostPort, ok := params[InitParamHostPort]; ok {
+		if _, _, err := net.SplitHostPort(hostPort); err != nil {
+			report("init.host-port", "%q is not a valid host:port: %v", hostPort, err)
+		}
+	}
+}
+
+func (c *conformanceChecker) checkCall(id uint32, msgType messageType, rbuf *typed.ReadBuffer,
+	report func(string, string, ...interface{})) {
+
+	inProgress := c.requests
+	if msgType == messageTypeCallRes || msgType == messageTypeCallResContinue {
+		inProgress = c.responses
+	}
+
+	flags := rbuf.ReadSingleByte()
+	if flags&^hasMoreFragmentsFlag != 0 {
+		report("call.flags", "unknown flags 0x%02x", flags)
+	}
+
+	msg := inProgress[id]
+	initial := msgType == messageTypeCallReq || msgType == messageTypeCallRes
+	if initial {
+		if msg != nil {
+			report("fragment.duplicate-id", "new message started before the previous message with the same ID completed")
+		}
+		msg = &conformanceMessage{}
+		if msgType == messageTypeCallReq {
+			if ttl := rbuf.ReadUint32(); ttl == 0 && rbuf.Err() == nil {
+				report("call.ttl", "call requests must not have a ttl of 0")
+			}
+			rbuf.ReadBytes(25) // tracing:25
+			if service := rbuf.ReadLen8String(); service == "" && rbuf.Err() == nil {
+				report("call.service", "call requests must specify a service")
+			}
+		} else {
+			rbuf.ReadSingleByte() // code:1
+			rbuf.ReadBytes(25)    // tracing:25
+		}
+		c.checkHeaders(msgType, rbuf, report)
+	} else if msg == nil {
+		report("fragment.orphan", "continue frame without a preceding frame that has more fragments")
+		return
+	}
+	delete(inProgress, id)
+
+	checksumType := ChecksumType(rbuf.ReadSingleByte())
+	checksum := rbuf.ReadBytes(checksumType.ChecksumSize())
+	if err := rbuf.Err(); err != nil {
+		report("frame.malformed", "failed to read call message: %v", err)
+		return
+	}
+
+	if msg.checksum == nil {
+		if msg.checksum = checksumType.New(); msg.checksum == nil {
+			report("checksum.type", "unsupported checksum type %v", checksumType)
+			return
+		}
+	} else if msg.checksum.TypeCode() != checksumType {
+		report("fragment.checksum-type", "checksum type %v does not match the previous fragments' type %v",
+			checksumType, msg.checksum.TypeCode())
+		return
+	}
+
+	arg1Len := msg.arg1Len
+	numChunks := 0
+	for rbuf.BytesRemaining() > 0 {
+		chunkSize := int(rbuf.ReadUint16())
+		if chunkSize > rbuf.BytesRemaining() {
+			report("fragment.chunk-size", "arg size %v exceeds the remaining frame size %v", chunkSize, rbuf.BytesRemaining())
+			return
+		}
+		chunk := rbuf.ReadBytes(chunkSize)
+		msg.checksum.Add(chunk)
+
+		// The first chunk in a continue frame continues the last arg of the previous frame.
+		if numChunks > 0 {
+			msg.arg++
+		}
+		numChunks++
+		if msg.arg == 0 {
+			msg.arg1Len += chunkSize
+		}
+	}
+	if err := rbuf.Err(); err != nil {
+		report("frame.malformed", "failed to read args: %v", err)
+		return
+	}
+
+	if numChunks == 0 {
+		report("fragment.no-args", "call frames must contain at least one arg")
+	}
+	if msg.arg > 2 {
+		report("fragment.too-many-args", "call messages must have exactly 3 args, got %v", msg.arg+1)
+	}
+	if arg1Len <= maxConformantArg1Len && msg.arg1Len > maxConformantArg1Len {
+		report("call.arg1-size", "arg1 is larger than %v bytes", maxConformantArg1Len)
+	}
+	if !bytes.Equal(checksum, msg.checksum.Sum()) {
+		report("checksum.mismatch", "checksum %x does not match the calculated checksum %x", checksum, msg.checksum.Sum())
+	}
+
+	if flags&hasMoreFragmentsFlag != 0 {
+		inProgress[id] = msg
+	} else if msg.arg < 2 {
+		report("fragment.missing-args", "call messages must have exactly 3 args, got %v", msg.arg+1)
+	}
+}
+
+func (c *conformanceChecker) checkHeaders(msgType messageType, rbuf *typed.ReadBuffer,
+	report func(string, string, ...interface{})) {
+
+	numHeaders := int(rbuf.ReadSingleByte())
+	if numHeaders > maxConformantHeaders {
+		report("header.count", "%v transport headers is more than the maximum of %v", numHeaders, maxConformantHeaders)
+	}
+
+	seen := make(map[string]struct{}, numHeaders)
+	for i := 0; i < numHeaders && rbuf.Err() == nil; i++ {
+		k := rbuf.ReadLen8String()
+		rbuf.ReadLen8String()
+		if rbuf.Err() != nil {
+			break
+		}
+
+		if k == "" {
+			report("header.empty-key", "transport header keys must not be empty")
+		}
+		if len(k) > maxConformantHeaderKeyLen {
+			report("header.key-length", "transport header key %q is longer than %v bytes", k, maxConformantHeaderKeyLen)
+		}
+		if _, ok := seen[k]; ok {
+			report("header.duplicate", "transport header %q is repeated", k)
+		}
+		seen[k] = struct{}{}
+		if _, ok := requestOnlyHeaders[TransportHeaderName(k)]; ok && msgType == messageTypeCallRes {
+			report("header.request-only", "transport header %q is only valid in call requests", k)
+		}
+	}
+}
+
+func (c *conformanceChecker) checkError(id uint32, rbuf *typed.ReadBuffer, report func(string, string, ...interface{})) {
+	// An error ends any response that is in progress for the message.
+	delete(c.responses, id)
+
+	code := SystemErrCode(rbuf.ReadSingleByte())
+	rbuf.ReadBytes(25) // tracing:25
+	rbuf.ReadLen16String()
+	if err := rbuf.Err(); err != nil {
+		report("frame.malformed", "failed to read error message: %v", err)
+		return
+	}
+
+	switch code {
+	case ErrCodeTimeout, ErrCodeCancelled, ErrCodeBusy, ErrCodeDeclined, ErrCodeUnexpected,
+		ErrCodeBadRequest, ErrCodeNetwork, errCodeUnhealthy:
+	case ErrCodeProtocol:
+		if id != fatalErrorID {
+			report("error.protocol-id", "fatal protocol errors should use the message ID 0x%x", uint32(fatalErrorID))
+		}
+	default:
+		report("error.code", "invalid error code 0x%02x", byte(code))
+	}
+}
+
+// checkConformance checks an inbound frame against the protocol spec if the channel has
+// StrictConformance enabled. Violations are logged and counted, and call requests that
+// violate the spec are rejected with a bad request error. It returns whether the frame
+// should be processed.
+func (c *Connection) checkConformance(frame *Frame) bool {
+	if c.conformance == nil {
+		return true
+	}
+
+	violations := c.conformance.check(frame)
+	for _, v := range violations {
+		c.log.Warnf("Received non-conformant frame from %v: %v", c.remotePeerInfo, v)
+		tags := map[string]string{"rule": v.Rule}
+		for k, v := range c.commonStatsTags {
+			tags[k] = v
+		}
+		c.statsReporter.IncCounter("connection.conformance-violations", tags, 1)
+	}
+
+	if len(violations) > 0 && frame.Header.messageType == messageTypeCallReq {
+		v := violations[0]
+		c.SendSystemError(frame.Header.ID, nil, NewSystemError(ErrCodeBadRequest,
+			"call does not conform to the protocol: %v: %v", v.Rule, v.Message))
+		return false
+	}
+	return true
+}
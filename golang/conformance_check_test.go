@@ -0,0 +1,369 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/typed"
+)
+
+// checkFrame returns the bytes for a frame with the given type, ID and payload.
+func checkFrame(msgType messageType, id uint32, payload ...[]byte) []byte {
+	p := concat(payload...)
+	f := NewFrame(len(p))
+	f.Header.messageType = msgType
+	f.Header.ID = id
+	f.Header.SetPayloadSize(uint16(len(p)))
+	copy(f.Payload, p)
+
+	var buf bytes.Buffer
+	f.WriteOut(&buf)
+	return buf.Bytes()
+}
+
+func checkInitFrame(t *testing.T, version uint16, params initParams) []byte {
+	return checkFrame(messageTypeInitReq, 1, encodeMessage(t, &initReq{initMessage{Version: version, initParams: params}}))
+}
+
+// checkHeaders returns the bytes for the transport headers in keys and values.
+func checkHeaders(kvs ...string) []byte {
+	b := []byte{byte(len(kvs) / 2)}
+	for _, s := range kvs {
+		b = append(b, byte(len(s)))
+		b = append(b, s...)
+	}
+	return b
+}
+
+// checkArgs returns the bytes for args with no checksum.
+func checkArgs(args ...string) []byte {
+	b := []byte{byte(ChecksumTypeNone)}
+	for _, arg := range args {
+		b = append(b, byte(len(arg)>>8), byte(len(arg)))
+		b = append(b, arg...)
+	}
+	return b
+}
+
+func checkCallReq(id uint32, flags byte, ttl uint32, headers []byte, args []byte) []byte {
+	ttlBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(ttlBytes, ttl)
+	return checkFrame(messageTypeCallReq, id, []byte{flags}, ttlBytes, testTracingBytes,
+		[]byte{3}, []byte("svc"), headers, args)
+}
+
+func checkCallRes(id uint32, flags byte, headers []byte, args []byte) []byte {
+	return checkFrame(messageTypeCallRes, id, []byte{flags, byte(responseOK)}, testTracingBytes, headers, args)
+}
+
+func checkError(id uint32, code SystemErrCode) []byte {
+	return checkFrame(messageTypeError, id, []byte{byte(code)}, testTracingBytes, []byte{0x00, 0x02}, []byte("hi"))
+}
+
+func violatedRules(t *testing.T, stream []byte) []string {
+	report, err := CheckConformance(bytes.NewReader(stream))
+	require.NoError(t, err, "CheckConformance failed")
+
+	var rules []string
+	for _, v := range report.Violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func TestCheckConformance(t *testing.T) {
+	validParams := initParams{InitParamHostPort: "1.2.3.4:5", InitParamProcessName: "node"}
+	init := checkInitFrame(t, CurrentProtocolVersion, validParams)
+	call := checkCallReq(2, 0, 1000, checkHeaders("cn", "caller", "as", "raw"), checkArgs("op", "a2", "a3"))
+
+	tests := []struct {
+		msg    string
+		stream []byte
+		rules  []string
+	}{
+		{
+			msg:    "valid stream",
+			stream: concat(init, call, checkCallRes(3, 0, checkHeaders("as", "raw"), checkArgs("", "a2", "a3"))),
+		},
+		{
+			msg:    "fragmented call",
+			stream: concat(init, checkCallReq(2, 1, 1000, checkHeaders(), checkArgs("op", "a")), checkFrame(messageTypeCallReqContinue, 2, []byte{0}, checkArgs("2", "a3"))),
+		},
+		{
+			msg:    "missing init",
+			stream: call,
+			rules:  []string{"init.first"},
+		},
+		{
+			msg:    "repeated init",
+			stream: concat(init, init),
+			rules:  []string{"init.repeated"},
+		},
+		{
+			msg:    "init version and params",
+			stream: checkInitFrame(t, 1, initParams{InitParamHostPort: "localhost"}),
+			rules:  []string{"init.version", "init.required-param", "init.host-port"},
+		},
+		{
+			msg: "non-zero reserved fields",
+			stream: func() []byte {
+				b := append([]byte(nil), init...)
+				b[3] = 1
+				return b
+			}(),
+			rules: []string{"frame.reserved"},
+		},
+		{
+			msg:    "unknown message type",
+			stream: concat(init, checkFrame(0x50, 2)),
+			rules:  []string{"frame.type"},
+		},
+		{
+			msg:    "call req fields",
+			stream: concat(init, checkCallReq(2, 0x02, 0, checkHeaders(), checkArgs("op", "", ""))),
+			rules:  []string{"call.flags", "call.ttl"},
+		},
+		{
+			msg: "transport headers",
+			stream: concat(init, checkCallReq(2, 0, 1000,
+				checkHeaders("", "v", strings.Repeat("k", 17), "v", "as", "raw", "as", "raw"), checkArgs("op", "", ""))),
+			rules: []string{"header.empty-key", "header.key-length", "header.duplicate"},
+		},
+		{
+			msg:    "request header in call res",
+			stream: concat(init, checkCallRes(2, 0, checkHeaders("cn", "caller"), checkArgs("", "", ""))),
+			rules:  []string{"header.request-only"},
+		},
+		{
+			msg:    "arg1 too large",
+			stream: concat(init, checkCallReq(2, 0, 1000, checkHeaders(), checkArgs(strings.Repeat("a", maxConformantArg1Len+1), "", ""))),
+			rules:  []string{"call.arg1-size"},
+		},
+		{
+			msg:    "missing args",
+			stream: concat(init, checkCallReq(2, 0, 1000, checkHeaders(), checkArgs("op"))),
+			rules:  []string{"fragment.missing-args"},
+		},
+		{
+			msg:    "too many args",
+			stream: concat(init, checkCallReq(2, 0, 1000, checkHeaders(), checkArgs("op", "", "", ""))),
+			rules:  []string{"fragment.too-many-args"},
+		},
+		{
+			msg:    "orphan continue",
+			stream: concat(init, checkFrame(messageTypeCallReqContinue, 2, []byte{0}, checkArgs("", ""))),
+			rules:  []string{"fragment.orphan"},
+		},
+		{
+			msg: "mismatched checksum types",
+			stream: concat(init, checkCallReq(2, 1, 1000, checkHeaders(), checkArgs("op")),
+				checkFrame(messageTypeCallReqContinue, 2, []byte{0, byte(ChecksumTypeCrc32), 0, 0, 0, 0})),
+			rules: []string{"fragment.checksum-type"},
+		},
+		{
+			msg:    "checksum mismatch",
+			stream: concat(init, checkCallReq(2, 0, 1000, checkHeaders(), []byte{byte(ChecksumTypeCrc32), 1, 2, 3, 4, 0, 0, 0, 0, 0, 0})),
+			rules:  []string{"checksum.mismatch"},
+		},
+		{
+			msg:    "incomplete fragments",
+			stream: concat(init, checkCallReq(2, 1, 1000, checkHeaders(), checkArgs("op"))),
+			rules:  []string{"fragment.incomplete"},
+		},
+		{
+			msg:    "error codes",
+			stream: concat(init, checkError(2, ErrCodeBusy), checkError(3, ErrCodeInvalid), checkError(4, ErrCodeProtocol)),
+			rules:  []string{"error.code", "error.protocol-id"},
+		},
+		{
+			msg:    "truncated frame",
+			stream: concat(init, call[:len(call)-1]),
+			rules:  []string{"frame.truncated"},
+		},
+		{
+			msg:    "frame too small",
+			stream: concat(init, []byte{0x00, 0x02, 0x03, 0x00, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0}),
+			rules:  []string{"frame.size"},
+		},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.rules, violatedRules(t, tt.stream), "%v: violations mismatch", tt.msg)
+	}
+}
+
+// recordingConn records the bytes written and read on a connection.
+type recordingConn struct {
+	net.Conn
+
+	sync.Mutex
+	written, read bytes.Buffer
+}
+
+func (c *recordingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.Lock()
+	c.read.Write(b[:n])
+	c.Unlock()
+	return n, err
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	c.Lock()
+	c.written.Write(b)
+	c.Unlock()
+	return c.Conn.Write(b)
+}
+
+// recorded returns copies of the bytes written and read on the connection.
+func (c *recordingConn) recorded() (written, read []byte) {
+	c.Lock()
+	defer c.Unlock()
+
+	return append([]byte(nil), c.written.Bytes()...), append([]byte(nil), c.read.Bytes()...)
+}
+
+func TestCheckConformanceGoTraffic(t *testing.T) {
+	server, err := NewChannel("svc", &ChannelOptions{Logger: NullLogger})
+	require.NoError(t, err, "NewChannel failed")
+	defer server.Close()
+	server.Register(conformanceEcho{}, "echo")
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Listen failed")
+	require.NoError(t, server.Serve(l), "Serve failed")
+
+	var conn *recordingConn
+	client, err := NewChannel("client", &ChannelOptions{
+		Logger: NullLogger,
+		Dialer: func(hostPort string) (net.Conn, error) {
+			c, err := net.Dial("tcp", hostPort)
+			conn = &recordingConn{Conn: c}
+			return conn, err
+		},
+	})
+	require.NoError(t, err, "NewChannel failed")
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+
+	// A large arg3 is fragmented across multiple frames in both directions.
+	largeArg := bytes.Repeat([]byte("a"), 3*MaxFramePayloadSize)
+	for _, op := range []string{"echo", "unknown"} {
+		call, err := client.BeginCall(ctx, l.Addr().String(), "svc", op, nil)
+		require.NoError(t, err, "BeginCall failed")
+		require.NoError(t, NewArgWriter(call.Arg2Writer()).Write([]byte("arg2")), "Arg2 write failed")
+		require.NoError(t, NewArgWriter(call.Arg3Writer()).Write(largeArg), "Arg3 write failed")
+
+		var arg2, arg3 []byte
+		err = NewArgReader(call.Response().Arg2Reader()).Read(&arg2)
+		if op == "echo" {
+			require.NoError(t, err, "Arg2 read failed")
+			require.NoError(t, NewArgReader(call.Response().Arg3Reader()).Read(&arg3), "Arg3 read failed")
+			assert.Equal(t, largeArg, arg3, "arg3 mismatch")
+		} else {
+			assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(err), "unknown operation should fail")
+		}
+	}
+	client.Close()
+
+	written, read := conn.recorded()
+	for _, recorded := range [][]byte{written, read} {
+		report, err := CheckConformance(bytes.NewReader(recorded))
+		require.NoError(t, err, "CheckConformance failed")
+		assert.True(t, report.Conformant(), "Go traffic should conform to the spec:\n%v", report)
+		assert.True(t, report.Frames >= 6, "expected fragmented calls, got %v frames", report.Frames)
+	}
+}
+
+// violationCounter is a StatsReporter that counts conformance violations by rule.
+type violationCounter struct {
+	sync.Mutex
+	nullStatsReporter
+
+	counts map[string]int64
+}
+
+func (c *violationCounter) IncCounter(name string, tags map[string]string, value int64) {
+	if name != "connection.conformance-violations" {
+		return
+	}
+
+	c.Lock()
+	c.counts[tags["rule"]] += value
+	c.Unlock()
+}
+
+func TestStrictConformance(t *testing.T) {
+	stats := &violationCounter{counts: make(map[string]int64)}
+	ch, err := NewChannel("svc", &ChannelOptions{
+		Logger:            NullLogger,
+		StatsReporter:     stats,
+		StrictConformance: true,
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+	ch.Register(conformanceEcho{}, "echo")
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	l := conformanceListener{make(chan net.Conn, 1)}
+	l.conns <- serverConn
+	require.NoError(t, ch.Serve(l), "Serve failed")
+
+	clientConn.SetDeadline(time.Now().Add(time.Second))
+	send := func(frameBytes []byte) {
+		_, err := clientConn.Write(frameBytes)
+		require.NoError(t, err, "failed to send frame")
+	}
+	receive := func() *Frame {
+		f := NewFrame(MaxFramePayloadSize)
+		require.NoError(t, f.ReadIn(clientConn), "failed to receive frame")
+		return f
+	}
+
+	send(checkInitFrame(t, CurrentProtocolVersion, initParams{InitParamHostPort: "1.2.3.4:5", InitParamProcessName: "node"}))
+	assert.Equal(t, messageTypeInitRes, receive().Header.messageType, "expected init res")
+
+	send(checkCallReq(2, 0, 1000, checkHeaders("as", "raw", "as", "raw"), checkArgs("echo", "a2", "a3")))
+	f := receive()
+	assert.Equal(t, messageTypeError, f.Header.messageType, "non-conformant call should be rejected")
+	var errMsg errorMessage
+	require.NoError(t, errMsg.read(typed.NewReadBuffer(f.SizedPayload())), "failed to read error")
+	assert.Equal(t, ErrCodeBadRequest, errMsg.errCode, "error code mismatch")
+	assert.Contains(t, errMsg.message, "header.duplicate", "error should describe the violation")
+
+	send(checkCallReq(3, 0, 1000, checkHeaders("as", "raw"), checkArgs("echo", "a2", "a3")))
+	f = receive()
+	assert.Equal(t, messageTypeCallRes, f.Header.messageType, "conformant call should succeed")
+	assert.Equal(t, uint32(3), f.Header.ID, "call res ID mismatch")
+
+	stats.Lock()
+	assert.Equal(t, map[string]int64{"header.duplicate": 1}, stats.counts, "violation counters mismatch")
+	stats.Unlock()
+}
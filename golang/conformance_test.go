@@ -0,0 +1,460 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+// This file checks the encoding of frames against fixtures from other TChannel
+// implementations. The codec fixtures are ported from the tchannel-node v2 codec
+// tests (node/test/v2), and the wire fixtures are the frames that a tchannel-node
+// client sends for an init handshake and a fragmented call, as described in
+// docs/protocol.md. Live interop tests against reference servers are in interop_test.go.
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/typed"
+	"golang.org/x/net/context"
+)
+
+// testTracing is the tracing payload used by the tchannel-node fixtures.
+var testTracing = Span{
+	spanID:   0x0001020304050607,
+	parentID: 0x08090a0b0c0d0e0f,
+	traceID:  0x1011121314151617,
+	flags:    24,
+}
+
+var testTracingBytes = []byte{
+	0x00, 0x01, 0x02, 0x03, // spanid:8
+	0x04, 0x05, 0x06, 0x07, // ...
+	0x08, 0x09, 0x0a, 0x0b, // parentid:8
+	0x0c, 0x0d, 0x0e, 0x0f, // ...
+	0x10, 0x11, 0x12, 0x13, // traceid:8
+	0x14, 0x15, 0x16, 0x17, // ...
+	0x18, // traceflags:1
+}
+
+func concat(parts ...[]byte) []byte {
+	var b []byte
+	for _, part := range parts {
+		b = append(b, part...)
+	}
+	return b
+}
+
+// encodeMessage returns the payload bytes for the message.
+func encodeMessage(t *testing.T, msg message) []byte {
+	f := NewFrame(MaxFramePayloadSize)
+	require.NoError(t, f.write(msg), "failed to write %v", msg.messageType())
+	return append([]byte(nil), f.SizedPayload()...)
+}
+
+// decodeMessage reads the message from the payload bytes.
+func decodeMessage(t *testing.T, payload []byte, msg message) {
+	f := NewFrame(MaxFramePayloadSize)
+	copy(f.Payload, payload)
+	f.Header.SetPayloadSize(uint16(len(payload)))
+	require.NoError(t, f.read(msg), "failed to read %v", msg.messageType())
+}
+
+func TestConformanceFrameHeader(t *testing.T) {
+	frameBytes := []byte{
+		0x00, 0x15, // size:2
+		0x00,                   // type:1
+		0x00,                   // reserved:1
+		0x01, 0x02, 0x03, 0x04, // id:4
+		0x00, 0x00, 0x00, 0x00, // reserved:4
+		0x00, 0x00, 0x00, 0x00, // reserved:4
+		0x04, 0x64, 0x6f, 0x67, 0x65, // payload
+	}
+
+	f := NewFrame(MaxFramePayloadSize)
+	f.Header.ID = 0x01020304
+	copy(f.Payload, frameBytes[FrameHeaderSize:])
+	f.Header.SetPayloadSize(5)
+
+	var w typed.WriteBuffer
+	buf := make([]byte, len(frameBytes))
+	w.Wrap(buf)
+	require.NoError(t, f.WriteOut(bytesWriter{&w}), "WriteOut failed")
+	assert.Equal(t, frameBytes, buf, "frame bytes mismatch")
+
+	read := NewFrame(MaxFramePayloadSize)
+	require.NoError(t, read.ReadIn(bytesReader(frameBytes)), "ReadIn failed")
+	assert.Equal(t, f.Header, read.Header, "frame header mismatch")
+	assert.Equal(t, frameBytes[FrameHeaderSize:], read.SizedPayload(), "payload mismatch")
+}
+
+func TestConformanceTracing(t *testing.T) {
+	var w typed.WriteBuffer
+	buf := make([]byte, len(testTracingBytes))
+	w.Wrap(buf)
+	require.NoError(t, testTracing.write(&w), "write failed")
+	assert.Equal(t, testTracingBytes, buf, "tracing bytes mismatch")
+
+	var span Span
+	require.NoError(t, span.read(typed.NewReadBuffer(testTracingBytes)), "read failed")
+	assert.Equal(t, testTracing, span, "tracing mismatch")
+}
+
+func TestConformanceTransportHeaders(t *testing.T) {
+	tests := []struct {
+		headers transportHeaders
+		bytes   []byte
+	}{
+		{transportHeaders{}, []byte{0x00}},
+		{transportHeaders{"key": "val"}, []byte{
+			0x01,                   // nh:1
+			0x03, 0x6b, 0x65, 0x79, // hk~1 "key"
+			0x03, 0x76, 0x61, 0x6c, // hv~1 "val"
+		}},
+		{transportHeaders{"ev": ""}, []byte{
+			0x01,             // nh:1
+			0x02, 0x65, 0x76, // hk~1 "ev"
+			0x00, // hv~1 ""
+		}},
+	}
+
+	for _, tt := range tests {
+		var w typed.WriteBuffer
+		buf := make([]byte, len(tt.bytes))
+		w.Wrap(buf)
+		tt.headers.write(&w)
+		require.NoError(t, w.Err(), "write failed")
+		assert.Equal(t, tt.bytes, buf, "headers %v bytes mismatch", tt.headers)
+
+		headers := transportHeaders{}
+		r := typed.NewReadBuffer(tt.bytes)
+		headers.read(r)
+		require.NoError(t, r.Err(), "read failed")
+		assert.Equal(t, tt.headers, headers, "headers mismatch")
+	}
+
+	// The order of multiple headers is not specified, so only check that they are read.
+	headers := transportHeaders{}
+	headers.read(typed.NewReadBuffer([]byte{
+		0x03,                   // nh:1
+		0x03, 0x72, 0x65, 0x64, // hk~1 "red"
+		0x05, 0x67, 0x72, 0x65, // hv~1 "green"
+		0x65, 0x6e, // ...
+		0x04, 0x62, 0x6c, 0x75, // hk~1 "blue"
+		0x65,                   // ...
+		0x06, 0x79, 0x65, 0x6c, // hv~1 "yellow"
+		0x6c, 0x6f, 0x77, // ...
+		0x07, 0x6d, 0x61, 0x67, // hk~1 "magenta"
+		0x65, 0x6e, 0x74, 0x61, // ...
+		0x04, 0x63, 0x79, 0x61, // hv~1 "cyan"
+		0x6e, // ...
+	}))
+	assert.Equal(t, transportHeaders{"red": "green", "blue": "yellow", "magenta": "cyan"}, headers, "headers mismatch")
+}
+
+var testInitReqBytes = []byte{
+	0x00, 0x02, // version:2
+	0x00, 0x03, // nh:2
+	0x00, 0x09, 0x68, 0x6f, // key~2 -- host_port
+	0x73, 0x74, 0x5f, 0x70, // ...
+	0x6f, 0x72, 0x74, // ...
+	0x00, 0x09, 0x31, 0x2e, // value~2 -- 1.2.3.4:5
+	0x32, 0x2e, 0x33, 0x2e, // ...
+	0x34, 0x3a, 0x35, // ...
+	0x00, 0x0c, 0x70, 0x72, // key~2 -- process_name
+	0x6f, 0x63, 0x65, 0x73, // ...
+	0x73, 0x5f, 0x6e, 0x61, // ...
+	0x6d, 0x65, // ...
+	0x00, 0x04, 0x6e, 0x6f, // value~2 -- node
+	0x64, 0x65, // ...
+	0x00, 0x09, 0x61, 0x72, // key~2 -- arbitrary
+	0x62, 0x69, 0x74, 0x72, // ...
+	0x61, 0x72, 0x79, // ...
+	0x00, 0x05, 0x76, 0x61, // value~2 -- value
+	0x6c, 0x75, 0x65, // ...
+}
+
+func TestConformanceInit(t *testing.T) {
+	want := initParams{"host_port": "1.2.3.4:5", "process_name": "node", "arbitrary": "value"}
+
+	var req initReq
+	decodeMessage(t, testInitReqBytes, &req)
+	assert.Equal(t, uint16(2), req.Version, "version mismatch")
+	assert.Equal(t, want, req.initParams, "init params mismatch")
+
+	// The order of the headers is not specified, so check the length and round trip.
+	encoded := encodeMessage(t, &initRes{initMessage{Version: 2, initParams: want}})
+	assert.Equal(t, len(testInitReqBytes), len(encoded), "encoded length mismatch")
+	var res initRes
+	decodeMessage(t, encoded, &res)
+	assert.Equal(t, want, res.initParams, "init params mismatch")
+}
+
+func TestConformanceCall(t *testing.T) {
+	// The flags, checksum and args of call frames are written by the fragmenting
+	// writer, so the messages are checked up to the transport headers.
+	callReqBytes := concat(
+		[]byte{0x00, 0x00, 0x04, 0x00}, // ttl:4
+		testTracingBytes,               // tracing:25
+		[]byte{
+			0x06,                   // service~1
+			0x61, 0x70, 0x61, 0x63, // ...
+			0x68, 0x65, // ...
+			0x01,                   // nh:1
+			0x03, 0x6b, 0x65, 0x79, // (hk~1 hv~1){nh}
+			0x03, 0x76, 0x61, 0x6c, // ...
+		},
+	)
+	req := &callReq{
+		TimeToLive: 1024 * time.Millisecond,
+		Tracing:    testTracing,
+		Service:    "apache",
+		Headers:    transportHeaders{"key": "val"},
+	}
+	assert.Equal(t, callReqBytes, encodeMessage(t, req), "call req bytes mismatch")
+	var decodedReq callReq
+	decodeMessage(t, callReqBytes, &decodedReq)
+	assert.Equal(t, req, &decodedReq, "call req mismatch")
+
+	callResBytes := concat(
+		[]byte{0x00},     // code:1
+		testTracingBytes, // tracing:25
+		[]byte{
+			0x01,                   // nh:1
+			0x03, 0x6b, 0x65, 0x79, // (hk~1 hv~1){nh}
+			0x03, 0x76, 0x61, 0x6c, // ...
+		},
+	)
+	res := &callRes{
+		ResponseCode: responseOK,
+		Tracing:      testTracing,
+		Headers:      transportHeaders{"key": "val"},
+	}
+	assert.Equal(t, callResBytes, encodeMessage(t, res), "call res bytes mismatch")
+	var decodedRes callRes
+	decodeMessage(t, callResBytes, &decodedRes)
+	assert.Equal(t, res, &decodedRes, "call res mismatch")
+}
+
+func TestConformanceError(t *testing.T) {
+	errorBytes := concat(
+		[]byte{0xff},     // code:1
+		testTracingBytes, // tracing:25
+		[]byte{
+			0x00, 0x08, 0x74, 0x6f, // message~2
+			0x6f, 0x20, 0x62, 0x61, // ...
+			0x64, 0x2e, // ...
+		},
+	)
+	msg := &errorMessage{errCode: ErrCodeProtocol, tracing: testTracing, message: "too bad."}
+	assert.Equal(t, errorBytes, encodeMessage(t, msg), "error bytes mismatch")
+
+	var decoded errorMessage
+	decodeMessage(t, errorBytes, &decoded)
+	assert.Equal(t, msg, &decoded, "error mismatch")
+}
+
+func TestConformanceChecksum(t *testing.T) {
+	csum := ChecksumTypeCrc32.New()
+	for _, arg := range []string{"arg1", "arg2", "arg3"} {
+		csum.Add([]byte(arg))
+	}
+	assert.Equal(t, []byte{0x8c, 0x38, 0xc3, 0xaf}, csum.Sum(), "crc32 checksum mismatch")
+	assert.Equal(t, byte(0x01), byte(ChecksumTypeCrc32), "crc32 checksum type mismatch")
+}
+
+// bytesWriter writes to a typed.WriteBuffer.
+type bytesWriter struct {
+	w *typed.WriteBuffer
+}
+
+func (w bytesWriter) Write(b []byte) (int, error) {
+	w.w.WriteBytes(b)
+	return len(b), w.w.Err()
+}
+
+func bytesReader(b []byte) net.Conn {
+	client, server := net.Pipe()
+	go func() {
+		server.Write(b)
+		server.Close()
+	}()
+	return client
+}
+
+// conformanceListener is a listener with a fixed address that returns the given connections.
+type conformanceListener struct {
+	conns chan net.Conn
+}
+
+func (l conformanceListener) Accept() (net.Conn, error) {
+	c, ok := <-l.conns
+	if !ok {
+		return nil, io.EOF
+	}
+	return c, nil
+}
+
+func (l conformanceListener) Close() error { return nil }
+
+func (l conformanceListener) Addr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4040}
+}
+
+type conformanceEcho struct{}
+
+func (conformanceEcho) Handle(ctx context.Context, call *InboundCall) {
+	var arg2, arg3 []byte
+	if err := NewArgReader(call.Arg2Reader()).Read(&arg2); err != nil {
+		return
+	}
+	if err := NewArgReader(call.Arg3Reader()).Read(&arg3); err != nil {
+		return
+	}
+	NewArgWriter(call.Response().Arg2Writer()).Write(arg2)
+	NewArgWriter(call.Response().Arg3Writer()).Write(arg3)
+}
+
+func TestConformanceWire(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	l := conformanceListener{make(chan net.Conn, 1)}
+	l.conns <- serverConn
+
+	ch, err := NewChannel("svc", &ChannelOptions{ProcessName: "go-server", Logger: NullLogger})
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+	ch.Register(conformanceEcho{}, "echo")
+	require.NoError(t, ch.Serve(l), "Serve failed")
+
+	clientConn.SetDeadline(time.Now().Add(time.Second))
+	send := func(frameBytes []byte) {
+		_, err := clientConn.Write(frameBytes)
+		require.NoError(t, err, "failed to send frame")
+	}
+	receive := func() *Frame {
+		f := NewFrame(MaxFramePayloadSize)
+		require.NoError(t, f.ReadIn(clientConn), "failed to receive frame")
+		return f
+	}
+
+	send(concat([]byte{
+		0x00, 0x50, // size:2
+		0x01,                   // type:1 -- init req
+		0x00,                   // reserved:1
+		0x00, 0x00, 0x00, 0x01, // id:4
+		0x00, 0x00, 0x00, 0x00, // reserved:4
+		0x00, 0x00, 0x00, 0x00, // reserved:4
+	}, testInitReqBytes))
+
+	f := receive()
+	assert.Equal(t, messageTypeInitRes, f.Header.messageType, "expected init res")
+	assert.Equal(t, uint32(1), f.Header.ID, "init res ID mismatch")
+	var res initRes
+	require.NoError(t, f.read(&res), "failed to read init res")
+	assert.Equal(t, uint16(2), res.Version, "init res version mismatch")
+	assert.Equal(t, initParams{"host_port": "127.0.0.1:4040", "process_name": "go-server"}, res.initParams, "init res params mismatch")
+
+	// A call req fragmented across two frames, with arg2 split between them.
+	send(concat([]byte{
+		0x00, 0x45, // size:2
+		0x03,                   // type:1 -- call req
+		0x00,                   // reserved:1
+		0x00, 0x00, 0x00, 0x02, // id:4
+		0x00, 0x00, 0x00, 0x00, // reserved:4
+		0x00, 0x00, 0x00, 0x00, // reserved:4
+		0x01,                   // flags:1 -- more fragments
+		0x00, 0x00, 0x03, 0xe8, // ttl:4
+	}, testTracingBytes, []byte{
+		0x03, 0x73, 0x76, 0x63, // service~1 -- svc
+		0x01,             // nh:1
+		0x02, 0x61, 0x73, // hk~1 -- as
+		0x03, 0x72, 0x61, 0x77, // hv~1 -- raw
+		0x00,                   // csumtype:1
+		0x00, 0x04, 0x65, 0x63, // arg1~2 -- echo
+		0x68, 0x6f, // ...
+		0x00, 0x02, 0x61, 0x72, // arg2~2 -- ar
+	}))
+	send([]byte{
+		0x00, 0x1c, // size:2
+		0x13,                   // type:1 -- call req continue
+		0x00,                   // reserved:1
+		0x00, 0x00, 0x00, 0x02, // id:4
+		0x00, 0x00, 0x00, 0x00, // reserved:4
+		0x00, 0x00, 0x00, 0x00, // reserved:4
+		0x00,                   // flags:1
+		0x00,                   // csumtype:1
+		0x00, 0x02, 0x67, 0x32, // arg2~2 -- g2
+		0x00, 0x04, 0x61, 0x72, // arg3~2 -- arg3
+		0x67, 0x33, // ...
+	})
+
+	f = receive()
+	assert.Equal(t, concat([]byte{
+		0x00, 0x42, // size:2
+		0x04,                   // type:1 -- call res
+		0x00,                   // reserved:1
+		0x00, 0x00, 0x00, 0x02, // id:4
+		0x00, 0x00, 0x00, 0x00, // reserved:4
+		0x00, 0x00, 0x00, 0x00, // reserved:4
+		0x00, // flags:1
+		0x00, // code:1
+	}, testTracingBytes, []byte{
+		0x01,             // nh:1
+		0x02, 0x61, 0x73, // hk~1 -- as
+		0x03, 0x72, 0x61, 0x77, // hv~1 -- raw
+		0x00,       // csumtype:1
+		0x00, 0x00, // arg1~2
+		0x00, 0x04, 0x61, 0x72, // arg2~2 -- arg2
+		0x67, 0x32, // ...
+		0x00, 0x04, 0x61, 0x72, // arg3~2 -- arg3
+		0x67, 0x33, // ...
+	}), f.buffer[:f.Header.FrameSize()], "call res bytes mismatch")
+
+	// A call req for a service that is not registered fails with a bad request error.
+	send(concat([]byte{
+		0x00, 0x3f, // size:2
+		0x03,                   // type:1 -- call req
+		0x00,                   // reserved:1
+		0x00, 0x00, 0x00, 0x03, // id:4
+		0x00, 0x00, 0x00, 0x00, // reserved:4
+		0x00, 0x00, 0x00, 0x00, // reserved:4
+		0x00,                   // flags:1
+		0x00, 0x00, 0x03, 0xe8, // ttl:4
+	}, testTracingBytes, []byte{
+		0x04, 0x6e, 0x6f, 0x70, // service~1 -- nope
+		0x65,                   // ...
+		0x00,                   // nh:1
+		0x00,                   // csumtype:1
+		0x00, 0x04, 0x65, 0x63, // arg1~2 -- echo
+		0x68, 0x6f, // ...
+		0x00, 0x00, // arg2~2
+		0x00, 0x00, // arg3~2
+	}))
+
+	f = receive()
+	assert.Equal(t, messageTypeError, f.Header.messageType, "expected error frame")
+	assert.Equal(t, uint32(3), f.Header.ID, "error ID mismatch")
+	payload := f.SizedPayload()
+	require.True(t, len(payload) > 26, "error frame too short")
+	assert.Equal(t, byte(0x06), payload[0], "error code should be bad request")
+	assert.Equal(t, testTracingBytes, payload[1:26], "error tracing should match the call")
+}
@@ -26,6 +26,7 @@ import (
 	"net"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/uber/tchannel/golang/typed"
 	"golang.org/x/net/context"
@@ -38,6 +39,10 @@ type PeerInfo struct {
 
 	// The logical process name for the peer, used for only for logging / debugging
 	ProcessName string
+
+	// Process is structured information about the peer process, and is nil if the
+	// peer did not send any.
+	Process *ProcessInfo `json:",omitempty"`
 }
 
 func (p PeerInfo) String() string {
@@ -101,6 +106,27 @@ type ConnectionOptions struct {
 
 	// The type of checksum to use when sending messages
 	ChecksumType ChecksumType
+
+	// PingInterval is the interval at which active connections ping the remote peer
+	// to measure the round trip time. Periodic pings are disabled if zero.
+	PingInterval time.Duration
+
+	// StallTimeout is the StreamOptions.StallTimeout used for calls on the connection that
+	// do not set one. It also fails calls with ErrStreamStalled if the peer stops sending
+	// the fragments of a message part way through, rather than waiting until the call's
+	// deadline.
+	StallTimeout time.Duration
+
+	// ReadTimeout closes the connection if no frames are received from the peer for this
+	// long. If pings are enabled, it defaults to a few ping intervals, as a healthy peer
+	// responds to each ping. Otherwise, idle connections are not closed if it is zero.
+	ReadTimeout time.Duration
+
+	// WriteTimeout closes the connection if a frame cannot be written to the peer within
+	// this long, such as when the peer has stopped reading and its receive buffer is full.
+	// If pings are enabled, it defaults to a few ping intervals. Otherwise, writes can
+	// block indefinitely if it is zero.
+	WriteTimeout time.Duration
 }
 
 // connectionEvents are the events that can be triggered by a connection.
@@ -110,29 +136,76 @@ type connectionEvents struct {
 
 	// OnCloseStateChange is called when a connection that is closing changes state.
 	OnCloseStateChange func(c *Connection)
+
+	// OnMessageIDsExhausted is called when the connection is about to run out of message
+	// IDs, see messageIDCycleThreshold.
+	OnMessageIDsExhausted func(c *Connection)
 }
 
 // Connection represents a connection to a remote peer.
 type Connection struct {
-	connID          uint32
-	log             Logger
-	statsReporter   StatsReporter
-	traceReporter   TraceReporter
-	checksumType    ChecksumType
-	framePool       FramePool
-	conn            net.Conn
-	localPeerInfo   LocalPeerInfo
-	remotePeerInfo  PeerInfo
-	sendCh          chan *Frame
-	state           connectionState
-	stateMut        sync.RWMutex
-	inbound         messageExchangeSet
-	outbound        messageExchangeSet
-	handlers        *handlerMap
-	subchannels     *subChannelMap
-	nextMessageID   uint32
-	events          connectionEvents
-	commonStatsTags map[string]string
+	connID            uint32
+	log               Logger
+	statsReporter     StatsReporter
+	traceReporter     TraceReporter
+	checksumType      ChecksumType
+	framePool         FramePool
+	conn              net.Conn
+	localPeerInfo     LocalPeerInfo
+	remotePeerInfo    PeerInfo
+	sendCh            chan *Frame
+	state             connectionState
+	stateMut          sync.RWMutex
+	inbound           messageExchangeSet
+	outbound          messageExchangeSet
+	handlers          *handlerMap
+	internalHandlers  map[string]Handler
+	subchannels       *subChannelMap
+	nextMessageID     uint32
+	events            connectionEvents
+	commonStatsTags   map[string]string
+	inboundStats      *endpointStatsMap
+	outboundStats     *endpointStatsMap
+	slowCallThreshold time.Duration
+	payloadSampler    *payloadSampler
+	pingInterval      time.Duration
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	pingStop          chan struct{}
+	lost              chan struct{}
+	lostOnce          sync.Once
+	rtt               rttEstimator
+	localDraining     func() bool
+	remoteDrainNotify bool
+	remoteHeartbeats  bool
+	flowWindow        int
+	remoteDraining    int32
+	throughput        connectionThroughput
+	frameTap          *FrameTapOptions
+	faults            *faultInjector
+	conformance       *conformanceChecker
+	clock             Clock
+	auditor           *auditor
+	circuitBreakers   *circuitBreakers
+	inboundLimiter    *concurrencyLimiter
+	deduplicator      *deduplicator
+	admission         *admission
+	tlsOptions        *TLSOptions
+	peerIdentity      string
+	usesTLS           bool
+	authenticator     Authenticator
+	authenticated     bool
+	peerPolicy        *PeerPolicy
+	authorizer        Authorizer
+	admin             *adminService
+	payloadSigning    *PayloadSigningOptions
+	contentHash       *ContentHashOptions
+	noise             *noiseConn
+	quotas            *quotaEnforcer
+	interceptors      *interceptors
+	relay             *relayer
+	tag               string
+	tagPolicy         *tagPolicy
 }
 
 // nextConnID gives an ID for each connection for debugging purposes.
@@ -170,7 +243,7 @@ const (
 
 // Creates a new Connection around an outbound connection initiated to a peer
 func (ch *Channel) newOutboundConnection(hostPort string, events connectionEvents, opts *ConnectionOptions) (*Connection, error) {
-	conn, err := net.Dial("tcp", hostPort)
+	conn, err := ch.dial(hostPort)
 	if err != nil {
 		return nil, err
 	}
@@ -215,9 +288,13 @@ func (ch *Channel) newConnection(conn net.Conn, initialState connectionState, ev
 		{"localPeer", conn.LocalAddr()},
 		{"remotePeer", conn.RemoteAddr()},
 	}...)
+	tag, tagPolicy := ch.connTagger.tagConnection(conn, initialState == connectionWaitingToRecvInitReq)
+	log = tagLogger(log, tag, tagPolicy)
 	peerInfo := ch.PeerInfo()
 	log.Debugf("created for %v (%v) local: %v remote: %v",
 		peerInfo.ServiceName, peerInfo.ProcessName, conn.LocalAddr(), conn.RemoteAddr())
+	lost := make(chan struct{})
+	readTimeout, writeTimeout := opts.socketTimeouts()
 	c := &Connection{
 		connID:        connID,
 		log:           log,
@@ -230,22 +307,74 @@ func (ch *Channel) newConnection(conn net.Conn, initialState connectionState, ev
 		localPeerInfo: peerInfo,
 		checksumType:  checksumType,
 		inbound: messageExchangeSet{
-			name:      messageExchangeSetInbound,
-			log:       log,
-			exchanges: make(map[uint32]*messageExchange),
+			name:          messageExchangeSetInbound,
+			log:           log,
+			exchanges:     make(map[uint32]*messageExchange),
+			captureStacks: ch.leakDetector != nil,
+			lost:          lost,
+			stallTimeout:  opts.StallTimeout,
 		},
 		outbound: messageExchangeSet{
-			name:      messageExchangeSetOutbound,
-			log:       log,
-			exchanges: make(map[uint32]*messageExchange),
+			name:          messageExchangeSetOutbound,
+			log:           log,
+			exchanges:     make(map[uint32]*messageExchange),
+			captureStacks: ch.leakDetector != nil,
+			lost:          lost,
+			stallTimeout:  opts.StallTimeout,
 		},
-		handlers:        ch.handlers,
-		events:          events,
-		commonStatsTags: ch.commonStatsTags,
-		subchannels:     ch.subChannels,
+		lost:              lost,
+		handlers:          ch.handlers,
+		internalHandlers:  ch.internalHandlers,
+		events:            events,
+		commonStatsTags:   tagStatsTags(ch.commonStatsTags, tag),
+		subchannels:       ch.subChannels,
+		inboundStats:      ch.inboundStats,
+		outboundStats:     ch.outboundStats,
+		slowCallThreshold: ch.slowCallThreshold,
+		payloadSampler:    ch.payloadSampler,
+		pingInterval:      opts.PingInterval,
+		readTimeout:       readTimeout,
+		writeTimeout:      writeTimeout,
+		pingStop:          make(chan struct{}),
+		frameTap:          ch.frameTap,
+		faults:            ch.faults,
+		clock:             ch.clock,
+		auditor:           ch.auditor,
+		circuitBreakers:   ch.circuitBreakers,
+		inboundLimiter:    ch.inboundLimiter,
+		deduplicator:      ch.deduplicator,
+		admission:         ch.admission,
+		tlsOptions:        ch.tlsOptions,
+		peerIdentity:      ch.tlsOptions.peerIdentity(conn),
+		usesTLS:           isTLSConn(conn),
+		localDraining:     ch.Draining,
+		authenticator:     ch.authenticator,
+		peerPolicy:        ch.peerPolicy,
+		authorizer:        ch.authorizer,
+		admin:             ch.admin,
+		payloadSigning:    ch.payloadSigning,
+		contentHash:       ch.contentHash,
+		quotas:            ch.quotas,
+		interceptors:      ch.interceptors,
+		tag:               tag,
+		tagPolicy:         tagPolicy,
+	}
+	if ch.encryption != nil {
+		c.noise = &noiseConn{Conn: conn, required: ch.encryption.Required}
+		c.conn = c.noise
+	}
+	if ch.strictConformance {
+		c.conformance = newConformanceChecker()
+	}
+	c.relay = newRelayer(ch, c)
+	if c.relay == nil {
+		// Relays forward frames without reading them, so they cannot return credits.
+		c.flowWindow = defaultFlowWindow
 	}
 	c.inbound.onRemoved = c.checkExchanges
 	c.outbound.onRemoved = c.checkExchanges
+	c.inbound.sendCh = c.sendCh
+	c.outbound.sendCh = c.sendCh
 
 	go c.readFrames(connID)
 	go c.writeFrames(connID)
@@ -258,9 +387,15 @@ func (c *Connection) IsActive() bool {
 }
 
 func (c *Connection) callOnActive() {
+	if c.pingInterval > 0 {
+		go c.pingLoop()
+	}
 	if f := c.events.OnActive; f != nil {
 		f(c)
 	}
+	if c.localDraining != nil && c.localDraining() {
+		c.sendDrainNotice(true)
+	}
 }
 
 func (c *Connection) callOnCloseStateChange() {
@@ -297,6 +432,20 @@ func (c *Connection) sendInit(ctx context.Context) error {
 		InitParamHostPort:    c.localPeerInfo.HostPort,
 		InitParamProcessName: c.localPeerInfo.ProcessName,
 	}
+	c.localPeerInfo.Process.addInitParams(req.initParams)
+	req.initParams[InitParamDrainNotify] = "1"
+	req.initParams[InitParamHeartbeats] = "1"
+	c.offerFlowWindow(req.initParams)
+	if c.authenticator != nil {
+		token, err := c.authenticator.Token(c.localPeerInfo.PeerInfo)
+		if err != nil {
+			return c.connectionError(err)
+		}
+		req.initParams[InitParamAuthToken] = token
+	}
+	if err := c.offerEncryption(req.initParams); err != nil {
+		return c.connectionError(err)
+	}
 
 	mex, err := c.outbound.newExchange(ctx, c.framePool, req.messageType(), req.ID(), 1)
 	if err != nil {
@@ -312,8 +461,20 @@ func (c *Connection) sendInit(ctx context.Context) error {
 	res := initRes{}
 	err = c.recvMessage(ctx, &res, mex.recvCh)
 	if err != nil {
+		if _, ok := err.(SystemError); ok {
+			// The peer rejected the handshake, and the connection is closed by handleError.
+			return err
+		}
 		return c.connectionError(err)
 	}
+	if err := c.noise.handshakeErr(); err != nil {
+		// The connection is closed by handleInitRes.
+		return NewWrappedSystemError(ErrCodeProtocol, err)
+	}
+	if err := c.peerPolicy.validate(c.remotePeerInfo); err != nil {
+		return c.connectionError(NewWrappedSystemError(ErrCodeProtocol,
+			fmt.Errorf("peer validation failed: %v", err)))
+	}
 
 	return nil
 }
@@ -345,17 +506,42 @@ func (c *Connection) handleInitReq(frame *Frame) {
 		c.protocolError(id, fmt.Errorf("Header %v is required", InitParamProcessName))
 		return
 	}
+	var err error
+	if c.remotePeerInfo.Process, err = parseProcessInfo(req.initParams); err != nil {
+		c.protocolError(id, err)
+		return
+	}
+	if c.authenticator != nil {
+		if err := c.authenticator.Authenticate(c.remotePeerInfo, req.initParams[InitParamAuthToken]); err != nil {
+			c.statsReporter.IncCounter("inbound.connections.auth-failed", c.commonStatsTags, 1)
+			c.protocolError(id, fmt.Errorf("authentication failed: %v", err))
+			return
+		}
+		c.authenticated = true
+	}
 	if c.remotePeerInfo.IsEphemeral() {
 		// TODO(prashant): Add an IsEphemeral bool to the peer info.
 		c.remotePeerInfo.HostPort = c.conn.RemoteAddr().String()
 	}
+	if err := c.peerPolicy.validate(c.remotePeerInfo); err != nil {
+		c.protocolError(id, fmt.Errorf("peer validation failed: %v", err))
+		return
+	}
 
 	res := initRes{initMessage{id: frame.Header.ID}}
 	res.initParams = initParams{
 		InitParamHostPort:    c.localPeerInfo.HostPort,
 		InitParamProcessName: c.localPeerInfo.ProcessName,
 	}
+	c.localPeerInfo.Process.addInitParams(res.initParams)
+	c.acceptDrainNotify(req.initParams, res.initParams)
+	c.acceptHeartbeats(req.initParams, res.initParams)
+	c.acceptFlowWindow(req.initParams, res.initParams)
 	res.Version = CurrentProtocolVersion
+	if err := c.acceptEncryption(req.initParams, res.initParams); err != nil {
+		c.protocolError(id, err)
+		return
+	}
 	if err := c.sendMessage(&res); err != nil {
 		c.connectionError(err)
 		return
@@ -373,8 +559,10 @@ func (c *Connection) handleInitReq(frame *Frame) {
 	c.callOnActive()
 }
 
-// ping sends a ping message and waits for a ping response.
+// ping sends a ping message and waits for a ping response. The round trip time
+// of the ping is used to update the connection's RTT estimate.
 func (c *Connection) ping(ctx context.Context) error {
+	start := c.clock.Now()
 	req := &pingReq{id: c.NextMessageID()}
 	mex, err := c.outbound.newExchange(ctx, c.framePool, req.messageType(), req.ID(), 1)
 	if err != nil {
@@ -392,6 +580,7 @@ func (c *Connection) ping(ctx context.Context) error {
 		return c.connectionError(err)
 	}
 
+	c.recordRTT(c.clock.Now().Sub(start))
 	return nil
 }
 
@@ -452,11 +641,27 @@ func (c *Connection) handleInitRes(frame *Frame) bool {
 		return true
 	}
 
+	if err := c.completeEncryption(res.initParams); err != nil {
+		// Forward the response so that sendInit can return the error.
+		forwardErr := c.outbound.forwardPeerFrame(frame)
+		c.connectionError(err)
+		return forwardErr != nil
+	}
+
 	c.remotePeerInfo.HostPort = res.initParams[InitParamHostPort]
 	if c.remotePeerInfo.IsEphemeral() {
 		c.remotePeerInfo.HostPort = c.conn.RemoteAddr().String()
 	}
 	c.remotePeerInfo.ProcessName = res.initParams[InitParamProcessName]
+	process, err := parseProcessInfo(res.initParams)
+	if err != nil {
+		c.protocolError(frame.Header.ID, err)
+		return true
+	}
+	c.remotePeerInfo.Process = process
+	c.drainNotifySupported(res.initParams)
+	c.heartbeatsSupported(res.initParams)
+	c.setFlowWindow(res.initParams)
 
 	c.withStateLock(func() error {
 		if c.state == connectionWaitingToRecvInitRes {
@@ -501,19 +706,35 @@ func (c *Connection) recvMessage(ctx context.Context, msg message, resCh <-chan
 		return ctx.Err()
 
 	case frame := <-resCh:
-		err := frame.read(msg)
-		c.framePool.Release(frame)
-		return err
+		defer c.framePool.Release(frame)
+		if frame.Header.messageType == messageTypeError && msg.messageType() != messageTypeError {
+			errMsg := errorMessage{id: frame.Header.ID}
+			if err := frame.read(&errMsg); err != nil {
+				return err
+			}
+			return errMsg.AsSystemError()
+		}
+		return frame.read(msg)
 	}
 }
 
 // NextMessageID reserves the next available message id for this connection
 func (c *Connection) NextMessageID() uint32 {
-	return atomic.AddUint32(&c.nextMessageID, 1)
+	id := atomic.AddUint32(&c.nextMessageID, 1)
+	if id == messageIDCycleThreshold && c.events.OnMessageIDsExhausted != nil {
+		go c.events.OnMessageIDsExhausted(c)
+	}
+	return id
 }
 
 // SendSystemError sends an error frame for the given system error.
 func (c *Connection) SendSystemError(id uint32, span *Span, err error) error {
+	return c.sendSystemError(id, span, err, "")
+}
+
+// sendSystemError sends an error frame for the given system error, including the
+// request ID of the call in the message if it is set.
+func (c *Connection) sendSystemError(id uint32, span *Span, err error, requestID string) error {
 	frame := c.framePool.Get()
 
 	errorSpan := Span{}
@@ -525,7 +746,7 @@ func (c *Connection) SendSystemError(id uint32, span *Span, err error) error {
 		id:      id,
 		errCode: GetSystemErrorCode(err),
 		tracing: errorSpan,
-		message: err.Error()}); err != nil {
+		message: withRequestID(err.Error(), requestID)}); err != nil {
 
 		// This shouldn't happen - it means writing the errorMessage is broken.
 		c.log.Warnf("Could not create outbound frame to %s for %d: %v",
@@ -554,6 +775,13 @@ func (c *Connection) SendSystemError(id uint32, span *Span, err error) error {
 func (c *Connection) connectionError(err error) error {
 	c.log.Warnf("Connection error: %v", err)
 	c.Close()
+
+	// In-flight calls can no longer complete, so fail them rather than leaving them
+	// to wait until their deadline.
+	c.lostOnce.Do(func() {
+		close(c.lost)
+		c.relay.connectionLost()
+	})
 	return NewWrappedSystemError(ErrCodeNetwork, err)
 }
 
@@ -599,11 +827,19 @@ func (c *Connection) readState() connectionState {
 func (c *Connection) readFrames(_ uint32) {
 	for {
 		frame := c.framePool.Get()
+		c.setReadDeadline()
 		if err := frame.ReadIn(c.conn); err != nil {
 			c.framePool.Release(frame)
+			c.checkSocketTimeout(err, "read-timeout")
 			c.connectionError(err)
 			return
 		}
+		c.throughput.recvd.add(int(frame.Header.FrameSize()))
+		c.tapFrame(FrameInbound, frame)
+		if c.injectCallError(frame) || !c.checkConformance(frame) {
+			c.framePool.Release(frame)
+			continue
+		}
 
 		// call req and call res messages may not want the frame released immediately.
 		releaseFrame := true
@@ -624,6 +860,12 @@ func (c *Connection) readFrames(_ uint32) {
 			c.handlePingReq(frame)
 		case messageTypePingRes:
 			releaseFrame = c.handlePingRes(frame)
+		case messageTypeCallProgress:
+			releaseFrame = c.handleCallProgress(frame)
+		case messageTypeDrainNotice:
+			c.handleDrainNotice(frame)
+		case messageTypeWindowUpdate:
+			c.handleWindowUpdate(frame)
 		case messageTypeError:
 			c.handleError(frame)
 		default:
@@ -642,9 +884,28 @@ func (c *Connection) readFrames(_ uint32) {
 func (c *Connection) writeFrames(_ uint32) {
 	for f := range c.sendCh {
 		c.log.Debugf("Writing frame %s", f.Header)
+		switch c.injectWriteFault(f) {
+		case faultDrop:
+			c.framePool.Release(f)
+			continue
+		case faultClose:
+			c.framePool.Release(f)
+			c.conn.Close()
+			c.connectionError(errFaultConnectionClosed)
+			return
+		}
+		c.tapFrame(FrameOutbound, f)
+		c.setWriteDeadline()
 		err := f.WriteOut(c.conn)
+		if f.Header.messageType == messageTypeInitRes {
+			c.noise.initResWritten()
+		}
+		if err == nil {
+			c.throughput.sent.add(int(f.Header.FrameSize()))
+		}
 		c.framePool.Release(f)
 		if err != nil {
+			c.checkSocketTimeout(err, "write-timeout")
 			c.connectionError(err)
 			return
 		}
@@ -735,6 +996,7 @@ func (c *Connection) closeNetwork() {
 	// NB(mmihic): The sender goroutine will exit once the connection is
 	// closed; no need to close the send channel (and closing the send
 	// channel would be dangerous since other goroutine might be sending)
+	close(c.pingStop)
 	if err := c.conn.Close(); err != nil {
 		c.log.Warnf("could not close connection to peer %s: %v", c.remotePeerInfo, err)
 	}
@@ -0,0 +1,173 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// ConnectionTagInfo describes a connection that is being tagged.
+type ConnectionTagInfo struct {
+	// LocalAddr is the local address of the connection, which can be used to tag
+	// connections by the listener that accepted them.
+	LocalAddr net.Addr
+
+	// RemoteAddr is the remote address of the connection.
+	RemoteAddr net.Addr
+
+	// Inbound is whether the connection was accepted, rather than dialed.
+	Inbound bool
+}
+
+// ConnectionTagFunc returns the tag, such as "internal", "partner" or "batch", for a
+// connection when it is accepted or dialed. Connections with an empty tag are not tagged.
+type ConnectionTagFunc func(info ConnectionTagInfo) string
+
+// ConnectionPolicy is the policy applied to inbound calls on connections with a tag.
+type ConnectionPolicy struct {
+	// MaxConcurrentCalls is the number of inbound calls that can be handled concurrently
+	// across all connections with the tag. Calls over the limit are rejected with
+	// ErrServerBusy. Calls are not limited if this is zero.
+	MaxConcurrentCalls int
+
+	// MaxTimeout caps the time to live of inbound calls on connections with the tag.
+	MaxTimeout time.Duration
+
+	// LogLevel is the minimum level logged for connections with the tag. Defaults to
+	// logging everything that the channel's logger logs.
+	LogLevel LogLevel
+}
+
+// ConnectionTaggingOptions configure tagging of connections, so that a single channel can
+// serve different populations of callers with different policies.
+type ConnectionTaggingOptions struct {
+	// Tag returns the tag for each connection.
+	Tag ConnectionTagFunc
+
+	// Policies are the policies for each tag. Connections with a tag that has no policy
+	// are tagged, but are otherwise treated like untagged connections.
+	Policies map[string]ConnectionPolicy
+}
+
+// tagPolicy is the policy for a tag, along with the state used to enforce it.
+type tagPolicy struct {
+	ConnectionPolicy
+
+	inFlight int32
+}
+
+// acquire reserves a slot for a new inbound call, returning ErrServerBusy if the tag's
+// concurrency limit has been reached.
+func (p *tagPolicy) acquire() error {
+	if p == nil || p.MaxConcurrentCalls <= 0 {
+		return nil
+	}
+	if atomic.AddInt32(&p.inFlight, 1) > int32(p.MaxConcurrentCalls) {
+		atomic.AddInt32(&p.inFlight, -1)
+		return ErrServerBusy
+	}
+	return nil
+}
+
+// release releases the slot for a completed inbound call.
+func (p *tagPolicy) release() {
+	if p == nil || p.MaxConcurrentCalls <= 0 {
+		return
+	}
+	atomic.AddInt32(&p.inFlight, -1)
+}
+
+// maxTimeout returns the maximum time to live for inbound calls, or 0 if it is not capped.
+func (p *tagPolicy) maxTimeout() time.Duration {
+	if p == nil {
+		return 0
+	}
+	return p.MaxTimeout
+}
+
+// connectionTagger tags connections and holds the policy for each tag.
+type connectionTagger struct {
+	tag      ConnectionTagFunc
+	policies map[string]*tagPolicy
+}
+
+func newConnectionTagger(opts *ConnectionTaggingOptions) *connectionTagger {
+	if opts == nil || opts.Tag == nil {
+		return nil
+	}
+
+	t := &connectionTagger{
+		tag:      opts.Tag,
+		policies: make(map[string]*tagPolicy, len(opts.Policies)),
+	}
+	for tag, policy := range opts.Policies {
+		t.policies[tag] = &tagPolicy{ConnectionPolicy: policy}
+	}
+	return t
+}
+
+// tagConnection returns the tag for a connection, and the policy for the tag.
+func (t *connectionTagger) tagConnection(conn net.Conn, inbound bool) (string, *tagPolicy) {
+	if t == nil {
+		return "", nil
+	}
+
+	tag := t.tag(ConnectionTagInfo{
+		LocalAddr:  conn.LocalAddr(),
+		RemoteAddr: conn.RemoteAddr(),
+		Inbound:    inbound,
+	})
+	return tag, t.policies[tag]
+}
+
+// tagLogger returns the logger for a connection with the given tag, which includes the tag
+// and only logs at the level configured for the tag.
+func tagLogger(log Logger, tag string, policy *tagPolicy) Logger {
+	if tag == "" {
+		return log
+	}
+
+	log = log.WithFields(LogField{"connTag", tag})
+	if policy != nil && policy.LogLevel > LogLevelAll {
+		log = NewLevelLogger(log, policy.LogLevel)
+	}
+	return log
+}
+
+// tagStatsTags returns the common stats tags for a connection with the given tag.
+func tagStatsTags(commonStatsTags map[string]string, tag string) map[string]string {
+	if tag == "" {
+		return commonStatsTags
+	}
+
+	statsTags := make(map[string]string, len(commonStatsTags)+1)
+	for k, v := range commonStatsTags {
+		statsTags[k] = v
+	}
+	statsTags["connection-tag"] = tag
+	return statsTags
+}
+
+// Tag returns the tag for the connection, see ConnectionTaggingOptions.
+func (c *Connection) Tag() string {
+	return c.tag
+}
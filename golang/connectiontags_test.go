@@ -0,0 +1,145 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestConnectionTagPolicy(t *testing.T) {
+	stats := newRecordingStatsReporter()
+	server, err := NewChannel(testServiceName, &ChannelOptions{
+		StatsReporter: stats,
+		ConnectionTagging: &ConnectionTaggingOptions{
+			Tag: func(info ConnectionTagInfo) string {
+				if info.Inbound {
+					return "partner"
+				}
+				return ""
+			},
+			Policies: map[string]ConnectionPolicy{
+				"partner": {MaxConcurrentCalls: 1, MaxTimeout: 50 * time.Millisecond},
+			},
+		},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+
+	started := make(chan struct{}, 1)
+	testutils.RegisterFunc(t, server, "block", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		return &raw.Res{SystemErr: ErrTimeout}, nil
+	})
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+	hostPort := server.PeerInfo().HostPort
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+
+	errC := make(chan error, 1)
+	go func() {
+		_, _, _, err := raw.Call(ctx, client, hostPort, testServiceName, "block", nil, nil)
+		errC <- err
+	}()
+	<-started
+
+	_, _, _, err = raw.Call(ctx, client, hostPort, testServiceName, "block", nil, nil)
+	assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(err), "calls over the tag's limit should be rejected: %v", err)
+
+	select {
+	case err := <-errC:
+		assert.Equal(t, ErrCodeTimeout, GetSystemErrorCode(err), "call should time out: %v", err)
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("call was not limited by the tag's timeout")
+	}
+
+	// The slot is released once the call completes.
+	_, _, _, err = raw.Call(ctx, client, hostPort, testServiceName, "block", nil, nil)
+	assert.Equal(t, ErrCodeTimeout, GetSystemErrorCode(err), "call should time out: %v", err)
+
+	shedTags := counterTags(stats, "inbound.calls.shed")
+	if assert.Equal(t, 1, len(shedTags), "missing shed counter") {
+		assert.Contains(t, shedTags[0], "connection-tag = partner", "stats should be tagged with the connection tag")
+	}
+
+	var tags []string
+	for _, peer := range server.IntrospectState(nil).Peers {
+		for _, conn := range peer.Connections {
+			tags = append(tags, conn.Tag)
+		}
+	}
+	assert.Equal(t, []string{"partner"}, tags, "introspection should include the connection tag")
+}
+
+func TestConnectionTagLogLevel(t *testing.T) {
+	var logs SyncBuffer
+	var quiet int32
+	server, err := NewChannel(testServiceName, &ChannelOptions{
+		Logger: NewLogger(&logs),
+		ConnectionTagging: &ConnectionTaggingOptions{
+			Tag: func(info ConnectionTagInfo) string {
+				if atomic.LoadInt32(&quiet) == 1 {
+					return "quiet"
+				}
+				return "verbose"
+			},
+			Policies: map[string]ConnectionPolicy{
+				"quiet": {LogLevel: LogLevelError},
+			},
+		},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg3: args.Arg3}, nil
+	})
+
+	for _, q := range []int32{0, 1} {
+		atomic.StoreInt32(&quiet, q)
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+
+		ctx, cancel := NewContext(time.Second)
+		_, _, _, err = raw.Call(ctx, client, server.PeerInfo().HostPort, testServiceName, "echo", nil, testArg3)
+		cancel()
+		client.Close()
+		require.NoError(t, err, "Call failed")
+	}
+
+	assert.True(t, strings.Contains(logs.String(), "{connTag verbose}"), "verbose connections should be logged")
+	assert.False(t, strings.Contains(logs.String(), "{connTag quiet}"), "quiet connections should only log errors")
+}
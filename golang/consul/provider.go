@@ -0,0 +1,225 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// Package consul provides a peer provider that keeps a SubChannel's peers in sync with
+// the healthy instances of a service in the Consul catalog.
+package consul
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/uber/tchannel/golang"
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultMinBackoff = time.Second
+	defaultMaxBackoff = time.Minute
+	defaultWaitTime   = 5 * time.Minute
+)
+
+var errAlreadyStarted = errors.New("peer provider already started")
+
+// Health is the Consul health API used to find instances of a service. It is
+// satisfied by *api.Health, which is returned by api.Client.Health.
+type Health interface {
+	ServiceMultipleTags(service string, tags []string, passingOnly bool, q *api.QueryOptions) ([]*api.ServiceEntry, *api.QueryMeta, error)
+}
+
+// Options configure a PeerProvider.
+type Options struct {
+	// Service is the name of the service in the Consul catalog. Defaults to the
+	// SubChannel's service name.
+	Service string
+
+	// Datacenter is the Consul datacenter to query. Defaults to the agent's datacenter.
+	Datacenter string
+
+	// Tags filters the instances of the service to those that have all of the tags.
+	Tags []string
+
+	// MinBackoff and MaxBackoff bound the time to wait before retrying after the watch
+	// fails. The backoff doubles on each consecutive failure. They default to 1 second
+	// and 1 minute.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// WaitTime is the maximum time that each blocking query waits for changes.
+	// Defaults to 5 minutes.
+	WaitTime time.Duration
+}
+
+// PeerProvider watches the instances of a service that pass their Consul health checks,
+// and keeps a SubChannel's peer list in sync with them. Peers are removed from the peer
+// list once they are no longer healthy.
+type PeerProvider struct {
+	health Health
+	sc     *tchannel.SubChannel
+	opts   Options
+
+	cancel  context.CancelFunc
+	stopped chan struct{}
+
+	mut   sync.Mutex // mut protects added.
+	added map[string]struct{}
+}
+
+// NewPeerProvider returns a PeerProvider for the given SubChannel. Call Start to begin
+// watching Consul.
+func NewPeerProvider(health Health, sc *tchannel.SubChannel, opts *Options) *PeerProvider {
+	p := &PeerProvider{
+		health: health,
+		sc:     sc,
+		added:  make(map[string]struct{}),
+	}
+	if opts != nil {
+		p.opts = *opts
+	}
+	if p.opts.Service == "" {
+		p.opts.Service = sc.ServiceName()
+	}
+	if p.opts.MinBackoff <= 0 {
+		p.opts.MinBackoff = defaultMinBackoff
+	}
+	if p.opts.MaxBackoff < p.opts.MinBackoff {
+		p.opts.MaxBackoff = defaultMaxBackoff
+		if p.opts.MaxBackoff < p.opts.MinBackoff {
+			p.opts.MaxBackoff = p.opts.MinBackoff
+		}
+	}
+	if p.opts.WaitTime <= 0 {
+		p.opts.WaitTime = defaultWaitTime
+	}
+	return p
+}
+
+// Start queries Consul for the initial set of peers, and returns any error. If the
+// query succeeds, a goroutine is started to watch for changes until Stop is called.
+func (p *PeerProvider) Start() error {
+	if p.cancel != nil {
+		return errAlreadyStarted
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	index, err := p.update(ctx, 0)
+	if err != nil {
+		cancel()
+		return err
+	}
+
+	p.cancel = cancel
+	p.stopped = make(chan struct{})
+	go p.watch(ctx, index)
+	return nil
+}
+
+// Stop stops watching Consul. The peers that were added are not removed.
+func (p *PeerProvider) Stop() {
+	if p.cancel == nil {
+		return
+	}
+	p.cancel()
+	<-p.stopped
+}
+
+// watch runs blocking queries to update the peers whenever the service changes.
+func (p *PeerProvider) watch(ctx context.Context, index uint64) {
+	defer close(p.stopped)
+
+	backoff := p.opts.MinBackoff
+	for {
+		newIndex, err := p.update(ctx, index)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			p.sc.Logger().Warnf("Consul watch for %v failed, retrying in %v: %v", p.opts.Service, backoff, err)
+			p.sc.StatsReporter().IncCounter("consul.watch.failed", p.sc.StatsTags(), 1)
+
+			// Sleep for a random duration up to the backoff, to avoid synchronized retries.
+			select {
+			case <-time.After(time.Duration(rand.Int63n(int64(backoff))) + 1):
+			case <-ctx.Done():
+				return
+			}
+			if backoff *= 2; backoff > p.opts.MaxBackoff {
+				backoff = p.opts.MaxBackoff
+			}
+			continue
+		}
+
+		backoff = p.opts.MinBackoff
+		// If the index goes backwards, the Consul state was reset, so start a new watch.
+		if newIndex < index {
+			newIndex = 0
+		}
+		index = newIndex
+	}
+}
+
+// update waits for the service to change after the given index, updates the peers,
+// and returns the new index.
+func (p *PeerProvider) update(ctx context.Context, index uint64) (uint64, error) {
+	q := &api.QueryOptions{
+		Datacenter: p.opts.Datacenter,
+		WaitIndex:  index,
+		WaitTime:   p.opts.WaitTime,
+	}
+	entries, meta, err := p.health.ServiceMultipleTags(p.opts.Service, p.opts.Tags, true, q.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+
+	hostPorts := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		address := entry.Service.Address
+		if address == "" {
+			address = entry.Node.Address
+		}
+		hostPorts[net.JoinHostPort(address, strconv.Itoa(entry.Service.Port))] = struct{}{}
+	}
+	p.setPeers(hostPorts)
+	return meta.LastIndex, nil
+}
+
+// setPeers adds new peers, and removes peers previously added that are no longer healthy.
+func (p *PeerProvider) setPeers(hostPorts map[string]struct{}) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	peers := p.sc.Peers()
+	for hostPort := range hostPorts {
+		if _, ok := p.added[hostPort]; !ok {
+			peers.Add(hostPort)
+			p.added[hostPort] = struct{}{}
+		}
+	}
+	for hostPort := range p.added {
+		if _, ok := hostPorts[hostPort]; !ok {
+			peers.Remove(hostPort)
+			delete(p.added, hostPort)
+		}
+	}
+}
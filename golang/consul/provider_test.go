@@ -0,0 +1,145 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package consul
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+)
+
+type healthResult struct {
+	entries []*api.ServiceEntry
+	index   uint64
+	err     error
+}
+
+// fakeHealth returns queued results. Blocking queries wait for the next result.
+type fakeHealth struct {
+	results chan healthResult
+	queries chan *api.QueryOptions
+}
+
+func newFakeHealth() *fakeHealth {
+	return &fakeHealth{
+		results: make(chan healthResult),
+		queries: make(chan *api.QueryOptions, 100),
+	}
+}
+
+func (h *fakeHealth) ServiceMultipleTags(service string, tags []string, passingOnly bool, q *api.QueryOptions) ([]*api.ServiceEntry, *api.QueryMeta, error) {
+	h.queries <- q
+	select {
+	case r := <-h.results:
+		return r.entries, &api.QueryMeta{LastIndex: r.index}, r.err
+	case <-q.Context().Done():
+		return nil, nil, q.Context().Err()
+	}
+}
+
+func entry(nodeAddress, serviceAddress string, port int) *api.ServiceEntry {
+	return &api.ServiceEntry{
+		Node:    &api.Node{Address: nodeAddress},
+		Service: &api.AgentService{Address: serviceAddress, Port: port},
+	}
+}
+
+func getPeers(ch *tchannel.Channel) []string {
+	var peers []string
+	for hostPort := range ch.Peers().Copy() {
+		peers = append(peers, hostPort)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+func waitForPeers(t *testing.T, ch *tchannel.Channel, want []string) {
+	for i := 0; i < 100; i++ {
+		if assert.ObjectsAreEqual(want, getPeers(ch)) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, want, getPeers(ch), "peers mismatch")
+}
+
+func TestPeerProvider(t *testing.T) {
+	ch, err := tchannel.NewChannel("client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+
+	health := newFakeHealth()
+	provider := NewPeerProvider(health, ch.GetSubChannel("svc"), &Options{
+		Datacenter: "dc1",
+		Tags:       []string{"prod"},
+		MinBackoff: time.Millisecond,
+	})
+
+	go func() {
+		health.results <- healthResult{index: 1, entries: []*api.ServiceEntry{
+			entry("10.0.0.1", "", 1000),
+			entry("10.0.0.2", "10.0.1.2", 2000),
+		}}
+	}()
+	require.NoError(t, provider.Start(), "Start failed")
+	defer provider.Stop()
+	assert.Equal(t, []string{"10.0.0.1:1000", "10.0.1.2:2000"}, getPeers(ch), "initial peers mismatch")
+
+	q := <-health.queries
+	assert.Equal(t, "dc1", q.Datacenter, "datacenter mismatch")
+	assert.EqualValues(t, 0, q.WaitIndex, "initial query should not block")
+
+	// Errors are retried, and the watch continues from the last index.
+	health.results <- healthResult{err: errors.New("consul unavailable")}
+	health.results <- healthResult{index: 2, entries: []*api.ServiceEntry{
+		entry("10.0.0.1", "", 1000),
+		entry("10.0.0.3", "", 3000),
+	}}
+	waitForPeers(t, ch, []string{"10.0.0.1:1000", "10.0.0.3:3000"})
+
+	for i := 0; i < 100 && len(health.queries) < 3; i++ {
+		time.Sleep(5 * time.Millisecond)
+	}
+	var waitIndexes []uint64
+	for len(health.queries) > 0 {
+		waitIndexes = append(waitIndexes, (<-health.queries).WaitIndex)
+	}
+	assert.Equal(t, []uint64{1, 1, 2}, waitIndexes, "watch should block on the last index")
+}
+
+func TestPeerProviderStartFails(t *testing.T) {
+	ch, err := tchannel.NewChannel("client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+
+	health := newFakeHealth()
+	provider := NewPeerProvider(health, ch.GetSubChannel("svc"), nil)
+	go func() {
+		health.results <- healthResult{err: errors.New("consul unavailable")}
+	}()
+	assert.Error(t, provider.Start(), "Start should fail if the initial query fails")
+	assert.Empty(t, getPeers(ch), "no peers should be added")
+}
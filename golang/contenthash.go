@@ -0,0 +1,96 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+var (
+	// ErrContentHashMismatch is a SystemError indicating that the content hash of an
+	// inbound call is missing or does not match the call's arg3.
+	ErrContentHashMismatch = NewSystemError(ErrCodeBadRequest, "content hash mismatch")
+)
+
+// ContentHashOptions configure end-to-end content hashes of call payloads. Frame checksums
+// only protect each hop, so a relay that re-fragments or re-checksums frames can corrupt
+// a payload without being detected. A content hash of arg3 is sent in a transport header
+// and verified by the final receiver, as relays forward headers unchanged.
+type ContentHashOptions struct {
+	// Required rejects inbound calls that do not have a content hash. Otherwise, only
+	// calls that have a content hash are verified.
+	Required bool
+}
+
+// hashContent returns the content hash for arg3.
+func hashContent(arg3 []byte) string {
+	sum := sha256.Sum256(arg3)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashContent returns the content hash for a call with the given arg3, to be sent using
+// CallOptions.ContentHash. It returns an empty string if content hashes are not enabled
+// for the channel.
+func (ch *Channel) HashContent(arg3 []byte) string {
+	if ch.contentHash == nil {
+		return ""
+	}
+	return hashContent(arg3)
+}
+
+// HashContent returns the content hash for a call using the subchannel with the given
+// arg3, to be sent using CallOptions.ContentHash.
+func (c *SubChannel) HashContent(arg3 []byte) string {
+	return c.topChannel.HashContent(arg3)
+}
+
+// verifyContentHash reads the arguments of an inbound call and verifies arg3 against the
+// call's content hash. The arguments are buffered so that they can be read by the handler.
+func (c *Connection) verifyContentHash(call *InboundCall) error {
+	opts := c.contentHash
+	if opts == nil {
+		return nil
+	}
+
+	expected, ok := call.headers[ContentHash]
+	if !ok {
+		if opts.Required {
+			return ErrContentHashMismatch
+		}
+		return nil
+	}
+
+	if call.bufferedArgs == nil {
+		var arg2, arg3 []byte
+		if err := NewArgReader(call.arg2Reader()).Read(&arg2); err != nil {
+			return err
+		}
+		if err := NewArgReader(call.arg3Reader()).Read(&arg3); err != nil {
+			return err
+		}
+		call.bufferedArgs = [][]byte{arg2, arg3}
+	}
+
+	if hashContent(call.bufferedArgs[1]) != expected {
+		return ErrContentHashMismatch
+	}
+	return nil
+}
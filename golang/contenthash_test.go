@@ -0,0 +1,105 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestContentHash(t *testing.T) {
+	server, err := NewChannel("svc", &ChannelOptions{ContentHash: &ContentHashOptions{Required: true}})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+
+	relay, err := NewChannel("relay", &ChannelOptions{
+		RelayHosts: SimpleRelayHosts{"svc": {server.PeerInfo().HostPort}},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, relay.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer relay.Close()
+
+	hashing, err := NewChannel("hashing-client", &ChannelOptions{ContentHash: &ContentHashOptions{}})
+	require.NoError(t, err, "NewChannel failed")
+	defer hashing.Close()
+
+	plain, err := NewChannel("plain-client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer plain.Close()
+
+	tests := []struct {
+		msg      string
+		client   *Channel
+		opts     *CallOptions
+		hostPort string
+		wantErr  bool
+	}{
+		{msg: "hashed", client: hashing, hostPort: server.PeerInfo().HostPort},
+		{msg: "hashed through relay", client: hashing, hostPort: relay.PeerInfo().HostPort},
+		{msg: "missing hash", client: plain, hostPort: server.PeerInfo().HostPort, wantErr: true},
+		{
+			msg:      "mismatched hash",
+			client:   plain,
+			opts:     &CallOptions{ContentHash: "bad"},
+			hostPort: server.PeerInfo().HostPort,
+			wantErr:  true,
+		},
+		{
+			msg:      "mismatched hash through relay",
+			client:   plain,
+			opts:     &CallOptions{ContentHash: "bad"},
+			hostPort: relay.PeerInfo().HostPort,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		ctx, cancel := NewContext(time.Second)
+		_, arg3, _, err := raw.CallWithOptions(ctx, tt.client, tt.hostPort, "svc", "echo", testArg2, testArg3, tt.opts)
+		cancel()
+
+		if tt.wantErr {
+			assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(err), "%v: unexpected error %v", tt.msg, err)
+			continue
+		}
+		if assert.NoError(t, err, "%v: call failed", tt.msg) {
+			assert.Equal(t, testArg3, arg3, "%v: arg3 mismatch", tt.msg)
+		}
+	}
+}
+
+func TestHashContentDisabled(t *testing.T) {
+	ch, err := NewChannel("svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+	assert.Empty(t, ch.HashContent(testArg3), "HashContent should be empty when content hashes are disabled")
+}
@@ -21,6 +21,7 @@
 package tchannel
 
 import (
+	"sync"
 	"time"
 
 	"golang.org/x/net/context"
@@ -32,10 +33,17 @@ type contextKey int
 
 const contextKeyTChannel = 1
 
+const contextKeyRequestState contextKey = 2
+
 type tchannelCtxParams struct {
 	span    *Span
 	call    IncomingCall
 	options *CallOptions
+
+	retryOptions *RetryOptions
+
+	mut       sync.RWMutex // mut protects requestID.
+	requestID string
 }
 
 // IncomingCall exposes properties for incoming calls through the context.
@@ -45,6 +53,9 @@ type IncomingCall interface {
 
 	// ShardKey returns the shard key from the ShardKey transport header.
 	ShardKey() string
+
+	// RoutingDelegate returns the routing delegate from the RoutingDelegate transport header.
+	RoutingDelegate() string
 }
 
 func getTChannelParams(ctx context.Context) *tchannelCtxParams {
@@ -70,10 +81,13 @@ func WrapContextForTest(ctx context.Context, call IncomingCall) context.Context
 }
 
 // newIncomingContext creates a new context for an incoming call with the given span.
+// The context is assigned a new request ID, which may be replaced by a request ID
+// propagated by the caller once the application headers are read.
 func newIncomingContext(call IncomingCall, timeout time.Duration, span *Span) (context.Context, context.CancelFunc) {
 	return NewContextBuilder(timeout).
 		setIncomingCall(call).
 		setSpan(span).
+		SetRequestID(newRequestID()).
 		Build()
 }
 
@@ -85,6 +99,29 @@ func CurrentCall(ctx context.Context) IncomingCall {
 	return nil
 }
 
+// LoggerFromContext returns the logger for the inbound call that the context is for, which
+// includes the service, operation, caller and trace ID of the call as fields. It returns
+// NullLogger if the context is not for an inbound call.
+func LoggerFromContext(ctx context.Context) Logger {
+	if call, ok := CurrentCall(ctx).(*InboundCall); ok {
+		logger, _ := call.handlerObservability()
+		return logger
+	}
+	return NullLogger
+}
+
+// StatsFromContext returns a StatsReporter for the inbound call that the context is for,
+// which adds the tags used for the channel's own inbound call stats, such as the endpoint
+// and calling service, to every stat. It returns NullStatsReporter if the context is not
+// for an inbound call.
+func StatsFromContext(ctx context.Context) StatsReporter {
+	if call, ok := CurrentCall(ctx).(*InboundCall); ok {
+		_, stats := call.handlerObservability()
+		return stats
+	}
+	return NullStatsReporter
+}
+
 // CurrentSpan returns the Span value for the provided Context
 func CurrentSpan(ctx context.Context) *Span {
 	if params := getTChannelParams(ctx); params != nil {
@@ -38,6 +38,12 @@ type ContextBuilder struct {
 	// CallOptions are TChannel call options for the specific call.
 	CallOptions *CallOptions
 
+	// RequestID is the request ID that is propagated on calls made using the Context.
+	RequestID string
+
+	// RetryOptions are the retry options used by RunWithRetry.
+	RetryOptions *RetryOptions
+
 	// Hidden fields: we do not want users outside of tchannel to set these.
 	incomingCall IncomingCall
 	span         *Span
@@ -81,6 +87,33 @@ func (cb *ContextBuilder) SetShardKey(sk string) *ContextBuilder {
 	return cb
 }
 
+// SetRoutingDelegate sets the RoutingDelegate call option ("rd" transport header).
+func (cb *ContextBuilder) SetRoutingDelegate(rd string) *ContextBuilder {
+	if cb.CallOptions == nil {
+		cb.CallOptions = new(CallOptions)
+	}
+	cb.CallOptions.RoutingDelegate = rd
+	return cb
+}
+
+// SetCallerName sets the CallerName call option, which overrides the "cn" transport header.
+func (cb *ContextBuilder) SetCallerName(callerName string) *ContextBuilder {
+	if cb.CallOptions == nil {
+		cb.CallOptions = new(CallOptions)
+	}
+	cb.CallOptions.CallerName = callerName
+	return cb
+}
+
+// SetIdempotencyKey sets the IdempotencyKey call option ("ik" transport header).
+func (cb *ContextBuilder) SetIdempotencyKey(key string) *ContextBuilder {
+	if cb.CallOptions == nil {
+		cb.CallOptions = new(CallOptions)
+	}
+	cb.CallOptions.IdempotencyKey = key
+	return cb
+}
+
 // SetFormat sets the Format call option ("as" transport header).
 func (cb *ContextBuilder) SetFormat(f Format) *ContextBuilder {
 	if cb.CallOptions == nil {
@@ -90,6 +123,28 @@ func (cb *ContextBuilder) SetFormat(f Format) *ContextBuilder {
 	return cb
 }
 
+// SetStreamOptions sets the Stream call option, which configures flow control for calls
+// that stream arguments, such as those made by the stream package.
+func (cb *ContextBuilder) SetStreamOptions(opts *StreamOptions) *ContextBuilder {
+	if cb.CallOptions == nil {
+		cb.CallOptions = new(CallOptions)
+	}
+	cb.CallOptions.Stream = opts
+	return cb
+}
+
+// SetRequestID sets the request ID that is propagated on calls made using the Context.
+func (cb *ContextBuilder) SetRequestID(requestID string) *ContextBuilder {
+	cb.RequestID = requestID
+	return cb
+}
+
+// SetRetryOptions sets RetryOptions in the context.
+func (cb *ContextBuilder) SetRetryOptions(retryOptions *RetryOptions) *ContextBuilder {
+	cb.RetryOptions = retryOptions
+	return cb
+}
+
 // SetIncomingCallForTest sets an IncomingCall in the context.
 // This should only be used in unit tests.
 func (cb *ContextBuilder) SetIncomingCallForTest(call IncomingCall) *ContextBuilder {
@@ -120,9 +175,12 @@ func (cb *ContextBuilder) Build() (ContextWithHeaders, context.CancelFunc) {
 	}
 
 	params := &tchannelCtxParams{
-		options: cb.CallOptions,
-		span:    cb.span,
-		call:    cb.incomingCall,
+		options:   cb.CallOptions,
+		span:      cb.span,
+		call:      cb.incomingCall,
+		requestID: cb.RequestID,
+
+		retryOptions: cb.RetryOptions,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
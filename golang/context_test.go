@@ -20,6 +20,7 @@
 package tchannel_test
 
 import (
+	"io/ioutil"
 	"testing"
 	"time"
 
@@ -28,6 +29,7 @@ import (
 	. "github.com/uber/tchannel/golang"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/uber/tchannel/golang/raw"
 	"github.com/uber/tchannel/golang/testutils"
 )
@@ -66,6 +68,132 @@ func TestShardKeyPropagates(t *testing.T) {
 	})
 }
 
+func TestCallMetadataPropagates(t *testing.T) {
+	WithVerifiedServer(t, nil, func(ch *Channel, hostPort string) {
+		peerInfo := ch.PeerInfo()
+		testutils.RegisterFunc(t, ch, "test", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			call := CurrentCall(ctx)
+			return &raw.Res{
+				Arg2: []byte(call.CallerName()),
+				Arg3: []byte(call.ShardKey() + "," + call.RoutingDelegate()),
+			}, nil
+		})
+
+		ctx, cancel := NewContextBuilder(time.Second).Build()
+		defer cancel()
+		arg2, arg3, _, err := raw.Call(ctx, ch, peerInfo.HostPort, peerInfo.ServiceName, "test", nil, nil)
+		assert.NoError(t, err, "Call failed")
+		assert.Equal(t, peerInfo.ServiceName, string(arg2), "Caller name should default to the service name")
+		assert.Equal(t, ",", string(arg3))
+
+		ctx, cancel = NewContextBuilder(time.Second).
+			SetShardKey("shard").
+			SetRoutingDelegate("router").
+			SetCallerName("caller").
+			SetRetryOptions(&RetryOptions{RetryOn: RetryNever}).
+			Build()
+		defer cancel()
+		arg2, arg3, _, err = raw.Call(ctx, ch, peerInfo.HostPort, peerInfo.ServiceName, "test", nil, nil)
+		assert.NoError(t, err, "Call failed")
+		assert.Equal(t, "caller", string(arg2))
+		assert.Equal(t, "shard,router", string(arg3))
+	})
+}
+
+func TestCallWithOptions(t *testing.T) {
+	WithVerifiedServer(t, nil, func(ch *Channel, hostPort string) {
+		peerInfo := ch.PeerInfo()
+		var attempts int
+		testutils.RegisterFunc(t, ch, "test", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			attempts++
+			if attempts == 1 {
+				return &raw.Res{SystemErr: ErrServerBusy}, nil
+			}
+			call := CurrentCall(ctx)
+			deadline, _ := ctx.Deadline()
+			return &raw.Res{
+				Arg2: []byte(call.ShardKey() + "," + call.RoutingDelegate() + "," + string(args.Format)),
+				Arg3: []byte(deadline.Sub(time.Now()).String()),
+			}, nil
+		})
+
+		ctx, cancel := NewContext(time.Minute)
+		defer cancel()
+
+		opts := &CallOptions{
+			Format:          JSON,
+			ShardKey:        "shard",
+			RoutingDelegate: "router",
+			Timeout:         time.Second,
+			RetryOptions:    &RetryOptions{MaxAttempts: 1},
+		}
+		_, _, _, err := raw.CallWithOptions(ctx, ch, hostPort, peerInfo.ServiceName, "test", nil, nil, opts)
+		assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(err), "Call should not be retried")
+
+		attempts = 0
+		sc := ch.GetSubChannel(peerInfo.ServiceName)
+		_, _, _, err = raw.CallSCWithOptions(ctx, sc, "test", nil, nil, opts)
+		assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(err), "CallSC should use the retry options")
+
+		attempts = 0
+		opts.RetryOptions = &RetryOptions{MaxAttempts: 2, BackoffBase: time.Millisecond}
+		arg2, arg3, _, err := raw.CallSCWithOptions(ctx, sc, "test", nil, nil, opts)
+		require.NoError(t, err, "CallSC should be retried")
+		assert.Equal(t, 2, attempts, "CallSC should be retried")
+		assert.Equal(t, "shard,router,json", string(arg2))
+		ttl, err := time.ParseDuration(string(arg3))
+		require.NoError(t, err, "failed to parse ttl")
+		assert.True(t, ttl <= time.Second, "call should use the timeout in the call options, got %v", ttl)
+	})
+}
+
+func TestLoggerAndStatsFromContext(t *testing.T) {
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	assert.Equal(t, NullLogger, LoggerFromContext(ctx), "outbound contexts should use NullLogger")
+	assert.Equal(t, NullStatsReporter, StatsFromContext(ctx), "outbound contexts should use NullStatsReporter")
+
+	stats := newRecordingStatsReporter()
+	server, err := NewChannel("svc", &ChannelOptions{
+		Logger:        NewLogger(ioutil.Discard),
+		StatsReporter: stats,
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer server.Close()
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+
+	var fields LogFields
+	var traceID uint64
+	testutils.RegisterFunc(t, server, "op", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		fields = LoggerFromContext(ctx).Fields()
+		traceID = CurrentSpan(ctx).TraceID()
+		StatsFromContext(ctx).IncCounter("app.requests", map[string]string{"result": "ok"}, 1)
+		return &raw.Res{}, nil
+	})
+
+	client, err := testutils.NewClient(&testutils.ChannelOpts{ServiceName: "caller"})
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	_, _, _, err = raw.Call(ctx, client, server.PeerInfo().HostPort, "svc", "op", nil, nil)
+	require.NoError(t, err, "Call failed")
+
+	fieldValues := make(map[string]interface{})
+	for _, f := range fields {
+		fieldValues[f.Key] = f.Value
+	}
+	assert.Equal(t, "svc", fieldValues["service"], "service field mismatch")
+	assert.Equal(t, "op", fieldValues["operation"], "operation field mismatch")
+	assert.Equal(t, "caller", fieldValues["caller"], "caller field mismatch")
+	assert.Equal(t, traceID, fieldValues["traceID"], "traceID field mismatch")
+
+	tags := counterTags(stats, "app.requests")
+	require.Equal(t, 1, len(tags), "app.requests should be reported with one set of tags")
+	for _, tag := range []string{"calling-service = caller", "endpoint = op", "result = ok", "service = svc"} {
+		assert.Contains(t, tags[0], tag, "stat is missing tag")
+	}
+}
+
 func TestCurrentCallWithNilResult(t *testing.T) {
 	ctx, cancel := NewContext(time.Second)
 	defer cancel()
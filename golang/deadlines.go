@@ -0,0 +1,85 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+const (
+	// defaultTimeoutPings is the number of ping intervals that the default read and write
+	// timeouts allow for, so that a single slow ping does not close the connection.
+	defaultTimeoutPings = 3
+
+	// minDefaultSocketTimeout is the minimum default read and write timeout, so that
+	// short ping intervals do not close connections that are briefly slow.
+	minDefaultSocketTimeout = time.Second
+)
+
+// socketTimeouts returns the read and write timeouts for connections using the options.
+// If they are not set, they are derived from the ping interval, since a healthy peer
+// responds to each ping.
+func (o *ConnectionOptions) socketTimeouts() (readTimeout, writeTimeout time.Duration) {
+	readTimeout, writeTimeout = o.ReadTimeout, o.WriteTimeout
+	if o.PingInterval <= 0 {
+		return readTimeout, writeTimeout
+	}
+
+	defaultTimeout := defaultTimeoutPings * o.PingInterval
+	if defaultTimeout < minDefaultSocketTimeout {
+		defaultTimeout = minDefaultSocketTimeout
+	}
+	if readTimeout == 0 {
+		readTimeout = defaultTimeout
+	}
+	if writeTimeout == 0 {
+		writeTimeout = defaultTimeout
+	}
+	return readTimeout, writeTimeout
+}
+
+// setReadDeadline sets the deadline for reading the next frame from the peer.
+func (c *Connection) setReadDeadline() {
+	if c.readTimeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+}
+
+// setWriteDeadline sets the deadline for writing the next frame to the peer.
+func (c *Connection) setWriteDeadline() {
+	if c.writeTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+}
+
+// checkSocketTimeout closes the underlying connection if err is a read or write timeout,
+// so that neither the reader nor the writer is left blocked on an unresponsive peer.
+func (c *Connection) checkSocketTimeout(err error, metric string) {
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		return
+	}
+
+	c.log.Warnf("Closing connection to %v after a %v: %v", c.remotePeerInfo, metric, err)
+	c.statsReporter.IncCounter("connections."+metric+"s", c.commonStatsTags, 1)
+	c.conn.Close()
+}
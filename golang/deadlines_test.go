@@ -0,0 +1,153 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/testutils"
+)
+
+func TestReadTimeout(t *testing.T) {
+	WithVerifiedServer(t, nil, func(server *Channel, hostPort string) {
+		stats := newRecordingStatsReporter()
+		client, err := NewChannel("client", &ChannelOptions{StatsReporter: stats})
+		require.NoError(t, err, "NewChannel failed")
+		defer client.Close()
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		conn, err := client.Connect(ctx, hostPort, &ConnectionOptions{ReadTimeout: 100 * time.Millisecond})
+		require.NoError(t, err, "Connect failed")
+
+		// The server never sends frames on an idle connection, so it is closed.
+		assert.True(t, testutils.WaitFor(time.Second, func() bool {
+			return !conn.IsActive()
+		}), "idle connection should be closed after the read timeout")
+		assert.Equal(t, int64(1), counterValue(stats, "connections.read-timeouts"), "read timeouts mismatch")
+	})
+}
+
+func TestPingsPreventReadTimeout(t *testing.T) {
+	WithVerifiedServer(t, nil, func(server *Channel, hostPort string) {
+		client, err := NewChannel("client", nil)
+		require.NoError(t, err, "NewChannel failed")
+		defer client.Close()
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		conn, err := client.Connect(ctx, hostPort, &ConnectionOptions{
+			PingInterval: 20 * time.Millisecond,
+			ReadTimeout:  100 * time.Millisecond,
+		})
+		require.NoError(t, err, "Connect failed")
+
+		time.Sleep(300 * time.Millisecond)
+		assert.True(t, conn.IsActive(), "ping responses should keep the connection active")
+	})
+}
+
+// withPausingProxy runs f with the address of a proxy to hostPort. Once pause is called,
+// the proxy stops reading from the client, so writes to it block.
+func withPausingProxy(t *testing.T, hostPort string, f func(proxyHostPort string, pause func())) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Listen failed")
+	defer ln.Close()
+
+	paused := make(chan struct{})
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		server, err := net.Dial("tcp", hostPort)
+		if err != nil {
+			return
+		}
+		defer server.Close()
+
+		go io.Copy(conn, server)
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			server.Write(buf[:n])
+
+			select {
+			case <-paused:
+				// Keep the connection open until the client closes it.
+				io.Copy(ioutil.Discard, server)
+				return
+			default:
+			}
+		}
+	}()
+
+	var pauseOnce sync.Once
+	f(ln.Addr().String(), func() { pauseOnce.Do(func() { close(paused) }) })
+}
+
+func TestWriteTimeout(t *testing.T) {
+	WithVerifiedServer(t, nil, func(_ *Channel, hostPort string) {
+		withPausingProxy(t, hostPort, func(proxyHostPort string, pause func()) {
+			stats := newRecordingStatsReporter()
+			client, err := NewChannel("client", &ChannelOptions{
+				StatsReporter:            stats,
+				DefaultConnectionOptions: ConnectionOptions{WriteTimeout: 100 * time.Millisecond},
+			})
+			require.NoError(t, err, "NewChannel failed")
+			defer client.Close()
+
+			ctx, cancel := NewContext(5 * time.Second)
+			defer cancel()
+			require.NoError(t, client.Ping(ctx, proxyHostPort), "Ping failed")
+
+			// Once the proxy stops reading, calls are queued until the write times out.
+			pause()
+			started := time.Now()
+			arg2 := make([]byte, 32*1024)
+			for i := 0; i < 4096 && err == nil; i++ {
+				var call *OutboundCall
+				call, err = client.BeginCall(ctx, proxyHostPort, testutils.DefaultServerName, "echo", nil)
+				if err == nil {
+					err = NewArgWriter(call.Arg2Writer()).Write(arg2)
+				}
+				if err == nil {
+					err = NewArgWriter(call.Arg3Writer()).Write(nil)
+				}
+			}
+			assert.Equal(t, ErrCodeNetwork, GetSystemErrorCode(err), "Write should fail once the connection is closed: %v", err)
+			assert.True(t, time.Since(started) < 3*time.Second, "Write should fail before the deadline")
+			assert.Equal(t, int64(1), counterValue(stats, "connections.write-timeouts"), "write timeouts mismatch")
+		})
+	})
+}
@@ -0,0 +1,308 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDedupWindow          = time.Minute
+	defaultDedupMaxEntries      = 10000
+	defaultDedupMaxResponseSize = 64 * 1024
+)
+
+// ErrIdempotencyKeyReused is a SystemError indicating that an inbound call reused the
+// idempotency key of a recent call, but its arguments differ from the original call's.
+var ErrIdempotencyKeyReused = NewSystemError(ErrCodeBadRequest, "idempotency key reused with a different payload")
+
+// DeduplicationOptions configure deduplication of inbound calls that set the idempotency
+// key ("ik") transport header. If a call with the same caller, service, operation and key
+// is received within the window, the response of the original call is returned instead of
+// calling the handler again. Only calls that complete successfully or with an application
+// error are deduplicated, so calls that fail with a system error can be retried.
+type DeduplicationOptions struct {
+	// Window is how long after the original call is received that repeated calls are
+	// deduplicated. Defaults to 1 minute.
+	Window time.Duration
+
+	// MaxEntries is the maximum number of calls tracked. Once it is reached, the oldest calls
+	// are no longer deduplicated. Defaults to 10000.
+	MaxEntries int
+
+	// MaxResponseSize is the maximum size of the arg2 and arg3 of a response that is kept
+	// to be returned for repeated calls. Calls with larger responses are not deduplicated.
+	// Defaults to 64KB.
+	MaxResponseSize int
+}
+
+type dedupKey struct {
+	caller    string
+	service   string
+	operation string
+	key       string
+}
+
+// dedupEntry tracks the original call for an idempotency key.
+type dedupEntry struct {
+	key         dedupKey
+	createdAt   time.Time
+	payloadHash [sha256.Size]byte
+
+	// done is closed once the original call completes. The fields below must not be
+	// read until done is closed.
+	done      chan struct{}
+	completed bool
+	appError  bool
+	arg2      []byte
+	arg3      []byte
+}
+
+// deduplicator tracks inbound calls by idempotency key.
+type deduplicator struct {
+	window          time.Duration
+	maxEntries      int
+	maxResponseSize int
+	clock           Clock
+
+	mut     sync.Mutex
+	entries map[dedupKey]*dedupEntry
+
+	// order contains entries in the order they were created, which is also the order
+	// in which they expire. It may contain entries that have already been removed.
+	order []*dedupEntry
+}
+
+func newDeduplicator(opts *DeduplicationOptions, clock Clock) *deduplicator {
+	if opts == nil {
+		return nil
+	}
+
+	d := &deduplicator{
+		window:          opts.Window,
+		maxEntries:      opts.MaxEntries,
+		maxResponseSize: opts.MaxResponseSize,
+		clock:           clock,
+		entries:         make(map[dedupKey]*dedupEntry),
+	}
+	if d.window <= 0 {
+		d.window = defaultDedupWindow
+	}
+	if d.maxEntries <= 0 {
+		d.maxEntries = defaultDedupMaxEntries
+	}
+	if d.maxResponseSize <= 0 {
+		d.maxResponseSize = defaultDedupMaxResponseSize
+	}
+	return d
+}
+
+// hashPayload returns a hash of the arguments of a call.
+func hashPayload(arg2, arg3 []byte) [sha256.Size]byte {
+	h := sha256.New()
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(len(arg2)))
+	h.Write(size[:])
+	h.Write(arg2)
+	h.Write(arg3)
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// start returns the entry for the call's idempotency key, and whether this call is the
+// original call for the key. It returns a nil entry if the call is not deduplicated.
+// The call's arguments are read and buffered, so that a repeated call can be checked
+// against the original call, and ErrIdempotencyKeyReused is returned if they differ.
+func (d *deduplicator) start(call *InboundCall) (*dedupEntry, bool, error) {
+	if d == nil || call.headers[IdempotencyKey] == "" {
+		return nil, false, nil
+	}
+
+	if call.bufferedArgs == nil {
+		var arg2, arg3 []byte
+		if err := NewArgReader(call.arg2Reader()).Read(&arg2); err != nil {
+			return nil, false, err
+		}
+		if err := NewArgReader(call.arg3Reader()).Read(&arg3); err != nil {
+			return nil, false, err
+		}
+		call.bufferedArgs = [][]byte{arg2, arg3}
+	}
+	payloadHash := hashPayload(call.bufferedArgs[0], call.bufferedArgs[1])
+
+	key := dedupKey{
+		caller:    call.CallerName(),
+		service:   call.ServiceName(),
+		operation: string(call.Operation()),
+		key:       call.headers[IdempotencyKey],
+	}
+
+	d.mut.Lock()
+	defer d.mut.Unlock()
+
+	now := d.clock.Now()
+	d.evict(now)
+	if entry, ok := d.entries[key]; ok {
+		if entry.payloadHash != payloadHash {
+			return nil, false, ErrIdempotencyKeyReused
+		}
+		return entry, false, nil
+	}
+
+	entry := &dedupEntry{key: key, createdAt: now, payloadHash: payloadHash, done: make(chan struct{})}
+	d.entries[key] = entry
+	d.order = append(d.order, entry)
+	return entry, true, nil
+}
+
+// evict removes entries that are outside the window, and the oldest entries if there
+// is no room for a new entry. mut must be held.
+func (d *deduplicator) evict(now time.Time) {
+	for len(d.order) > 0 {
+		entry := d.order[0]
+		if len(d.entries) < d.maxEntries && now.Sub(entry.createdAt) < d.window {
+			return
+		}
+		d.order = d.order[1:]
+		d.remove(entry)
+	}
+}
+
+// remove removes the entry if it is still the entry for its key. mut must be held.
+func (d *deduplicator) remove(entry *dedupEntry) {
+	if d.entries[entry.key] == entry {
+		delete(d.entries, entry.key)
+	}
+}
+
+// dedupCall records the response of an original call so it can be replayed.
+type dedupCall struct {
+	d     *deduplicator
+	entry *dedupEntry
+
+	mut  sync.Mutex
+	arg2 bytes.Buffer
+	arg3 bytes.Buffer
+
+	// tooLarge is set once the response exceeds the maximum response size, after which
+	// the response is no longer recorded.
+	tooLarge bool
+}
+
+// captureWriter wraps the given response writer so that the data written is recorded.
+func (c *dedupCall) captureWriter(arg sampledArg, writer ArgWriter, err error) (ArgWriter, error) {
+	if c == nil || err != nil {
+		return writer, err
+	}
+	return &dedupWriter{writer, c, arg}, nil
+}
+
+type dedupWriter struct {
+	ArgWriter
+	call *dedupCall
+	arg  sampledArg
+}
+
+func (w *dedupWriter) Write(p []byte) (int, error) {
+	n, err := w.ArgWriter.Write(p)
+
+	c := w.call
+	c.mut.Lock()
+	if !c.tooLarge && c.arg2.Len()+c.arg3.Len()+n > c.d.maxResponseSize {
+		c.tooLarge = true
+		c.arg2 = bytes.Buffer{}
+		c.arg3 = bytes.Buffer{}
+	}
+	if !c.tooLarge {
+		if w.arg == sampledResponseArg2 {
+			c.arg2.Write(p[:n])
+		} else {
+			c.arg3.Write(p[:n])
+		}
+	}
+	c.mut.Unlock()
+	return n, err
+}
+
+// finish completes the entry for the original call. If the call did not complete, or its
+// response was too large to record, the entry is removed so that the call can be retried.
+func (c *dedupCall) finish(completed, appError bool) {
+	if c == nil {
+		return
+	}
+
+	c.mut.Lock()
+	tooLarge := c.tooLarge
+	c.mut.Unlock()
+
+	entry := c.entry
+	if completed && !tooLarge {
+		c.mut.Lock()
+		entry.completed = true
+		entry.appError = appError
+		entry.arg2 = c.arg2.Bytes()
+		entry.arg3 = c.arg3.Bytes()
+		c.mut.Unlock()
+	} else {
+		c.d.mut.Lock()
+		c.d.remove(entry)
+		c.d.mut.Unlock()
+	}
+	close(entry.done)
+}
+
+// replayCall responds to a repeated call with the response of the original call, waiting
+// for the original call to complete if required.
+// The arguments of the repeated call have already been read by start.
+func (c *Connection) replayCall(call *InboundCall, entry *dedupEntry) {
+	response := call.Response()
+	select {
+	case <-entry.done:
+	case <-call.mex.ctx.Done():
+		call.mex.shutdown()
+		response.SendSystemError(ErrTimeout)
+		return
+	}
+
+	// The original call failed, or its response was too large to record, after this call
+	// was received, so ask the caller to retry.
+	if !entry.completed {
+		call.mex.shutdown()
+		response.SendSystemError(ErrServerBusy)
+		return
+	}
+
+	call.statsReporter.IncCounter("inbound.calls.deduplicated", call.commonStatsTags, 1)
+	if entry.appError {
+		if err := response.SetApplicationError(); err != nil {
+			return
+		}
+	}
+	if err := NewArgWriter(response.Arg2Writer()).Write(entry.arg2); err != nil {
+		return
+	}
+	NewArgWriter(response.Arg3Writer()).Write(entry.arg3)
+}
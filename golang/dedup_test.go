@@ -0,0 +1,169 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestDeduplication(t *testing.T) {
+	var calls int32
+	large := strings.Repeat("x", 64)
+	server, err := NewChannel("dedup-svc", &ChannelOptions{
+		Deduplication: &DeduplicationOptions{Window: time.Second, MaxResponseSize: 64},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer server.Close()
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+
+	testutils.RegisterFunc(t, server, "op", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		n := atomic.AddInt32(&calls, 1)
+		switch string(args.Arg3) {
+		case "app-error":
+			return &raw.Res{IsErr: true, Arg2: []byte("err"), Arg3: []byte(fmt.Sprint(n))}, nil
+		case "busy-once":
+			if n == 1 {
+				return &raw.Res{SystemErr: ErrServerBusy}, nil
+			}
+		case "large":
+			return &raw.Res{Arg2: []byte("res"), Arg3: []byte(large + fmt.Sprint(n))}, nil
+		}
+		return &raw.Res{Arg2: []byte("res"), Arg3: []byte(fmt.Sprint(n))}, nil
+	})
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	call := func(key, arg3 string) (string, bool, error) {
+		ctx, cancel := NewContextBuilder(time.Second).SetIdempotencyKey(key).Build()
+		defer cancel()
+		_, res, resp, err := raw.Call(ctx, client, server.PeerInfo().HostPort, "dedup-svc", "op", nil, []byte(arg3))
+		if err != nil {
+			return "", false, err
+		}
+		return string(res), resp.ApplicationError(), nil
+	}
+
+	tests := []struct {
+		msg       string
+		key       string
+		arg3      string
+		wantRes   string
+		wantErr   bool
+		wantCalls int32
+	}{
+		{"first call", "k1", "", "1", false, 1},
+		{"repeated call is replayed", "k1", "", "1", false, 1},
+		{"new key is handled", "k2", "", "2", false, 2},
+		{"no key is handled", "", "", "3", false, 3},
+		{"no key is not deduplicated", "", "", "4", false, 4},
+		{"application error", "k3", "app-error", "5", true, 5},
+		{"application errors are replayed", "k3", "app-error", "5", true, 5},
+		{"large response", "k5", "large", large + "6", false, 6},
+		{"large responses are not replayed", "k5", "large", large + "7", false, 7},
+	}
+
+	for _, tt := range tests {
+		res, appErr, err := call(tt.key, tt.arg3)
+		require.NoError(t, err, "%v: call failed", tt.msg)
+		assert.Equal(t, tt.wantRes, res, "%v: response mismatch", tt.msg)
+		assert.Equal(t, tt.wantErr, appErr, "%v: application error mismatch", tt.msg)
+		assert.Equal(t, tt.wantCalls, atomic.LoadInt32(&calls), "%v: handler calls mismatch", tt.msg)
+	}
+
+	// Reusing a key with a different payload is rejected.
+	_, _, err = call("k1", "other")
+	assert.True(t, errors.Is(err, ErrIdempotencyKeyReused), "reused key with a different payload should fail, got %v", err)
+	assert.Equal(t, int32(7), atomic.LoadInt32(&calls), "handler should not be called for a reused key")
+
+	// System errors are not cached, so the call can be retried.
+	atomic.StoreInt32(&calls, 0)
+	_, _, err = call("k4", "busy-once")
+	assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(err), "first call should fail")
+	res, _, err := call("k4", "busy-once")
+	require.NoError(t, err, "retry failed")
+	assert.Equal(t, "2", res, "retry should call the handler")
+}
+
+func TestDeduplicationWaitsForOriginal(t *testing.T) {
+	var calls, received int32
+	started := make(chan struct{})
+	repeated := make(chan struct{})
+	release := make(chan struct{})
+	tap := FrameTapFunc(func(event FrameEvent) {
+		if event.Direction == FrameInbound && event.MessageType == "messageTypeCallReq" &&
+			atomic.AddInt32(&received, 1) == 2 {
+			close(repeated)
+		}
+	})
+	server, err := NewChannel("dedup-svc", &ChannelOptions{
+		Deduplication: &DeduplicationOptions{},
+		FrameTap:      &FrameTapOptions{Tap: tap},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer server.Close()
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+
+	testutils.RegisterFunc(t, server, "op", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+			<-release
+		}
+		return &raw.Res{Arg3: []byte("original")}, nil
+	})
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	results := make(chan string, 2)
+	call := func() {
+		ctx, cancel := NewContextBuilder(time.Second).SetIdempotencyKey("key").Build()
+		defer cancel()
+		_, res, _, err := raw.Call(ctx, client, server.PeerInfo().HostPort, "dedup-svc", "op", nil, nil)
+		assert.NoError(t, err, "call failed")
+		results <- string(res)
+	}
+
+	go call()
+	<-started
+	go call()
+
+	// The original call completes once the repeated call has reached the server.
+	<-repeated
+	close(release)
+	assert.Equal(t, "original", <-results, "response mismatch")
+	assert.Equal(t, "original", <-results, "response mismatch")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "handler should only be called once")
+}
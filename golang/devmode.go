@@ -0,0 +1,109 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const defaultDevModeMaxTimeout = time.Minute
+
+// DevModeOptions enable checks that reject outbound calls that misuse contexts, so that
+// mistakes are caught in development rather than causing incidents in production.
+// Rejected calls fail with a bad request error, and are logged at error level along
+// with the call site.
+type DevModeOptions struct {
+	// MaxTimeout is the longest timeout that a call's context may have. Calls with
+	// longer timeouts are usually a mistake, such as passing a count of seconds as a
+	// time.Duration. Defaults to 1 minute.
+	MaxTimeout time.Duration
+
+	// AllowMissingMetadata allows calls with contexts that were not created using
+	// NewContext or a ContextBuilder, which do not propagate tracing or call options.
+	AllowMissingMetadata bool
+}
+
+// devMode checks outbound calls for misuse.
+type devMode struct {
+	opts DevModeOptions
+	log  Logger
+}
+
+func newDevMode(opts *DevModeOptions, log Logger) *devMode {
+	if opts == nil {
+		return nil
+	}
+
+	d := &devMode{opts: *opts, log: log}
+	if d.opts.MaxTimeout <= 0 {
+		d.opts.MaxTimeout = defaultDevModeMaxTimeout
+	}
+	return d
+}
+
+// checkCall returns an error if the context for a call to the given service and
+// operation is misused.
+func (d *devMode) checkCall(ctx context.Context, serviceName, operation string) error {
+	if d == nil {
+		return nil
+	}
+
+	var problem string
+	deadline, ok := ctx.Deadline()
+	switch {
+	case !ok:
+		problem = "has no deadline, use tchannel.NewContext to set a timeout"
+	case deadline.Sub(timeNow()) > d.opts.MaxTimeout:
+		problem = fmt.Sprintf("has a timeout of %v, which is longer than the maximum of %v",
+			deadline.Sub(timeNow()), d.opts.MaxTimeout)
+	case getTChannelParams(ctx) == nil && !d.opts.AllowMissingMetadata:
+		problem = "is missing tchannel metadata, use tchannel.NewContext or a ContextBuilder to create it"
+	default:
+		return nil
+	}
+
+	msg := fmt.Sprintf("dev mode: the context for the call to %v::%v %v", serviceName, operation, problem)
+	d.log.Errorf("%v (called from %v)", msg, callSite())
+	return NewSystemError(ErrCodeBadRequest, msg)
+}
+
+// callSite returns the location of the first caller outside of the tchannel packages.
+func callSite() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	for _, pc := range pcs[:n] {
+		f := runtime.FuncForPC(pc - 1)
+		if f == nil {
+			continue
+		}
+		if name := f.Name(); strings.HasPrefix(name, "github.com/uber/tchannel/golang.") ||
+			strings.HasPrefix(name, "github.com/uber/tchannel/golang/") {
+			continue
+		}
+		file, line := f.FileLine(pc - 1)
+		return fmt.Sprintf("%s:%d", file, line)
+	}
+	return "unknown"
+}
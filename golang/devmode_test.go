@@ -0,0 +1,114 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestDevMode(t *testing.T) {
+	server, err := testutils.NewServer(nil)
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+	server.Register(raw.Wrap(newTestHandler(t)), "echo")
+	hostPort := server.PeerInfo().HostPort
+	serviceName := server.PeerInfo().ServiceName
+
+	var logs SyncBuffer
+	client, err := NewChannel("dev-client", &ChannelOptions{
+		Logger:  NewLogger(&logs),
+		DevMode: &DevModeOptions{MaxTimeout: 10 * time.Second},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	tests := []struct {
+		msg     string
+		ctx     func() (context.Context, context.CancelFunc)
+		wantErr string
+	}{
+		{
+			msg: "tchannel context",
+			ctx: func() (context.Context, context.CancelFunc) { return NewContext(time.Second) },
+		},
+		{
+			msg:     "no deadline",
+			ctx:     func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) },
+			wantErr: "has no deadline",
+		},
+		{
+			msg:     "long deadline",
+			ctx:     func() (context.Context, context.CancelFunc) { return NewContext(time.Hour) },
+			wantErr: "longer than the maximum of 10s",
+		},
+		{
+			msg: "missing metadata",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Second)
+			},
+			wantErr: "missing tchannel metadata",
+		},
+	}
+
+	var rejected int
+	for _, tt := range tests {
+		ctx, cancel := tt.ctx()
+		_, _, _, err := raw.Call(ctx, client, hostPort, serviceName, "echo", testArg2, testArg3)
+		cancel()
+
+		if tt.wantErr == "" {
+			assert.NoError(t, err, "%v: call failed", tt.msg)
+			continue
+		}
+		require.Error(t, err, "%v: call should fail", tt.msg)
+		rejected++
+		assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(err), "%v: unexpected error code", tt.msg)
+		assert.True(t, strings.Contains(err.Error(), tt.wantErr), "%v: unexpected error %v", tt.msg, err)
+		assert.Equal(t, rejected, strings.Count(logs.String(), "devmode_test.go:"),
+			"%v: log should include the call site, got %v", tt.msg, logs.String())
+	}
+}
+
+func TestDevModeAllowMissingMetadata(t *testing.T) {
+	WithVerifiedServer(t, nil, func(server *Channel, hostPort string) {
+		server.Register(raw.Wrap(newTestHandler(t)), "echo")
+
+		client, err := NewChannel("dev-client", &ChannelOptions{
+			DevMode: &DevModeOptions{AllowMissingMetadata: true},
+		})
+		require.NoError(t, err, "NewChannel failed")
+		defer client.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, _, _, err = raw.Call(ctx, client, hostPort, server.PeerInfo().ServiceName, "echo", testArg2, testArg3)
+		assert.NoError(t, err, "call without tchannel metadata should be allowed")
+	})
+}
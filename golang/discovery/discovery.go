@@ -0,0 +1,129 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// Package discovery registers channels in a key-value store such as etcd or ZooKeeper,
+// and keeps the peers of a SubChannel in sync with the instances registered for its service.
+//
+// Each instance is registered under the key <prefix>/<service>/<host:port>, with the
+// host:port as the value.
+package discovery
+
+import (
+	"errors"
+	"io"
+	"net"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/uber/tchannel/golang"
+)
+
+const (
+	// DefaultPrefix is the default key prefix for registered services.
+	DefaultPrefix = "/tchannel/services"
+
+	defaultTTL = 30 * time.Second
+)
+
+var errNotListening = errors.New("channel must be listening on a specific host:port to be registered")
+
+// Store is a key-value store used to register and discover instances.
+type Store interface {
+	// Register stores the value under the key until the returned Closer is closed. The
+	// registration is renewed in the background, and expires if it is not renewed for
+	// the TTL, such as when the process exits.
+	Register(key, value string, ttl time.Duration) (io.Closer, error)
+
+	// Watch calls onChange with the values of all keys directly under the directory dir,
+	// initially and whenever they change, until the returned Closer is closed.
+	Watch(dir string, onChange func(values []string)) (io.Closer, error)
+}
+
+// Options configure registration and discovery.
+type Options struct {
+	// Prefix is the key prefix that services are registered under. Defaults to DefaultPrefix.
+	Prefix string
+
+	// TTL is the time after which registrations expire if they are not renewed.
+	// Defaults to 30 seconds.
+	TTL time.Duration
+}
+
+func (o *Options) prefix() string {
+	if o == nil || o.Prefix == "" {
+		return DefaultPrefix
+	}
+	return o.Prefix
+}
+
+func (o *Options) ttl() time.Duration {
+	if o == nil || o.TTL <= 0 {
+		return defaultTTL
+	}
+	return o.TTL
+}
+
+// Register registers the channel's host:port under its service name, until the returned
+// Closer is closed. The channel must be listening.
+func Register(ch *tchannel.Channel, store Store, opts *Options) (io.Closer, error) {
+	hostPort := ch.PeerInfo().HostPort
+	host, _, err := net.SplitHostPort(hostPort)
+	if err != nil || host == "" || net.ParseIP(host).IsUnspecified() {
+		return nil, errNotListening
+	}
+
+	key := path.Join(opts.prefix(), ch.ServiceName(), hostPort)
+	return store.Register(key, hostPort, opts.ttl())
+}
+
+// WatchPeers keeps the SubChannel's peers in sync with the instances registered for its
+// service, until the returned Closer is closed.
+func WatchPeers(sc *tchannel.SubChannel, store Store, opts *Options) (io.Closer, error) {
+	w := &peerWatcher{peers: sc.Peers(), added: make(map[string]struct{})}
+	return store.Watch(path.Join(opts.prefix(), sc.ServiceName()), w.update)
+}
+
+// peerWatcher adds and removes peers as the registered instances change.
+type peerWatcher struct {
+	peers *tchannel.PeerList
+
+	mut   sync.Mutex
+	added map[string]struct{}
+}
+
+func (w *peerWatcher) update(hostPorts []string) {
+	w.mut.Lock()
+	defer w.mut.Unlock()
+
+	current := make(map[string]struct{}, len(hostPorts))
+	for _, hostPort := range hostPorts {
+		current[hostPort] = struct{}{}
+		if _, ok := w.added[hostPort]; !ok {
+			w.peers.Add(hostPort)
+			w.added[hostPort] = struct{}{}
+		}
+	}
+	for hostPort := range w.added {
+		if _, ok := current[hostPort]; !ok {
+			w.peers.Remove(hostPort)
+			delete(w.added, hostPort)
+		}
+	}
+}
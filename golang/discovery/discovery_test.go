@@ -0,0 +1,164 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package discovery
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+)
+
+// memStore is an in-memory Store.
+type memStore struct {
+	sync.Mutex
+	values   map[string]string
+	ttls     map[string]time.Duration
+	watchers map[string]func([]string)
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		values:   make(map[string]string),
+		ttls:     make(map[string]time.Duration),
+		watchers: make(map[string]func([]string)),
+	}
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+func (s *memStore) Register(key, value string, ttl time.Duration) (io.Closer, error) {
+	s.Lock()
+	s.values[key] = value
+	s.ttls[key] = ttl
+	s.Unlock()
+	s.notify()
+	return closerFunc(func() error {
+		s.Lock()
+		delete(s.values, key)
+		s.Unlock()
+		s.notify()
+		return nil
+	}), nil
+}
+
+func (s *memStore) Watch(dir string, onChange func([]string)) (io.Closer, error) {
+	s.Lock()
+	s.watchers[dir] = onChange
+	s.Unlock()
+	s.notify()
+	return closerFunc(func() error {
+		s.Lock()
+		delete(s.watchers, dir)
+		s.Unlock()
+		return nil
+	}), nil
+}
+
+func (s *memStore) notify() {
+	s.Lock()
+	defer s.Unlock()
+	for dir, onChange := range s.watchers {
+		var values []string
+		for k, v := range s.values {
+			if strings.HasPrefix(k, dir+"/") {
+				values = append(values, v)
+			}
+		}
+		onChange(values)
+	}
+}
+
+func getPeers(ch *tchannel.Channel) []string {
+	var peers []string
+	for hostPort := range ch.Peers().Copy() {
+		peers = append(peers, hostPort)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+func newServer(t *testing.T) *tchannel.Channel {
+	ch, err := tchannel.NewChannel("svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, ch.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	return ch
+}
+
+func TestRegister(t *testing.T) {
+	store := newMemStore()
+
+	notListening, err := tchannel.NewChannel("svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer notListening.Close()
+	_, err = Register(notListening, store, nil)
+	assert.Equal(t, errNotListening, err, "channels that are not listening cannot be registered")
+
+	server := newServer(t)
+	defer server.Close()
+	hostPort := server.PeerInfo().HostPort
+
+	closer, err := Register(server, store, &Options{Prefix: "/services", TTL: time.Minute})
+	require.NoError(t, err, "Register failed")
+	key := "/services/svc/" + hostPort
+	assert.Equal(t, map[string]string{key: hostPort}, store.values, "registered values mismatch")
+	assert.Equal(t, time.Minute, store.ttls[key], "TTL mismatch")
+
+	require.NoError(t, closer.Close(), "Close failed")
+	assert.Empty(t, store.values, "closing should deregister")
+}
+
+func TestWatchPeers(t *testing.T) {
+	store := newMemStore()
+	servers := []*tchannel.Channel{newServer(t), newServer(t)}
+	var registrations []io.Closer
+	for _, server := range servers {
+		defer server.Close()
+		closer, err := Register(server, store, nil)
+		require.NoError(t, err, "Register failed")
+		registrations = append(registrations, closer)
+	}
+
+	client, err := tchannel.NewChannel("client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+	client.Peers().Add("10.0.0.1:1")
+
+	watch, err := WatchPeers(client.GetSubChannel("svc"), store, nil)
+	require.NoError(t, err, "WatchPeers failed")
+	defer watch.Close()
+
+	want := []string{"10.0.0.1:1", servers[0].PeerInfo().HostPort, servers[1].PeerInfo().HostPort}
+	sort.Strings(want)
+	assert.Equal(t, want, getPeers(client), "peers should include registered instances")
+
+	registrations[0].Close()
+	want = []string{"10.0.0.1:1", servers[1].PeerInfo().HostPort}
+	sort.Strings(want)
+	assert.Equal(t, want, getPeers(client), "deregistered instances should be removed")
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// Package etcd implements a discovery.Store using etcd.
+package etcd
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/tchannel/golang/discovery"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+const (
+	requestTimeout = 5 * time.Second
+	retryInterval  = time.Second
+)
+
+type store struct {
+	kv      clientv3.KV
+	lease   clientv3.Lease
+	watcher clientv3.Watcher
+}
+
+// NewStore returns a discovery.Store that keeps registrations alive using etcd leases.
+func NewStore(client *clientv3.Client) discovery.Store {
+	return &store{kv: client.KV, lease: client.Lease, watcher: client.Watcher}
+}
+
+type registration struct {
+	s      *store
+	key    string
+	value  string
+	ttl    int64
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mut     sync.Mutex
+	leaseID clientv3.LeaseID
+	done    chan struct{}
+}
+
+// Register puts the key with a lease that is renewed until the registration is closed.
+// If the lease is lost, such as after a network partition, the key is registered again.
+func (s *store) Register(key, value string, ttl time.Duration) (io.Closer, error) {
+	ttlSecs := int64(ttl / time.Second)
+	if ttlSecs < 1 {
+		ttlSecs = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &registration{s: s, key: key, value: value, ttl: ttlSecs, ctx: ctx, cancel: cancel, done: make(chan struct{})}
+	keepAlive, err := r.register()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	go r.keepAlive(keepAlive)
+	return r, nil
+}
+
+func (r *registration) register() (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	ctx, cancel := context.WithTimeout(r.ctx, requestTimeout)
+	defer cancel()
+
+	lease, err := r.s.lease.Grant(ctx, r.ttl)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.s.kv.Put(ctx, r.key, r.value, clientv3.WithLease(lease.ID)); err != nil {
+		return nil, err
+	}
+
+	r.mut.Lock()
+	r.leaseID = lease.ID
+	r.mut.Unlock()
+	return r.s.lease.KeepAlive(r.ctx, lease.ID)
+}
+
+func (r *registration) keepAlive(keepAlive <-chan *clientv3.LeaseKeepAliveResponse) {
+	defer close(r.done)
+	for {
+		// The channel is closed when the lease expires or the registration is closed.
+		for range keepAlive {
+		}
+
+		for {
+			select {
+			case <-r.ctx.Done():
+				return
+			case <-time.After(retryInterval):
+			}
+
+			var err error
+			if keepAlive, err = r.register(); err == nil {
+				break
+			}
+		}
+	}
+}
+
+// Close stops renewing the lease and revokes it, which deletes the key.
+func (r *registration) Close() error {
+	r.cancel()
+	<-r.done
+
+	r.mut.Lock()
+	leaseID := r.leaseID
+	r.mut.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	_, err := r.s.lease.Revoke(ctx, leaseID)
+	return err
+}
+
+type watch struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Watch gets all keys under the directory, and then watches for changes from the
+// revision that was read.
+func (s *store) Watch(dir string, onChange func(values []string)) (io.Closer, error) {
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	resp, err := s.kv.Get(ctx, prefix, clientv3.WithPrefix())
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	for _, kv := range resp.Kvs {
+		values[string(kv.Key)] = string(kv.Value)
+	}
+	onChange(sortedValues(values))
+
+	ctx, cancel = context.WithCancel(context.Background())
+	w := &watch{cancel: cancel, done: make(chan struct{})}
+	events := s.watcher.Watch(ctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+	go func() {
+		defer close(w.done)
+		for resp := range events {
+			if len(resp.Events) == 0 {
+				continue
+			}
+			for _, ev := range resp.Events {
+				if ev.Type == clientv3.EventTypeDelete {
+					delete(values, string(ev.Kv.Key))
+				} else {
+					values[string(ev.Kv.Key)] = string(ev.Kv.Value)
+				}
+			}
+			onChange(sortedValues(values))
+		}
+	}()
+	return w, nil
+}
+
+// Close stops the watch.
+func (w *watch) Close() error {
+	w.cancel()
+	<-w.done
+	return nil
+}
+
+func sortedValues(values map[string]string) []string {
+	sorted := make([]string, 0, len(values))
+	for _, v := range values {
+		sorted = append(sorted, v)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
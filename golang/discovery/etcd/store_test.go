@@ -0,0 +1,204 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package etcd
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/net/context"
+)
+
+// fakeEtcd implements the parts of the etcd client used by the store. Calls to any
+// other methods panic on the nil embedded interfaces.
+type fakeEtcd struct {
+	clientv3.KV
+	clientv3.Lease
+	clientv3.Watcher
+
+	sync.Mutex
+	values     map[string]string
+	leases     map[string]clientv3.LeaseID
+	nextLease  clientv3.LeaseID
+	keepAlives map[clientv3.LeaseID]chan *clientv3.LeaseKeepAliveResponse
+	watchCh    chan clientv3.WatchResponse
+	watchRev   int64
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{
+		values:     make(map[string]string),
+		leases:     make(map[string]clientv3.LeaseID),
+		keepAlives: make(map[clientv3.LeaseID]chan *clientv3.LeaseKeepAliveResponse),
+		watchCh:    make(chan clientv3.WatchResponse),
+	}
+}
+
+func (f *fakeEtcd) store() *store {
+	return &store{kv: f, lease: f, watcher: f}
+}
+
+func (f *fakeEtcd) Close() error { return nil }
+
+func (f *fakeEtcd) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	f.nextLease++
+	return &clientv3.LeaseGrantResponse{ID: f.nextLease, TTL: ttl}, nil
+}
+
+func (f *fakeEtcd) KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	ch := make(chan *clientv3.LeaseKeepAliveResponse)
+	f.Lock()
+	f.keepAlives[id] = ch
+	f.Unlock()
+	go func() {
+		<-ctx.Done()
+		f.expire(id)
+	}()
+	return ch, nil
+}
+
+// expire closes the keep alive channel for the lease, and deletes its keys.
+func (f *fakeEtcd) expire(id clientv3.LeaseID) {
+	f.Lock()
+	defer f.Unlock()
+	if ch, ok := f.keepAlives[id]; ok {
+		close(ch)
+		delete(f.keepAlives, id)
+	}
+	for k, leaseID := range f.leases {
+		if leaseID == id {
+			delete(f.values, k)
+			delete(f.leases, k)
+		}
+	}
+}
+
+func (f *fakeEtcd) Revoke(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	f.expire(id)
+	return &clientv3.LeaseRevokeResponse{}, nil
+}
+
+func (f *fakeEtcd) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	// The store always puts keys with the most recently granted lease.
+	f.values[key] = val
+	f.leases[key] = f.nextLease
+	return &clientv3.PutResponse{}, nil
+}
+
+func (f *fakeEtcd) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	f.Lock()
+	defer f.Unlock()
+	resp := &clientv3.GetResponse{Header: &pb.ResponseHeader{Revision: 10}}
+	for k, v := range f.values {
+		if strings.HasPrefix(k, key) {
+			resp.Kvs = append(resp.Kvs, &mvccpb.KeyValue{Key: []byte(k), Value: []byte(v)})
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeEtcd) Watch(ctx context.Context, key string, opts ...clientv3.OpOption) clientv3.WatchChan {
+	op := clientv3.OpGet(key, opts...)
+	f.Lock()
+	f.watchRev = op.Rev()
+	f.Unlock()
+
+	ch := make(chan clientv3.WatchResponse)
+	go func() {
+		defer close(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case resp := <-f.watchCh:
+				ch <- resp
+			}
+		}
+	}()
+	return ch
+}
+
+func (f *fakeEtcd) getValues() map[string]string {
+	f.Lock()
+	defer f.Unlock()
+	values := make(map[string]string)
+	for k, v := range f.values {
+		values[k] = v
+	}
+	return values
+}
+
+func TestRegister(t *testing.T) {
+	fake := newFakeEtcd()
+	closer, err := fake.store().Register("/svc/1.1.1.1:1", "1.1.1.1:1", 10*time.Second)
+	require.NoError(t, err, "Register failed")
+	assert.Equal(t, map[string]string{"/svc/1.1.1.1:1": "1.1.1.1:1"}, fake.getValues(), "key should be registered")
+
+	require.NoError(t, closer.Close(), "Close failed")
+	assert.Empty(t, fake.getValues(), "Close should revoke the lease")
+}
+
+func TestRegisterLeaseLost(t *testing.T) {
+	fake := newFakeEtcd()
+	closer, err := fake.store().Register("/svc/1.1.1.1:1", "1.1.1.1:1", 10*time.Second)
+	require.NoError(t, err, "Register failed")
+	defer closer.Close()
+
+	fake.expire(1)
+	assert.Empty(t, fake.getValues(), "key should be deleted when the lease expires")
+
+	for i := 0; i < 50 && len(fake.getValues()) == 0; i++ {
+		time.Sleep(50 * time.Millisecond)
+	}
+	assert.Equal(t, map[string]string{"/svc/1.1.1.1:1": "1.1.1.1:1"}, fake.getValues(), "key should be registered again")
+}
+
+func TestWatch(t *testing.T) {
+	fake := newFakeEtcd()
+	fake.values["/svc/1.1.1.1:1"] = "1.1.1.1:1"
+	fake.values["/svc2/2.2.2.2:2"] = "2.2.2.2:2"
+
+	changes := make(chan []string, 1)
+	closer, err := fake.store().Watch("/svc", func(values []string) { changes <- values })
+	require.NoError(t, err, "Watch failed")
+	defer closer.Close()
+
+	assert.Equal(t, []string{"1.1.1.1:1"}, <-changes, "initial values should only include keys in the directory")
+	fake.Lock()
+	assert.Equal(t, int64(11), fake.watchRev, "watch should start after the revision that was read")
+	fake.Unlock()
+
+	fake.watchCh <- clientv3.WatchResponse{Events: []*clientv3.Event{
+		{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{Key: []byte("/svc/3.3.3.3:3"), Value: []byte("3.3.3.3:3")}},
+		{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: []byte("/svc/1.1.1.1:1")}},
+	}}
+	assert.Equal(t, []string{"3.3.3.3:3"}, <-changes, "values should be updated from events")
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// Package zookeeper implements a discovery.Store using ZooKeeper.
+package zookeeper
+
+import (
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+	"github.com/uber/tchannel/golang/discovery"
+)
+
+const retryInterval = time.Second
+
+// Conn is the subset of *zk.Conn used by the store.
+type Conn interface {
+	Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error)
+	Delete(path string, version int32) error
+	ExistsW(path string) (bool, *zk.Stat, <-chan zk.Event, error)
+	ChildrenW(path string) ([]string, *zk.Stat, <-chan zk.Event, error)
+	Get(path string) ([]byte, *zk.Stat, error)
+}
+
+type store struct {
+	conn Conn
+	acl  []zk.ACL
+}
+
+// NewStore returns a discovery.Store that registers instances as ephemeral nodes.
+// Ephemeral nodes are deleted when the ZooKeeper session expires, so the TTL passed
+// to Register is not used: the session timeout passed to zk.Connect is used instead.
+func NewStore(conn Conn) discovery.Store {
+	return &store{conn: conn, acl: zk.WorldACL(zk.PermAll)}
+}
+
+// createPath creates any missing persistent nodes for the given path.
+func (s *store) createPath(p string) error {
+	cur := ""
+	for _, part := range strings.Split(strings.Trim(p, "/"), "/") {
+		cur += "/" + part
+		if _, err := s.conn.Create(cur, nil, 0, s.acl); err != nil && err != zk.ErrNodeExists {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *store) createEphemeral(key, value string) error {
+	if err := s.createPath(path.Dir(key)); err != nil {
+		return err
+	}
+	_, err := s.conn.Create(key, []byte(value), zk.FlagEphemeral, s.acl)
+	if err == zk.ErrNodeExists {
+		// The node may belong to a previous session that has not expired yet.
+		// It is recreated by the watch once it is deleted.
+		err = nil
+	}
+	return err
+}
+
+type registration struct {
+	s     *store
+	key   string
+	value string
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	done      chan struct{}
+}
+
+// Register creates an ephemeral node for the key, and creates it again if it is
+// deleted, such as when the session expires, until the registration is closed.
+func (s *store) Register(key, value string, ttl time.Duration) (io.Closer, error) {
+	if err := s.createEphemeral(key, value); err != nil {
+		return nil, err
+	}
+
+	r := &registration{s: s, key: key, value: value, closed: make(chan struct{}), done: make(chan struct{})}
+	go r.watch()
+	return r, nil
+}
+
+func (r *registration) watch() {
+	defer close(r.done)
+	for {
+		exists, _, events, err := r.s.conn.ExistsW(r.key)
+		if err == nil && !exists {
+			err = r.s.createEphemeral(r.key, r.value)
+		}
+		if err != nil {
+			select {
+			case <-r.closed:
+				return
+			case <-time.After(retryInterval):
+			}
+			continue
+		}
+		if !exists {
+			// Set a watch on the node that was just created.
+			continue
+		}
+
+		select {
+		case <-r.closed:
+			return
+		case <-events:
+		}
+	}
+}
+
+// Close stops watching the node and deletes it.
+func (r *registration) Close() error {
+	r.closeOnce.Do(func() { close(r.closed) })
+	<-r.done
+
+	if err := r.s.conn.Delete(r.key, -1); err != nil && err != zk.ErrNoNode {
+		return err
+	}
+	return nil
+}
+
+type watch struct {
+	closeOnce sync.Once
+	closed    chan struct{}
+	done      chan struct{}
+}
+
+// Watch gets the values of the children of the directory whenever they change. The
+// directory is created if it does not exist.
+func (s *store) Watch(dir string, onChange func(values []string)) (io.Closer, error) {
+	dir = strings.TrimSuffix(dir, "/")
+	if err := s.createPath(dir); err != nil {
+		return nil, err
+	}
+
+	values, events, err := s.children(dir)
+	if err != nil {
+		return nil, err
+	}
+	onChange(values)
+
+	w := &watch{closed: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		for {
+			select {
+			case <-w.closed:
+				return
+			case <-events:
+			}
+
+			for {
+				values, events, err = s.children(dir)
+				if err == nil {
+					break
+				}
+				select {
+				case <-w.closed:
+					return
+				case <-time.After(retryInterval):
+				}
+			}
+			onChange(values)
+		}
+	}()
+	return w, nil
+}
+
+func (s *store) children(dir string) ([]string, <-chan zk.Event, error) {
+	children, _, events, err := s.conn.ChildrenW(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := make([]string, 0, len(children))
+	for _, child := range children {
+		data, _, err := s.conn.Get(path.Join(dir, child))
+		if err == zk.ErrNoNode {
+			// Deleted since the children were listed, the watch will fire again.
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		values = append(values, string(data))
+	}
+	sort.Strings(values)
+	return values, events, nil
+}
+
+// Close stops the watch.
+func (w *watch) Close() error {
+	w.closeOnce.Do(func() { close(w.closed) })
+	<-w.done
+	return nil
+}
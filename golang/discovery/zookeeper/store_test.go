@@ -0,0 +1,206 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package zookeeper
+
+import (
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConn is an in-memory ZooKeeper tree.
+type fakeConn struct {
+	sync.Mutex
+	nodes     map[string][]byte
+	ephemeral map[string]bool
+	watches   map[string][]chan zk.Event
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{
+		nodes:     map[string][]byte{"/": nil},
+		ephemeral: make(map[string]bool),
+		watches:   make(map[string][]chan zk.Event),
+	}
+}
+
+// fire triggers and removes the watches on p. It must be called with the lock held.
+func (c *fakeConn) fire(p string, eventType zk.EventType) {
+	for _, ch := range c.watches[p] {
+		ch <- zk.Event{Type: eventType, Path: p}
+	}
+	delete(c.watches, p)
+}
+
+func (c *fakeConn) watch(p string) <-chan zk.Event {
+	ch := make(chan zk.Event, 1)
+	c.watches[p] = append(c.watches[p], ch)
+	return ch
+}
+
+func (c *fakeConn) Create(p string, data []byte, flags int32, acl []zk.ACL) (string, error) {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.nodes[p]; ok {
+		return "", zk.ErrNodeExists
+	}
+	if _, ok := c.nodes[path.Dir(p)]; !ok {
+		return "", zk.ErrNoNode
+	}
+	c.nodes[p] = data
+	c.ephemeral[p] = flags&zk.FlagEphemeral != 0
+	c.fire(p, zk.EventNodeCreated)
+	c.fire("children:"+path.Dir(p), zk.EventNodeChildrenChanged)
+	return p, nil
+}
+
+func (c *fakeConn) Delete(p string, version int32) error {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.nodes[p]; !ok {
+		return zk.ErrNoNode
+	}
+	delete(c.nodes, p)
+	delete(c.ephemeral, p)
+	c.fire(p, zk.EventNodeDeleted)
+	c.fire("children:"+path.Dir(p), zk.EventNodeChildrenChanged)
+	return nil
+}
+
+func (c *fakeConn) ExistsW(p string) (bool, *zk.Stat, <-chan zk.Event, error) {
+	c.Lock()
+	defer c.Unlock()
+	_, ok := c.nodes[p]
+	return ok, &zk.Stat{}, c.watch(p), nil
+}
+
+func (c *fakeConn) ChildrenW(p string) ([]string, *zk.Stat, <-chan zk.Event, error) {
+	c.Lock()
+	defer c.Unlock()
+	if _, ok := c.nodes[p]; !ok {
+		return nil, nil, nil, zk.ErrNoNode
+	}
+	var children []string
+	for node := range c.nodes {
+		if node != "/" && path.Dir(node) == p {
+			children = append(children, path.Base(node))
+		}
+	}
+	return children, &zk.Stat{}, c.watch("children:" + p), nil
+}
+
+func (c *fakeConn) Get(p string) ([]byte, *zk.Stat, error) {
+	c.Lock()
+	defer c.Unlock()
+	data, ok := c.nodes[p]
+	if !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+	return data, &zk.Stat{}, nil
+}
+
+// expireSession deletes all ephemeral nodes.
+func (c *fakeConn) expireSession() {
+	c.Lock()
+	var ephemeral []string
+	for p, ok := range c.ephemeral {
+		if ok {
+			ephemeral = append(ephemeral, p)
+		}
+	}
+	c.Unlock()
+	for _, p := range ephemeral {
+		c.Delete(p, -1)
+	}
+}
+
+func (c *fakeConn) get(p string) (string, bool) {
+	data, _, err := c.Get(p)
+	return string(data), err == nil
+}
+
+func TestRegister(t *testing.T) {
+	conn := newFakeConn()
+	closer, err := NewStore(conn).Register("/services/svc/1.1.1.1:1", "1.1.1.1:1", 0)
+	require.NoError(t, err, "Register failed")
+
+	value, ok := conn.get("/services/svc/1.1.1.1:1")
+	assert.True(t, ok, "node should be created")
+	assert.Equal(t, "1.1.1.1:1", value, "node value mismatch")
+	conn.Lock()
+	assert.True(t, conn.ephemeral["/services/svc/1.1.1.1:1"], "node should be ephemeral")
+	assert.False(t, conn.ephemeral["/services/svc"], "parent nodes should be persistent")
+	conn.Unlock()
+
+	require.NoError(t, closer.Close(), "Close failed")
+	_, ok = conn.get("/services/svc/1.1.1.1:1")
+	assert.False(t, ok, "Close should delete the node")
+}
+
+func TestWatch(t *testing.T) {
+	conn := newFakeConn()
+	store := NewStore(conn)
+	r1, err := store.Register("/services/svc/1.1.1.1:1", "1.1.1.1:1", 0)
+	require.NoError(t, err, "Register failed")
+	defer r1.Close()
+
+	changes := make(chan []string, 10)
+	closer, err := store.Watch("/services/svc/", func(values []string) { changes <- values })
+	require.NoError(t, err, "Watch failed")
+	defer closer.Close()
+	assert.Equal(t, []string{"1.1.1.1:1"}, <-changes, "initial values mismatch")
+
+	r2, err := store.Register("/services/svc/2.2.2.2:2", "2.2.2.2:2", 0)
+	require.NoError(t, err, "Register failed")
+	assert.Equal(t, []string{"1.1.1.1:1", "2.2.2.2:2"}, <-changes, "new registrations should be watched")
+
+	require.NoError(t, r2.Close(), "Close failed")
+	assert.Equal(t, []string{"1.1.1.1:1"}, <-changes, "closed registrations should be removed")
+
+	// When the session expires, the node is deleted and then registered again. The
+	// watch may or may not see the node while it is deleted.
+	conn.expireSession()
+	select {
+	case values := <-changes:
+		if len(values) == 0 {
+			values = <-changes
+		}
+		assert.Equal(t, []string{"1.1.1.1:1"}, values, "expired registrations should be created again")
+	case <-time.After(time.Second):
+		t.Fatalf("watch was not updated after the session expired")
+	}
+}
+
+func TestWatchCreatesDir(t *testing.T) {
+	conn := newFakeConn()
+	closer, err := NewStore(conn).Watch("/services/other", func(values []string) {
+		assert.Empty(t, values, "no values expected")
+	})
+	require.NoError(t, err, "Watch failed")
+	defer closer.Close()
+
+	_, ok := conn.get("/services/other")
+	assert.True(t, ok, "directory should be created")
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import "sync/atomic"
+
+// InitParamDrainNotify is sent by peers that understand drain notices, so that a
+// draining peer only sends drain notices to peers that can handle them. It is only
+// sent in an init response if the init request contained it.
+const InitParamDrainNotify = "tchannel_drain_notify"
+
+// drainNotifySupported records whether the remote peer supports drain notices.
+func (c *Connection) drainNotifySupported(params initParams) {
+	c.remoteDrainNotify = params[InitParamDrainNotify] == "1"
+}
+
+// acceptDrainNotify records whether the peer that sent an init request supports drain
+// notices, and if so, adds the init param to the response.
+func (c *Connection) acceptDrainNotify(reqParams, resParams initParams) {
+	c.drainNotifySupported(reqParams)
+	if c.remoteDrainNotify {
+		resParams[InitParamDrainNotify] = "1"
+	}
+}
+
+// sendDrainNotice tells the remote peer whether the local channel is draining, if the
+// connection is active and the peer supports drain notices.
+func (c *Connection) sendDrainNotice(draining bool) {
+	if !c.IsActive() || !c.remoteDrainNotify {
+		return
+	}
+
+	notice := &drainNotice{id: c.NextMessageID(), draining: draining}
+	if err := c.sendMessage(notice); err != nil {
+		c.log.Warnf("Failed to send drain notice to %s: %v", c.remotePeerInfo, err)
+	}
+}
+
+// handleDrainNotice records whether the remote peer is draining.
+func (c *Connection) handleDrainNotice(frame *Frame) {
+	var msg drainNotice
+	if err := frame.read(&msg); err != nil {
+		c.log.Warnf("Unable to read drain notice from %s: %v", c.remotePeerInfo, err)
+		return
+	}
+
+	var draining int32
+	if msg.draining {
+		draining = 1
+		c.log.Infof("Peer %s is draining", c.remotePeerInfo)
+	}
+	atomic.StoreInt32(&c.remoteDraining, draining)
+}
+
+// RemoteDraining returns whether the remote peer has notified that it is draining.
+func (c *Connection) RemoteDraining() bool {
+	return atomic.LoadInt32(&c.remoteDraining) == 1
+}
+
+// Draining returns whether the peer has notified that it is draining, on every active
+// connection to it. Draining peers are not selected for new calls while other peers
+// are available, but calls that are in progress can complete.
+func (p *Peer) Draining() bool {
+	active := p.getActive()
+	if len(active) == 0 {
+		return false
+	}
+	for _, c := range active {
+		if !c.RemoteDraining() {
+			return false
+		}
+	}
+	return true
+}
+
+// notifyDraining sends a drain notice on each of the channel's connections.
+func (ch *Channel) notifyDraining(draining bool) {
+	ch.mutable.mut.RLock()
+	conns := append([]*Connection(nil), ch.mutable.conns...)
+	ch.mutable.mut.RUnlock()
+
+	for _, c := range conns {
+		c.sendDrainNotice(draining)
+	}
+}
+
+// withoutDraining returns the peers that are not draining. If every peer is draining,
+// all of the peers are returned, so that calls can still be made.
+func withoutDraining(peers []*Peer) []*Peer {
+	var available []*Peer
+	for _, p := range peers {
+		if !p.Draining() {
+			available = append(available, p)
+		}
+	}
+	if len(available) == 0 {
+		return peers
+	}
+	return available
+}
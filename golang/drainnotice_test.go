@@ -0,0 +1,114 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestRemoteDraining(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	servers := make([]*Channel, 2)
+	for i := range servers {
+		server, err := testutils.NewServer(nil)
+		require.NoError(t, err, "NewServer failed")
+		defer server.Close()
+		testutils.RegisterFunc(t, server, "block", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			started <- struct{}{}
+			<-release
+			return &raw.Res{}, nil
+		})
+		servers[i] = server
+	}
+	draining, other := servers[0], servers[1]
+	serviceName := draining.PeerInfo().ServiceName
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	for _, server := range servers {
+		client.Peers().Add(server.PeerInfo().HostPort)
+		require.NoError(t, client.Ping(ctx, server.PeerInfo().HostPort), "Ping failed")
+	}
+	drainingPeer := client.Peers().GetOrAdd(draining.PeerInfo().HostPort)
+
+	// Start a call before the server drains, which should complete successfully.
+	callErr := make(chan error, 1)
+	go func() {
+		_, _, _, err := raw.Call(ctx, client, draining.PeerInfo().HostPort, serviceName, "block", nil, nil)
+		callErr <- err
+	}()
+	<-started
+
+	draining.StartDrain()
+	require.True(t, testutils.WaitFor(time.Second, drainingPeer.Draining), "peer should be draining")
+	assert.True(t, client.IntrospectState(nil).Peers[draining.PeerInfo().HostPort].Draining,
+		"introspection should report the peer as draining")
+	for i := 0; i < 20; i++ {
+		assert.Equal(t, other.PeerInfo().HostPort, client.Peers().Get().HostPort(),
+			"draining peer should not be selected")
+	}
+
+	close(release)
+	assert.NoError(t, <-callErr, "in-flight call to the draining peer failed")
+
+	// New connections to a draining channel are notified once they are active.
+	client2, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client2.Close()
+	require.NoError(t, client2.Ping(ctx, draining.PeerInfo().HostPort), "Ping failed")
+	assert.True(t, testutils.WaitFor(time.Second, client2.Peers().GetOrAdd(draining.PeerInfo().HostPort).Draining),
+		"peer should be draining for new connections")
+
+	draining.StopDrain()
+	assert.True(t, testutils.WaitFor(time.Second, func() bool { return !drainingPeer.Draining() }),
+		"peer should stop draining")
+}
+
+func TestRemoteDrainingAllPeers(t *testing.T) {
+	WithVerifiedServer(t, nil, func(server *Channel, hostPort string) {
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		client.Peers().Add(hostPort)
+		require.NoError(t, client.Ping(ctx, hostPort), "Ping failed")
+
+		server.StartDrain()
+		peer := client.Peers().GetOrAdd(hostPort)
+		require.True(t, testutils.WaitFor(time.Second, peer.Draining), "peer should be draining")
+		assert.Equal(t, peer, client.Peers().Get(), "draining peers are selected if no other peers are available")
+	})
+}
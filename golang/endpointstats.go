@@ -0,0 +1,373 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// latencyBuckets are the upper bounds of the latency histogram buckets. Latencies
+// above the last bucket are counted in an additional overflow bucket.
+var latencyBuckets = []time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	20 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	200 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// LatencyBucket is a single bucket in a latency histogram.
+type LatencyBucket struct {
+	// UpperBound is the upper bound of the bucket, or 0 for the overflow bucket.
+	UpperBound time.Duration `json:"upperBound"`
+
+	// Count is the number of calls with latency in this bucket.
+	Count int64 `json:"count"`
+}
+
+// LatencyHistogram is a snapshot of the latency distribution for an endpoint.
+type LatencyHistogram struct {
+	Count   int64           `json:"count"`
+	Sum     time.Duration   `json:"sum"`
+	Max     time.Duration   `json:"max"`
+	Buckets []LatencyBucket `json:"buckets"`
+}
+
+// EndpointStats is a snapshot of the statistics for a single endpoint.
+type EndpointStats struct {
+	Service   string `json:"service"`
+	Operation string `json:"operation"`
+
+	// Successes is the number of calls that completed without an error.
+	Successes int64 `json:"successes"`
+
+	// AppErrors is the number of calls that completed with an application error.
+	AppErrors int64 `json:"appErrors"`
+
+	// SystemErrors is the number of calls that failed, broken down by error code.
+	SystemErrors map[string]int64 `json:"systemErrors"`
+
+	// Latency is the latency distribution for all calls to the endpoint.
+	Latency LatencyHistogram `json:"latency"`
+}
+
+// endpointStats tracks statistics for a single (service, operation) pair.
+type endpointStats struct {
+	sync.Mutex
+
+	service      string
+	operation    string
+	successes    int64
+	appErrors    int64
+	systemErrors map[SystemErrCode]int64
+
+	latencyCount   int64
+	latencySum     time.Duration
+	latencyMax     time.Duration
+	latencyBuckets []int64
+}
+
+func newEndpointStats(service, operation string) *endpointStats {
+	return &endpointStats{
+		service:        service,
+		operation:      operation,
+		systemErrors:   make(map[SystemErrCode]int64),
+		latencyBuckets: make([]int64, len(latencyBuckets)+1),
+	}
+}
+
+// recordLatency records the latency of a call. The lock must be held.
+func (s *endpointStats) recordLatency(d time.Duration) {
+	s.latencyCount++
+	s.latencySum += d
+	if d > s.latencyMax {
+		s.latencyMax = d
+	}
+
+	bucket := len(latencyBuckets)
+	for i, upperBound := range latencyBuckets {
+		if d <= upperBound {
+			bucket = i
+			break
+		}
+	}
+	s.latencyBuckets[bucket]++
+}
+
+func (s *endpointStats) recordSuccess(appError bool, latency time.Duration) {
+	s.Lock()
+	if appError {
+		s.appErrors++
+	} else {
+		s.successes++
+	}
+	s.recordLatency(latency)
+	s.Unlock()
+}
+
+func (s *endpointStats) recordSystemError(code SystemErrCode, latency time.Duration) {
+	s.Lock()
+	s.systemErrors[code]++
+	s.recordLatency(latency)
+	s.Unlock()
+}
+
+// latencyPercentile returns an estimate of the given latency percentile (between 0 and 1),
+// using the upper bound of the histogram bucket that contains it, along with the number
+// of latencies recorded.
+func (s *endpointStats) latencyPercentile(p float64) (time.Duration, int64) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.latencyCount == 0 {
+		return 0, 0
+	}
+
+	target := int64(p * float64(s.latencyCount))
+	var seen int64
+	for i, count := range s.latencyBuckets {
+		seen += count
+		if seen > target && i < len(latencyBuckets) {
+			return latencyBuckets[i], s.latencyCount
+		}
+	}
+	return s.latencyMax, s.latencyCount
+}
+
+func (s *endpointStats) snapshot() EndpointStats {
+	s.Lock()
+	defer s.Unlock()
+
+	snapshot := EndpointStats{
+		Service:      s.service,
+		Operation:    s.operation,
+		Successes:    s.successes,
+		AppErrors:    s.appErrors,
+		SystemErrors: make(map[string]int64, len(s.systemErrors)),
+		Latency: LatencyHistogram{
+			Count:   s.latencyCount,
+			Sum:     s.latencySum,
+			Max:     s.latencyMax,
+			Buckets: make([]LatencyBucket, len(s.latencyBuckets)),
+		},
+	}
+	for code, count := range s.systemErrors {
+		snapshot.SystemErrors[code.MetricsKey()] = count
+	}
+	for i, count := range s.latencyBuckets {
+		var upperBound time.Duration
+		if i < len(latencyBuckets) {
+			upperBound = latencyBuckets[i]
+		}
+		snapshot.Latency.Buckets[i] = LatencyBucket{UpperBound: upperBound, Count: count}
+	}
+	return snapshot
+}
+
+type endpointStatsKey struct {
+	service   string
+	operation string
+}
+
+// endpointStatsMap tracks statistics for each endpoint in a single direction (inbound or outbound).
+type endpointStatsMap struct {
+	mut   sync.RWMutex
+	stats map[endpointStatsKey]*endpointStats
+}
+
+func newEndpointStatsMap() *endpointStatsMap {
+	return &endpointStatsMap{stats: make(map[endpointStatsKey]*endpointStats)}
+}
+
+// get returns the stats for the given endpoint, creating them if they do not exist.
+func (m *endpointStatsMap) get(service, operation string) *endpointStats {
+	key := endpointStatsKey{service, operation}
+
+	m.mut.RLock()
+	stats, ok := m.stats[key]
+	m.mut.RUnlock()
+	if ok {
+		return stats
+	}
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if stats, ok := m.stats[key]; ok {
+		return stats
+	}
+	stats = newEndpointStats(service, operation)
+	m.stats[key] = stats
+	return stats
+}
+
+// snapshot returns a snapshot of all endpoint stats, keyed by "service::operation".
+func (m *endpointStatsMap) snapshot() map[string]EndpointStats {
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+
+	snapshot := make(map[string]EndpointStats, len(m.stats))
+	for key, stats := range m.stats {
+		snapshot[key.service+"::"+key.operation] = stats.snapshot()
+	}
+	return snapshot
+}
+
+// callStatsRecorder records the outcome of a single call. Only the first outcome
+// recorded for a call is used, since a failing call may fail on multiple paths.
+type callStatsRecorder struct {
+	endpoint          *endpointStats
+	statsReporter     StatsReporter
+	metricPrefix      string
+	commonStatsTags   map[string]string
+	startedAt         time.Time
+	clock             Clock
+	log               Logger
+	slowCallThreshold time.Duration
+	remotePeer        PeerInfo
+	traceID           uint64
+	ctx               context.Context
+	sample            *callSample
+	audit             *auditCall
+	breaker           *circuitBreaker
+	recorded          uint32
+
+	// sentBytes and recvBytes are the frame payload bytes sent and received for the call.
+	sentBytes int64
+	recvBytes int64
+}
+
+// addSentBytes records the payload size of a frame sent for the call.
+func (r *callStatsRecorder) addSentBytes(n uint16) {
+	if r != nil {
+		atomic.AddInt64(&r.sentBytes, int64(n))
+	}
+}
+
+// addRecvBytes records the payload size of a frame received for the call.
+func (r *callStatsRecorder) addRecvBytes(n uint16) {
+	if r != nil {
+		atomic.AddInt64(&r.recvBytes, int64(n))
+	}
+}
+
+// tryRecord returns whether the outcome for this call should be recorded.
+func (r *callStatsRecorder) tryRecord() bool {
+	return r != nil && atomic.CompareAndSwapUint32(&r.recorded, 0, 1)
+}
+
+// recordSuccess records a call that completed, possibly with an application error.
+func (r *callStatsRecorder) recordSuccess(appError bool, latency time.Duration) {
+	if !r.tryRecord() {
+		return
+	}
+
+	if r.endpoint != nil {
+		r.endpoint.recordSuccess(appError, latency)
+	}
+	outcome := "success"
+	if appError {
+		outcome = "app-error"
+	}
+	r.checkSlowCall(latency, outcome)
+	r.sample.finish(outcome, latency)
+	r.audit.finish(r.startedAt, outcome, latency)
+	r.breaker.success()
+}
+
+// recordError records a call that failed with the given error.
+func (r *callStatsRecorder) recordError(err error) {
+	if !r.tryRecord() {
+		return
+	}
+
+	class := ErrorClass(err)
+	code := class.Code
+
+	// Calls that fail before they are dispatched have no latency.
+	var latency time.Duration
+	if !r.startedAt.IsZero() {
+		latency = r.clock.Now().Sub(r.startedAt)
+	}
+	if r.endpoint != nil {
+		r.endpoint.recordSystemError(code, latency)
+	}
+
+	tags := make(map[string]string, len(r.commonStatsTags)+1)
+	for k, v := range r.commonStatsTags {
+		tags[k] = v
+	}
+	tags["type"] = code.MetricsKey()
+	r.statsReporter.IncCounter(r.metricPrefix+".calls.system-errors", tags, 1)
+	r.checkSlowCall(latency, code.MetricsKey())
+	r.sample.finish(code.MetricsKey(), latency)
+	r.audit.finish(r.startedAt, code.MetricsKey(), latency)
+	r.breaker.failure(class)
+}
+
+// checkSlowCall logs and counts the call if it took longer than the slow call threshold.
+func (r *callStatsRecorder) checkSlowCall(latency time.Duration, outcome string) {
+	if r.slowCallThreshold <= 0 || latency < r.slowCallThreshold || r.endpoint == nil {
+		return
+	}
+
+	// For inbound calls, the request is received and the response is sent.
+	requestBytes, responseBytes := atomic.LoadInt64(&r.sentBytes), atomic.LoadInt64(&r.recvBytes)
+	if r.metricPrefix == "inbound" {
+		requestBytes, responseBytes = responseBytes, requestBytes
+	}
+
+	r.log.WithFields(
+		LogField{"service", r.endpoint.service},
+		LogField{"operation", r.endpoint.operation},
+		LogField{"peer", r.remotePeer},
+		LogField{"requestBytes", requestBytes},
+		LogField{"responseBytes", responseBytes},
+		LogField{"traceID", r.traceID},
+		LogField{"requestID", CurrentRequestID(r.ctx)},
+		LogField{"outcome", outcome},
+	).Warnf("Slow %v call took %v (threshold %v)", r.metricPrefix, latency, r.slowCallThreshold)
+	r.statsReporter.IncCounter(r.metricPrefix+".calls.slow", r.commonStatsTags, 1)
+}
+
+// getContextError converts context errors, including wrapped context errors, into the
+// corresponding SystemError.
+func getContextError(err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrTimeout
+	case errors.Is(err, context.Canceled):
+		return ErrRequestCancelled
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+)
+
+func TestEndpointStats(t *testing.T) {
+	clientStats := newRecordingStatsReporter()
+	serverStats := newRecordingStatsReporter()
+	WithVerifiedServer(t, &testutils.ChannelOpts{StatsReporter: serverStats}, func(serverCh *Channel, hostPort string) {
+		handler := raw.Wrap(newTestHandler(t))
+		for _, op := range []string{"echo", "app-error", "busy"} {
+			serverCh.Register(handler, op)
+		}
+
+		ch, err := testutils.NewClient(&testutils.ChannelOpts{StatsReporter: clientStats})
+		require.NoError(t, err, "NewClient failed")
+		defer ch.Close()
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		for i := 0; i < 3; i++ {
+			_, _, _, err := raw.Call(ctx, ch, hostPort, testServiceName, "echo", nil, nil)
+			require.NoError(t, err, "echo failed")
+		}
+		_, _, _, err = raw.Call(ctx, ch, hostPort, testServiceName, "app-error", nil, nil)
+		require.NoError(t, err, "app-error failed")
+		_, _, _, err = raw.Call(ctx, ch, hostPort, testServiceName, "busy", nil, nil)
+		require.Equal(t, ErrCodeBusy, GetSystemErrorCode(err), "busy should return a busy error")
+
+		key := func(op string) string { return testServiceName + "::" + op }
+
+		// The server records stats after the response is sent, so wait for the stats to be updated.
+		require.True(t, testutils.WaitFor(time.Second, func() bool {
+			inbound := serverCh.IntrospectState(nil).InboundEndpoints
+			return inbound[key("echo")].Successes == 3 && inbound[key("app-error")].AppErrors == 1
+		}), "server stats were not updated")
+		for _, state := range []*RuntimeState{
+			ch.IntrospectState(nil),
+			serverCh.IntrospectState(nil),
+		} {
+			endpoints := state.OutboundEndpoints
+			if state.LocalPeer.ServiceName == testServiceName {
+				endpoints = state.InboundEndpoints
+			}
+
+			echo := endpoints[key("echo")]
+			assert.Equal(t, int64(3), echo.Successes, "echo successes mismatch")
+			assert.Equal(t, int64(3), echo.Latency.Count, "echo latency count mismatch")
+			var bucketTotal int64
+			for _, b := range echo.Latency.Buckets {
+				bucketTotal += b.Count
+			}
+			assert.Equal(t, int64(3), bucketTotal, "echo latency buckets mismatch")
+
+			appErr := endpoints[key("app-error")]
+			assert.Equal(t, int64(0), appErr.Successes, "app-error successes mismatch")
+			assert.Equal(t, int64(1), appErr.AppErrors, "app-error errors mismatch")
+
+			busy := endpoints[key("busy")]
+			assert.Equal(t, map[string]int64{"busy": 1}, busy.SystemErrors, "busy system errors mismatch")
+			assert.Equal(t, int64(1), busy.Latency.Count, "busy latency count mismatch")
+		}
+
+		outboundTags := tagsForOutboundCall(serverCh, ch, "busy")
+		outboundTags["type"] = "busy"
+		assert.Equal(t, int64(1), clientStats.getStat("outbound.calls.system-errors", outboundTags).count,
+			"outbound system-errors counter mismatch")
+		inboundTags := tagsForInboundCall(serverCh, ch, "busy")
+		inboundTags["type"] = "busy"
+		assert.Equal(t, int64(1), serverStats.getStat("inbound.calls.system-errors", inboundTags).count,
+			"inbound system-errors counter mismatch")
+	})
+}
+
+func TestSystemErrCodeMetricsKey(t *testing.T) {
+	assert.Equal(t, "timeout", ErrCodeTimeout.MetricsKey())
+	assert.Equal(t, "bad-request", ErrCodeBadRequest.MetricsKey())
+	assert.Equal(t, "unknown-16", SystemErrCode(16).MetricsKey())
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrKind is the broad category of an error.
+type ErrKind int
+
+const (
+	// ErrKindSystem is a SystemError, either sent by the remote peer or created locally,
+	// including errors for calls that timed out or were cancelled.
+	ErrKindSystem ErrKind = iota + 1
+
+	// ErrKindNetwork is an error with the connection to the remote peer.
+	ErrKindNetwork
+
+	// ErrKindApplication is any other error, such as an application error from a format package.
+	ErrKindApplication
+)
+
+// ErrFault is the party responsible for an error.
+type ErrFault int
+
+const (
+	// ErrFaultServer is an error caused by the server or the network, such as an overloaded
+	// or failing server. These errors should be alerted on by the server's owners.
+	ErrFaultServer ErrFault = iota + 1
+
+	// ErrFaultClient is an error caused by the caller, such as an invalid or cancelled request.
+	ErrFaultClient
+)
+
+// ErrClass is the classification of an error, used for retry and alerting decisions.
+type ErrClass struct {
+	Kind ErrKind
+
+	// Code is the system error code that the error is reported as.
+	Code SystemErrCode
+
+	// Retryable is whether the call can be retried with any retry policy, as the request was
+	// not processed. Calls that failed with an unexpected error or timed out may have been
+	// processed, so whether they are retried depends on the RetryOn option.
+	Retryable bool
+
+	Fault ErrFault
+}
+
+// ApplicationError is implemented by the errors that call helpers return when the handler
+// marked its response as an application error, such as raw.ErrAppError and
+// json.ErrApplication. The call was processed by the handler, so these errors are not
+// retried, and do not count as failures of the server.
+type ApplicationError interface {
+	error
+
+	// ApplicationError returns whether the error is an application error response.
+	ApplicationError() bool
+}
+
+// IsApplicationError returns whether err is an application error response from a handler,
+// rather than a system error or a failure to make the call.
+func IsApplicationError(err error) bool {
+	appErr, ok := err.(ApplicationError)
+	return ok && appErr.ApplicationError()
+}
+
+// ErrorClassifierFunc classifies an error, returning false if the error is not recognized.
+type ErrorClassifierFunc func(err error) (ErrClass, bool)
+
+var errorClassifiers struct {
+	sync.RWMutex
+	funcs []ErrorClassifierFunc
+}
+
+// RegisterErrorClassifier registers a classifier that is used by ErrorClass before the default
+// classification, so applications can classify their own errors. Classifiers are used in the
+// order they are registered.
+func RegisterErrorClassifier(f ErrorClassifierFunc) {
+	errorClassifiers.Lock()
+	errorClassifiers.funcs = append(errorClassifiers.funcs, f)
+	errorClassifiers.Unlock()
+}
+
+// ErrorClass returns the classification of the given error, which is used for retries, circuit
+// breakers and stats. It returns the zero ErrClass if err is nil.
+func ErrorClass(err error) ErrClass {
+	if err == nil {
+		return ErrClass{}
+	}
+
+	errorClassifiers.RLock()
+	funcs := errorClassifiers.funcs
+	errorClassifiers.RUnlock()
+	for _, f := range funcs {
+		if class, ok := f(err); ok {
+			return class
+		}
+	}
+
+	return defaultErrorClass(err)
+}
+
+func defaultErrorClass(err error) ErrClass {
+	if IsApplicationError(err) {
+		// The handler processed the call and chose to fail it, which says nothing about the
+		// health of the server.
+		return ErrClass{Kind: ErrKindApplication, Code: ErrCodeUnexpected, Fault: ErrFaultClient}
+	}
+
+	// Context errors are checked first as they may also implement net.Error.
+	ctxErr := getContextError(err)
+	if ctxErr == err && isConnectionError(err) {
+		return ErrClass{Kind: ErrKindNetwork, Code: ErrCodeNetwork, Retryable: true, Fault: ErrFaultServer}
+	}
+
+	var se SystemError
+	if !errors.As(ctxErr, &se) {
+		return ErrClass{Kind: ErrKindApplication, Code: ErrCodeUnexpected, Fault: ErrFaultServer}
+	}
+
+	class := ErrClass{Kind: ErrKindSystem, Code: se.Code(), Fault: ErrFaultServer}
+	switch class.Code {
+	case ErrCodeBusy, ErrCodeDeclined, ErrCodeNetwork:
+		class.Retryable = true
+	case ErrCodeBadRequest, ErrCodeCancelled:
+		class.Fault = ErrFaultClient
+	}
+	return class
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel/golang/json"
+	"github.com/uber/tchannel/golang/raw"
+	"golang.org/x/net/context"
+)
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrClass
+	}{
+		{nil, ErrClass{}},
+		{ErrConnectionClosed, ErrClass{Kind: ErrKindNetwork, Code: ErrCodeNetwork, Retryable: true, Fault: ErrFaultServer}},
+		{ErrServerBusy, ErrClass{Kind: ErrKindSystem, Code: ErrCodeBusy, Retryable: true, Fault: ErrFaultServer}},
+		{ErrCircuitOpen, ErrClass{Kind: ErrKindSystem, Code: ErrCodeDeclined, Retryable: true, Fault: ErrFaultServer}},
+		{ErrTimeout, ErrClass{Kind: ErrKindSystem, Code: ErrCodeTimeout, Fault: ErrFaultServer}},
+		{context.DeadlineExceeded, ErrClass{Kind: ErrKindSystem, Code: ErrCodeTimeout, Fault: ErrFaultServer}},
+		{context.Canceled, ErrClass{Kind: ErrKindSystem, Code: ErrCodeCancelled, Fault: ErrFaultClient}},
+		{NewSystemError(ErrCodeBadRequest, "bad"), ErrClass{Kind: ErrKindSystem, Code: ErrCodeBadRequest, Fault: ErrFaultClient}},
+		{NewSystemError(ErrCodeProtocol, "protocol"), ErrClass{Kind: ErrKindSystem, Code: ErrCodeProtocol, Fault: ErrFaultServer}},
+		{errors.New("app"), ErrClass{Kind: ErrKindApplication, Code: ErrCodeUnexpected, Fault: ErrFaultServer}},
+		{raw.ErrAppError, ErrClass{Kind: ErrKindApplication, Code: ErrCodeUnexpected, Fault: ErrFaultClient}},
+		{json.ErrApplication{}, ErrClass{Kind: ErrKindApplication, Code: ErrCodeUnexpected, Fault: ErrFaultClient}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ErrorClass(tt.err), "ErrorClass(%v) mismatch", tt.err)
+	}
+}
+
+type quotaError struct{}
+
+func (quotaError) Error() string { return "quota exceeded" }
+
+func TestRegisterErrorClassifier(t *testing.T) {
+	RegisterErrorClassifier(func(err error) (ErrClass, bool) {
+		if _, ok := err.(quotaError); !ok {
+			return ErrClass{}, false
+		}
+		return ErrClass{Kind: ErrKindApplication, Code: ErrCodeBusy, Retryable: true, Fault: ErrFaultClient}, true
+	})
+
+	class := ErrorClass(quotaError{})
+	assert.Equal(t, ErrCodeBusy, class.Code, "Custom classifier not used")
+	assert.Equal(t, ErrFaultClient, class.Fault, "Custom classifier not used")
+	assert.True(t, RetryDefault.CanRetry(quotaError{}), "Retries should use the custom classification")
+
+	assert.Equal(t, ErrKindApplication, ErrorClass(errors.New("other")).Kind, "Unmatched errors should use the default")
+	assert.False(t, RetryDefault.CanRetry(errors.New("other")), "Unmatched errors should not be retried")
+}
+
+func TestIsApplicationError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New("app"), false},
+		{ErrServerBusy, false},
+		{raw.ErrAppError, true},
+		{json.ErrApplication{"type": "error"}, true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, IsApplicationError(tt.err), "IsApplicationError(%v) mismatch", tt.err)
+		if tt.want {
+			for _, r := range []RetryOn{RetryDefault, RetryUnexpected, RetryIdempotent} {
+				assert.False(t, r.CanRetry(tt.err), "application error %v should not be retried with %v", tt.err, r)
+			}
+		}
+	}
+}
@@ -21,7 +21,9 @@
 package tchannel
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 )
 
 const (
@@ -73,6 +75,33 @@ const (
 	ErrCodeProtocol SystemErrCode = 0xFF
 )
 
+// MetricsKey is a string representation of the error code that's suitable for
+// inclusion in metrics tags.
+func (c SystemErrCode) MetricsKey() string {
+	switch c {
+	case ErrCodeInvalid:
+		return "invalid"
+	case ErrCodeTimeout:
+		return "timeout"
+	case ErrCodeCancelled:
+		return "cancelled"
+	case ErrCodeBusy:
+		return "busy"
+	case ErrCodeDeclined:
+		return "declined"
+	case ErrCodeUnexpected:
+		return "unexpected-error"
+	case ErrCodeBadRequest:
+		return "bad-request"
+	case ErrCodeNetwork:
+		return "network-error"
+	case ErrCodeProtocol:
+		return "protocol-error"
+	default:
+		return fmt.Sprintf("unknown-%d", int(c))
+	}
+}
+
 var (
 	// ErrServerBusy is a SystemError indicating the server is busy
 	ErrServerBusy = NewSystemError(ErrCodeBusy, "server busy")
@@ -100,6 +129,32 @@ type SystemError struct {
 	code    SystemErrCode
 	msg     string
 	wrapped error
+
+	// requestID is the request ID of the call on the peer that sent the error.
+	requestID string
+}
+
+// requestIDSuffix is appended to the message of error frames sent for inbound calls,
+// so that callers can correlate errors with the peer's logs.
+const requestIDSuffix = " (request ID %v)"
+
+// withRequestID returns the message to send in an error frame for a call with the given
+// request ID.
+func withRequestID(msg, requestID string) string {
+	if requestID == "" {
+		return msg
+	}
+	return msg + fmt.Sprintf(requestIDSuffix, requestID)
+}
+
+// newPeerSystemError returns the SystemError for an error frame received from a peer,
+// with the request ID removed from the message.
+func newPeerSystemError(code SystemErrCode, msg string) SystemError {
+	prefix := strings.SplitN(requestIDSuffix, "%", 2)[0]
+	if i := strings.LastIndex(msg, prefix); i >= 0 && strings.HasSuffix(msg, ")") {
+		return SystemError{code: code, msg: msg[:i], requestID: msg[i+len(prefix) : len(msg)-1]}
+	}
+	return SystemError{code: code, msg: msg}
 }
 
 // NewSystemError defines a new SystemError with a code and message
@@ -112,23 +167,94 @@ func NewWrappedSystemError(code SystemErrCode, wrapped error) error {
 	return SystemError{code: code, msg: fmt.Sprintf("sys err %x: %s", code, wrapped.Error()), wrapped: wrapped}
 }
 
+// newCausedSystemError returns a SystemError with the given code and message that
+// wraps cause. The cause is appended to the message if it is non-nil.
+func newCausedSystemError(code SystemErrCode, msg string, cause error) error {
+	if cause != nil {
+		if msg == "" {
+			msg = cause.Error()
+		} else {
+			msg = msg + ": " + cause.Error()
+		}
+	}
+	return SystemError{code: code, msg: msg, wrapped: cause}
+}
+
+// NewTimeoutError returns a SystemError with ErrCodeTimeout, caused by the given error which may be nil.
+func NewTimeoutError(msg string, cause error) error {
+	return newCausedSystemError(ErrCodeTimeout, msg, cause)
+}
+
+// NewCancelledError returns a SystemError with ErrCodeCancelled, caused by the given error which may be nil.
+func NewCancelledError(msg string, cause error) error {
+	return newCausedSystemError(ErrCodeCancelled, msg, cause)
+}
+
+// NewBusyError returns a SystemError with ErrCodeBusy, caused by the given error which may be nil.
+func NewBusyError(msg string, cause error) error {
+	return newCausedSystemError(ErrCodeBusy, msg, cause)
+}
+
+// NewDeclinedError returns a SystemError with ErrCodeDeclined, caused by the given error which may be nil.
+func NewDeclinedError(msg string, cause error) error {
+	return newCausedSystemError(ErrCodeDeclined, msg, cause)
+}
+
+// NewUnexpectedError returns a SystemError with ErrCodeUnexpected, caused by the given error which may be nil.
+func NewUnexpectedError(msg string, cause error) error {
+	return newCausedSystemError(ErrCodeUnexpected, msg, cause)
+}
+
+// NewBadRequestError returns a SystemError with ErrCodeBadRequest, caused by the given error which may be nil.
+func NewBadRequestError(msg string, cause error) error {
+	return newCausedSystemError(ErrCodeBadRequest, msg, cause)
+}
+
+// NewNetworkError returns a SystemError with ErrCodeNetwork, caused by the given error which may be nil.
+func NewNetworkError(msg string, cause error) error {
+	return newCausedSystemError(ErrCodeNetwork, msg, cause)
+}
+
+// NewProtocolError returns a SystemError with ErrCodeProtocol, caused by the given error which may be nil.
+func NewProtocolError(msg string, cause error) error {
+	return newCausedSystemError(ErrCodeProtocol, msg, cause)
+}
+
 // Error returns the SystemError message, conforming to the error interface
 func (se SystemError) Error() string {
-	return se.msg
+	return withRequestID(se.msg, se.requestID)
+}
+
+// RequestID returns the request ID of the call on the peer that returned the error,
+// or "" if the error was not received from a peer.
+func (se SystemError) RequestID() string { return se.requestID }
+
+// Is returns whether target is a SystemError with the same code and message, so that
+// errors received from a peer match the predefined errors using errors.Is, regardless
+// of their request ID.
+func (se SystemError) Is(target error) bool {
+	t, ok := target.(SystemError)
+	return ok && t.requestID == "" && t.wrapped == nil && se.code == t.code && se.msg == t.msg
 }
 
 // Wrapped returns the wrapped error
 func (se SystemError) Wrapped() error { return se.wrapped }
 
+// Unwrap returns the error that caused the SystemError, so that errors.Is and errors.As
+// can match the cause. Causes are not sent to peers, so errors received from a peer
+// have no cause.
+func (se SystemError) Unwrap() error { return se.wrapped }
+
 // Code returns the SystemError code, for sending to a peer
 func (se SystemError) Code() SystemErrCode {
 	return se.code
 }
 
-// GetSystemErrorCode returns the code to report for the given error.  If the error is a SystemError, we can
-// get the code directly.  Otherwise treat it as an unexpected error
+// GetSystemErrorCode returns the code to report for the given error.  If the error is, or wraps,
+// a SystemError, we can get the code directly.  Otherwise treat it as an unexpected error
 func GetSystemErrorCode(err error) SystemErrCode {
-	if se, ok := err.(SystemError); ok {
+	var se SystemError
+	if errors.As(err, &se) {
 		return se.Code()
 	}
 
@@ -0,0 +1,79 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystemErrorConstructors(t *testing.T) {
+	cause := io.ErrUnexpectedEOF
+	tests := []struct {
+		newErr func(msg string, cause error) error
+		code   SystemErrCode
+	}{
+		{NewTimeoutError, ErrCodeTimeout},
+		{NewCancelledError, ErrCodeCancelled},
+		{NewBusyError, ErrCodeBusy},
+		{NewDeclinedError, ErrCodeDeclined},
+		{NewUnexpectedError, ErrCodeUnexpected},
+		{NewBadRequestError, ErrCodeBadRequest},
+		{NewNetworkError, ErrCodeNetwork},
+		{NewProtocolError, ErrCodeProtocol},
+	}
+
+	for _, tt := range tests {
+		err := tt.newErr("failed", cause)
+		assert.Equal(t, tt.code, GetSystemErrorCode(err), "unexpected code")
+		assert.Equal(t, "failed: unexpected EOF", err.Error(), "unexpected message")
+		assert.True(t, errors.Is(err, cause), "errors.Is should match the cause")
+		assert.Equal(t, cause, errors.Unwrap(err), "Unwrap should return the cause")
+
+		var se SystemError
+		assert.True(t, errors.As(err, &se), "errors.As should match SystemError")
+		assert.Equal(t, tt.code, se.Code(), "unexpected code from errors.As")
+
+		err = tt.newErr("failed", nil)
+		assert.Equal(t, "failed", err.Error(), "unexpected message without a cause")
+		assert.Nil(t, errors.Unwrap(err), "Unwrap should return nil without a cause")
+
+		err = tt.newErr("", cause)
+		assert.Equal(t, cause.Error(), err.Error(), "message should be the cause without a message")
+	}
+}
+
+func TestWrappedSystemErrors(t *testing.T) {
+	busy := NewBusyError("queue full", nil)
+	wrapped := fmt.Errorf("call failed: %w", busy)
+	assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(wrapped), "code should be found through wrapping")
+	assert.Equal(t, ErrClass{Kind: ErrKindSystem, Code: ErrCodeBusy, Retryable: true, Fault: ErrFaultServer},
+		ErrorClass(wrapped), "wrapped SystemError should be classified by its code")
+	assert.True(t, errors.Is(NewWrappedSystemError(ErrCodeNetwork, io.EOF), io.EOF),
+		"NewWrappedSystemError should unwrap to the wrapped error")
+	assert.True(t, errors.Is(wrapped, busy), "errors.Is should match the SystemError")
+	assert.Equal(t, ErrCodeUnexpected, GetSystemErrorCode(errors.New("other")), "non-SystemErrors are unexpected")
+}
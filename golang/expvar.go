@@ -0,0 +1,180 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"expvar"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// ExpvarName is the name of the expvar variable that contains the state of all channels.
+const ExpvarName = "tchannel"
+
+var (
+	publishExpvarOnce sync.Once
+
+	// channelRegistry tracks all channels that have not been closed, keyed by channel ID.
+	channelRegistry = struct {
+		sync.RWMutex
+		channels map[uint32]*Channel
+	}{channels: make(map[uint32]*Channel)}
+)
+
+// FramePoolStats contains statistics on frame pool usage.
+type FramePoolStats struct {
+	// Gets is the number of frames retrieved from the pool.
+	Gets uint64 `json:"gets"`
+
+	// Releases is the number of frames released back to the pool.
+	Releases uint64 `json:"releases"`
+
+	// Outstanding is the number of frames that have not been released yet.
+	Outstanding int64 `json:"outstanding"`
+}
+
+// ChannelGauges are the gauges for a channel that are published using expvar.
+type ChannelGauges struct {
+	LocalPeer LocalPeerInfo `json:"localPeer"`
+
+	// Connections is the number of connections that are not closed.
+	Connections int `json:"connections"`
+
+	// InboundCalls is the number of inbound calls that are in progress.
+	InboundCalls int `json:"inboundCalls"`
+
+	// OutboundCalls is the number of outbound calls that are in progress.
+	OutboundCalls int `json:"outboundCalls"`
+
+	// SendQueueDepth is the number of frames waiting to be written across all connections.
+	SendQueueDepth int `json:"sendQueueDepth"`
+
+	// SendQueueCapacity is the total send buffer capacity across all connections.
+	SendQueueCapacity int `json:"sendQueueCapacity"`
+
+	// FramePool contains statistics for the channel's default frame pool.
+	FramePool FramePoolStats `json:"framePool"`
+
+	// LeakedExchanges is the number of leaked message exchanges reported by the leak detector.
+	LeakedExchanges int64 `json:"leakedExchanges"`
+
+	// ConcurrencyLimit is the current adaptive limit on concurrent inbound calls, or 0 if
+	// the channel does not have a concurrency limiter.
+	ConcurrencyLimit int `json:"concurrencyLimit"`
+
+	// ConcurrencyQueued is the number of inbound calls waiting for the concurrency limiter.
+	ConcurrencyQueued int `json:"concurrencyQueued"`
+
+	// Throughput is the bytes sent and received over all of the channel's connections,
+	// including connections that have been closed.
+	Throughput Throughput `json:"throughput"`
+}
+
+// PublishExpvar publishes the gauges for all channels in this process using expvar
+// under ExpvarName. It is safe to call PublishExpvar multiple times.
+func PublishExpvar() {
+	publishExpvarOnce.Do(func() {
+		expvar.Publish(ExpvarName, expvar.Func(expvarChannels))
+	})
+}
+
+// expvarChannels returns the gauges for all registered channels, keyed by channel ID.
+func expvarChannels() interface{} {
+	channelRegistry.RLock()
+	defer channelRegistry.RUnlock()
+
+	m := make(map[string]ChannelGauges, len(channelRegistry.channels))
+	for id, ch := range channelRegistry.channels {
+		m[strconv.Itoa(int(id))] = ch.Gauges()
+	}
+	return m
+}
+
+func registerChannel(ch *Channel) {
+	channelRegistry.Lock()
+	channelRegistry.channels[ch.chID] = ch
+	channelRegistry.Unlock()
+}
+
+func unregisterChannel(ch *Channel) {
+	channelRegistry.Lock()
+	delete(channelRegistry.channels, ch.chID)
+	channelRegistry.Unlock()
+}
+
+// Gauges returns the current values of the channel's gauges.
+func (ch *Channel) Gauges() ChannelGauges {
+	ch.mutable.mut.RLock()
+	gauges := ChannelGauges{LocalPeer: ch.mutable.peerInfo}
+	for _, c := range ch.mutable.conns {
+		gauges.Throughput = gauges.Throughput.add(c.Throughput())
+		if c.readState() == connectionClosed {
+			continue
+		}
+		gauges.Connections++
+		gauges.InboundCalls += c.inbound.count()
+		gauges.OutboundCalls += c.outbound.count()
+		gauges.SendQueueDepth += len(c.sendCh)
+		gauges.SendQueueCapacity += cap(c.sendCh)
+	}
+	ch.mutable.mut.RUnlock()
+
+	gauges.FramePool = ch.framePoolStats.stats()
+	gauges.LeakedExchanges = ch.leakDetector.leakedExchanges()
+	gauges.ConcurrencyLimit, gauges.ConcurrencyQueued = ch.inboundLimiter.currentLimit()
+	return gauges
+}
+
+// statsFramePool wraps a FramePool to track the number of frames retrieved and released.
+type statsFramePool struct {
+	FramePool
+
+	gets     uint64
+	releases uint64
+}
+
+func newStatsFramePool(pool FramePool) *statsFramePool {
+	if pool == nil {
+		pool = DefaultFramePool
+	}
+	return &statsFramePool{FramePool: pool}
+}
+
+func (p *statsFramePool) Get() *Frame {
+	atomic.AddUint64(&p.gets, 1)
+	return p.FramePool.Get()
+}
+
+func (p *statsFramePool) Release(f *Frame) {
+	atomic.AddUint64(&p.releases, 1)
+	p.FramePool.Release(f)
+}
+
+func (p *statsFramePool) stats() FramePoolStats {
+	gets := atomic.LoadUint64(&p.gets)
+	releases := atomic.LoadUint64(&p.releases)
+	return FramePoolStats{
+		Gets:        gets,
+		Releases:    releases,
+		Outstanding: int64(gets) - int64(releases),
+	}
+}
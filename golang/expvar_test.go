@@ -0,0 +1,150 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"runtime/pprof"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestGauges(t *testing.T) {
+	WithVerifiedServer(t, nil, func(ch *Channel, hostPort string) {
+		inHandler := make(chan struct{})
+		unblock := make(chan struct{})
+		testutils.RegisterFunc(t, ch, "block", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			inHandler <- struct{}{}
+			<-unblock
+			return &raw.Res{}, nil
+		})
+
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		callDone := make(chan struct{})
+		go func() {
+			defer close(callDone)
+			_, _, _, err := raw.Call(ctx, client, hostPort, testServiceName, "block", nil, nil)
+			assert.NoError(t, err, "Call failed")
+		}()
+		<-inHandler
+
+		serverGauges := ch.Gauges()
+		assert.Equal(t, ch.PeerInfo(), serverGauges.LocalPeer, "LocalPeer mismatch")
+		assert.Equal(t, 1, serverGauges.Connections, "Connections mismatch")
+		assert.Equal(t, 1, serverGauges.InboundCalls, "InboundCalls mismatch")
+		assert.Equal(t, 0, serverGauges.OutboundCalls, "OutboundCalls mismatch")
+		assert.True(t, serverGauges.SendQueueCapacity > 0, "SendQueueCapacity should be set")
+		assert.True(t, serverGauges.FramePool.Gets > 0, "frames should have been retrieved")
+
+		clientGauges := client.Gauges()
+		assert.Equal(t, 1, clientGauges.OutboundCalls, "OutboundCalls mismatch")
+
+		close(unblock)
+		<-callDone
+	})
+}
+
+func TestPublishExpvar(t *testing.T) {
+	PublishExpvar()
+	// Publishing multiple times should not panic.
+	PublishExpvar()
+
+	ch, err := testutils.NewClient(&testutils.ChannelOpts{ServiceName: "expvar-client"})
+	require.NoError(t, err, "NewClient failed")
+
+	findChannel := func() bool {
+		v := expvar.Get(ExpvarName)
+		require.NotNil(t, v, "expvar not published")
+
+		var channels map[string]ChannelGauges
+		require.NoError(t, json.Unmarshal([]byte(v.String()), &channels), "Unmarshal failed")
+		for _, gauges := range channels {
+			if gauges.LocalPeer == ch.PeerInfo() {
+				return true
+			}
+		}
+		return false
+	}
+
+	assert.True(t, findChannel(), "channel not found in expvar")
+	ch.Close()
+	assert.False(t, findChannel(), "closed channel should be removed from expvar")
+}
+
+func TestRegisterProfiles(t *testing.T) {
+	RegisterProfiles()
+	// Registering multiple times should not panic.
+	RegisterProfiles()
+
+	profile := pprof.Lookup(ExchangesProfileName)
+	require.NotNil(t, profile, "exchanges profile not registered")
+	require.NotNil(t, pprof.Lookup(SendBlockedProfileName), "send-blocked profile not registered")
+
+	WithVerifiedServer(t, nil, func(ch *Channel, hostPort string) {
+		inHandler := make(chan struct{})
+		unblock := make(chan struct{})
+		testutils.RegisterFunc(t, ch, "block", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			inHandler <- struct{}{}
+			<-unblock
+			return &raw.Res{}, nil
+		})
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		before := profile.Count()
+		callDone := make(chan struct{})
+		go func() {
+			defer close(callDone)
+			_, _, _, err := raw.Call(ctx, ch, hostPort, testServiceName, "block", nil, nil)
+			assert.NoError(t, err, "Call failed")
+		}()
+		<-inHandler
+
+		// There should be an inbound and outbound exchange for the call.
+		assert.Equal(t, before+2, profile.Count(), "exchanges profile count mismatch")
+		var buf bytes.Buffer
+		require.NoError(t, profile.WriteTo(&buf, 1), "WriteTo failed")
+		assert.Contains(t, buf.String(), "beginCall", "profile should contain the stack of the outbound call")
+
+		close(unblock)
+		<-callDone
+		assert.True(t, testutils.WaitFor(time.Second, func() bool {
+			return profile.Count() == before
+		}), "exchanges should be removed from the profile")
+	})
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import "golang.org/x/net/context"
+
+// FallbackFunc returns a degraded response, such as a cached response, for a call to the
+// given operation that failed with err. The returned arguments are used in place of the
+// response arguments of the failed call. If fallbackErr is non-nil, it is returned to the
+// caller instead of a response.
+type FallbackFunc func(ctx context.Context, operation string, err error) (arg2, arg3 []byte, fallbackErr error)
+
+// SetFallback sets the fallback for calls made using the subchannel. The fallback is used
+// by helpers such as raw.CallSC when a call fails after exhausting its retries, or because
+// the circuit breaker for the peer is open.
+func (c *SubChannel) SetFallback(f FallbackFunc) {
+	c.fallbackMut.Lock()
+	c.fallback = f
+	c.fallbackMut.Unlock()
+}
+
+// Fallback returns the fallback response for a call to the given operation that failed with
+// err. ok is false if there is no fallback, or if err is not an error that the fallback is
+// used for, in which case err is returned unchanged.
+func (c *SubChannel) Fallback(ctx context.Context, operation string, err error) (arg2, arg3 []byte, ok bool, fallbackErr error) {
+	c.fallbackMut.RLock()
+	f := c.fallback
+	c.fallbackMut.RUnlock()
+
+	if f == nil || !usesFallback(ctx, err) {
+		return nil, nil, false, err
+	}
+
+	tags := c.StatsTags()
+	tags["target-endpoint"] = operation
+	c.statsReporter.IncCounter("outbound.calls.fallback", tags, 1)
+
+	arg2, arg3, fallbackErr = f(ctx, operation, err)
+	return arg2, arg3, true, fallbackErr
+}
+
+// usesFallback returns whether a call that failed with err should use the fallback. This is
+// the case if the circuit breaker was open, or if the error could have been retried using the
+// context's retry options, in which case the retries have been exhausted.
+func usesFallback(ctx context.Context, err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == ErrCircuitOpen {
+		return true
+	}
+
+	opts := currentRetryOptions(ctx)
+	if opts == nil {
+		opts = defaultRetryOptions
+	}
+	return opts.RetryOn.CanRetry(err)
+}
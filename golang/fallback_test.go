@@ -0,0 +1,126 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+// cachedFallback is a fallback that returns a fixed response, and records the errors it is called for.
+func cachedFallback(errs *[]error) FallbackFunc {
+	return func(ctx context.Context, operation string, err error) ([]byte, []byte, error) {
+		*errs = append(*errs, err)
+		return []byte("cached-" + operation), []byte("cached"), nil
+	}
+}
+
+func TestFallbackAfterRetries(t *testing.T) {
+	var calls int32
+	server := newRetryServer(t, &calls, ErrServerBusy)
+	defer server.Close()
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+	sc := client.GetSubChannel("retry-svc")
+	sc.Peers().Add(server.PeerInfo().HostPort)
+
+	ctx, cancel := NewContextBuilder(time.Second).
+		SetRetryOptions(&RetryOptions{MaxAttempts: 2, BackoffBase: time.Millisecond}).
+		Build()
+	defer cancel()
+
+	_, _, _, err = raw.CallSC(ctx, sc, "op", nil, nil)
+	assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(err), "calls should fail without a fallback")
+
+	var fallbackErrs []error
+	sc.SetFallback(cachedFallback(&fallbackErrs))
+	arg2, arg3, resp, err := raw.CallSC(ctx, sc, "op", nil, nil)
+	require.NoError(t, err, "CallSC should use the fallback")
+	assert.Equal(t, "cached-op", string(arg2), "arg2 mismatch")
+	assert.Equal(t, "cached", string(arg3), "arg3 mismatch")
+	assert.Nil(t, resp, "response should be nil when the fallback is used")
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls), "each call should be retried")
+	require.Len(t, fallbackErrs, 1, "fallback should be called once")
+	assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(fallbackErrs[0]), "fallback error mismatch")
+}
+
+func TestFallbackNotUsedForNonRetryableErrors(t *testing.T) {
+	var calls int32
+	server := newRetryServer(t, &calls, NewSystemError(ErrCodeBadRequest, "bad request"))
+	defer server.Close()
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+	sc := client.GetSubChannel("retry-svc")
+	sc.Peers().Add(server.PeerInfo().HostPort)
+
+	var fallbackErrs []error
+	sc.SetFallback(cachedFallback(&fallbackErrs))
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	_, _, _, err = raw.CallSC(ctx, sc, "op", nil, nil)
+	assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(err), "bad requests should not use the fallback")
+	assert.Empty(t, fallbackErrs, "fallback should not be called")
+}
+
+func TestFallbackWhenCircuitOpen(t *testing.T) {
+	var calls int32
+	server := newRetryServer(t, &calls, ErrServerBusy)
+	defer server.Close()
+
+	client, err := NewChannel("retry-client", &ChannelOptions{
+		CircuitBreaker: &CircuitBreakerOptions{MinRequests: 1, OpenDuration: time.Minute},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+	sc := client.GetSubChannel("retry-svc")
+	sc.Peers().Add(server.PeerInfo().HostPort)
+
+	var fallbackErrs []error
+	sc.SetFallback(cachedFallback(&fallbackErrs))
+
+	ctx, cancel := NewContextBuilder(time.Second).
+		SetRetryOptions(&RetryOptions{RetryOn: RetryNever}).
+		Build()
+	defer cancel()
+
+	_, _, _, err = raw.CallSC(ctx, sc, "op", nil, nil)
+	assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(err), "errors that are not retried should not use the fallback")
+
+	_, arg3, _, err := raw.CallSC(ctx, sc, "op", nil, nil)
+	require.NoError(t, err, "CallSC should use the fallback once the circuit is open")
+	assert.Equal(t, "cached", string(arg3), "arg3 mismatch")
+	require.Len(t, fallbackErrs, 1, "fallback should be called once")
+	assert.Equal(t, ErrCircuitOpen, fallbackErrs[0], "fallback error mismatch")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "calls should not be sent while the circuit is open")
+}
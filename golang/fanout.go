@@ -0,0 +1,174 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// FanOutOptions are the options used to configure FanOut.
+type FanOutOptions struct {
+	// CallTimeout is the budget for each call. Calls are always limited by the deadline of
+	// the fan-out's context, which is used if this is zero.
+	CallTimeout time.Duration
+
+	// MaxConcurrent is the maximum number of calls that are made concurrently. Defaults to
+	// making a call to every target concurrently.
+	MaxConcurrent int
+
+	// MinSuccesses is the number of successful calls after which the remaining calls are
+	// canceled, for queries that only need a quorum of responses. Defaults to waiting for
+	// every call.
+	MinSuccesses int
+}
+
+// FanOutFunc makes a call to a single target, such as a host:port or a shard key, and
+// returns the response.
+type FanOutFunc func(ctx context.Context, target string) (interface{}, error)
+
+// FanOutResult is the result of the call to a single target.
+type FanOutResult struct {
+	Target   string
+	Response interface{}
+	Err      error
+	Duration time.Duration
+}
+
+// FanOutResults are the results of a fan-out, in the same order as the targets. Targets
+// whose calls were not started before the fan-out completed have ErrTimeout or
+// ErrRequestCancelled as their error.
+type FanOutResults struct {
+	Results []FanOutResult
+}
+
+// Successes returns the results of the calls that succeeded.
+func (r *FanOutResults) Successes() []FanOutResult {
+	var successes []FanOutResult
+	for _, res := range r.Results {
+		if res.Err == nil {
+			successes = append(successes, res)
+		}
+	}
+	return successes
+}
+
+// Errors returns the errors of the calls that failed, keyed by target.
+func (r *FanOutResults) Errors() map[string]error {
+	errs := make(map[string]error)
+	for _, res := range r.Results {
+		if res.Err != nil {
+			errs[res.Target] = res.Err
+		}
+	}
+	return errs
+}
+
+// Complete returns whether every call succeeded.
+func (r *FanOutResults) Complete() bool {
+	for _, res := range r.Results {
+		if res.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// FanOut calls f for each target concurrently, for scatter-gather queries where a partial
+// result is preferred over failing the whole query. The fan-out completes once every call
+// has completed, the context's deadline passes, or opts.MinSuccesses calls have succeeded.
+// Errors do not cancel the other calls, and are returned in the results.
+func FanOut(ctx context.Context, targets []string, opts *FanOutOptions, f FanOutFunc) *FanOutResults {
+	if opts == nil {
+		opts = &FanOutOptions{}
+	}
+	maxConcurrent := opts.MaxConcurrent
+	if maxConcurrent <= 0 || maxConcurrent > len(targets) {
+		maxConcurrent = len(targets)
+	}
+
+	fanOutCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if headerCtx, ok := ctx.(ContextWithHeaders); ok {
+		fanOutCtx = WrapWithHeaders(fanOutCtx, headerCtx.Headers())
+	}
+
+	results := &FanOutResults{Results: make([]FanOutResult, len(targets))}
+	var (
+		wg        sync.WaitGroup
+		mut       sync.Mutex
+		successes int
+	)
+	sem := make(chan struct{}, maxConcurrent)
+	for i, target := range targets {
+		results.Results[i].Target = target
+
+		select {
+		case sem <- struct{}{}:
+		case <-fanOutCtx.Done():
+			results.Results[i].Err = getContextError(fanOutCtx.Err())
+			continue
+		}
+
+		wg.Add(1)
+		go func(res *FanOutResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			callCtx := fanOutCtx
+			if opts.CallTimeout > 0 {
+				var callCancel context.CancelFunc
+				callCtx, callCancel = context.WithTimeout(fanOutCtx, opts.CallTimeout)
+				defer callCancel()
+				if headerCtx, ok := fanOutCtx.(ContextWithHeaders); ok {
+					callCtx = WrapWithHeaders(callCtx, headerCtx.Headers())
+				}
+			}
+
+			start := time.Now()
+			res.Response, res.Err = f(callCtx, res.Target)
+			res.Duration = time.Since(start)
+
+			if res.Err == nil && opts.MinSuccesses > 0 {
+				mut.Lock()
+				successes++
+				if successes >= opts.MinSuccesses {
+					cancel()
+				}
+				mut.Unlock()
+			}
+		}(&results.Results[i])
+	}
+
+	wg.Wait()
+	return results
+}
+
+// FanOut calls f for each peer of the subchannel concurrently, see FanOut. f is passed
+// the host:port of the peer, which can be used to make a call using the Channel. The
+// results are sorted by host:port.
+func (c *SubChannel) FanOut(ctx context.Context, opts *FanOutOptions, f FanOutFunc) *FanOutResults {
+	hostPorts := c.Peers().hostPorts()
+	sort.Strings(hostPorts)
+	return FanOut(ctx, hostPorts, opts, f)
+}
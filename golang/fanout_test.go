@@ -0,0 +1,167 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestSubChannelFanOut(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	handlers := []func(ctx context.Context) (*raw.Res, error){
+		func(ctx context.Context) (*raw.Res, error) {
+			return &raw.Res{Arg3: []byte("ok")}, nil
+		},
+		func(ctx context.Context) (*raw.Res, error) {
+			return &raw.Res{SystemErr: NewSystemError(ErrCodeBadRequest, "bad request")}, nil
+		},
+		func(ctx context.Context) (*raw.Res, error) {
+			// Respond only after the call's budget has been exceeded.
+			<-release
+			return &raw.Res{Arg3: []byte("late")}, nil
+		},
+	}
+
+	var okHostPort, badHostPort, slowHostPort string
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+	sc := client.GetSubChannel("fanout-svc")
+
+	for i, h := range handlers {
+		h := h
+		server, err := testutils.NewServer(&testutils.ChannelOpts{ServiceName: "fanout-svc"})
+		require.NoError(t, err, "NewServer failed")
+		defer server.Close()
+		testutils.RegisterFunc(t, server, "query", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			return h(ctx)
+		})
+
+		hostPort := server.PeerInfo().HostPort
+		sc.Peers().Add(hostPort)
+		switch i {
+		case 0:
+			okHostPort = hostPort
+		case 1:
+			badHostPort = hostPort
+		case 2:
+			slowHostPort = hostPort
+		}
+	}
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	started := time.Now()
+	results := sc.FanOut(ctx, &FanOutOptions{CallTimeout: 100 * time.Millisecond}, func(ctx context.Context, hostPort string) (interface{}, error) {
+		_, arg3, _, err := raw.Call(ctx, client, hostPort, "fanout-svc", "query", nil, nil)
+		return string(arg3), err
+	})
+	assert.True(t, time.Since(started) < 500*time.Millisecond, "slow peer should be limited by the call budget")
+
+	require.Equal(t, 3, len(results.Results), "unexpected number of results")
+	assert.False(t, results.Complete(), "results should be partial")
+	if successes := results.Successes(); assert.Equal(t, 1, len(successes), "unexpected successes") {
+		assert.Equal(t, okHostPort, successes[0].Target, "unexpected successful target")
+		assert.Equal(t, "ok", successes[0].Response, "unexpected response")
+	}
+
+	errs := results.Errors()
+	assert.Equal(t, 2, len(errs), "unexpected errors: %v", errs)
+	assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(errs[badHostPort]), "unexpected error: %v", errs[badHostPort])
+	assert.Error(t, errs[slowHostPort], "slow peer should fail when its call budget is exceeded")
+}
+
+func TestFanOutMaxConcurrent(t *testing.T) {
+	var active, maxActive int32
+	targets := []string{"a", "b", "c", "d", "e", "f"}
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	results := FanOut(ctx, targets, &FanOutOptions{MaxConcurrent: 2}, func(ctx context.Context, target string) (interface{}, error) {
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			max := atomic.LoadInt32(&maxActive)
+			if n <= max || atomic.CompareAndSwapInt32(&maxActive, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return target, nil
+	})
+
+	assert.True(t, results.Complete(), "all calls should succeed")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxActive), "unexpected concurrency")
+	for i, res := range results.Results {
+		assert.Equal(t, targets[i], res.Target, "results should be in target order")
+		assert.Equal(t, targets[i], res.Response, "unexpected response")
+	}
+}
+
+func TestFanOutMinSuccesses(t *testing.T) {
+	targets := []string{"fast1", "fast2", "slow"}
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	started := time.Now()
+	results := FanOut(ctx, targets, &FanOutOptions{MinSuccesses: 2}, func(ctx context.Context, target string) (interface{}, error) {
+		if target == "slow" {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return target, nil
+	})
+
+	assert.True(t, time.Since(started) < 500*time.Millisecond, "fan-out should complete after enough successes")
+	assert.Equal(t, 2, len(results.Successes()), "unexpected successes")
+	assert.Equal(t, context.Canceled, results.Errors()["slow"], "slow call should be canceled")
+}
+
+func TestFanOutDeadline(t *testing.T) {
+	targets := []string{"a", "b", "c"}
+	errFailed := errors.New("failed")
+
+	ctx, cancel := NewContext(50 * time.Millisecond)
+	defer cancel()
+	results := FanOut(ctx, targets, &FanOutOptions{MaxConcurrent: 1}, func(ctx context.Context, target string) (interface{}, error) {
+		if target == "a" {
+			return nil, errFailed
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	errs := results.Errors()
+	assert.Equal(t, errFailed, errs["a"], "unexpected error for a")
+	assert.Equal(t, context.DeadlineExceeded, errs["b"], "call should fail at the deadline")
+	assert.Equal(t, ErrTimeout, errs["c"], "calls that are not started should time out")
+}
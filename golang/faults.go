@@ -0,0 +1,221 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/uber/tchannel/golang/typed"
+)
+
+var errFaultConnectionClosed = errors.New("connection closed by fault injection")
+
+// FaultOptions configure faults that are injected into a channel's connections, for
+// testing how applications behave when peers or the network misbehave. Each rate is the
+// probability, between 0 and 1, that the fault is injected for a call frame.
+type FaultOptions struct {
+	// Latency is the delay added before writing a call frame, with probability LatencyRate.
+	Latency     time.Duration
+	LatencyRate float64
+
+	// DropRate is the probability that a call frame is not written.
+	DropRate float64
+
+	// CorruptChecksumRate is the probability that the checksum of a call frame is
+	// corrupted before it is written. Frames without a checksum are not affected.
+	CorruptChecksumRate float64
+
+	// CloseRate is the probability that the connection is closed instead of writing
+	// a call frame.
+	CloseRate float64
+
+	// ErrorRate is the probability that an inbound call is not dispatched, and fails
+	// with an error frame using ErrorCode instead. ErrorCode defaults to ErrCodeUnexpected.
+	ErrorRate float64
+	ErrorCode SystemErrCode
+
+	// Peers limits faults to connections with the given remote host:ports. If it is empty,
+	// faults are injected for all connections.
+	Peers []string
+}
+
+// faultAction is the action taken for a frame that is about to be written.
+type faultAction int
+
+const (
+	faultNone faultAction = iota
+	faultDrop
+	faultClose
+)
+
+// faultInjector decides which faults to inject into a channel's connections.
+type faultInjector struct {
+	mut   sync.RWMutex
+	opts  *FaultOptions
+	peers map[string]struct{}
+	rand  *rand.Rand
+}
+
+func newFaultInjector(opts *FaultOptions) *faultInjector {
+	f := &faultInjector{rand: NewRand(time.Now().UnixNano())}
+	f.update(opts)
+	return f
+}
+
+// update replaces the injector's options. Faults are disabled if opts is nil.
+func (f *faultInjector) update(opts *FaultOptions) {
+	var peers map[string]struct{}
+	if opts != nil {
+		copied := *opts
+		opts = &copied
+		peers = make(map[string]struct{}, len(opts.Peers))
+		for _, hostPort := range opts.Peers {
+			peers[hostPort] = struct{}{}
+		}
+	}
+
+	f.mut.Lock()
+	f.opts = opts
+	f.peers = peers
+	f.mut.Unlock()
+}
+
+// forPeer returns the options for the given peer, or nil if faults are not injected for it.
+func (f *faultInjector) forPeer(hostPort string) *FaultOptions {
+	f.mut.RLock()
+	defer f.mut.RUnlock()
+
+	if f.opts == nil {
+		return nil
+	}
+	if len(f.peers) > 0 {
+		if _, ok := f.peers[hostPort]; !ok {
+			return nil
+		}
+	}
+	return f.opts
+}
+
+// chance returns true with the given probability.
+func (f *faultInjector) chance(rate float64) bool {
+	return rate > 0 && f.rand.Float64() < rate
+}
+
+// SetFaults replaces the faults injected into the channel's connections, including
+// existing connections. Faults are disabled if opts is nil.
+func (ch *Channel) SetFaults(opts *FaultOptions) {
+	ch.faults.update(opts)
+}
+
+func isCallFrame(frame *Frame) bool {
+	switch frame.Header.messageType {
+	case messageTypeCallReq, messageTypeCallReqContinue, messageTypeCallRes, messageTypeCallResContinue,
+		messageTypeCallProgress:
+		return true
+	default:
+		return false
+	}
+}
+
+// countFault increments the counter for an injected fault.
+func (c *Connection) countFault(fault string) {
+	tags := map[string]string{"fault": fault}
+	for k, v := range c.commonStatsTags {
+		tags[k] = v
+	}
+	c.statsReporter.IncCounter("connection.faults-injected", tags, 1)
+}
+
+// injectWriteFault injects faults into a frame that is about to be written, and returns
+// whether the frame should be written, dropped, or the connection closed.
+func (c *Connection) injectWriteFault(frame *Frame) faultAction {
+	if !isCallFrame(frame) {
+		return faultNone
+	}
+	opts := c.faults.forPeer(c.remotePeerInfo.HostPort)
+	if opts == nil {
+		return faultNone
+	}
+
+	if c.faults.chance(opts.LatencyRate) {
+		c.countFault("latency")
+		c.clock.Sleep(opts.Latency)
+	}
+	if c.faults.chance(opts.CloseRate) {
+		c.countFault("close")
+		return faultClose
+	}
+	if c.faults.chance(opts.DropRate) {
+		c.countFault("drop")
+		return faultDrop
+	}
+	if c.faults.chance(opts.CorruptChecksumRate) && corruptChecksum(frame) {
+		c.countFault("corrupt-checksum")
+	}
+	return faultNone
+}
+
+// injectCallError fails an inbound call request with an error frame, and returns whether
+// it did so, in which case the call should not be handled.
+func (c *Connection) injectCallError(frame *Frame) bool {
+	if frame.Header.messageType != messageTypeCallReq {
+		return false
+	}
+	opts := c.faults.forPeer(c.remotePeerInfo.HostPort)
+	if opts == nil || !c.faults.chance(opts.ErrorRate) {
+		return false
+	}
+
+	code := opts.ErrorCode
+	if code == 0 {
+		code = ErrCodeUnexpected
+	}
+	c.countFault("error")
+	c.SendSystemError(frame.Header.ID, nil, NewSystemError(code, "injected fault"))
+	return true
+}
+
+// corruptChecksum flips the bits of the first checksum byte in a call frame. It returns
+// false if the frame does not have a checksum.
+func corruptChecksum(frame *Frame) bool {
+	payload := frame.SizedPayload()
+	if len(payload) == 0 || frame.Header.messageType == messageTypeCallProgress {
+		return false
+	}
+
+	// Skip the flags byte, and the message header for the first frame of a call.
+	rbuf := typed.NewReadBuffer(payload[1:])
+	switch frame.Header.messageType {
+	case messageTypeCallReq:
+		new(callReq).read(rbuf)
+	case messageTypeCallRes:
+		new(callRes).read(rbuf)
+	}
+	checksumType := ChecksumType(rbuf.ReadSingleByte())
+	if rbuf.Err() != nil || checksumType.ChecksumSize() == 0 || rbuf.BytesRemaining() < checksumType.ChecksumSize() {
+		return false
+	}
+
+	payload[len(payload)-rbuf.BytesRemaining()] ^= 0xff
+	return true
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func setupFaultTest(t *testing.T, stats StatsReporter) (client, server *Channel, call func(timeout time.Duration) error) {
+	server, err := testutils.NewServer(&testutils.ChannelOpts{StatsReporter: stats})
+	require.NoError(t, err, "NewServer failed")
+	testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+
+	client, err = testutils.NewClient(&testutils.ChannelOpts{StatsReporter: stats})
+	require.NoError(t, err, "NewClient failed")
+
+	hostPort := server.PeerInfo().HostPort
+	call = func(timeout time.Duration) error {
+		ctx, cancel := NewContext(timeout)
+		defer cancel()
+
+		arg2, arg3, _, err := raw.Call(ctx, client, hostPort, server.PeerInfo().ServiceName, "echo", []byte("head"), []byte("body"))
+		if err == nil {
+			assert.Equal(t, "head", string(arg2), "arg2 mismatch")
+			assert.Equal(t, "body", string(arg3), "arg3 mismatch")
+		}
+		return err
+	}
+	require.NoError(t, call(time.Second), "call without faults failed")
+	return client, server, call
+}
+
+func TestFaultDrop(t *testing.T) {
+	stats := newRecordingStatsReporter()
+	client, server, call := setupFaultTest(t, stats)
+	defer server.Close()
+	defer client.Close()
+
+	client.SetFaults(&FaultOptions{DropRate: 1})
+	assert.Equal(t, context.DeadlineExceeded, call(50*time.Millisecond), "dropped calls should time out")
+
+	dropped := counterValue(stats, "connection.faults-injected")
+	assert.True(t, dropped > 0, "injected faults should be counted")
+
+	client.SetFaults(nil)
+	assert.NoError(t, call(time.Second), "calls should succeed once faults are disabled")
+}
+
+func TestFaultLatency(t *testing.T) {
+	client, server, call := setupFaultTest(t, nil)
+	defer server.Close()
+	defer client.Close()
+
+	server.SetFaults(&FaultOptions{Latency: 100 * time.Millisecond, LatencyRate: 1})
+	assert.Equal(t, context.DeadlineExceeded, call(50*time.Millisecond), "delayed calls should time out")
+	assert.NoError(t, call(time.Second), "calls with a longer timeout should succeed")
+}
+
+func TestFaultErrorFrames(t *testing.T) {
+	client, server, call := setupFaultTest(t, nil)
+	defer server.Close()
+	defer client.Close()
+
+	server.SetFaults(&FaultOptions{ErrorRate: 1, ErrorCode: ErrCodeBusy})
+	assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(call(time.Second)), "calls should fail with the injected error")
+
+	server.SetFaults(&FaultOptions{ErrorRate: 1})
+	assert.Equal(t, ErrCodeUnexpected, GetSystemErrorCode(call(time.Second)), "ErrorCode should default to unexpected")
+}
+
+func TestFaultCorruptChecksum(t *testing.T) {
+	client, server, call := setupFaultTest(t, nil)
+	defer server.Close()
+	defer client.Close()
+
+	server.SetFaults(&FaultOptions{CorruptChecksumRate: 1})
+	assert.Error(t, call(time.Second), "calls with corrupted responses should fail")
+}
+
+func TestFaultClose(t *testing.T) {
+	client, server, call := setupFaultTest(t, nil)
+	defer server.Close()
+	defer client.Close()
+
+	client.SetFaults(&FaultOptions{CloseRate: 1})
+	assert.Error(t, call(100*time.Millisecond), "calls should fail when the connection is closed")
+
+	client.SetFaults(nil)
+	assert.NoError(t, call(time.Second), "calls should succeed on a new connection")
+}
+
+func TestFaultCloseFailsCalls(t *testing.T) {
+	client, server, call := setupFaultTest(t, nil)
+	defer server.Close()
+	defer client.Close()
+
+	// Calls fail as soon as the connection is lost, rather than at their deadline.
+	client.SetFaults(&FaultOptions{CloseRate: 1})
+	started := time.Now()
+	err := call(5 * time.Second)
+	assert.Equal(t, ErrCodeNetwork, GetSystemErrorCode(err), "Unexpected error: %v", err)
+	assert.True(t, time.Since(started) < time.Second, "Call should fail before its deadline")
+}
+
+func TestFaultPeers(t *testing.T) {
+	client, server, call := setupFaultTest(t, nil)
+	defer server.Close()
+	defer client.Close()
+
+	client.SetFaults(&FaultOptions{DropRate: 1, Peers: []string{"1.1.1.1:1"}})
+	assert.NoError(t, call(time.Second), "faults should not affect other peers")
+
+	client.SetFaults(&FaultOptions{DropRate: 1, Peers: []string{server.PeerInfo().HostPort}})
+	assert.Equal(t, context.DeadlineExceeded, call(50*time.Millisecond), "faults should affect the listed peers")
+}
@@ -0,0 +1,357 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// InitParamFlowWindow is sent by peers that support flow control for streamed arguments.
+// Its value is the number of continuation frames of a message that the peer accepts
+// before it returns credits. Calls are only flow controlled if both peers send it, and it
+// is only sent in an init response if the init request contained it.
+const InitParamFlowWindow = "tchannel_flow_window"
+
+const (
+	// defaultFlowWindow is the flow control window for calls. It is less than the size of
+	// the call's receive buffer, so a flow controlled call never fills the buffer.
+	defaultFlowWindow = 64
+
+	// unlimitedCredits is sent in a window update once a message will no longer be read,
+	// so that the writer is no longer limited.
+	unlimitedCredits = math.MaxUint32
+)
+
+// ErrStreamStalled is a SystemError indicating that a streamed argument made no progress
+// within the stall timeout, as either the reader stopped consuming frames or the writer
+// could not send them.
+var ErrStreamStalled = NewSystemError(ErrCodeTimeout, "stream stalled")
+
+// StreamOptions configure flow control for calls that stream their last argument.
+type StreamOptions struct {
+	// MaxBufferedFrames is the maximum number of frames of the streamed argument that are
+	// buffered for the reader. Once the limit is reached, the reader stops returning flow
+	// control credits until it catches up, which applies backpressure to the writer. The
+	// peer may send up to a full flow control window before the reader consumes the first
+	// frame. Defaults to the flow control window, and has no effect if the peer does not
+	// support flow control.
+	MaxBufferedFrames int
+
+	// StallTimeout fails the call with ErrStreamStalled if the reader does not consume a
+	// frame, the writer cannot send a frame, or the peer stops sending the frames of a
+	// message part way through, within this duration. Defaults to the connection's
+	// StallTimeout. If neither is set, a stalled stream is only failed when the call's
+	// deadline is reached.
+	StallTimeout time.Duration
+}
+
+// flowControl tracks the credits of a flow controlled call. Each continuation frame of a
+// message uses a credit, and the reader returns credits to the writer as it consumes
+// frames, so a reader that falls behind slows down the writer rather than blocking the
+// connection or filling the call's receive buffer.
+type flowControl struct {
+	sync.Mutex
+
+	// credits is the number of continuation frames that can be sent, and creditsC is
+	// signalled when the peer returns credits.
+	credits  int64
+	creditsC chan struct{}
+
+	// window is the number of continuation frames the peer can send before it is returned
+	// credits, and limit is how many of those can be buffered. consumed and returned count
+	// the continuation frames that have been read and the credits returned for them, and
+	// finished is set once no more credits need to be returned.
+	window   int
+	limit    int
+	consumed int
+	returned int
+	finished bool
+}
+
+func newFlowControl(window, peerWindow int) *flowControl {
+	return &flowControl{
+		credits:  int64(peerWindow),
+		creditsC: make(chan struct{}, 1),
+		window:   window,
+		limit:    window,
+	}
+}
+
+// addCredits adds the credits returned by the peer and wakes up a waiting writer.
+func (f *flowControl) addCredits(credits uint32) {
+	f.Lock()
+	if credits == unlimitedCredits {
+		f.credits = math.MaxInt64
+	} else if f.credits != math.MaxInt64 {
+		f.credits += int64(credits)
+	}
+	f.Unlock()
+
+	select {
+	case f.creditsC <- struct{}{}:
+	default:
+	}
+}
+
+// takeCredit uses a credit to send a continuation frame, and returns false if there are
+// no credits left.
+func (f *flowControl) takeCredit() bool {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.credits == 0 {
+		return false
+	}
+	if f.credits != math.MaxInt64 {
+		f.credits--
+	}
+	return true
+}
+
+// frameConsumed records that the reader consumed frame, and returns the number of credits
+// to return to the peer. Credits are returned in batches to limit the number of updates.
+func (f *flowControl) frameConsumed(frame *Frame) uint32 {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.finished {
+		return 0
+	}
+	if isContinuation(frame) {
+		f.consumed++
+	}
+	if frame.Header.messageType == messageTypeError || !hasMoreFragments(frame) {
+		f.finished = true
+		return 0
+	}
+
+	// Credits are held back so that at most limit frames are buffered once the peer has
+	// used its initial window.
+	pending := f.consumed - f.returned - (f.window - f.limit)
+	if pending <= 0 || pending < f.limit/2 {
+		return 0
+	}
+	f.returned += pending
+	return uint32(pending)
+}
+
+// setLimit limits the number of frames that are buffered for the reader.
+func (f *flowControl) setLimit(limit int) {
+	f.Lock()
+	if limit < f.window {
+		f.limit = limit
+	}
+	f.Unlock()
+}
+
+// release stops returning credits, and returns whether the peer may still be waiting for
+// credits, since the message was not read completely.
+func (f *flowControl) release() bool {
+	f.Lock()
+	defer f.Unlock()
+
+	released := !f.finished
+	f.finished = true
+	return released
+}
+
+// offerFlowWindow adds the local flow control window to the init request params.
+func (c *Connection) offerFlowWindow(params initParams) {
+	if c.flowWindow > 0 {
+		params[InitParamFlowWindow] = strconv.Itoa(c.flowWindow)
+	}
+}
+
+// setFlowWindow records the flow control window of the peer, if both the local and remote
+// peers support flow control. It must be called before the connection is active.
+func (c *Connection) setFlowWindow(params initParams) {
+	if c.flowWindow == 0 {
+		return
+	}
+	peerWindow, err := strconv.Atoi(params[InitParamFlowWindow])
+	if err != nil || peerWindow <= 0 {
+		return
+	}
+	for _, mexset := range []*messageExchangeSet{&c.inbound, &c.outbound} {
+		mexset.flowWindow = c.flowWindow
+		mexset.peerFlowWindow = peerWindow
+	}
+}
+
+// acceptFlowWindow records the flow control window of the peer that sent an init request,
+// and if it supports flow control, adds the local window to the response.
+func (c *Connection) acceptFlowWindow(reqParams, resParams initParams) {
+	c.setFlowWindow(reqParams)
+	if c.inbound.peerFlowWindow > 0 {
+		c.offerFlowWindow(resParams)
+	}
+}
+
+// handleWindowUpdate adds the credits returned by the peer to the exchange writing the
+// message. Updates for exchanges that have completed are ignored.
+func (c *Connection) handleWindowUpdate(frame *Frame) {
+	msg := windowUpdate{id: frame.Header.ID}
+	if err := frame.read(&msg); err != nil {
+		c.log.Warnf("Unable to read window update from %s: %v", c.remotePeerInfo, err)
+		return
+	}
+
+	mexset := &c.inbound
+	if msg.forRequest {
+		mexset = &c.outbound
+	}
+	if mex := mexset.exchange(msg.id); mex != nil && mex.flow != nil {
+		mex.flow.addCredits(msg.credits)
+	}
+}
+
+// waitForCredit waits until the exchange can send a continuation frame. If the peer does
+// not return credits within the stall timeout, it fails with ErrStreamStalled.
+func (mex *messageExchange) waitForCredit() error {
+	if mex.flow.takeCredit() {
+		return nil
+	}
+
+	var stallC <-chan time.Time
+	if mex.stallTimeout > 0 {
+		timer := time.NewTimer(mex.stallTimeout)
+		defer timer.Stop()
+		stallC = timer.C
+	}
+	for {
+		select {
+		case <-mex.flow.creditsC:
+			if mex.flow.takeCredit() {
+				return nil
+			}
+		case <-stallC:
+			return ErrStreamStalled
+		case <-mex.ctx.Done():
+			return mex.ctx.Err()
+		case <-mex.lost:
+			return errConnectionLost
+		case <-mex.removed:
+			return errMexShutdown
+		}
+	}
+}
+
+// frameConsumed returns credits to the peer once the reader has consumed enough frames of
+// a flow controlled call, and records when the reader last consumed a buffered frame.
+func (mex *messageExchange) frameConsumed(frame *Frame) error {
+	if mex.stallTimeout > 0 {
+		atomic.StoreInt64(&mex.bufferedSince, 0)
+		if len(mex.recvCh) > 0 {
+			atomic.StoreInt64(&mex.bufferedSince, time.Now().UnixNano())
+		}
+	}
+	if mex.flow == nil {
+		return nil
+	}
+	if credits := mex.flow.frameConsumed(frame); credits > 0 {
+		return mex.sendWindowUpdate(credits)
+	}
+	return nil
+}
+
+// frameBuffered records when frames started waiting for the reader, so that a reader that
+// stops consuming frames can be detected without blocking the connection.
+func (mex *messageExchange) frameBuffered() {
+	if atomic.LoadInt64(&mex.bufferedSince) == 0 {
+		atomic.CompareAndSwapInt64(&mex.bufferedSince, 0, time.Now().UnixNano())
+	}
+}
+
+// checkStalled returns ErrStreamStalled if frames have been waiting for the reader for
+// longer than the stall timeout.
+func (mex *messageExchange) checkStalled() error {
+	if mex.stallTimeout <= 0 || len(mex.recvCh) == 0 {
+		return nil
+	}
+	since := atomic.LoadInt64(&mex.bufferedSince)
+	if since != 0 && time.Since(time.Unix(0, since)) > mex.stallTimeout {
+		return ErrStreamStalled
+	}
+	return nil
+}
+
+// sendWindowUpdate returns credits to the peer. Unlimited credits are sent when the
+// exchange is removed, which may be on the connection's read loop, so they are dropped
+// rather than waiting if the send buffer is full.
+func (mex *messageExchange) sendWindowUpdate(credits uint32) error {
+	frame := mex.framePool.Get()
+	msg := &windowUpdate{
+		id:         mex.msgID,
+		forRequest: mex.mexset.name == messageExchangeSetInbound,
+		credits:    credits,
+	}
+	if err := frame.write(msg); err != nil {
+		mex.framePool.Release(frame)
+		return err
+	}
+
+	if credits == unlimitedCredits {
+		select {
+		case mex.mexset.sendCh <- frame:
+			return nil
+		default:
+			mex.framePool.Release(frame)
+			return ErrSendBufferFull
+		}
+	}
+
+	select {
+	case mex.mexset.sendCh <- frame:
+		return nil
+	case <-mex.ctx.Done():
+		mex.framePool.Release(frame)
+		return mex.ctx.Err()
+	case <-mex.lost:
+		mex.framePool.Release(frame)
+		return errConnectionLost
+	}
+}
+
+// isContinuation returns whether the frame continues a message, and so is flow controlled.
+func isContinuation(frame *Frame) bool {
+	t := frame.Header.messageType
+	return t == messageTypeCallReqContinue || t == messageTypeCallResContinue
+}
+
+// setStreamOptions applies the stream options to the exchange. It must be called before
+// the streamed argument is read or written.
+func (mex *messageExchange) setStreamOptions(opts *StreamOptions) {
+	if opts.MaxBufferedFrames > 0 && mex.flow != nil {
+		mex.flow.setLimit(opts.MaxBufferedFrames)
+	}
+	if opts.StallTimeout > 0 {
+		mex.stallTimeout = opts.StallTimeout
+	}
+}
+
+// SetStreamOptions sets the flow control options used to read arg3 and write the
+// response. It must be called before Arg3Reader.
+func (call *InboundCall) SetStreamOptions(opts *StreamOptions) {
+	call.mex.setStreamOptions(opts)
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func continuationFrame(hasMore bool) *Frame {
+	frame := NewFrame(MaxFramePayloadSize)
+	frame.Header.messageType = messageTypeCallReqContinue
+	if hasMore {
+		frame.Payload[0] = hasMoreFragmentsFlag
+	}
+	frame.Header.SetPayloadSize(1)
+	return frame
+}
+
+func TestFlowControlCredits(t *testing.T) {
+	f := newFlowControl(8, 4)
+	for i := 0; i < 4; i++ {
+		assert.True(t, f.takeCredit(), "credit %v should be available from the peer's window", i)
+	}
+	assert.False(t, f.takeCredit(), "no credits should be left")
+
+	f.addCredits(2)
+	assert.True(t, f.takeCredit(), "returned credit should be available")
+	assert.True(t, f.takeCredit(), "returned credit should be available")
+	assert.False(t, f.takeCredit(), "no credits should be left")
+
+	f.addCredits(unlimitedCredits)
+	for i := 0; i < 100; i++ {
+		assert.True(t, f.takeCredit(), "credits should be unlimited")
+	}
+}
+
+func TestFlowControlReturnsCredits(t *testing.T) {
+	f := newFlowControl(8, 8)
+	frame := continuationFrame(true)
+
+	var returned []uint32
+	for i := 0; i < 8; i++ {
+		if credits := f.frameConsumed(frame); credits > 0 {
+			returned = append(returned, credits)
+		}
+	}
+	assert.Equal(t, []uint32{4, 4}, returned, "credits should be returned in batches")
+
+	assert.Equal(t, uint32(0), f.frameConsumed(continuationFrame(false)), "no credits after the last frame")
+	assert.False(t, f.release(), "release is not needed once the message is complete")
+}
+
+func TestFlowControlLimit(t *testing.T) {
+	f := newFlowControl(8, 8)
+	f.setLimit(2)
+	frame := continuationFrame(true)
+
+	// The peer's initial window covers the first frames, so no credits are returned until
+	// fewer than limit frames can be buffered.
+	for i := 0; i < 6; i++ {
+		assert.Equal(t, uint32(0), f.frameConsumed(frame), "frame %v should not return credits", i)
+	}
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, uint32(1), f.frameConsumed(frame), "each frame should return a credit")
+	}
+	assert.True(t, f.release(), "release is needed if the message was not read completely")
+	assert.Equal(t, uint32(0), f.frameConsumed(frame), "no credits after release")
+}
@@ -0,0 +1,290 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+// withStreamServer runs f with a server that handles the "stream" operation using handler,
+// and a client to call it.
+func withStreamServer(t *testing.T, handler func(ctx context.Context, call *InboundCall),
+	f func(client *Channel, hostPort string)) {
+
+	require.NoError(t, testutils.WithServer(nil, func(server *Channel, hostPort string) {
+		server.Register(HandlerFunc(handler), "stream")
+
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		f(client, hostPort)
+	}))
+}
+
+func TestStreamMaxBufferedFrames(t *testing.T) {
+	body := testutils.RandBytes(1024 * 1024)
+	handler := func(ctx context.Context, call *InboundCall) {
+		var arg2, arg3 []byte
+		require.NoError(t, NewArgReader(call.Arg2Reader()).Read(&arg2), "Read arg2 failed")
+		require.NoError(t, NewArgReader(call.Arg3Reader()).Read(&arg3), "Read arg3 failed")
+		response := call.Response()
+		require.NoError(t, NewArgWriter(response.Arg2Writer()).Write(nil), "Write arg2 failed")
+		require.NoError(t, NewArgWriter(response.Arg3Writer()).Write(body), "Write arg3 failed")
+	}
+
+	withStreamServer(t, handler, func(client *Channel, hostPort string) {
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		call, err := client.BeginCall(ctx, hostPort, testutils.DefaultServerName, "stream", &CallOptions{
+			Stream: &StreamOptions{MaxBufferedFrames: 2, StallTimeout: 500 * time.Millisecond},
+		})
+		require.NoError(t, err, "BeginCall failed")
+		require.NoError(t, NewArgWriter(call.Arg2Writer()).Write(nil), "Write arg2 failed")
+		require.NoError(t, NewArgWriter(call.Arg3Writer()).Write(nil), "Write arg3 failed")
+
+		response := call.Response()
+		_, err = response.ReadArg2()
+		require.NoError(t, err, "ReadArg2 failed")
+		reader, err := response.Arg3Reader()
+		require.NoError(t, err, "Arg3Reader failed")
+
+		// The server waits for credits once the buffer is full, but the stream completes as
+		// the reader catches up.
+		time.Sleep(50 * time.Millisecond)
+		got, err := ioutil.ReadAll(reader)
+		require.NoError(t, err, "Read arg3 failed")
+		assert.True(t, bytes.Equal(body, got), "Response mismatch")
+		assert.NoError(t, reader.Close(), "Close failed")
+	})
+}
+
+func TestStreamReaderStall(t *testing.T) {
+	ready := make(chan struct{})
+	handler := func(ctx context.Context, call *InboundCall) {
+		call.SetStreamOptions(&StreamOptions{MaxBufferedFrames: 1, StallTimeout: 50 * time.Millisecond})
+		var arg2 []byte
+		require.NoError(t, NewArgReader(call.Arg2Reader()).Read(&arg2), "Read arg2 failed")
+		reader, err := call.Arg3Reader()
+		require.NoError(t, err, "Arg3Reader failed")
+		close(ready)
+
+		// Stop reading for longer than the stall timeout.
+		time.Sleep(150 * time.Millisecond)
+		_, err = ioutil.ReadAll(reader)
+		assert.Equal(t, ErrStreamStalled, err, "Read should fail once the stream stalls")
+		call.Response().SendSystemError(err)
+	}
+
+	withStreamServer(t, handler, func(client *Channel, hostPort string) {
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		call, err := client.BeginCall(ctx, hostPort, testutils.DefaultServerName, "stream", nil)
+		require.NoError(t, err, "BeginCall failed")
+		require.NoError(t, NewArgWriter(call.Arg2Writer()).Write(nil), "Write arg2 failed")
+		writer, err := call.Arg3Writer()
+		require.NoError(t, err, "Arg3Writer failed")
+		require.NoError(t, writer.Flush(), "Flush failed")
+
+		<-ready
+		_, err = writer.Write(testutils.RandBytes(1024 * 1024))
+		require.NoError(t, err, "Write arg3 failed")
+		require.NoError(t, writer.Close(), "Close failed")
+
+		_, err = call.Response().ReadArg2()
+		assert.Equal(t, ErrCodeTimeout, GetSystemErrorCode(err), "Unexpected error: %v", err)
+		assert.Contains(t, err.Error(), "stream stalled", "Unexpected error")
+	})
+}
+
+func TestStreamWriterStall(t *testing.T) {
+	done := make(chan struct{})
+	handler := func(ctx context.Context, call *InboundCall) {
+		call.SetStreamOptions(&StreamOptions{MaxBufferedFrames: 1})
+		var arg2 []byte
+		require.NoError(t, NewArgReader(call.Arg2Reader()).Read(&arg2), "Read arg2 failed")
+		_, err := call.Arg3Reader()
+		require.NoError(t, err, "Arg3Reader failed")
+
+		// Never read arg3, so no credits are returned and the writer is blocked.
+		<-done
+	}
+
+	withStreamServer(t, handler, func(client *Channel, hostPort string) {
+		defer close(done)
+		ctx, cancel := NewContext(2 * time.Second)
+		defer cancel()
+
+		call, err := client.BeginCall(ctx, hostPort, testutils.DefaultServerName, "stream", &CallOptions{
+			Stream: &StreamOptions{StallTimeout: 50 * time.Millisecond},
+		})
+		require.NoError(t, err, "BeginCall failed")
+		require.NoError(t, NewArgWriter(call.Arg2Writer()).Write(nil), "Write arg2 failed")
+		writer, err := call.Arg3Writer()
+		require.NoError(t, err, "Arg3Writer failed")
+
+		started := time.Now()
+		chunk := make([]byte, 64*1024)
+		for i := 0; i < 1024 && err == nil; i++ {
+			_, err = writer.Write(chunk)
+		}
+		assert.Equal(t, ErrStreamStalled, err, "Write should fail once the stream stalls")
+		assert.True(t, time.Since(started) < time.Second, "Write should fail before the deadline")
+	})
+}
+
+var stallTimeoutOpts = &testutils.ChannelOpts{
+	DefaultConnectionOptions: ConnectionOptions{StallTimeout: 50 * time.Millisecond},
+}
+
+func TestStreamPeerStallInbound(t *testing.T) {
+	handlerErr := make(chan error, 1)
+	require.NoError(t, testutils.WithServer(stallTimeoutOpts, func(server *Channel, hostPort string) {
+		server.Register(HandlerFunc(func(ctx context.Context, call *InboundCall) {
+			var arg2 []byte
+			require.NoError(t, NewArgReader(call.Arg2Reader()).Read(&arg2), "Read arg2 failed")
+			reader, err := call.Arg3Reader()
+			require.NoError(t, err, "Arg3Reader failed")
+			_, err = ioutil.ReadAll(reader)
+			handlerErr <- err
+			call.Response().SendSystemError(err)
+		}), "stall")
+
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		ctx, cancel := NewContext(2 * time.Second)
+		defer cancel()
+
+		call, err := client.BeginCall(ctx, hostPort, testutils.DefaultServerName, "stall", nil)
+		require.NoError(t, err, "BeginCall failed")
+		require.NoError(t, NewArgWriter(call.Arg2Writer()).Write(nil), "Write arg2 failed")
+		writer, err := call.Arg3Writer()
+		require.NoError(t, err, "Arg3Writer failed")
+
+		// Send part of arg3, and then stop sending without closing the connection.
+		started := time.Now()
+		_, err = writer.Write([]byte("partial"))
+		require.NoError(t, err, "Write arg3 failed")
+		require.NoError(t, writer.Flush(), "Flush failed")
+
+		select {
+		case err := <-handlerErr:
+			assert.Equal(t, ErrStreamStalled, err, "Read should fail once the peer stops sending")
+		case <-time.After(time.Second):
+			t.Fatalf("handler was not failed by the stall timeout")
+		}
+		assert.True(t, time.Since(started) < 500*time.Millisecond, "Read should fail before the deadline")
+
+		_, err = call.Response().ReadArg2()
+		assert.Equal(t, ErrCodeTimeout, GetSystemErrorCode(err), "Unexpected error: %v", err)
+		assert.Contains(t, err.Error(), "stream stalled", "Unexpected error")
+	}))
+}
+
+func TestStreamPeerStallOutbound(t *testing.T) {
+	done := make(chan struct{})
+	handler := func(ctx context.Context, call *InboundCall) {
+		var arg2, arg3 []byte
+		require.NoError(t, NewArgReader(call.Arg2Reader()).Read(&arg2), "Read arg2 failed")
+		require.NoError(t, NewArgReader(call.Arg3Reader()).Read(&arg3), "Read arg3 failed")
+
+		response := call.Response()
+		require.NoError(t, NewArgWriter(response.Arg2Writer()).Write(nil), "Write arg2 failed")
+		writer, err := response.Arg3Writer()
+		require.NoError(t, err, "Arg3Writer failed")
+		_, err = writer.Write([]byte("partial"))
+		require.NoError(t, err, "Write arg3 failed")
+		require.NoError(t, writer.Flush(), "Flush failed")
+		<-done
+	}
+
+	require.NoError(t, testutils.WithServer(nil, func(server *Channel, hostPort string) {
+		defer close(done)
+		server.Register(HandlerFunc(handler), "stall")
+
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		ctx, cancel := NewContext(2 * time.Second)
+		defer cancel()
+
+		call, err := client.BeginCall(ctx, hostPort, testutils.DefaultServerName, "stall", &CallOptions{
+			Stream: &StreamOptions{StallTimeout: 50 * time.Millisecond},
+		})
+		require.NoError(t, err, "BeginCall failed")
+		require.NoError(t, NewArgWriter(call.Arg2Writer()).Write(nil), "Write arg2 failed")
+		require.NoError(t, NewArgWriter(call.Arg3Writer()).Write(nil), "Write arg3 failed")
+
+		started := time.Now()
+		response := call.Response()
+		_, err = response.ReadArg2()
+		require.NoError(t, err, "ReadArg2 failed")
+		reader, err := response.Arg3Reader()
+		require.NoError(t, err, "Arg3Reader failed")
+		_, err = ioutil.ReadAll(reader)
+		assert.Equal(t, ErrStreamStalled, err, "Read should fail once the peer stops sending")
+		assert.True(t, time.Since(started) < 500*time.Millisecond, "Read should fail before the deadline")
+	}))
+}
+
+func TestStreamStallSlowResponse(t *testing.T) {
+	handler := func(ctx context.Context, call *InboundCall) {
+		var arg2, arg3 []byte
+		require.NoError(t, NewArgReader(call.Arg2Reader()).Read(&arg2), "Read arg2 failed")
+		require.NoError(t, NewArgReader(call.Arg3Reader()).Read(&arg3), "Read arg3 failed")
+
+		// The stall timeout only applies once the response has started.
+		time.Sleep(150 * time.Millisecond)
+		response := call.Response()
+		require.NoError(t, NewArgWriter(response.Arg2Writer()).Write(nil), "Write arg2 failed")
+		require.NoError(t, NewArgWriter(response.Arg3Writer()).Write(arg3), "Write arg3 failed")
+	}
+
+	require.NoError(t, testutils.WithServer(nil, func(server *Channel, hostPort string) {
+		server.Register(HandlerFunc(handler), "slow")
+
+		client, err := testutils.NewClient(stallTimeoutOpts)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		_, arg3, _, err := raw.Call(ctx, client, hostPort, testutils.DefaultServerName, "slow", nil, testArg3)
+		require.NoError(t, err, "Call failed")
+		assert.Equal(t, testArg3, arg3, "arg3 mismatch")
+	}))
+}
@@ -22,6 +22,7 @@ package tchannel
 
 import (
 	"bytes"
+	"io"
 	"sync"
 	"testing"
 
@@ -410,3 +411,56 @@ func buffers(elements ...[][]byte) [][]byte {
 
 	return buffers
 }
+
+func TestFragmentationUnknownChecksumType(t *testing.T) {
+	recvCh := make(fragmentChannel, 10)
+	r := newFragmentingReader(recvCh)
+
+	// A fragment with an unknown checksum type, and an empty chunk.
+	recvCh <- []byte{0x00, 0x7F, 0x00, 0x00}
+	assert.Equal(t, errUnknownChecksumType, r.BeginArgument(true /* last */))
+}
+
+func TestFragmentationNoChunks(t *testing.T) {
+	recvCh := make(fragmentChannel, 10)
+	r := newFragmentingReader(recvCh)
+
+	// A fragment with no checksum, and no chunks.
+	recvCh <- []byte{0x00, byte(ChecksumTypeNone)}
+	assert.Equal(t, errNoChunksInFragment, r.BeginArgument(true /* last */))
+}
+
+func TestFragmentationPartialRead(t *testing.T) {
+	runFragmentationErrorTest(func(w *fragmentingWriter, r *fragmentingReader) {
+		writer, err := w.ArgWriter(false /* last */)
+		require.NoError(t, err)
+		require.NoError(t, NewArgWriter(writer, nil).Write([]byte("headers")))
+
+		writer, err = w.ArgWriter(true /* last */)
+		require.NoError(t, err)
+		_, err = writer.Write([]byte("first"))
+		require.NoError(t, err)
+		require.NoError(t, writer.Flush())
+		_, err = writer.Write([]byte("second"))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		var arg2 []byte
+		require.NoError(t, NewArgReader(r.ArgReader(false /* last */)).Read(&arg2))
+		assert.Equal(t, "headers", string(arg2))
+
+		// Reads return the data in the current fragment without waiting for the next one.
+		reader, err := r.ArgReader(true /* last */)
+		require.NoError(t, err)
+		buf := make([]byte, 100)
+		n, err := reader.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "first", string(buf[:n]))
+
+		// Closing once all the data is read succeeds without reading io.EOF.
+		_, err = io.ReadFull(reader, buf[:len("second")])
+		require.NoError(t, err)
+		assert.Equal(t, "second", string(buf[:len("second")]))
+		assert.NoError(t, reader.Close())
+	})
+}
@@ -37,6 +37,8 @@ var (
 	errMoreDataInArgument       = errors.New("more data available in argument")
 	errExpectedMoreArguments    = errors.New("more arguments in message")
 	errNoMoreFragments          = errors.New("no more fragments")
+	errUnknownChecksumType      = errors.New("peer sent an unsupported checksum type")
+	errNoChunksInFragment       = errors.New("peer sent a fragment without any chunks")
 )
 
 type readableFragment struct {
@@ -166,6 +168,12 @@ func (r *fragmentingReader) Read(b []byte) (int, error) {
 			return totalRead, io.EOF
 		}
 
+		// Return the data we already have rather than waiting for the next fragment,
+		// so that streamed arguments are received as soon as they are sent.
+		if totalRead > 0 {
+			return totalRead, nil
+		}
+
 		if r.err = r.recvAndParseNextFragment(false); r.err != nil {
 			return totalRead, r.err
 		}
@@ -183,6 +191,15 @@ func (r *fragmentingReader) Close() error {
 		return r.err
 	}
 
+	// The caller may stop reading once it has the data it expects, before Read has seen
+	// the end of the argument. Receive the remaining fragments for the argument so that
+	// we can check whether the argument is complete.
+	for len(r.curChunk) == 0 && len(r.remainingChunks) == 0 && r.hasMoreFragments {
+		if r.err = r.recvAndParseNextFragment(false); r.err != nil {
+			return r.err
+		}
+	}
+
 	if len(r.curChunk) > 0 {
 		// There was more data remaining in the chunk
 		r.err = errMoreDataInArgument
@@ -198,11 +215,7 @@ func (r *fragmentingReader) Close() error {
 	//       - the stream is complete
 	// 3. The caller thinks there are more arguments, and there are more chunks in this fragment
 	//       - advance to the next chunk, this is the first chunk for the next argument
-	// 4. The caller thinks there are more arguments, and there are no more chunks in this fragment,
-	//    but there are more fragments in the message
-	//       - retrieve the next fragment, confirm it has an empty chunk (indicating the end of the
-	//         current argument), advance to the next check (which is the first chunk for the next arg)
-	// 5. The caller thinks there are more arguments, but there are no more chunks or fragments available
+	// 4. The caller thinks there are more arguments, but there are no more chunks or fragments available
 	//      - give them an err
 	if last {
 		if len(r.remainingChunks) > 0 || r.hasMoreFragments {
@@ -228,17 +241,8 @@ func (r *fragmentingReader) Close() error {
 	}
 
 	// If there are no more chunks in this fragment, and no more fragments, we have an issue
-	if !r.hasMoreFragments {
-		r.err = errNoMoreFragments
-		return r.err
-	}
-
-	// There are no more chunks in this fragments, but more fragments - get the next fragment
-	if r.err = r.recvAndParseNextFragment(false); r.err != nil {
-		return r.err
-	}
-
-	return nil
+	r.err = errNoMoreFragments
+	return r.err
 }
 
 func (r *fragmentingReader) recvAndParseNextFragment(initial bool) error {
@@ -258,7 +262,9 @@ func (r *fragmentingReader) recvAndParseNextFragment(initial bool) error {
 
 	// Set checksum, or confirm new checksum is the same type as the prior checksum
 	if r.checksum == nil {
-		r.checksum = r.curFragment.checksumType.New()
+		if r.checksum = r.curFragment.checksumType.New(); r.checksum == nil {
+			return errUnknownChecksumType
+		}
 	} else if r.checksum.TypeCode() != r.curFragment.checksumType {
 		return errMismatchedChecksumTypes
 	}
@@ -287,6 +293,9 @@ func (r *fragmentingReader) recvAndParseNextFragment(initial bool) error {
 	}
 
 	// Pull out the first chunk to act as the current chunk
+	if len(r.remainingChunks) == 0 {
+		return errNoChunksInFragment
+	}
 	r.curChunk, r.remainingChunks = r.remainingChunks[0], r.remainingChunks[1:]
 	return nil
 }
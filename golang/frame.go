@@ -21,6 +21,7 @@
 package tchannel
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"math"
@@ -39,6 +40,9 @@ const (
 	MaxFramePayloadSize = MaxFrameSize - FrameHeaderSize
 )
 
+// errFrameTooSmall is returned when a frame's size is smaller than the frame header.
+var errFrameTooSmall = errors.New("frame size is smaller than the frame header")
+
 // FrameHeader is the header for a frame, containing the MessageType and size
 type FrameHeader struct {
 	// The size of the frame including the header
@@ -80,6 +84,9 @@ func (fh *FrameHeader) read(r *typed.ReadBuffer) error {
 	fh.reserved1 = r.ReadSingleByte()
 	fh.ID = r.ReadUint32()
 	r.ReadBytes(len(fh.reserved))
+	if r.Err() == nil && fh.size < FrameHeaderSize {
+		return errFrameTooSmall
+	}
 	return r.Err()
 }
 
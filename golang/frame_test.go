@@ -93,3 +93,14 @@ func TestEmptyPayload(t *testing.T) {
 	// This is also simulated by the LimitedReader so we use that here.
 	require.NoError(t, f.ReadIn(&io.LimitedReader{R: buf, N: FrameHeaderSize}))
 }
+
+func TestReadInFrameTooSmall(t *testing.T) {
+	for _, size := range []uint16{0, 1, FrameHeaderSize - 1} {
+		header := make([]byte, FrameHeaderSize)
+		header[0], header[1] = byte(size>>8), byte(size)
+		header[2] = byte(messageTypeCallReq)
+
+		f := NewFrame(MaxFramePayloadSize)
+		assert.Equal(t, errFrameTooSmall, f.ReadIn(bytes.NewReader(header)), "size %v should be rejected", size)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import "time"
+
+// FrameDirection is the direction of a frame on a connection.
+type FrameDirection int
+
+const (
+	// FrameInbound is a frame received from the remote peer.
+	FrameInbound FrameDirection = iota + 1
+
+	// FrameOutbound is a frame sent to the remote peer.
+	FrameOutbound
+)
+
+func (d FrameDirection) String() string {
+	switch d {
+	case FrameInbound:
+		return "inbound"
+	case FrameOutbound:
+		return "outbound"
+	default:
+		return "unknown"
+	}
+}
+
+// FrameEvent describes a single frame sent or received on a connection.
+type FrameEvent struct {
+	// ConnectionID is the ID of the connection the frame was sent or received on.
+	ConnectionID uint32
+
+	// Direction is whether the frame was sent or received.
+	Direction FrameDirection
+
+	// LocalHostPort and RemoteHostPort are the addresses of the underlying network connection.
+	LocalHostPort  string
+	RemoteHostPort string
+
+	// Time is when the frame was read from, or about to be written to, the network.
+	Time time.Time
+
+	// Header is the frame header, which contains the message ID and payload size.
+	Header FrameHeader
+
+	// MessageType is the name of the message type of the frame.
+	MessageType string
+
+	// Payload is a copy of the frame payload, which is only set if IncludePayloads is set.
+	Payload []byte
+}
+
+// FrameTap receives an event for every frame sent or received by a channel.
+type FrameTap interface {
+	// OnFrame is called synchronously from the connection's read and write loops,
+	// so implementations should not block.
+	OnFrame(event FrameEvent)
+}
+
+// FrameTapFunc is an adapter that allows a function to be used as a FrameTap.
+type FrameTapFunc func(event FrameEvent)
+
+// OnFrame calls f(event).
+func (f FrameTapFunc) OnFrame(event FrameEvent) {
+	f(event)
+}
+
+// FrameTapOptions configure a tap that observes all frames sent and received by a channel.
+type FrameTapOptions struct {
+	// Tap receives the frame events.
+	Tap FrameTap
+
+	// IncludePayloads copies the frame payload into each event. Otherwise, events
+	// only contain a summary of the frame.
+	IncludePayloads bool
+}
+
+// tapFrame passes the frame to the connection's frame tap, if one is configured.
+func (c *Connection) tapFrame(direction FrameDirection, frame *Frame) {
+	opts := c.frameTap
+	if opts == nil || opts.Tap == nil {
+		return
+	}
+
+	event := FrameEvent{
+		ConnectionID:   c.connID,
+		Direction:      direction,
+		LocalHostPort:  c.conn.LocalAddr().String(),
+		RemoteHostPort: c.conn.RemoteAddr().String(),
+		Time:           timeNow(),
+		Header:         frame.Header,
+		MessageType:    frame.Header.messageType.String(),
+	}
+	if opts.IncludePayloads {
+		event.Payload = append([]byte(nil), frame.SizedPayload()...)
+	}
+	opts.Tap.OnFrame(event)
+}
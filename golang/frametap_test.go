@@ -0,0 +1,118 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+type recordingFrameTap struct {
+	sync.Mutex
+	events []FrameEvent
+}
+
+func (r *recordingFrameTap) OnFrame(event FrameEvent) {
+	r.Lock()
+	defer r.Unlock()
+	r.events = append(r.events, event)
+}
+
+// messageTypes returns the message types seen in the given direction.
+func (r *recordingFrameTap) messageTypes(direction FrameDirection) []string {
+	r.Lock()
+	defer r.Unlock()
+
+	var types []string
+	for _, e := range r.events {
+		if e.Direction == direction {
+			types = append(types, e.MessageType)
+		}
+	}
+	return types
+}
+
+func (r *recordingFrameTap) find(direction FrameDirection, messageType string) (FrameEvent, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	for _, e := range r.events {
+		if e.Direction == direction && e.MessageType == messageType {
+			return e, true
+		}
+	}
+	return FrameEvent{}, false
+}
+
+func TestFrameTap(t *testing.T) {
+	serverTap := &recordingFrameTap{}
+	serverCh, err := NewChannel("tap-server", &ChannelOptions{
+		FrameTap: &FrameTapOptions{Tap: serverTap, IncludePayloads: true},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer serverCh.Close()
+	require.NoError(t, serverCh.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	hostPort := serverCh.PeerInfo().HostPort
+
+	testutils.RegisterFunc(t, serverCh, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg3: args.Arg3}, nil
+	})
+
+	clientTap := &recordingFrameTap{}
+	clientCh, err := NewChannel("tap-client", &ChannelOptions{
+		FrameTap: &FrameTapOptions{Tap: clientTap},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer clientCh.Close()
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	_, _, _, err = raw.Call(ctx, clientCh, hostPort, "tap-server", "echo", nil, []byte("body"))
+	require.NoError(t, err, "Call failed")
+
+	assert.Equal(t, []string{"messageTypeInitReq", "messageTypeCallReq"}, clientTap.messageTypes(FrameOutbound))
+	assert.Equal(t, []string{"messageTypeInitRes", "messageTypeCallRes"}, clientTap.messageTypes(FrameInbound))
+
+	callReq, ok := clientTap.find(FrameOutbound, "messageTypeCallReq")
+	require.True(t, ok, "client should see the outbound call req")
+	assert.Equal(t, hostPort, callReq.RemoteHostPort, "remote host port mismatch")
+	assert.True(t, callReq.Header.PayloadSize() > 0, "call req should have a payload")
+	assert.Nil(t, callReq.Payload, "payloads should only be included when requested")
+
+	require.True(t, testutils.WaitFor(time.Second, func() bool {
+		_, ok := serverTap.find(FrameOutbound, "messageTypeCallRes")
+		return ok
+	}), "server should see the outbound call res")
+
+	serverCallReq, ok := serverTap.find(FrameInbound, "messageTypeCallReq")
+	require.True(t, ok, "server should see the inbound call req")
+	assert.Equal(t, callReq.Header.ID, serverCallReq.Header.ID, "message ID mismatch")
+	assert.Equal(t, int(serverCallReq.Header.PayloadSize()), len(serverCallReq.Payload), "payload size mismatch")
+}
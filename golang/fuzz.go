@@ -0,0 +1,128 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build gofuzz
+// +build gofuzz
+
+package tchannel
+
+// This file contains fuzz targets for the parsers that read untrusted network input.
+// They are built using go-fuzz (github.com/dvyukov/go-fuzz), or for libFuzzer using
+// go-fuzz-build -libfuzzer, with the target selected using -func. For example:
+//
+//	go-fuzz-build -func FuzzFrame github.com/uber/tchannel/golang
+//	go-fuzz -bin tchannel-fuzz.zip -workdir fuzz/frame
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/uber/tchannel/golang/typed"
+)
+
+// FuzzFrame parses data as a frame, and the frame's payload as its message type.
+func FuzzFrame(data []byte) int {
+	frame := NewFrame(MaxFramePayloadSize)
+	if err := frame.ReadIn(bytes.NewReader(data)); err != nil {
+		return 0
+	}
+
+	var msg message
+	switch frame.Header.messageType {
+	case messageTypeInitReq:
+		msg = &initReq{}
+	case messageTypeInitRes:
+		msg = &initRes{}
+	case messageTypeCallReq:
+		msg = &callReq{}
+	case messageTypeCallRes:
+		msg = &callRes{}
+	case messageTypeError:
+		msg = &errorMessage{}
+	case messageTypePingReq:
+		msg = &pingReq{}
+	case messageTypePingRes:
+		msg = &pingRes{}
+	case messageTypeDrainNotice:
+		msg = &drainNotice{}
+	case messageTypeWindowUpdate:
+		msg = &windowUpdate{}
+	default:
+		return 0
+	}
+	if err := frame.read(msg); err != nil {
+		return 0
+	}
+	return 1
+}
+
+// FuzzMessages parses data as the payload of each message type.
+func FuzzMessages(data []byte) int {
+	messages := []message{
+		&initReq{}, &initRes{}, &callReq{}, &callRes{}, &errorMessage{},
+	}
+
+	result := 0
+	for _, msg := range messages {
+		if err := msg.read(typed.NewReadBuffer(data)); err == nil {
+			result = 1
+		}
+	}
+	return result
+}
+
+// fuzzFragmentReceiver reads call fragments from a stream of frames.
+type fuzzFragmentReceiver struct {
+	r io.Reader
+}
+
+func (f fuzzFragmentReceiver) recvNextFragment(initial bool) (*readableFragment, error) {
+	frame := NewFrame(MaxFramePayloadSize)
+	if err := frame.ReadIn(f.r); err != nil {
+		return nil, err
+	}
+
+	var msg message = &callReqContinue{}
+	if initial {
+		msg = &callReq{}
+	}
+	return parseInboundFragment(DisabledFramePool, frame, msg)
+}
+
+func (f fuzzFragmentReceiver) doneReading() {}
+
+// FuzzFragments parses data as the frames of a call request, and reads its arguments.
+func FuzzFragments(data []byte) int {
+	r := newFragmentingReader(fuzzFragmentReceiver{bytes.NewReader(data)})
+	for i := 0; i < 3; i++ {
+		arg, err := r.ArgReader(i == 2 /* last */)
+		if err != nil {
+			return 0
+		}
+		if _, err := ioutil.ReadAll(arg); err != nil {
+			return 0
+		}
+		if err := arg.Close(); err != nil {
+			return 0
+		}
+	}
+	return 1
+}
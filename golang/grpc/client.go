@@ -0,0 +1,129 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package grpc
+
+import (
+	"strings"
+
+	"github.com/uber/tchannel/golang"
+	"golang.org/x/net/context"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// ClientConn is a grpc.ClientConnInterface that makes calls over a TChannel subchannel,
+// so that generated gRPC client stubs can call services registered using Register.
+type ClientConn struct {
+	sc *tchannel.SubChannel
+}
+
+var _ grpc.ClientConnInterface = (*ClientConn)(nil)
+
+// NewClientConn returns a ClientConn that makes calls to the subchannel's service.
+// Calls use the context's deadline, or the subchannel's default timeout.
+func NewClientConn(sc *tchannel.SubChannel) *ClientConn {
+	return &ClientConn{sc: sc}
+}
+
+// Invoke implements grpc.ClientConnInterface.
+func (c *ClientConn) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	arg2, err := encodeMetadata(md)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to encode metadata: %v", err)
+	}
+	arg3, err := marshal(args)
+	if err != nil {
+		return err
+	}
+
+	call, err := c.sc.BeginCall(ctx, strings.TrimPrefix(method, "/"), &tchannel.CallOptions{Format: tchannel.Raw})
+	if err != nil {
+		return statusFromError(err)
+	}
+	if err := tchannel.NewArgWriter(call.Arg2Writer()).Write(arg2); err != nil {
+		return statusFromError(err)
+	}
+	if err := tchannel.NewArgWriter(call.Arg3Writer()).Write(arg3); err != nil {
+		return statusFromError(err)
+	}
+
+	var respArg2, respArg3 []byte
+	response := call.Response()
+	if err := tchannel.NewArgReader(response.Arg2Reader()).Read(&respArg2); err != nil {
+		return statusFromError(err)
+	}
+	if err := tchannel.NewArgReader(response.Arg3Reader()).Read(&respArg3); err != nil {
+		return statusFromError(err)
+	}
+
+	if response.ApplicationError() {
+		st := &spb.Status{}
+		if err := proto.Unmarshal(respArg3, st); err != nil {
+			return status.Errorf(codes.Internal, "failed to decode error status: %v", err)
+		}
+		return status.FromProto(st).Err()
+	}
+
+	m, ok := reply.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "message %T is not a proto.Message", reply)
+	}
+	if err := proto.Unmarshal(respArg3, m); err != nil {
+		return status.Errorf(codes.Internal, "failed to decode response: %v", err)
+	}
+	return nil
+}
+
+// NewStream implements grpc.ClientConnInterface. Streaming is not supported.
+func (c *ClientConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return nil, status.Errorf(codes.Unimplemented, "streaming method %v is not supported over TChannel", method)
+}
+
+// statusFromError returns the gRPC status error for an error from TChannel.
+func statusFromError(err error) error {
+	if err == tchannel.ErrNoPeers {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+
+	class := tchannel.ErrorClass(err)
+	code := codes.Unknown
+	switch class.Code {
+	case tchannel.ErrCodeTimeout:
+		code = codes.DeadlineExceeded
+	case tchannel.ErrCodeCancelled:
+		code = codes.Canceled
+	case tchannel.ErrCodeBusy:
+		code = codes.ResourceExhausted
+	case tchannel.ErrCodeDeclined, tchannel.ErrCodeNetwork:
+		code = codes.Unavailable
+	case tchannel.ErrCodeBadRequest:
+		code = codes.InvalidArgument
+	case tchannel.ErrCodeUnexpected, tchannel.ErrCodeProtocol:
+		if class.Kind == tchannel.ErrKindSystem {
+			code = codes.Internal
+		}
+	}
+	return status.Error(code, err.Error())
+}
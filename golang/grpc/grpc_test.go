@@ -0,0 +1,134 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package grpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// The following mirrors the code generated by protoc-gen-go-grpc for:
+// service Echo { rpc Echo(google.protobuf.StringValue) returns (google.protobuf.StringValue); }
+
+type echoServer interface {
+	Echo(context.Context, *wrapperspb.StringValue) (*wrapperspb.StringValue, error)
+}
+
+func echoHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(wrapperspb.StringValue)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	return srv.(echoServer).Echo(ctx, in)
+}
+
+var echoServiceDesc = grpc.ServiceDesc{
+	ServiceName: "test.Echo",
+	HandlerType: (*echoServer)(nil),
+	Methods:     []grpc.MethodDesc{{MethodName: "Echo", Handler: echoHandler}},
+}
+
+type echoClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func (c echoClient) Echo(ctx context.Context, in *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+	out := new(wrapperspb.StringValue)
+	if err := c.cc.Invoke(ctx, "/test.Echo/Echo", in, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+type echoImpl struct{}
+
+func (echoImpl) Echo(ctx context.Context, in *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+	switch in.Value {
+	case "fail":
+		return nil, status.Error(codes.FailedPrecondition, "echo failed")
+	case "metadata":
+		md, _ := metadata.FromIncomingContext(ctx)
+		return wrapperspb.String(md.Get("key")[0]), nil
+	}
+	return wrapperspb.String("echo " + in.Value), nil
+}
+
+func TestGRPCAdapter(t *testing.T) {
+	server, err := tchannel.NewChannel("echo-svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+	require.NoError(t, Register(server, &echoServiceDesc, echoImpl{}), "Register failed")
+
+	client, err := tchannel.NewChannel("echo-client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+	sc := client.GetSubChannel("echo-svc")
+	sc.Peers().Add(server.PeerInfo().HostPort)
+	echo := echoClient{NewClientConn(sc)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	res, err := echo.Echo(ctx, wrapperspb.String("hello"))
+	require.NoError(t, err, "Echo failed")
+	assert.Equal(t, "echo hello", res.Value, "response mismatch")
+
+	mdCtx := metadata.AppendToOutgoingContext(ctx, "key", "value")
+	res, err = echo.Echo(mdCtx, wrapperspb.String("metadata"))
+	require.NoError(t, err, "Echo failed")
+	assert.Equal(t, "value", res.Value, "metadata should be sent to the server")
+
+	_, err = echo.Echo(ctx, wrapperspb.String("fail"))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "status code mismatch")
+	assert.Equal(t, "echo failed", status.Convert(err).Message(), "status message mismatch")
+
+	err = NewClientConn(sc).Invoke(ctx, "/test.Echo/Unknown", wrapperspb.String("hello"), new(wrapperspb.StringValue))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "calls to unknown methods should be invalid")
+
+	noPeers, err := tchannel.NewChannel("echo-client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer noPeers.Close()
+	err = NewClientConn(noPeers.GetSubChannel("echo-svc")).Invoke(ctx, "/test.Echo/Echo", wrapperspb.String("hello"), new(wrapperspb.StringValue))
+	assert.Equal(t, codes.Unavailable, status.Code(err), "calls without peers should be unavailable")
+
+	_, err = NewClientConn(sc).NewStream(ctx, &grpc.StreamDesc{}, "/test.Echo/Stream")
+	assert.Equal(t, codes.Unimplemented, status.Code(err), "streaming should not be supported")
+}
+
+func TestRegisterStreamingService(t *testing.T) {
+	ch, err := tchannel.NewChannel("svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+
+	desc := echoServiceDesc
+	desc.Streams = []grpc.StreamDesc{{StreamName: "Stream"}}
+	assert.Error(t, Register(ch, &desc, echoImpl{}), "Register should fail for streaming services")
+}
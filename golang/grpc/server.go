@@ -0,0 +1,149 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// Package grpc allows gRPC services and clients to use TChannel. Generated gRPC service
+// implementations can be registered on a channel, and generated gRPC client stubs can
+// make calls over a subchannel. Only unary methods are supported.
+//
+// Calls use the operation "<service>/<method>", such as "helloworld.Greeter/SayHello".
+// Arg2 contains the gRPC metadata encoded as a JSON object, and arg3 contains the
+// request or response message encoded using protobuf. Errors returned by handlers are
+// sent as application errors with arg3 containing the encoded google.rpc.Status.
+package grpc
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/uber/tchannel/golang"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Register registers the unary methods of a gRPC service implementation, using the
+// service description from the generated code, such as helloworld.Greeter_ServiceDesc.
+func Register(registrar tchannel.Registrar, desc *grpc.ServiceDesc, impl interface{}) error {
+	if len(desc.Streams) > 0 {
+		return fmt.Errorf("gRPC service %v has streaming methods, which are not supported", desc.ServiceName)
+	}
+
+	for _, method := range desc.Methods {
+		h := &handler{impl: impl, method: method, log: registrar.Logger()}
+		tchannel.RegisterOperation(registrar, h, tchannel.OperationInfo{
+			Name:     desc.ServiceName + "/" + method.MethodName,
+			Format:   tchannel.Raw,
+			Metadata: map[string]string{"grpc.service": desc.ServiceName},
+		})
+	}
+	return nil
+}
+
+type handler struct {
+	impl   interface{}
+	method grpc.MethodDesc
+	log    tchannel.Logger
+}
+
+// Handle implements tchannel.Handler.
+func (h *handler) Handle(ctx context.Context, call *tchannel.InboundCall) {
+	var arg2, arg3 []byte
+	if err := tchannel.NewArgReader(call.Arg2Reader()).Read(&arg2); err != nil {
+		h.log.Warnf("gRPC handler failed to read arg2: %v", err)
+		return
+	}
+	if err := tchannel.NewArgReader(call.Arg3Reader()).Read(&arg3); err != nil {
+		h.log.Warnf("gRPC handler failed to read arg3: %v", err)
+		return
+	}
+
+	md, err := decodeMetadata(arg2)
+	if err != nil {
+		call.Response().SendSystemError(tchannel.NewBadRequestError("", err))
+		return
+	}
+	ctx = metadata.NewIncomingContext(ctx, md)
+
+	dec := func(msg interface{}) error {
+		m, ok := msg.(proto.Message)
+		if !ok {
+			return status.Errorf(codes.Internal, "message %T is not a proto.Message", msg)
+		}
+		if err := proto.Unmarshal(arg3, m); err != nil {
+			return status.Errorf(codes.InvalidArgument, "failed to decode request: %v", err)
+		}
+		return nil
+	}
+
+	resp, err := h.method.Handler(h.impl, ctx, dec, nil)
+	if err == nil {
+		arg3, err = marshal(resp)
+	}
+
+	response := call.Response()
+	if err != nil {
+		arg3, err = proto.Marshal(status.Convert(err).Proto())
+		if err != nil {
+			h.log.Warnf("gRPC handler failed to encode status: %v", err)
+			response.SendSystemError(tchannel.NewUnexpectedError("", err))
+			return
+		}
+		if err := response.SetApplicationError(); err != nil {
+			h.log.Warnf("gRPC handler failed to set application error: %v", err)
+			return
+		}
+	}
+
+	if err := tchannel.NewArgWriter(response.Arg2Writer()).Write(nil); err != nil {
+		h.log.Warnf("gRPC handler failed to write arg2: %v", err)
+		return
+	}
+	if err := tchannel.NewArgWriter(response.Arg3Writer()).Write(arg3); err != nil {
+		h.log.Warnf("gRPC handler failed to write arg3: %v", err)
+	}
+}
+
+func marshal(msg interface{}) ([]byte, error) {
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "message %T is not a proto.Message", msg)
+	}
+	return proto.Marshal(m)
+}
+
+func encodeMetadata(md metadata.MD) ([]byte, error) {
+	if len(md) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(md)
+}
+
+func decodeMetadata(arg2 []byte) (metadata.MD, error) {
+	md := metadata.MD{}
+	if len(arg2) == 0 {
+		return md, nil
+	}
+	if err := json.Unmarshal(arg2, &md); err != nil {
+		return nil, fmt.Errorf("invalid metadata: %v", err)
+	}
+	return md, nil
+}
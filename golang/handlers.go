@@ -21,6 +21,9 @@
 package tchannel
 
 import (
+	"fmt"
+	"sort"
+	"strings"
 	"sync"
 
 	"golang.org/x/net/context"
@@ -41,17 +44,131 @@ type HandlerFunc func(ctx context.Context, call *InboundCall)
 // Handle calls f(ctx, call)
 func (f HandlerFunc) Handle(ctx context.Context, call *InboundCall) { f(ctx, call) }
 
+// OperationInfo describes a registered operation.
+type OperationInfo struct {
+	// Name is the operation name, which may be a pattern, see SubChannel.Register.
+	Name string `json:"name"`
+
+	// Format is the arg scheme used by the operation's handler, if known.
+	Format Format `json:"format,omitempty"`
+
+	// Metadata is additional information about the operation, such as its owner or
+	// a description, that is exposed for debugging.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// DuplicateRegistrationPolicy is how a channel handles a handler being registered for
+// an operation that already has one.
+type DuplicateRegistrationPolicy int
+
+const (
+	// DuplicateRegistrationWarn logs a warning and replaces the existing handler. This is
+	// the default, since servers such as thrift.NewServer register the same operations
+	// each time they are created on a channel.
+	DuplicateRegistrationWarn DuplicateRegistrationPolicy = iota
+
+	// DuplicateRegistrationReject rejects the registration by panicking, for applications
+	// that want to catch operations registered twice by mistake.
+	DuplicateRegistrationReject
+)
+
+// onDuplicate returns the function called for duplicate registrations with this policy.
+func (p DuplicateRegistrationPolicy) onDuplicate(log Logger) func(serviceName, operation string) {
+	if p == DuplicateRegistrationReject {
+		return func(serviceName, operation string) {
+			panic(fmt.Sprintf("tchannel: multiple registrations for %v::%v", serviceName, operation))
+		}
+	}
+	return func(serviceName, operation string) {
+		log.Warnf("Replacing the handler registered for %v::%v", serviceName, operation)
+	}
+}
+
 // Manages handlers
 type handlerMap struct {
 	mut      sync.RWMutex
 	handlers map[string]map[string]Handler
+	patterns map[string][]operationPattern
+	infos    map[string]map[string]OperationInfo
+
+	// onDuplicate is called when an operation that already has a handler is registered,
+	// before the handler is replaced. Duplicates replace the handler if it is nil.
+	onDuplicate func(serviceName, operation string)
 }
 
-// Registers a handler
+// operationPattern is a handler registered for an operation pattern containing wildcards.
+type operationPattern struct {
+	pattern string
+	handler Handler
+
+	// literals is the number of non-wildcard characters in the pattern. Patterns with
+	// more literals are more specific, and are matched first.
+	literals int
+}
+
+// isOperationPattern returns whether the operation name contains a wildcard.
+func isOperationPattern(operation string) bool {
+	return strings.Contains(operation, "*")
+}
+
+// matchOperation returns whether operation matches the pattern, where a "*" in the
+// pattern matches any sequence of characters, including an empty one.
+func matchOperation(pattern string, operation []byte) bool {
+	// Track the position of the last "*" so we can backtrack and have it match
+	// one more character when the rest of the pattern does not match.
+	p, o := 0, 0
+	starP, starO := -1, 0
+	for o < len(operation) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			starP, starO = p, o
+			p++
+		case p < len(pattern) && pattern[p] == operation[o]:
+			p++
+			o++
+		case starP >= 0:
+			starO++
+			p, o = starP+1, starO
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// Registers a handler. If the operation contains a "*", the handler is used for
+// all operations matching the pattern that do not have a handler registered
+// for the exact operation name.
 func (hmap *handlerMap) register(h Handler, serviceName, operation string) {
+	hmap.registerOperation(h, serviceName, OperationInfo{Name: operation})
+}
+
+// registerOperation registers a handler, and records the information for the operation.
+func (hmap *handlerMap) registerOperation(h Handler, serviceName string, op OperationInfo) {
 	hmap.mut.Lock()
 	defer hmap.mut.Unlock()
 
+	operation := op.Name
+	if _, ok := hmap.infos[serviceName][operation]; ok && hmap.onDuplicate != nil {
+		hmap.onDuplicate(serviceName, operation)
+	}
+
+	if hmap.infos == nil {
+		hmap.infos = make(map[string]map[string]OperationInfo)
+	}
+	if hmap.infos[serviceName] == nil {
+		hmap.infos[serviceName] = make(map[string]OperationInfo)
+	}
+	hmap.infos[serviceName][operation] = op
+
+	if isOperationPattern(operation) {
+		hmap.registerPattern(h, serviceName, operation)
+		return
+	}
+
 	if hmap.handlers == nil {
 		hmap.handlers = make(map[string]map[string]Handler)
 	}
@@ -65,12 +182,95 @@ func (hmap *handlerMap) register(h Handler, serviceName, operation string) {
 	operations[operation] = h
 }
 
+// registerPattern registers a handler for an operation pattern. Patterns are kept
+// sorted by priority: more specific patterns first, then in registration order.
+func (hmap *handlerMap) registerPattern(h Handler, serviceName, pattern string) {
+	if hmap.patterns == nil {
+		hmap.patterns = make(map[string][]operationPattern)
+	}
+
+	patterns := hmap.patterns[serviceName]
+	for i := range patterns {
+		if patterns[i].pattern == pattern {
+			patterns[i].handler = h
+			return
+		}
+	}
+
+	newPattern := operationPattern{
+		pattern:  pattern,
+		handler:  h,
+		literals: len(pattern) - strings.Count(pattern, "*"),
+	}
+	i := sort.Search(len(patterns), func(i int) bool {
+		return patterns[i].literals < newPattern.literals
+	})
+	patterns = append(patterns, operationPattern{})
+	copy(patterns[i+1:], patterns[i:])
+	patterns[i] = newPattern
+	hmap.patterns[serviceName] = patterns
+}
+
 // Finds the handler matching the given service and operation.  See https://github.com/golang/go/issues/3512
 // for the reason that operation is []byte instead of a string
 func (hmap *handlerMap) find(serviceName string, operation []byte) Handler {
 	hmap.mut.RLock()
-	handler := hmap.handlers[serviceName][string(operation)]
-	hmap.mut.RUnlock()
+	defer hmap.mut.RUnlock()
+
+	if handler := hmap.handlers[serviceName][string(operation)]; handler != nil {
+		return handler
+	}
+	for _, p := range hmap.patterns[serviceName] {
+		if matchOperation(p.pattern, operation) {
+			return p.handler
+		}
+	}
+	return nil
+}
+
+// hasHandlers returns whether any handlers are registered for the given service.
+func (hmap *handlerMap) hasHandlers(serviceName string) bool {
+	hmap.mut.RLock()
+	defer hmap.mut.RUnlock()
+
+	return len(hmap.handlers[serviceName]) > 0 || len(hmap.patterns[serviceName]) > 0
+}
+
+// operations returns a map from service name to the operations registered for that service.
+func (hmap *handlerMap) operations() map[string][]string {
+	hmap.mut.RLock()
+	defer hmap.mut.RUnlock()
+
+	ops := make(map[string][]string)
+	for serviceName, operations := range hmap.handlers {
+		for operation := range operations {
+			ops[serviceName] = append(ops[serviceName], operation)
+		}
+	}
+	for serviceName, patterns := range hmap.patterns {
+		for _, p := range patterns {
+			ops[serviceName] = append(ops[serviceName], p.pattern)
+		}
+	}
+	return ops
+}
+
+// operationInfos returns the information for the operations registered for the given
+// service, sorted by name.
+func (hmap *handlerMap) operationInfos(serviceName string) []OperationInfo {
+	hmap.mut.RLock()
+	defer hmap.mut.RUnlock()
 
-	return handler
+	infos := make([]OperationInfo, 0, len(hmap.infos[serviceName]))
+	for _, op := range hmap.infos[serviceName] {
+		infos = append(infos, op)
+	}
+	sort.Sort(operationInfosByName(infos))
+	return infos
 }
+
+type operationInfosByName []OperationInfo
+
+func (s operationInfosByName) Len() int           { return len(s) }
+func (s operationInfosByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s operationInfosByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -62,3 +62,66 @@ func TestHandlers(t *testing.T) {
 	assert.Equal(t, h2, hmap.find(s2, m1b))
 	assert.Nil(t, hmap.find(s1, m2b))
 }
+
+type namedHandler string
+
+func (namedHandler) Handle(ctx context.Context, call *InboundCall) {}
+
+func TestMatchOperation(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		operation string
+		want      bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"admin::*", "admin::", true},
+		{"admin::*", "admin::get", true},
+		{"admin::*", "admin:get", false},
+		{"admin::*", "users::get", false},
+		{"*::get", "admin::get", true},
+		{"*::get", "admin::getAll", false},
+		{"a*b*c", "abc", true},
+		{"a*b*c", "axxbyybc", true},
+		{"a*b*c", "axxbyy", false},
+		{"a**", "a", true},
+	}
+
+	for _, tt := range tests {
+		got := matchOperation(tt.pattern, []byte(tt.operation))
+		assert.Equal(t, tt.want, got, "matchOperation(%q, %q)", tt.pattern, tt.operation)
+	}
+}
+
+func TestHandlerPatterns(t *testing.T) {
+	hmap := &handlerMap{}
+	hmap.register(namedHandler("all"), "s1", "*")
+	hmap.register(namedHandler("admin"), "s1", "admin::*")
+	hmap.register(namedHandler("get"), "s1", "*::get")
+	hmap.register(namedHandler("exact"), "s1", "admin::get")
+
+	tests := []struct {
+		operation string
+		want      Handler
+	}{
+		{"admin::get", namedHandler("exact")},
+		{"admin::put", namedHandler("admin")},
+		{"users::get", namedHandler("get")},
+		{"users::put", namedHandler("all")},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, hmap.find("s1", []byte(tt.operation)), "find(%v)", tt.operation)
+	}
+	assert.Nil(t, hmap.find("s2", []byte("admin::get")), "patterns should only match their service")
+
+	// Patterns with the same number of literals are matched in registration order,
+	// and registering a pattern again replaces its handler.
+	hmap.register(namedHandler("admin2"), "s1", "admin::*")
+	assert.Equal(t, namedHandler("admin2"), hmap.find("s1", []byte("admin::put")))
+	assert.Equal(t, namedHandler("admin2"), hmap.find("s1", []byte("admin::x::get")),
+		"admin::* was registered before *::get")
+
+	assert.Equal(t, map[string][]string{
+		"s1": {"admin::get", "admin::*", "*::get", "*"},
+	}, hmap.operations())
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// HandlerTimeoutOptions configure the maximum duration of handlers wrapped using
+// WithHandlerTimeout.
+type HandlerTimeoutOptions struct {
+	// Max caps how long the handler can run for any operation. If it is zero, the
+	// handler can run until the call's time to live expires.
+	Max time.Duration
+
+	// PerOperation overrides Max for specific operations.
+	PerOperation map[string]time.Duration
+}
+
+func (o HandlerTimeoutOptions) timeout(operation string) time.Duration {
+	if timeout, ok := o.PerOperation[operation]; ok {
+		return timeout
+	}
+	return o.Max
+}
+
+// timeoutHandler is a Handler that enforces a maximum duration on another Handler.
+type timeoutHandler struct {
+	handler Handler
+	opts    HandlerTimeoutOptions
+}
+
+// handlerResult is the result of running a handler, which records whether it panicked.
+type handlerResult struct {
+	panicked bool
+	value    interface{}
+}
+
+// WithHandlerTimeout returns a Handler that runs h with a context that is cancelled
+// once the call's time to live, or the maximum duration configured for the operation,
+// expires, whichever is sooner.
+//
+// If h has not started responding when its context is cancelled, the call fails with
+// ErrTimeout and the "inbound.calls.handler-timeouts" counter is incremented. h keeps
+// running in the background until it returns, so it should stop once its context is
+// done; any response it writes after the timeout is discarded.
+func WithHandlerTimeout(h Handler, opts HandlerTimeoutOptions) Handler {
+	perOperation := make(map[string]time.Duration, len(opts.PerOperation))
+	for op, timeout := range opts.PerOperation {
+		perOperation[op] = timeout
+	}
+	opts.PerOperation = perOperation
+	return &timeoutHandler{handler: h, opts: opts}
+}
+
+func (h *timeoutHandler) Handle(ctx context.Context, call *InboundCall) {
+	handlerCtx, cancel := h.withTimeout(ctx, string(call.Operation()))
+	defer cancel()
+
+	done := make(chan handlerResult, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- handlerResult{panicked: true, value: r}
+			}
+		}()
+		h.handler.Handle(handlerCtx, call)
+		done <- handlerResult{}
+	}()
+
+	select {
+	case res := <-done:
+		if res.panicked {
+			// Panic in the calling goroutine so the panic is handled like any other
+			// handler panic.
+			panic(res.value)
+		}
+		return
+	case <-handlerCtx.Done():
+	}
+
+	// Calls cancelled by the caller are failed when the call's context is cancelled.
+	if handlerCtx.Err() != context.DeadlineExceeded {
+		go h.waitAfterTimeout(call, done)
+		return
+	}
+
+	call.statsReporter.IncCounter("inbound.calls.handler-timeouts", call.commonStatsTags, 1)
+	if call.response.timeout() {
+		call.log.Debugf("Handler for %s:%s timed out", call.ServiceName(), call.Operation())
+		call.mex.shutdown()
+		call.response.sendSystemError(ErrTimeout)
+	}
+
+	go h.waitAfterTimeout(call, done)
+}
+
+// waitAfterTimeout waits for a handler that is still running after its call failed,
+// logging any panic rather than crashing the process.
+func (h *timeoutHandler) waitAfterTimeout(call *InboundCall, done <-chan handlerResult) {
+	if res := <-done; res.panicked {
+		call.log.Errorf("Handler for %s:%s panicked after its call failed: %v",
+			call.ServiceName(), call.Operation(), res.value)
+	}
+}
+
+// withTimeout returns the context for the handler, which is cancelled once the
+// maximum duration for the operation expires.
+func (h *timeoutHandler) withTimeout(ctx context.Context, operation string) (context.Context, context.CancelFunc) {
+	var (
+		handlerCtx context.Context
+		cancel     context.CancelFunc
+	)
+	timeout := h.opts.timeout(operation)
+	if deadline, ok := ctx.Deadline(); timeout <= 0 || (ok && time.Now().Add(timeout).After(deadline)) {
+		// The call's time to live expires before the maximum duration.
+		handlerCtx, cancel = context.WithCancel(ctx)
+	} else {
+		handlerCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	if headerCtx, ok := ctx.(ContextWithHeaders); ok {
+		return WrapWithHeaders(handlerCtx, headerCtx.Headers()), cancel
+	}
+	return handlerCtx, cancel
+}
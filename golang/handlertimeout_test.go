@@ -0,0 +1,154 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+// sleepHandler reads the call's arguments, then responds once the given delay has
+// passed. If stopOnDone is set, the handler stops without responding once its context
+// is done, and sends the context's error to errC. Otherwise, any error writing the
+// response is sent to errC.
+func sleepHandler(delay time.Duration, stopOnDone bool, errC chan<- error) Handler {
+	return HandlerFunc(func(ctx context.Context, call *InboundCall) {
+		var arg2, arg3 []byte
+		if err := NewArgReader(call.Arg2Reader()).Read(&arg2); err != nil {
+			errC <- err
+			return
+		}
+		if err := NewArgReader(call.Arg3Reader()).Read(&arg3); err != nil {
+			errC <- err
+			return
+		}
+
+		done := ctx.Done()
+		if !stopOnDone {
+			done = nil
+		}
+		select {
+		case <-time.After(delay):
+		case <-done:
+			errC <- ctx.Err()
+			return
+		}
+		if err := NewArgWriter(call.Response().Arg2Writer()).Write(nil); err != nil {
+			errC <- err
+			return
+		}
+		errC <- NewArgWriter(call.Response().Arg3Writer()).Write([]byte("done"))
+	})
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	stats := newRecordingStatsReporter()
+	server, err := NewChannel("svc", &ChannelOptions{StatsReporter: stats})
+	require.NoError(t, err, "NewChannel failed")
+	defer server.Close()
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+
+	errC := make(chan error, 1)
+	opts := HandlerTimeoutOptions{
+		Max:          50 * time.Millisecond,
+		PerOperation: map[string]time.Duration{"slow": time.Second},
+	}
+	server.Register(WithHandlerTimeout(sleepHandler(200*time.Millisecond, false, errC), opts), "capped")
+	server.Register(WithHandlerTimeout(sleepHandler(200*time.Millisecond, false, errC), opts), "slow")
+	server.Register(WithHandlerTimeout(sleepHandler(0, false, errC), opts), "fast")
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	tests := []struct {
+		operation   string
+		wantTimeout bool
+	}{
+		{"capped", true},
+		{"slow", false},
+		{"fast", false},
+	}
+	for _, tt := range tests {
+		ctx, cancel := NewContext(time.Second)
+		started := time.Now()
+		_, arg3, _, err := raw.Call(ctx, client, server.PeerInfo().HostPort, "svc", tt.operation, nil, nil)
+		elapsed := time.Since(started)
+		cancel()
+
+		handlerErr := <-errC
+		if !tt.wantTimeout {
+			assert.NoError(t, err, "%v: call failed", tt.operation)
+			assert.NoError(t, handlerErr, "%v: handler failed to respond", tt.operation)
+			assert.Equal(t, []byte("done"), arg3, "%v: unexpected response", tt.operation)
+			continue
+		}
+
+		assert.Equal(t, ErrCodeTimeout, GetSystemErrorCode(err), "%v: expected timeout, got %v", tt.operation, err)
+		assert.True(t, elapsed < 150*time.Millisecond, "%v: call should fail once the handler times out", tt.operation)
+		assert.Equal(t, ErrTimeout, handlerErr, "%v: handler should not be able to respond after the timeout", tt.operation)
+	}
+
+	timeouts := counterValue(stats, "inbound.calls.handler-timeouts")
+	assert.Equal(t, int64(1), timeouts, "handler-timeouts counter mismatch")
+}
+
+func TestHandlerTimeoutUsesTimeToLive(t *testing.T) {
+	errC := make(chan error, 1)
+	testutils.WithServer(nil, func(ch *Channel, hostPort string) {
+		ch.Register(WithHandlerTimeout(sleepHandler(time.Second, true, errC), HandlerTimeoutOptions{}), "op")
+
+		ctx, cancel := NewContext(50 * time.Millisecond)
+		defer cancel()
+		// The caller's deadline expires at the same time, so it may not see the error frame.
+		_, _, _, err := raw.Call(ctx, ch, hostPort, testutils.DefaultServerName, "op", nil, nil)
+		assert.Error(t, err, "call should time out")
+
+		select {
+		case err := <-errC:
+			assert.Equal(t, context.DeadlineExceeded, err, "handler context should time out")
+		case <-time.After(time.Second):
+			t.Errorf("handler context was not cancelled when the call's time to live expired")
+		}
+	})
+}
+
+func TestHandlerTimeoutPanic(t *testing.T) {
+	// The panic leaves the call's exchange to be cleaned up by the failed response.
+	testutils.WithServer(nil, func(ch *Channel, hostPort string) {
+		h := HandlerFunc(func(ctx context.Context, call *InboundCall) {
+			panic("handler panic")
+		})
+		ch.Register(WithHandlerTimeout(h, HandlerTimeoutOptions{Max: time.Second}), "op")
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		_, _, _, err := raw.Call(ctx, ch, hostPort, testutils.DefaultServerName, "op", nil, nil)
+		assert.Equal(t, ErrCodeUnexpected, GetSystemErrorCode(err), "expected unexpected error, got %v", err)
+	})
+}
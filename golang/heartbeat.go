@@ -0,0 +1,291 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// minHeartbeatInterval is the shortest interval at which heartbeats are sent, so a
+// caller cannot request an excessive number of progress messages.
+const minHeartbeatInterval = 10 * time.Millisecond
+
+// heartbeatQueueSize is the number of progress messages buffered for an outbound call.
+// Progress messages that arrive when the buffer is full are dropped, since any
+// queued message already shows that the call is being handled.
+const heartbeatQueueSize = 16
+
+// InitParamHeartbeats is sent by peers that send heartbeats for calls that request them.
+// Calls to peers that did not send it only start waiting for heartbeats once the first
+// progress message arrives. It is only sent in an init response if the init request
+// contained it, and is never sent by relays, which cannot know whether the peer
+// handling a call sends heartbeats.
+const InitParamHeartbeats = "tchannel_heartbeats"
+
+// HeartbeatOptions are the options for heartbeats on an outbound call.
+//
+// While the call is handled, the handler's peer sends a heartbeat every Interval, and
+// the handler may send its own progress messages using InboundCallResponse.SendProgress.
+// This lets a call that may legitimately take minutes use a generous deadline, while
+// still failing quickly if the peer stops responding.
+type HeartbeatOptions struct {
+	// Interval is how often the handler's peer should send heartbeats.
+	// Intervals shorter than 10ms are rounded up to 10ms.
+	Interval time.Duration
+
+	// Timeout is how long to wait for a heartbeat, progress message or the response
+	// once the request has been sent, before the call fails with ErrCodeTimeout.
+	// If it is not set, the timeout is 3 heartbeat intervals.
+	Timeout time.Duration
+
+	// OnProgress is called with each progress message sent by the handler.
+	OnProgress func(progress string)
+}
+
+// interval returns the interval requested from the handler's peer, which never sends
+// heartbeats more often than minHeartbeatInterval.
+func (o *HeartbeatOptions) interval() time.Duration {
+	if o.Interval > 0 && o.Interval < minHeartbeatInterval {
+		return minHeartbeatInterval
+	}
+	return o.Interval
+}
+
+func (o *HeartbeatOptions) timeout() time.Duration {
+	if o.Timeout > 0 {
+		return o.Timeout
+	}
+	return 3 * o.interval()
+}
+
+// heartbeatMonitor receives the progress messages for an outbound call.
+type heartbeatMonitor struct {
+	opts          *HeartbeatOptions
+	progress      chan string
+	responded     chan struct{}
+	respondedOnce sync.Once
+}
+
+func newHeartbeatMonitor(opts *HeartbeatOptions) *heartbeatMonitor {
+	return &heartbeatMonitor{
+		opts:      opts,
+		progress:  make(chan string, heartbeatQueueSize),
+		responded: make(chan struct{}),
+	}
+}
+
+func (m *heartbeatMonitor) onProgress(progress string) {
+	if progress != "" && m.opts.OnProgress != nil {
+		m.opts.OnProgress(progress)
+	}
+}
+
+// respond stops the monitor once the peer starts responding to the call.
+func (m *heartbeatMonitor) respond() {
+	m.respondedOnce.Do(func() { close(m.responded) })
+}
+
+// heartbeatsSupported records whether the remote peer sends heartbeats.
+func (c *Connection) heartbeatsSupported(params initParams) {
+	c.remoteHeartbeats = params[InitParamHeartbeats] == "1"
+}
+
+// acceptHeartbeats records whether the peer that sent an init request sends heartbeats,
+// and if so, adds the init param to the response unless the connection is relayed.
+func (c *Connection) acceptHeartbeats(reqParams, resParams initParams) {
+	c.heartbeatsSupported(reqParams)
+	if c.remoteHeartbeats && c.relay == nil {
+		resParams[InitParamHeartbeats] = "1"
+	}
+}
+
+// heartbeatInterval returns the heartbeat interval requested by an inbound call,
+// or 0 if the caller did not request heartbeats.
+func heartbeatInterval(headers transportHeaders) time.Duration {
+	ms, err := strconv.ParseInt(headers[Heartbeat], 10, 64)
+	if err != nil || ms <= 0 {
+		return 0
+	}
+	if interval := time.Duration(ms) * time.Millisecond; interval > minHeartbeatInterval {
+		return interval
+	}
+	return minHeartbeatInterval
+}
+
+// startHeartbeats sends heartbeats for an inbound call that requested them, until the
+// call's exchange is removed.
+func (c *Connection) startHeartbeats(call *InboundCall) {
+	interval := heartbeatInterval(call.headers)
+	if interval == 0 {
+		return
+	}
+	call.response.heartbeats = true
+
+	go func() {
+		ticker := c.clock.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				if err := c.sendCallProgress(call.mex.msgID, ""); err != nil {
+					c.log.Debugf("Could not send heartbeat to %s for %d: %v", c.remotePeerInfo, call.mex.msgID, err)
+				}
+			case <-call.mex.removed:
+				return
+			case <-call.mex.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// SendProgress sends a progress message to the caller, which is passed to the
+// caller's HeartbeatOptions.OnProgress. Progress messages also count as heartbeats.
+// It does nothing if the caller did not request heartbeats.
+func (response *InboundCallResponse) SendProgress(progress string) error {
+	if !response.heartbeats {
+		return nil
+	}
+	return response.conn.sendCallProgress(response.mex.msgID, progress)
+}
+
+// sendCallProgress sends a progress message for the given call to the peer.
+func (c *Connection) sendCallProgress(id uint32, progress string) error {
+	frame := c.framePool.Get()
+	if err := frame.write(&callProgress{id: id, progress: progress}); err != nil {
+		c.framePool.Release(frame)
+		return err
+	}
+
+	// Hold the state rlock to ensure that sendCh is not closed as we send the frame.
+	return c.withStateRLock(func() error {
+		if c.state == connectionClosed {
+			c.framePool.Release(frame)
+			return ErrConnectionClosed
+		}
+		select {
+		case c.sendCh <- frame:
+			return nil
+		default:
+			c.framePool.Release(frame)
+			return ErrSendBufferFull
+		}
+	})
+}
+
+// handleCallProgress passes a progress message to the heartbeat monitor of the outbound
+// call it is for. Progress messages for calls that have completed are ignored.
+func (c *Connection) handleCallProgress(frame *Frame) bool {
+	if handled, release := c.relay.relayCallProgress(frame); handled {
+		return release
+	}
+
+	var msg callProgress
+	if err := frame.read(&msg); err != nil {
+		c.log.Warnf("Unable to read progress frame from %s: %v", c.remotePeerInfo, err)
+		return true
+	}
+
+	if monitor := c.outbound.heartbeatMonitor(frame.Header.ID); monitor != nil {
+		select {
+		case monitor.progress <- msg.progress:
+		default:
+		}
+	}
+	return true
+}
+
+// monitorHeartbeats fails an outbound call if no progress messages are received within
+// the heartbeat timeout. It is started once the request has been sent, and returns
+// once the peer starts responding. If the peer did not say that it sends heartbeats,
+// the timeout only starts once the first progress message arrives.
+func (c *Connection) monitorHeartbeats(mex *messageExchange, monitor *heartbeatMonitor, tags map[string]string) {
+	timeout := monitor.opts.timeout()
+	var (
+		timer   Timer
+		timerCh <-chan time.Time
+	)
+	if c.remoteHeartbeats {
+		timer = c.clock.NewTimer(timeout)
+		timerCh = timer.C()
+	}
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case progress := <-monitor.progress:
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = c.clock.NewTimer(timeout)
+			timerCh = timer.C()
+			monitor.onProgress(progress)
+		case <-timerCh:
+			c.statsReporter.IncCounter("outbound.calls.heartbeat-timeouts", tags, 1)
+			c.failExchange(mex, NewSystemError(ErrCodeTimeout,
+				"no heartbeat received from %v for %v", c.remotePeerInfo.HostPort, timeout))
+			return
+		case <-monitor.responded:
+			// Progress sent before the response may not have been handled yet.
+			for {
+				select {
+				case progress := <-monitor.progress:
+					monitor.onProgress(progress)
+				default:
+					return
+				}
+			}
+		case <-mex.removed:
+			return
+		case <-mex.ctx.Done():
+			return
+		}
+	}
+}
+
+// failExchange fails an outbound exchange with the given error, as if the peer had
+// sent the error.
+func (c *Connection) failExchange(mex *messageExchange, err error) {
+	frame := c.framePool.Get()
+	if err := frame.write(&errorMessage{
+		id:      mex.msgID,
+		errCode: GetSystemErrorCode(err),
+		message: err.Error(),
+	}); err != nil {
+		c.framePool.Release(frame)
+		return
+	}
+
+	select {
+	case <-mex.removed:
+		c.framePool.Release(frame)
+		return
+	default:
+	}
+	if err := mex.forwardPeerFrame(frame); err != nil {
+		c.framePool.Release(frame)
+	}
+}
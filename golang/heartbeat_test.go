@@ -0,0 +1,268 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+// heartbeatCall makes a raw call to the "slow" operation with the given heartbeat options.
+func heartbeatCall(ctx context.Context, client *Channel, server *Channel, heartbeat *HeartbeatOptions) ([]byte, error) {
+	call, err := client.BeginCall(ctx, server.PeerInfo().HostPort, server.PeerInfo().ServiceName, "slow",
+		&CallOptions{Format: Raw, Heartbeat: heartbeat})
+	if err != nil {
+		return nil, err
+	}
+
+	_, arg3, _, err := raw.WriteArgs(call, nil, []byte("req"))
+	return arg3, err
+}
+
+func withHeartbeatServer(t *testing.T, handler func(ctx context.Context, call *InboundCall),
+	f func(client, server *Channel)) {
+
+	require.NoError(t, testutils.WithServer(nil, func(server *Channel, hostPort string) {
+		server.Register(HandlerFunc(func(ctx context.Context, call *InboundCall) {
+			var arg2, arg3 []byte
+			require.NoError(t, NewArgReader(call.Arg2Reader()).Read(&arg2), "Read arg2 failed")
+			require.NoError(t, NewArgReader(call.Arg3Reader()).Read(&arg3), "Read arg3 failed")
+			handler(ctx, call)
+		}), "slow")
+
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		f(client, server)
+	}))
+}
+
+func writeResponse(t *testing.T, call *InboundCall, arg3 string) {
+	response := call.Response()
+	require.NoError(t, NewArgWriter(response.Arg2Writer()).Write(nil), "Write arg2 failed")
+	require.NoError(t, NewArgWriter(response.Arg3Writer()).Write([]byte(arg3)), "Write arg3 failed")
+}
+
+func TestHeartbeatProgress(t *testing.T) {
+	handler := func(ctx context.Context, call *InboundCall) {
+		for _, progress := range []string{"25%", "50%", "75%"} {
+			assert.NoError(t, call.Response().SendProgress(progress), "SendProgress failed")
+			time.Sleep(10 * time.Millisecond)
+		}
+		writeResponse(t, call, "done")
+	}
+
+	withHeartbeatServer(t, handler, func(client, server *Channel) {
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		var mut sync.Mutex
+		var progress []string
+		arg3, err := heartbeatCall(ctx, client, server, &HeartbeatOptions{
+			Interval: 20 * time.Millisecond,
+			OnProgress: func(p string) {
+				mut.Lock()
+				progress = append(progress, p)
+				mut.Unlock()
+			},
+		})
+		require.NoError(t, err, "Call failed")
+		assert.Equal(t, "done", string(arg3), "Unexpected response")
+
+		mut.Lock()
+		defer mut.Unlock()
+		assert.Equal(t, []string{"25%", "50%", "75%"}, progress, "Unexpected progress")
+	})
+}
+
+func TestHeartbeatSlowCall(t *testing.T) {
+	handler := func(ctx context.Context, call *InboundCall) {
+		// The handler takes much longer than the heartbeat timeout, but the call
+		// succeeds since heartbeats are sent while it runs.
+		time.Sleep(300 * time.Millisecond)
+		writeResponse(t, call, "slow")
+	}
+
+	withHeartbeatServer(t, handler, func(client, server *Channel) {
+		ctx, cancel := NewContext(5 * time.Second)
+		defer cancel()
+
+		arg3, err := heartbeatCall(ctx, client, server, &HeartbeatOptions{
+			Interval: 20 * time.Millisecond,
+			Timeout:  100 * time.Millisecond,
+		})
+		require.NoError(t, err, "Call failed")
+		assert.Equal(t, "slow", string(arg3), "Unexpected response")
+	})
+}
+
+func TestHeartbeatTimeout(t *testing.T) {
+	release := make(chan struct{})
+	handler := func(ctx context.Context, call *InboundCall) {
+		<-release
+	}
+
+	withHeartbeatServer(t, handler, func(client, server *Channel) {
+		ctx, cancel := NewContext(5 * time.Second)
+		defer cancel()
+
+		// Connect before the server stops sending frames, to simulate a peer that
+		// stops responding while the call is handled.
+		require.NoError(t, client.Ping(ctx, server.PeerInfo().HostPort), "Ping failed")
+		server.SetFaults(&FaultOptions{DropRate: 1})
+		defer server.SetFaults(nil)
+		defer close(release)
+
+		started := time.Now()
+		_, err := heartbeatCall(ctx, client, server, &HeartbeatOptions{
+			Interval: 20 * time.Millisecond,
+			Timeout:  100 * time.Millisecond,
+		})
+		require.Error(t, err, "Call should fail when heartbeats stop")
+		assert.Equal(t, ErrCodeTimeout, GetSystemErrorCode(err), "Unexpected error code")
+		assert.Contains(t, err.Error(), "no heartbeat", "Unexpected error")
+		assert.True(t, time.Since(started) < time.Second, "Call should fail well before its deadline")
+	})
+}
+
+func TestHeartbeatNotRequested(t *testing.T) {
+	handler := func(ctx context.Context, call *InboundCall) {
+		assert.NoError(t, call.Response().SendProgress("ignored"), "SendProgress failed")
+		writeResponse(t, call, "done")
+	}
+
+	withHeartbeatServer(t, handler, func(client, server *Channel) {
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		arg3, err := heartbeatCall(ctx, client, server, nil)
+		require.NoError(t, err, "Call failed")
+		assert.Equal(t, "done", string(arg3), "Unexpected response")
+	})
+}
+
+func TestHeartbeatRelayed(t *testing.T) {
+	handler := func(ctx context.Context, call *InboundCall) {
+		assert.NoError(t, call.Response().SendProgress("relayed"), "SendProgress failed")
+		time.Sleep(100 * time.Millisecond)
+		writeResponse(t, call, "done")
+	}
+
+	withHeartbeatServer(t, handler, func(client, server *Channel) {
+		relay, err := NewChannel("relay", &ChannelOptions{
+			RelayHosts: SimpleRelayHosts{server.PeerInfo().ServiceName: {server.PeerInfo().HostPort}},
+		})
+		require.NoError(t, err, "NewChannel failed")
+		require.NoError(t, relay.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+		defer relay.Close()
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		var mut sync.Mutex
+		var progress []string
+		call, err := client.BeginCall(ctx, relay.PeerInfo().HostPort, server.PeerInfo().ServiceName, "slow",
+			&CallOptions{Format: Raw, Heartbeat: &HeartbeatOptions{
+				Interval: 10 * time.Millisecond,
+				Timeout:  50 * time.Millisecond,
+				OnProgress: func(p string) {
+					mut.Lock()
+					progress = append(progress, p)
+					mut.Unlock()
+				},
+			}})
+		require.NoError(t, err, "BeginCall failed")
+
+		// The handler takes longer than the heartbeat timeout, so heartbeats must be relayed.
+		_, arg3, _, err := raw.WriteArgs(call, nil, []byte("req"))
+		require.NoError(t, err, "Relayed call failed")
+		assert.Equal(t, "done", string(arg3), "Unexpected response")
+
+		mut.Lock()
+		defer mut.Unlock()
+		assert.Equal(t, []string{"relayed"}, progress, "Unexpected progress")
+	})
+}
+
+func TestHeartbeatMinInterval(t *testing.T) {
+	handler := func(ctx context.Context, call *InboundCall) {
+		time.Sleep(100 * time.Millisecond)
+		writeResponse(t, call, "slow")
+	}
+
+	withHeartbeatServer(t, handler, func(client, server *Channel) {
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		// The server never sends heartbeats more often than every 10ms, so the caller
+		// must wait for 3 of those intervals rather than 3 of the requested intervals.
+		arg3, err := heartbeatCall(ctx, client, server, &HeartbeatOptions{Interval: time.Millisecond})
+		require.NoError(t, err, "Call failed")
+		assert.Equal(t, "slow", string(arg3), "Unexpected response")
+	})
+}
+
+func TestHeartbeatPeerWithoutSupport(t *testing.T) {
+	release := make(chan struct{})
+	handler := func(ctx context.Context, call *InboundCall) {
+		<-release
+	}
+
+	withHeartbeatServer(t, handler, func(client, server *Channel) {
+		// The relay hides the client's init param, so the server does not say that it
+		// sends heartbeats, as an older server would.
+		relay := newRecordingRelay(t, server.PeerInfo().HostPort, func(p []byte) []byte {
+			return bytes.Replace(p, []byte(InitParamHeartbeats), []byte("tchannel_heartbeatz"), -1)
+		})
+		defer relay.Close()
+		hostPort := relay.Addr().String()
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		require.NoError(t, client.Ping(ctx, hostPort), "Ping failed")
+		server.SetFaults(&FaultOptions{DropRate: 1})
+		defer server.SetFaults(nil)
+		defer close(release)
+
+		callCtx, callCancel := NewContext(300 * time.Millisecond)
+		defer callCancel()
+		call, err := client.BeginCall(callCtx, hostPort, server.PeerInfo().ServiceName, "slow",
+			&CallOptions{Format: Raw, Heartbeat: &HeartbeatOptions{
+				Interval: 20 * time.Millisecond,
+				Timeout:  50 * time.Millisecond,
+			}})
+		require.NoError(t, err, "BeginCall failed")
+
+		// Without any progress messages, the call is only limited by its deadline.
+		_, _, _, err = raw.WriteArgs(call, nil, []byte("req"))
+		assert.Equal(t, context.DeadlineExceeded, err, "Call should fail at its deadline")
+	})
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultHedgePercentile = 0.95
+	defaultHedgeMinSamples = 100
+	defaultHedgeDelay      = 100 * time.Millisecond
+)
+
+// HedgeOptions are the options used to configure RunWithHedging.
+type HedgeOptions struct {
+	// Percentile is the percentile (between 0 and 1) of the operation's outbound latency
+	// after which a second attempt is made. Defaults to 0.95.
+	Percentile float64
+
+	// MinSamples is the number of latencies that must be recorded for the operation before
+	// the percentile is used. Defaults to 100.
+	MinSamples int64
+
+	// DefaultDelay is the delay used until MinSamples latencies have been recorded.
+	// Defaults to 100 milliseconds.
+	DefaultDelay time.Duration
+
+	// MinDelay is the minimum delay before a second attempt is made.
+	MinDelay time.Duration
+}
+
+// hedgeResult is the result of a single attempt of a hedged request.
+type hedgeResult struct {
+	rs  *RequestState
+	err error
+}
+
+// hedgeDelay returns the delay before a second attempt for the given operation.
+func (c *SubChannel) hedgeDelay(operation string, opts *HedgeOptions) time.Duration {
+	percentile, minSamples, delay := opts.Percentile, opts.MinSamples, opts.DefaultDelay
+	if percentile <= 0 || percentile > 1 {
+		percentile = defaultHedgePercentile
+	}
+	if minSamples <= 0 {
+		minSamples = defaultHedgeMinSamples
+	}
+	if delay <= 0 {
+		delay = defaultHedgeDelay
+	}
+
+	stats := c.topChannel.outboundStats.get(c.ServiceName(), operation)
+	if latency, count := stats.latencyPercentile(percentile); count >= minSamples {
+		delay = latency
+	}
+	if delay < opts.MinDelay {
+		delay = opts.MinDelay
+	}
+	return delay
+}
+
+// RunWithHedging runs f, and if it has not completed after a delay based on the observed
+// latency of the operation, runs f again in parallel using a different peer. The result of
+// the first attempt to succeed is used and the other attempt is canceled. Since both
+// attempts may be processed, this should only be used for read-only, idempotent operations.
+// f should make calls using the subchannel so that the second attempt selects a new peer.
+func (c *SubChannel) RunWithHedging(runCtx context.Context, operation string, opts *HedgeOptions, f RetriableFunc) error {
+	if opts == nil {
+		opts = &HedgeOptions{}
+	}
+
+	ctx, cancel := context.WithCancel(runCtx)
+	defer cancel()
+	if headerCtx, ok := runCtx.(ContextWithHeaders); ok {
+		ctx = WrapWithHeaders(ctx, headerCtx.Headers())
+	}
+
+	// Each attempt is a single call, so attempts are never retried.
+	retryOpts := &RetryOptions{MaxAttempts: 2, RetryOn: RetryNever}
+	start := c.topChannel.clock.Now()
+	results := make(chan hedgeResult, 2)
+	runAttempt := func(rs *RequestState) {
+		go func() {
+			results <- hedgeResult{rs, c.topChannel.runAttempt(ctx, rs, f)}
+		}()
+	}
+
+	first := &RequestState{Start: start, Attempt: 1, retryOpts: retryOpts}
+	runAttempt(first)
+	outstanding := 1
+
+	timer := c.topChannel.clock.NewTimer(c.hedgeDelay(operation, opts))
+	defer timer.Stop()
+
+	for {
+		select {
+		case res := <-results:
+			outstanding--
+			if res.err == nil {
+				if res.rs != first {
+					c.statsReporter.IncCounter("outbound.hedges.won", c.StatsTags(), 1)
+				}
+				return nil
+			}
+			if outstanding == 0 {
+				return res.err
+			}
+		case <-timer.C():
+			hedge := &RequestState{
+				Start:         start,
+				Attempt:       2,
+				SelectedPeers: first.PrevSelectedPeers(),
+				retryOpts:     retryOpts,
+			}
+			c.statsReporter.IncCounter("outbound.hedges", c.StatsTags(), 1)
+			runAttempt(hedge)
+			outstanding++
+		}
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+// hedgeServers creates two servers for "retry-svc". If block is set when a call is
+// received, the call is blocked until release is closed.
+func hedgeServers(t *testing.T, calls []int32, block *int32, release chan struct{}) []*Channel {
+	var servers []*Channel
+	for i := range calls {
+		calls := &calls[i]
+		ch, err := testutils.NewServer(&testutils.ChannelOpts{ServiceName: "retry-svc"})
+		require.NoError(t, err, "NewServer failed")
+		testutils.RegisterFunc(t, ch, "op", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			atomic.AddInt32(calls, 1)
+			if atomic.CompareAndSwapInt32(block, 1, 0) {
+				select {
+				case <-release:
+				case <-ctx.Done():
+				}
+			}
+			return &raw.Res{Arg3: args.Arg3}, nil
+		})
+		servers = append(servers, ch)
+	}
+	return servers
+}
+
+func TestRunWithHedgingSlowPeer(t *testing.T) {
+	calls := make([]int32, 2)
+	var block int32
+	release := make(chan struct{})
+	servers := hedgeServers(t, calls, &block, release)
+	defer close(release)
+	for _, server := range servers {
+		defer server.Close()
+	}
+
+	stats := newRecordingStatsReporter()
+	client, err := testutils.NewClient(&testutils.ChannelOpts{StatsReporter: stats})
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	sc := client.GetSubChannel("retry-svc")
+	for _, server := range servers {
+		sc.Peers().Add(server.PeerInfo().HostPort)
+	}
+
+	// The default delay is not used once enough latencies have been recorded, and the
+	// minimum delay ensures the first attempt has reached a server before the hedge.
+	opts := &HedgeOptions{MinSamples: 5, DefaultDelay: time.Minute, MinDelay: 20 * time.Millisecond}
+	runRequest := func() error {
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		return sc.RunWithHedging(ctx, "op", opts, func(ctx context.Context, rs *RequestState) error {
+			return retryCall(ctx, sc)
+		})
+	}
+	for i := 0; i < 5; i++ {
+		require.NoError(t, runRequest(), "RunWithHedging failed")
+	}
+	tags := sc.StatsTags()
+	assert.Equal(t, int64(0), stats.getStat("outbound.hedges", tags).count, "fast calls should not be hedged")
+
+	before := []int32{atomic.LoadInt32(&calls[0]), atomic.LoadInt32(&calls[1])}
+	atomic.StoreInt32(&block, 1)
+	started := time.Now()
+	require.NoError(t, runRequest(), "RunWithHedging should use the hedged response")
+	assert.True(t, time.Since(started) < 500*time.Millisecond, "hedged call took too long")
+
+	// Each peer should have received one of the two attempts.
+	assert.Equal(t, before[0]+1, atomic.LoadInt32(&calls[0]), "unexpected calls to first peer")
+	assert.Equal(t, before[1]+1, atomic.LoadInt32(&calls[1]), "unexpected calls to second peer")
+	assert.Equal(t, int64(1), stats.getStat("outbound.hedges", tags).count, "hedges counter mismatch")
+	assert.Equal(t, int64(1), stats.getStat("outbound.hedges.won", tags).count, "hedges won counter mismatch")
+}
+
+func TestRunWithHedgingError(t *testing.T) {
+	var calls int32
+	server := newRetryServer(t, &calls, NewSystemError(ErrCodeBadRequest, "bad request"))
+	defer server.Close()
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+	sc := client.GetSubChannel("retry-svc")
+	sc.Peers().Add(server.PeerInfo().HostPort)
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	err = sc.RunWithHedging(ctx, "op", &HedgeOptions{DefaultDelay: time.Second}, func(ctx context.Context, rs *RequestState) error {
+		return retryCall(ctx, sc)
+	})
+	assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(err), "unexpected error")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "errors before the hedge delay should not be hedged")
+}
@@ -0,0 +1,255 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uber/tchannel/golang"
+	"golang.org/x/net/context"
+)
+
+// Headers set on requests forwarded by an Egress, describing the TChannel call.
+const (
+	CallerHeader    = "Rpc-Caller"
+	ProcedureHeader = "Rpc-Procedure"
+	ShardKeyHeader  = "Rpc-Shard-Key"
+
+	// ApplicationHeaderPrefix is the prefix for application headers of calls that do not
+	// use the HTTP format, such as JSON calls.
+	ApplicationHeaderPrefix = "Rpc-Header-"
+)
+
+// EgressOptions configure an Egress.
+type EgressOptions struct {
+	// Client is the HTTP client used to make requests. Defaults to http.DefaultClient.
+	Client *http.Client
+
+	// Logger is used to log errors. Defaults to tchannel.NullLogger.
+	Logger tchannel.Logger
+}
+
+// Egress is a tchannel.Handler that forwards TChannel calls to an HTTP upstream, so
+// that TChannel callers can call HTTP services. Calls using the HTTP format are
+// forwarded as-is. Calls using other formats are sent as a POST to the operation's
+// path with arg3 as the body, and JSON application headers are sent as HTTP headers
+// with ApplicationHeaderPrefix. As HTTP headers are case-insensitive, application
+// headers in responses to JSON calls are returned in lower case. Response headers are
+// sent as soon as the upstream returns them, and the body is streamed as it is received.
+type Egress struct {
+	upstream *url.URL
+	client   *http.Client
+	log      tchannel.Logger
+}
+
+// NewEgress returns an Egress that forwards calls to the given upstream URL. Register
+// it for each operation that should be forwarded.
+func NewEgress(upstream string, opts *EgressOptions) (*Egress, error) {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("upstream must be an absolute URL: %v", upstream)
+	}
+
+	e := &Egress{upstream: u, client: http.DefaultClient, log: tchannel.NullLogger}
+	if opts != nil && opts.Client != nil {
+		e.client = opts.Client
+	}
+	if opts != nil && opts.Logger != nil {
+		e.log = opts.Logger
+	}
+	return e, nil
+}
+
+// Handle implements tchannel.Handler.
+func (e *Egress) Handle(ctx context.Context, call *tchannel.InboundCall) {
+	var arg2, arg3 []byte
+	if err := tchannel.NewArgReader(call.Arg2Reader()).Read(&arg2); err != nil {
+		e.log.Warnf("HTTP egress failed to read arg2: %v", err)
+		return
+	}
+	if err := tchannel.NewArgReader(call.Arg3Reader()).Read(&arg3); err != nil {
+		e.log.Warnf("HTTP egress failed to read arg3: %v", err)
+		return
+	}
+
+	req, err := e.newRequest(call, arg2, arg3)
+	if err != nil {
+		e.sendResponse(call, nil, tchannel.NewBadRequestError("", err))
+		return
+	}
+	req = req.WithContext(ctx)
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set(TimeoutHeader, strconv.FormatInt(int64(deadline.Sub(time.Now())/time.Millisecond), 10))
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = tchannel.ErrTimeout
+		} else {
+			err = tchannel.NewNetworkError("", err)
+		}
+		e.sendResponse(call, nil, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	e.sendResponse(call, resp, nil)
+}
+
+// newRequest creates the HTTP request for a call.
+func (e *Egress) newRequest(call *tchannel.InboundCall, arg2, arg3 []byte) (*http.Request, error) {
+	method, path := "POST", "/"+string(call.Operation())
+	headers := make(http.Header)
+	switch call.Format() {
+	case tchannel.HTTP:
+		var err error
+		if method, path, headers, err = decodeRequestArg2(arg2); err != nil {
+			return nil, fmt.Errorf("invalid HTTP arg2: %v", err)
+		}
+	case tchannel.JSON:
+		var appHeaders map[string]string
+		if len(arg2) > 0 {
+			if err := json.Unmarshal(arg2, &appHeaders); err != nil {
+				return nil, fmt.Errorf("invalid JSON arg2: %v", err)
+			}
+		}
+		for k, v := range appHeaders {
+			headers.Set(ApplicationHeaderPrefix+k, v)
+		}
+	}
+
+	ref, err := url.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	u := *e.upstream
+	u.Path = strings.TrimSuffix(u.Path, "/") + ref.Path
+	if ref.RawQuery != "" {
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += ref.RawQuery
+	}
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(arg3))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = headers
+	req.Header.Set(CallerHeader, call.CallerName())
+	req.Header.Set(ServiceHeader, call.ServiceName())
+	req.Header.Set(ProcedureHeader, string(call.Operation()))
+	if shardKey := call.ShardKey(); shardKey != "" {
+		req.Header.Set(ShardKeyHeader, shardKey)
+	}
+	return req, nil
+}
+
+// errorForStatus returns the system error for HTTP status codes that map to TChannel
+// error codes, for calls that do not use the HTTP format.
+func errorForStatus(statusCode int) error {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return tchannel.ErrServerBusy
+	case http.StatusGatewayTimeout:
+		return tchannel.ErrTimeout
+	case http.StatusBadGateway:
+		return tchannel.NewSystemError(tchannel.ErrCodeNetwork, "%v", http.StatusText(statusCode))
+	}
+	return nil
+}
+
+// sendResponse writes the response for a call. If err is set, it is sent as a system error.
+// The response headers are sent as soon as they are available, and the body is streamed
+// to the caller as it is received from the upstream.
+func (e *Egress) sendResponse(call *tchannel.InboundCall, resp *http.Response, err error) {
+	response := call.Response()
+	var arg2 []byte
+	if err == nil {
+		arg2, err = e.responseArg2(call.Format(), resp)
+	}
+	if err == nil && call.Format() != tchannel.HTTP {
+		err = errorForStatus(resp.StatusCode)
+	}
+	if err != nil {
+		e.log.Warnf("HTTP egress call %v failed: %v", string(call.Operation()), err)
+		if err := response.SendSystemError(err); err != nil {
+			e.log.Warnf("HTTP egress failed to send system error: %v", err)
+		}
+		return
+	}
+
+	if call.Format() != tchannel.HTTP && resp.StatusCode >= 400 {
+		if err := response.SetApplicationError(); err != nil {
+			e.log.Warnf("HTTP egress failed to set application error: %v", err)
+			return
+		}
+	}
+	writer, err := response.SendArg2(arg2)
+	if err != nil {
+		e.log.Warnf("HTTP egress failed to write arg2: %v", err)
+		return
+	}
+	readErr, writeErr := copyFlushing(writer, resp.Body, writer.Flush)
+	if writeErr != nil {
+		e.log.Warnf("HTTP egress failed to write arg3: %v", writeErr)
+		return
+	}
+	if readErr != nil {
+		// The headers have already been sent, so the caller sees the call fail part way
+		// through the body.
+		e.log.Warnf("HTTP egress call %v failed reading the body: %v", string(call.Operation()), readErr)
+		if err := response.SendSystemError(tchannel.NewNetworkError("", readErr)); err != nil {
+			e.log.Warnf("HTTP egress failed to send system error: %v", err)
+		}
+		return
+	}
+	if err := writer.Close(); err != nil {
+		e.log.Warnf("HTTP egress failed to write arg3: %v", err)
+	}
+}
+
+// responseArg2 returns arg2 for the response in the given format.
+func (e *Egress) responseArg2(format tchannel.Format, resp *http.Response) ([]byte, error) {
+	switch format {
+	case tchannel.HTTP:
+		return encodeResponseArg2(resp.StatusCode, resp.Header)
+	case tchannel.JSON:
+		appHeaders := make(map[string]string)
+		for k := range resp.Header {
+			if strings.HasPrefix(k, ApplicationHeaderPrefix) {
+				appHeaders[strings.ToLower(strings.TrimPrefix(k, ApplicationHeaderPrefix))] = resp.Header.Get(k)
+			}
+		}
+		return json.Marshal(appHeaders)
+	}
+	return nil, nil
+}
@@ -0,0 +1,242 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/json"
+	"github.com/uber/tchannel/golang/raw"
+)
+
+// newUpstream returns an HTTP server that echoes the request, or returns the status
+// code in the path for requests to /status/{code}.
+func newUpstream(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/status/") {
+			var code int
+			fmt.Sscan(strings.TrimPrefix(r.URL.Path, "/status/"), &code)
+			w.WriteHeader(code)
+			fmt.Fprintf(w, "status %v", code)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err, "failed to read request body")
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Path", r.URL.Path)
+		w.Header().Set("X-Caller", r.Header.Get(CallerHeader))
+		w.Header().Set("X-Procedure", r.Header.Get(ProcedureHeader))
+		w.Header().Set("X-Has-Timeout", fmt.Sprint(r.Header.Get(TimeoutHeader) != ""))
+		w.Header().Set(ApplicationHeaderPrefix+"Echo", r.Header.Get(ApplicationHeaderPrefix+"Key"))
+		w.Write(body)
+	}))
+}
+
+func newEgressServer(t *testing.T, upstream string) *tchannel.Channel {
+	egress, err := NewEgress(upstream, nil)
+	require.NoError(t, err, "NewEgress failed")
+
+	server, err := tchannel.NewChannel("legacy", nil)
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	server.Register(egress, "users/get")
+	return server
+}
+
+func TestNewEgressInvalidUpstream(t *testing.T) {
+	_, err := NewEgress("/relative", nil)
+	assert.Error(t, err, "NewEgress should fail for relative URLs")
+}
+
+func TestEgressHTTPFormat(t *testing.T) {
+	upstream := newUpstream(t)
+	defer upstream.Close()
+	server := newEgressServer(t, upstream.URL+"/api")
+	defer server.Close()
+
+	// Use the ingress to make HTTP format calls to the egress.
+	client, err := tchannel.NewChannel("http-client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+	client.GetSubChannel("legacy").Peers().Add(server.PeerInfo().HostPort)
+	ingress := httptest.NewServer(NewIngress(client, &IngressOptions{Service: "legacy"}))
+	defer ingress.Close()
+
+	resp, err := http.Post(ingress.URL+"/users/get", "text/plain", bytes.NewReader([]byte("body")))
+	require.NoError(t, err, "HTTP request failed")
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err, "failed to read body")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "status code mismatch")
+	assert.Equal(t, "body", string(body), "body mismatch")
+	assert.Equal(t, "POST", resp.Header.Get("X-Method"), "method mismatch")
+	assert.Equal(t, "/api/users/get", resp.Header.Get("X-Path"), "path mismatch")
+	assert.Equal(t, "http-client", resp.Header.Get("X-Caller"), "caller mismatch")
+	assert.Equal(t, "users/get", resp.Header.Get("X-Procedure"), "procedure mismatch")
+	assert.Equal(t, "true", resp.Header.Get("X-Has-Timeout"), "timeout should be forwarded")
+
+	// Status codes are returned as-is for HTTP format calls.
+	server.Register(mustEgress(t, upstream.URL+"/status"), "404")
+	resp, err = http.Get(ingress.URL + "/404")
+	require.NoError(t, err, "HTTP request failed")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "status code mismatch")
+}
+
+func TestEgressJSONFormat(t *testing.T) {
+	upstream := newUpstream(t)
+	defer upstream.Close()
+	server := newEgressServer(t, upstream.URL)
+	defer server.Close()
+
+	client, err := tchannel.NewChannel("json-client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+	sc := client.GetSubChannel("legacy")
+	sc.Peers().Add(server.PeerInfo().HostPort)
+
+	ctx, cancel := tchannel.NewContext(time.Second)
+	defer cancel()
+	jctx := json.WithHeaders(ctx, map[string]string{"key": "value"})
+	var res map[string]string
+	require.NoError(t, json.CallSC(jctx, sc, "users/get", map[string]string{"id": "1"}, &res), "JSON call failed")
+	assert.Equal(t, map[string]string{"id": "1"}, res, "response mismatch")
+	assert.Equal(t, "value", jctx.ResponseHeaders()["echo"], "application headers should be forwarded")
+}
+
+func TestEgressErrors(t *testing.T) {
+	upstream := newUpstream(t)
+	server := newEgressServer(t, upstream.URL)
+	defer server.Close()
+
+	client, err := tchannel.NewChannel("raw-client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	call := func(operation string) (bool, error) {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		defer cancel()
+		_, _, resp, err := raw.Call(ctx, client, server.PeerInfo().HostPort, "legacy", operation, nil, nil)
+		if err != nil {
+			return false, err
+		}
+		return resp.ApplicationError(), nil
+	}
+
+	tests := []struct {
+		status   int
+		wantCode tchannel.SystemErrCode
+		wantApp  bool
+	}{
+		{status: 200},
+		{status: 404, wantApp: true},
+		{status: 429, wantCode: tchannel.ErrCodeBusy},
+		{status: 503, wantCode: tchannel.ErrCodeBusy},
+		{status: 504, wantCode: tchannel.ErrCodeTimeout},
+		{status: 502, wantCode: tchannel.ErrCodeNetwork},
+	}
+	for _, tt := range tests {
+		operation := fmt.Sprint(tt.status)
+		server.Register(mustEgress(t, upstream.URL+"/status"), operation)
+		appErr, err := call(operation)
+		if tt.wantCode != 0 {
+			assert.Equal(t, tt.wantCode, tchannel.GetSystemErrorCode(err), "status %v: error code mismatch", tt.status)
+			continue
+		}
+		require.NoError(t, err, "status %v: call failed", tt.status)
+		assert.Equal(t, tt.wantApp, appErr, "status %v: application error mismatch", tt.status)
+	}
+
+	upstream.Close()
+	_, err = call("users/get")
+	assert.Equal(t, tchannel.ErrCodeNetwork, tchannel.GetSystemErrorCode(err), "unreachable upstreams should return network errors")
+}
+
+func mustEgress(t *testing.T, upstream string) *Egress {
+	egress, err := NewEgress(upstream, nil)
+	require.NoError(t, err, "NewEgress failed")
+	return egress
+}
+
+func TestEgressStreamsBody(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Resp", "r")
+		w.Write([]byte("first "))
+		w.(http.Flusher).Flush()
+
+		// The rest of the body is only written once the caller has received the start.
+		<-release
+		w.Write([]byte("second"))
+	}))
+	defer upstream.Close()
+	server := newEgressServer(t, upstream.URL)
+	defer server.Close()
+
+	client, err := tchannel.NewChannel("http-client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	ctx, cancel := tchannel.NewContext(time.Second)
+	defer cancel()
+	req, err := http.NewRequest("GET", "/users/get", nil)
+	require.NoError(t, err, "NewRequest failed")
+	arg2, err := encodeRequestArg2(req)
+	require.NoError(t, err, "encodeRequestArg2 failed")
+
+	call, err := client.BeginCall(ctx, server.PeerInfo().HostPort, "legacy", "users/get", &tchannel.CallOptions{Format: tchannel.HTTP})
+	require.NoError(t, err, "BeginCall failed")
+	require.NoError(t, tchannel.NewArgWriter(call.Arg2Writer()).Write(arg2), "write arg2 failed")
+	require.NoError(t, tchannel.NewArgWriter(call.Arg3Writer()).Write(nil), "write arg3 failed")
+
+	response := call.Response()
+	respArg2, err := response.ReadArg2()
+	require.NoError(t, err, "ReadArg2 failed")
+	statusCode, headers, err := decodeResponseArg2(respArg2)
+	require.NoError(t, err, "decodeResponseArg2 failed")
+	assert.Equal(t, http.StatusOK, statusCode, "status code mismatch")
+	assert.Equal(t, "r", headers.Get("X-Resp"), "response header mismatch")
+
+	reader, err := response.Arg3Reader()
+	require.NoError(t, err, "Arg3Reader failed")
+	first := make([]byte, len("first "))
+	_, err = io.ReadFull(reader, first)
+	require.NoError(t, err, "failed to read the start of the body")
+	assert.Equal(t, "first ", string(first), "body mismatch")
+
+	close(release)
+	rest, err := ioutil.ReadAll(reader)
+	require.NoError(t, err, "failed to read body")
+	assert.Equal(t, "second", string(rest), "body mismatch")
+	require.NoError(t, reader.Close(), "close failed")
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// Package http bridges HTTP and TChannel. Calls use the HTTP arg scheme: arg1 is the
+// operation, arg2 contains the HTTP method, URL and headers for requests, and the
+// status code and headers for responses, and arg3 is the body.
+package http
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/typed"
+)
+
+var errHeaderTooLarge = errors.New("HTTP header is too large to encode")
+
+// hopHeaders are the headers that apply to a single HTTP connection, and are not forwarded.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// copyBufferSize is the size of the buffer used to forward bodies.
+const copyBufferSize = 32 * 1024
+
+// copyFlushing copies the body from r to w, calling flush after each write so that data
+// is forwarded as soon as it is available, rather than when buffers fill up. Errors
+// reading from r and writing to w are returned separately, as they are handled differently.
+func copyFlushing(w io.Writer, r io.Reader, flush func() error) (readErr, writeErr error) {
+	buf := make([]byte, copyBufferSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return nil, err
+			}
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return err, nil
+		}
+	}
+}
+
+// forwardedHeaders returns a copy of the headers without hop-by-hop headers.
+func forwardedHeaders(headers http.Header) http.Header {
+	forwarded := make(http.Header, len(headers))
+	for k, v := range headers {
+		forwarded[k] = v
+	}
+	for _, k := range hopHeaders {
+		delete(forwarded, k)
+	}
+	return forwarded
+}
+
+func headersSize(headers http.Header) int {
+	size := 2
+	for k, vs := range headers {
+		for _, v := range vs {
+			size += 2 + len(k) + 2 + len(v)
+		}
+	}
+	return size
+}
+
+// writeHeaders writes the headers as nh~2 (key~2 value~2){nh}. Each value of a header
+// with multiple values is written as a separate pair.
+func writeHeaders(wb *typed.WriteBuffer, headers http.Header) error {
+	numHeaders := wb.DeferUint16()
+	n := 0
+	for k, vs := range headers {
+		for _, v := range vs {
+			if len(k) > 0xFFFF || len(v) > 0xFFFF {
+				return errHeaderTooLarge
+			}
+			wb.WriteLen16String(k)
+			wb.WriteLen16String(v)
+			n++
+		}
+	}
+	if n > 0xFFFF {
+		return errHeaderTooLarge
+	}
+	numHeaders.Update(uint16(n))
+	return wb.Err()
+}
+
+func readHeaders(rb *typed.ReadBuffer) (http.Header, error) {
+	headers := make(http.Header)
+	numHeaders := int(rb.ReadUint16())
+	for i := 0; i < numHeaders; i++ {
+		k := rb.ReadLen16String()
+		v := rb.ReadLen16String()
+		headers.Add(k, v)
+	}
+	return headers, rb.Err()
+}
+
+// encodeRequestArg2 returns arg2 for the request: method~1 url~2 nh~2 (key~2 value~2){nh}
+func encodeRequestArg2(r *http.Request) ([]byte, error) {
+	method, url := r.Method, r.URL.RequestURI()
+	if len(method) > 0xFF || len(url) > 0xFFFF {
+		return nil, errHeaderTooLarge
+	}
+
+	headers := forwardedHeaders(r.Header)
+	buf := make([]byte, 1+len(method)+2+len(url)+headersSize(headers))
+	wb := typed.NewWriteBuffer(buf)
+	wb.WriteLen8String(method)
+	wb.WriteLen16String(url)
+	if err := writeHeaders(wb, headers); err != nil {
+		return nil, err
+	}
+	return buf[:wb.BytesWritten()], nil
+}
+
+// decodeRequestArg2 parses arg2 for a request.
+func decodeRequestArg2(arg2 []byte) (method, url string, headers http.Header, err error) {
+	rb := typed.NewReadBuffer(arg2)
+	method = rb.ReadLen8String()
+	url = rb.ReadLen16String()
+	headers, err = readHeaders(rb)
+	return method, url, headers, err
+}
+
+// encodeResponseArg2 returns arg2 for a response: statusCode:2 message~2 nh~2 (key~2 value~2){nh}
+func encodeResponseArg2(statusCode int, headers http.Header) ([]byte, error) {
+	message := http.StatusText(statusCode)
+	headers = forwardedHeaders(headers)
+	buf := make([]byte, 2+2+len(message)+headersSize(headers))
+	wb := typed.NewWriteBuffer(buf)
+	wb.WriteUint16(uint16(statusCode))
+	wb.WriteLen16String(message)
+	if err := writeHeaders(wb, headers); err != nil {
+		return nil, err
+	}
+	return buf[:wb.BytesWritten()], nil
+}
+
+// decodeResponseArg2 parses arg2 for a response.
+func decodeResponseArg2(arg2 []byte) (statusCode int, headers http.Header, err error) {
+	rb := typed.NewReadBuffer(arg2)
+	statusCode = int(rb.ReadUint16())
+	rb.ReadLen16String()
+	headers, err = readHeaders(rb)
+	return statusCode, headers, err
+}
+
+// StatusForError returns the HTTP status code for an error returned by a TChannel call.
+func StatusForError(err error) int {
+	switch tchannel.ErrorClass(err).Code {
+	case tchannel.ErrCodeTimeout:
+		return http.StatusGatewayTimeout
+	case tchannel.ErrCodeBusy, tchannel.ErrCodeDeclined:
+		return http.StatusServiceUnavailable
+	case tchannel.ErrCodeBadRequest:
+		return http.StatusBadRequest
+	case tchannel.ErrCodeNetwork:
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
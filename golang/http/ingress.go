@@ -0,0 +1,189 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package http
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uber/tchannel/golang"
+)
+
+const (
+	// ServiceHeader is the HTTP header used to select the TChannel service, if the
+	// ingress is not configured with a service.
+	ServiceHeader = "Rpc-Service"
+
+	// TimeoutHeader is the HTTP header used to set the timeout for the call in milliseconds.
+	TimeoutHeader = "Context-TTL-Ms"
+
+	defaultIngressTimeout = time.Second
+)
+
+// IngressOptions configure an Ingress.
+type IngressOptions struct {
+	// Service is the TChannel service that requests are forwarded to. If it is empty,
+	// the service is taken from the ServiceHeader of each request.
+	Service string
+
+	// Operation returns the operation for a request. Defaults to the request's URL
+	// path without the leading "/".
+	Operation func(r *http.Request) string
+
+	// Timeout is the timeout for calls if the request does not set the TimeoutHeader.
+	// Defaults to 1 second.
+	Timeout time.Duration
+}
+
+// Ingress is an http.Handler that forwards HTTP requests as TChannel calls, so that
+// HTTP clients can call TChannel services. Calls are made to the peers of the
+// subchannel for the service. The response status and headers are written as soon as
+// they are received, and the body is streamed to the client as it is received.
+type Ingress struct {
+	ch   *tchannel.Channel
+	opts IngressOptions
+}
+
+// NewIngress returns an Ingress that makes calls using the given channel.
+func NewIngress(ch *tchannel.Channel, opts *IngressOptions) *Ingress {
+	i := &Ingress{ch: ch}
+	if opts != nil {
+		i.opts = *opts
+	}
+	if i.opts.Operation == nil {
+		i.opts.Operation = defaultOperation
+	}
+	if i.opts.Timeout <= 0 {
+		i.opts.Timeout = defaultIngressTimeout
+	}
+	return i
+}
+
+func defaultOperation(r *http.Request) string {
+	return strings.TrimPrefix(r.URL.Path, "/")
+}
+
+func (i *Ingress) timeout(r *http.Request) (time.Duration, error) {
+	ttl := r.Header.Get(TimeoutHeader)
+	if ttl == "" {
+		return i.opts.Timeout, nil
+	}
+	ms, err := strconv.Atoi(ttl)
+	if err != nil || ms <= 0 {
+		return 0, fmt.Errorf("invalid %v header: %q", TimeoutHeader, ttl)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// ServeHTTP implements http.Handler.
+func (i *Ingress) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	service := i.opts.Service
+	if service == "" {
+		service = r.Header.Get(ServiceHeader)
+	}
+	if service == "" {
+		http.Error(w, fmt.Sprintf("missing %v header", ServiceHeader), http.StatusBadRequest)
+		return
+	}
+
+	timeout, err := i.timeout(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	arg2, err := encodeRequestArg2(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestHeaderFieldsTooLarge)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := tchannel.NewContext(timeout)
+	defer cancel()
+
+	sc := i.ch.GetSubChannel(service)
+	call, err := sc.BeginCall(ctx, i.opts.Operation(r), &tchannel.CallOptions{Format: tchannel.HTTP})
+	if err != nil {
+		i.sendError(w, service, err)
+		return
+	}
+	if err := tchannel.NewArgWriter(call.Arg2Writer()).Write(arg2); err != nil {
+		i.sendError(w, service, err)
+		return
+	}
+	if err := tchannel.NewArgWriter(call.Arg3Writer()).Write(body); err != nil {
+		i.sendError(w, service, err)
+		return
+	}
+
+	// The status and headers are written as soon as arg2 is received, and the body is
+	// then streamed to the client as it is received.
+	response := call.Response()
+	respArg2, err := response.ReadArg2()
+	if err != nil {
+		i.sendError(w, service, err)
+		return
+	}
+	statusCode, headers, err := decodeResponseArg2(respArg2)
+	if err != nil {
+		i.sendError(w, service, fmt.Errorf("failed to decode response headers: %v", err))
+		return
+	}
+	reader, err := response.Arg3Reader()
+	if err != nil {
+		i.sendError(w, service, err)
+		return
+	}
+	defer reader.Close()
+
+	for k, vs := range headers {
+		w.Header()[k] = vs
+	}
+	w.WriteHeader(statusCode)
+
+	flush := func() error { return nil }
+	if flusher, ok := w.(http.Flusher); ok {
+		flush = func() error {
+			flusher.Flush()
+			return nil
+		}
+	}
+	flush()
+	if readErr, _ := copyFlushing(w, reader, flush); readErr != nil {
+		// The status has already been sent, so abort the response to make sure the
+		// client does not treat the truncated body as complete.
+		i.ch.Logger().Warnf("HTTP ingress call to %v failed while streaming the body: %v", service, readErr)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (i *Ingress) sendError(w http.ResponseWriter, service string, err error) {
+	i.ch.Logger().Warnf("HTTP ingress call to %v failed: %v", service, err)
+	http.Error(w, err.Error(), StatusForError(err))
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package http
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestArg2RoundTrip(t *testing.T) {
+	r, err := http.NewRequest("PUT", "http://example.com/path?q=1", nil)
+	require.NoError(t, err, "NewRequest failed")
+	r.Header.Add("X-Multi", "a")
+	r.Header.Add("X-Multi", "b")
+	r.Header.Set("Connection", "close")
+
+	arg2, err := encodeRequestArg2(r)
+	require.NoError(t, err, "encodeRequestArg2 failed")
+	method, url, headers, err := decodeRequestArg2(arg2)
+	require.NoError(t, err, "decodeRequestArg2 failed")
+	assert.Equal(t, "PUT", method, "method mismatch")
+	assert.Equal(t, "/path?q=1", url, "url mismatch")
+	assert.Equal(t, http.Header{"X-Multi": {"a", "b"}}, headers, "hop-by-hop headers should not be forwarded")
+
+	arg2, err = encodeResponseArg2(http.StatusTeapot, http.Header{"X-Resp": {"v"}})
+	require.NoError(t, err, "encodeResponseArg2 failed")
+	statusCode, headers, err := decodeResponseArg2(arg2)
+	require.NoError(t, err, "decodeResponseArg2 failed")
+	assert.Equal(t, http.StatusTeapot, statusCode, "status code mismatch")
+	assert.Equal(t, http.Header{"X-Resp": {"v"}}, headers, "response headers mismatch")
+
+	_, _, err = decodeResponseArg2(nil)
+	assert.Error(t, err, "decoding an empty arg2 should fail")
+}
+
+func TestIngress(t *testing.T) {
+	server, err := tchannel.NewChannel("svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+
+	testutils.RegisterFunc(t, server, "users/create", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		assert.Equal(t, tchannel.HTTP, args.Format, "format mismatch")
+		method, url, headers, err := decodeRequestArg2(args.Arg2)
+		require.NoError(t, err, "decodeRequestArg2 failed")
+		assert.Equal(t, "POST", method, "method mismatch")
+		assert.Equal(t, "/users/create?dry=1", url, "url mismatch")
+		assert.Equal(t, "v", headers.Get("X-Req"), "request header mismatch")
+
+		arg2, err := encodeResponseArg2(http.StatusCreated, http.Header{"X-Resp": {"r"}})
+		require.NoError(t, err, "encodeResponseArg2 failed")
+		return &raw.Res{Arg2: arg2, Arg3: append([]byte("created "), args.Arg3...)}, nil
+	})
+	testutils.RegisterFunc(t, server, "slow", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		time.Sleep(100 * time.Millisecond)
+		return &raw.Res{}, nil
+	})
+
+	client, err := tchannel.NewChannel("ingress", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+	client.GetSubChannel("svc").Peers().Add(server.PeerInfo().HostPort)
+
+	ingress := httptest.NewServer(NewIngress(client, nil))
+	defer ingress.Close()
+
+	req, err := http.NewRequest("POST", ingress.URL+"/users/create?dry=1", bytes.NewReader([]byte("alice")))
+	require.NoError(t, err, "NewRequest failed")
+	req.Header.Set(ServiceHeader, "svc")
+	req.Header.Set("X-Req", "v")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err, "HTTP request failed")
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err, "failed to read body")
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, "status code mismatch")
+	assert.Equal(t, "r", resp.Header.Get("X-Resp"), "response header mismatch")
+	assert.Equal(t, "created alice", string(body), "body mismatch")
+
+	tests := []struct {
+		msg        string
+		path       string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{"missing service", "/users/create", nil, http.StatusBadRequest},
+		{"invalid timeout", "/users/create", map[string]string{ServiceHeader: "svc", TimeoutHeader: "x"}, http.StatusBadRequest},
+		{"unknown operation", "/unknown", map[string]string{ServiceHeader: "svc"}, http.StatusBadRequest},
+		{"timeout", "/slow", map[string]string{ServiceHeader: "svc", TimeoutHeader: "20"}, http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", ingress.URL+tt.path, nil)
+		require.NoError(t, err, "NewRequest failed")
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+
+		started := time.Now()
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err, "%v: HTTP request failed", tt.msg)
+		resp.Body.Close()
+		assert.Equal(t, tt.wantStatus, resp.StatusCode, "%v: status code mismatch", tt.msg)
+		assert.True(t, time.Since(started) < time.Second, "%v: took %v", tt.msg, time.Since(started))
+	}
+}
+
+func TestIngressStreamsBody(t *testing.T) {
+	defer testutils.SetTimeout(t, 2*time.Second)()
+	server, err := tchannel.NewChannel("svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+
+	release := make(chan struct{})
+	server.Register(tchannel.HandlerFunc(func(ctx context.Context, call *tchannel.InboundCall) {
+		var arg2, arg3 []byte
+		require.NoError(t, tchannel.NewArgReader(call.Arg2Reader()).Read(&arg2), "read arg2 failed")
+		require.NoError(t, tchannel.NewArgReader(call.Arg3Reader()).Read(&arg3), "read arg3 failed")
+
+		respArg2, err := encodeResponseArg2(http.StatusOK, http.Header{"X-Resp": {"r"}})
+		require.NoError(t, err, "encodeResponseArg2 failed")
+		writer, err := call.Response().SendArg2(respArg2)
+		require.NoError(t, err, "SendArg2 failed")
+		_, err = writer.Write([]byte("first "))
+		require.NoError(t, err, "write failed")
+		require.NoError(t, writer.Flush(), "flush failed")
+
+		// The rest of the body is only written once the client has received the start.
+		<-release
+		_, err = writer.Write([]byte("second"))
+		require.NoError(t, err, "write failed")
+		require.NoError(t, writer.Close(), "close failed")
+	}), "stream")
+
+	client, err := tchannel.NewChannel("ingress", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+	client.GetSubChannel("svc").Peers().Add(server.PeerInfo().HostPort)
+
+	ingress := httptest.NewServer(NewIngress(client, &IngressOptions{Service: "svc"}))
+	defer ingress.Close()
+
+	resp, err := http.Get(ingress.URL + "/stream")
+	require.NoError(t, err, "HTTP request failed")
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "status code mismatch")
+	assert.Equal(t, "r", resp.Header.Get("X-Resp"), "response header mismatch")
+
+	first := make([]byte, len("first "))
+	_, err = io.ReadFull(resp.Body, first)
+	require.NoError(t, err, "failed to read the start of the body")
+	assert.Equal(t, "first ", string(first), "body mismatch")
+
+	close(release)
+	rest, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err, "failed to read body")
+	assert.Equal(t, "second", string(rest), "body mismatch")
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package hyperbahn
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/json"
+)
+
+// DiscoveryRequest is the request sent to Hyperbahn to find the peers for a service.
+type DiscoveryRequest struct {
+	ServiceName string `json:"serviceName"`
+}
+
+// DiscoveryResponse is the response from Hyperbahn for a discovery request.
+type DiscoveryResponse struct {
+	// Peers is the list of host:ports for instances of the service.
+	Peers []string `json:"peers"`
+}
+
+// Discover queries Hyperbahn for the host:ports of instances of the given service.
+func (c *Client) Discover(serviceName string) ([]string, error) {
+	ctx, cancel := json.NewContext(c.opts.Timeout)
+	defer cancel()
+
+	// Disable tracing on Hyperbahn discovery messages to avoid cascading failures.
+	tchannel.CurrentSpan(ctx).EnableTracing(false)
+
+	sc := c.tchan.GetSubChannel(hyperbahnServiceName)
+	var resp DiscoveryResponse
+	if err := json.CallSC(ctx, sc, "discover", &DiscoveryRequest{ServiceName: serviceName}, &resp); err != nil {
+		return nil, err
+	}
+
+	for _, hostPort := range resp.Peers {
+		if _, _, err := net.SplitHostPort(hostPort); err != nil {
+			return nil, fmt.Errorf("hyperbahn discover returned invalid peer %v: %v", hostPort, err)
+		}
+	}
+	return resp.Peers, nil
+}
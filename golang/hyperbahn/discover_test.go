@@ -0,0 +1,63 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package hyperbahn
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/json"
+)
+
+func TestDiscover(t *testing.T) {
+	withSetup(t, func(serverCh *tchannel.Channel, hostPort string) {
+		peers := map[string][]string{
+			"foo": {"1.1.1.1:1", "2.2.2.2:2"},
+			"bad": {"1.1.1.1"},
+		}
+		discoverHandler := func(ctx json.Context, req *DiscoveryRequest) (*DiscoveryResponse, error) {
+			if p, ok := peers[req.ServiceName]; ok {
+				return &DiscoveryResponse{Peers: p}, nil
+			}
+			return nil, errors.New("no peers")
+		}
+		require.NoError(t, json.Register(serverCh, json.Handlers{"discover": discoverHandler}, nil))
+
+		clientCh, err := tchannel.NewChannel("my-client", nil)
+		require.NoError(t, err)
+		defer clientCh.Close()
+
+		client, err := NewClient(clientCh, configFor(hostPort), nil)
+		require.NoError(t, err, "NewClient")
+
+		got, err := client.Discover("foo")
+		require.NoError(t, err, "Discover failed")
+		assert.Equal(t, peers["foo"], got, "Discover returned unexpected peers")
+
+		_, err = client.Discover("bad")
+		assert.Error(t, err, "Discover should fail for invalid peers")
+
+		_, err = client.Discover("unknown")
+		assert.Error(t, err, "Discover should fail when Hyperbahn returns an error")
+	})
+}
@@ -24,6 +24,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"golang.org/x/net/context"
@@ -31,6 +32,10 @@ import (
 
 var errInboundRequestAlreadyActive = errors.New("inbound request is already active; possible duplicate client id")
 
+// errHandlerPanic is the error returned to the caller when a handler panics. The panic
+// value is not included, as it may contain internal details.
+var errHandlerPanic = NewSystemError(ErrCodeUnexpected, "internal error")
+
 // handleCallReq handles an incoming call request, registering a message
 // exchange to receive further fragments for that call, and dispatching it in
 // another goroutine
@@ -48,6 +53,10 @@ func (c *Connection) handleCallReq(frame *Frame) bool {
 		panic(fmt.Errorf("unknown connection state for call req: %v", state))
 	}
 
+	if handled, release := c.relay.relayCallReq(frame); handled {
+		return release
+	}
+
 	callReq := new(callReq)
 	initialFragment, err := parseInboundFragment(c.framePool, frame, callReq)
 	if err != nil {
@@ -58,7 +67,15 @@ func (c *Connection) handleCallReq(frame *Frame) bool {
 
 	c.log.Debugf("span=%s", callReq.Tracing)
 	call := new(InboundCall)
-	ctx, cancel := newIncomingContext(call, callReq.TimeToLive, &callReq.Tracing)
+	call.callerIdentity = c.peerIdentity
+	timeToLive := callReq.TimeToLive
+	if maxTimeToLive := c.subchannels.maxInboundTimeout(string(callReq.Service)); maxTimeToLive > 0 && timeToLive > maxTimeToLive {
+		timeToLive = maxTimeToLive
+	}
+	if maxTimeToLive := c.tagPolicy.maxTimeout(); maxTimeToLive > 0 && timeToLive > maxTimeToLive {
+		timeToLive = maxTimeToLive
+	}
+	ctx, cancel := newIncomingContext(call, timeToLive, &callReq.Tracing)
 
 	mex, err := c.inbound.newExchange(ctx, c.framePool, callReq.messageType(), frame.Header.ID, 512)
 	if err != nil {
@@ -76,6 +93,11 @@ func (c *Connection) handleCallReq(frame *Frame) bool {
 		return true
 	}
 
+	// The first frame of the request is read here rather than from the exchange.
+	if mex.flow != nil {
+		mex.flow.frameConsumed(frame)
+	}
+
 	call.AddBinaryAnnotation(BinaryAnnotation{Key: "cn", Value: callReq.Headers[CallerName]})
 	call.AddBinaryAnnotation(BinaryAnnotation{Key: "as", Value: callReq.Headers[ArgScheme]})
 	call.AddAnnotation(AnnotationKeyServerReceive)
@@ -98,6 +120,7 @@ func (c *Connection) handleCallReq(frame *Frame) bool {
 			call.Report(callReq.Tracing, targetEndpoint, c.traceReporter)
 
 			callRes := new(callRes)
+			callRes.Tracing = response.span
 			callRes.Headers = response.headers
 			callRes.ResponseCode = responseOK
 			if response.applicationError {
@@ -120,9 +143,29 @@ func (c *Connection) handleCallReq(frame *Frame) bool {
 	call.contents = newFragmentingReader(call)
 	call.statsReporter = c.statsReporter
 	call.createStatsTags(c.commonStatsTags)
+	if c.subchannels.serves(call.serviceName) {
+		// The channel may serve several services, so tag calls with the service called.
+		call.commonStatsTags["service"] = call.serviceName
+	}
+	call.statsRecorder = &callStatsRecorder{
+		statsReporter:     c.statsReporter,
+		metricPrefix:      "inbound",
+		commonStatsTags:   call.commonStatsTags,
+		clock:             c.clock,
+		log:               c.log,
+		slowCallThreshold: c.slowCallThreshold,
+		remotePeer:        c.remotePeerInfo,
+		traceID:           callReq.Tracing.TraceID(),
+		ctx:               ctx,
+		sample:            c.payloadSampler.sample("inbound", callReq.Service, c.remotePeerInfo, callReq.Headers),
+	}
+	call.statsRecorder.addRecvBytes(frame.Header.PayloadSize())
+	call.completion = &callCompletion{clock: c.clock}
 
 	response.statsReporter = c.statsReporter
 	response.commonStatsTags = call.commonStatsTags
+	response.statsRecorder = call.statsRecorder
+	response.completion = call.completion
 
 	setResponseHeaders(call.headers, response.headers)
 	go c.dispatchInbound(c.connID, callReq.ID(), call)
@@ -133,6 +176,9 @@ func (c *Connection) handleCallReq(frame *Frame) bool {
 // it to the request channel for that request, where it can be pulled during
 // defragmentation
 func (c *Connection) handleCallReqContinue(frame *Frame) bool {
+	if handled, release := c.relay.relayCallReqContinue(frame); handled {
+		return release
+	}
 	if err := c.inbound.forwardPeerFrame(frame); err != nil {
 		c.inbound.removeExchange(frame.Header.ID)
 		return true
@@ -161,7 +207,7 @@ func (c *Connection) dispatchInbound(_ uint32, _ uint32, call *InboundCall) {
 
 	call.commonStatsTags["endpoint"] = string(call.operation)
 	call.statsReporter.IncCounter("inbound.calls.recvd", call.commonStatsTags, 1)
-	call.response.calledAt = timeNow()
+	call.response.calledAt = c.clock.Now()
 
 	// NB(mmihic): Don't cast operation name to string here - this will
 	// create a copy of the byte array, where as aliasing to string in the
@@ -173,25 +219,177 @@ func (c *Connection) dispatchInbound(_ uint32, _ uint32, call *InboundCall) {
 		c.log.Debugf("Checking the subchannel's handlers for %s:%s", call.ServiceName(), call.Operation())
 		h = c.subchannels.find(call.ServiceName(), call.Operation())
 	}
+	internal := false
+	if h == nil {
+		// Internal handlers (such as introspection) can be called for any service.
+		h = c.internalHandlers[string(call.Operation())]
+		internal = h != nil
+	}
+	if h == nil {
+		h = c.subchannels.findNotFound(call.ServiceName())
+	}
 	if h == nil {
 		c.log.Errorf("Could not find handler for %s:%s", call.ServiceName(), call.Operation())
 		call.mex.shutdown()
+		if call.ServiceName() != c.localPeerInfo.ServiceName && !c.subchannels.serves(call.ServiceName()) {
+			call.Response().SendSystemError(
+				NewSystemError(ErrCodeBadRequest, "service %q is not served by %v", call.ServiceName(), c.localPeerInfo.ServiceName))
+			return
+		}
 		call.Response().SendSystemError(
 			NewSystemError(ErrCodeBadRequest, "no handler for service %q and operation %q", call.ServiceName(), call.Operation()))
 		return
 	}
 
+	if !internal {
+		if err := c.subchannels.maintenanceError(call.ServiceName(), call.Operation()); err != nil {
+			c.log.Debugf("Rejecting call for %s:%s as it is under maintenance", call.ServiceName(), call.Operation())
+			call.statsReporter.IncCounter("inbound.calls.maintenance", call.commonStatsTags, 1)
+			call.mex.shutdown()
+			call.Response().SendSystemError(err)
+			return
+		}
+	}
+
+	call.statsRecorder.endpoint = c.inboundStats.get(call.ServiceName(), string(call.Operation()))
+	call.statsRecorder.startedAt = call.response.calledAt
+	call.completion.startedAt = call.response.calledAt
+	call.statsRecorder.sample.setOperation(string(call.Operation()))
+	call.statsRecorder.audit = c.auditor.forCall(call.mex.ctx, call, c.remotePeerInfo)
+
+	if err := c.authorize(call); err != nil {
+		c.log.Infof("Rejecting call for %s:%s from %s: %v", call.ServiceName(), call.Operation(), call.CallerName(), err)
+		call.statsReporter.IncCounter("inbound.calls.permission-denied", call.commonStatsTags, 1)
+		call.mex.shutdown()
+		call.Response().SendSystemError(ErrPermissionDenied)
+		return
+	}
+
+	if err := c.verifyPayload(call); err != nil {
+		c.log.Infof("Rejecting call for %s:%s from %s as its payload could not be verified: %v",
+			call.ServiceName(), call.Operation(), call.CallerName(), err)
+		call.statsReporter.IncCounter("inbound.calls.invalid-signature", call.commonStatsTags, 1)
+		call.mex.shutdown()
+		call.Response().SendSystemError(err)
+		return
+	}
+
+	if err := c.verifyContentHash(call); err != nil {
+		c.log.Warnf("Rejecting call for %s:%s from %s as its content hash could not be verified: %v",
+			call.ServiceName(), call.Operation(), call.CallerName(), err)
+		call.statsReporter.IncCounter("inbound.calls.content-hash-mismatch", call.commonStatsTags, 1)
+		call.mex.shutdown()
+		call.Response().SendSystemError(err)
+		return
+	}
+
+	if err := c.admission.admit(call); err != nil {
+		c.log.Debugf("Rejecting call for %s:%s as it was not admitted: %v",
+			call.ServiceName(), call.Operation(), err)
+		call.statsReporter.IncCounter("inbound.calls.rejected", call.commonStatsTags, 1)
+		call.mex.shutdown()
+		call.Response().SendSystemError(err)
+		return
+	}
+
+	if err := c.quotas.check(c, call); err != nil {
+		c.log.Debugf("Rejecting call for %s:%s as %s exceeded its quota",
+			call.ServiceName(), call.Operation(), call.CallerName())
+		call.statsReporter.IncCounter("inbound.calls.quota-exceeded", call.commonStatsTags, 1)
+		call.mex.shutdown()
+		call.Response().SendSystemError(err)
+		return
+	}
+
+	if err := c.tagPolicy.acquire(); err != nil {
+		c.log.Debugf("Rejecting call for %s:%s as the concurrency limit for connections tagged %q has been reached",
+			call.ServiceName(), call.Operation(), c.tag)
+		call.statsReporter.IncCounter("inbound.calls.shed", call.commonStatsTags, 1)
+		call.mex.shutdown()
+		call.Response().SendSystemError(err)
+		return
+	}
+	call.completion.tagPolicy = c.tagPolicy
+
+	entry, original, err := c.deduplicator.start(call)
+	if err != nil {
+		c.log.Infof("Rejecting call for %s:%s from %s with idempotency key %q: %v",
+			call.ServiceName(), call.Operation(), call.CallerName(), call.headers[IdempotencyKey], err)
+		call.mex.shutdown()
+		call.Response().SendSystemError(err)
+		return
+	}
+	if entry != nil {
+		if !original {
+			c.replayCall(call, entry)
+			return
+		}
+		call.completion.dedup = &dedupCall{d: c.deduplicator, entry: entry}
+	}
+
+	if err := c.inboundLimiter.acquire(call.mex.ctx); err != nil {
+		c.log.Debugf("Rejecting call for %s:%s as the concurrency limit has been reached: %v",
+			call.ServiceName(), call.Operation(), err)
+		call.statsReporter.IncCounter("inbound.calls.shed", call.commonStatsTags, 1)
+		call.mex.shutdown()
+		call.Response().SendSystemError(err)
+		return
+	}
+	call.completion.limiter = c.inboundLimiter
+
+	inbound, _ := c.interceptorsFor(call.ServiceName())
+	ctx, intercepted, err := interceptInbound(call.mex.ctx, inbound, call.callInfo(c.remotePeerInfo))
+	call.completion.intercepted = intercepted
+	if err != nil {
+		c.log.Debugf("Rejecting call for %s:%s as an interceptor failed: %v",
+			call.ServiceName(), call.Operation(), err)
+		call.statsReporter.IncCounter("inbound.calls.intercepted", call.commonStatsTags, 1)
+		call.mex.shutdown()
+		call.Response().SendSystemError(err)
+		return
+	}
+
 	// TODO(prashant): This is an expensive way to check for cancellation, and is not thread-safe.
 	// We need to figure out a better solution to avoid leaking calls that timeout.
+	// The goroutine exits once the exchange is removed, so completed calls do not leave
+	// it running until their deadline.
 	go func() {
-		<-call.mex.ctx.Done()
-		if call.mex.ctx.Err() != nil {
+		select {
+		case <-call.mex.ctx.Done():
 			call.failed(call.mex.ctx.Err())
+		case <-call.mex.removed:
 		}
 	}()
 
+	c.startHeartbeats(call)
+
 	c.log.Debugf("Dispatching %s:%s from %s", call.ServiceName(), call.Operation(), c.remotePeerInfo)
-	h.Handle(call.mex.ctx, call)
+	defer c.recoverHandlerPanic(call)
+	h.Handle(ctx, call)
+}
+
+// recoverHandlerPanic recovers a panic in the handler for an inbound call, so that it does
+// not crash the process. The panic is logged and counted, and the call fails with an
+// unexpected error if a response has not already been sent.
+func (c *Connection) recoverHandlerPanic(call *InboundCall) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	c.log.WithFields(
+		LogField{"service", call.ServiceName()},
+		LogField{"operation", string(call.Operation())},
+		LogField{"caller", call.CallerName()},
+		LogField{"peer", c.remotePeerInfo},
+		LogField{"requestID", CurrentRequestID(call.mex.ctx)},
+	).Errorf("Handler panicked: %v\n%s", r, captureStack())
+	call.statsReporter.IncCounter("inbound.calls.panics", call.commonStatsTags, 1)
+
+	if call.response.state != reqResWriterComplete {
+		call.mex.shutdown()
+		call.Response().SendSystemError(errHandlerPanic)
+	}
 }
 
 // An InboundCall is an incoming call from a peer
@@ -206,6 +404,29 @@ type InboundCall struct {
 	span            Span
 	statsReporter   StatsReporter
 	commonStatsTags map[string]string
+	callerIdentity  string
+	bufferedArgs    [][]byte
+
+	// handlerLogger and handlerStats are the logger and stats reporter returned by
+	// LoggerFromContext and StatsFromContext, which are created the first time either is used.
+	handlerOnce   sync.Once
+	handlerLogger Logger
+	handlerStats  StatsReporter
+}
+
+// handlerObservability returns the logger and stats reporter for the call's handler.
+// It must only be called once the operation has been read.
+func (call *InboundCall) handlerObservability() (Logger, StatsReporter) {
+	call.handlerOnce.Do(func() {
+		call.handlerLogger = call.log.WithFields(
+			LogField{"service", call.ServiceName()},
+			LogField{"operation", string(call.operation)},
+			LogField{"caller", call.CallerName()},
+			LogField{"traceID", call.span.TraceID()},
+		)
+		call.handlerStats = newTaggedStatsReporter(call.statsReporter, call.commonStatsTags)
+	})
+	return call.handlerLogger, call.handlerStats
 }
 
 // ServiceName returns the name of the service being called
@@ -233,6 +454,17 @@ func (call *InboundCall) ShardKey() string {
 	return call.headers[ShardKey]
 }
 
+// RoutingDelegate returns the routing delegate from the RoutingDelegate transport header.
+func (call *InboundCall) RoutingDelegate() string {
+	return call.headers[RoutingDelegate]
+}
+
+// CallerIdentity returns the identity from the caller's verified TLS client certificate,
+// or an empty string if the caller did not connect using mutual TLS.
+func (call *InboundCall) CallerIdentity() string {
+	return call.callerIdentity
+}
+
 // Reads the entire operation name (arg1) from the request stream.
 func (call *InboundCall) readOperation() error {
 	var arg1 []byte
@@ -247,13 +479,26 @@ func (call *InboundCall) readOperation() error {
 // Arg2Reader returns an io.ReadCloser to read the second argument.
 // The ReadCloser must be closed once the argument has been read.
 func (call *InboundCall) Arg2Reader() (io.ReadCloser, error) {
-	return call.arg2Reader()
+	if call.bufferedArgs != nil {
+		reader, err := bufferedArgReader(call.bufferedArgs[0])
+		return call.statsRecorder.sample.captureReader(sampledRequestArg2, reader, err)
+	}
+	reader, err := call.arg2Reader()
+	return call.statsRecorder.sample.captureReader(sampledRequestArg2, reader, err)
 }
 
 // Arg3Reader returns an io.ReadCloser to read the last argument.
 // The ReadCloser must be closed once the argument has been read.
+// The argument is received as it is read, so it can be streamed without buffering the
+// whole value. If the peer supports flow control, a reader that falls behind slows down
+// the writer.
 func (call *InboundCall) Arg3Reader() (io.ReadCloser, error) {
-	return call.arg3Reader()
+	if call.bufferedArgs != nil {
+		reader, err := bufferedArgReader(call.bufferedArgs[1])
+		return call.statsRecorder.sample.captureReader(sampledRequestArg3, reader, err)
+	}
+	reader, err := call.arg3Reader()
+	return call.statsRecorder.sample.captureReader(sampledRequestArg3, reader, err)
 }
 
 // Response provides access to the InboundCallResponse object which can be used
@@ -276,21 +521,77 @@ type InboundCallResponse struct {
 	span             Span
 	statsReporter    StatsReporter
 	commonStatsTags  map[string]string
+
+	// heartbeats is set if the caller requested heartbeats.
+	heartbeats bool
+
+	// startedMut guards started and timedOut, as a handler timeout may race with the
+	// handler starting to respond.
+	startedMut sync.Mutex
+	started    bool
+	timedOut   bool
+}
+
+// start marks the response as started. It fails if the call has already been failed
+// by a handler timeout.
+func (response *InboundCallResponse) start() error {
+	response.startedMut.Lock()
+	defer response.startedMut.Unlock()
+
+	if response.timedOut {
+		return ErrTimeout
+	}
+	response.started = true
+	return nil
+}
+
+// timeout marks the call as timed out, and returns whether the response can be
+// failed with a timeout, which is only possible if the handler has not started
+// responding.
+func (response *InboundCallResponse) timeout() bool {
+	response.startedMut.Lock()
+	defer response.startedMut.Unlock()
+
+	if response.started || response.timedOut {
+		return false
+	}
+	response.timedOut = true
+	return true
 }
 
 // SendSystemError returns a system error response to the peer.  The call is considered
 // complete after this method is called, and no further data can be written.
 func (response *InboundCallResponse) SendSystemError(err error) error {
+	if err := response.start(); err != nil {
+		return err
+	}
+	return response.sendSystemError(err)
+}
+
+func (response *InboundCallResponse) sendSystemError(err error) error {
+	response.statsRecorder.recordError(err)
+	response.completion.failed(err)
+
+	// Log the request ID, and include it in the error frame, so the error the caller
+	// receives can be correlated with our logs.
+	requestID := CurrentRequestID(response.mex.ctx)
+	if requestID != "" {
+		response.log.WithFields(LogField{"requestID", requestID}).Infof("Sending system error: %v", err)
+	}
+
 	// Fail all future attempts to read fragments
 	response.cancel()
 	response.state = reqResWriterComplete
 
-	return response.conn.SendSystemError(response.mex.msgID, CurrentSpan(response.mex.ctx), err)
+	return response.conn.sendSystemError(response.mex.msgID, CurrentSpan(response.mex.ctx), err, requestID)
 }
 
 // SetApplicationError marks the response as being an application error.  This method can
 // only be called before any arguments have been sent to the calling peer.
 func (response *InboundCallResponse) SetApplicationError() error {
+	if err := response.start(); err != nil {
+		return err
+	}
 	if response.state > reqResWriterPreArg2 {
 		return response.failed(errReqResWriterStateMismatch{
 			state:         response.state,
@@ -304,16 +605,42 @@ func (response *InboundCallResponse) SetApplicationError() error {
 // Arg2Writer returns a WriteCloser that can be used to write the second argument.
 // The returned writer must be closed once the write is complete.
 func (response *InboundCallResponse) Arg2Writer() (ArgWriter, error) {
+	if err := response.start(); err != nil {
+		return nil, err
+	}
 	if err := NewArgWriter(response.arg1Writer()).Write(nil); err != nil {
 		return nil, err
 	}
-	return response.arg2Writer()
+	writer, err := response.arg2Writer()
+	writer, err = response.completion.dedup.captureWriter(sampledResponseArg2, writer, err)
+	return response.statsRecorder.sample.captureWriter(sampledResponseArg2, writer, err)
 }
 
 // Arg3Writer returns a WriteCloser that can be used to write the last argument.
 // The returned writer must be closed once the write is complete.
+// Data is sent as each frame fills up, or when the writer is flushed, so the argument
+// can be streamed without buffering the whole value.
 func (response *InboundCallResponse) Arg3Writer() (ArgWriter, error) {
-	return response.arg3Writer()
+	writer, err := response.arg3Writer()
+	writer, err = response.completion.dedup.captureWriter(sampledResponseArg3, writer, err)
+	return response.statsRecorder.sample.captureWriter(sampledResponseArg3, writer, err)
+}
+
+// SendArg2 writes arg2 and sends it to the caller immediately, before any of arg3 is
+// written, so the caller can act on the response headers while the body is still being
+// produced. It returns the writer for arg3, which must be closed once the body is complete.
+func (response *InboundCallResponse) SendArg2(arg2 []byte) (ArgWriter, error) {
+	if err := NewArgWriter(response.Arg2Writer()).Write(arg2); err != nil {
+		return nil, err
+	}
+	writer, err := response.Arg3Writer()
+	if err != nil {
+		return nil, err
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+	return writer, nil
 }
 
 // doneSending shuts down the message exchange for this call.
@@ -324,8 +651,10 @@ func (response *InboundCallResponse) doneSending() {
 	} else {
 		response.statsReporter.IncCounter("inbound.calls.success", response.commonStatsTags, 1)
 	}
-	latency := timeNow().Sub(response.calledAt)
+	latency := response.conn.clock.Now().Sub(response.calledAt)
 	response.statsReporter.RecordTimer("inbound.calls.latency", response.commonStatsTags, latency)
+	response.statsRecorder.recordSuccess(response.applicationError, latency)
+	response.completion.succeeded(response.applicationError, latency)
 
 	response.mex.shutdown()
 }
@@ -0,0 +1,245 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// CallInfo describes a call to interceptors.
+type CallInfo struct {
+	// ServiceName is the service being called.
+	ServiceName string
+
+	// Operation is the operation (arg1) being called.
+	Operation string
+
+	// Caller is the service name of the caller.
+	Caller string
+
+	// Format is the format of the call's arguments.
+	Format Format
+
+	// Peer is the remote peer: the caller for inbound calls, and the peer being called
+	// for outbound calls.
+	Peer PeerInfo
+
+	// Headers are the call's transport headers. Outbound interceptors can add or change
+	// headers in Before, and the changes are sent with the call.
+	Headers map[TransportHeaderName]string
+}
+
+// CallOutcome describes how a call completed.
+type CallOutcome struct {
+	// Err is the error the call failed with, or nil if it completed.
+	Err error
+
+	// ApplicationError is set if the call completed with an application error.
+	ApplicationError bool
+
+	// Latency is the time from the call starting to it completing or failing.
+	Latency time.Duration
+}
+
+// InboundInterceptor intercepts inbound calls, before they are passed to their handler
+// and once they complete.
+type InboundInterceptor interface {
+	// Before is called before the call is passed to its handler. The returned context
+	// is passed to later interceptors and the handler. If Before returns an error, the
+	// call is rejected with that error, and later interceptors and the handler are not called.
+	Before(ctx context.Context, call *CallInfo) (context.Context, error)
+
+	// After is called once the response has been sent or the call has failed, if
+	// Before was called and did not return an error.
+	After(ctx context.Context, call *CallInfo, outcome CallOutcome)
+}
+
+// OutboundInterceptor intercepts outbound calls, before they are sent and once they complete.
+type OutboundInterceptor interface {
+	// Before is called before the call is sent. If Before returns an error, the call
+	// fails with that error, and later interceptors are not called.
+	Before(ctx context.Context, call *CallInfo) error
+
+	// After is called once the response has been read or the call has failed, if
+	// Before was called and did not return an error.
+	After(ctx context.Context, call *CallInfo, outcome CallOutcome)
+}
+
+// interceptors holds the interceptors registered on a channel or subchannel. Adding an
+// interceptor replaces the slices, so the slices returned by get can be used without a lock.
+type interceptors struct {
+	mut      sync.RWMutex
+	inbound  []InboundInterceptor
+	outbound []OutboundInterceptor
+}
+
+func (i *interceptors) addInbound(add []InboundInterceptor) {
+	i.mut.Lock()
+	i.inbound = append(i.inbound[:len(i.inbound):len(i.inbound)], add...)
+	i.mut.Unlock()
+}
+
+func (i *interceptors) addOutbound(add []OutboundInterceptor) {
+	i.mut.Lock()
+	i.outbound = append(i.outbound[:len(i.outbound):len(i.outbound)], add...)
+	i.mut.Unlock()
+}
+
+func (i *interceptors) get() ([]InboundInterceptor, []OutboundInterceptor) {
+	i.mut.RLock()
+	defer i.mut.RUnlock()
+	return i.inbound, i.outbound
+}
+
+// UseInbound adds interceptors for inbound calls to the channel, including calls
+// handled by its subchannels. Interceptors are called in the order they are added,
+// and After is called in the reverse order.
+func (ch *Channel) UseInbound(interceptors ...InboundInterceptor) {
+	ch.interceptors.addInbound(interceptors)
+}
+
+// UseOutbound adds interceptors for outbound calls made using the channel, including
+// calls made using its subchannels. Interceptors are called in the order they are added,
+// and After is called in the reverse order.
+func (ch *Channel) UseOutbound(interceptors ...OutboundInterceptor) {
+	ch.interceptors.addOutbound(interceptors)
+}
+
+// UseInbound adds interceptors for inbound calls to the subchannel's service. They are
+// called after the channel's interceptors.
+func (c *SubChannel) UseInbound(interceptors ...InboundInterceptor) {
+	c.interceptors.addInbound(interceptors)
+}
+
+// UseOutbound adds interceptors for outbound calls to the subchannel's service. They
+// are called after the channel's interceptors.
+func (c *SubChannel) UseOutbound(interceptors ...OutboundInterceptor) {
+	c.interceptors.addOutbound(interceptors)
+}
+
+// interceptorsFor returns the channel's interceptors followed by those of the
+// subchannel for the given service, if any.
+func (c *Connection) interceptorsFor(serviceName string) ([]InboundInterceptor, []OutboundInterceptor) {
+	inbound, outbound := c.interceptors.get()
+	sc, ok := c.subchannels.get(serviceName)
+	if !ok {
+		return inbound, outbound
+	}
+
+	scInbound, scOutbound := sc.interceptors.get()
+	if len(scInbound) > 0 {
+		inbound = append(inbound[:len(inbound):len(inbound)], scInbound...)
+	}
+	if len(scOutbound) > 0 {
+		outbound = append(outbound[:len(outbound):len(outbound)], scOutbound...)
+	}
+	return inbound, outbound
+}
+
+// interceptedCall tracks the interceptors whose Before was called for a call, so their
+// After can be called once the call completes.
+type interceptedCall struct {
+	ctx      context.Context
+	info     *CallInfo
+	inbound  []InboundInterceptor
+	outbound []OutboundInterceptor
+}
+
+// interceptInbound calls Before on the inbound interceptors for a call. It returns the
+// context for the handler, and the intercepted call, which is nil if there are no
+// interceptors.
+func interceptInbound(ctx context.Context, interceptors []InboundInterceptor, info *CallInfo) (
+	context.Context, *interceptedCall, error) {
+
+	if len(interceptors) == 0 {
+		return ctx, nil, nil
+	}
+
+	ic := &interceptedCall{info: info}
+	for _, i := range interceptors {
+		newCtx, err := i.Before(ctx, info)
+		if err != nil {
+			ic.ctx = ctx
+			return ctx, ic, err
+		}
+		ctx = newCtx
+		ic.inbound = append(ic.inbound, i)
+	}
+	ic.ctx = ctx
+	return ctx, ic, nil
+}
+
+// interceptOutbound calls Before on the outbound interceptors for a call. It returns
+// the intercepted call, which is nil if there are no interceptors.
+func interceptOutbound(ctx context.Context, interceptors []OutboundInterceptor, info *CallInfo) (
+	*interceptedCall, error) {
+
+	if len(interceptors) == 0 {
+		return nil, nil
+	}
+
+	ic := &interceptedCall{ctx: ctx, info: info}
+	for _, i := range interceptors {
+		if err := i.Before(ctx, info); err != nil {
+			return ic, err
+		}
+		ic.outbound = append(ic.outbound, i)
+	}
+	return ic, nil
+}
+
+// after calls After on the interceptors whose Before was called, in reverse order.
+func (ic *interceptedCall) after(outcome CallOutcome) {
+	if ic == nil {
+		return
+	}
+
+	for i := len(ic.inbound) - 1; i >= 0; i-- {
+		ic.inbound[i].After(ic.ctx, ic.info, outcome)
+	}
+	for i := len(ic.outbound) - 1; i >= 0; i-- {
+		ic.outbound[i].After(ic.ctx, ic.info, outcome)
+	}
+}
+
+// callInfo returns the CallInfo for an inbound call from the given peer.
+func (call *InboundCall) callInfo(peer PeerInfo) *CallInfo {
+	return &CallInfo{
+		ServiceName: call.ServiceName(),
+		Operation:   string(call.Operation()),
+		Caller:      call.CallerName(),
+		Format:      call.Format(),
+		Peer:        peer,
+		Headers:     copyHeaders(call.headers),
+	}
+}
+
+// copyHeaders returns a copy of transport headers for inbound interceptors, so they
+// cannot change the call's headers.
+func copyHeaders(headers transportHeaders) map[TransportHeaderName]string {
+	copied := make(map[TransportHeaderName]string, len(headers))
+	for k, v := range headers {
+		copied[k] = v
+	}
+	return copied
+}
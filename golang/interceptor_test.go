@@ -0,0 +1,229 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+type interceptorKey struct{}
+
+// interceptorLog records the calls made to test interceptors.
+type interceptorLog struct {
+	sync.Mutex
+	events   []string
+	infos    []CallInfo
+	outcomes []CallOutcome
+}
+
+func (l *interceptorLog) add(event string, info *CallInfo) {
+	l.Lock()
+	l.events = append(l.events, event)
+	l.infos = append(l.infos, *info)
+	l.Unlock()
+}
+
+func (l *interceptorLog) addOutcome(event string, info *CallInfo, outcome CallOutcome) {
+	l.Lock()
+	l.events = append(l.events, event)
+	l.outcomes = append(l.outcomes, outcome)
+	l.Unlock()
+}
+
+func (l *interceptorLog) get() ([]string, []CallInfo, []CallOutcome) {
+	l.Lock()
+	defer l.Unlock()
+	return l.events, l.infos, l.outcomes
+}
+
+type testInbound struct {
+	name string
+	log  *interceptorLog
+	err  error
+}
+
+func (i testInbound) Before(ctx context.Context, call *CallInfo) (context.Context, error) {
+	i.log.add(i.name+".before", call)
+	if i.err != nil {
+		return nil, i.err
+	}
+	return context.WithValue(ctx, interceptorKey{}, i.name), nil
+}
+
+func (i testInbound) After(ctx context.Context, call *CallInfo, outcome CallOutcome) {
+	i.log.addOutcome(i.name+".after", call, outcome)
+}
+
+type testOutbound struct {
+	name string
+	log  *interceptorLog
+	err  error
+}
+
+func (i testOutbound) Before(ctx context.Context, call *CallInfo) error {
+	i.log.add(i.name+".before", call)
+	call.Headers["intercepted-by"] = i.name
+	return i.err
+}
+
+func (i testOutbound) After(ctx context.Context, call *CallInfo, outcome CallOutcome) {
+	i.log.addOutcome(i.name+".after", call, outcome)
+}
+
+func TestInterceptors(t *testing.T) {
+	testutils.WithTestClientServer(t, nil, func(client, server *Channel, hostPort string) {
+		var inbound, outbound interceptorLog
+		server.UseInbound(testInbound{name: "ch", log: &inbound})
+		server.GetSubChannel(testutils.DefaultServerName).UseInbound(testInbound{name: "sc", log: &inbound})
+		client.UseOutbound(testOutbound{name: "ch", log: &outbound})
+		client.GetSubChannel(testutils.DefaultServerName).UseOutbound(testOutbound{name: "sc", log: &outbound})
+
+		handlerCtx := make(chan interface{}, 1)
+		testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			handlerCtx <- ctx.Value(interceptorKey{})
+			return &raw.Res{Arg3: args.Arg3}, nil
+		})
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		_, arg3, _, err := raw.Call(ctx, client, hostPort, testutils.DefaultServerName, "echo", nil, []byte("hello"))
+		require.NoError(t, err, "Call failed")
+		assert.Equal(t, "hello", string(arg3), "Unexpected response")
+		assert.Equal(t, "sc", <-handlerCtx, "Handler should get the context from the last interceptor")
+
+		// The server records the outcome after sending the response, which may be after
+		// the client has read it.
+		testutils.WaitFor(time.Second, func() bool {
+			events, _, _ := inbound.get()
+			return len(events) == 4
+		})
+
+		events, infos, outcomes := outbound.get()
+		assert.Equal(t, []string{"ch.before", "sc.before", "sc.after", "ch.after"}, events, "Unexpected outbound events")
+		for _, info := range infos {
+			assert.Equal(t, testutils.DefaultServerName, info.ServiceName, "Unexpected outbound service")
+			assert.Equal(t, "echo", info.Operation, "Unexpected outbound operation")
+			assert.Equal(t, client.PeerInfo().ServiceName, info.Caller, "Unexpected outbound caller")
+			assert.Equal(t, Raw, info.Format, "Unexpected outbound format")
+			assert.Equal(t, hostPort, info.Peer.HostPort, "Unexpected outbound peer")
+		}
+		for _, outcome := range outcomes {
+			assert.NoError(t, outcome.Err, "Unexpected outbound error")
+			assert.False(t, outcome.ApplicationError, "Unexpected outbound application error")
+			assert.True(t, outcome.Latency > 0, "Outbound latency should be recorded")
+		}
+
+		events, infos, outcomes = inbound.get()
+		assert.Equal(t, []string{"ch.before", "sc.before", "sc.after", "ch.after"}, events, "Unexpected inbound events")
+		for _, info := range infos {
+			assert.Equal(t, "echo", info.Operation, "Unexpected inbound operation")
+			assert.Equal(t, client.PeerInfo().ServiceName, info.Caller, "Unexpected inbound caller")
+			assert.Equal(t, "sc", info.Headers["intercepted-by"], "Outbound interceptors should be able to set headers")
+		}
+		for _, outcome := range outcomes {
+			assert.NoError(t, outcome.Err, "Unexpected inbound error")
+		}
+	})
+}
+
+func TestInterceptorOutcomes(t *testing.T) {
+	testutils.WithTestClientServer(t, nil, func(client, server *Channel, hostPort string) {
+		var inbound, outbound interceptorLog
+		server.UseInbound(testInbound{name: "in", log: &inbound})
+		client.UseOutbound(testOutbound{name: "out", log: &outbound})
+
+		testutils.RegisterFunc(t, server, "app", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			return &raw.Res{IsErr: true}, nil
+		})
+		testutils.RegisterFunc(t, server, "busy", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			return &raw.Res{SystemErr: ErrServerBusy}, nil
+		})
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		for _, op := range []string{"app", "busy"} {
+			raw.Call(ctx, client, hostPort, testutils.DefaultServerName, op, nil, nil)
+		}
+		testutils.WaitFor(time.Second, func() bool {
+			events, _, _ := inbound.get()
+			return len(events) == 4
+		})
+
+		for _, log := range []*interceptorLog{&inbound, &outbound} {
+			_, _, outcomes := log.get()
+			require.Equal(t, 2, len(outcomes), "Unexpected number of outcomes")
+			assert.True(t, outcomes[0].ApplicationError, "Expected an application error")
+			assert.NoError(t, outcomes[0].Err, "Application errors are not call errors")
+			assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(outcomes[1].Err), "Unexpected error: %v", outcomes[1].Err)
+		}
+	})
+}
+
+func TestInterceptorRejects(t *testing.T) {
+	// Rejected calls leave their request frames unread, which the leak checks report as
+	// frames that were not released, so the server is not leak checked.
+	require.NoError(t, testutils.WithServer(nil, func(server *Channel, hostPort string) {
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		var inbound, outbound interceptorLog
+		server.UseInbound(
+			testInbound{name: "allow", log: &inbound},
+			testInbound{name: "deny", log: &inbound, err: ErrServerBusy},
+			testInbound{name: "unreached", log: &inbound},
+		)
+		var called bool
+		testutils.RegisterFunc(t, server, "op", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			called = true
+			return &raw.Res{}, nil
+		})
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		_, _, _, err = raw.Call(ctx, client, hostPort, testutils.DefaultServerName, "op", nil, nil)
+		assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(err), "Unexpected error: %v", err)
+		assert.False(t, called, "Handler should not be called for rejected calls")
+		events, _, _ := inbound.get()
+		assert.Equal(t, []string{"allow.before", "deny.before", "allow.after"}, events, "Unexpected inbound events")
+
+		errDenied := errors.New("denied")
+		client.UseOutbound(
+			testOutbound{name: "allow", log: &outbound},
+			testOutbound{name: "deny", log: &outbound, err: errDenied},
+		)
+		_, _, _, err = raw.Call(ctx, client, hostPort, testutils.DefaultServerName, "op", nil, nil)
+		assert.Equal(t, errDenied, err, "Unexpected error")
+		events, _, outcomes := outbound.get()
+		assert.Equal(t, []string{"allow.before", "deny.before", "allow.after"}, events, "Unexpected outbound events")
+		assert.Equal(t, []CallOutcome{{Err: errDenied}}, outcomes, "Unexpected outbound outcome")
+	}))
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/json"
+	"github.com/uber/tchannel/golang/raw"
+)
+
+// The interop tests call a reference test server from another implementation, as
+// described in docs/cross_language_testing. For example:
+//
+//	go test -run Interop -interopServer "make -C ../node test_server"
+var flagInteropServer = flag.String("interopServer", "", "Command that starts a reference TChannel test server for interop tests")
+
+// startInteropServer runs the interop server command, and returns the host:port that
+// the server prints once it is listening.
+func startInteropServer(t *testing.T) (string, func()) {
+	if *flagInteropServer == "" {
+		t.Skip("Skipping interop test as interopServer is not set")
+	}
+
+	// Run the server in its own process group, so that any processes it starts are
+	// also stopped.
+	cmd := exec.Command("sh", "-c", *flagInteropServer)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err, "StdoutPipe failed")
+	require.NoError(t, cmd.Start(), "failed to start interop server")
+	stop := func() {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		cmd.Wait()
+	}
+
+	hostPortC := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if line := scanner.Text(); strings.HasPrefix(line, "listening on ") {
+				hostPortC <- strings.TrimPrefix(line, "listening on ")
+				break
+			}
+		}
+		// Keep reading so the server does not block writing to stdout.
+		for scanner.Scan() {
+		}
+	}()
+
+	select {
+	case hostPort := <-hostPortC:
+		return hostPort, stop
+	case <-time.After(time.Minute):
+		stop()
+		t.Fatalf("interop server did not start listening")
+		return "", nil
+	}
+}
+
+func TestInterop(t *testing.T) {
+	hostPort, stop := startInteropServer(t)
+	defer stop()
+
+	ch, err := NewChannel("interop-client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+
+	// Raw echo, including payloads that are fragmented across many frames.
+	for _, size := range []int{0, 10, 100000} {
+		ctx, cancel := NewContext(5 * time.Second)
+		arg3 := bytes.Repeat([]byte("x"), size)
+		arg2, resArg3, resp, err := raw.Call(ctx, ch, hostPort, "test_as_raw", "echo", []byte("arg2"), arg3)
+		cancel()
+		if assert.NoError(t, err, "raw echo with %v bytes failed", size) {
+			assert.False(t, resp.ApplicationError(), "raw echo should not return an application error")
+			assert.Equal(t, []byte("arg2"), arg2, "raw echo arg2 mismatch")
+			assert.Equal(t, arg3, resArg3, "raw echo with %v bytes arg3 mismatch", size)
+		}
+	}
+
+	// JSON echo, which checks the encoding of the application headers.
+	ctx, cancel := json.NewContext(5 * time.Second)
+	ctx = json.WithHeaders(ctx, map[string]string{"key": "value"})
+	var res map[string]interface{}
+	sc := ch.GetSubChannel("test_kv_as_json")
+	sc.Peers().Add(hostPort)
+	err = json.CallSC(ctx, sc, "echo", map[string]interface{}{"a": "b"}, &res)
+	cancel()
+	if assert.NoError(t, err, "json echo failed") {
+		assert.Equal(t, map[string]interface{}{"a": "b"}, res, "json echo mismatch")
+		assert.Equal(t, map[string]string{"key": "value"}, ctx.ResponseHeaders(), "json echo headers mismatch")
+	}
+
+	// Calls to unknown services fail with a bad request error frame.
+	ctx2, cancel2 := NewContext(5 * time.Second)
+	_, _, _, err = raw.Call(ctx2, ch, hostPort, "unknown-service", "echo", nil, nil)
+	cancel2()
+	assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(err), "unknown service error mismatch: %v", err)
+}
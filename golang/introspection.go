@@ -0,0 +1,331 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"encoding/json"
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// IntrospectOperation is the operation name of the built-in endpoint that returns
+	// the channel's runtime state as JSON. It can be called for any service name, and
+	// is only available if the channel's EnableIntrospection option is set.
+	IntrospectOperation = "_channel_introspect"
+)
+
+// IntrospectionOptions control the amount of detail returned by IntrospectState.
+type IntrospectionOptions struct {
+	// IncludeExchanges will include the individual message exchanges for each connection.
+	IncludeExchanges bool `json:"includeExchanges"`
+
+	// IncludeEmptyPeers will include peers that do not have any connections.
+	IncludeEmptyPeers bool `json:"includeEmptyPeers"`
+
+	// IncludePayloadSamples will include the call payloads captured by the payload sampler.
+	IncludePayloadSamples bool `json:"includePayloadSamples"`
+}
+
+// RuntimeState is a snapshot of the runtime state of a channel.
+type RuntimeState struct {
+	// LocalPeer is the local peer information (service name, host-port, process name).
+	LocalPeer LocalPeerInfo `json:"localPeer"`
+
+	// State is the current state of the channel.
+	State string `json:"state"`
+
+	// Options are the options the channel was created with.
+	Options OptionsRuntimeState `json:"options"`
+
+	// Version is the version information for the library and the Go runtime.
+	Version VersionRuntimeState `json:"version"`
+
+	// Handlers is a map from service name to the operations registered for that service.
+	Handlers map[string][]string `json:"handlers"`
+
+	// Operations is a map from service name to the information for each registered operation.
+	Operations map[string][]OperationInfo `json:"operations"`
+
+	// SubChannels is the list of service names that have subchannels.
+	SubChannels []string `json:"subChannels"`
+
+	// Services is the list of service names that the channel serves, see Channel.ServiceNames.
+	Services []string `json:"services"`
+
+	// Peers contains the state of each peer, keyed by the peer's host:port.
+	Peers map[string]PeerRuntimeState `json:"peers"`
+
+	// InboundEndpoints contains call statistics for inbound calls, keyed by "service::operation".
+	InboundEndpoints map[string]EndpointStats `json:"inboundEndpoints"`
+
+	// OutboundEndpoints contains call statistics for outbound calls, keyed by "service::operation".
+	OutboundEndpoints map[string]EndpointStats `json:"outboundEndpoints"`
+
+	// PayloadSamples are the sampled call payloads, if requested and payload sampling is enabled.
+	PayloadSamples []PayloadSample `json:"payloadSamples,omitempty"`
+
+	// CircuitBreakers contains the state of each circuit breaker, if circuit breakers are enabled.
+	CircuitBreakers []CircuitBreakerRuntimeState `json:"circuitBreakers,omitempty"`
+}
+
+// OptionsRuntimeState is the set of options the channel is using.
+type OptionsRuntimeState struct {
+	ProcessName    string       `json:"processName"`
+	ChecksumType   ChecksumType `json:"checksumType"`
+	SendBufferSize int          `json:"sendBufferSize"`
+	RecvBufferSize int          `json:"recvBufferSize"`
+}
+
+// VersionRuntimeState contains version information.
+type VersionRuntimeState struct {
+	TChannel        string   `json:"tchannel"`
+	ProtocolVersion int      `json:"protocolVersion"`
+	Go              string   `json:"go"`
+	Features        []string `json:"features"`
+}
+
+// PeerRuntimeState is the runtime state for a single peer.
+type PeerRuntimeState struct {
+	HostPort    string                   `json:"hostPort"`
+	RTT         time.Duration            `json:"rtt"`
+	Throughput  Throughput               `json:"throughput"`
+	QueuedCalls int                      `json:"queuedCalls,omitempty"`
+	Draining    bool                     `json:"draining,omitempty"`
+	Connections []ConnectionRuntimeState `json:"connections"`
+}
+
+// ConnectionRuntimeState is the runtime state for a single connection.
+type ConnectionRuntimeState struct {
+	ID               uint32               `json:"id"`
+	ConnectionState  string               `json:"connectionState"`
+	LocalHostPort    string               `json:"localHostPort"`
+	RemoteHostPort   string               `json:"remoteHostPort"`
+	RemotePeer       PeerInfo             `json:"remotePeer"`
+	Tag              string               `json:"tag,omitempty"`
+	RTT              time.Duration        `json:"rtt"`
+	Throughput       Throughput           `json:"throughput"`
+	InboundExchange  ExchangeRuntimeState `json:"inboundExchange"`
+	OutboundExchange ExchangeRuntimeState `json:"outboundExchange"`
+}
+
+// ExchangeRuntimeState is the runtime state for a message exchange set.
+type ExchangeRuntimeState struct {
+	Name      string                          `json:"name"`
+	Count     int                             `json:"count"`
+	Exchanges map[string]ExchangeStateSummary `json:"exchanges,omitempty"`
+}
+
+// ExchangeStateSummary is the state of a single message exchange.
+type ExchangeStateSummary struct {
+	ID          uint32 `json:"id"`
+	MessageType string `json:"messageType"`
+}
+
+// IntrospectState returns the runtime state of the channel.
+// If opts is nil, the default options are used.
+func (ch *Channel) IntrospectState(opts *IntrospectionOptions) *RuntimeState {
+	if opts == nil {
+		opts = &IntrospectionOptions{}
+	}
+
+	ch.mutable.mut.RLock()
+	localPeer := ch.mutable.peerInfo
+	state := ch.mutable.state
+	ch.mutable.mut.RUnlock()
+
+	var payloadSamples []PayloadSample
+	if opts.IncludePayloadSamples {
+		payloadSamples = ch.PayloadSamples()
+	}
+
+	return &RuntimeState{
+		LocalPeer: localPeer,
+		State:     state.String(),
+		Options: OptionsRuntimeState{
+			ProcessName:    localPeer.ProcessName,
+			ChecksumType:   ch.connectionOptions.ChecksumType,
+			SendBufferSize: ch.connectionOptions.SendBufferSize,
+			RecvBufferSize: ch.connectionOptions.RecvBufferSize,
+		},
+		Version: VersionRuntimeState{
+			TChannel:        VersionInfo,
+			ProtocolVersion: CurrentProtocolVersion,
+			Go:              runtime.Version(),
+			Features:        ProtocolFeatures(),
+		},
+		Handlers:    ch.registeredOperations(),
+		Operations:  ch.registeredOperationInfos(),
+		SubChannels: ch.subChannels.serviceNames(),
+		Services:    ch.ServiceNames(),
+		Peers:       ch.peers.IntrospectState(opts),
+
+		InboundEndpoints:  ch.inboundStats.snapshot(),
+		OutboundEndpoints: ch.outboundStats.snapshot(),
+		PayloadSamples:    payloadSamples,
+		CircuitBreakers:   ch.circuitBreakers.IntrospectState(),
+	}
+}
+
+// registeredOperations returns the operations registered on the channel and all subchannels.
+func (ch *Channel) registeredOperations() map[string][]string {
+	ops := ch.handlers.operations()
+	for _, serviceName := range ch.subChannels.serviceNames() {
+		sc, _ := ch.subChannels.get(serviceName)
+		for svc, svcOps := range sc.handlers.operations() {
+			ops[svc] = append(ops[svc], svcOps...)
+		}
+	}
+	for _, svcOps := range ops {
+		sort.Strings(svcOps)
+	}
+	return ops
+}
+
+// registeredOperationInfos returns the information for the operations registered on the
+// channel and all subchannels.
+func (ch *Channel) registeredOperationInfos() map[string][]OperationInfo {
+	ops := make(map[string][]OperationInfo)
+	if infos := ch.handlers.operationInfos(ch.PeerInfo().ServiceName); len(infos) > 0 {
+		ops[ch.PeerInfo().ServiceName] = infos
+	}
+	for _, serviceName := range ch.subChannels.serviceNames() {
+		sc, _ := ch.subChannels.get(serviceName)
+		if infos := sc.Operations(); len(infos) > 0 {
+			ops[serviceName] = append(ops[serviceName], infos...)
+			sort.Sort(operationInfosByName(ops[serviceName]))
+		}
+	}
+	return ops
+}
+
+// IntrospectState returns the runtime state of all peers in the peer list.
+func (l *PeerList) IntrospectState(opts *IntrospectionOptions) map[string]PeerRuntimeState {
+	l.mut.RLock()
+	defer l.mut.RUnlock()
+
+	m := make(map[string]PeerRuntimeState)
+	for hostPort, peer := range l.peersByHostPort {
+		peerState := peer.IntrospectState(opts)
+		if len(peerState.Connections) > 0 || opts.IncludeEmptyPeers {
+			m[hostPort] = peerState
+		}
+	}
+	return m
+}
+
+// IntrospectState returns the runtime state of the peer and its connections.
+func (p *Peer) IntrospectState(opts *IntrospectionOptions) PeerRuntimeState {
+	state := PeerRuntimeState{
+		HostPort:    p.hostPort,
+		RTT:         p.RTT(),
+		Throughput:  p.Throughput(),
+		QueuedCalls: p.QueuedCalls(),
+		Draining:    p.Draining(),
+	}
+
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+
+	for _, c := range p.connections {
+		state.Connections = append(state.Connections, c.IntrospectState(opts))
+	}
+	return state
+}
+
+// IntrospectState returns the runtime state of the connection.
+func (c *Connection) IntrospectState(opts *IntrospectionOptions) ConnectionRuntimeState {
+	return ConnectionRuntimeState{
+		ID:               c.connID,
+		ConnectionState:  c.readState().String(),
+		LocalHostPort:    c.conn.LocalAddr().String(),
+		RemoteHostPort:   c.conn.RemoteAddr().String(),
+		RemotePeer:       c.remotePeerInfo,
+		Tag:              c.tag,
+		RTT:              c.RTT(),
+		Throughput:       c.Throughput(),
+		InboundExchange:  c.inbound.IntrospectState(opts),
+		OutboundExchange: c.outbound.IntrospectState(opts),
+	}
+}
+
+// IntrospectState returns the runtime state of the message exchange set.
+func (mexset *messageExchangeSet) IntrospectState(opts *IntrospectionOptions) ExchangeRuntimeState {
+	mexset.mut.RLock()
+	defer mexset.mut.RUnlock()
+
+	state := ExchangeRuntimeState{
+		Name:  mexset.name,
+		Count: len(mexset.exchanges),
+	}
+	if opts.IncludeExchanges {
+		state.Exchanges = make(map[string]ExchangeStateSummary, len(mexset.exchanges))
+		for k, mex := range mexset.exchanges {
+			state.Exchanges[strconv.Itoa(int(k))] = ExchangeStateSummary{
+				ID:          mex.msgID,
+				MessageType: mex.msgType.String(),
+			}
+		}
+	}
+	return state
+}
+
+// internalJSONHandler is a handler for internal endpoints. It is passed the raw arg3
+// and the returned value is written as JSON to arg3 of the response.
+type internalJSONHandler func(arg3 []byte) interface{}
+
+// Handle reads the arguments of the call and responds with the result of f as JSON.
+func (f internalJSONHandler) Handle(ctx context.Context, call *InboundCall) {
+	var arg2, arg3 []byte
+	if err := NewArgReader(call.Arg2Reader()).Read(&arg2); err != nil {
+		call.Response().SendSystemError(NewSystemError(ErrCodeBadRequest, "arg2 read failed: %v", err))
+		return
+	}
+	if err := NewArgReader(call.Arg3Reader()).Read(&arg3); err != nil {
+		call.Response().SendSystemError(NewSystemError(ErrCodeBadRequest, "arg3 read failed: %v", err))
+		return
+	}
+
+	response := call.Response()
+	if err := NewArgWriter(response.Arg2Writer()).Write(nil); err != nil {
+		return
+	}
+	NewArgWriter(response.Arg3Writer()).WriteJSON(f(arg3))
+}
+
+// handleIntrospection handles calls to the IntrospectOperation endpoint.
+func (ch *Channel) handleIntrospection(arg3 []byte) interface{} {
+	var opts IntrospectionOptions
+	// Invalid or empty options fall back to the defaults.
+	json.Unmarshal(arg3, &opts)
+	return ch.IntrospectState(&opts)
+}
+
+// createInternalHandlers creates the handlers for the built-in endpoints.
+func (ch *Channel) createInternalHandlers() map[string]Handler {
+	return map[string]Handler{
+		IntrospectOperation: internalJSONHandler(ch.handleIntrospection),
+	}
+}
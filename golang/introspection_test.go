@@ -0,0 +1,112 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+)
+
+func TestIntrospectState(t *testing.T) {
+	WithVerifiedServer(t, nil, func(ch *Channel, hostPort string) {
+		ch.Register(raw.Wrap(newTestHandler(t)), "echo")
+		ch.GetSubChannel("subsvc").Register(raw.Wrap(newTestHandler(t)), "sub-echo")
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		_, _, _, err := raw.Call(ctx, ch, hostPort, testServiceName, "echo", testArg2, testArg3)
+		require.NoError(t, err, "Call failed")
+
+		state := ch.IntrospectState(&IntrospectionOptions{IncludeExchanges: true})
+		assert.Equal(t, ch.PeerInfo(), state.LocalPeer, "LocalPeer mismatch")
+		assert.Equal(t, ChannelListening.String(), state.State, "State mismatch")
+		assert.Equal(t, VersionInfo, state.Version.TChannel, "Version mismatch")
+		assert.Equal(t, ProtocolFeatures(), state.Version.Features, "Features mismatch")
+		assert.Equal(t, []string{"echo"}, state.Handlers[testServiceName], "Handlers mismatch")
+		assert.Equal(t, []string{"sub-echo"}, state.Handlers["subsvc"], "Subchannel handlers mismatch")
+		assert.Equal(t, []OperationInfo{{Name: "echo"}}, state.Operations[testServiceName], "Operations mismatch")
+		assert.Equal(t, []string{"subsvc"}, state.SubChannels, "SubChannels mismatch")
+		assert.Equal(t, []string{"subsvc", testServiceName}, state.Services, "Services mismatch")
+
+		// The channel called itself, so both the outbound and inbound connection are for the same peer.
+		require.Equal(t, 1, len(state.Peers), "Peers mismatch")
+		peerState := state.Peers[hostPort]
+		require.Equal(t, 2, len(peerState.Connections), "Connections mismatch")
+		for _, connState := range peerState.Connections {
+			assert.Equal(t, "connectionActive", connState.ConnectionState, "ConnectionState mismatch")
+			assert.Equal(t, 0, connState.InboundExchange.Count, "Inbound exchanges should be empty")
+			assert.Equal(t, 0, connState.OutboundExchange.Count, "Outbound exchanges should be empty")
+		}
+	})
+}
+
+func TestIntrospectionEndpoint(t *testing.T) {
+	opts := &testutils.ChannelOpts{EnableIntrospection: true}
+	WithVerifiedServer(t, opts, func(ch *Channel, hostPort string) {
+		ch.Register(raw.Wrap(newTestHandler(t)), "echo")
+
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		// The introspection endpoint is available for any service name.
+		for _, service := range []string{testServiceName, "other-service"} {
+			_, arg3, resp, err := raw.Call(ctx, client, hostPort, service, IntrospectOperation, nil, []byte(`{"includeEmptyPeers": true}`))
+			require.NoError(t, err, "Call to introspection endpoint failed")
+			assert.False(t, resp.ApplicationError(), "introspection should not return an error")
+
+			var state RuntimeState
+			require.NoError(t, json.Unmarshal(arg3, &state), "Unmarshal failed")
+			assert.Equal(t, testServiceName, state.LocalPeer.ServiceName, "ServiceName mismatch")
+			assert.Equal(t, hostPort, state.LocalPeer.HostPort, "HostPort mismatch")
+			assert.Equal(t, []string{"echo"}, state.Handlers[testServiceName], "Handlers mismatch")
+			assert.Equal(t, CurrentProtocolVersion, state.Version.ProtocolVersion, "ProtocolVersion mismatch")
+			assert.Equal(t, 1, len(state.Peers), "expected the client as a peer")
+		}
+	})
+}
+
+func TestIntrospectionEndpointDisabled(t *testing.T) {
+	WithVerifiedServer(t, nil, func(ch *Channel, hostPort string) {
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		_, _, _, err = raw.Call(ctx, client, hostPort, ch.ServiceName(), IntrospectOperation, nil, []byte("{}"))
+		require.Error(t, err, "introspection should be disabled by default")
+		assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(err), "unexpected error code")
+	})
+}
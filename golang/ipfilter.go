@@ -0,0 +1,111 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"net"
+	"sync"
+)
+
+// IPFilterOptions configure which remote addresses may open inbound connections.
+type IPFilterOptions struct {
+	// Allow is a list of CIDR ranges that are allowed to connect. If it is empty,
+	// all addresses that are not denied are allowed.
+	Allow []string
+
+	// Deny is a list of CIDR ranges that are not allowed to connect. Deny takes
+	// precedence over Allow.
+	Deny []string
+}
+
+// ipFilter accepts or rejects inbound connections by their remote address.
+type ipFilter struct {
+	mut   sync.RWMutex
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// update replaces the filter's ranges. The filter is not modified if a range is invalid.
+func (f *ipFilter) update(opts *IPFilterOptions) error {
+	var allow, deny []*net.IPNet
+	if opts != nil {
+		var err error
+		if allow, err = parseCIDRs(opts.Allow); err != nil {
+			return err
+		}
+		if deny, err = parseCIDRs(opts.Deny); err != nil {
+			return err
+		}
+	}
+
+	f.mut.Lock()
+	f.allow = allow
+	f.deny = deny
+	f.mut.Unlock()
+	return nil
+}
+
+// allowed returns whether connections from the given address are accepted.
+func (f *ipFilter) allowed(addr net.Addr) bool {
+	f.mut.RLock()
+	defer f.mut.RUnlock()
+
+	if len(f.allow) == 0 && len(f.deny) == 0 {
+		return true
+	}
+
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		// Only TCP addresses can be filtered, so reject others when a filter is set.
+		return false
+	}
+	if containsIP(f.deny, tcpAddr.IP) {
+		return false
+	}
+	return len(f.allow) == 0 || containsIP(f.allow, tcpAddr.IP)
+}
+
+// SetIPFilter replaces the ranges used to accept or reject new inbound connections.
+// Existing connections are not affected. An error is returned if a range is invalid,
+// in which case the current ranges are kept.
+func (ch *Channel) SetIPFilter(opts IPFilterOptions) error {
+	return ch.ipFilter.update(&opts)
+}
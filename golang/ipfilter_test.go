@@ -0,0 +1,73 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestIPFilter(t *testing.T) {
+	stats := newRecordingStatsReporter()
+	server, err := NewChannel("ipfilter-svc", &ChannelOptions{
+		StatsReporter: stats,
+		IPFilter:      &IPFilterOptions{Deny: []string{"127.0.0.0/8"}},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+
+	ping := func() error {
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		return client.Ping(ctx, server.PeerInfo().HostPort)
+	}
+
+	assert.Error(t, ping(), "denied addresses should be rejected")
+
+	require.NoError(t, server.SetIPFilter(IPFilterOptions{Allow: []string{"10.0.0.0/8"}}), "SetIPFilter failed")
+	assert.Error(t, ping(), "addresses that are not allowed should be rejected")
+
+	require.NoError(t, server.SetIPFilter(IPFilterOptions{
+		Allow: []string{"127.0.0.0/8", "::1/128"},
+		Deny:  []string{"127.0.0.2/32"},
+	}), "SetIPFilter failed")
+	assert.NoError(t, ping(), "allowed addresses should be accepted")
+
+	assert.Error(t, server.SetIPFilter(IPFilterOptions{Deny: []string{"invalid"}}), "invalid ranges should fail")
+	assert.NoError(t, ping(), "invalid ranges should not change the filter")
+
+	rejected := counterValue(stats, "inbound.connections.rejected")
+	assert.EqualValues(t, 2, rejected, "rejected connections should be counted")
+
+	_, err = NewChannel("ipfilter-svc", &ChannelOptions{IPFilter: &IPFilterOptions{Allow: []string{"1.2.3.4"}}})
+	assert.Error(t, err, "NewChannel should fail with an invalid range")
+}
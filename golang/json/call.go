@@ -21,31 +21,66 @@
 package json
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/uber/tchannel/golang"
+	"golang.org/x/net/context"
 )
 
 // ErrApplication is an application error which contains the object returned from the other side.
+// Handlers that return an error other than AppError respond with an object containing
+// the "type" "error" and the error's "message".
 type ErrApplication map[string]interface{}
 
 func (e ErrApplication) Error() string {
 	return fmt.Sprintf("JSON call failed: %v", map[string]interface{}(e))
 }
 
-func makeCall(ctx Context, call *tchannel.OutboundCall, arg interface{}, resp interface{}) error {
+// ApplicationError returns true, so that tchannel.IsApplicationError distinguishes the
+// error from system errors.
+func (e ErrApplication) ApplicationError() bool {
+	return true
+}
+
+// Decode decodes the application error's object into v, which is typically a pointer to
+// the struct that the handler returned in an AppError.
+func (e ErrApplication) Decode(v interface{}) error {
+	bs, err := json.Marshal(map[string]interface{}(e))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, v)
+}
+
+// AppError can be returned by handlers to respond with an application error that
+// has the given payload, rather than an object containing the error message. The
+// response is marked as an application error, and callers receive the payload as an
+// ErrApplication, distinct from system errors. The payload must encode as a JSON object.
+type AppError struct {
+	Payload interface{}
+}
+
+func (e AppError) Error() string {
+	return fmt.Sprintf("JSON application error: %v", e.Payload)
+}
+
+// makeCall writes the headers and arg for the call, and reads the response into resp.
+// Response headers are set on ctx.
+func makeCall(ctx Context, call *tchannel.OutboundCall, headers map[string]string, arg interface{}, resp interface{}) error {
 	// Encode any headers as a JSON object.
-	if err := tchannel.NewArgWriter(call.Arg2Writer()).WriteJSON(ctx.Headers()); err != nil {
-		return fmt.Errorf("arg2 write failed: %v", err)
+	headers = tchannel.InjectRequestID(ctx, headers)
+	if err := tchannel.NewArgWriter(call.Arg2Writer()).WriteJSON(headers); err != nil {
+		return fmt.Errorf("arg2 write failed: %w", err)
 	}
 	if err := tchannel.NewArgWriter(call.Arg3Writer()).WriteJSON(arg); err != nil {
-		return fmt.Errorf("arg3 write failed: %v", err)
+		return fmt.Errorf("arg3 write failed: %w", err)
 	}
 
 	// Call Arg2Reader before application error.
 	var respHeaders map[string]string
 	if err := tchannel.NewArgReader(call.Response().Arg2Reader()).ReadJSON(&respHeaders); err != nil {
-		return fmt.Errorf("arg2 read failed: %v", err)
+		return fmt.Errorf("arg2 read failed: %w", err)
 	}
 	ctx.SetResponseHeaders(respHeaders)
 
@@ -53,34 +88,76 @@ func makeCall(ctx Context, call *tchannel.OutboundCall, arg interface{}, resp in
 	if call.Response().ApplicationError() {
 		errResponse := make(ErrApplication)
 		if err := tchannel.NewArgReader(call.Response().Arg3Reader()).ReadJSON(&errResponse); err != nil {
-			return fmt.Errorf("arg3 read error failed: %v", err)
+			return fmt.Errorf("arg3 read error failed: %w", err)
 		}
 		return errResponse
 	}
 
 	if err := tchannel.NewArgReader(call.Response().Arg3Reader()).ReadJSON(resp); err != nil {
-		return fmt.Errorf("arg3 read failed: %v", err)
+		return fmt.Errorf("arg3 read failed: %w", err)
 	}
 
 	return nil
 }
 
+// callOptions returns the options for BeginCall, which are a copy of opts using the JSON format.
+func callOptions(opts *tchannel.CallOptions) *tchannel.CallOptions {
+	var callOpts tchannel.CallOptions
+	if opts != nil {
+		callOpts = *opts
+	}
+	callOpts.Format = tchannel.JSON
+	return &callOpts
+}
+
 // CallPeer makes a JSON call using the given peer.
 func CallPeer(ctx Context, peer *tchannel.Peer, serviceName, operation string, arg interface{}, resp interface{}) error {
-	call, err := peer.BeginCall(ctx, serviceName, operation, &tchannel.CallOptions{Format: tchannel.JSON})
+	return CallPeerWithOptions(ctx, peer, serviceName, operation, arg, resp, nil)
+}
+
+// CallPeerWithOptions makes a JSON call using the given peer and call options. The options'
+// Timeout and RetryOptions are applied using tchannel.WithCallOptions, and Headers are sent
+// with the headers in the context. The call is not retried, as it is made to a specific peer.
+func CallPeerWithOptions(ctx Context, peer *tchannel.Peer, serviceName, operation string,
+	arg interface{}, resp interface{}, opts *tchannel.CallOptions) error {
+
+	callCtx, cancel := tchannel.WithCallOptions(ctx, opts)
+	defer cancel()
+
+	call, err := peer.BeginCall(callCtx, serviceName, operation, callOptions(opts))
 	if err != nil {
 		return err
 	}
 
-	return makeCall(ctx, call, arg, resp)
+	return makeCall(ctx, call, opts.AppHeaders(ctx.Headers()), arg, resp)
 }
 
 // CallSC makes a JSON call using the given subchannel.
 func CallSC(ctx Context, sc *tchannel.SubChannel, operation string, arg interface{}, resp interface{}) error {
-	call, err := sc.BeginCall(ctx, operation, &tchannel.CallOptions{Format: tchannel.JSON})
-	if err != nil {
-		return err
+	return CallSCWithOptions(ctx, sc, operation, arg, resp, nil)
+}
+
+// CallSCWithOptions makes a JSON call using the given subchannel and call options. The
+// options' Timeout and RetryOptions are applied using tchannel.WithCallOptions, and Headers
+// are sent with the headers in the context. If RetryOptions is set, the call is retried
+// using the subchannel's RunWithRetry.
+func CallSCWithOptions(ctx Context, sc *tchannel.SubChannel, operation string,
+	arg interface{}, resp interface{}, opts *tchannel.CallOptions) error {
+
+	callCtx, cancel := tchannel.WithCallOptions(ctx, opts)
+	defer cancel()
+
+	headers := opts.AppHeaders(ctx.Headers())
+	attempt := func(callCtx context.Context, _ *tchannel.RequestState) error {
+		call, err := sc.BeginCall(callCtx, operation, callOptions(opts))
+		if err != nil {
+			return err
+		}
+		return makeCall(ctx, call, headers, arg, resp)
 	}
 
-	return makeCall(ctx, call, arg, resp)
+	if opts == nil || opts.RetryOptions == nil {
+		return attempt(callCtx, nil)
+	}
+	return sc.RunWithRetry(callCtx, attempt)
 }
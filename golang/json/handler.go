@@ -92,7 +92,20 @@ func toHandler(f interface{}) (*handler, error) {
 // func(context.Context, *ArgType)(*ResType, error)
 func Register(registrar tchannel.Registrar, funcs Handlers, onError func(context.Context, error)) error {
 	handlers := make(map[string]*handler)
+	for m, f := range funcs {
+		h, err := toHandler(f)
+		if err != nil {
+			return fmt.Errorf("%v cannot be used as a handler: %v", m, err)
+		}
+		handlers[m] = h
+	}
 
+	register(registrar, handlers, onError)
+	return nil
+}
+
+// register registers a single tchannel.Handler that dispatches to the given handlers.
+func register(registrar tchannel.Registrar, handlers map[string]*handler, onError func(context.Context, error)) {
 	handler := tchannel.HandlerFunc(func(ctx context.Context, call *tchannel.InboundCall) {
 		h, ok := handlers[string(call.Operation())]
 		if !ok {
@@ -105,16 +118,9 @@ func Register(registrar tchannel.Registrar, funcs Handlers, onError func(context
 		}
 	})
 
-	for m, f := range funcs {
-		h, err := toHandler(f)
-		if err != nil {
-			return fmt.Errorf("%v cannot be used as a handler: %v", m, err)
-		}
-		handlers[m] = h
-		registrar.Register(handler, m)
+	for m := range handlers {
+		tchannel.RegisterOperation(registrar, handler, tchannel.OperationInfo{Name: m, Format: tchannel.JSON})
 	}
-
-	return nil
 }
 
 // Handle deserializes the JSON arguments and calls the underlying handler.
@@ -123,7 +129,7 @@ func (h *handler) Handle(tctx context.Context, call *tchannel.InboundCall) error
 	if err := tchannel.NewArgReader(call.Arg2Reader()).ReadJSON(&headers); err != nil {
 		return fmt.Errorf("arg2 read failed: %v", err)
 	}
-	ctx := WithHeaders(tctx, headers)
+	ctx := WithHeaders(tctx, tchannel.ExtractRequestID(tctx, headers))
 
 	var arg3 reflect.Value
 	var callArg reflect.Value
@@ -147,14 +153,7 @@ func (h *handler) Handle(tctx context.Context, call *tchannel.InboundCall) error
 	// If an error was returned, we create an error arg3 to respond with.
 	if err != nil {
 		call.Response().SetApplicationError()
-		// TODO(prashant): Allow client to customize the error in more ways.
-		res = struct {
-			Type    string `json:"type"`
-			Message string `json:"message"`
-		}{
-			Type:    "error",
-			Message: err.(error).Error(),
-		}
+		res = errorPayload(err.(error))
 	}
 
 	if err := tchannel.NewArgWriter(call.Response().Arg2Writer()).WriteJSON(ctx.ResponseHeaders()); err != nil {
@@ -163,3 +162,24 @@ func (h *handler) Handle(tctx context.Context, call *tchannel.InboundCall) error
 
 	return tchannel.NewArgWriter(call.Response().Arg3Writer()).WriteJSON(res)
 }
+
+// errorPayload returns the arg3 for an application error response for the given error.
+func errorPayload(err error) interface{} {
+	switch err := err.(type) {
+	case AppError:
+		return err.Payload
+	case *AppError:
+		return err.Payload
+	case ErrApplication:
+		// Forward application errors returned by downstream calls unchanged.
+		return err
+	}
+
+	return struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	}{
+		Type:    "error",
+		Message: err.Error(),
+	}
+}
@@ -241,3 +241,151 @@ func TestMapInputOutput(t *testing.T) {
 	require.NoError(t, tchannel.NewArgReader(resp.Arg3Reader()).ReadJSON(&data))
 	assert.Equal(t, arg, data.(map[string]interface{}), "result does not match arg")
 }
+
+func TestRequestIDPropagation(t *testing.T) {
+	ch, err := tchannel.NewChannel("server", nil)
+	require.NoError(t, err)
+	defer ch.Close()
+	require.NoError(t, ch.ListenAndServe("127.0.0.1:0"))
+	peer := ch.Peers().GetOrAdd(ch.PeerInfo().HostPort)
+
+	var leafRequestID string
+	var leafHeaders map[string]string
+	handlers := Handlers{
+		"forward": func(ctx Context, _ *struct{}) (*Res, error) {
+			res := &Res{}
+			err := CallPeer(Wrap(ctx), peer, "server", "leaf", nil, res)
+			return res, err
+		},
+		"leaf": func(ctx Context, _ *struct{}) (*Res, error) {
+			leafRequestID = tchannel.CurrentRequestID(ctx)
+			leafHeaders = ctx.Headers()
+			return &Res{"leaf called!"}, nil
+		},
+	}
+	onError := func(ctx context.Context, err error) {
+		t.Errorf("onError: %v", err)
+	}
+	require.NoError(t, Register(ch, handlers, onError))
+
+	tctx, cancel := tchannel.NewContextBuilder(time.Second).SetRequestID("req-id").Build()
+	defer cancel()
+	ctx := WithHeaders(tctx, map[string]string{"hdr": "val"})
+
+	res := &Res{}
+	require.NoError(t, CallPeer(ctx, peer, "server", "forward", nil, res))
+	assert.Equal(t, "leaf called!", res.Result)
+	assert.Equal(t, "req-id", leafRequestID, "request ID should be propagated to downstream calls")
+	assert.Empty(t, leafHeaders, "request ID header should not be visible to handlers")
+}
+
+func TestCallWithOptions(t *testing.T) {
+	ch, err := tchannel.NewChannel("server", nil)
+	require.NoError(t, err)
+	defer ch.Close()
+	require.NoError(t, ch.ListenAndServe("127.0.0.1:0"))
+	peer := ch.Peers().GetOrAdd(ch.PeerInfo().HostPort)
+
+	var attempts int
+	handler := func(ctx Context, _ *struct{}) (map[string]string, error) {
+		attempts++
+		res := map[string]string{"shardKey": tchannel.CurrentCall(ctx).ShardKey()}
+		for k, v := range ctx.Headers() {
+			res[k] = v
+		}
+		return res, nil
+	}
+	onError := func(ctx context.Context, err error) {
+		t.Errorf("onError: %v", err)
+	}
+	require.NoError(t, Register(ch, Handlers{"handle": handler}, onError))
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	ctx = WithHeaders(ctx, map[string]string{"ctx": "1", "both": "ctx"})
+
+	opts := &tchannel.CallOptions{
+		Format:       tchannel.Raw,
+		ShardKey:     "shard",
+		Timeout:      time.Second,
+		RetryOptions: &tchannel.RetryOptions{MaxAttempts: 2},
+		Headers:      map[string]string{"opts": "1", "both": "opts"},
+	}
+	want := map[string]string{"shardKey": "shard", "ctx": "1", "opts": "1", "both": "opts"}
+
+	var res map[string]string
+	require.NoError(t, CallPeerWithOptions(ctx, peer, "server", "handle", nil, &res, opts))
+	assert.Equal(t, want, res, "CallPeerWithOptions result mismatch")
+
+	res = nil
+	require.NoError(t, CallSCWithOptions(ctx, ch.GetSubChannel("server"), "handle", nil, &res, opts))
+	assert.Equal(t, want, res, "CallSCWithOptions result mismatch")
+	assert.Equal(t, 2, attempts, "successful calls should not be retried")
+	assert.Equal(t, map[string]string{"ctx": "1", "both": "ctx"}, ctx.Headers(), "context headers should not change")
+}
+
+type notFoundErr struct {
+	Key    string `json:"key"`
+	Reason string `json:"reason"`
+}
+
+func TestApplicationErrors(t *testing.T) {
+	ch, err := tchannel.NewChannel("server", nil)
+	require.NoError(t, err)
+	defer ch.Close()
+	require.NoError(t, ch.ListenAndServe("127.0.0.1:0"))
+	ch.Peers().Add(ch.PeerInfo().HostPort)
+
+	var calls int
+	downstream := ErrApplication{"type": "downstream"}
+	handlers := Handlers{
+		"payload": func(ctx Context, _ *struct{}) (*Res, error) {
+			calls++
+			return nil, AppError{Payload: notFoundErr{Key: "k", Reason: "missing"}}
+		},
+		"pointer": func(ctx Context, _ *struct{}) (*Res, error) {
+			return nil, &AppError{Payload: map[string]string{"type": "pointer"}}
+		},
+		"forward": func(ctx Context, _ *struct{}) (*Res, error) {
+			return nil, downstream
+		},
+		"error": func(ctx Context, _ *struct{}) (*Res, error) {
+			return nil, fmt.Errorf("failed")
+		},
+	}
+	onError := func(ctx context.Context, err error) {
+		t.Errorf("onError: %v", err)
+	}
+	require.NoError(t, Register(ch, handlers, onError))
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	sc := ch.GetSubChannel("server")
+
+	tests := []struct {
+		operation string
+		want      ErrApplication
+	}{
+		{"payload", ErrApplication{"key": "k", "reason": "missing"}},
+		{"pointer", ErrApplication{"type": "pointer"}},
+		{"forward", downstream},
+		{"error", ErrApplication{"type": "error", "message": "failed"}},
+	}
+	for _, tt := range tests {
+		var res Res
+		err := CallSCWithOptions(ctx, sc, tt.operation, nil, &res, &tchannel.CallOptions{
+			RetryOptions: &tchannel.RetryOptions{RetryOn: tchannel.RetryUnexpected},
+		})
+		assert.Equal(t, tt.want, err, "%v: unexpected error", tt.operation)
+		assert.True(t, tchannel.IsApplicationError(err), "%v: should be an application error", tt.operation)
+	}
+	assert.Equal(t, 1, calls, "application errors should not be retried")
+
+	var res Res
+	err = CallSC(ctx, sc, "payload", nil, &res)
+	appErr, ok := err.(ErrApplication)
+	require.True(t, ok, "expected ErrApplication, got %v", err)
+	var decoded notFoundErr
+	require.NoError(t, appErr.Decode(&decoded), "Decode failed")
+	assert.Equal(t, notFoundErr{Key: "k", Reason: "missing"}, decoded)
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package json
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/uber/tchannel/golang"
+	"golang.org/x/net/context"
+)
+
+// NamingPolicy maps the name of a service method to the operation name it is registered as.
+type NamingPolicy func(method string) string
+
+// MethodName registers each method using the method name unchanged, e.g. "GetValue".
+func MethodName(method string) string {
+	return method
+}
+
+// LowerCamelCase registers each method with the first letter lowercased, e.g. "getValue".
+func LowerCamelCase(method string) string {
+	r, n := utf8.DecodeRuneInString(method)
+	return string(unicode.ToLower(r)) + method[n:]
+}
+
+// WithPrefix returns a NamingPolicy that adds prefix to the names returned by policy,
+// e.g. WithPrefix("KeyValue::", MethodName) registers "KeyValue::GetValue".
+func WithPrefix(prefix string, policy NamingPolicy) NamingPolicy {
+	return func(method string) string {
+		return prefix + policy(method)
+	}
+}
+
+// ServiceOptions are options for RegisterService.
+type ServiceOptions struct {
+	// Naming determines the operation name for each method. Defaults to MethodName.
+	Naming NamingPolicy
+
+	// OnError is called for any errors handling calls. Defaults to logging a warning
+	// using the registrar's logger.
+	OnError func(context.Context, error)
+}
+
+// RegisterService registers each exported method of svc that has the signature
+// func(json.Context, *ArgType) (*ResType, error) as an operation. Methods with other
+// signatures are ignored, so svc may have helper methods. An error is returned if svc
+// has no handler methods, or if two methods map to the same operation name.
+func RegisterService(registrar tchannel.Registrar, svc interface{}, opts *ServiceOptions) error {
+	if opts == nil {
+		opts = &ServiceOptions{}
+	}
+	naming := opts.Naming
+	if naming == nil {
+		naming = MethodName
+	}
+	onError := opts.OnError
+	if onError == nil {
+		onError = func(ctx context.Context, err error) {
+			registrar.Logger().Warnf("json handler for %v failed: %v", registrar.ServiceName(), err)
+		}
+	}
+
+	svcV := reflect.ValueOf(svc)
+	svcT := svcV.Type()
+	handlers := make(map[string]*handler)
+	for i := 0; i < svcT.NumMethod(); i++ {
+		m := svcT.Method(i)
+		if m.PkgPath != "" {
+			continue
+		}
+
+		hV := svcV.Method(i)
+		if verifyHandler(hV.Type()) != nil {
+			continue
+		}
+
+		op := naming(m.Name)
+		if strings.TrimSpace(op) == "" {
+			return fmt.Errorf("method %v has an empty operation name", m.Name)
+		}
+		if _, ok := handlers[op]; ok {
+			return fmt.Errorf("method %v duplicates operation name %q", m.Name, op)
+		}
+		argType := hV.Type().In(1)
+		handlers[op] = &handler{hV, argType, argType.Kind() == reflect.Map}
+	}
+
+	if len(handlers) == 0 {
+		return fmt.Errorf("%v has no methods of the form func(json.Context, *ArgType) (*ResType, error)", svcT)
+	}
+
+	register(registrar, handlers, onError)
+	return nil
+}
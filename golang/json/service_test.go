@@ -0,0 +1,158 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package json
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+	"golang.org/x/net/context"
+)
+
+type kvService struct {
+	values map[string]string
+}
+
+type kvArgs struct {
+	Key   string
+	Value string
+}
+
+func (s *kvService) GetValue(ctx Context, args *kvArgs) (*kvArgs, error) {
+	v, ok := s.values[args.Key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return &kvArgs{Key: args.Key, Value: v}, nil
+}
+
+func (s *kvService) SetValue(ctx Context, args *kvArgs) (*kvArgs, error) {
+	s.values[args.Key] = args.Value
+	return args, nil
+}
+
+// Helper methods that do not match the handler signature are ignored.
+func (s *kvService) Len() int {
+	return len(s.values)
+}
+
+type emptyService struct{}
+
+func (emptyService) Helper(ctx context.Context) error {
+	return nil
+}
+
+type duplicateService struct{}
+
+func (duplicateService) A(ctx Context, _ *struct{}) (*struct{}, error) {
+	return nil, nil
+}
+
+func (duplicateService) B(ctx Context, _ *struct{}) (*struct{}, error) {
+	return nil, nil
+}
+
+func TestRegisterService(t *testing.T) {
+	tests := []struct {
+		naming   NamingPolicy
+		getOp    string
+		setOp    string
+		helperOp string
+	}{
+		{nil, "GetValue", "SetValue", "Len"},
+		{MethodName, "GetValue", "SetValue", "Len"},
+		{LowerCamelCase, "getValue", "setValue", "len"},
+		{WithPrefix("KeyValue::", MethodName), "KeyValue::GetValue", "KeyValue::SetValue", "KeyValue::Len"},
+	}
+
+	for _, tt := range tests {
+		ch, err := tchannel.NewChannel("server", nil)
+		require.NoError(t, err)
+		require.NoError(t, ch.ListenAndServe("127.0.0.1:0"))
+
+		svc := &kvService{values: make(map[string]string)}
+		onError := func(ctx context.Context, err error) {
+			t.Errorf("onError: %v", err)
+		}
+		require.NoError(t, RegisterService(ch, svc, &ServiceOptions{Naming: tt.naming, OnError: onError}))
+
+		ctx, cancel := NewContext(time.Second)
+		ch.Peers().Add(ch.PeerInfo().HostPort)
+		sc := ch.GetSubChannel("server")
+
+		var res kvArgs
+		require.NoError(t, CallSC(ctx, sc, tt.setOp, &kvArgs{Key: "k", Value: "v"}, &res), "%v failed", tt.setOp)
+		assert.Equal(t, 1, svc.Len())
+
+		res = kvArgs{}
+		require.NoError(t, CallSC(ctx, sc, tt.getOp, &kvArgs{Key: "k"}, &res), "%v failed", tt.getOp)
+		assert.Equal(t, kvArgs{Key: "k", Value: "v"}, res)
+
+		err = CallSC(ctx, sc, tt.getOp, &kvArgs{Key: "missing"}, &res)
+		assert.Equal(t, ErrApplication{"type": "error", "message": "not found"}, err)
+
+		err = CallSC(ctx, sc, tt.helperOp, nil, &res)
+		if assert.Error(t, err, "%v should not be registered", tt.helperOp) {
+			assert.Contains(t, err.Error(), "no handler for service")
+		}
+
+		cancel()
+		ch.Close()
+	}
+}
+
+func TestRegisterServiceErrors(t *testing.T) {
+	tests := []struct {
+		svc    interface{}
+		opts   *ServiceOptions
+		errMsg string
+	}{
+		{
+			svc:    emptyService{},
+			errMsg: "has no methods",
+		},
+		{
+			svc:    duplicateService{},
+			opts:   &ServiceOptions{Naming: func(string) string { return "op" }},
+			errMsg: `duplicates operation name "op"`,
+		},
+		{
+			svc:    duplicateService{},
+			opts:   &ServiceOptions{Naming: func(string) string { return "" }},
+			errMsg: "empty operation name",
+		},
+	}
+
+	for _, tt := range tests {
+		ch, err := tchannel.NewChannel("server", nil)
+		require.NoError(t, err)
+
+		err = RegisterService(ch, tt.svc, tt.opts)
+		if assert.Error(t, err, "RegisterService(%T) should fail", tt.svc) {
+			assert.Contains(t, err.Error(), tt.errMsg)
+		}
+		ch.Close()
+	}
+}
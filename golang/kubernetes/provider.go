@@ -0,0 +1,224 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// Package kubernetes provides a peer provider that keeps a SubChannel's peers in sync
+// with the ready endpoints of a Kubernetes service, using EndpointSlices.
+package kubernetes
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/uber/tchannel/golang"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	k8s "k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const defaultResyncPeriod = 10 * time.Minute
+
+var (
+	errAlreadyStarted = errors.New("peer provider already started")
+	errNotSynced      = errors.New("failed to sync EndpointSlices")
+)
+
+// Options configure a PeerProvider.
+type Options struct {
+	// Namespace is the namespace of the service. Defaults to "default".
+	Namespace string
+
+	// Service is the name of the Kubernetes service. Defaults to the SubChannel's
+	// service name.
+	Service string
+
+	// PortName is the name of the endpoint port that the service's TChannel server
+	// listens on. Defaults to the first port of each EndpointSlice.
+	PortName string
+
+	// IncludeUnready adds endpoints that are not ready, such as pods that are failing
+	// their readiness probe or terminating. By default only ready endpoints are added.
+	IncludeUnready bool
+
+	// ResyncPeriod is how often the peers are recomputed from the cached EndpointSlices.
+	// Defaults to 10 minutes.
+	ResyncPeriod time.Duration
+}
+
+// PeerProvider watches the EndpointSlices of a Kubernetes service, and keeps a
+// SubChannel's peer list in sync with the ready endpoints. Peers are removed from the
+// peer list once their pods are deleted or are no longer ready.
+type PeerProvider struct {
+	client k8s.Interface
+	sc     *tchannel.SubChannel
+	opts   Options
+
+	stopCh chan struct{}
+	lister listersv1.EndpointSliceLister
+
+	mut   sync.Mutex // mut protects added.
+	added map[string]struct{}
+}
+
+// NewPeerProvider returns a PeerProvider for the given SubChannel. Call Start to begin
+// watching the EndpointSlices.
+func NewPeerProvider(client k8s.Interface, sc *tchannel.SubChannel, opts *Options) *PeerProvider {
+	p := &PeerProvider{
+		client: client,
+		sc:     sc,
+		added:  make(map[string]struct{}),
+	}
+	if opts != nil {
+		p.opts = *opts
+	}
+	if p.opts.Namespace == "" {
+		p.opts.Namespace = metav1.NamespaceDefault
+	}
+	if p.opts.Service == "" {
+		p.opts.Service = sc.ServiceName()
+	}
+	if p.opts.ResyncPeriod <= 0 {
+		p.opts.ResyncPeriod = defaultResyncPeriod
+	}
+	return p
+}
+
+// Start lists the EndpointSlices for the service, and returns an error if they cannot
+// be synced. If they are synced, the peers are updated whenever the EndpointSlices
+// change until Stop is called.
+func (p *PeerProvider) Start() error {
+	if p.stopCh != nil {
+		return errAlreadyStarted
+	}
+
+	selector := labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: p.opts.Service})
+	factory := informers.NewSharedInformerFactoryWithOptions(p.client, p.opts.ResyncPeriod,
+		informers.WithNamespace(p.opts.Namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = selector.String()
+		}))
+	slices := factory.Discovery().V1().EndpointSlices()
+	informer := slices.Informer()
+	p.lister = slices.Lister()
+
+	update := func(interface{}) { p.update() }
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    update,
+		UpdateFunc: func(_, obj interface{}) { update(obj) },
+		DeleteFunc: update,
+	}); err != nil {
+		return err
+	}
+
+	p.stopCh = make(chan struct{})
+	factory.Start(p.stopCh)
+	if !cache.WaitForCacheSync(p.stopCh, informer.HasSynced) {
+		p.Stop()
+		return errNotSynced
+	}
+
+	p.update()
+	return nil
+}
+
+// Stop stops watching the EndpointSlices. The peers that were added are not removed.
+func (p *PeerProvider) Stop() {
+	if p.stopCh == nil {
+		return
+	}
+	select {
+	case <-p.stopCh:
+	default:
+		close(p.stopCh)
+	}
+}
+
+// update sets the peers to the endpoints in the cached EndpointSlices.
+func (p *PeerProvider) update() {
+	slices, err := p.lister.EndpointSlices(p.opts.Namespace).List(labels.Everything())
+	if err != nil {
+		p.sc.Logger().Warnf("Listing EndpointSlices for %v failed: %v", p.opts.Service, err)
+		return
+	}
+
+	hostPorts := make(map[string]struct{})
+	for _, slice := range slices {
+		if slice.AddressType != discoveryv1.AddressTypeIPv4 && slice.AddressType != discoveryv1.AddressTypeIPv6 {
+			continue
+		}
+		port, ok := p.findPort(slice.Ports)
+		if !ok {
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			if !p.opts.IncludeUnready && !isReady(endpoint) {
+				continue
+			}
+			for _, address := range endpoint.Addresses {
+				hostPorts[net.JoinHostPort(address, strconv.Itoa(int(port)))] = struct{}{}
+			}
+		}
+	}
+	p.setPeers(hostPorts)
+}
+
+// findPort returns the port with the configured name, or the first port.
+func (p *PeerProvider) findPort(ports []discoveryv1.EndpointPort) (int32, bool) {
+	for _, port := range ports {
+		if port.Port == nil {
+			continue
+		}
+		if p.opts.PortName == "" || (port.Name != nil && *port.Name == p.opts.PortName) {
+			return *port.Port, true
+		}
+	}
+	return 0, false
+}
+
+// isReady returns whether the endpoint is ready. A nil ready condition should be
+// interpreted as ready.
+func isReady(endpoint discoveryv1.Endpoint) bool {
+	return endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+}
+
+// setPeers adds new peers, and removes peers previously added that are no longer ready.
+func (p *PeerProvider) setPeers(hostPorts map[string]struct{}) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	peers := p.sc.Peers()
+	for hostPort := range hostPorts {
+		if _, ok := p.added[hostPort]; !ok {
+			peers.Add(hostPort)
+			p.added[hostPort] = struct{}{}
+		}
+	}
+	for hostPort := range p.added {
+		if _, ok := hostPorts[hostPort]; !ok {
+			peers.Remove(hostPort)
+			delete(p.added, hostPort)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package kubernetes
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+	"golang.org/x/net/context"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func getPeers(ch *tchannel.Channel) []string {
+	var peers []string
+	for hostPort := range ch.Peers().Copy() {
+		peers = append(peers, hostPort)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+func waitForPeers(t *testing.T, ch *tchannel.Channel, want []string) {
+	for i := 0; i < 100; i++ {
+		if assert.ObjectsAreEqual(want, getPeers(ch)) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, want, getPeers(ch), "peers mismatch")
+}
+
+type endpoint struct {
+	address string
+	ready   bool
+}
+
+func endpointSlice(name, service string, ports map[string]int32, endpoints ...endpoint) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "ns",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+	}
+	for name, port := range ports {
+		name, port := name, port
+		slice.Ports = append(slice.Ports, discoveryv1.EndpointPort{Name: &name, Port: &port})
+	}
+	for _, e := range endpoints {
+		ready := e.ready
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Addresses:  []string{e.address},
+			Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+		})
+	}
+	return slice
+}
+
+func TestPeerProvider(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(
+		endpointSlice("svc-a", "svc", map[string]int32{"tchannel": 4040},
+			endpoint{"10.0.0.1", true}, endpoint{"10.0.0.2", false}),
+		endpointSlice("other-a", "other", map[string]int32{"tchannel": 4040}, endpoint{"10.0.1.1", true}),
+	)
+	slices := client.DiscoveryV1().EndpointSlices("ns")
+
+	ch, err := tchannel.NewChannel("client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+
+	p := NewPeerProvider(client, ch.GetSubChannel("svc"), &Options{Namespace: "ns", PortName: "tchannel"})
+	require.NoError(t, p.Start(), "Start failed")
+	defer p.Stop()
+	assert.Equal(t, errAlreadyStarted, p.Start(), "Start should fail when already started")
+	assert.Equal(t, []string{"10.0.0.1:4040"}, getPeers(ch), "only ready endpoints should be added")
+
+	_, err = slices.Create(ctx, endpointSlice("svc-b", "svc", map[string]int32{"tchannel": 5050, "http": 80},
+		endpoint{"10.0.0.3", true}), metav1.CreateOptions{})
+	require.NoError(t, err, "Create failed")
+	waitForPeers(t, ch, []string{"10.0.0.1:4040", "10.0.0.3:5050"})
+
+	_, err = slices.Update(ctx, endpointSlice("svc-a", "svc", map[string]int32{"tchannel": 4040},
+		endpoint{"10.0.0.1", false}, endpoint{"10.0.0.2", true}), metav1.UpdateOptions{})
+	require.NoError(t, err, "Update failed")
+	waitForPeers(t, ch, []string{"10.0.0.2:4040", "10.0.0.3:5050"})
+
+	require.NoError(t, slices.Delete(ctx, "svc-b", metav1.DeleteOptions{}), "Delete failed")
+	waitForPeers(t, ch, []string{"10.0.0.2:4040"})
+}
+
+func TestPeerProviderIncludeUnready(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		endpointSlice("svc-a", "svc", map[string]int32{"": 4040},
+			endpoint{"10.0.0.1", true}, endpoint{"10.0.0.2", false}),
+	)
+
+	ch, err := tchannel.NewChannel("client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+
+	p := NewPeerProvider(client, ch.GetSubChannel("svc"), &Options{Namespace: "ns", IncludeUnready: true})
+	require.NoError(t, p.Start(), "Start failed")
+	defer p.Stop()
+	assert.Equal(t, []string{"10.0.0.1:4040", "10.0.0.2:4040"}, getPeers(ch), "unready endpoints should be added")
+}
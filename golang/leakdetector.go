@@ -0,0 +1,168 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultLeakCheckInterval = 10 * time.Second
+	defaultLeakGrace         = time.Minute
+
+	// maxExchangeStackSize is the maximum size of the stack captured for each exchange.
+	maxExchangeStackSize = 4096
+)
+
+// LeakDetectorOptions configure a background watchdog that reports message exchanges
+// that are still active long after their context deadline has passed.
+type LeakDetectorOptions struct {
+	// CheckInterval is how often exchanges are checked. Defaults to 10 seconds.
+	CheckInterval time.Duration
+
+	// Grace is how long after its deadline an exchange must still be active before it
+	// is reported as leaked. Defaults to 1 minute.
+	Grace time.Duration
+}
+
+// leakDetector periodically checks a channel's connections for leaked exchanges.
+type leakDetector struct {
+	ch       *Channel
+	interval time.Duration
+	grace    time.Duration
+	leaked   int64
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+func newLeakDetector(ch *Channel, opts *LeakDetectorOptions) *leakDetector {
+	if opts == nil {
+		return nil
+	}
+
+	d := &leakDetector{
+		ch:       ch,
+		interval: opts.CheckInterval,
+		grace:    opts.Grace,
+		stopCh:   make(chan struct{}),
+	}
+	if d.interval <= 0 {
+		d.interval = defaultLeakCheckInterval
+	}
+	if d.grace <= 0 {
+		d.grace = defaultLeakGrace
+	}
+	return d
+}
+
+func (d *leakDetector) start() {
+	if d != nil {
+		go d.run()
+	}
+}
+
+func (d *leakDetector) stop() {
+	if d != nil {
+		d.stopOnce.Do(func() { close(d.stopCh) })
+	}
+}
+
+func (d *leakDetector) run() {
+	ticker := d.ch.clock.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			d.check()
+		case <-d.stopCh:
+			return
+		}
+	}
+}
+
+// check reports any exchanges that have leaked since the last check.
+func (d *leakDetector) check() {
+	d.ch.mutable.mut.RLock()
+	conns := append([]*Connection(nil), d.ch.mutable.conns...)
+	d.ch.mutable.mut.RUnlock()
+
+	now := timeNow()
+	for _, c := range conns {
+		for _, mexset := range []*messageExchangeSet{&c.inbound, &c.outbound} {
+			for _, mex := range mexset.findLeaks(now, d.grace) {
+				d.report(mexset, mex, now)
+			}
+		}
+	}
+}
+
+func (d *leakDetector) report(mexset *messageExchangeSet, mex *messageExchange, now time.Time) {
+	atomic.AddInt64(&d.leaked, 1)
+	d.ch.statsReporter.IncCounter("exchanges.leaked", d.ch.commonStatsTags, 1)
+
+	deadline, _ := mex.ctx.Deadline()
+	mexset.log.WithFields(
+		LogField{"exchange", mex.msgID},
+		LogField{"messageType", mex.msgType},
+		LogField{"age", now.Sub(mex.createdAt)},
+	).Errorf("%v message exchange is still active %v after its deadline, created by:\n%s",
+		mexset.name, now.Sub(deadline), mex.stack)
+}
+
+// leakedExchanges returns the number of leaked exchanges that have been reported.
+func (d *leakDetector) leakedExchanges() int64 {
+	if d == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&d.leaked)
+}
+
+// captureStack returns the stack of the current goroutine, truncated to maxExchangeStackSize.
+func captureStack() []byte {
+	buf := make([]byte, maxExchangeStackSize)
+	return buf[:runtime.Stack(buf, false)]
+}
+
+// findLeaks returns the exchanges that are still active more than grace after their
+// deadline. Each exchange is only returned once.
+func (mexset *messageExchangeSet) findLeaks(now time.Time, grace time.Duration) []*messageExchange {
+	mexset.mut.Lock()
+	defer mexset.mut.Unlock()
+
+	var leaked []*messageExchange
+	for _, mex := range mexset.exchanges {
+		if mex.leakReported {
+			continue
+		}
+		deadline, ok := mex.ctx.Deadline()
+		if !ok || now.Sub(deadline) < grace {
+			continue
+		}
+		mex.leakReported = true
+		leaked = append(leaked, mex)
+	}
+	return leaked
+}
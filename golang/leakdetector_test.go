@@ -0,0 +1,92 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestFindLeaks(t *testing.T) {
+	mexset := &messageExchangeSet{
+		name:          messageExchangeSetOutbound,
+		log:           NullLogger,
+		exchanges:     make(map[uint32]*messageExchange),
+		captureStacks: true,
+		onRemoved:     func() {},
+	}
+
+	now := time.Now()
+	expired, cancel := context.WithDeadline(context.Background(), now.Add(-2*time.Minute))
+	defer cancel()
+	recent, cancel := context.WithDeadline(context.Background(), now.Add(-time.Second))
+	defer cancel()
+
+	_, err := mexset.newExchange(expired, DefaultFramePool, messageTypeCallReq, 1, 1)
+	require.NoError(t, err, "newExchange failed")
+	_, err = mexset.newExchange(recent, DefaultFramePool, messageTypeCallReq, 2, 1)
+	require.NoError(t, err, "newExchange failed")
+	_, err = mexset.newExchange(context.Background(), DefaultFramePool, messageTypeCallReq, 3, 1)
+	require.NoError(t, err, "newExchange failed")
+
+	leaked := mexset.findLeaks(now, time.Minute)
+	require.Equal(t, 1, len(leaked), "expected a single leaked exchange")
+	assert.Equal(t, uint32(1), leaked[0].msgID, "unexpected leaked exchange")
+	assert.Contains(t, string(leaked[0].stack), "TestFindLeaks", "stack should contain the creator")
+
+	assert.Empty(t, mexset.findLeaks(now, time.Minute), "leaks should only be reported once")
+}
+
+func TestLeakDetector(t *testing.T) {
+	var logs SyncBuffer
+	ch, err := NewChannel("leak-detector", &ChannelOptions{
+		Logger:       NewLogger(&logs),
+		LeakDetector: &LeakDetectorOptions{CheckInterval: time.Millisecond, Grace: time.Millisecond},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+	require.NoError(t, ch.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	require.NoError(t, ch.Ping(ctx, ch.PeerInfo().HostPort), "Ping failed")
+
+	conn, err := ch.Peers().GetOrAdd(ch.PeerInfo().HostPort).GetConnection(ctx)
+	require.NoError(t, err, "GetConnection failed")
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	mex, err := conn.outbound.newExchange(expired, conn.framePool, messageTypeCallReq, conn.NextMessageID(), 1)
+	require.NoError(t, err, "newExchange failed")
+	defer mex.shutdown()
+
+	deadline := time.Now().Add(time.Second)
+	for ch.Gauges().LeakedExchanges == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, int64(1), ch.Gauges().LeakedExchanges, "leaked exchange should be counted")
+	assert.Contains(t, logs.String(), "message exchange is still active", "leak should be logged")
+	assert.Contains(t, logs.String(), "TestLeakDetector", "log should contain the creating stack")
+}
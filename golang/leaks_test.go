@@ -0,0 +1,78 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func echoFunc(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+	return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+}
+
+func TestWithTestChannel(t *testing.T) {
+	opts := &testutils.ChannelOpts{
+		ServiceName:              "leak-server",
+		DefaultConnectionOptions: ConnectionOptions{FramePool: NewSyncFramePool()},
+	}
+	testutils.WithTestChannel(t, opts, func(ch *Channel, hostPort string) {
+		testutils.RegisterFunc(t, ch, "echo", echoFunc)
+
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		arg2, arg3, _, err := raw.Call(ctx, client, hostPort, "leak-server", "echo", []byte("head"), []byte("body"))
+		require.NoError(t, err, "echo call failed")
+		assert.Equal(t, "head", string(arg2))
+		assert.Equal(t, "body", string(arg3))
+	})
+}
+
+func TestWithTestClientServer(t *testing.T) {
+	testutils.WithTestClientServer(t, nil, func(client, server *Channel, hostPort string) {
+		assert.Equal(t, testutils.DefaultClientName, client.PeerInfo().ServiceName)
+		assert.Equal(t, testutils.DefaultServerName, server.PeerInfo().ServiceName)
+		testutils.RegisterFunc(t, server, "echo", echoFunc)
+
+		// The timeout is longer than the leak check timeout, so goroutines that wait for
+		// the call's deadline are reported as leaks.
+		ctx, cancel := NewContext(10 * time.Second)
+		defer cancel()
+
+		for i := 0; i < 10; i++ {
+			_, arg3, _, err := raw.Call(ctx, client, hostPort, testutils.DefaultServerName, "echo", nil, []byte("body"))
+			require.NoError(t, err, "echo call failed")
+			assert.Equal(t, "body", string(arg3))
+		}
+	})
+}
@@ -28,6 +28,7 @@ import (
 
 import (
 	"os"
+	"sync/atomic"
 )
 
 // Logger provides an abstract interface for logging from TChannel.
@@ -185,3 +186,65 @@ func (l levelLogger) WithFields(fields ...LogField) Logger {
 		level:  l.level,
 	}
 }
+
+// dynamicLevelLogger is a levelLogger whose level can be changed at runtime. The level
+// is shared by all loggers created using WithFields.
+type dynamicLevelLogger struct {
+	logger Logger
+	level  *int32
+}
+
+func newDynamicLevelLogger(logger Logger, level LogLevel) dynamicLevelLogger {
+	l := dynamicLevelLogger{logger, new(int32)}
+	l.setLevel(level)
+	return l
+}
+
+func (l dynamicLevelLogger) getLevel() LogLevel {
+	return LogLevel(atomic.LoadInt32(l.level))
+}
+
+func (l dynamicLevelLogger) setLevel(level LogLevel) {
+	atomic.StoreInt32(l.level, int32(level))
+}
+
+func (l dynamicLevelLogger) Fatalf(msg string, args ...interface{}) {
+	if l.getLevel() <= LogLevelFatal {
+		l.logger.Fatalf(msg, args...)
+	}
+}
+
+func (l dynamicLevelLogger) Errorf(msg string, args ...interface{}) {
+	if l.getLevel() <= LogLevelError {
+		l.logger.Errorf(msg, args...)
+	}
+}
+
+func (l dynamicLevelLogger) Warnf(msg string, args ...interface{}) {
+	if l.getLevel() <= LogLevelWarn {
+		l.logger.Warnf(msg, args...)
+	}
+}
+
+func (l dynamicLevelLogger) Infof(msg string, args ...interface{}) {
+	if l.getLevel() <= LogLevelInfo {
+		l.logger.Infof(msg, args...)
+	}
+}
+
+func (l dynamicLevelLogger) Debugf(msg string, args ...interface{}) {
+	if l.getLevel() <= LogLevelDebug {
+		l.logger.Debugf(msg, args...)
+	}
+}
+
+func (l dynamicLevelLogger) Fields() LogFields {
+	return l.logger.Fields()
+}
+
+func (l dynamicLevelLogger) WithFields(fields ...LogField) Logger {
+	return dynamicLevelLogger{
+		logger: l.logger.WithFields(fields...),
+		level:  l.level,
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import "fmt"
+
+// maintenanceState records the operations of a subchannel's service that are under
+// maintenance, and the message to reject their calls with.
+type maintenanceState struct {
+	// all is set if the whole service is under maintenance.
+	all        bool
+	allMessage string
+
+	operations map[string]string
+}
+
+// StartMaintenance puts the given operations of the subchannel's service under maintenance,
+// or the whole service if no operations are given. New calls to an operation under
+// maintenance are rejected with ErrCodeDeclined and the given message, which tells callers
+// to retry the call on another peer, while other operations keep serving. Calls that are
+// already being handled are not affected. Calls to internal handlers, such as
+// introspection, are never rejected.
+//
+// Handlers registered on the Channel are for the channel's own service, so use
+// ch.GetSubChannel(ch.ServiceName()) to put them under maintenance.
+func (c *SubChannel) StartMaintenance(message string, operations ...string) {
+	c.maintenanceMut.Lock()
+	defer c.maintenanceMut.Unlock()
+
+	if len(operations) == 0 {
+		if message == "" {
+			message = fmt.Sprintf("service %q is under maintenance", c.serviceName)
+		}
+		c.maintenance.all = true
+		c.maintenance.allMessage = message
+		return
+	}
+
+	ops := make(map[string]string, len(c.maintenance.operations)+len(operations))
+	for op, msg := range c.maintenance.operations {
+		ops[op] = msg
+	}
+	for _, op := range operations {
+		msg := message
+		if msg == "" {
+			msg = fmt.Sprintf("operation %q of service %q is under maintenance", op, c.serviceName)
+		}
+		ops[op] = msg
+	}
+	c.maintenance.operations = ops
+}
+
+// EndMaintenance ends maintenance for the given operations of the subchannel's service.
+// If no operations are given, maintenance ends for the service and all of its operations.
+func (c *SubChannel) EndMaintenance(operations ...string) {
+	c.maintenanceMut.Lock()
+	defer c.maintenanceMut.Unlock()
+
+	if len(operations) == 0 {
+		c.maintenance = maintenanceState{}
+		return
+	}
+
+	ops := make(map[string]string, len(c.maintenance.operations))
+	for op, msg := range c.maintenance.operations {
+		ops[op] = msg
+	}
+	for _, op := range operations {
+		delete(ops, op)
+	}
+	c.maintenance.operations = ops
+}
+
+// InMaintenance returns whether calls to the given operation of the subchannel's service
+// are rejected as the operation or service is under maintenance.
+func (c *SubChannel) InMaintenance(operation string) bool {
+	return c.maintenanceError(operation) != nil
+}
+
+// maintenanceError returns the error to reject calls to the given operation with, or nil
+// if the operation is not under maintenance.
+func (c *SubChannel) maintenanceError(operation string) error {
+	c.maintenanceMut.RLock()
+	defer c.maintenanceMut.RUnlock()
+
+	if msg, ok := c.maintenance.operations[operation]; ok {
+		return NewDeclinedError(msg, nil)
+	}
+	if c.maintenance.all {
+		return NewDeclinedError(c.maintenance.allMessage, nil)
+	}
+	return nil
+}
+
+// maintenanceError returns the error to reject calls to the given service and operation
+// with, or nil if they are not under maintenance.
+func (subChMap *subChannelMap) maintenanceError(serviceName string, operation []byte) error {
+	sc, ok := subChMap.get(serviceName)
+	if !ok {
+		return nil
+	}
+	return sc.maintenanceError(string(operation))
+}
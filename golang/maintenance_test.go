@@ -0,0 +1,118 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestMaintenance(t *testing.T) {
+	WithVerifiedServer(t, nil, func(ch *Channel, hostPort string) {
+		for _, op := range []string{"a", "b"} {
+			testutils.RegisterFunc(t, ch, op, func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+				return &raw.Res{}, nil
+			})
+		}
+		sc := ch.GetSubChannel(ch.ServiceName())
+
+		// call returns the error message for a call to the given operation, or "" if it succeeded.
+		call := func(operation string) string {
+			ctx, cancel := NewContext(time.Second)
+			defer cancel()
+			_, _, _, err := raw.Call(ctx, ch, hostPort, ch.ServiceName(), operation, nil, nil)
+			if err == nil {
+				return ""
+			}
+			assert.Equal(t, ErrCodeDeclined, GetSystemErrorCode(err), "calls under maintenance should be declined")
+			return err.Error()
+		}
+
+		tests := []struct {
+			update func()
+			wantA  string
+			wantB  string
+		}{
+			{
+				update: func() {},
+			},
+			{
+				update: func() { sc.StartMaintenance("upgrading a", "a") },
+				wantA:  "upgrading a",
+			},
+			{
+				update: func() { sc.StartMaintenance("") },
+				wantA:  "upgrading a",
+				wantB:  `service "testService" is under maintenance`,
+			},
+			{
+				update: func() { sc.EndMaintenance("a") },
+				wantA:  `service "testService" is under maintenance`,
+				wantB:  `service "testService" is under maintenance`,
+			},
+			{
+				update: func() {
+					sc.EndMaintenance()
+					sc.StartMaintenance("", "b")
+				},
+				wantB: `operation "b" of service "testService" is under maintenance`,
+			},
+			{
+				update: func() { sc.EndMaintenance() },
+			},
+		}
+
+		for i, tt := range tests {
+			tt.update()
+			for _, c := range []struct {
+				op   string
+				want string
+			}{{"a", tt.wantA}, {"b", tt.wantB}} {
+				got := call(c.op)
+				assert.Equal(t, c.want != "", sc.InMaintenance(c.op), "%v: InMaintenance(%v) mismatch", i, c.op)
+				if c.want == "" {
+					assert.Equal(t, "", got, "%v: call to %v should succeed", i, c.op)
+					continue
+				}
+				assert.True(t, strings.HasPrefix(got, c.want), "%v: call to %v got error %q, want %q", i, c.op, got, c.want)
+			}
+		}
+	})
+}
+
+func TestMaintenanceAllowsInternalHandlers(t *testing.T) {
+	opts := &testutils.ChannelOpts{EnableIntrospection: true}
+	WithVerifiedServer(t, opts, func(ch *Channel, hostPort string) {
+		ch.GetSubChannel(ch.ServiceName()).StartMaintenance("")
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		_, _, _, err := raw.Call(ctx, ch, hostPort, ch.ServiceName(), IntrospectOperation, nil, []byte("{}"))
+		assert.NoError(t, err, "introspection should be allowed during maintenance")
+	})
+}
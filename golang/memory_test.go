@@ -0,0 +1,90 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/json"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestNewClientServer(t *testing.T) {
+	client, server, err := testutils.NewClientServer(nil)
+	require.NoError(t, err, "NewClientServer failed")
+	defer client.Close()
+	defer server.Close()
+
+	testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+	require.NoError(t, json.Register(server, json.Handlers{
+		"greet": func(ctx json.Context, args map[string]string) (map[string]string, error) {
+			return map[string]string{"greeting": "hello " + args["name"]}, nil
+		},
+	}, nil), "json.Register failed")
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+
+	hostPort := server.PeerInfo().HostPort
+	arg2, arg3, _, err := raw.Call(ctx, client, hostPort, server.PeerInfo().ServiceName, "echo", []byte("head"), []byte("body"))
+	require.NoError(t, err, "raw call failed")
+	assert.Equal(t, "head", string(arg2))
+	assert.Equal(t, "body", string(arg3))
+
+	jctx, jcancel := json.NewContext(time.Second)
+	defer jcancel()
+
+	var res map[string]string
+	sc := client.GetSubChannel(server.PeerInfo().ServiceName)
+	require.NoError(t, json.CallSC(jctx, sc, "greet", map[string]string{"name": "world"}, &res), "json call failed")
+	assert.Equal(t, "hello world", res["greeting"])
+}
+
+func TestMemoryNetworkDial(t *testing.T) {
+	network := testutils.NewMemoryNetwork()
+	_, err := network.Dial("inmemory:1")
+	assert.Error(t, err, "Dial should fail with no listener")
+
+	l := network.Listen()
+	server, err := NewChannel("svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.Serve(l), "Serve failed")
+
+	client, err := NewChannel("client", &ChannelOptions{Dialer: network.Dial})
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	assert.NoError(t, client.Ping(ctx, l.Addr().String()), "Ping failed")
+
+	server.Close()
+	_, err = network.Dial(l.Addr().String())
+	assert.Error(t, err, "Dial should fail after the listener is closed")
+}
@@ -38,6 +38,9 @@ const (
 	messageTypeCallResContinue messageType = 0x14
 	messageTypePingReq         messageType = 0xd0
 	messageTypePingRes         messageType = 0xd1
+	messageTypeCallProgress    messageType = 0xe0
+	messageTypeDrainNotice     messageType = 0xe1
+	messageTypeWindowUpdate    messageType = 0xe2
 	messageTypeError           messageType = 0xFF
 )
 
@@ -73,6 +76,9 @@ const (
 
 	// InitParamProcessName contains the name of the peer process
 	InitParamProcessName = "process_name"
+
+	// InitParamAuthToken contains the authentication token of the peer process
+	InitParamAuthToken = "auth_token"
 )
 
 // initMessage is the base for messages in the initialization handshake
@@ -154,11 +160,32 @@ const (
 	// ShardKey header value is used by ringpop to deliver calls to a specific tchannel instance.
 	ShardKey TransportHeaderName = "sk"
 
+	// RoutingDelegate header identifies a service that the call should be routed through,
+	// such as a router or proxy, rather than directly to the service being called.
+	RoutingDelegate TransportHeaderName = "rd"
+
 	// RetryFlags header specifies whether retry policies.
 	RetryFlags TransportHeaderName = "re"
 
 	// SpeculativeExecution header specifies the number of nodes on which to run the request.
 	SpeculativeExecution TransportHeaderName = "se"
+
+	// IdempotencyKey header identifies repeated attempts of the same request, so that servers
+	// with deduplication enabled can return the original response instead of handling it again.
+	IdempotencyKey TransportHeaderName = "ik"
+
+	// PayloadSignature header contains the signature of the call's arguments, which is
+	// verified by servers with payload signing enabled.
+	PayloadSignature TransportHeaderName = "ps"
+
+	// ContentHash header contains a hash of the call's arg3, which is verified by the final
+	// receiver if content hashes are enabled, see ContentHashOptions.
+	ContentHash TransportHeaderName = "ch"
+
+	// Heartbeat header is the interval, in milliseconds, at which the caller would like
+	// progress messages while the call is handled. Progress messages are an extension to
+	// the protocol, and are only sent to callers that set this header.
+	Heartbeat TransportHeaderName = "hb"
 )
 
 // transportHeaders are passed as part of a CallReq/CallRes
@@ -289,7 +316,7 @@ func (m *errorMessage) write(w *typed.WriteBuffer) error {
 
 func (m errorMessage) AsSystemError() error {
 	// TODO(mmihic): Might be nice to return one of the well defined error types
-	return NewSystemError(m.errCode, m.message)
+	return newPeerSystemError(m.errCode, m.message)
 }
 
 type pingReq struct {
@@ -308,3 +335,73 @@ type pingRes struct {
 
 func (c *pingRes) ID() uint32               { return c.id }
 func (c *pingRes) messageType() messageType { return messageTypePingRes }
+
+// callProgress is sent by the handler's peer for a call that requested heartbeats,
+// to show that the call is still being handled. Progress is empty for heartbeats,
+// and otherwise set by the handler.
+type callProgress struct {
+	id       uint32
+	progress string
+}
+
+func (m *callProgress) ID() uint32               { return m.id }
+func (m *callProgress) messageType() messageType { return messageTypeCallProgress }
+func (m *callProgress) read(r *typed.ReadBuffer) error {
+	m.progress = r.ReadLen16String()
+	return r.Err()
+}
+
+func (m *callProgress) write(w *typed.WriteBuffer) error {
+	w.WriteLen16String(m.progress)
+	return w.Err()
+}
+
+// drainNotice is sent by a peer when it starts or stops draining, so that the receiver
+// stops or resumes selecting it for new calls.
+type drainNotice struct {
+	id       uint32
+	draining bool
+}
+
+func (m *drainNotice) ID() uint32               { return m.id }
+func (m *drainNotice) messageType() messageType { return messageTypeDrainNotice }
+func (m *drainNotice) read(r *typed.ReadBuffer) error {
+	m.draining = r.ReadSingleByte() == 1
+	return r.Err()
+}
+
+func (m *drainNotice) write(w *typed.WriteBuffer) error {
+	var draining byte
+	if m.draining {
+		draining = 1
+	}
+	w.WriteSingleByte(draining)
+	return w.Err()
+}
+
+// windowUpdate returns flow control credits to the writer of a message, allowing it to
+// send that many more continuation frames. forRequest is set if the message is the
+// request of the call, rather than the response.
+type windowUpdate struct {
+	id         uint32
+	forRequest bool
+	credits    uint32
+}
+
+func (m *windowUpdate) ID() uint32               { return m.id }
+func (m *windowUpdate) messageType() messageType { return messageTypeWindowUpdate }
+func (m *windowUpdate) read(r *typed.ReadBuffer) error {
+	m.forRequest = r.ReadSingleByte() == 1
+	m.credits = r.ReadUint32()
+	return r.Err()
+}
+
+func (m *windowUpdate) write(w *typed.WriteBuffer) error {
+	var forRequest byte
+	if m.forRequest {
+		forRequest = 1
+	}
+	w.WriteSingleByte(forRequest)
+	w.WriteUint32(m.credits)
+	return w.Err()
+}
@@ -138,6 +138,29 @@ func TestErrorMessage(t *testing.T) {
 	assertRoundTrip(t, &m, &errorMessage{})
 }
 
+func TestCallProgress(t *testing.T) {
+	m := callProgress{
+		id:       0xDEADBEEF,
+		progress: "50%",
+	}
+
+	assert.Equal(t, uint32(0xDEADBEEF), m.ID())
+	assert.Equal(t, messageTypeCallProgress, m.messageType())
+	assertRoundTrip(t, &m, &callProgress{id: 0xDEADBEEF})
+}
+
+func TestWindowUpdate(t *testing.T) {
+	m := windowUpdate{
+		id:         0xDEADBEEF,
+		forRequest: true,
+		credits:    32,
+	}
+
+	assert.Equal(t, uint32(0xDEADBEEF), m.ID())
+	assert.Equal(t, messageTypeWindowUpdate, m.messageType())
+	assertRoundTrip(t, &m, &windowUpdate{id: 0xDEADBEEF})
+}
+
 func assertRoundTrip(t *testing.T, expected message, actual message) {
 	w := typed.NewWriteBufferWithSize(1024)
 	require.Nil(t, expected.write(w), fmt.Sprintf("error writing message %v", expected.messageType()))
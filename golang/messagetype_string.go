@@ -8,14 +8,16 @@ const (
 	_messageType_name_0 = "messageTypeInitReqmessageTypeInitResmessageTypeCallReqmessageTypeCallRes"
 	_messageType_name_1 = "messageTypeCallReqContinuemessageTypeCallResContinue"
 	_messageType_name_2 = "messageTypePingReqmessageTypePingRes"
-	_messageType_name_3 = "messageTypeError"
+	_messageType_name_3 = "messageTypeCallProgressmessageTypeDrainNoticemessageTypeWindowUpdate"
+	_messageType_name_4 = "messageTypeError"
 )
 
 var (
 	_messageType_index_0 = [...]uint8{0, 18, 36, 54, 72}
 	_messageType_index_1 = [...]uint8{0, 26, 52}
 	_messageType_index_2 = [...]uint8{0, 18, 36}
-	_messageType_index_3 = [...]uint8{0, 16}
+	_messageType_index_3 = [...]uint8{0, 23, 45, 68}
+	_messageType_index_4 = [...]uint8{0, 16}
 )
 
 func (i messageType) String() string {
@@ -29,8 +31,11 @@ func (i messageType) String() string {
 	case 208 <= i && i <= 209:
 		i -= 208
 		return _messageType_name_2[_messageType_index_2[i]:_messageType_index_2[i+1]]
+	case 224 <= i && i <= 226:
+		i -= 224
+		return _messageType_name_3[_messageType_index_3[i]:_messageType_index_3[i+1]]
 	case i == 255:
-		return _messageType_name_3
+		return _messageType_name_4
 	default:
 		return fmt.Sprintf("messageType(%d)", i)
 	}
@@ -23,6 +23,7 @@ package tchannel
 import (
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/uber/tchannel/golang/typed"
 	"golang.org/x/net/context"
@@ -31,6 +32,8 @@ import (
 var (
 	errDuplicateMex        = errors.New("multiple attempts to use the message id")
 	errMexChannelFull      = NewSystemError(ErrCodeBusy, "cannot send frame to message exchange channel")
+	errMexShutdown         = errors.New("message exchange was shut down")
+	errConnectionLost      = NewSystemError(ErrCodeNetwork, "connection to peer was lost")
 	errUnexpectedFrameType = errors.New("unexpected frame received")
 )
 
@@ -50,13 +53,50 @@ type messageExchange struct {
 	msgType   messageType
 	mexset    *messageExchangeSet
 	framePool FramePool
+
+	// removed is closed when the exchange is removed from its message exchange set.
+	removed chan struct{}
+
+	// lost is closed if the connection fails, so the exchange can no longer complete.
+	lost <-chan struct{}
+
+	// flow is set for calls on connections where both peers support flow control.
+	flow *flowControl
+
+	// stallTimeout defaults to the connection's StallTimeout, and bufferedSince is when the oldest frame
+	// that is waiting for the reader was received, in Unix nanoseconds.
+	stallTimeout  time.Duration
+	bufferedSince int64
+
+	// heartbeat is set for outbound calls that requested heartbeats.
+	heartbeat *heartbeatMonitor
+
+	// onResponse is set for calls made using CallAsync, and is called once the last
+	// frame of the response has been forwarded.
+	onResponse func()
+
+	// onRemoved is called once the exchange is removed from its message exchange set.
+	onRemoved func()
+
+	// createdAt and stack are only set if the leak detector is enabled.
+	createdAt    time.Time
+	stack        []byte
+	leakReported bool
 }
 
 // forwardPeerFrame forwards a frame from a peer to the message exchange, where
 // it can be pulled by whatever application thread is handling the exchange
 func (mex *messageExchange) forwardPeerFrame(frame *Frame) error {
+	if mex.heartbeat != nil {
+		mex.heartbeat.respond()
+	}
+
 	select {
 	case mex.recvCh <- frame:
+		mex.frameBuffered()
+		if mex.onResponse != nil && (frame.Header.messageType == messageTypeError || !hasMoreFragments(frame)) {
+			mex.onResponse()
+		}
 		return nil
 	default:
 		return errMexChannelFull
@@ -64,21 +104,62 @@ func (mex *messageExchange) forwardPeerFrame(frame *Frame) error {
 }
 
 // recvPeerFrame waits for a new frame from the peer, or until the context
-// expires or is cancelled
-func (mex *messageExchange) recvPeerFrame() (*Frame, error) {
+// expires or is cancelled. If the frame is a continuation of a message, it also
+// fails if the frame does not arrive within the stall timeout.
+func (mex *messageExchange) recvPeerFrame(continuation bool) (*Frame, error) {
+	if err := mex.checkStalled(); err != nil {
+		return nil, err
+	}
+
+	var stalledC <-chan time.Time
+	if continuation && mex.stallTimeout > 0 {
+		// Avoid creating a timer if the frame has already been received.
+		select {
+		case frame := <-mex.recvCh:
+			return mex.consumeFrame(frame)
+		default:
+		}
+
+		timer := time.NewTimer(mex.stallTimeout)
+		defer timer.Stop()
+		stalledC = timer.C
+	}
+
 	select {
 	case frame := <-mex.recvCh:
-		return frame, nil
+		return mex.consumeFrame(frame)
+
+	case <-stalledC:
+		return nil, ErrStreamStalled
+
+	case <-mex.lost:
+		// Frames received before the connection failed can still be read.
+		select {
+		case frame := <-mex.recvCh:
+			return mex.consumeFrame(frame)
+		default:
+			return nil, errConnectionLost
+		}
 
 	case <-mex.ctx.Done():
 		return nil, mex.ctx.Err()
 	}
 }
 
+// consumeFrame returns a frame received from the peer to the reader, once any flow
+// control credits for it have been returned.
+func (mex *messageExchange) consumeFrame(frame *Frame) (*Frame, error) {
+	if err := mex.frameConsumed(frame); err != nil {
+		mex.framePool.Release(frame)
+		return nil, err
+	}
+	return frame, nil
+}
+
 // recvPeerFrameOfType waits for a new frame of a given type from the peer, failing
 // if the next frame received is not of that type
-func (mex *messageExchange) recvPeerFrameOfType(msgType messageType) (*Frame, error) {
-	frame, err := mex.recvPeerFrame()
+func (mex *messageExchange) recvPeerFrameOfType(msgType messageType, continuation bool) (*Frame, error) {
+	frame, err := mex.recvPeerFrame(continuation)
 	if err != nil {
 		return nil, err
 	}
@@ -128,6 +209,23 @@ type messageExchangeSet struct {
 	name      string
 	onRemoved func()
 
+	// captureStacks records the stack that created each exchange, for leak detection.
+	captureStacks bool
+
+	// lost is closed if the connection fails, and is shared by the connection's exchanges.
+	lost chan struct{}
+
+	// stallTimeout is the default stall timeout for exchanges.
+	stallTimeout time.Duration
+
+	// flowWindow and peerFlowWindow are the flow control windows of the local and remote
+	// peers. They are only set if both peers support flow control.
+	flowWindow     int
+	peerFlowWindow int
+
+	// sendCh is the connection's send channel, used to send window updates.
+	sendCh chan<- *Frame
+
 	exchanges map[uint32]*messageExchange
 	mut       sync.RWMutex
 }
@@ -138,12 +236,22 @@ func (mexset *messageExchangeSet) newExchange(ctx context.Context, framePool Fra
 	mexset.log.Debugf("Creating new %s message exchange for [%v:%d]", mexset.name, msgType, msgID)
 
 	mex := &messageExchange{
-		msgType:   msgType,
-		msgID:     msgID,
-		ctx:       ctx,
-		recvCh:    make(chan *Frame, bufferSize),
-		mexset:    mexset,
-		framePool: framePool,
+		msgType:      msgType,
+		msgID:        msgID,
+		ctx:          ctx,
+		recvCh:       make(chan *Frame, bufferSize),
+		mexset:       mexset,
+		framePool:    framePool,
+		removed:      make(chan struct{}),
+		lost:         mexset.lost,
+		stallTimeout: mexset.stallTimeout,
+	}
+	if msgType == messageTypeCallReq && mexset.peerFlowWindow > 0 {
+		mex.flow = newFlowControl(mexset.flowWindow, mexset.peerFlowWindow)
+	}
+	if mexset.captureStacks {
+		mex.createdAt = timeNow()
+		mex.stack = captureStack()
 	}
 
 	mexset.mut.Lock()
@@ -162,6 +270,7 @@ func (mexset *messageExchangeSet) newExchange(ctx context.Context, framePool Fra
 	}
 
 	mexset.exchanges[mex.msgID] = mex
+	profileAddExchange(mex)
 
 	// TODO(mmihic): Put into a deadline ordered heap so we can garbage collected expired exchanges
 	return mex, nil
@@ -172,13 +281,77 @@ func (mexset *messageExchangeSet) newExchange(ctx context.Context, framePool Fra
 func (mexset *messageExchangeSet) removeExchange(msgID uint32) {
 	mexset.log.Debugf("Removing %s message exchange %d", mexset.name, msgID)
 
+	var onRemoved func()
 	mexset.mut.Lock()
-	delete(mexset.exchanges, msgID)
+	if mex, ok := mexset.exchanges[msgID]; ok {
+		// Let the peer finish sending a message that will no longer be read. This is sent
+		// while the exchange is registered, so the connection cannot close sendCh.
+		if mex.flow != nil && mex.flow.release() {
+			mex.sendWindowUpdate(unlimitedCredits)
+		}
+		profileRemoveExchange(mex)
+		delete(mexset.exchanges, msgID)
+		close(mex.removed)
+		onRemoved = mex.onRemoved
+	}
 	mexset.mut.Unlock()
 
+	if onRemoved != nil {
+		onRemoved()
+	}
 	mexset.onRemoved()
 }
 
+// setHeartbeatMonitor sets the heartbeat monitor for an exchange. The monitor is set
+// with the set's lock held, so it is visible to goroutines that look up the exchange.
+func (mexset *messageExchangeSet) setHeartbeatMonitor(mex *messageExchange, monitor *heartbeatMonitor) {
+	mexset.mut.Lock()
+	mex.heartbeat = monitor
+	mexset.mut.Unlock()
+}
+
+// setResponseHook sets the function called once the exchange has received the whole
+// response. Like the heartbeat monitor, it is set with the set's lock held.
+func (mexset *messageExchangeSet) setResponseHook(mex *messageExchange, onResponse func()) {
+	mexset.mut.Lock()
+	mex.onResponse = onResponse
+	mexset.mut.Unlock()
+}
+
+// setRemovedHook sets the function called once the exchange is removed, however the
+// exchange ends. If the exchange has already been removed, it is called immediately.
+func (mexset *messageExchangeSet) setRemovedHook(mex *messageExchange, onRemoved func()) {
+	mexset.mut.Lock()
+	select {
+	case <-mex.removed:
+		mexset.mut.Unlock()
+		onRemoved()
+		return
+	default:
+	}
+	mex.onRemoved = onRemoved
+	mexset.mut.Unlock()
+}
+
+// exchange returns the exchange with the given message ID, if any.
+func (mexset *messageExchangeSet) exchange(msgID uint32) *messageExchange {
+	mexset.mut.RLock()
+	mex := mexset.exchanges[msgID]
+	mexset.mut.RUnlock()
+	return mex
+}
+
+// heartbeatMonitor returns the heartbeat monitor for the given exchange, if any.
+func (mexset *messageExchangeSet) heartbeatMonitor(msgID uint32) *heartbeatMonitor {
+	mexset.mut.RLock()
+	defer mexset.mut.RUnlock()
+
+	if mex := mexset.exchanges[msgID]; mex != nil {
+		return mex.heartbeat
+	}
+	return nil
+}
+
 func (mexset *messageExchangeSet) count() int {
 	mexset.mut.RLock()
 	count := len(mexset.exchanges)
@@ -0,0 +1,63 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"math"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// messageIDCycleThreshold is the message ID at which a connection is replaced. Message
+// IDs are 32 bits and wrap around, so long-lived connections that make a very large
+// number of calls are replaced before IDs could be reused by calls that are in progress.
+// The remaining IDs are left for calls that start before the connection is closed.
+const messageIDCycleThreshold = math.MaxUint32 - 1<<24
+
+// replacementConnectTimeout is the timeout for connecting a replacement for a
+// connection that has run out of message IDs.
+const replacementConnectTimeout = 5 * time.Second
+
+// cycleOutboundConnection replaces an outbound connection that is running out of message
+// IDs. A new connection is made to the peer before the old connection is gracefully
+// closed, so that new calls use the new connection while calls on the old connection
+// complete.
+func (ch *Channel) cycleOutboundConnection(c *Connection, hostPort string) {
+	c.log.Infof("Replacing connection to %v as it is running out of message IDs", hostPort)
+	ch.statsReporter.IncCounter("connection.message-ids-exhausted", ch.commonStatsTags, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), replacementConnectTimeout)
+	defer cancel()
+	if _, err := ch.Peers().GetOrAdd(hostPort).Connect(ctx); err != nil {
+		c.log.Warnf("Failed to connect a replacement connection to %v: %v", hostPort, err)
+	}
+	c.Close()
+}
+
+// cycleInboundConnection gracefully closes an inbound connection that is running out of
+// message IDs. The remote peer connects again for new calls, and new calls to the peer
+// use another connection.
+func (ch *Channel) cycleInboundConnection(c *Connection) {
+	c.log.Infof("Closing connection from %v as it is running out of message IDs", c.remotePeerInfo)
+	ch.statsReporter.IncCounter("connection.message-ids-exhausted", ch.commonStatsTags, 1)
+	c.Close()
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestMessageIDExhaustion(t *testing.T) {
+	WithVerifiedServer(t, nil, func(ch *Channel, hostPort string) {
+		testutils.RegisterFunc(t, ch, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			return &raw.Res{Arg3: args.Arg3}, nil
+		})
+
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		call := func() {
+			ctx, cancel := NewContext(time.Second)
+			defer cancel()
+			_, _, _, err := raw.Call(ctx, client, hostPort, testServiceName, "echo", nil, []byte("body"))
+			require.NoError(t, err, "Call failed")
+		}
+
+		call()
+		conns := GetConnections(client)
+		require.Len(t, conns, 1, "expected a single connection")
+		old := conns[0]
+
+		SetLastMessageID(old, MessageIDCycleThreshold-1)
+		call()
+
+		// The connection is replaced once the call reserves the threshold ID.
+		deadline := time.Now().Add(time.Second)
+		for old.IsActive() && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		assert.False(t, old.IsActive(), "exhausted connection should be closed")
+
+		conns = GetConnections(client)
+		require.Len(t, conns, 2, "a replacement connection should be made")
+		assert.True(t, conns[1].IsActive(), "replacement connection should be active")
+
+		call()
+		assert.True(t, conns[1].NextMessageID() < 10, "new calls should use the replacement connection")
+	})
+}
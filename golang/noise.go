@@ -0,0 +1,497 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+)
+
+// noiseProtocolName is the Noise protocol used to encrypt connections. The NN pattern
+// does not authenticate peers, so it protects against passive eavesdroppers only. An
+// active attacker can complete a separate handshake with each peer and read all traffic.
+const noiseProtocolName = "Noise_NN_25519_AESGCM_SHA256"
+
+const (
+	// InitParamEncryption contains the Noise protocol offered or accepted for the connection.
+	InitParamEncryption = "tchannel_encryption"
+
+	// InitParamEncryptionHandshake contains the hex-encoded Noise handshake message.
+	InitParamEncryptionHandshake = "tchannel_encryption_handshake"
+)
+
+// maxNoiseRecord is the largest plaintext encrypted in a single record, so that records
+// with the authentication tag fit in a 2 byte length.
+const maxNoiseRecord = 65535 - 16
+
+var (
+	errEncryptionRequired = errors.New("connection encryption is required")
+	errNoiseHandshake     = errors.New("invalid encryption handshake")
+)
+
+// EncryptionOptions configure encryption of connections using a Noise handshake during
+// the init handshake, for environments where TLS is not available. Connections are only
+// encrypted if both peers enable encryption.
+//
+// Peers are not authenticated, so encryption only protects against passive eavesdroppers,
+// and TLS should be used when peers must be authenticated. The init request and response
+// params are bound to the handshake, so they cannot be modified without the handshake
+// failing, but they are sent in cleartext.
+type EncryptionOptions struct {
+	// Required rejects connections with peers that do not support encryption. If it is
+	// false, an attacker can remove the encryption params from the init request, and the
+	// connection falls back to plaintext without either peer noticing.
+	Required bool
+}
+
+// noiseCipher is a Noise CipherState using AES-GCM.
+type noiseCipher struct {
+	aead  cipher.AEAD
+	nonce uint64
+}
+
+func newNoiseCipher(key []byte) *noiseCipher {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return &noiseCipher{aead: aead}
+}
+
+func (c *noiseCipher) nextNonce() []byte {
+	var nonce [12]byte
+	binary.BigEndian.PutUint64(nonce[4:], c.nonce)
+	c.nonce++
+	return nonce[:]
+}
+
+func (c *noiseCipher) seal(dst, ad, plaintext []byte) []byte {
+	return c.aead.Seal(dst, c.nextNonce(), plaintext, ad)
+}
+
+func (c *noiseCipher) open(dst, ad, ciphertext []byte) ([]byte, error) {
+	return c.aead.Open(dst, c.nextNonce(), ciphertext, ad)
+}
+
+// noiseHandshake is the Noise HandshakeState for the NN pattern, where the initiator
+// sends its ephemeral key, and the responder replies with its ephemeral key (-> e, <- e, ee).
+type noiseHandshake struct {
+	ck, h []byte
+	k     *noiseCipher
+	e     *ecdh.PrivateKey
+}
+
+// newNoiseHandshake returns a handshake using the init request params as the prologue.
+func newNoiseHandshake(reqParams initParams) (*noiseHandshake, error) {
+	e, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// The protocol name is shorter than the hash length, so it is padded with zeros.
+	h := make([]byte, sha256.Size)
+	copy(h, noiseProtocolName)
+	hs := &noiseHandshake{ck: h, h: h, e: e}
+	hs.mixHash(encodeNoiseParams(reqParams))
+	return hs, nil
+}
+
+// encodeNoiseParams returns the init params, other than the handshake message, sorted
+// by key and encoded with length prefixes, so that they can be mixed into the handshake.
+func encodeNoiseParams(params initParams) []byte {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		if k != InitParamEncryptionHandshake {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var buf []byte
+	var size [2]byte
+	for _, k := range keys {
+		for _, field := range []string{k, params[k]} {
+			binary.BigEndian.PutUint16(size[:], uint16(len(field)))
+			buf = append(buf, size[:]...)
+			buf = append(buf, field...)
+		}
+	}
+	return buf
+}
+
+func (hs *noiseHandshake) mixHash(data []byte) {
+	sum := sha256.New()
+	sum.Write(hs.h)
+	sum.Write(data)
+	hs.h = sum.Sum(nil)
+}
+
+// noiseHKDF returns the first two outputs of HKDF using the chaining key.
+func noiseHKDF(ck, ikm []byte) ([]byte, []byte) {
+	hmacSum := func(key []byte, data ...[]byte) []byte {
+		mac := hmac.New(sha256.New, key)
+		for _, d := range data {
+			mac.Write(d)
+		}
+		return mac.Sum(nil)
+	}
+	tempKey := hmacSum(ck, ikm)
+	out1 := hmacSum(tempKey, []byte{1})
+	out2 := hmacSum(tempKey, out1, []byte{2})
+	return out1, out2
+}
+
+func (hs *noiseHandshake) mixKey(ikm []byte) {
+	var k []byte
+	hs.ck, k = noiseHKDF(hs.ck, ikm)
+	hs.k = newNoiseCipher(k)
+}
+
+func (hs *noiseHandshake) encryptAndHash(plaintext []byte) []byte {
+	ciphertext := plaintext
+	if hs.k != nil {
+		ciphertext = hs.k.seal(nil, hs.h, plaintext)
+	}
+	hs.mixHash(ciphertext)
+	return ciphertext
+}
+
+func (hs *noiseHandshake) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	plaintext := ciphertext
+	if hs.k != nil {
+		var err error
+		if plaintext, err = hs.k.open(nil, hs.h, ciphertext); err != nil {
+			return nil, err
+		}
+	}
+	hs.mixHash(ciphertext)
+	return plaintext, nil
+}
+
+// writeE writes the local ephemeral key.
+func (hs *noiseHandshake) writeE() []byte {
+	pub := hs.e.PublicKey().Bytes()
+	hs.mixHash(pub)
+	return pub
+}
+
+// readE reads the remote ephemeral key, and returns the rest of the message.
+func (hs *noiseHandshake) readE(msg []byte) (*ecdh.PublicKey, []byte, error) {
+	if len(msg) < 32 {
+		return nil, nil, errNoiseHandshake
+	}
+	re, err := ecdh.X25519().NewPublicKey(msg[:32])
+	if err != nil {
+		return nil, nil, err
+	}
+	hs.mixHash(msg[:32])
+	return re, msg[32:], nil
+}
+
+// mixEE mixes the shared secret of the local and remote ephemeral keys.
+func (hs *noiseHandshake) mixEE(re *ecdh.PublicKey) error {
+	secret, err := hs.e.ECDH(re)
+	if err != nil {
+		return err
+	}
+	hs.mixKey(secret)
+	return nil
+}
+
+// split returns the ciphers for messages sent by the initiator and the responder.
+func (hs *noiseHandshake) split() (*noiseCipher, *noiseCipher) {
+	k1, k2 := noiseHKDF(hs.ck, nil)
+	return newNoiseCipher(k1), newNoiseCipher(k2)
+}
+
+// initiate returns the initiator's first handshake message.
+func (hs *noiseHandshake) initiate() []byte {
+	msg := hs.writeE()
+	return append(msg, hs.encryptAndHash(nil)...)
+}
+
+// respond reads the initiator's message, and returns the responder's message
+// and the ciphers for sending and receiving. The init response params are mixed into
+// the handshake before the responder's message, which authenticates them.
+func (hs *noiseHandshake) respond(msg []byte, resParams initParams) ([]byte, *noiseCipher, *noiseCipher, error) {
+	re, payload, err := hs.readE(msg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if _, err := hs.decryptAndHash(payload); err != nil {
+		return nil, nil, nil, err
+	}
+
+	hs.mixHash(encodeNoiseParams(resParams))
+	res := hs.writeE()
+	if err := hs.mixEE(re); err != nil {
+		return nil, nil, nil, err
+	}
+	res = append(res, hs.encryptAndHash(nil)...)
+
+	recv, send := hs.split()
+	return res, send, recv, nil
+}
+
+// finish reads the responder's message, and returns the ciphers for sending and receiving.
+// It fails if the init request or response params were modified.
+func (hs *noiseHandshake) finish(msg []byte, resParams initParams) (*noiseCipher, *noiseCipher, error) {
+	hs.mixHash(encodeNoiseParams(resParams))
+	re, payload, err := hs.readE(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := hs.mixEE(re); err != nil {
+		return nil, nil, err
+	}
+	if _, err := hs.decryptAndHash(payload); err != nil {
+		return nil, nil, err
+	}
+
+	send, recv := hs.split()
+	return send, recv, nil
+}
+
+// noiseConn is a connection that is encrypted once the Noise handshake completes.
+// Each write is sent as one or more records, containing a 2 byte length and the ciphertext.
+type noiseConn struct {
+	net.Conn
+	required bool
+
+	// recv and readBuf are only used by the connection's read goroutine.
+	recv    *noiseCipher
+	readBuf []byte
+
+	// writeBuf is only used by the connection's write goroutine.
+	writeBuf []byte
+
+	mut         sync.Mutex
+	handshake   *noiseHandshake
+	send        *noiseCipher
+	pendingSend *noiseCipher
+	err         error
+}
+
+func (n *noiseConn) Read(p []byte) (int, error) {
+	if n.recv == nil {
+		return n.Conn.Read(p)
+	}
+
+	if len(n.readBuf) == 0 {
+		var size [2]byte
+		if _, err := io.ReadFull(n.Conn, size[:]); err != nil {
+			return 0, err
+		}
+		record := make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(n.Conn, record); err != nil {
+			return 0, err
+		}
+		plaintext, err := n.recv.open(record[:0], nil, record)
+		if err != nil {
+			return 0, err
+		}
+		n.readBuf = plaintext
+	}
+
+	copied := copy(p, n.readBuf)
+	n.readBuf = n.readBuf[copied:]
+	return copied, nil
+}
+
+// Write encrypts and writes p. It is only called by the connection's write goroutine,
+// so the send cipher is only used by one goroutine once it is set.
+func (n *noiseConn) Write(p []byte) (int, error) {
+	n.mut.Lock()
+	send := n.send
+	n.mut.Unlock()
+
+	if send == nil {
+		return n.Conn.Write(p)
+	}
+
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > maxNoiseRecord {
+			chunk = chunk[:maxNoiseRecord]
+		}
+		if size := 2 + len(chunk) + send.aead.Overhead(); cap(n.writeBuf) < size {
+			n.writeBuf = make([]byte, 0, size)
+		}
+		record := send.seal(n.writeBuf[:2], nil, chunk)
+		binary.BigEndian.PutUint16(record, uint16(len(record)-2))
+		if _, err := n.Conn.Write(record); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// initResWritten is called once the init response has been written, after which
+// the responder encrypts the frames it sends.
+func (n *noiseConn) initResWritten() {
+	if n == nil {
+		return
+	}
+
+	n.mut.Lock()
+	if n.pendingSend != nil {
+		n.send, n.pendingSend = n.pendingSend, nil
+	}
+	n.mut.Unlock()
+}
+
+// handshakeErr returns the error if the initiator could not complete the handshake.
+func (n *noiseConn) handshakeErr() error {
+	if n == nil {
+		return nil
+	}
+
+	n.mut.Lock()
+	defer n.mut.Unlock()
+	return n.err
+}
+
+// offerEncryption adds the initiator's handshake message to the init request params.
+// The params are bound to the handshake, so it must be called after all other params are set.
+func (c *Connection) offerEncryption(params initParams) error {
+	if c.noise == nil {
+		return nil
+	}
+
+	params[InitParamEncryption] = noiseProtocolName
+	hs, err := newNoiseHandshake(params)
+	if err != nil {
+		return err
+	}
+
+	c.noise.mut.Lock()
+	c.noise.handshake = hs
+	c.noise.mut.Unlock()
+
+	params[InitParamEncryptionHandshake] = hex.EncodeToString(hs.initiate())
+	return nil
+}
+
+// acceptEncryption completes the responder's side of the handshake using the init request
+// params, and adds the responder's handshake message to the init response params. Frames
+// received after the init request are decrypted, and frames sent after the init response
+// are encrypted.
+func (c *Connection) acceptEncryption(reqParams, resParams initParams) error {
+	if c.noise == nil {
+		return nil
+	}
+
+	if reqParams[InitParamEncryption] != noiseProtocolName {
+		if c.noise.required {
+			return errEncryptionRequired
+		}
+		return nil
+	}
+
+	msg, err := hex.DecodeString(reqParams[InitParamEncryptionHandshake])
+	if err != nil {
+		return errNoiseHandshake
+	}
+	hs, err := newNoiseHandshake(reqParams)
+	if err != nil {
+		return err
+	}
+	resParams[InitParamEncryption] = noiseProtocolName
+	res, send, recv, err := hs.respond(msg, resParams)
+	if err != nil {
+		return fmt.Errorf("%v: %v", errNoiseHandshake, err)
+	}
+
+	resParams[InitParamEncryptionHandshake] = hex.EncodeToString(res)
+	c.noise.recv = recv
+	c.noise.mut.Lock()
+	c.noise.pendingSend = send
+	c.noise.mut.Unlock()
+	return nil
+}
+
+// completeEncryption completes the initiator's side of the handshake using the init
+// response params. All frames sent and received after the init response are encrypted.
+func (c *Connection) completeEncryption(resParams initParams) error {
+	if c.noise == nil {
+		return nil
+	}
+
+	c.noise.mut.Lock()
+	defer c.noise.mut.Unlock()
+
+	hs := c.noise.handshake
+	c.noise.handshake = nil
+	if hs == nil {
+		return nil
+	}
+
+	if resParams[InitParamEncryption] != noiseProtocolName {
+		if c.noise.required {
+			c.noise.err = errEncryptionRequired
+		}
+		return c.noise.err
+	}
+
+	msg, err := hex.DecodeString(resParams[InitParamEncryptionHandshake])
+	if err != nil {
+		c.noise.err = errNoiseHandshake
+		return c.noise.err
+	}
+	send, recv, err := hs.finish(msg, resParams)
+	if err != nil {
+		c.noise.err = fmt.Errorf("%v: %v", errNoiseHandshake, err)
+		return c.noise.err
+	}
+
+	c.noise.send = send
+	c.noise.recv = recv
+	return nil
+}
+
+// Encrypted returns whether the connection is encrypted using the Noise handshake.
+func (c *Connection) Encrypted() bool {
+	if c.noise == nil {
+		return false
+	}
+
+	c.noise.mut.Lock()
+	defer c.noise.mut.Unlock()
+	return c.noise.send != nil || c.noise.pendingSend != nil
+}
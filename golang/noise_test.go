@@ -0,0 +1,198 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+// recordingRelay relays connections to a server, and records the bytes sent by clients.
+// If rewrite is set, it is applied to the bytes sent by clients before they are relayed.
+type recordingRelay struct {
+	net.Listener
+	rewrite func([]byte) []byte
+
+	mut  sync.Mutex
+	sent bytes.Buffer
+}
+
+// rewritingWriter applies rewrite to each write before writing to the underlying writer.
+type rewritingWriter struct {
+	io.Writer
+	rewrite func([]byte) []byte
+}
+
+func (w rewritingWriter) Write(p []byte) (int, error) {
+	if _, err := w.Writer.Write(w.rewrite(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func newRecordingRelay(t *testing.T, hostPort string, rewrite func([]byte) []byte) *recordingRelay {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Listen failed")
+	relay := &recordingRelay{Listener: l, rewrite: rewrite}
+	go func() {
+		for {
+			clientConn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			serverConn, err := net.Dial("tcp", hostPort)
+			if !assert.NoError(t, err, "relay Dial failed") {
+				clientConn.Close()
+				return
+			}
+			var toServer io.Writer = serverConn
+			if relay.rewrite != nil {
+				toServer = rewritingWriter{serverConn, relay.rewrite}
+			}
+			go func() {
+				io.Copy(io.MultiWriter(toServer, relay), clientConn)
+				serverConn.Close()
+			}()
+			go func() {
+				io.Copy(clientConn, serverConn)
+				clientConn.Close()
+			}()
+		}
+	}()
+	return relay
+}
+
+func (r *recordingRelay) Write(p []byte) (int, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return r.sent.Write(p)
+}
+
+func (r *recordingRelay) sentContains(s string) bool {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+	return bytes.Contains(r.sent.Bytes(), []byte(s))
+}
+
+func callEncryptionServer(t *testing.T, clientOpts *EncryptionOptions, hostPort string, arg3 []byte) error {
+	client, err := testutils.NewClient(&testutils.ChannelOpts{
+		ServiceName: "noise-client",
+		Encryption:  clientOpts,
+	})
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	resArg3, err := callWithTimeout(client, hostPort, "noise-svc", "echo", []byte("arg2"), arg3)
+	if err == nil {
+		assert.Equal(t, arg3, resArg3, "response mismatch")
+	}
+	return err
+}
+
+func registerEncryptionEcho(t *testing.T, ch *Channel) {
+	testutils.RegisterFunc(t, ch, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+}
+
+func TestEncryption(t *testing.T) {
+	opts := &testutils.ChannelOpts{
+		ServiceName: "noise-svc",
+		Encryption:  &EncryptionOptions{Required: true},
+	}
+	WithVerifiedServer(t, opts, func(server *Channel, hostPort string) {
+		registerEncryptionEcho(t, server)
+		relay := newRecordingRelay(t, hostPort, nil)
+		defer relay.Close()
+
+		// Use a payload that is split across multiple frames.
+		payload := bytes.Repeat([]byte("secret-payload "), 10000)
+		require.NoError(t, callEncryptionServer(t, &EncryptionOptions{}, relay.Addr().String(), payload),
+			"encrypted call failed")
+		assert.True(t, relay.sentContains(InitParamEncryption), "init request should not be encrypted")
+		assert.False(t, relay.sentContains("secret-payload"), "payload should be encrypted")
+
+		err := callEncryptionServer(t, nil, hostPort, []byte("body"))
+		assert.Equal(t, ErrCodeProtocol, GetSystemErrorCode(err), "unencrypted clients should be rejected")
+	})
+}
+
+func TestEncryptionNegotiation(t *testing.T) {
+	WithVerifiedServer(t, &testutils.ChannelOpts{ServiceName: "noise-svc"}, func(server *Channel, hostPort string) {
+		registerEncryptionEcho(t, server)
+		assert.NoError(t, callEncryptionServer(t, &EncryptionOptions{}, hostPort, []byte("body")),
+			"optional encryption should fall back to plaintext")
+
+		err := callEncryptionServer(t, &EncryptionOptions{Required: true}, hostPort, []byte("body"))
+		assert.Equal(t, ErrCodeProtocol, GetSystemErrorCode(err), "required encryption should fail with a plaintext server")
+	})
+
+	opts := &testutils.ChannelOpts{
+		ServiceName: "noise-svc",
+		Encryption:  &EncryptionOptions{},
+	}
+	WithVerifiedServer(t, opts, func(server *Channel, hostPort string) {
+		registerEncryptionEcho(t, server)
+		assert.NoError(t, callEncryptionServer(t, nil, hostPort, []byte("body")),
+			"servers with optional encryption should accept plaintext clients")
+	})
+}
+
+func TestEncryptionBindsInitParams(t *testing.T) {
+	opts := &testutils.ChannelOpts{
+		ServiceName: "noise-svc",
+		Encryption:  &EncryptionOptions{Required: true},
+	}
+	WithVerifiedServer(t, opts, func(server *Channel, hostPort string) {
+		registerEncryptionEcho(t, server)
+
+		// The relay changes the client's process name in the init request, without changing its length.
+		relay := newRecordingRelay(t, hostPort, func(p []byte) []byte {
+			return bytes.Replace(p, []byte("noise-process-a"), []byte("noise-process-b"), -1)
+		})
+		defer relay.Close()
+
+		client, err := testutils.NewClient(&testutils.ChannelOpts{
+			ServiceName: "noise-client",
+			ProcessName: "noise-process-a",
+			Encryption:  &EncryptionOptions{Required: true},
+		})
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		_, _, _, err = raw.Call(ctx, client, relay.Addr().String(), "noise-svc", "echo", nil, nil)
+		assert.Equal(t, ErrCodeProtocol, GetSystemErrorCode(err), "modified init params should fail the handshake: %v", err)
+		assert.True(t, relay.sentContains("noise-process-a"), "relay should have seen the init request")
+	})
+}
@@ -70,8 +70,45 @@ func (c *Connection) beginCall(ctx context.Context, serviceName string, callOpti
 		CallerName: c.localPeerInfo.ServiceName,
 	}
 	callOptions.setHeaders(headers)
+	heartbeat, streamOpts := callOptions.Heartbeat, callOptions.Stream
 	if opts := currentCallOptions(ctx); opts != nil {
 		opts.overrideHeaders(headers)
+		if opts.Heartbeat != nil {
+			heartbeat = opts.Heartbeat
+		}
+		if opts.Stream != nil {
+			streamOpts = opts.Stream
+		}
+	}
+	if streamOpts != nil {
+		mex.setStreamOptions(streamOpts)
+	}
+	if retryOpts := currentRetryOptions(ctx); retryOpts != nil {
+		headers[RetryFlags] = retryOpts.RetryOn.retryFlags()
+	}
+
+	_, outbound := c.interceptorsFor(serviceName)
+	intercepted, err := interceptOutbound(ctx, outbound, &CallInfo{
+		ServiceName: serviceName,
+		Operation:   operation,
+		Caller:      headers[CallerName],
+		Format:      Format(headers[ArgScheme]),
+		Peer:        c.remotePeerInfo,
+		Headers:     headers,
+	})
+	if err != nil {
+		mex.shutdown()
+		intercepted.after(CallOutcome{Err: err})
+		return nil, err
+	}
+
+	// The breaker is checked after the interceptors, so that a call they reject does
+	// not count as a probe of a half-open circuit.
+	breaker := c.circuitBreakers.get(c.remotePeerInfo.HostPort, serviceName, operation, c.commonStatsTags)
+	if !breaker.allow() {
+		mex.shutdown()
+		intercepted.after(CallOutcome{Err: ErrCircuitOpen})
+		return nil, ErrCircuitOpen
 	}
 
 	call := new(OutboundCall)
@@ -110,7 +147,7 @@ func (c *Connection) beginCall(ctx context.Context, serviceName string, callOpti
 	call.AddAnnotation(AnnotationKeyClientSend)
 
 	response := new(OutboundCallResponse)
-	response.startedAt = timeNow()
+	response.startedAt = c.clock.Now()
 	response.mex = mex
 	response.log = c.log.WithFields(LogField{"Out-Response", requestID})
 	response.messageForFragment = func(initial bool) message {
@@ -130,9 +167,37 @@ func (c *Connection) beginCall(ctx context.Context, serviceName string, callOpti
 	response.contents = newFragmentingReader(response)
 	response.statsReporter = call.statsReporter
 	response.commonStatsTags = call.commonStatsTags
+	response.statsRecorder = &callStatsRecorder{
+		endpoint:          c.outboundStats.get(serviceName, operation),
+		statsReporter:     call.statsReporter,
+		metricPrefix:      "outbound",
+		commonStatsTags:   call.commonStatsTags,
+		startedAt:         response.startedAt,
+		clock:             c.clock,
+		log:               c.log,
+		slowCallThreshold: c.slowCallThreshold,
+		remotePeer:        c.remotePeerInfo,
+		traceID:           call.callReq.Tracing.TraceID(),
+		ctx:               ctx,
+		sample:            c.payloadSampler.sample("outbound", serviceName, c.remotePeerInfo, headers),
+		breaker:           breaker,
+	}
+	response.completion = &callCompletion{
+		clock:       c.clock,
+		startedAt:   response.startedAt,
+		intercepted: intercepted,
+	}
+	response.statsRecorder.sample.setOperation(operation)
+	call.statsRecorder = response.statsRecorder
+	call.completion = response.completion
 
 	call.response = response
 
+	if heartbeat != nil && heartbeat.Interval > 0 {
+		call.heartbeat = newHeartbeatMonitor(heartbeat)
+		c.outbound.setHeartbeatMonitor(mex, call.heartbeat)
+	}
+
 	if err := call.writeOperation([]byte(operation)); err != nil {
 		return nil, err
 	}
@@ -142,6 +207,9 @@ func (c *Connection) beginCall(ctx context.Context, serviceName string, callOpti
 // handleCallRes handles an incoming call req message, forwarding the
 // frame to the response channel waiting for it
 func (c *Connection) handleCallRes(frame *Frame) bool {
+	if handled, release := c.relay.relayResponse(frame); handled {
+		return release
+	}
 	if err := c.outbound.forwardPeerFrame(frame); err != nil {
 		c.outbound.removeExchange(frame.Header.ID)
 		return true
@@ -152,6 +220,9 @@ func (c *Connection) handleCallRes(frame *Frame) bool {
 // handleCallResContinue handles an incoming call res continue message,
 // forwarding the frame to the response channel waiting for it
 func (c *Connection) handleCallResContinue(frame *Frame) bool {
+	if handled, release := c.relay.relayResponse(frame); handled {
+		return release
+	}
 	if err := c.outbound.forwardPeerFrame(frame); err != nil {
 		c.outbound.removeExchange(frame.Header.ID)
 		return true
@@ -171,6 +242,9 @@ type OutboundCall struct {
 	response        *OutboundCallResponse
 	statsReporter   StatsReporter
 	commonStatsTags map[string]string
+
+	// heartbeat is set if the call requested heartbeats.
+	heartbeat *heartbeatMonitor
 }
 
 // Response provides access to the call's response object, which can be used to
@@ -205,16 +279,25 @@ func (call *OutboundCall) writeOperation(operation []byte) error {
 // Arg2Writer returns a WriteCloser that can be used to write the second argument.
 // The returned writer must be closed once the write is complete.
 func (call *OutboundCall) Arg2Writer() (ArgWriter, error) {
-	return call.arg2Writer()
+	writer, err := call.arg2Writer()
+	return call.statsRecorder.sample.captureWriter(sampledRequestArg2, writer, err)
 }
 
 // Arg3Writer returns a WriteCloser that can be used to write the last argument.
 // The returned writer must be closed once the write is complete.
+// Data is sent as each frame fills up, or when the writer is flushed, so the argument
+// can be streamed without buffering the whole value.
 func (call *OutboundCall) Arg3Writer() (ArgWriter, error) {
-	return call.arg3Writer()
+	writer, err := call.arg3Writer()
+	return call.statsRecorder.sample.captureWriter(sampledRequestArg3, writer, err)
 }
 
-func (call *OutboundCall) doneSending() {}
+// doneSending starts monitoring heartbeats, if requested, once the request has been sent.
+func (call *OutboundCall) doneSending() {
+	if call.heartbeat != nil {
+		go call.conn.monitorHeartbeats(call.mex, call.heartbeat, call.commonStatsTags)
+	}
+}
 
 // An OutboundCallResponse is the response to an outbound call
 type OutboundCallResponse struct {
@@ -250,13 +333,27 @@ func (response *OutboundCallResponse) Arg2Reader() (io.ReadCloser, error) {
 		return nil, err
 	}
 
-	return response.arg2Reader()
+	reader, err := response.arg2Reader()
+	return response.statsRecorder.sample.captureReader(sampledResponseArg2, reader, err)
 }
 
 // Arg3Reader returns an io.ReadCloser to read the last argument.
 // The ReadCloser must be closed once the argument has been read.
+// The argument is received as it is read, so it can be streamed without buffering the
+// whole value. If the peer supports flow control, a reader that falls behind slows down
+// the writer.
 func (response *OutboundCallResponse) Arg3Reader() (io.ReadCloser, error) {
-	return response.arg3Reader()
+	reader, err := response.arg3Reader()
+	return response.statsRecorder.sample.captureReader(sampledResponseArg3, reader, err)
+}
+
+// ReadArg2 reads the second argument as soon as it is received, without waiting for
+// arg3, so the response headers can be handled before the body completes. The result of
+// ApplicationError is valid once it returns, and the body can then be read using Arg3Reader.
+func (response *OutboundCallResponse) ReadArg2() ([]byte, error) {
+	var arg2 []byte
+	err := NewArgReader(response.Arg2Reader()).Read(&arg2)
+	return arg2, err
 }
 
 // handleError andles an error coming back from the peer. If the error is a
@@ -275,8 +372,14 @@ func (c *Connection) handleError(frame *Frame) {
 		return
 	}
 
+	if errMsg.errCode != ErrCodeProtocol && c.relay.relayError(&errMsg) {
+		return
+	}
+
 	if errMsg.errCode == ErrCodeProtocol {
 		c.log.Warnf("Peer %s reported protocol error: %s", c.remotePeerInfo, errMsg.message)
+		// Forward the error to any exchange waiting on it, such as the init handshake.
+		c.outbound.forwardPeerFrame(frame)
 		c.connectionError(errMsg.AsSystemError())
 		return
 	}
@@ -295,8 +398,10 @@ func (response *OutboundCallResponse) doneReading() {
 	} else {
 		response.statsReporter.IncCounter("outbound.calls.success", response.commonStatsTags, 1)
 	}
-	latency := timeNow().Sub(response.startedAt)
+	latency := response.statsRecorder.clock.Now().Sub(response.startedAt)
 	response.statsReporter.RecordTimer("outbound.calls.latency", response.commonStatsTags, latency)
+	response.statsRecorder.recordSuccess(response.ApplicationError(), latency)
+	response.completion.succeeded(response.ApplicationError(), latency)
 
 	response.mex.shutdown()
 }
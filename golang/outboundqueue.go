@@ -0,0 +1,253 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultMaxPendingPerPeer    = 100
+	defaultOutboundMaxQueueSize = 1000
+)
+
+// ErrOutboundQueueFull is a SystemError returned for calls that are rejected without
+// being sent because too many calls are already waiting for the peer.
+var ErrOutboundQueueFull = NewSystemError(ErrCodeBusy, "outbound queue full")
+
+// OperationClass is a label for the kind of traffic an operation carries, used to
+// prioritize calls to a saturated peer.
+type OperationClass string
+
+const (
+	// OperationClassInteractive is for user-facing calls, which are sent before any
+	// waiting batch calls.
+	OperationClassInteractive OperationClass = "interactive"
+
+	// OperationClassBatch is for bulk or background calls that can wait.
+	OperationClassBatch OperationClass = "batch"
+)
+
+// priority returns the queue for calls of this class, where lower queues are served
+// first. Labels other than OperationClassInteractive are treated as batch.
+func (c OperationClass) priority() int {
+	if c == OperationClassInteractive {
+		return 0
+	}
+	return 1
+}
+
+const numOperationPriorities = 2
+
+// OutboundSchedulerOptions configure a queue for outbound calls to each peer. Once a peer
+// has MaxPendingPerPeer calls in progress, new calls wait for one to complete, and waiting
+// interactive calls are sent before waiting batch calls, so that bulk jobs do not starve
+// user-facing traffic that shares the channel.
+type OutboundSchedulerOptions struct {
+	// MaxPendingPerPeer is the number of calls to a peer that can be in progress before
+	// new calls are queued. Defaults to 100.
+	MaxPendingPerPeer int
+
+	// MaxQueueSize is the number of calls of each class that can wait for a peer. Calls
+	// are rejected with ErrOutboundQueueFull once the queue is full. Defaults to 1000.
+	MaxQueueSize int
+
+	// Classes maps operations to their class, keyed by "service::operation", or by
+	// "service" for all of a service's operations.
+	Classes map[string]OperationClass
+
+	// DefaultClass is the class of operations that are not in Classes.
+	// Defaults to OperationClassInteractive.
+	DefaultClass OperationClass
+}
+
+// outboundScheduler classifies outbound calls and creates the queue for each peer.
+type outboundScheduler struct {
+	opts OutboundSchedulerOptions
+}
+
+func newOutboundScheduler(opts *OutboundSchedulerOptions) *outboundScheduler {
+	if opts == nil {
+		return nil
+	}
+
+	s := &outboundScheduler{opts: *opts}
+	if s.opts.MaxPendingPerPeer <= 0 {
+		s.opts.MaxPendingPerPeer = defaultMaxPendingPerPeer
+	}
+	if s.opts.MaxQueueSize <= 0 {
+		s.opts.MaxQueueSize = defaultOutboundMaxQueueSize
+	}
+	if s.opts.DefaultClass == "" {
+		s.opts.DefaultClass = OperationClassInteractive
+	}
+	return s
+}
+
+// classify returns the class for a call to the given service and operation.
+func (s *outboundScheduler) classify(serviceName, operation string) OperationClass {
+	if s == nil {
+		return ""
+	}
+	if class, ok := s.opts.Classes[serviceName+"::"+operation]; ok {
+		return class
+	}
+	if class, ok := s.opts.Classes[serviceName]; ok {
+		return class
+	}
+	return s.opts.DefaultClass
+}
+
+// newPeerQueue returns the queue for a new peer, or nil if scheduling is disabled.
+func (s *outboundScheduler) newPeerQueue() *peerCallQueue {
+	if s == nil {
+		return nil
+	}
+	return &peerCallQueue{
+		maxPending:   s.opts.MaxPendingPerPeer,
+		maxQueueSize: s.opts.MaxQueueSize,
+	}
+}
+
+// peerCallQueue limits the calls in progress to a single peer, queueing calls by priority.
+type peerCallQueue struct {
+	maxPending   int
+	maxQueueSize int
+
+	mut     sync.Mutex
+	pending int
+
+	// waiters are the calls waiting for a slot, in order, for each priority. A waiter's
+	// channel is closed once it has been given a slot.
+	waiters [numOperationPriorities][]chan struct{}
+}
+
+// acquire reserves a slot for a new call, waiting behind calls of the same or a higher
+// priority if the peer is saturated. It returns ErrOutboundQueueFull if the queue for
+// the call's class is full, or ErrTimeout if the context finishes while waiting.
+func (q *peerCallQueue) acquire(ctx context.Context, class OperationClass) error {
+	if q == nil {
+		return nil
+	}
+
+	priority := class.priority()
+	q.mut.Lock()
+	if q.pending < q.maxPending && q.queued() == 0 {
+		q.pending++
+		q.mut.Unlock()
+		return nil
+	}
+	if len(q.waiters[priority]) >= q.maxQueueSize {
+		q.mut.Unlock()
+		return ErrOutboundQueueFull
+	}
+
+	waiter := make(chan struct{})
+	q.waiters[priority] = append(q.waiters[priority], waiter)
+	q.mut.Unlock()
+
+	select {
+	case <-waiter:
+		return nil
+	case <-ctx.Done():
+	}
+
+	q.mut.Lock()
+	removed := q.removeWaiter(priority, waiter)
+	q.mut.Unlock()
+	if !removed {
+		// The slot was given to this call as the context finished, so pass it on.
+		q.release()
+	}
+	return ErrTimeout
+}
+
+// queued returns the number of waiting calls. mut must be held.
+func (q *peerCallQueue) queued() int {
+	var n int
+	for _, waiters := range q.waiters {
+		n += len(waiters)
+	}
+	return n
+}
+
+// removeWaiter removes the given waiter from the queue, returning false if it had
+// already been given a slot. mut must be held.
+func (q *peerCallQueue) removeWaiter(priority int, waiter chan struct{}) bool {
+	waiters := q.waiters[priority]
+	for i, w := range waiters {
+		if w == waiter {
+			q.waiters[priority] = append(waiters[:i], waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// release releases the slot for a completed call, and gives it to the first waiting
+// call with the highest priority.
+func (q *peerCallQueue) release() {
+	if q == nil {
+		return
+	}
+
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	q.pending--
+	for i, waiters := range q.waiters {
+		if len(waiters) > 0 && q.pending < q.maxPending {
+			q.waiters[i] = waiters[1:]
+			q.pending++
+			close(waiters[0])
+			return
+		}
+	}
+}
+
+// releaseWhenDone releases the slot for a call once its exchange completes, fails
+// with its connection, or times out.
+func (q *peerCallQueue) releaseWhenDone(mex *messageExchange) {
+	if q == nil {
+		return
+	}
+
+	go func() {
+		select {
+		case <-mex.removed:
+		case <-mex.lost:
+		case <-mex.ctx.Done():
+		}
+		q.release()
+	}()
+}
+
+// QueuedCalls returns the number of calls waiting for a slot to this peer.
+func (p *Peer) QueuedCalls() int {
+	if p.callQueue == nil {
+		return 0
+	}
+
+	p.callQueue.mut.Lock()
+	defer p.callQueue.mut.Unlock()
+	return p.callQueue.queued()
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+// newQueueTestServer returns a server whose operations record their name and block
+// until release is closed or sent to.
+func newQueueTestServer(t *testing.T, release <-chan struct{}) (*Channel, func() []string) {
+	server, err := testutils.NewServer(nil)
+	require.NoError(t, err, "NewServer failed")
+
+	var mut sync.Mutex
+	var received []string
+	for _, op := range []string{"blocker", "batch", "interactive"} {
+		op := op
+		testutils.RegisterFunc(t, server, op, func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			mut.Lock()
+			received = append(received, op)
+			mut.Unlock()
+			<-release
+			return &raw.Res{}, nil
+		})
+	}
+	return server, func() []string {
+		mut.Lock()
+		defer mut.Unlock()
+		return append([]string(nil), received...)
+	}
+}
+
+func TestOutboundSchedulerPrioritizesInteractive(t *testing.T) {
+	release := make(chan struct{})
+	server, received := newQueueTestServer(t, release)
+	defer server.Close()
+	hostPort := server.PeerInfo().HostPort
+	serviceName := server.PeerInfo().ServiceName
+
+	client, err := NewChannel("queue-client", &ChannelOptions{
+		OutboundScheduler: &OutboundSchedulerOptions{
+			MaxPendingPerPeer: 1,
+			Classes: map[string]OperationClass{
+				serviceName + "::batch": OperationClassBatch,
+			},
+		},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+	peer := client.Peers().GetOrAdd(hostPort)
+
+	var wg sync.WaitGroup
+	call := func(op string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := NewContext(time.Second)
+			defer cancel()
+			_, _, _, err := raw.Call(ctx, client, hostPort, serviceName, op, nil, nil)
+			assert.NoError(t, err, "%v call failed", op)
+		}()
+	}
+	waitFor := func(f func() bool) {
+		require.True(t, testutils.WaitFor(time.Second, f), "timed out waiting for condition")
+	}
+
+	call("blocker")
+	waitFor(func() bool { return len(received()) == 1 })
+	call("batch")
+	waitFor(func() bool { return peer.QueuedCalls() == 1 })
+	call("interactive")
+	waitFor(func() bool { return peer.QueuedCalls() == 2 })
+	assert.Equal(t, 2, client.IntrospectState(nil).Peers[hostPort].QueuedCalls, "introspection queued calls")
+
+	for i := 0; i < 3; i++ {
+		release <- struct{}{}
+	}
+	wg.Wait()
+	assert.Equal(t, []string{"blocker", "interactive", "batch"}, received(), "unexpected call order")
+}
+
+func TestOutboundSchedulerQueueLimits(t *testing.T) {
+	release := make(chan struct{})
+	server, received := newQueueTestServer(t, release)
+	defer server.Close()
+	defer close(release)
+	hostPort := server.PeerInfo().HostPort
+	serviceName := server.PeerInfo().ServiceName
+
+	client, err := NewChannel("queue-client", &ChannelOptions{
+		OutboundScheduler: &OutboundSchedulerOptions{
+			MaxPendingPerPeer: 1,
+			MaxQueueSize:      1,
+			DefaultClass:      OperationClassBatch,
+		},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+	peer := client.Peers().GetOrAdd(hostPort)
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	go raw.Call(ctx, client, hostPort, serviceName, "blocker", nil, nil)
+	require.True(t, testutils.WaitFor(time.Second, func() bool { return len(received()) == 1 }),
+		"blocker call was not received")
+
+	shortCtx, shortCancel := NewContext(50 * time.Millisecond)
+	defer shortCancel()
+	queuedErr := make(chan error, 1)
+	go func() {
+		_, _, _, err := raw.Call(shortCtx, client, hostPort, serviceName, "batch", nil, nil)
+		queuedErr <- err
+	}()
+	require.True(t, testutils.WaitFor(time.Second, func() bool { return peer.QueuedCalls() == 1 }),
+		"batch call was not queued")
+
+	_, _, _, err = raw.Call(ctx, client, hostPort, serviceName, "batch", nil, nil)
+	assert.Equal(t, ErrOutboundQueueFull, err, "call should be rejected when the queue is full")
+
+	assert.Equal(t, ErrTimeout, <-queuedErr, "queued call should time out")
+	assert.Equal(t, 0, peer.QueuedCalls(), "timed out call should be removed from the queue")
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestHandlerPanic(t *testing.T) {
+	var logs SyncBuffer
+	stats := newRecordingStatsReporter()
+	server, err := NewChannel("panic-svc", &ChannelOptions{
+		Logger:        NewLevelLogger(NewLogger(&logs), LogLevelWarn),
+		StatsReporter: stats,
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer server.Close()
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+
+	testutils.RegisterFunc(t, server, "panic", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		panic("secret internal state")
+	})
+	testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg3: args.Arg3}, nil
+	})
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	hostPort := server.PeerInfo().HostPort
+	_, _, _, err = raw.Call(ctx, client, hostPort, "panic-svc", "panic", nil, []byte("arg3"))
+	require.Error(t, err, "call to panicking handler should fail")
+	assert.Equal(t, ErrCodeUnexpected, GetSystemErrorCode(err), "unexpected error code")
+	assert.NotContains(t, err.Error(), "secret", "error should not include the panic value")
+
+	// The server should continue to handle calls.
+	_, arg3, _, err := raw.Call(ctx, client, hostPort, "panic-svc", "echo", nil, []byte("arg3"))
+	require.NoError(t, err, "call after panic failed")
+	assert.Equal(t, []byte("arg3"), arg3, "echo response mismatch")
+
+	log := logs.String()
+	assert.Contains(t, log, "Handler panicked: secret internal state", "panic should be logged")
+	assert.Contains(t, log, "{operation panic}", "log should include the operation")
+	assert.Contains(t, log, "goroutine ", "log should include the stack")
+
+	panics := counterValue(stats, "inbound.calls.panics")
+	assert.Equal(t, int64(1), panics, "panics counter mismatch")
+}
@@ -32,6 +32,12 @@ var (
 	// ErrInvalidConnectionState indicates that the connection is not in a valid state.
 	ErrInvalidConnectionState = errors.New("connection is in an invalid state")
 
+	// ErrNoPeers indicates that there are no peers.
+	ErrNoPeers = errors.New("no peers available")
+
+	// ErrPeerNotFound indicates that the specified peer was not found.
+	ErrPeerNotFound = errors.New("peer not found")
+
 	peerRng = NewRand(time.Now().UnixNano())
 )
 
@@ -66,11 +72,34 @@ func (l *PeerList) Add(hostPort string) *Peer {
 	return p
 }
 
+// Remove removes a peer from the list. Existing connections to the peer are not closed,
+// but the peer is no longer selected for new calls.
+func (l *PeerList) Remove(hostPort string) error {
+	l.mut.Lock()
+	defer l.mut.Unlock()
+
+	p, ok := l.peersByHostPort[hostPort]
+	if !ok {
+		return ErrPeerNotFound
+	}
+
+	delete(l.peersByHostPort, hostPort)
+	for i, peer := range l.peers {
+		if peer == p {
+			l.peers = append(l.peers[:i], l.peers[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
 func randPeer(peers []*Peer) *Peer {
 	return peers[peerRng.Intn(len(peers))]
 }
 
 // Get returns a peer from the peer list, or nil if none can be found.
+// If latency aware peer selection is enabled, two random peers are chosen
+// and the peer with the lower round trip time is returned.
 func (l *PeerList) Get() *Peer {
 	l.mut.RLock()
 
@@ -79,12 +108,52 @@ func (l *PeerList) Get() *Peer {
 		return nil
 	}
 
-	peer := randPeer(l.peers)
+	peers := l.peers
+	peer := randPeer(peers)
+	if peer.Draining() {
+		peers = withoutDraining(peers)
+		peer = randPeer(peers)
+	}
+	if l.channel.latencyAwarePeers && len(peers) > 1 {
+		peer = lowerRTTPeer(peer, randPeer(peers))
+	}
 	l.mut.RUnlock()
 
 	return peer
 }
 
+// GetNew returns a peer from the peer list that is not in prevSelected. If all peers
+// have been selected previously, any peer may be returned. It returns nil if the peer
+// list is empty.
+func (l *PeerList) GetNew(prevSelected map[string]struct{}) *Peer {
+	if len(prevSelected) == 0 {
+		return l.Get()
+	}
+
+	l.mut.RLock()
+	defer l.mut.RUnlock()
+
+	var candidates []*Peer
+	for _, p := range l.peers {
+		if _, ok := prevSelected[p.hostPort]; !ok {
+			candidates = append(candidates, p)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = l.peers
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	candidates = withoutDraining(candidates)
+
+	peer := randPeer(candidates)
+	if l.channel.latencyAwarePeers && len(candidates) > 1 {
+		peer = lowerRTTPeer(peer, randPeer(candidates))
+	}
+	return peer
+}
+
 // GetOrAdd returns a peer for the given hostPort, creating one if it doesn't yet exist.
 func (l *PeerList) GetOrAdd(hostPort string) *Peer {
 	l.mut.RLock()
@@ -109,6 +178,18 @@ func (l *PeerList) Copy() map[string]*Peer {
 	return listCopy
 }
 
+// hostPorts returns the host:ports of all peers in the list.
+func (l *PeerList) hostPorts() []string {
+	l.mut.RLock()
+	defer l.mut.RUnlock()
+
+	hostPorts := make([]string, 0, len(l.peers))
+	for _, p := range l.peers {
+		hostPorts = append(hostPorts, p.HostPort())
+	}
+	return hostPorts
+}
+
 // Close closes connections for all peers.
 func (l *PeerList) Close() {
 	l.mut.RLock()
@@ -124,14 +205,17 @@ type Peer struct {
 	channel  *Channel
 	hostPort string
 
+	callQueue *peerCallQueue
+
 	mut         sync.RWMutex // mut protects connections.
 	connections []*Connection
 }
 
 func newPeer(channel *Channel, hostPort string) *Peer {
 	return &Peer{
-		channel:  channel,
-		hostPort: hostPort,
+		channel:   channel,
+		hostPort:  hostPort,
+		callQueue: channel.outboundScheduler.newPeerQueue(),
 	}
 }
 
@@ -210,8 +294,20 @@ func (p *Peer) Connect(ctx context.Context) (*Connection, error) {
 // BeginCall starts a new call to this specific peer, returning an OutboundCall that can
 // be used to write the arguments of the call.
 func (p *Peer) BeginCall(ctx context.Context, serviceName string, operationName string, callOptions *CallOptions) (*OutboundCall, error) {
+	currentRequestState(ctx).AddSelectedPeer(p.hostPort)
+
+	if err := p.channel.devMode.checkCall(ctx, serviceName, operationName); err != nil {
+		return nil, err
+	}
+
+	class := p.channel.outboundScheduler.classify(serviceName, operationName)
+	if err := p.callQueue.acquire(ctx, class); err != nil {
+		return nil, err
+	}
+
 	conn, err := p.GetConnection(ctx)
 	if err != nil {
+		p.callQueue.release()
 		return nil, err
 	}
 
@@ -220,9 +316,11 @@ func (p *Peer) BeginCall(ctx context.Context, serviceName string, operationName
 	}
 	call, err := conn.beginCall(ctx, serviceName, callOptions, operationName)
 	if err != nil {
+		p.callQueue.release()
 		return nil, err
 	}
 
+	p.callQueue.releaseWhenDone(call.mex)
 	return call, err
 }
 
@@ -0,0 +1,48 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"testing"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerListRemove(t *testing.T) {
+	ch, err := NewChannel("svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+
+	peers := ch.Peers()
+	peers.Add("1.1.1.1:1")
+	peers.Add("2.2.2.2:2")
+
+	require.NoError(t, peers.Remove("1.1.1.1:1"), "Remove failed")
+	assert.Equal(t, ErrPeerNotFound, peers.Remove("1.1.1.1:1"), "removing a missing peer should fail")
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, "2.2.2.2:2", peers.Get().HostPort(), "removed peer should not be selected")
+	}
+
+	require.NoError(t, peers.Remove("2.2.2.2:2"), "Remove failed")
+	assert.Nil(t, peers.Get(), "no peers should be selected from an empty list")
+}
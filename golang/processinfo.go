@@ -0,0 +1,141 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	// InitParamProcessHost contains the host name of the peer process
+	InitParamProcessHost = "tchannel_process_host"
+
+	// InitParamProcessPID contains the process ID of the peer process
+	InitParamProcessPID = "tchannel_process_pid"
+
+	// InitParamProcessVersion contains the version of the peer process
+	InitParamProcessVersion = "tchannel_process_version"
+)
+
+var (
+	errProcessNameMissing = errors.New("process name missing")
+	errProcessInfoMissing = errors.New("process info missing")
+)
+
+// ProcessInfo is structured information about a process that is sent to peers during
+// the init handshake, in addition to the process name.
+type ProcessInfo struct {
+	// Host is the host name of the process. Defaults to os.Hostname.
+	Host string `json:"host,omitempty"`
+
+	// PID is the process ID. Defaults to os.Getpid.
+	PID int `json:"pid,omitempty"`
+
+	// Version is the version of the application, such as a release tag or a commit.
+	Version string `json:"version,omitempty"`
+}
+
+// processName returns the default process name for a process with the given info.
+func (p *ProcessInfo) processName() string {
+	name := fmt.Sprintf("%s[%d]@%s", filepath.Base(os.Args[0]), p.PID, p.Host)
+	if p.Version != "" {
+		name += " " + p.Version
+	}
+	return name
+}
+
+func (p *ProcessInfo) withDefaults() *ProcessInfo {
+	if p == nil {
+		return nil
+	}
+	info := *p
+	if info.Host == "" {
+		info.Host, _ = os.Hostname()
+	}
+	if info.PID == 0 {
+		info.PID = os.Getpid()
+	}
+	return &info
+}
+
+func (p *ProcessInfo) addInitParams(params initParams) {
+	if p == nil {
+		return
+	}
+	params[InitParamProcessHost] = p.Host
+	params[InitParamProcessPID] = strconv.Itoa(p.PID)
+	if p.Version != "" {
+		params[InitParamProcessVersion] = p.Version
+	}
+}
+
+// parseProcessInfo returns the process info sent by a peer, or nil if the peer did not
+// send any. Peers that do not set ProcessInfo only send the process name.
+func parseProcessInfo(params initParams) (*ProcessInfo, error) {
+	host, hasHost := params[InitParamProcessHost]
+	pid, hasPID := params[InitParamProcessPID]
+	version, hasVersion := params[InitParamProcessVersion]
+	if !hasHost && !hasPID && !hasVersion {
+		return nil, nil
+	}
+
+	info := &ProcessInfo{Host: host, Version: version}
+	if hasPID {
+		var err error
+		if info.PID, err = strconv.Atoi(pid); err != nil {
+			return nil, fmt.Errorf("invalid %v %q", InitParamProcessPID, pid)
+		}
+	}
+	return info, nil
+}
+
+// PeerPolicy is used to validate the information that remote peers send during the
+// init handshake. Connections to or from peers that fail validation are closed.
+type PeerPolicy struct {
+	// RequireProcessName rejects peers that send an empty process name.
+	RequireProcessName bool
+
+	// RequireProcessInfo rejects peers that do not send a host and process ID.
+	RequireProcessInfo bool
+
+	// Validate is an optional function that is called after the checks above, and
+	// may reject the peer by returning an error.
+	Validate func(remote PeerInfo) error
+}
+
+func (p *PeerPolicy) validate(remote PeerInfo) error {
+	if p == nil {
+		return nil
+	}
+	if p.RequireProcessName && remote.ProcessName == "" {
+		return errProcessNameMissing
+	}
+	if p.RequireProcessInfo && (remote.Process == nil || remote.Process.Host == "" || remote.Process.PID == 0) {
+		return errProcessInfoMissing
+	}
+	if p.Validate != nil {
+		return p.Validate(remote)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestProcessInfoDefaults(t *testing.T) {
+	ch, err := NewChannel("svc", &ChannelOptions{ProcessInfo: &ProcessInfo{Version: "v1.2.3"}})
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+
+	host, _ := os.Hostname()
+	peerInfo := ch.PeerInfo()
+	require.NotNil(t, peerInfo.Process, "Process should be set")
+	assert.Equal(t, ProcessInfo{Host: host, PID: os.Getpid(), Version: "v1.2.3"}, *peerInfo.Process)
+	assert.True(t, strings.HasSuffix(peerInfo.ProcessName, "@"+host+" v1.2.3"),
+		"process name %q should include the host and version", peerInfo.ProcessName)
+
+	ch, err = NewChannel("svc", &ChannelOptions{
+		ProcessName: "custom",
+		ProcessInfo: &ProcessInfo{Host: "h1", PID: 10},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+	assert.Equal(t, "custom", ch.PeerInfo().ProcessName, "ProcessName should not be overridden")
+	assert.Equal(t, ProcessInfo{Host: "h1", PID: 10}, *ch.PeerInfo().Process)
+
+	ch, err = NewChannel("svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+	assert.Nil(t, ch.PeerInfo().Process, "Process should not be set by default")
+}
+
+func TestProcessInfoHandshake(t *testing.T) {
+	server, err := NewChannel("svc", &ChannelOptions{
+		ProcessInfo: &ProcessInfo{Host: "server-host", PID: 1, Version: "v2"},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+	hostPort := server.PeerInfo().HostPort
+
+	client, err := NewChannel("client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, client.Ping(ctx, hostPort), "Ping failed")
+
+	peer, ok := client.IntrospectState(nil).Peers[hostPort]
+	require.True(t, ok, "missing peer state for %v", hostPort)
+	require.Len(t, peer.Connections, 1, "expected a single connection")
+	remote := peer.Connections[0].RemotePeer
+	assert.Equal(t, server.PeerInfo().ProcessName, remote.ProcessName, "process name mismatch")
+	assert.Equal(t, &ProcessInfo{Host: "server-host", PID: 1, Version: "v2"}, remote.Process,
+		"process info mismatch")
+}
+
+func TestPeerPolicy(t *testing.T) {
+	errBadVersion := errors.New("bad version")
+	policy := &PeerPolicy{
+		RequireProcessName: true,
+		RequireProcessInfo: true,
+		Validate: func(remote PeerInfo) error {
+			if remote.Process.Version == "bad" {
+				return errBadVersion
+			}
+			return nil
+		},
+	}
+
+	tests := []struct {
+		processName string
+		processInfo *ProcessInfo
+		wantErr     bool
+	}{
+		{processName: "client", processInfo: &ProcessInfo{Version: "v1"}},
+		{processInfo: &ProcessInfo{}},
+		{processName: "client", wantErr: true},
+		{processName: "client", processInfo: &ProcessInfo{Version: "bad"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		// Validate inbound connections on the server.
+		server, err := NewChannel("svc", &ChannelOptions{PeerPolicy: policy})
+		require.NoError(t, err, "NewChannel failed")
+		require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+
+		client, err := NewChannel("client", &ChannelOptions{
+			ProcessName: tt.processName,
+			ProcessInfo: tt.processInfo,
+		})
+		require.NoError(t, err, "NewChannel failed")
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err = client.Ping(ctx, server.PeerInfo().HostPort)
+		cancel()
+		if tt.wantErr {
+			assert.Error(t, err, "inbound validation should fail for %+v", tt)
+		} else {
+			assert.NoError(t, err, "inbound validation should pass for %+v", tt)
+		}
+		client.Close()
+		server.Close()
+
+		// Validate outbound connections on the client.
+		server, err = NewChannel("svc", &ChannelOptions{
+			ProcessName: tt.processName,
+			ProcessInfo: tt.processInfo,
+		})
+		require.NoError(t, err, "NewChannel failed")
+		require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+
+		client, err = NewChannel("client", &ChannelOptions{PeerPolicy: policy})
+		require.NoError(t, err, "NewChannel failed")
+
+		ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+		err = client.Ping(ctx, server.PeerInfo().HostPort)
+		cancel()
+		if tt.wantErr {
+			assert.Error(t, err, "outbound validation should fail for %+v", tt)
+		} else {
+			assert.NoError(t, err, "outbound validation should pass for %+v", tt)
+		}
+		client.Close()
+		server.Close()
+	}
+}
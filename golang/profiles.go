@@ -0,0 +1,89 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"runtime/pprof"
+	"sync"
+	"sync/atomic"
+)
+
+// Names of the profiles registered by RegisterProfiles.
+const (
+	// ExchangesProfileName is the profile of stacks that created active message exchanges.
+	ExchangesProfileName = "tchannel.exchanges"
+
+	// SendBlockedProfileName is the profile of stacks that are blocked waiting for
+	// space in a connection's send buffer.
+	SendBlockedProfileName = "tchannel.send-blocked"
+)
+
+var (
+	registerProfilesOnce sync.Once
+	profilesEnabled      int32
+
+	exchangesProfile   *pprof.Profile
+	sendBlockedProfile *pprof.Profile
+)
+
+// RegisterProfiles registers pprof profiles that are scoped to TChannel internals.
+// The profiles can be retrieved using pprof.Lookup, or through net/http/pprof.
+// Profiles only track events after RegisterProfiles is called, and it is safe
+// to call RegisterProfiles multiple times.
+func RegisterProfiles() {
+	registerProfilesOnce.Do(func() {
+		exchangesProfile = pprof.NewProfile(ExchangesProfileName)
+		sendBlockedProfile = pprof.NewProfile(SendBlockedProfileName)
+		atomic.StoreInt32(&profilesEnabled, 1)
+	})
+}
+
+func profilesActive() bool {
+	return atomic.LoadInt32(&profilesEnabled) == 1
+}
+
+// profileAddExchange records the stack that created the message exchange.
+func profileAddExchange(mex *messageExchange) {
+	if profilesActive() {
+		// Skip profileAddExchange and newExchange.
+		exchangesProfile.Add(mex, 2)
+	}
+}
+
+// profileRemoveExchange removes a message exchange that was added using profileAddExchange.
+func profileRemoveExchange(mex *messageExchange) {
+	if profilesActive() {
+		exchangesProfile.Remove(mex)
+	}
+}
+
+// profileSendBlocked records the current stack as blocked on sending a frame.
+// The returned function must be called once the send is no longer blocked.
+func profileSendBlocked() func() {
+	if !profilesActive() {
+		return func() {}
+	}
+
+	// Each blocked send needs a unique key in the profile.
+	key := new(byte)
+	sendBlockedProfile.Add(key, 1)
+	return func() { sendBlockedProfile.Remove(key) }
+}
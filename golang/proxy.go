@@ -0,0 +1,273 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const defaultProxyTimeout = 10 * time.Second
+
+// ProxyOptions configure proxies for outbound connections. Connections to a peer are
+// shared by all subchannels, so proxies are configured per peer rather than per service.
+type ProxyOptions struct {
+	// URL is the proxy for outbound connections, unless there is an entry for the peer
+	// in PeerURLs. The scheme must be "socks5" or "http", which uses HTTP CONNECT. A
+	// username and password in the URL are used to authenticate with the proxy.
+	URL *url.URL
+
+	// PeerURLs overrides URL for outbound connections to specific peers, keyed by the
+	// peer's host:port. Connections to peers with a nil URL do not use a proxy.
+	PeerURLs map[string]*url.URL
+
+	// Timeout is the time allowed for connecting to the proxy and establishing the
+	// tunnel to the peer. Defaults to 10 seconds.
+	Timeout time.Duration
+}
+
+var (
+	errProxyScheme      = errors.New("proxy scheme must be socks5 or http")
+	errSOCKSAuthMethod  = errors.New("socks5 proxy did not accept any authentication method")
+	errSOCKSAuthFailed  = errors.New("socks5 proxy authentication failed")
+	errSOCKSBadResponse = errors.New("socks5 proxy returned an invalid response")
+)
+
+// proxyFor returns the proxy for connections to the given peer, or nil if there is none.
+func (o *ProxyOptions) proxyFor(hostPort string) *url.URL {
+	if o == nil {
+		return nil
+	}
+	if u, ok := o.PeerURLs[hostPort]; ok {
+		return u
+	}
+	return o.URL
+}
+
+func (o *ProxyOptions) timeout() time.Duration {
+	if o == nil || o.Timeout <= 0 {
+		return defaultProxyTimeout
+	}
+	return o.Timeout
+}
+
+// dial connects to the proxy using the given dialer, or TCP if it is nil, and
+// establishes a tunnel to the peer.
+func (o *ProxyOptions) dial(proxy *url.URL, hostPort string, dialer func(string) (net.Conn, error)) (net.Conn, error) {
+	var tunnel func(net.Conn, *url.URL, string) (net.Conn, error)
+	switch proxy.Scheme {
+	case "socks5":
+		tunnel = socks5Tunnel
+	case "http":
+		tunnel = connectTunnel
+	default:
+		return nil, errProxyScheme
+	}
+
+	var conn net.Conn
+	var err error
+	if dialer != nil {
+		conn, err = dialer(proxy.Host)
+	} else {
+		conn, err = net.DialTimeout("tcp", proxy.Host, o.timeout())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(o.timeout()))
+	tunnelConn, err := tunnel(conn, proxy, hostPort)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return tunnelConn, nil
+}
+
+// connectTunnel establishes a tunnel using an HTTP CONNECT request.
+func connectTunnel(conn net.Conn, proxy *url.URL, hostPort string) (net.Conn, error) {
+	req := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: hostPort},
+		Host:   hostPort,
+		Header: make(http.Header),
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		req.SetBasicAuth(proxy.User.Username(), password)
+		req.Header.Set("Proxy-Authorization", req.Header.Get("Authorization"))
+		req.Header.Del("Authorization")
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proxy CONNECT to %v failed: %v", hostPort, resp.Status)
+	}
+
+	if reader.Buffered() > 0 {
+		return &bufferedConn{conn, reader}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a connection with data that was read ahead into a buffer.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+// socks5Tunnel establishes a tunnel using the SOCKS5 protocol, described in RFC 1928,
+// with username and password authentication described in RFC 1929.
+func socks5Tunnel(conn net.Conn, proxy *url.URL, hostPort string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	const (
+		version       = 5
+		noAuth        = 0
+		passwordAuth  = 2
+		noAcceptable  = 0xff
+		cmdConnect    = 1
+		addrIPv4      = 1
+		addrDomain    = 3
+		addrIPv6      = 4
+		passwordVer   = 1
+		passwordValid = 0
+	)
+
+	methods := []byte{noAuth}
+	if proxy.User != nil {
+		methods = append(methods, passwordAuth)
+	}
+	if _, err := conn.Write(append([]byte{version, byte(len(methods))}, methods...)); err != nil {
+		return nil, err
+	}
+
+	var resp [2]byte
+	if _, err := io.ReadFull(conn, resp[:]); err != nil {
+		return nil, err
+	}
+	if resp[0] != version {
+		return nil, errSOCKSBadResponse
+	}
+	switch resp[1] {
+	case noAuth:
+	case passwordAuth:
+		if proxy.User == nil {
+			return nil, errSOCKSBadResponse
+		}
+		username := proxy.User.Username()
+		password, _ := proxy.User.Password()
+		req := []byte{passwordVer, byte(len(username))}
+		req = append(req, username...)
+		req = append(req, byte(len(password)))
+		req = append(req, password...)
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(conn, resp[:]); err != nil {
+			return nil, err
+		}
+		if resp[1] != passwordValid {
+			return nil, errSOCKSAuthFailed
+		}
+	case noAcceptable:
+		return nil, errSOCKSAuthMethod
+	default:
+		return nil, errSOCKSBadResponse
+	}
+
+	req := []byte{version, cmdConnect, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		req = append(req, addrDomain, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, addrIPv4)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, addrIPv6)
+		req = append(req, ip...)
+	}
+	var portBytes [2]byte
+	binary.BigEndian.PutUint16(portBytes[:], uint16(port))
+	req = append(req, portBytes[:]...)
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	// The reply has the version, a reply code, a reserved byte, and the bound address.
+	var reply [4]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return nil, err
+	}
+	if reply[0] != version {
+		return nil, errSOCKSBadResponse
+	}
+	if reply[1] != 0 {
+		return nil, fmt.Errorf("socks5 proxy CONNECT to %v failed with reply code %v", hostPort, reply[1])
+	}
+
+	var addrLen int
+	switch reply[3] {
+	case addrIPv4:
+		addrLen = net.IPv4len
+	case addrIPv6:
+		addrLen = net.IPv6len
+	case addrDomain:
+		var domainLen [1]byte
+		if _, err := io.ReadFull(conn, domainLen[:]); err != nil {
+			return nil, err
+		}
+		addrLen = int(domainLen[0])
+	default:
+		return nil, errSOCKSBadResponse
+	}
+	if _, err := io.ReadFull(conn, make([]byte, addrLen+2)); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+// testProxy is a proxy server that records the destinations of its tunnels.
+type testProxy struct {
+	sync.Mutex
+	ln           net.Listener
+	destinations []string
+}
+
+func (p *testProxy) tunnel(conn net.Conn, reader io.Reader, dest string) {
+	p.Lock()
+	p.destinations = append(p.destinations, dest)
+	p.Unlock()
+
+	destConn, err := net.Dial("tcp", dest)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go io.Copy(destConn, reader)
+	io.Copy(conn, destConn)
+	conn.Close()
+	destConn.Close()
+}
+
+func (p *testProxy) getDestinations() []string {
+	p.Lock()
+	defer p.Unlock()
+	return append([]string(nil), p.destinations...)
+}
+
+func (p *testProxy) serve(handle func(net.Conn)) *testProxy {
+	for {
+		conn, err := p.ln.Accept()
+		if err != nil {
+			return p
+		}
+		go handle(conn)
+	}
+}
+
+func newTestProxy(t *testing.T) *testProxy {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Listen failed")
+	return &testProxy{ln: ln}
+}
+
+// newSOCKS5Proxy returns a SOCKS5 proxy that requires the given username and password.
+func newSOCKS5Proxy(t *testing.T, username, password string) *testProxy {
+	p := newTestProxy(t)
+	go p.serve(func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		var header [2]byte
+		io.ReadFull(reader, header[:])
+		io.ReadFull(reader, make([]byte, header[1]))
+		conn.Write([]byte{5, 2})
+
+		reader.ReadByte() // The version of the username and password request.
+		ulen, _ := reader.ReadByte()
+		user := make([]byte, ulen)
+		io.ReadFull(reader, user)
+		plen, _ := reader.ReadByte()
+		pass := make([]byte, plen)
+		io.ReadFull(reader, pass)
+		if string(user) != username || string(pass) != password {
+			conn.Write([]byte{1, 1})
+			conn.Close()
+			return
+		}
+		conn.Write([]byte{1, 0})
+
+		var req [4]byte
+		io.ReadFull(reader, req[:])
+		ip := make(net.IP, net.IPv4len)
+		io.ReadFull(reader, ip)
+		var port [2]byte
+		io.ReadFull(reader, port[:])
+		conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+
+		dest := net.JoinHostPort(ip.String(), strconv.Itoa(int(binary.BigEndian.Uint16(port[:]))))
+		p.tunnel(conn, reader, dest)
+	})
+	return p
+}
+
+// newConnectProxy returns an HTTP CONNECT proxy.
+func newConnectProxy(t *testing.T) *testProxy {
+	p := newTestProxy(t)
+	go p.serve(func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		req, err := http.ReadRequest(reader)
+		if err != nil || req.Method != "CONNECT" {
+			conn.Close()
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		p.tunnel(conn, reader, req.Host)
+	})
+	return p
+}
+
+var proxyTestServerOpts = &testutils.ChannelOpts{ServiceName: "proxy-svc"}
+
+func registerProxyTestEcho(t *testing.T, server *Channel) {
+	testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+}
+
+func callProxyTestServer(client *Channel, hostPort string) error {
+	_, err := callWithTimeout(client, hostPort, "proxy-svc", "echo", []byte("arg2"), []byte("arg3"))
+	return err
+}
+
+func TestProxy(t *testing.T) {
+	socks := newSOCKS5Proxy(t, "user", "pass")
+	defer socks.ln.Close()
+	connect := newConnectProxy(t)
+	defer connect.ln.Close()
+
+	tests := []struct {
+		msg   string
+		url   *url.URL
+		proxy *testProxy
+	}{
+		{"socks5", &url.URL{Scheme: "socks5", Host: socks.ln.Addr().String(), User: url.UserPassword("user", "pass")}, socks},
+		{"http", &url.URL{Scheme: "http", Host: connect.ln.Addr().String()}, connect},
+	}
+	WithVerifiedServer(t, proxyTestServerOpts, func(server *Channel, hostPort string) {
+		registerProxyTestEcho(t, server)
+		for _, tt := range tests {
+			client, err := testutils.NewClient(&testutils.ChannelOpts{
+				ServiceName: "proxy-client",
+				Proxy:       &ProxyOptions{URL: tt.url},
+			})
+			require.NoError(t, err, "NewClient failed")
+			assert.NoError(t, callProxyTestServer(client, hostPort), "%v: call through proxy failed", tt.msg)
+			assert.Equal(t, []string{hostPort}, tt.proxy.getDestinations(), "%v: proxy destinations mismatch", tt.msg)
+			client.Close()
+		}
+	})
+}
+
+func TestProxyPeerURLs(t *testing.T) {
+	WithVerifiedServer(t, proxyTestServerOpts, func(server *Channel, hostPort string) {
+		registerProxyTestEcho(t, server)
+
+		// The default proxy does not exist, but the peer is configured to connect directly.
+		client, err := testutils.NewClient(&testutils.ChannelOpts{
+			ServiceName: "proxy-client",
+			Proxy: &ProxyOptions{
+				URL:      &url.URL{Scheme: "socks5", Host: "127.0.0.1:1"},
+				PeerURLs: map[string]*url.URL{hostPort: nil},
+			},
+		})
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+		assert.NoError(t, callProxyTestServer(client, hostPort), "direct call failed")
+	})
+}
+
+func TestProxyAuthFailed(t *testing.T) {
+	socks := newSOCKS5Proxy(t, "user", "pass")
+	defer socks.ln.Close()
+
+	WithVerifiedServer(t, proxyTestServerOpts, func(server *Channel, hostPort string) {
+		registerProxyTestEcho(t, server)
+
+		stats := newRecordingStatsReporter()
+		client, err := testutils.NewClient(&testutils.ChannelOpts{
+			ServiceName:   "proxy-client",
+			StatsReporter: stats,
+			Proxy: &ProxyOptions{URL: &url.URL{
+				Scheme: "socks5",
+				Host:   socks.ln.Addr().String(),
+				User:   url.UserPassword("user", "wrong"),
+			}},
+		})
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+		assert.Error(t, callProxyTestServer(client, hostPort), "call with invalid proxy credentials should fail")
+		assert.Empty(t, socks.getDestinations(), "proxy should not open a tunnel")
+		assert.EqualValues(t, 1, counterValue(stats, "outbound.proxy.connect-failed"), "proxy failure should be counted")
+	})
+}
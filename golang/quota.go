@@ -0,0 +1,197 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExceeded is a SystemError indicating that the caller has exceeded its quota.
+// Unlike ErrServerBusy, callers should not retry the call until the quota period ends.
+var ErrQuotaExceeded = NewSystemError(ErrCodeBadRequest, "quota exceeded")
+
+// IsQuotaExceeded returns whether the error is returned for calls over the caller's quota.
+func IsQuotaExceeded(err error) bool {
+	return errors.Is(err, ErrQuotaExceeded)
+}
+
+var errQuotasNotEnabled = errors.New("quotas are not enabled for this channel")
+
+// Quota is the number of calls a caller may make in each period.
+type Quota struct {
+	Limit int64
+
+	// Period is the length of the quota period, such as time.Hour or 24 * time.Hour.
+	// Periods are aligned to UTC, so daily quotas are reset at midnight UTC.
+	Period time.Duration
+}
+
+// QuotaStore stores the call counters used to enforce quotas. Stores may be shared by
+// multiple channels so that quotas are enforced across instances of a service.
+type QuotaStore interface {
+	// Increment increments the counter for the key, and returns the new count.
+	// The counter can be discarded once the expiry has elapsed.
+	Increment(key string, expiry time.Duration) (int64, error)
+}
+
+// QuotaOptions configure per-caller quotas for inbound calls.
+type QuotaOptions struct {
+	// Callers maps a caller's service name to its quotas for each service.
+	Callers map[string][]Quota
+
+	// Default is the quotas for callers that are not in Callers.
+	Default []Quota
+
+	// Store is the store for call counters. Defaults to an in-memory store, which
+	// only enforces quotas for calls to this channel.
+	Store QuotaStore
+}
+
+// quotaEnforcer enforces quotas for inbound calls.
+type quotaEnforcer struct {
+	mut  sync.RWMutex // protects the quotas in opts.
+	opts QuotaOptions
+}
+
+func newQuotaEnforcer(opts *QuotaOptions) *quotaEnforcer {
+	if opts == nil {
+		return nil
+	}
+
+	q := &quotaEnforcer{opts: *opts}
+	if q.opts.Store == nil {
+		q.opts.Store = NewMemoryQuotaStore()
+	}
+	return q
+}
+
+// quotaKey returns the counter key for calls from the caller to the service in the
+// period that contains now.
+func quotaKey(service, caller string, period time.Duration, now time.Time) string {
+	start := now.Truncate(period)
+	return fmt.Sprintf("tchannel-quota:%s:%s:%d:%d", service, caller, int64(period/time.Second), start.Unix())
+}
+
+// check counts the call against the caller's quotas, and returns ErrQuotaExceeded if
+// any quota is exceeded. Calls are allowed if the store fails.
+func (q *quotaEnforcer) check(c *Connection, call *InboundCall) error {
+	if q == nil {
+		return nil
+	}
+
+	caller := call.CallerName()
+	q.mut.RLock()
+	quotas, ok := q.opts.Callers[caller]
+	if !ok {
+		quotas = q.opts.Default
+	}
+	q.mut.RUnlock()
+
+	now := c.clock.Now()
+	exceeded := false
+	for _, quota := range quotas {
+		if quota.Period <= 0 {
+			continue
+		}
+
+		start := now.Truncate(quota.Period)
+		expiry := start.Add(quota.Period).Sub(now)
+		count, err := q.opts.Store.Increment(quotaKey(call.ServiceName(), caller, quota.Period, now), expiry)
+		if err != nil {
+			c.log.Warnf("Quota store failed for %s:%s from %s: %v", call.ServiceName(), call.Operation(), caller, err)
+			call.statsReporter.IncCounter("inbound.quota.store-errors", call.commonStatsTags, 1)
+			continue
+		}
+		if count > quota.Limit {
+			exceeded = true
+		}
+	}
+
+	if exceeded {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// update replaces the quotas, keeping the store and its counters.
+func (q *quotaEnforcer) update(callers map[string][]Quota, defaultQuotas []Quota) {
+	q.mut.Lock()
+	q.opts.Callers = callers
+	q.opts.Default = defaultQuotas
+	q.mut.Unlock()
+}
+
+// SetQuotas replaces the per-caller and default quotas for inbound calls. Counters for
+// the current quota periods are kept. An error is returned if the channel was not
+// created with quotas enabled. The quotas are stored in the channel's RuntimeOptions.
+func (ch *Channel) SetQuotas(callers map[string][]Quota, defaultQuotas []Quota) error {
+	if ch.quotas == nil {
+		return errQuotasNotEnabled
+	}
+	return ch.UpdateRuntimeOptions(func(opts *RuntimeOptions) {
+		opts.Quotas = callers
+		opts.DefaultQuotas = defaultQuotas
+	})
+}
+
+// memoryQuotaStore is an in-memory QuotaStore.
+type memoryQuotaStore struct {
+	mut       sync.Mutex
+	counters  map[string]*memoryQuotaCounter
+	lastSweep time.Time
+}
+
+type memoryQuotaCounter struct {
+	count   int64
+	expires time.Time
+}
+
+// NewMemoryQuotaStore returns a QuotaStore that keeps counters in memory.
+func NewMemoryQuotaStore() QuotaStore {
+	return &memoryQuotaStore{counters: make(map[string]*memoryQuotaCounter)}
+}
+
+// Increment implements QuotaStore.
+func (s *memoryQuotaStore) Increment(key string, expiry time.Duration) (int64, error) {
+	now := timeNow()
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, counter := range s.counters {
+			if !now.Before(counter.expires) {
+				delete(s.counters, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	counter, ok := s.counters[key]
+	if !ok || !now.Before(counter.expires) {
+		counter = &memoryQuotaCounter{expires: now.Add(expiry)}
+		s.counters[key] = counter
+	}
+	counter.count++
+	return counter.count, nil
+}
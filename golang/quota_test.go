@@ -0,0 +1,140 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestQuotas(t *testing.T) {
+	nowFn := testutils.NowStub(GetTimeNow(), time.Date(2015, 6, 1, 10, 59, 0, 0, time.UTC))
+	defer testutils.ResetNowStub(GetTimeNow())
+
+	stats := newRecordingStatsReporter()
+	server, err := NewChannel("quota-svc", &ChannelOptions{
+		StatsReporter: stats,
+		Quotas: &QuotaOptions{
+			Callers: map[string][]Quota{
+				"limited": {{Limit: 2, Period: time.Hour}},
+			},
+			Default: []Quota{{Limit: 100, Period: 24 * time.Hour}},
+		},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{}, nil
+	})
+
+	clients := make(map[string]*Channel)
+	for _, name := range []string{"limited", "other"} {
+		client, err := NewChannel(name, nil)
+		require.NoError(t, err, "NewChannel failed")
+		defer client.Close()
+		clients[name] = client
+	}
+
+	call := func(callerName string) error {
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		_, _, _, err := raw.Call(ctx, clients[callerName], server.PeerInfo().HostPort, "quota-svc", "echo", nil, nil)
+		return err
+	}
+
+	assert.NoError(t, call("limited"), "call within quota failed")
+	assert.NoError(t, call("limited"), "call within quota failed")
+	err = call("limited")
+	assert.True(t, IsQuotaExceeded(err), "call over quota should fail with quota exceeded, got %v", err)
+	assert.NotEqual(t, ErrCodeBusy, GetSystemErrorCode(err), "quota errors should not be busy errors")
+	assert.NoError(t, call("other"), "other callers should not be affected")
+
+	// The hourly quota is reset at the start of the next hour.
+	nowFn(2 * time.Minute)
+	assert.NoError(t, call("limited"), "call after the quota period failed")
+
+	exceeded := counterValue(stats, "inbound.calls.quota-exceeded")
+	assert.EqualValues(t, 1, exceeded, "calls over quota should be counted")
+}
+
+type failingQuotaStore struct{}
+
+func (failingQuotaStore) Increment(key string, expiry time.Duration) (int64, error) {
+	return 0, errors.New("store unavailable")
+}
+
+func TestQuotaStoreFailureAllowsCalls(t *testing.T) {
+	server, err := NewChannel("quota-svc", &ChannelOptions{
+		Quotas: &QuotaOptions{
+			Default: []Quota{{Limit: 0, Period: time.Hour}},
+			Store:   failingQuotaStore{},
+		},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{}, nil
+	})
+
+	client, err := NewChannel("client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	_, _, _, err = raw.Call(ctx, client, server.PeerInfo().HostPort, "quota-svc", "echo", nil, nil)
+	assert.NoError(t, err, "calls should be allowed when the quota store fails")
+}
+
+func TestMemoryQuotaStore(t *testing.T) {
+	nowFn := testutils.NowStub(GetTimeNow(), time.Unix(1000, 0))
+	defer testutils.ResetNowStub(GetTimeNow())
+
+	store := NewMemoryQuotaStore()
+	for i := int64(1); i <= 3; i++ {
+		count, err := store.Increment("key", time.Minute)
+		require.NoError(t, err, "Increment failed")
+		assert.Equal(t, i, count, "count mismatch")
+	}
+
+	nowFn(time.Minute)
+	count, err := store.Increment("key", time.Minute)
+	require.NoError(t, err, "Increment failed")
+	assert.EqualValues(t, 1, count, "counter should be reset after it expires")
+}
+
+func TestIsQuotaExceeded(t *testing.T) {
+	assert.False(t, IsQuotaExceeded(nil), "nil is not quota exceeded")
+	assert.False(t, IsQuotaExceeded(ErrServerBusy), "busy is not quota exceeded")
+	assert.True(t, IsQuotaExceeded(ErrQuotaExceeded), "ErrQuotaExceeded mismatch")
+	assert.False(t, IsQuotaExceeded(NewSystemError(ErrCodeBadRequest, "quota exceeded for user")),
+		"errors from handlers that share the message prefix are not quota exceeded")
+}
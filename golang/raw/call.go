@@ -21,14 +21,24 @@
 package raw
 
 import (
-	"errors"
-
 	"github.com/uber/tchannel/golang"
 	"golang.org/x/net/context"
 )
 
 // ErrAppError is returned if the application sets an error response.
-var ErrAppError = errors.New("application error")
+var ErrAppError error = appError{}
+
+// appError is the type of ErrAppError, which tchannel.IsApplicationError distinguishes
+// from system errors.
+type appError struct{}
+
+func (appError) Error() string {
+	return "application error"
+}
+
+func (appError) ApplicationError() bool {
+	return true
+}
 
 // WriteArgs writes the given arguments to the call, and returns the response args.
 func WriteArgs(call *tchannel.OutboundCall, arg2, arg3 []byte) ([]byte, []byte, *tchannel.OutboundCallResponse, error) {
@@ -55,13 +65,95 @@ func WriteArgs(call *tchannel.OutboundCall, arg2, arg3 []byte) ([]byte, []byte,
 }
 
 // Call makes a call to the given hostPort with the given arguments and returns the response args.
+// The arguments are signed if payload signing is enabled for the channel.
 func Call(ctx context.Context, ch *tchannel.Channel, hostPort string, serviceName, operation string,
 	arg2, arg3 []byte) ([]byte, []byte, *tchannel.OutboundCallResponse, error) {
 
-	call, err := ch.BeginCall(ctx, hostPort, serviceName, operation, nil)
+	return CallWithOptions(ctx, ch, hostPort, serviceName, operation, arg2, arg3, nil)
+}
+
+// CallWithOptions is the same as Call, but makes the call using the given call options.
+// The format defaults to raw, and the options' Timeout and RetryOptions are applied using
+// tchannel.WithCallOptions. The call is not retried, as it is made to a specific hostPort.
+func CallWithOptions(ctx context.Context, ch *tchannel.Channel, hostPort string, serviceName, operation string,
+	arg2, arg3 []byte, opts *tchannel.CallOptions) ([]byte, []byte, *tchannel.OutboundCallResponse, error) {
+
+	ctx, cancel := tchannel.WithCallOptions(ctx, opts)
+	defer cancel()
+
+	call, err := ch.BeginCall(ctx, hostPort, serviceName, operation,
+		callOptions(opts, ch.SignPayload(serviceName, operation, arg2, arg3), ch.HashContent(arg3)))
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
 	return WriteArgs(call, arg2, arg3)
 }
+
+// CallSC makes a call using the given subchannel with the given arguments, retrying as
+// specified by the retry options in the context. If the call fails after exhausting its
+// retries, or because the circuit breaker is open, the subchannel's fallback is used to
+// get the response args, and the returned response is nil. The returned response is
+// also nil if the response args are from the subchannel's response cache.
+func CallSC(ctx context.Context, sc *tchannel.SubChannel, operation string,
+	arg2, arg3 []byte) ([]byte, []byte, *tchannel.OutboundCallResponse, error) {
+
+	return CallSCWithOptions(ctx, sc, operation, arg2, arg3, nil)
+}
+
+// CallSCWithOptions is the same as CallSC, but makes the call using the given call options.
+// The format defaults to raw, and the options' Timeout and RetryOptions are applied using
+// tchannel.WithCallOptions.
+func CallSCWithOptions(ctx context.Context, sc *tchannel.SubChannel, operation string,
+	arg2, arg3 []byte, opts *tchannel.CallOptions) ([]byte, []byte, *tchannel.OutboundCallResponse, error) {
+
+	if respArg2, respArg3, ok := sc.CachedResponse(operation, arg2, arg3); ok {
+		return respArg2, respArg3, nil, nil
+	}
+
+	ctx, cancel := tchannel.WithCallOptions(ctx, opts)
+	defer cancel()
+
+	var respArg2, respArg3 []byte
+	var resp *tchannel.OutboundCallResponse
+	err := sc.RunWithRetry(ctx, func(ctx context.Context, rs *tchannel.RequestState) error {
+		call, err := sc.BeginCall(ctx, operation, callOptions(opts, sc.SignPayload(operation, arg2, arg3), sc.HashContent(arg3)))
+		if err != nil {
+			return err
+		}
+
+		respArg2, respArg3, resp, err = WriteArgs(call, arg2, arg3)
+		return err
+	})
+	if err != nil {
+		if fbArg2, fbArg3, ok, fbErr := sc.Fallback(ctx, operation, err); ok {
+			return fbArg2, fbArg3, nil, fbErr
+		}
+		return nil, nil, nil, err
+	}
+
+	if !resp.ApplicationError() {
+		sc.CacheResponse(operation, arg2, arg3, respArg2, respArg3)
+	}
+	return respArg2, respArg3, resp, nil
+}
+
+// callOptions returns the options for BeginCall, which are a copy of opts with the given
+// payload signature and content hash. It returns opts if there is nothing to add.
+func callOptions(opts *tchannel.CallOptions, signature, contentHash string) *tchannel.CallOptions {
+	if signature == "" && contentHash == "" {
+		return opts
+	}
+
+	var callOpts tchannel.CallOptions
+	if opts != nil {
+		callOpts = *opts
+	}
+	if signature != "" {
+		callOpts.PayloadSignature = signature
+	}
+	if contentHash != "" {
+		callOpts.ContentHash = contentHash
+	}
+	return &callOpts
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+// ArgRedactor returns a copy of a call's arguments with sensitive information removed.
+// The arguments may be truncated, so redactors should not assume they can be decoded.
+type ArgRedactor func(arg2, arg3 []byte) (redactedArg2, redactedArg3 []byte)
+
+// RedactionOptions configure how sensitive information is removed from call headers and
+// payloads before they are sampled or included in audit records.
+type RedactionOptions struct {
+	// Headers is called with a copy of a call's transport headers, and may modify it.
+	Headers func(headers map[string]string)
+
+	// Args maps an arg scheme to the redactor for the arguments of calls using it.
+	// The arguments of calls using other arg schemes are not redacted.
+	Args map[Format]ArgRedactor
+}
+
+// redactHeaders returns a copy of the transport headers, redacted using the options.
+func (o *RedactionOptions) redactHeaders(headers transportHeaders) map[string]string {
+	headersCopy := make(map[string]string, len(headers))
+	for k, v := range headers {
+		headersCopy[string(k)] = v
+	}
+	if o != nil && o.Headers != nil {
+		o.Headers(headersCopy)
+	}
+	return headersCopy
+}
+
+// redactArgs returns the arguments redacted using the redactor for the arg scheme.
+func (o *RedactionOptions) redactArgs(format Format, arg2, arg3 []byte) ([]byte, []byte) {
+	if o == nil {
+		return arg2, arg3
+	}
+	redact, ok := o.Args[format]
+	if !ok {
+		return arg2, arg3
+	}
+	return redact(arg2, arg3)
+}
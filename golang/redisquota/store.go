@@ -0,0 +1,72 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// Package redisquota provides a tchannel.QuotaStore that keeps quota counters in Redis,
+// so that quotas are enforced across all instances of a service.
+package redisquota
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/uber/tchannel/golang"
+)
+
+// Conn is a connection to Redis. It is satisfied by redigo's redis.Conn.
+type Conn interface {
+	Do(commandName string, args ...interface{}) (interface{}, error)
+	Close() error
+}
+
+type store struct {
+	getConn func() Conn
+	prefix  string
+}
+
+// NewStore returns a QuotaStore that keeps counters in Redis. getConn is called to get
+// a connection for each increment, and the connection is closed after use, so it is
+// typically a redigo Pool's Get method. The prefix is prepended to all keys.
+func NewStore(getConn func() Conn, prefix string) tchannel.QuotaStore {
+	return &store{getConn: getConn, prefix: prefix}
+}
+
+// Increment implements tchannel.QuotaStore.
+func (s *store) Increment(key string, expiry time.Duration) (int64, error) {
+	conn := s.getConn()
+	defer conn.Close()
+
+	// The key is created with its expiry before it is incremented, so a failure between
+	// the two commands can never leave a counter that does not expire. NX leaves the
+	// counter and its expiry unchanged if the key already exists.
+	key = s.prefix + key
+	if _, err := conn.Do("SET", key, 0, "PX", int64(expiry/time.Millisecond), "NX"); err != nil {
+		return 0, err
+	}
+
+	reply, err := conn.Do("INCR", key)
+	if err != nil {
+		return 0, err
+	}
+
+	count, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected reply to INCR: %v", reply)
+	}
+	return count, nil
+}
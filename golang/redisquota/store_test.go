@@ -0,0 +1,108 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package redisquota
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeConn struct {
+	counters map[string]int64
+	expiries map[string]int64
+	closed   int
+	failures map[string]error
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{
+		counters: make(map[string]int64),
+		expiries: make(map[string]int64),
+		failures: make(map[string]error),
+	}
+}
+
+func (c *fakeConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	if err := c.failures[commandName]; err != nil {
+		return nil, err
+	}
+
+	key := args[0].(string)
+	switch commandName {
+	case "SET":
+		// Only SET key 0 PX ms NX is supported.
+		if _, ok := c.counters[key]; ok {
+			return nil, nil
+		}
+		c.counters[key] = int64(args[1].(int))
+		c.expiries[key] = args[3].(int64)
+		return "OK", nil
+	case "INCR":
+		c.counters[key]++
+		return c.counters[key], nil
+	}
+	return nil, fmt.Errorf("unknown command %v", commandName)
+}
+
+func (c *fakeConn) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestStore(t *testing.T) {
+	conn := newFakeConn()
+	s := NewStore(func() Conn { return conn }, "svc:")
+
+	for i := int64(1); i <= 3; i++ {
+		count, err := s.Increment("k", time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, i, count)
+	}
+
+	assert.Equal(t, int64(3), conn.counters["svc:k"])
+	assert.Equal(t, map[string]int64{"svc:k": 60000}, conn.expiries, "Expiry should be set once")
+	assert.Equal(t, 3, conn.closed, "Connections should be closed after use")
+}
+
+func TestStoreSetFails(t *testing.T) {
+	conn := newFakeConn()
+	conn.failures["SET"] = errors.New("set failed")
+	s := NewStore(func() Conn { return conn }, "svc:")
+
+	_, err := s.Increment("k", time.Minute)
+	assert.Equal(t, conn.failures["SET"], err, "Increment should return the SET error")
+	assert.Empty(t, conn.counters, "Counter should not be created without an expiry")
+	assert.Equal(t, 1, conn.closed, "Connection should be closed after a failure")
+}
+
+func TestStoreIncrFails(t *testing.T) {
+	conn := newFakeConn()
+	conn.failures["INCR"] = errors.New("incr failed")
+	s := NewStore(func() Conn { return conn }, "svc:")
+
+	_, err := s.Increment("k", time.Minute)
+	assert.Equal(t, conn.failures["INCR"], err, "Increment should return the INCR error")
+	assert.Equal(t, map[string]int64{"svc:k": 60000}, conn.expiries, "Counter should still expire")
+}
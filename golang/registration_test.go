@@ -0,0 +1,94 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/json"
+	"github.com/uber/tchannel/golang/raw"
+	"golang.org/x/net/context"
+)
+
+func TestDuplicateRegistrationRejected(t *testing.T) {
+	ch, err := NewChannel("svc", &ChannelOptions{DuplicateRegistration: DuplicateRegistrationReject})
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+
+	h := raw.Wrap(newTestHandler(t))
+	ch.Register(h, "echo")
+	assert.Panics(t, func() { ch.Register(h, "echo") }, "duplicate registration should panic")
+
+	sc := ch.GetSubChannel("subsvc")
+	sc.Register(h, "admin::*")
+	assert.Panics(t, func() { sc.Register(h, "admin::*") }, "duplicate pattern registration should panic")
+	assert.NotPanics(t, func() { sc.Register(h, "echo") },
+		"registering the same operation on another service should not panic")
+}
+
+func TestDuplicateRegistrationWarn(t *testing.T) {
+	// Duplicate registrations replace the existing handler by default.
+	ch, err := NewChannel("svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, ch.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer ch.Close()
+
+	ch.Register(HandlerFunc(func(ctx context.Context, call *InboundCall) {}), "echo")
+	ch.Register(raw.Wrap(newTestHandler(t)), "echo")
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	_, arg3, _, err := raw.Call(ctx, ch, ch.PeerInfo().HostPort, "svc", "echo", testArg2, testArg3)
+	require.NoError(t, err, "Call failed")
+	assert.Equal(t, testArg3, arg3, "the second handler should replace the first")
+}
+
+func TestSubChannelOperations(t *testing.T) {
+	ch, err := NewChannel("svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+
+	sc := ch.GetSubChannel("subsvc")
+	assert.Empty(t, sc.Operations(), "no operations should be registered")
+
+	h := raw.Wrap(newTestHandler(t))
+	sc.Register(h, "echo")
+	sc.RegisterOperation(h, OperationInfo{
+		Name:     "admin::*",
+		Format:   Raw,
+		Metadata: map[string]string{"owner": "infra"},
+	})
+	require.NoError(t, json.Register(sc, json.Handlers{
+		"get": func(ctx json.Context, arg *struct{}) (*struct{}, error) { return arg, nil },
+	}, nil), "json.Register failed")
+
+	want := []OperationInfo{
+		{Name: "admin::*", Format: Raw, Metadata: map[string]string{"owner": "infra"}},
+		{Name: "echo"},
+		{Name: "get", Format: JSON},
+	}
+	assert.Equal(t, want, sc.Operations(), "Operations mismatch")
+	assert.Equal(t, want, ch.IntrospectState(nil).Operations["subsvc"], "introspected operations mismatch")
+}
@@ -0,0 +1,472 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/tchannel/golang/typed"
+	"golang.org/x/net/context"
+)
+
+// relayQueueSize is the number of request frames buffered for a relayed call while
+// the connection to the destination is established.
+const relayQueueSize = 512
+
+var (
+	errRelayNoDestination = NewSystemError(ErrCodeDeclined, "relay could not connect to destination")
+	errRelayQueueFull     = NewSystemError(ErrCodeBusy, "relay buffer full")
+	errRelayDestLost      = NewSystemError(ErrCodeNetwork, "relay lost connection to destination")
+)
+
+// RelayHosts selects the destination for calls that are relayed by a channel.
+type RelayHosts interface {
+	// Get returns the host:port of the peer that a call for the given service should
+	// be relayed to, or an empty string if the call should be handled locally.
+	Get(serviceName string) string
+}
+
+// SimpleRelayHosts is a RelayHosts that relays calls for each service to a random peer
+// from a fixed list.
+type SimpleRelayHosts map[string][]string
+
+// Get implements RelayHosts.
+func (h SimpleRelayHosts) Get(serviceName string) string {
+	hostPorts := h[serviceName]
+	if len(hostPorts) == 0 {
+		return ""
+	}
+	return hostPorts[peerRng.Intn(len(hostPorts))]
+}
+
+// checkRelayOptions returns an error if relaying is enabled together with options that
+// check inbound calls. Relayed calls are forwarded frame by frame without being dispatched,
+// so these checks would not be applied to them.
+func checkRelayOptions(opts *ChannelOptions) error {
+	if opts.RelayHosts == nil {
+		return nil
+	}
+
+	var conflicts []string
+	if opts.Authorizer != nil {
+		conflicts = append(conflicts, "Authorizer")
+	}
+	if opts.TLS != nil && len(opts.TLS.Authorization) > 0 {
+		conflicts = append(conflicts, "TLS.Authorization")
+	}
+	if opts.PayloadSigning != nil && opts.PayloadSigning.Required {
+		conflicts = append(conflicts, "PayloadSigning.Required")
+	}
+	if opts.Quotas != nil {
+		conflicts = append(conflicts, "Quotas")
+	}
+	if opts.AdmissionController != nil {
+		conflicts = append(conflicts, "AdmissionController")
+	}
+	if opts.ConcurrencyLimiter != nil {
+		conflicts = append(conflicts, "ConcurrencyLimiter")
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("RelayHosts cannot be used with %v, as they are not applied to relayed calls",
+			strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+// relayItem is a call that is being relayed from a source connection to a destination.
+type relayItem struct {
+	src       *Connection
+	srcID     uint32
+	frames    chan *Frame
+	done      chan struct{}
+	once      sync.Once
+	startedAt time.Time
+	tags      map[string]string
+
+	mut      sync.Mutex // protects the following fields.
+	dest     *Connection
+	destID   uint32
+	finished bool
+}
+
+// relayer forwards frames for relayed calls on a connection.
+type relayer struct {
+	ch    *Channel
+	conn  *Connection
+	hosts RelayHosts
+
+	mut sync.Mutex
+	// inbound contains calls received on this connection, keyed by the caller's message ID.
+	inbound map[uint32]*relayItem
+	// outbound contains calls sent on this connection, keyed by the relayed message ID.
+	outbound map[uint32]*relayItem
+}
+
+func newRelayer(ch *Channel, conn *Connection) *relayer {
+	if ch.relayHosts == nil {
+		return nil
+	}
+	return &relayer{
+		ch:       ch,
+		conn:     conn,
+		hosts:    ch.relayHosts,
+		inbound:  make(map[uint32]*relayItem),
+		outbound: make(map[uint32]*relayItem),
+	}
+}
+
+// hasMoreFragments returns whether a call frame is followed by more fragments.
+func hasMoreFragments(frame *Frame) bool {
+	payload := frame.SizedPayload()
+	return len(payload) > 0 && payload[0]&hasMoreFragmentsFlag != 0
+}
+
+// relayCallReq relays the call if its service is relayed, and returns whether the frame
+// was handled and whether it should be released.
+func (r *relayer) relayCallReq(frame *Frame) (handled bool, release bool) {
+	if r == nil {
+		return false, true
+	}
+
+	payload := frame.SizedPayload()
+	if len(payload) == 0 {
+		return false, true
+	}
+	callReq := new(callReq)
+	if err := callReq.read(typed.NewReadBuffer(payload[1:])); err != nil {
+		return false, true
+	}
+	// The deadline is taken before the destination is looked up, so time spent in the
+	// relay is deducted from the TTL forwarded to the destination.
+	deadline := time.Now().Add(callReq.TimeToLive)
+	hostPort := r.hosts.Get(callReq.Service)
+	if hostPort == "" {
+		return false, true
+	}
+
+	c := r.conn
+	item := &relayItem{
+		src:       c,
+		srcID:     frame.Header.ID,
+		frames:    make(chan *Frame, relayQueueSize),
+		done:      make(chan struct{}),
+		startedAt: c.clock.Now(),
+		tags:      make(map[string]string, len(c.commonStatsTags)+2),
+	}
+	for k, v := range c.commonStatsTags {
+		item.tags[k] = v
+	}
+	item.tags["service"] = callReq.Service
+	item.tags["dest"] = hostPort
+
+	r.mut.Lock()
+	_, dup := r.inbound[item.srcID]
+	if !dup {
+		r.inbound[item.srcID] = item
+	}
+	r.mut.Unlock()
+	if dup {
+		c.SendSystemError(frame.Header.ID, nil, errInboundRequestAlreadyActive)
+		return true, true
+	}
+
+	c.statsReporter.IncCounter("relay.calls.forwarded", item.tags, 1)
+	item.frames <- frame
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	go item.run(ctx, cancel, hostPort)
+	return true, false
+}
+
+// relayCallReqContinue forwards a continuation of a relayed call, and returns whether
+// the frame was handled and whether it should be released.
+func (r *relayer) relayCallReqContinue(frame *Frame) (handled bool, release bool) {
+	if r == nil {
+		return false, true
+	}
+
+	r.mut.Lock()
+	item, ok := r.inbound[frame.Header.ID]
+	r.mut.Unlock()
+	if !ok {
+		return false, true
+	}
+
+	queued, finished := item.enqueue(frame)
+	if finished {
+		return true, true
+	}
+	if !queued {
+		item.fail(errRelayQueueFull, "relay.calls.failed")
+		return true, true
+	}
+	return true, false
+}
+
+// relayResponse forwards a response frame for a relayed call back to the caller, and
+// returns whether the frame was handled and whether it should be released.
+func (r *relayer) relayResponse(frame *Frame) (handled bool, release bool) {
+	if r == nil {
+		return false, true
+	}
+
+	r.mut.Lock()
+	item, ok := r.outbound[frame.Header.ID]
+	r.mut.Unlock()
+	if !ok {
+		return false, true
+	}
+
+	last := !hasMoreFragments(frame)
+	frame.Header.ID = item.srcID
+	if !item.src.sendRelayFrame(frame) {
+		item.src.log.Warnf("Relay could not forward response for %d to %s", item.srcID, item.src.remotePeerInfo)
+		item.fail(errRelayQueueFull, "relay.calls.failed")
+		return true, true
+	}
+	if last {
+		item.finish("relay.calls.success")
+	}
+	return true, false
+}
+
+// relayCallProgress forwards a progress message for a relayed call back to the caller,
+// and returns whether the frame was handled and whether it should be released.
+func (r *relayer) relayCallProgress(frame *Frame) (handled bool, release bool) {
+	if r == nil {
+		return false, true
+	}
+
+	r.mut.Lock()
+	item, ok := r.outbound[frame.Header.ID]
+	r.mut.Unlock()
+	if !ok {
+		return false, true
+	}
+
+	frame.Header.ID = item.srcID
+	if !item.src.sendRelayFrame(frame) {
+		return true, true
+	}
+	return true, false
+}
+
+// relayError forwards an error for a relayed call back to the caller, and returns
+// whether the error was for a relayed call.
+func (r *relayer) relayError(errMsg *errorMessage) bool {
+	if r == nil {
+		return false
+	}
+
+	r.mut.Lock()
+	item, ok := r.outbound[errMsg.id]
+	r.mut.Unlock()
+	if !ok {
+		return false
+	}
+
+	item.src.SendSystemError(item.srcID, &errMsg.tracing, errMsg.AsSystemError())
+	item.finish("relay.calls.failed")
+	return true
+}
+
+// connectionLost fails the calls relayed to this connection, as their responses will
+// never arrive, and finishes the calls received on it, as they cannot be responded to.
+func (r *relayer) connectionLost() {
+	if r == nil {
+		return
+	}
+
+	r.mut.Lock()
+	inbound := make([]*relayItem, 0, len(r.inbound))
+	for _, item := range r.inbound {
+		inbound = append(inbound, item)
+	}
+	outbound := make([]*relayItem, 0, len(r.outbound))
+	for _, item := range r.outbound {
+		outbound = append(outbound, item)
+	}
+	r.mut.Unlock()
+
+	for _, item := range inbound {
+		item.finish("relay.calls.failed")
+	}
+	for _, item := range outbound {
+		item.fail(errRelayDestLost, "relay.calls.failed")
+	}
+}
+
+// enqueue queues a request frame to be sent to the destination, and returns whether it
+// was queued and whether the call has already finished. The check and the send are
+// made under the same lock as remove marks the call finished, so a frame is never
+// queued after remove has released the queued frames.
+func (item *relayItem) enqueue(frame *Frame) (queued bool, finished bool) {
+	item.mut.Lock()
+	defer item.mut.Unlock()
+	if item.finished {
+		return false, true
+	}
+	select {
+	case item.frames <- frame:
+		return true, false
+	default:
+		return false, false
+	}
+}
+
+// run connects to the destination and forwards the request frames for the call.
+func (item *relayItem) run(ctx context.Context, cancel context.CancelFunc, hostPort string) {
+	defer cancel()
+
+	ch := item.src.relay.ch
+	dest, err := ch.peers.GetOrAdd(hostPort).GetConnection(ctx)
+	if err != nil {
+		item.src.log.Warnf("Relay could not connect to %v: %v", hostPort, err)
+		item.fail(errRelayNoDestination, "relay.calls.failed")
+		return
+	}
+
+	item.mut.Lock()
+	if item.finished {
+		item.mut.Unlock()
+		return
+	}
+	destID := dest.NextMessageID()
+	item.dest, item.destID = dest, destID
+	dest.relay.mut.Lock()
+	dest.relay.outbound[destID] = item
+	dest.relay.mut.Unlock()
+	item.mut.Unlock()
+
+	for sending := true; sending; {
+		select {
+		case frame := <-item.frames:
+			sending = hasMoreFragments(frame)
+			frame.Header.ID = destID
+			if frame.Header.messageType == messageTypeCallReq {
+				setRelayTimeToLive(ctx, frame)
+			}
+			if !dest.sendRelayFrame(frame) {
+				dest.framePool.Release(frame)
+				item.fail(errRelayQueueFull, "relay.calls.failed")
+				return
+			}
+		case <-item.done:
+			return
+		case <-ctx.Done():
+			item.fail(ErrTimeout, "relay.calls.timeout")
+			return
+		}
+	}
+
+	select {
+	case <-item.done:
+	case <-ctx.Done():
+		item.fail(ErrTimeout, "relay.calls.timeout")
+	}
+}
+
+// setRelayTimeToLive rewrites the TTL in a call req frame to the time remaining before
+// the call's deadline.
+func setRelayTimeToLive(ctx context.Context, frame *Frame) {
+	deadline, _ := ctx.Deadline()
+	ttl := deadline.Sub(time.Now())
+	if ttl < time.Millisecond {
+		ttl = time.Millisecond
+	}
+	// The TTL is the first field after the flags byte, see callReq.write.
+	payload := frame.SizedPayload()
+	typed.NewWriteBuffer(payload[1:5]).WriteUint32(uint32(ttl / time.Millisecond))
+}
+
+// fail sends an error for the call to the caller, and finishes the call.
+func (item *relayItem) fail(err error, counter string) {
+	sent := false
+	item.once.Do(func() {
+		item.remove()
+		item.report(counter)
+		sent = true
+	})
+	if sent {
+		item.src.SendSystemError(item.srcID, nil, err)
+	}
+}
+
+// finish removes the call from the relay once it has completed.
+func (item *relayItem) finish(counter string) {
+	item.once.Do(func() {
+		item.remove()
+		item.report(counter)
+	})
+}
+
+func (item *relayItem) report(counter string) {
+	item.src.statsReporter.IncCounter(counter, item.tags, 1)
+	item.src.statsReporter.RecordTimer("relay.calls.latency", item.tags, item.src.clock.Now().Sub(item.startedAt))
+}
+
+func (item *relayItem) remove() {
+	src := item.src.relay
+	src.mut.Lock()
+	delete(src.inbound, item.srcID)
+	src.mut.Unlock()
+
+	item.mut.Lock()
+	item.finished = true
+	dest, destID := item.dest, item.destID
+	item.mut.Unlock()
+
+	if dest != nil {
+		dest.relay.mut.Lock()
+		delete(dest.relay.outbound, destID)
+		dest.relay.mut.Unlock()
+	}
+	close(item.done)
+
+	// Release any request frames that were not sent.
+	for {
+		select {
+		case frame := <-item.frames:
+			item.src.framePool.Release(frame)
+		default:
+			return
+		}
+	}
+}
+
+// sendRelayFrame sends a frame for a relayed call, and returns false if the frame
+// could not be sent as the connection is closed or its send buffer is full.
+func (c *Connection) sendRelayFrame(frame *Frame) bool {
+	sent := false
+	c.withStateRLock(func() error {
+		if c.state == connectionClosed {
+			return nil
+		}
+		select {
+		case c.sendCh <- frame:
+			sent = true
+		default:
+		}
+		return nil
+	})
+	return sent
+}
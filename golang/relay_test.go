@@ -0,0 +1,259 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestRelay(t *testing.T) {
+	server, err := NewChannel("svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+	testutils.RegisterFunc(t, server, "fail", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return nil, errors.New("app error")
+	})
+
+	// Reserve an address that nothing listens on for a service that cannot be reached.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Listen failed")
+	unreachable := l.Addr().String()
+	l.Close()
+
+	stats := newRecordingStatsReporter()
+	relay, err := NewChannel("relay", &ChannelOptions{
+		StatsReporter: stats,
+		RelayHosts: SimpleRelayHosts{
+			"svc":         {server.PeerInfo().HostPort},
+			"unreachable": {unreachable},
+		},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, relay.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer relay.Close()
+	testutils.RegisterFunc(t, relay, "local", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg3: []byte("relay")}, nil
+	})
+
+	client, err := NewChannel("client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	call := func(service, operation string, arg2, arg3 []byte) ([]byte, []byte, *OutboundCallResponse, error) {
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		return raw.Call(ctx, client, relay.PeerInfo().HostPort, service, operation, arg2, arg3)
+	}
+
+	// Large arguments are fragmented in both directions.
+	arg2 := bytes.Repeat([]byte("a"), 100000)
+	arg3 := bytes.Repeat([]byte("b"), 200000)
+	gotArg2, gotArg3, _, err := call("svc", "echo", arg2, arg3)
+	require.NoError(t, err, "relayed call failed")
+	assert.Equal(t, arg2, gotArg2, "arg2 mismatch")
+	assert.Equal(t, arg3, gotArg3, "arg3 mismatch")
+
+	_, gotArg3, resp, err := call("svc", "fail", nil, nil)
+	require.NoError(t, err, "relayed call failed")
+	assert.True(t, resp.ApplicationError(), "application errors should be relayed")
+	assert.Equal(t, "app error", string(gotArg3), "application error mismatch")
+
+	_, _, _, err = call("svc", "unknown", nil, nil)
+	assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(err), "system errors should be relayed")
+
+	_, _, _, err = call("unreachable", "echo", nil, nil)
+	assert.Equal(t, ErrCodeDeclined, GetSystemErrorCode(err), "unreachable destinations should decline calls")
+
+	_, gotArg3, _, err = call("relay", "local", nil, nil)
+	require.NoError(t, err, "local call failed")
+	assert.Equal(t, "relay", string(gotArg3), "services without a destination should be handled locally")
+
+	assert.EqualValues(t, 4, counterValue(stats, "relay.calls.forwarded"), "forwarded calls mismatch")
+	assert.EqualValues(t, 2, counterValue(stats, "relay.calls.success"), "successful calls mismatch")
+	assert.EqualValues(t, 2, counterValue(stats, "relay.calls.failed"), "failed calls mismatch")
+}
+
+func TestRelayTimeout(t *testing.T) {
+	server, err := NewChannel("svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+	blockCh := make(chan struct{})
+	defer close(blockCh)
+	testutils.RegisterFunc(t, server, "block", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		<-blockCh
+		return &raw.Res{}, nil
+	})
+
+	stats := newRecordingStatsReporter()
+	relay, err := NewChannel("relay", &ChannelOptions{
+		StatsReporter: stats,
+		RelayHosts:    SimpleRelayHosts{"svc": {server.PeerInfo().HostPort}},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, relay.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer relay.Close()
+
+	client, err := NewChannel("client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	ctx, cancel := NewContext(50 * time.Millisecond)
+	defer cancel()
+	_, _, _, err = raw.Call(ctx, client, relay.PeerInfo().HostPort, "svc", "block", nil, nil)
+	assert.Error(t, err, "call should time out")
+
+	for i := 0; i < 50 && counterValue(stats, "relay.calls.timeout") == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.EqualValues(t, 1, counterValue(stats, "relay.calls.timeout"), "relay should time out the call")
+}
+
+// slowRelayHosts delays each lookup to simulate time spent in the relay.
+type slowRelayHosts struct {
+	SimpleRelayHosts
+	delay time.Duration
+}
+
+func (h slowRelayHosts) Get(serviceName string) string {
+	time.Sleep(h.delay)
+	return h.SimpleRelayHosts.Get(serviceName)
+}
+
+func TestRelayForwardsRemainingTimeToLive(t *testing.T) {
+	server, err := NewChannel("svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+	var remaining time.Duration
+	testutils.RegisterFunc(t, server, "deadline", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		deadline, _ := ctx.Deadline()
+		remaining = deadline.Sub(time.Now())
+		return &raw.Res{}, nil
+	})
+
+	relay, err := NewChannel("relay", &ChannelOptions{
+		RelayHosts: slowRelayHosts{
+			SimpleRelayHosts: SimpleRelayHosts{"svc": {server.PeerInfo().HostPort}},
+			delay:            200 * time.Millisecond,
+		},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, relay.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer relay.Close()
+
+	client, err := NewChannel("client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	_, _, _, err = raw.Call(ctx, client, relay.PeerInfo().HostPort, "svc", "deadline", nil, nil)
+	require.NoError(t, err, "relayed call failed")
+	assert.True(t, remaining > 0, "destination should receive a deadline")
+	assert.True(t, remaining <= 800*time.Millisecond, "TTL should exclude time spent in the relay, got %v", remaining)
+}
+
+func TestRelayDestinationLost(t *testing.T) {
+	// The server closes its connection instead of writing the response.
+	server, err := NewChannel("svc", &ChannelOptions{Faults: &FaultOptions{CloseRate: 1}})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{}, nil
+	})
+
+	stats := newRecordingStatsReporter()
+	relay, err := NewChannel("relay", &ChannelOptions{
+		StatsReporter: stats,
+		RelayHosts:    SimpleRelayHosts{"svc": {server.PeerInfo().HostPort}},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, relay.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer relay.Close()
+
+	client, err := NewChannel("client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	_, _, _, err = raw.Call(ctx, client, relay.PeerInfo().HostPort, "svc", "echo", nil, nil)
+	assert.Equal(t, ErrCodeNetwork, GetSystemErrorCode(err),
+		"call should fail when the destination connection is lost, got %v", err)
+	assert.EqualValues(t, 1, counterValue(stats, "relay.calls.failed"), "failed calls mismatch")
+}
+
+func TestRelayRejectsInboundChecks(t *testing.T) {
+	hosts := SimpleRelayHosts{"svc": {"127.0.0.1:1"}}
+	tests := []struct {
+		opts *ChannelOptions
+		msg  string
+	}{
+		{
+			opts: &ChannelOptions{RelayHosts: hosts},
+		},
+		{
+			opts: &ChannelOptions{RelayHosts: hosts, PayloadSigning: &PayloadSigningOptions{Key: []byte("k")}},
+		},
+		{
+			opts: &ChannelOptions{RelayHosts: hosts, Quotas: &QuotaOptions{}},
+			msg:  "Quotas",
+		},
+		{
+			opts: &ChannelOptions{
+				RelayHosts:         hosts,
+				ConcurrencyLimiter: &ConcurrencyLimiterOptions{},
+				PayloadSigning:     &PayloadSigningOptions{Key: []byte("k"), Required: true},
+			},
+			msg: "PayloadSigning.Required, ConcurrencyLimiter",
+		},
+	}
+
+	for _, tt := range tests {
+		ch, err := NewChannel("relay", tt.opts)
+		if tt.msg == "" {
+			if assert.NoError(t, err, "NewChannel failed") {
+				ch.Close()
+			}
+			continue
+		}
+		if assert.Error(t, err, "NewChannel should fail with %v", tt.msg) {
+			assert.Contains(t, err.Error(), tt.msg, "error should list the conflicting options")
+		}
+	}
+}
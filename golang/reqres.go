@@ -23,6 +23,7 @@ package tchannel
 import (
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/uber/tchannel/golang/typed"
 )
@@ -72,6 +73,8 @@ type reqResWriter struct {
 	mex                *messageExchange
 	state              reqResWriterState
 	messageForFragment messageForFragment
+	statsRecorder      *callStatsRecorder
+	completion         *callCompletion
 	log                Logger
 	err                error
 }
@@ -140,9 +143,33 @@ func (w *reqResWriter) flushFragment(fragment *writableFragment) error {
 
 	frame := fragment.frame.(*Frame)
 	frame.Header.SetPayloadSize(uint16(fragment.contents.BytesWritten()))
+	if w.mex.flow != nil && isContinuation(frame) {
+		if err := w.mex.waitForCredit(); err != nil {
+			return w.failed(err)
+		}
+	}
+	w.statsRecorder.addSentBytes(frame.Header.PayloadSize())
+	select {
+	case w.conn.sendCh <- frame:
+		return nil
+	default:
+	}
+
+	// The send buffer is full, so we need to wait till there is space.
+	defer profileSendBlocked()()
+	var stallC <-chan time.Time
+	if w.mex.stallTimeout > 0 {
+		timer := time.NewTimer(w.mex.stallTimeout)
+		defer timer.Stop()
+		stallC = timer.C
+	}
 	select {
 	case <-w.mex.ctx.Done():
 		return w.failed(w.mex.ctx.Err())
+	case <-stallC:
+		return w.failed(ErrStreamStalled)
+	case <-w.mex.lost:
+		return w.failed(errConnectionLost)
 	case w.conn.sendCh <- frame:
 		return nil
 	}
@@ -156,6 +183,8 @@ func (w *reqResWriter) failed(err error) error {
 	}
 
 	w.mex.shutdown()
+	w.statsRecorder.recordError(err)
+	w.completion.failed(err)
 	w.err = err
 	return w.err
 }
@@ -177,6 +206,8 @@ type reqResReader struct {
 	state              reqResReaderState
 	messageForFragment messageForFragment
 	initialFragment    *readableFragment
+	statsRecorder      *callStatsRecorder
+	completion         *callCompletion
 	log                Logger
 	err                error
 }
@@ -222,10 +253,11 @@ func (r *reqResReader) recvNextFragment(initial bool) (*readableFragment, error)
 
 	// Wait for the appropriate message from the peer
 	message := r.messageForFragment(initial)
-	frame, err := r.mex.recvPeerFrameOfType(message.messageType())
+	frame, err := r.mex.recvPeerFrameOfType(message.messageType(), !initial)
 	if err != nil {
 		return nil, r.failed(err)
 	}
+	r.statsRecorder.addRecvBytes(frame.Header.PayloadSize())
 
 	// Parse the message and setup the fragment
 	fragment, err := parseInboundFragment(r.mex.framePool, frame, message)
@@ -244,6 +276,8 @@ func (r *reqResReader) failed(err error) error {
 	}
 
 	r.mex.shutdown()
+	r.statsRecorder.recordError(err)
+	r.completion.failed(err)
 	r.err = err
 	return r.err
 }
@@ -0,0 +1,101 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// RequestIDHeader is the application header used to propagate request IDs between services.
+const RequestIDHeader = "x-request-id"
+
+var requestIDRng = NewRand(time.Now().UnixNano())
+
+// newRequestID generates a random request ID.
+func newRequestID() string {
+	return fmt.Sprintf("%016x", requestIDRng.Int63())
+}
+
+func (p *tchannelCtxParams) getRequestID() string {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+	return p.requestID
+}
+
+func (p *tchannelCtxParams) setRequestID(requestID string) {
+	p.mut.Lock()
+	p.requestID = requestID
+	p.mut.Unlock()
+}
+
+// CurrentRequestID returns the request ID associated with the context, or "" if there is none.
+// Inbound calls are assigned a request ID, either propagated from the caller or newly generated,
+// which can be used to correlate application logs with the call.
+func CurrentRequestID(ctx context.Context) string {
+	if params := getTChannelParams(ctx); params != nil {
+		return params.getRequestID()
+	}
+	return ""
+}
+
+// InjectRequestID returns the application headers to send on an outbound call, adding
+// the request ID from the context if there is one. The given headers are not modified.
+func InjectRequestID(ctx context.Context, headers map[string]string) map[string]string {
+	requestID := CurrentRequestID(ctx)
+	if requestID == "" {
+		return headers
+	}
+	if _, ok := headers[RequestIDHeader]; ok {
+		return headers
+	}
+
+	withID := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		withID[k] = v
+	}
+	withID[RequestIDHeader] = requestID
+	return withID
+}
+
+// ExtractRequestID should be called with the application headers of an inbound call. If the
+// caller propagated a request ID, it is used as the context's request ID. The headers are
+// returned without the request ID header, and the given headers are not modified.
+func ExtractRequestID(ctx context.Context, headers map[string]string) map[string]string {
+	requestID, ok := headers[RequestIDHeader]
+	if !ok {
+		return headers
+	}
+
+	if params := getTChannelParams(ctx); params != nil && requestID != "" {
+		params.setRequestID(requestID)
+	}
+
+	withoutID := make(map[string]string, len(headers)-1)
+	for k, v := range headers {
+		if k != RequestIDHeader {
+			withoutID[k] = v
+		}
+	}
+	return withoutID
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestRequestIDGenerated(t *testing.T) {
+	WithVerifiedServer(t, nil, func(ch *Channel, hostPort string) {
+		var requestIDs []string
+		testutils.RegisterFunc(t, ch, "id", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			requestIDs = append(requestIDs, CurrentRequestID(ctx))
+			return &raw.Res{}, nil
+		})
+		testutils.RegisterFunc(t, ch, "fail", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			return &raw.Res{SystemErr: errors.New("failed")}, nil
+		})
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		assert.Equal(t, "", CurrentRequestID(ctx), "outbound root contexts should not have a request ID")
+
+		for i := 0; i < 2; i++ {
+			_, _, _, err := raw.Call(ctx, ch, hostPort, ch.PeerInfo().ServiceName, "id", nil, nil)
+			require.NoError(t, err, "Call failed")
+		}
+		require.Equal(t, 2, len(requestIDs), "handler should be called twice")
+		assert.NotEqual(t, "", requestIDs[0], "inbound calls should be assigned a request ID")
+		assert.NotEqual(t, requestIDs[0], requestIDs[1], "each call should have a unique request ID")
+
+		_, _, _, err := raw.Call(ctx, ch, hostPort, ch.PeerInfo().ServiceName, "fail", nil, nil)
+		assert.True(t, errors.Is(err, NewSystemError(ErrCodeUnexpected, "failed")),
+			"system error should only have the request ID added, got %v", err)
+	})
+}
+
+func TestRequestIDInSystemError(t *testing.T) {
+	var logs SyncBuffer
+	ch, err := NewChannel("request-id", &ChannelOptions{
+		Logger: NewLevelLogger(NewLogger(&logs), LogLevelInfo),
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+	require.NoError(t, ch.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+
+	requestIDs := make(chan string, 1)
+	testutils.RegisterFunc(t, ch, "fail", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		requestIDs <- CurrentRequestID(ctx)
+		return &raw.Res{SystemErr: errors.New("failed")}, nil
+	})
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	_, _, _, err = raw.Call(ctx, ch, ch.PeerInfo().HostPort, "request-id", "fail", nil, nil)
+	require.Error(t, err, "Call should fail")
+	requestID := <-requestIDs
+	require.NotEqual(t, "", requestID, "inbound calls should be assigned a request ID")
+	assert.Contains(t, logs.String(), "{requestID "+requestID+"}", "system error should be logged with the request ID")
+
+	se, ok := err.(SystemError)
+	require.True(t, ok, "expected a SystemError, got %T", err)
+	assert.Equal(t, requestID, se.RequestID(), "error should have the server's request ID")
+	assert.Equal(t, "failed (request ID "+requestID+")", err.Error(), "error message should include the request ID")
+	assert.Equal(t, ErrCodeUnexpected, se.Code(), "unexpected error code")
+}
+
+func TestRequestIDHeaders(t *testing.T) {
+	ctx, cancel := NewContextBuilder(time.Second).SetRequestID("req-1").Build()
+	defer cancel()
+	assert.Equal(t, "req-1", CurrentRequestID(ctx))
+
+	headers := map[string]string{"k": "v"}
+	injected := InjectRequestID(ctx, headers)
+	assert.Equal(t, map[string]string{"k": "v", RequestIDHeader: "req-1"}, injected)
+	assert.Equal(t, map[string]string{"k": "v"}, headers, "headers should not be modified")
+
+	existing := map[string]string{RequestIDHeader: "req-0"}
+	assert.Equal(t, existing, InjectRequestID(ctx, existing), "existing request ID should not be replaced")
+
+	noIDCtx, cancel := NewContext(time.Second)
+	defer cancel()
+	assert.Equal(t, headers, InjectRequestID(noIDCtx, headers), "no request ID to inject")
+
+	extracted := ExtractRequestID(ctx, map[string]string{"k": "v", RequestIDHeader: "req-2"})
+	assert.Equal(t, map[string]string{"k": "v"}, extracted, "request ID header should be removed")
+	assert.Equal(t, "req-2", CurrentRequestID(ctx), "request ID should be taken from the headers")
+	assert.Nil(t, ExtractRequestID(ctx, nil), "nil headers should be unchanged")
+}
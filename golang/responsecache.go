@@ -0,0 +1,245 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+const defaultCacheMaxEntries = 1000
+
+// ResponseCacheOptions configure a client-side cache of responses for idempotent
+// operations, such as configuration or metadata lookups. Responses are cached by
+// operation and a hash of the call's arguments, and only successful responses are cached.
+type ResponseCacheOptions struct {
+	// Operations maps each cacheable operation to how long its responses are cached.
+	// Responses for other operations are not cached.
+	Operations map[string]time.Duration
+
+	// MaxEntries is the maximum number of cached responses. Defaults to 1000.
+	MaxEntries int
+
+	// MaxBytes is the maximum total size of the cached response arguments. The size is
+	// not limited if it is zero.
+	MaxBytes int
+}
+
+// responseCacheKey identifies a cached response.
+type responseCacheKey struct {
+	operation string
+	argsHash  [sha256.Size]byte
+}
+
+func newResponseCacheKey(operation string, arg2, arg3 []byte) responseCacheKey {
+	h := sha256.New()
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(arg2)))
+	h.Write(length[:])
+	h.Write(arg2)
+	h.Write(arg3)
+
+	key := responseCacheKey{operation: operation}
+	h.Sum(key.argsHash[:0])
+	return key
+}
+
+type responseCacheEntry struct {
+	key        responseCacheKey
+	arg2, arg3 []byte
+	expires    time.Time
+}
+
+func (e *responseCacheEntry) size() int {
+	return len(e.arg2) + len(e.arg3)
+}
+
+// responseCache is an LRU cache of responses with a TTL for each operation.
+type responseCache struct {
+	opts  ResponseCacheOptions
+	clock Clock
+
+	mut     sync.Mutex
+	entries map[responseCacheKey]*list.Element
+	lru     *list.List
+	bytes   int
+}
+
+func newResponseCache(opts *ResponseCacheOptions, clock Clock) *responseCache {
+	if opts == nil {
+		return nil
+	}
+
+	c := &responseCache{
+		opts:    *opts,
+		clock:   clock,
+		entries: make(map[responseCacheKey]*list.Element),
+		lru:     list.New(),
+	}
+	if c.opts.MaxEntries <= 0 {
+		c.opts.MaxEntries = defaultCacheMaxEntries
+	}
+	return c
+}
+
+// cacheable returns whether responses for the operation are cached.
+func (c *responseCache) cacheable(operation string) bool {
+	return c != nil && c.opts.Operations[operation] > 0
+}
+
+// get returns the cached response for the key, if it has not expired.
+func (c *responseCache) get(key responseCacheKey) (arg2, arg3 []byte, ok bool) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, nil, false
+	}
+	entry := elem.Value.(*responseCacheEntry)
+	if !c.clock.Now().Before(entry.expires) {
+		c.remove(elem)
+		return nil, nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry.arg2, entry.arg3, true
+}
+
+// set caches a response, evicting the least recently used responses to stay within
+// the cache's limits.
+func (c *responseCache) set(key responseCacheKey, arg2, arg3 []byte) {
+	entry := &responseCacheEntry{
+		key:     key,
+		arg2:    append([]byte(nil), arg2...),
+		arg3:    append([]byte(nil), arg3...),
+		expires: c.clock.Now().Add(c.opts.Operations[key.operation]),
+	}
+	if c.opts.MaxBytes > 0 && entry.size() > c.opts.MaxBytes {
+		return
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.bytes += entry.size()
+
+	for len(c.entries) > c.opts.MaxEntries || (c.opts.MaxBytes > 0 && c.bytes > c.opts.MaxBytes) {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove removes an entry from the cache. mut must be held.
+func (c *responseCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*responseCacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size()
+}
+
+// invalidate removes the cached responses for the operation, or all responses if
+// the operation is empty.
+func (c *responseCache) invalidate(operation string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	for key, elem := range c.entries {
+		if operation == "" || key.operation == operation {
+			c.remove(elem)
+		}
+	}
+}
+
+// invalidateKey removes the cached response for the key.
+func (c *responseCache) invalidateKey(key responseCacheKey) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+}
+
+// SetResponseCache sets the response cache for calls made using the subchannel. The cache
+// is used by helpers such as raw.CallSC, which return a cached response for a cacheable
+// operation without making a call. Any previously cached responses are dropped, and
+// responses are not cached if opts is nil.
+func (c *SubChannel) SetResponseCache(opts *ResponseCacheOptions) {
+	cache := newResponseCache(opts, c.topChannel.clock)
+	c.cacheMut.Lock()
+	c.cache = cache
+	c.cacheMut.Unlock()
+}
+
+func (c *SubChannel) responseCache() *responseCache {
+	c.cacheMut.RLock()
+	defer c.cacheMut.RUnlock()
+	return c.cache
+}
+
+// CachedResponse returns the cached response for a call to the operation with the given
+// arguments. ok is false if the operation is not cacheable, or there is no cached response.
+func (c *SubChannel) CachedResponse(operation string, arg2, arg3 []byte) (respArg2, respArg3 []byte, ok bool) {
+	cache := c.responseCache()
+	if !cache.cacheable(operation) {
+		return nil, nil, false
+	}
+
+	tags := c.StatsTags()
+	tags["target-endpoint"] = operation
+	respArg2, respArg3, ok = cache.get(newResponseCacheKey(operation, arg2, arg3))
+	if ok {
+		c.statsReporter.IncCounter("outbound.calls.cache-hit", tags, 1)
+	} else {
+		c.statsReporter.IncCounter("outbound.calls.cache-miss", tags, 1)
+	}
+	return respArg2, respArg3, ok
+}
+
+// CacheResponse caches the successful response for a call to the operation with the given
+// arguments, if the operation is cacheable.
+func (c *SubChannel) CacheResponse(operation string, arg2, arg3, respArg2, respArg3 []byte) {
+	cache := c.responseCache()
+	if !cache.cacheable(operation) {
+		return
+	}
+	cache.set(newResponseCacheKey(operation, arg2, arg3), respArg2, respArg3)
+}
+
+// InvalidateResponses removes the cached responses for the operation, such as after a call
+// that changes the data it returns. All cached responses are removed if operation is empty.
+func (c *SubChannel) InvalidateResponses(operation string) {
+	if cache := c.responseCache(); cache != nil {
+		cache.invalidate(operation)
+	}
+}
+
+// InvalidateResponse removes the cached response for a call to the operation with the
+// given arguments.
+func (c *SubChannel) InvalidateResponse(operation string, arg2, arg3 []byte) {
+	if cache := c.responseCache(); cache != nil {
+		cache.invalidateKey(newResponseCacheKey(operation, arg2, arg3))
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestResponseCache(t *testing.T) {
+	server, err := testutils.NewServer(nil)
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+	serviceName := server.PeerInfo().ServiceName
+
+	var calls int32
+	for _, op := range []string{"get", "put", "fail"} {
+		op := op
+		testutils.RegisterFunc(t, server, op, func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			atomic.AddInt32(&calls, 1)
+			return &raw.Res{Arg3: append([]byte(op+":"), args.Arg3...), IsErr: op == "fail"}, nil
+		})
+	}
+
+	clock := testutils.NewFakeClock(time.Unix(1000, 0))
+	stats := newRecordingStatsReporter()
+	client, err := testutils.NewClient(&testutils.ChannelOpts{Clock: clock, StatsReporter: stats})
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	sc := client.GetSubChannel(serviceName)
+	sc.Peers().Add(server.PeerInfo().HostPort)
+	sc.SetResponseCache(&ResponseCacheOptions{
+		Operations: map[string]time.Duration{"get": time.Minute, "fail": time.Minute},
+		MaxEntries: 2,
+	})
+
+	call := func(op, arg string) (cached bool) {
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		_, arg3, resp, err := raw.CallSC(ctx, sc, op, nil, []byte(arg))
+		require.NoError(t, err, "%v(%v) failed", op, arg)
+		assert.Equal(t, op+":"+arg, string(arg3), "%v(%v) response mismatch", op, arg)
+		return resp == nil
+	}
+
+	tests := []struct {
+		msg        string
+		before     func()
+		op, arg    string
+		wantCached bool
+	}{
+		{msg: "first call", op: "get", arg: "a"},
+		{msg: "cached call", op: "get", arg: "a", wantCached: true},
+		{msg: "different args", op: "get", arg: "b"},
+		{msg: "operation is not cacheable", op: "put", arg: "a"},
+		{msg: "operation is not cacheable again", op: "put", arg: "a"},
+		{msg: "application errors are not cached", op: "fail", arg: "a"},
+		{msg: "application errors are not cached again", op: "fail", arg: "a"},
+		{msg: "expired", before: func() { clock.Advance(time.Minute) }, op: "get", arg: "a"},
+		{msg: "cached after expiry", op: "get", arg: "a", wantCached: true},
+		{msg: "invalidated response", before: func() { sc.InvalidateResponse("get", nil, []byte("a")) }, op: "get", arg: "a"},
+		{msg: "invalidated operation", before: func() { sc.InvalidateResponses("get") }, op: "get", arg: "a"},
+		{msg: "fill the cache", op: "get", arg: "b"},
+		{msg: "evict the least recently used", op: "get", arg: "c"},
+		{msg: "recently used", op: "get", arg: "b", wantCached: true},
+		{msg: "evicted", op: "get", arg: "a"},
+		{msg: "cache disabled", before: func() { sc.SetResponseCache(nil) }, op: "get", arg: "a"},
+	}
+
+	for _, tt := range tests {
+		if tt.before != nil {
+			tt.before()
+		}
+		before := atomic.LoadInt32(&calls)
+		assert.Equal(t, tt.wantCached, call(tt.op, tt.arg), "%v: cached mismatch", tt.msg)
+		if tt.wantCached {
+			assert.Equal(t, before, atomic.LoadInt32(&calls), "%v: cached response should not make a call", tt.msg)
+		} else {
+			assert.Equal(t, before+1, atomic.LoadInt32(&calls), "%v: expected a call", tt.msg)
+		}
+	}
+
+	hits := counterValue(stats, "outbound.calls.cache-hit")
+	assert.Equal(t, int64(3), hits, "cache hits mismatch")
+}
@@ -0,0 +1,310 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// RetryOn represents the types of errors to retry on.
+type RetryOn int
+
+const (
+	// RetryDefault is currently the same as RetryConnectionError.
+	RetryDefault RetryOn = iota
+
+	// RetryConnectionError retries on busy frames, declined frames, and connection errors.
+	RetryConnectionError
+
+	// RetryNever never retries any errors.
+	RetryNever
+
+	// RetryUnexpected will retry busy frames, declined frames, connection errors, and
+	// unexpected errors.
+	RetryUnexpected
+
+	// RetryIdempotent will retry all errors that can be retried. This should be used
+	// for idempotent calls, as calls that timed out may have been processed.
+	RetryIdempotent
+)
+
+var (
+	defaultRetryOptions = &RetryOptions{
+		MaxAttempts: 5,
+		RetryOn:     RetryConnectionError,
+	}
+
+	retryRng = NewRand(time.Now().UnixNano())
+)
+
+const (
+	defaultBackoffBase = 10 * time.Millisecond
+	defaultBackoffMax  = time.Second
+)
+
+// RetryOptions are the retry options used to configure RunWithRetry.
+type RetryOptions struct {
+	// MaxAttempts is the maximum number of calls and retries that will be made.
+	// If this is 0, the default number of attempts (5) is used.
+	MaxAttempts int
+
+	// RetryOn is the types of errors to retry on.
+	RetryOn RetryOn
+
+	// TimeoutPerAttempt is the per-retry timeout to use.
+	// If this is zero, then the original timeout is used.
+	TimeoutPerAttempt time.Duration
+
+	// BackoffBase is the base backoff between attempts. The backoff before each retry is
+	// chosen randomly between zero and BackoffBase * 2^(attempt - 1), capped at BackoffMax.
+	// Defaults to 10 milliseconds.
+	BackoffBase time.Duration
+
+	// BackoffMax is the maximum backoff between attempts. Defaults to 1 second.
+	BackoffMax time.Duration
+}
+
+// RequestState is a global request state that persists across retries.
+type RequestState struct {
+	// Start is the time at which the request was initiated by the caller of RunWithRetry.
+	Start time.Time
+
+	// SelectedPeers is a set of host:ports that have been selected previously. It should
+	// be read using PrevSelectedPeers and updated using AddSelectedPeer.
+	SelectedPeers map[string]struct{}
+
+	// Attempt is 1 for the first attempt, and so on.
+	Attempt int
+
+	retryOpts *RetryOptions
+
+	// mut protects SelectedPeers, as attempts may run concurrently with hedged requests.
+	mut sync.Mutex
+}
+
+// RetriableFunc is the type of function that can be passed to RunWithRetry.
+type RetriableFunc func(context.Context, *RequestState) error
+
+// retryFlags returns the value of the retry flags transport header for the retry policy.
+func (r RetryOn) retryFlags() string {
+	switch r {
+	case RetryNever:
+		return "n"
+	case RetryIdempotent:
+		return "ct"
+	default:
+		return "c"
+	}
+}
+
+func isConnectionError(err error) bool {
+	switch err {
+	case ErrConnectionClosed, ErrConnectionNotReady:
+		return true
+	}
+	// Timeouts, such as context deadlines, also implement net.Error but do not mean
+	// that the connection failed.
+	netErr, isNetErr := err.(net.Error)
+	return isNetErr && !netErr.Timeout()
+}
+
+// CanRetry returns whether an error can be retried for the given retry option.
+func (r RetryOn) CanRetry(err error) bool {
+	if r == RetryNever || IsApplicationError(err) {
+		return false
+	}
+
+	class := ErrorClass(err)
+	if class.Retryable {
+		return true
+	}
+	if r == RetryDefault {
+		r = RetryConnectionError
+	}
+
+	switch class.Code {
+	case ErrCodeUnexpected:
+		return r == RetryUnexpected || r == RetryIdempotent
+	case ErrCodeTimeout:
+		return r == RetryIdempotent
+	}
+	return false
+}
+
+// HasRetries returns whether there's more retries left after the current attempt.
+func (rs *RequestState) HasRetries(err error) bool {
+	if rs == nil {
+		return false
+	}
+	rOpts := rs.retryOpts
+	return rs.Attempt < rOpts.MaxAttempts && rOpts.RetryOn.CanRetry(err)
+}
+
+// PrevSelectedPeers returns a copy of the previously selected peers for this request.
+func (rs *RequestState) PrevSelectedPeers() map[string]struct{} {
+	if rs == nil {
+		return nil
+	}
+
+	rs.mut.Lock()
+	defer rs.mut.Unlock()
+
+	selected := make(map[string]struct{}, len(rs.SelectedPeers))
+	for hostPort := range rs.SelectedPeers {
+		selected[hostPort] = struct{}{}
+	}
+	return selected
+}
+
+// AddSelectedPeer adds a given peer to the set of selected peers.
+func (rs *RequestState) AddSelectedPeer(hostPort string) {
+	if rs == nil {
+		return
+	}
+
+	rs.mut.Lock()
+	if rs.SelectedPeers == nil {
+		rs.SelectedPeers = make(map[string]struct{})
+	}
+	rs.SelectedPeers[hostPort] = struct{}{}
+	rs.mut.Unlock()
+}
+
+// backoff returns the random backoff to use before the next attempt.
+func (rs *RequestState) backoff() time.Duration {
+	base, max := rs.retryOpts.BackoffBase, rs.retryOpts.BackoffMax
+	if base <= 0 {
+		base = defaultBackoffBase
+	}
+	if max <= 0 {
+		max = defaultBackoffMax
+	}
+
+	backoff := base
+	for i := 1; i < rs.Attempt && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return time.Duration(retryRng.Int63n(int64(backoff) + 1))
+}
+
+// RunWithRetry will take a function that makes the TChannel call, and will
+// rerun it as specifed in the RetryOptions in the Context. Each attempt selects
+// a peer that has not been selected by a previous attempt where possible.
+func (ch *Channel) RunWithRetry(runCtx context.Context, f RetriableFunc) error {
+	return ch.runWithRetry(runCtx, nil, nil, f)
+}
+
+// RunWithRetry is the same as Channel.RunWithRetry, but retries are limited by the
+// subchannel's retry budget, if the channel was created with RetryBudget options.
+// If the context does not have RetryOptions, the service's retry policy from the
+// channel's RuntimeOptions is used.
+func (c *SubChannel) RunWithRetry(runCtx context.Context, f RetriableFunc) error {
+	ch := c.topChannel
+	return ch.runWithRetry(runCtx, c.retryBudget, ch.runtimeOptions.retryOptions(c.serviceName), f)
+}
+
+func (ch *Channel) runWithRetry(runCtx context.Context, budget *retryBudget, policy *RetryOptions, f RetriableFunc) error {
+	var err error
+
+	opts := currentRetryOptions(runCtx)
+	if opts == nil {
+		opts = policy
+	}
+	if opts == nil {
+		opts = defaultRetryOptions
+	}
+	if opts.MaxAttempts <= 0 {
+		optsCopy := *opts
+		optsCopy.MaxAttempts = defaultRetryOptions.MaxAttempts
+		opts = &optsCopy
+	}
+
+	rs := &RequestState{
+		Start:     ch.clock.Now(),
+		retryOpts: opts,
+	}
+	budget.recordRequest()
+	for i := 0; i < opts.MaxAttempts; i++ {
+		rs.Attempt++
+
+		if i > 0 {
+			if !budget.tryRetry() {
+				ch.log.Debugf("Not retrying request as the retry budget is exhausted: %v", err)
+				return err
+			}
+			select {
+			case <-ch.clock.After(rs.backoff()):
+			case <-runCtx.Done():
+				return err
+			}
+		}
+
+		err = ch.runAttempt(runCtx, rs, f)
+		if err == nil {
+			return nil
+		}
+		if !opts.RetryOn.CanRetry(err) || runCtx.Err() != nil {
+			return err
+		}
+		ch.log.Debugf("Retrying request after attempt %v failed: %v", rs.Attempt, err)
+	}
+
+	// Too many retries, return the last error
+	return err
+}
+
+// runAttempt runs a single attempt of f using a context that carries the request state.
+func (ch *Channel) runAttempt(runCtx context.Context, rs *RequestState, f RetriableFunc) error {
+	ctx := runCtx
+	if timeout := rs.retryOpts.TimeoutPerAttempt; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	ctx = context.WithValue(ctx, contextKeyRequestState, rs)
+	if headerCtx, ok := runCtx.(ContextWithHeaders); ok {
+		ctx = WrapWithHeaders(ctx, headerCtx.Headers())
+	}
+	return f(ctx, rs)
+}
+
+// currentRetryOptions returns the retry options set in the context, if any.
+func currentRetryOptions(ctx context.Context) *RetryOptions {
+	if params := getTChannelParams(ctx); params != nil {
+		return params.retryOptions
+	}
+	return nil
+}
+
+// currentRequestState returns the request state for the current attempt, if the
+// context was created by RunWithRetry.
+func currentRequestState(ctx context.Context) *RequestState {
+	rs, _ := ctx.Value(contextKeyRequestState).(*RequestState)
+	return rs
+}
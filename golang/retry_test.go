@@ -0,0 +1,190 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel_test
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestCanRetry(t *testing.T) {
+	tests := []struct {
+		err     error
+		retryOn RetryOn
+		want    bool
+	}{
+		{ErrServerBusy, RetryDefault, true},
+		{ErrServerBusy, RetryNever, false},
+		{ErrChannelClosed, RetryConnectionError, true},
+		{ErrConnectionClosed, RetryConnectionError, true},
+		{NewSystemError(ErrCodeNetwork, "network"), RetryConnectionError, true},
+		{NewSystemError(ErrCodeBadRequest, "bad request"), RetryIdempotent, false},
+		{NewSystemError(ErrCodeProtocol, "protocol"), RetryIdempotent, false},
+		{errors.New("unexpected"), RetryConnectionError, false},
+		{errors.New("unexpected"), RetryUnexpected, true},
+		{ErrTimeout, RetryUnexpected, false},
+		{ErrTimeout, RetryIdempotent, true},
+		{context.DeadlineExceeded, RetryIdempotent, true},
+		{context.DeadlineExceeded, RetryConnectionError, false},
+		{context.DeadlineExceeded, RetryDefault, false},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, RetryConnectionError, true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.retryOn.CanRetry(tt.err), "%v.CanRetry(%v) mismatch", tt.retryOn, tt.err)
+	}
+}
+
+// newRetryServer creates a server for "retry-svc" that returns the given error for calls.
+func newRetryServer(t *testing.T, calls *int32, err error) *Channel {
+	ch, chErr := testutils.NewServer(&testutils.ChannelOpts{ServiceName: "retry-svc"})
+	require.NoError(t, chErr, "NewServer failed")
+	testutils.RegisterFunc(t, ch, "op", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		atomic.AddInt32(calls, 1)
+		return &raw.Res{Arg3: args.Arg3, SystemErr: err}, nil
+	})
+	return ch
+}
+
+func retryCall(ctx context.Context, sc *SubChannel) error {
+	call, err := sc.BeginCall(ctx, "op", nil)
+	if err != nil {
+		return err
+	}
+	_, _, _, err = raw.WriteArgs(call, nil, []byte("body"))
+	return err
+}
+
+func TestRunWithRetrySelectsNewPeer(t *testing.T) {
+	var busyCalls, okCalls int32
+	busy := newRetryServer(t, &busyCalls, ErrServerBusy)
+	defer busy.Close()
+	ok := newRetryServer(t, &okCalls, nil)
+	defer ok.Close()
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	sc := client.GetSubChannel("retry-svc")
+	sc.Peers().Add(busy.PeerInfo().HostPort)
+	sc.Peers().Add(ok.PeerInfo().HostPort)
+
+	for i := 0; i < 10; i++ {
+		ctx, cancel := NewContextBuilder(time.Second).
+			SetRetryOptions(&RetryOptions{MaxAttempts: 2, BackoffBase: time.Millisecond}).
+			Build()
+
+		var attempts int
+		err := client.RunWithRetry(ctx, func(ctx context.Context, rs *RequestState) error {
+			attempts = rs.Attempt
+			return retryCall(ctx, sc)
+		})
+		cancel()
+		require.NoError(t, err, "RunWithRetry should retry on the other peer")
+		assert.True(t, attempts <= 2, "unexpected number of attempts: %v", attempts)
+	}
+
+	assert.Equal(t, int32(10), atomic.LoadInt32(&okCalls), "all calls should succeed on the healthy peer")
+	assert.True(t, atomic.LoadInt32(&busyCalls) <= 10, "busy peer should be called at most once per request")
+}
+
+func TestRunWithRetryNonRetryable(t *testing.T) {
+	var calls int32
+	server := newRetryServer(t, &calls, NewSystemError(ErrCodeBadRequest, "bad request"))
+	defer server.Close()
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+	sc := client.GetSubChannel("retry-svc")
+	sc.Peers().Add(server.PeerInfo().HostPort)
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	err = client.RunWithRetry(ctx, func(ctx context.Context, rs *RequestState) error {
+		return retryCall(ctx, sc)
+	})
+	require.Error(t, err, "RunWithRetry should fail")
+	assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(err), "unexpected error code")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "bad requests should not be retried")
+}
+
+func TestRunWithRetryMaxAttempts(t *testing.T) {
+	var calls int32
+	server := newRetryServer(t, &calls, ErrServerBusy)
+	defer server.Close()
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+	sc := client.GetSubChannel("retry-svc")
+	sc.Peers().Add(server.PeerInfo().HostPort)
+
+	ctx, cancel := NewContextBuilder(time.Second).
+		SetRetryOptions(&RetryOptions{MaxAttempts: 3, BackoffBase: time.Millisecond}).
+		Build()
+	defer cancel()
+
+	var selected map[string]struct{}
+	err = client.RunWithRetry(ctx, func(ctx context.Context, rs *RequestState) error {
+		err := retryCall(ctx, sc)
+		selected = rs.PrevSelectedPeers()
+		return err
+	})
+	assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(err), "RunWithRetry should return the last error")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls), "unexpected number of attempts")
+	assert.Equal(t, map[string]struct{}{server.PeerInfo().HostPort: {}}, selected, "selected peers mismatch")
+}
+
+func TestRetryFlagsHeader(t *testing.T) {
+	ch, err := NewChannel("retry-flags", &ChannelOptions{
+		PayloadSampler: &PayloadSamplerOptions{Rate: 1},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+	require.NoError(t, ch.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	testutils.RegisterFunc(t, ch, "op", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{}, nil
+	})
+
+	ctx, cancel := NewContextBuilder(time.Second).
+		SetRetryOptions(&RetryOptions{RetryOn: RetryIdempotent}).
+		Build()
+	defer cancel()
+	_, _, _, err = raw.Call(ctx, ch, ch.PeerInfo().HostPort, "retry-flags", "op", nil, nil)
+	require.NoError(t, err, "Call failed")
+
+	samples := ch.PayloadSamples()
+	require.NotEmpty(t, samples, "expected payload samples")
+	assert.Equal(t, "ct", samples[0].Headers[string(RetryFlags)], "retry flags header mismatch")
+}
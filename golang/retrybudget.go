@@ -0,0 +1,133 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryBudgetRatio     = 0.2
+	defaultRetryBudgetMaxTokens = 10
+)
+
+// RetryBudgetOptions configure a token bucket that limits the number of retries made
+// by RunWithRetry on a subchannel. Each request adds Ratio tokens to the bucket and
+// each retry removes a token, so when a downstream service is failing broadly, the
+// number of retries is capped to a fraction of the normal traffic.
+type RetryBudgetOptions struct {
+	// Ratio is the number of retries allowed per request. Defaults to 0.2.
+	Ratio float64
+
+	// MinRetriesPerSecond is the number of retries per second that are always allowed,
+	// so that services with little traffic can still retry.
+	MinRetriesPerSecond float64
+
+	// MaxTokens is the maximum number of tokens in the bucket, which limits the number of
+	// retries that can be made in a burst. Defaults to 10.
+	MaxTokens float64
+}
+
+// retryBudget is a token bucket used to limit retries.
+type retryBudget struct {
+	statsReporter StatsReporter
+	statsTags     map[string]string
+	clock         Clock
+
+	ratio        float64
+	minPerSecond float64
+	maxTokens    float64
+
+	mut        sync.Mutex
+	tokens     float64
+	lastRefill time.Time
+}
+
+func newRetryBudget(opts *RetryBudgetOptions, statsReporter StatsReporter, statsTags map[string]string, clock Clock) *retryBudget {
+	if opts == nil {
+		return nil
+	}
+
+	b := &retryBudget{
+		statsReporter: statsReporter,
+		statsTags:     statsTags,
+		ratio:         opts.Ratio,
+		minPerSecond:  opts.MinRetriesPerSecond,
+		maxTokens:     opts.MaxTokens,
+		clock:         clock,
+		lastRefill:    clock.Now(),
+	}
+	if b.ratio <= 0 {
+		b.ratio = defaultRetryBudgetRatio
+	}
+	if b.maxTokens <= 0 {
+		b.maxTokens = defaultRetryBudgetMaxTokens
+	}
+	b.tokens = b.maxTokens
+	return b
+}
+
+// addTokens adds tokens to the bucket, up to the maximum. mut must be held.
+func (b *retryBudget) addTokens(tokens float64) {
+	b.tokens += tokens
+	if b.tokens > b.maxTokens {
+		b.tokens = b.maxTokens
+	}
+}
+
+// recordRequest deposits tokens for a new request.
+func (b *retryBudget) recordRequest() {
+	if b == nil {
+		return
+	}
+
+	b.mut.Lock()
+	b.addTokens(b.ratio)
+	b.mut.Unlock()
+}
+
+// tryRetry withdraws a token for a retry, returning false if the budget is exhausted.
+func (b *retryBudget) tryRetry() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mut.Lock()
+	now := b.clock.Now()
+	if b.minPerSecond > 0 {
+		b.addTokens(now.Sub(b.lastRefill).Seconds() * b.minPerSecond)
+	}
+	b.lastRefill = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.mut.Unlock()
+
+	if allowed {
+		b.statsReporter.IncCounter("outbound.retries", b.statsTags, 1)
+	} else {
+		b.statsReporter.IncCounter("outbound.retry-budget.exhausted", b.statsTags, 1)
+	}
+	return allowed
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestRetryBudget(t *testing.T) {
+	var calls int32
+	server := newRetryServer(t, &calls, ErrServerBusy)
+	defer server.Close()
+
+	// The retry budget allows a single retry for every two requests.
+	stats := newRecordingStatsReporter()
+	client, err := NewChannel("retry-client", &ChannelOptions{
+		StatsReporter: stats,
+		RetryBudget:   &RetryBudgetOptions{Ratio: 0.5, MaxTokens: 1},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	sc := client.GetSubChannel("retry-svc")
+	sc.Peers().Add(server.PeerInfo().HostPort)
+
+	runRequest := func() int32 {
+		before := atomic.LoadInt32(&calls)
+		ctx, cancel := NewContextBuilder(time.Second).
+			SetRetryOptions(&RetryOptions{MaxAttempts: 5, BackoffBase: time.Millisecond}).
+			Build()
+		defer cancel()
+
+		err := sc.RunWithRetry(ctx, func(ctx context.Context, rs *RequestState) error {
+			return retryCall(ctx, sc)
+		})
+		assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(err), "unexpected error")
+		return atomic.LoadInt32(&calls) - before
+	}
+
+	// The bucket starts full, so the first request can retry once.
+	assert.Equal(t, int32(2), runRequest(), "first request should be retried once")
+	// The second request only adds half a token, so it cannot be retried.
+	assert.Equal(t, int32(1), runRequest(), "second request should not be retried")
+	// The third request adds another half token, allowing a single retry.
+	assert.Equal(t, int32(2), runRequest(), "third request should be retried once")
+
+	tags := sc.StatsTags()
+	assert.Equal(t, int64(2), stats.getStat("outbound.retries", tags).count, "retries counter mismatch")
+	assert.Equal(t, int64(3), stats.getStat("outbound.retry-budget.exhausted", tags).count,
+		"budget exhausted counter mismatch")
+}
+
+func TestRetryBudgetNotConfigured(t *testing.T) {
+	var calls int32
+	server := newRetryServer(t, &calls, ErrServerBusy)
+	defer server.Close()
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+	sc := client.GetSubChannel("retry-svc")
+	sc.Peers().Add(server.PeerInfo().HostPort)
+
+	ctx, cancel := NewContextBuilder(time.Second).
+		SetRetryOptions(&RetryOptions{MaxAttempts: 3, BackoffBase: time.Millisecond}).
+		Build()
+	defer cancel()
+
+	sc.RunWithRetry(ctx, func(ctx context.Context, rs *RequestState) error {
+		return retryCall(ctx, sc)
+	})
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls), "retries should not be limited without a budget")
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+// routeHandler responds with its name and the operation it was called for.
+type routeHandler struct {
+	t    *testing.T
+	name string
+}
+
+func (h routeHandler) Handle(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+	return &raw.Res{Arg2: []byte(h.name), Arg3: []byte(args.Operation)}, nil
+}
+
+func (h routeHandler) OnError(ctx context.Context, err error) {
+	h.t.Errorf("routeHandler %v OnError: %v", h.name, err)
+}
+
+func TestOperationPatterns(t *testing.T) {
+	WithVerifiedServer(t, nil, func(ch *Channel, hostPort string) {
+		sc := ch.GetSubChannel("routed")
+		sc.Register(raw.Wrap(routeHandler{t, "exact"}), "admin::status")
+		sc.Register(raw.Wrap(routeHandler{t, "admin"}), "admin::*")
+		sc.Register(raw.Wrap(routeHandler{t, "admin-get"}), "admin::get*")
+		sc.Register(raw.Wrap(routeHandler{t, "suffix"}), "*::health")
+		sc.Register(raw.Wrap(routeHandler{t, "all"}), "*")
+
+		tests := []struct {
+			operation string
+			handler   string
+		}{
+			{"admin::status", "exact"},
+			{"admin::restart", "admin"},
+			{"admin::getConfig", "admin-get"},
+			{"admin::", "admin"},
+			{"users::health", "suffix"},
+			// "*::health" has more non-wildcard characters than "admin::*".
+			{"admin::health", "suffix"},
+			{"users::get", "all"},
+		}
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		for _, tt := range tests {
+			arg2, arg3, _, err := raw.Call(ctx, ch, hostPort, "routed", tt.operation, nil, nil)
+			require.NoError(t, err, "Call %v failed", tt.operation)
+			assert.Equal(t, tt.handler, string(arg2), "wrong handler for %v", tt.operation)
+			assert.Equal(t, tt.operation, string(arg3), "wrong operation for %v", tt.operation)
+		}
+	})
+}
+
+func TestNotFoundHandler(t *testing.T) {
+	WithVerifiedServer(t, nil, func(ch *Channel, hostPort string) {
+		sc := ch.GetSubChannel("routed")
+		sc.Register(raw.Wrap(routeHandler{t, "echo"}), "echo")
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		sc.SetNotFoundHandler(raw.Wrap(routeHandler{t, "not-found"}))
+		arg2, _, _, err := raw.Call(ctx, ch, hostPort, "routed", "echo", nil, nil)
+		require.NoError(t, err, "Call failed")
+		assert.Equal(t, "echo", string(arg2), "registered operations should not use the NotFound handler")
+
+		arg2, arg3, _, err := raw.Call(ctx, ch, hostPort, "routed", "unknown", nil, nil)
+		require.NoError(t, err, "Call failed")
+		assert.Equal(t, "not-found", string(arg2), "unknown operations should use the NotFound handler")
+		assert.Equal(t, "unknown", string(arg3))
+	})
+}
+
+func TestNoNotFoundHandler(t *testing.T) {
+	// Calls that fail to find a handler leave frames unreleased, so we do not use a verified server.
+	require.NoError(t, testutils.WithServer(nil, func(ch *Channel, hostPort string) {
+		ch.GetSubChannel("other").SetNotFoundHandler(raw.Wrap(routeHandler{t, "not-found"}))
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		// The NotFound handler is only used for its own service.
+		_, _, _, err := raw.Call(ctx, ch, hostPort, "routed", "unknown", nil, nil)
+		assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(err), "unknown operations should fail")
+	}))
+}
+
+func TestMultipleServices(t *testing.T) {
+	stats := newRecordingStatsReporter()
+	opts := &testutils.ChannelOpts{StatsReporter: stats}
+	// Calls for services that are not served leave frames unreleased, so we do not use a verified server.
+	require.NoError(t, testutils.WithServer(opts, func(ch *Channel, hostPort string) {
+		ch.Register(raw.Wrap(routeHandler{t, "own"}), "op")
+		ch.GetSubChannel("users").Register(raw.Wrap(routeHandler{t, "users"}), "op")
+		ch.GetSubChannel("orders").SetNotFoundHandler(raw.Wrap(routeHandler{t, "orders"}))
+		// Subchannels without handlers are only used for outbound calls.
+		ch.GetSubChannel("downstream")
+
+		assert.Equal(t, []string{"orders", testServiceName, "users"}, ch.ServiceNames(), "ServiceNames mismatch")
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+
+		for _, serviceName := range []string{testServiceName, "users", "orders"} {
+			arg2, _, _, err := raw.Call(ctx, ch, hostPort, serviceName, "op", nil, nil)
+			require.NoError(t, err, "Call to %v failed", serviceName)
+			want := serviceName
+			if serviceName == testServiceName {
+				want = "own"
+			}
+			assert.Equal(t, want, string(arg2), "wrong handler for %v", serviceName)
+		}
+
+		for _, serviceName := range []string{"downstream", "unknown"} {
+			_, _, _, err := raw.Call(ctx, ch, hostPort, serviceName, "op", nil, nil)
+			assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(err), "calls to %v should fail", serviceName)
+			if assert.Error(t, err, "calls to %v should fail", serviceName) {
+				assert.Contains(t, err.Error(), "is not served by", "unexpected error for %v", serviceName)
+			}
+		}
+	}))
+
+	services := make(map[string]bool)
+	for _, tags := range counterTags(stats, "inbound.calls.success") {
+		for _, tag := range strings.Split(tags, ", ") {
+			if strings.HasPrefix(tag, "service = ") {
+				services[strings.TrimPrefix(tag, "service = ")] = true
+			}
+		}
+	}
+	assert.Equal(t, map[string]bool{testServiceName: true, "users": true, "orders": true}, services,
+		"inbound stats should be tagged with the called service")
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// rttSmoothingFactor is the weight given to each new round trip sample, as used by TCP.
+const rttSmoothingFactor = 0.125
+
+// rttEstimator maintains a smoothed round trip time estimate from ping samples.
+type rttEstimator struct {
+	mut      sync.RWMutex
+	smoothed time.Duration
+	samples  int64
+}
+
+// update adds a round trip sample and returns the new smoothed estimate.
+func (e *rttEstimator) update(sample time.Duration) time.Duration {
+	e.mut.Lock()
+	defer e.mut.Unlock()
+
+	if e.samples == 0 {
+		e.smoothed = sample
+	} else {
+		e.smoothed += time.Duration(rttSmoothingFactor * float64(sample-e.smoothed))
+	}
+	e.samples++
+	return e.smoothed
+}
+
+// get returns the smoothed estimate, or 0 if there have been no samples.
+func (e *rttEstimator) get() time.Duration {
+	e.mut.RLock()
+	defer e.mut.RUnlock()
+	return e.smoothed
+}
+
+// RTT returns the smoothed round trip time to the remote peer as measured by pings,
+// or 0 if no pings have completed on this connection.
+func (c *Connection) RTT() time.Duration {
+	return c.rtt.get()
+}
+
+// recordRTT updates the round trip time estimate for the connection with a ping sample.
+func (c *Connection) recordRTT(sample time.Duration) {
+	smoothed := c.rtt.update(sample)
+
+	tags := make(map[string]string, len(c.commonStatsTags)+1)
+	for k, v := range c.commonStatsTags {
+		tags[k] = v
+	}
+	tags["peer"] = c.remotePeerInfo.HostPort
+	c.statsReporter.UpdateGauge("peer.rtt", tags, int64(smoothed/time.Microsecond))
+}
+
+// pingLoop periodically pings the remote peer to measure the round trip time.
+// It exits once the connection is no longer active.
+func (c *Connection) pingLoop() {
+	ticker := c.clock.NewTicker(c.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+		case <-c.pingStop:
+			return
+		}
+
+		if !c.IsActive() {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.pingInterval)
+		if err := c.ping(ctx); err != nil {
+			c.log.Infof("Periodic ping to %v failed: %v", c.remotePeerInfo, err)
+		}
+		cancel()
+	}
+}
+
+// RTT returns the lowest smoothed round trip time across the active connections to
+// this peer, or 0 if the round trip time has not been measured.
+func (p *Peer) RTT() time.Duration {
+	var best time.Duration
+	for _, c := range p.getActive() {
+		if rtt := c.RTT(); rtt > 0 && (best == 0 || rtt < best) {
+			best = rtt
+		}
+	}
+	return best
+}
+
+// lowerRTTPeer returns whichever of the two peers has the lower round trip time.
+// Peers that have not been measured are preferred so that they get measured.
+func lowerRTTPeer(p1, p2 *Peer) *Peer {
+	rtt1, rtt2 := p1.RTT(), p2.RTT()
+	switch {
+	case rtt1 == 0:
+		return p1
+	case rtt2 == 0, rtt2 < rtt1:
+		return p2
+	default:
+		return p1
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+// gaugeStatsReporter records the latest value of each gauge.
+type gaugeStatsReporter struct {
+	sync.Mutex
+	StatsReporter
+
+	gauges map[string]int64
+}
+
+func newGaugeStatsReporter() *gaugeStatsReporter {
+	return &gaugeStatsReporter{
+		StatsReporter: NullStatsReporter,
+		gauges:        make(map[string]int64),
+	}
+}
+
+func (r *gaugeStatsReporter) UpdateGauge(name string, tags map[string]string, value int64) {
+	r.Lock()
+	defer r.Unlock()
+	r.gauges[name+":"+tags["peer"]] = value
+}
+
+func (r *gaugeStatsReporter) getGauge(name, peer string) (int64, bool) {
+	r.Lock()
+	defer r.Unlock()
+	v, ok := r.gauges[name+":"+peer]
+	return v, ok
+}
+
+func TestPingUpdatesRTT(t *testing.T) {
+	WithVerifiedServer(t, nil, func(ch *Channel, hostPort string) {
+		stats := newGaugeStatsReporter()
+		clientCh, err := NewChannel("rtt-client", &ChannelOptions{StatsReporter: stats})
+		require.NoError(t, err, "NewChannel failed")
+		defer clientCh.Close()
+
+		peer := clientCh.Peers().GetOrAdd(hostPort)
+		assert.Equal(t, time.Duration(0), peer.RTT(), "RTT should not be measured before a ping")
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		require.NoError(t, clientCh.Ping(ctx, hostPort), "Ping failed")
+
+		rtt := peer.RTT()
+		assert.True(t, rtt > 0, "RTT should be measured after a ping")
+
+		_, ok := stats.getGauge("peer.rtt", hostPort)
+		assert.True(t, ok, "peer.rtt gauge should be reported")
+
+		state := clientCh.IntrospectState(nil)
+		require.Contains(t, state.Peers, hostPort, "peer missing from introspection")
+		assert.Equal(t, rtt, state.Peers[hostPort].RTT, "introspected peer RTT mismatch")
+		require.Equal(t, 1, len(state.Peers[hostPort].Connections), "expected a single connection")
+		assert.Equal(t, rtt, state.Peers[hostPort].Connections[0].RTT, "introspected connection RTT mismatch")
+	})
+}
+
+func TestPeriodicPing(t *testing.T) {
+	WithVerifiedServer(t, nil, func(ch *Channel, hostPort string) {
+		testutils.RegisterFunc(t, ch, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			return &raw.Res{Arg3: args.Arg3}, nil
+		})
+
+		clientCh, err := NewChannel("rtt-client", &ChannelOptions{
+			DefaultConnectionOptions: ConnectionOptions{PingInterval: 10 * time.Millisecond},
+		})
+		require.NoError(t, err, "NewChannel failed")
+		defer clientCh.Close()
+
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		_, _, _, err = raw.Call(ctx, clientCh, hostPort, ch.PeerInfo().ServiceName, "echo", nil, []byte("body"))
+		require.NoError(t, err, "Call failed")
+
+		peer := clientCh.Peers().GetOrAdd(hostPort)
+		assert.True(t, testutils.WaitFor(time.Second, func() bool {
+			return peer.RTT() > 0
+		}), "RTT should be measured by periodic pings")
+	})
+}
+
+func TestLatencyAwarePeerSelection(t *testing.T) {
+	ch, err := NewChannel("rtt-client", &ChannelOptions{LatencyAwarePeerSelection: true})
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+
+	assert.Nil(t, ch.Peers().Get(), "empty peer list should not return a peer")
+
+	peers := map[*Peer]bool{
+		ch.Peers().Add("1.1.1.1:1"): true,
+		ch.Peers().Add("2.2.2.2:2"): true,
+	}
+	for i := 0; i < 10; i++ {
+		peer := ch.Peers().Get()
+		assert.True(t, peers[peer], "Get returned unexpected peer %v", peer.HostPort())
+	}
+}
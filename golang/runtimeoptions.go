@@ -0,0 +1,250 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+)
+
+var (
+	errConcurrencyLimiterNotEnabled = errors.New("the concurrency limiter is not enabled for this channel")
+	errPayloadSamplerNotEnabled     = errors.New("payload sampling is not enabled for this channel")
+	errInvalidSampleRate            = errors.New("payload sample rate must be between 0 and 1")
+)
+
+// RuntimeOptions are the channel options that can be changed while the channel is
+// running, using UpdateRuntimeOptions. The options are initialized from the
+// ChannelOptions the channel was created with.
+type RuntimeOptions struct {
+	// Timeouts are the default timeouts for each service, see SubChannel.SetTimeouts.
+	Timeouts map[string]TimeoutOptions `json:"timeouts"`
+
+	// Retries are the retry policies used by SubChannel.RunWithRetry for each service,
+	// when the context does not have RetryOptions.
+	Retries map[string]RetryOptions `json:"retries"`
+
+	// MaxConcurrency is the highest the inbound concurrency limit can go. It can only be
+	// changed if the channel was created with ConcurrencyLimiter options.
+	MaxConcurrency int `json:"maxConcurrency"`
+
+	// PayloadSampleRate is the fraction of calls captured by the payload sampler. It can
+	// only be changed if the channel was created with PayloadSampler options.
+	PayloadSampleRate float64 `json:"payloadSampleRate"`
+
+	// Quotas are the per-caller quotas for inbound calls, and DefaultQuotas are the quotas
+	// for other callers. They can only be changed if the channel was created with Quotas.
+	Quotas        map[string][]Quota `json:"quotas"`
+	DefaultQuotas []Quota            `json:"defaultQuotas"`
+}
+
+// copy returns a copy of the options that does not share maps with o.
+func (o RuntimeOptions) copy() RuntimeOptions {
+	timeouts := make(map[string]TimeoutOptions, len(o.Timeouts))
+	for service, t := range o.Timeouts {
+		if t.PerOperation != nil {
+			perOperation := make(map[string]time.Duration, len(t.PerOperation))
+			for op, timeout := range t.PerOperation {
+				perOperation[op] = timeout
+			}
+			t.PerOperation = perOperation
+		}
+		timeouts[service] = t
+	}
+	o.Timeouts = timeouts
+
+	retries := make(map[string]RetryOptions, len(o.Retries))
+	for service, r := range o.Retries {
+		retries[service] = r
+	}
+	o.Retries = retries
+
+	if o.Quotas != nil {
+		quotas := make(map[string][]Quota, len(o.Quotas))
+		for caller, q := range o.Quotas {
+			quotas[caller] = q
+		}
+		o.Quotas = quotas
+	}
+	return o
+}
+
+// RuntimeOptionsWatcher is called with the previous and updated options after the
+// runtime options of a channel change.
+type RuntimeOptionsWatcher func(prev, cur RuntimeOptions)
+
+// runtimeOptionsStore stores a channel's runtime options, applies updates to the
+// channel, and notifies watchers of changes.
+type runtimeOptionsStore struct {
+	ch *Channel
+
+	// updateMut serializes updates, so that watchers see changes in order.
+	updateMut sync.Mutex
+
+	mut           sync.RWMutex // protects the members below.
+	opts          RuntimeOptions
+	watchers      map[int]RuntimeOptionsWatcher
+	nextWatcherID int
+}
+
+func newRuntimeOptionsStore(ch *Channel, opts *ChannelOptions) *runtimeOptionsStore {
+	s := &runtimeOptionsStore{
+		ch:       ch,
+		watchers: make(map[int]RuntimeOptionsWatcher),
+	}
+	if ch.inboundLimiter != nil {
+		s.opts.MaxConcurrency = ch.inboundLimiter.maxLimit()
+	}
+	if ch.payloadSampler != nil {
+		s.opts.PayloadSampleRate = ch.payloadSampler.rate()
+	}
+	if opts.Quotas != nil {
+		s.opts.Quotas = opts.Quotas.Callers
+		s.opts.DefaultQuotas = opts.Quotas.Default
+	}
+	s.opts = s.opts.copy()
+	return s
+}
+
+func (s *runtimeOptionsStore) get() RuntimeOptions {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+	return s.opts.copy()
+}
+
+// retryOptions returns the retry policy for the service, or nil if there is none.
+func (s *runtimeOptionsStore) retryOptions(serviceName string) *RetryOptions {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+
+	if retry, ok := s.opts.Retries[serviceName]; ok {
+		return &retry
+	}
+	return nil
+}
+
+func (s *runtimeOptionsStore) update(f func(opts *RuntimeOptions)) error {
+	s.updateMut.Lock()
+	defer s.updateMut.Unlock()
+
+	prev := s.get()
+	cur := prev.copy()
+	f(&cur)
+	cur = cur.copy()
+
+	if reflect.DeepEqual(prev, cur) {
+		return nil
+	}
+	if err := s.apply(prev, cur); err != nil {
+		return err
+	}
+
+	s.mut.Lock()
+	s.opts = cur
+	watchers := make([]RuntimeOptionsWatcher, 0, len(s.watchers))
+	for _, w := range s.watchers {
+		watchers = append(watchers, w)
+	}
+	s.mut.Unlock()
+
+	for _, w := range watchers {
+		w(prev.copy(), cur.copy())
+	}
+	return nil
+}
+
+// apply validates the updated options and applies them to the channel. If the options
+// are not valid, an error is returned and the channel is not changed.
+func (s *runtimeOptionsStore) apply(prev, cur RuntimeOptions) error {
+	ch := s.ch
+	if cur.MaxConcurrency != prev.MaxConcurrency && ch.inboundLimiter == nil {
+		return errConcurrencyLimiterNotEnabled
+	}
+	if cur.PayloadSampleRate != prev.PayloadSampleRate {
+		if ch.payloadSampler == nil {
+			return errPayloadSamplerNotEnabled
+		}
+		if cur.PayloadSampleRate < 0 || cur.PayloadSampleRate > 1 {
+			return errInvalidSampleRate
+		}
+	}
+	if ch.quotas == nil && (len(cur.Quotas) > 0 || len(cur.DefaultQuotas) > 0) {
+		return errQuotasNotEnabled
+	}
+
+	if ch.inboundLimiter != nil && cur.MaxConcurrency != prev.MaxConcurrency {
+		if err := ch.inboundLimiter.setMaxLimit(cur.MaxConcurrency); err != nil {
+			return err
+		}
+	}
+	if ch.payloadSampler != nil {
+		ch.payloadSampler.setRate(cur.PayloadSampleRate)
+	}
+	if ch.quotas != nil {
+		ch.quotas.update(cur.Quotas, cur.DefaultQuotas)
+	}
+
+	for serviceName := range prev.Timeouts {
+		if _, ok := cur.Timeouts[serviceName]; !ok {
+			ch.GetSubChannel(serviceName).setTimeouts(TimeoutOptions{})
+		}
+	}
+	for serviceName, timeouts := range cur.Timeouts {
+		ch.GetSubChannel(serviceName).setTimeouts(timeouts)
+	}
+	return nil
+}
+
+func (s *runtimeOptionsStore) watch(w RuntimeOptionsWatcher) func() {
+	s.mut.Lock()
+	id := s.nextWatcherID
+	s.nextWatcherID++
+	s.watchers[id] = w
+	s.mut.Unlock()
+
+	return func() {
+		s.mut.Lock()
+		delete(s.watchers, id)
+		s.mut.Unlock()
+	}
+}
+
+// RuntimeOptions returns a copy of the channel's current runtime options.
+func (ch *Channel) RuntimeOptions() RuntimeOptions {
+	return ch.runtimeOptions.get()
+}
+
+// UpdateRuntimeOptions calls f with a copy of the current runtime options, and applies
+// the options as modified by f to the channel. Watchers are notified once the changes
+// have been applied. If the modified options are invalid, an error is returned and the
+// channel is not changed. Updates are serialized, so f and watchers must not call
+// UpdateRuntimeOptions.
+func (ch *Channel) UpdateRuntimeOptions(f func(opts *RuntimeOptions)) error {
+	return ch.runtimeOptions.update(f)
+}
+
+// WatchRuntimeOptions calls w after each change to the channel's runtime options, until
+// the returned function is called.
+func (ch *Channel) WatchRuntimeOptions(w RuntimeOptionsWatcher) (stop func()) {
+	return ch.runtimeOptions.watch(w)
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestRuntimeOptions(t *testing.T) {
+	ch, err := NewChannel("svc", &ChannelOptions{
+		ConcurrencyLimiter: &ConcurrencyLimiterOptions{MinLimit: 5, MaxLimit: 50},
+		PayloadSampler:     &PayloadSamplerOptions{Rate: 0.5},
+		Quotas:             &QuotaOptions{Default: []Quota{{Limit: 10, Period: time.Hour}}},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+
+	opts := ch.RuntimeOptions()
+	assert.Equal(t, 50, opts.MaxConcurrency, "initial max concurrency mismatch")
+	assert.Equal(t, 0.5, opts.PayloadSampleRate, "initial sample rate mismatch")
+	assert.Equal(t, []Quota{{Limit: 10, Period: time.Hour}}, opts.DefaultQuotas, "initial quotas mismatch")
+
+	var changes [][2]RuntimeOptions
+	stop := ch.WatchRuntimeOptions(func(prev, cur RuntimeOptions) {
+		changes = append(changes, [2]RuntimeOptions{prev, cur})
+	})
+
+	require.NoError(t, ch.UpdateRuntimeOptions(func(opts *RuntimeOptions) {
+		opts.MaxConcurrency = 20
+		opts.PayloadSampleRate = 0.1
+	}), "UpdateRuntimeOptions failed")
+	require.Len(t, changes, 1, "watcher should be notified")
+	assert.Equal(t, 0.5, changes[0][0].PayloadSampleRate, "previous options mismatch")
+	assert.Equal(t, 0.1, changes[0][1].PayloadSampleRate, "updated options mismatch")
+	assert.Equal(t, 20, ch.RuntimeOptions().MaxConcurrency, "max concurrency should be updated")
+
+	// Options set through other APIs are stored in the runtime options.
+	ch.GetSubChannel("other").SetTimeouts(TimeoutOptions{Default: time.Second})
+	require.NoError(t, ch.SetQuotas(nil, nil), "SetQuotas failed")
+	require.Len(t, changes, 3, "watcher should be notified of each change")
+	opts = ch.RuntimeOptions()
+	assert.Equal(t, time.Second, opts.Timeouts["other"].Default, "timeouts should be stored")
+	assert.Empty(t, opts.DefaultQuotas, "quotas should be stored")
+
+	require.NoError(t, ch.UpdateRuntimeOptions(func(opts *RuntimeOptions) {}), "UpdateRuntimeOptions failed")
+	assert.Len(t, changes, 3, "watcher should not be notified if nothing changed")
+
+	invalid := []func(opts *RuntimeOptions){
+		func(opts *RuntimeOptions) { opts.PayloadSampleRate = 2 },
+		func(opts *RuntimeOptions) { opts.MaxConcurrency = 1 },
+	}
+	for _, f := range invalid {
+		assert.Error(t, ch.UpdateRuntimeOptions(f), "invalid options should fail")
+	}
+	assert.Equal(t, opts, ch.RuntimeOptions(), "invalid options should not be applied")
+	assert.Len(t, changes, 3, "watcher should not be notified of invalid options")
+
+	stop()
+	ch.GetSubChannel("other").SetTimeouts(TimeoutOptions{})
+	assert.Len(t, changes, 3, "stopped watcher should not be notified")
+}
+
+func TestRuntimeOptionsNotEnabled(t *testing.T) {
+	ch, err := NewChannel("svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+
+	tests := []func(opts *RuntimeOptions){
+		func(opts *RuntimeOptions) { opts.MaxConcurrency = 10 },
+		func(opts *RuntimeOptions) { opts.PayloadSampleRate = 0.1 },
+		func(opts *RuntimeOptions) { opts.DefaultQuotas = []Quota{{Limit: 1, Period: time.Second}} },
+	}
+	for _, f := range tests {
+		assert.Error(t, ch.UpdateRuntimeOptions(f), "options that are not enabled should fail")
+	}
+}
+
+func TestRuntimeRetryPolicy(t *testing.T) {
+	ch, err := NewChannel("svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+	sc := ch.GetSubChannel("other")
+
+	attempts := func(ctx context.Context) int {
+		count := 0
+		sc.RunWithRetry(ctx, func(ctx context.Context, rs *RequestState) error {
+			count++
+			return ErrServerBusy
+		})
+		return count
+	}
+
+	require.NoError(t, ch.UpdateRuntimeOptions(func(opts *RuntimeOptions) {
+		opts.Retries["other"] = RetryOptions{MaxAttempts: 2, BackoffBase: time.Microsecond}
+	}), "UpdateRuntimeOptions failed")
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	assert.Equal(t, 2, attempts(ctx), "subchannel retry policy should be used")
+
+	ctx, cancel = NewContextBuilder(time.Second).
+		SetRetryOptions(&RetryOptions{RetryOn: RetryNever}).
+		Build()
+	defer cancel()
+	assert.Equal(t, 1, attempts(ctx), "context retry options should take precedence")
+}
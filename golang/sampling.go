@@ -0,0 +1,294 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSampleMaxArgSize = 1024
+	defaultSampleCapacity   = 100
+)
+
+// PayloadSamplerOptions configure sampling of call payloads for debugging.
+type PayloadSamplerOptions struct {
+	// Rate is the fraction of calls that are sampled, between 0 and 1.
+	Rate float64
+
+	// MaxArgSize is the maximum number of bytes captured for each argument.
+	// Arguments larger than this are truncated. Defaults to 1024.
+	MaxArgSize int
+
+	// Capacity is the number of samples retained. Once the capacity is reached,
+	// the oldest samples are discarded. Defaults to 100.
+	Capacity int
+
+	// Redact, if set, is called for each sample before it is retained so that
+	// sensitive information can be removed or masked. It is called after the
+	// channel's Redaction options are applied.
+	Redact func(sample *PayloadSample)
+}
+
+// PayloadSample is a captured call, containing the transport headers and the
+// (possibly truncated) arguments of the call.
+type PayloadSample struct {
+	// Direction is either "inbound" or "outbound".
+	Direction string `json:"direction"`
+
+	Service   string    `json:"service"`
+	Operation string    `json:"operation"`
+	Peer      PeerInfo  `json:"peer"`
+	StartedAt time.Time `json:"startedAt"`
+
+	// Headers are the transport headers of the call request.
+	Headers map[string]string `json:"headers"`
+
+	RequestArg2  []byte `json:"requestArg2"`
+	RequestArg3  []byte `json:"requestArg3"`
+	ResponseArg2 []byte `json:"responseArg2"`
+	ResponseArg3 []byte `json:"responseArg3"`
+
+	// Truncated is set if any of the arguments were truncated.
+	Truncated bool `json:"truncated"`
+
+	// Outcome is "success", "app-error", or the system error type if the call failed.
+	Outcome string        `json:"outcome"`
+	Latency time.Duration `json:"latency"`
+}
+
+// payloadSampler decides which calls to sample, and retains the latest samples in a ring buffer.
+type payloadSampler struct {
+	opts      PayloadSamplerOptions
+	redaction *RedactionOptions
+	rng       *rand.Rand
+
+	mut     sync.Mutex
+	samples []PayloadSample
+	next    int
+}
+
+func newPayloadSampler(opts *PayloadSamplerOptions, redaction *RedactionOptions) *payloadSampler {
+	if opts == nil || opts.Rate <= 0 {
+		return nil
+	}
+
+	s := &payloadSampler{
+		opts:      *opts,
+		redaction: redaction,
+		rng:       NewRand(time.Now().UnixNano()),
+	}
+	if s.opts.MaxArgSize <= 0 {
+		s.opts.MaxArgSize = defaultSampleMaxArgSize
+	}
+	if s.opts.Capacity <= 0 {
+		s.opts.Capacity = defaultSampleCapacity
+	}
+	return s
+}
+
+// rate returns the fraction of calls that are sampled.
+func (s *payloadSampler) rate() float64 {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	return s.opts.Rate
+}
+
+// setRate changes the fraction of calls that are sampled.
+func (s *payloadSampler) setRate(rate float64) {
+	s.mut.Lock()
+	s.opts.Rate = rate
+	s.mut.Unlock()
+}
+
+// sample returns a callSample if the call should be sampled, or nil otherwise.
+func (s *payloadSampler) sample(direction, service string, peer PeerInfo, headers transportHeaders) *callSample {
+	if s == nil || s.rng.Float64() >= s.rate() {
+		return nil
+	}
+
+	format := Format(headers[ArgScheme])
+	return &callSample{
+		sampler: s,
+		sample: PayloadSample{
+			Direction: direction,
+			Service:   service,
+			Peer:      peer,
+			StartedAt: timeNow(),
+			Headers:   s.redaction.redactHeaders(headers),
+		},
+		format: format,
+	}
+}
+
+// add adds a completed sample to the ring buffer.
+func (s *payloadSampler) add(sample PayloadSample, format Format) {
+	sample.RequestArg2, sample.RequestArg3 = s.redaction.redactArgs(format, sample.RequestArg2, sample.RequestArg3)
+	sample.ResponseArg2, sample.ResponseArg3 = s.redaction.redactArgs(format, sample.ResponseArg2, sample.ResponseArg3)
+	if s.opts.Redact != nil {
+		s.opts.Redact(&sample)
+	}
+
+	s.mut.Lock()
+	if len(s.samples) < s.opts.Capacity {
+		s.samples = append(s.samples, sample)
+	} else {
+		s.samples[s.next] = sample
+	}
+	s.next = (s.next + 1) % s.opts.Capacity
+	s.mut.Unlock()
+}
+
+// snapshot returns the retained samples, from oldest to newest.
+func (s *payloadSampler) snapshot() []PayloadSample {
+	if s == nil {
+		return nil
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	samples := make([]PayloadSample, 0, len(s.samples))
+	if len(s.samples) == s.opts.Capacity {
+		samples = append(samples, s.samples[s.next:]...)
+		samples = append(samples, s.samples[:s.next]...)
+	} else {
+		samples = append(samples, s.samples...)
+	}
+	return samples
+}
+
+// PayloadSamples returns the call samples retained by the payload sampler, from oldest
+// to newest. It returns nil if payload sampling is not enabled for the channel.
+func (ch *Channel) PayloadSamples() []PayloadSample {
+	return ch.payloadSampler.snapshot()
+}
+
+// sampledArg identifies which argument of a call is being captured.
+type sampledArg int
+
+const (
+	sampledRequestArg2 sampledArg = iota
+	sampledRequestArg3
+	sampledResponseArg2
+	sampledResponseArg3
+)
+
+// callSample captures the arguments of a single sampled call.
+type callSample struct {
+	sampler *payloadSampler
+	format  Format
+
+	mut    sync.Mutex
+	sample PayloadSample
+}
+
+func (s *callSample) setOperation(operation string) {
+	if s != nil {
+		s.sample.Operation = operation
+	}
+}
+
+// argBuffer returns the buffer in the sample that holds the given argument.
+func (s *callSample) argBuffer(arg sampledArg) *[]byte {
+	switch arg {
+	case sampledRequestArg2:
+		return &s.sample.RequestArg2
+	case sampledRequestArg3:
+		return &s.sample.RequestArg3
+	case sampledResponseArg2:
+		return &s.sample.ResponseArg2
+	default:
+		return &s.sample.ResponseArg3
+	}
+}
+
+// capture appends p to the given argument, truncating at the maximum argument size.
+func (s *callSample) capture(arg sampledArg, p []byte) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	dst := s.argBuffer(arg)
+	remaining := s.sampler.opts.MaxArgSize - len(*dst)
+	if len(p) > remaining {
+		p = p[:remaining]
+		s.sample.Truncated = true
+	}
+	*dst = append(*dst, p...)
+}
+
+// finish completes the sample with the outcome of the call, and adds it to the sampler.
+func (s *callSample) finish(outcome string, latency time.Duration) {
+	if s == nil {
+		return
+	}
+
+	s.mut.Lock()
+	s.sample.Outcome = outcome
+	s.sample.Latency = latency
+	sample := s.sample
+	s.mut.Unlock()
+
+	s.sampler.add(sample, s.format)
+}
+
+// captureReader wraps the given reader so that data read is captured as the given argument.
+func (s *callSample) captureReader(arg sampledArg, reader io.ReadCloser, err error) (io.ReadCloser, error) {
+	if s == nil || err != nil {
+		return reader, err
+	}
+	return &capturingReader{reader, s, arg}, nil
+}
+
+// captureWriter wraps the given writer so that data written is captured as the given argument.
+func (s *callSample) captureWriter(arg sampledArg, writer ArgWriter, err error) (ArgWriter, error) {
+	if s == nil || err != nil {
+		return writer, err
+	}
+	return &capturingWriter{writer, s, arg}, nil
+}
+
+type capturingReader struct {
+	io.ReadCloser
+	sample *callSample
+	arg    sampledArg
+}
+
+func (r *capturingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.sample.capture(r.arg, p[:n])
+	return n, err
+}
+
+type capturingWriter struct {
+	ArgWriter
+	sample *callSample
+	arg    sampledArg
+}
+
+func (w *capturingWriter) Write(p []byte) (int, error) {
+	n, err := w.ArgWriter.Write(p)
+	w.sample.capture(w.arg, p[:n])
+	return n, err
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func newSamplingServer(t *testing.T, name string, opts *PayloadSamplerOptions) *Channel {
+	ch, err := testutils.NewServer(&testutils.ChannelOpts{
+		ServiceName:    name,
+		PayloadSampler: opts,
+	})
+	require.NoError(t, err, "NewServer failed")
+	return ch
+}
+
+func TestPayloadSampling(t *testing.T) {
+	serverCh := newSamplingServer(t, "sample-server", &PayloadSamplerOptions{Rate: 1, MaxArgSize: 8})
+	defer serverCh.Close()
+	hostPort := serverCh.PeerInfo().HostPort
+
+	testutils.RegisterFunc(t, serverCh, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+
+	clientCh, err := testutils.NewClient(&testutils.ChannelOpts{
+		ServiceName: "sample-client",
+		PayloadSampler: &PayloadSamplerOptions{
+			Rate: 1,
+			Redact: func(sample *PayloadSample) {
+				sample.RequestArg2 = []byte("redacted")
+			},
+		},
+	})
+	require.NoError(t, err, "NewClient failed")
+	defer clientCh.Close()
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+
+	_, _, _, err = raw.Call(ctx, clientCh, hostPort, "sample-server", "echo", []byte("secret"), []byte("a long request body"))
+	require.NoError(t, err, "Call failed")
+
+	clientSamples := clientCh.PayloadSamples()
+	require.Equal(t, 1, len(clientSamples), "expected a single outbound sample")
+	outbound := clientSamples[0]
+	assert.Equal(t, "outbound", outbound.Direction)
+	assert.Equal(t, "sample-server", outbound.Service)
+	assert.Equal(t, "echo", outbound.Operation)
+	assert.Equal(t, hostPort, outbound.Peer.HostPort)
+	assert.Equal(t, "success", outbound.Outcome)
+	assert.Equal(t, []byte("redacted"), outbound.RequestArg2, "request arg2 should be redacted")
+	assert.Equal(t, []byte("a long request body"), outbound.RequestArg3)
+	assert.Equal(t, []byte("a long request body"), outbound.ResponseArg3)
+	assert.False(t, outbound.Truncated, "outbound sample should not be truncated")
+
+	require.True(t, testutils.WaitFor(time.Second, func() bool {
+		return len(serverCh.PayloadSamples()) == 1
+	}), "expected a single inbound sample")
+	inbound := serverCh.PayloadSamples()[0]
+	assert.Equal(t, "inbound", inbound.Direction)
+	assert.Equal(t, "echo", inbound.Operation)
+	assert.Equal(t, []byte("secret"), inbound.RequestArg2)
+	assert.Equal(t, []byte("a long r"), inbound.RequestArg3, "request arg3 should be truncated")
+	assert.Equal(t, []byte("a long r"), inbound.ResponseArg3, "response arg3 should be truncated")
+	assert.True(t, inbound.Truncated, "inbound sample should be truncated")
+}
+
+func TestPayloadSamplingCapacity(t *testing.T) {
+	ch := newSamplingServer(t, "sample-capacity", &PayloadSamplerOptions{Rate: 1, Capacity: 2})
+	defer ch.Close()
+	hostPort := ch.PeerInfo().HostPort
+
+	testutils.RegisterFunc(t, ch, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg3: args.Arg3}, nil
+	})
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+
+	for _, body := range []string{"1", "2", "3"} {
+		_, _, _, err := raw.Call(ctx, ch, hostPort, "sample-capacity", "echo", nil, []byte(body))
+		require.NoError(t, err, "Call failed")
+	}
+
+	// Each call is sampled as both an outbound and an inbound call, so
+	// only the samples for the last call should be retained.
+	require.True(t, testutils.WaitFor(time.Second, func() bool {
+		samples := ch.PayloadSamples()
+		return len(samples) == 2 &&
+			bytes.Equal(samples[0].RequestArg3, []byte("3")) &&
+			bytes.Equal(samples[1].RequestArg3, []byte("3"))
+	}), "expected only the samples for the last call, got %+v", ch.PayloadSamples())
+}
+
+func TestPayloadSamplingDisabled(t *testing.T) {
+	WithVerifiedServer(t, nil, func(ch *Channel, hostPort string) {
+		assert.Nil(t, ch.PayloadSamples(), "samples should be nil when sampling is disabled")
+	})
+}
+
+func TestIntrospectPayloadSamples(t *testing.T) {
+	ch := newSamplingServer(t, "sample-introspect", &PayloadSamplerOptions{Rate: 1})
+	defer ch.Close()
+	hostPort := ch.PeerInfo().HostPort
+
+	testutils.RegisterFunc(t, ch, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg3: args.Arg3}, nil
+	})
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	_, _, _, err := raw.Call(ctx, ch, hostPort, "sample-introspect", "echo", nil, []byte("body"))
+	require.NoError(t, err, "Call failed")
+
+	assert.Empty(t, ch.IntrospectState(&IntrospectionOptions{}).PayloadSamples,
+		"samples should only be included when requested")
+
+	state := ch.IntrospectState(&IntrospectionOptions{IncludePayloadSamples: true})
+	assert.NotEmpty(t, state.PayloadSamples, "expected samples from the call")
+
+	_, err = json.Marshal(state)
+	assert.NoError(t, err, "failed to marshal runtime state")
+}
+
+func TestRedaction(t *testing.T) {
+	var (
+		mut     sync.Mutex
+		audited []AuditRecord
+	)
+	redaction := &RedactionOptions{
+		Headers: func(headers map[string]string) {
+			headers["cn"] = "redacted"
+		},
+		Args: map[Format]ArgRedactor{
+			Raw: func(arg2, arg3 []byte) ([]byte, []byte) {
+				return arg2, bytes.Replace(arg3, []byte("token"), []byte("*****"), -1)
+			},
+		},
+	}
+	serverCh, err := NewChannel("redact-server", &ChannelOptions{
+		PayloadSampler: &PayloadSamplerOptions{Rate: 1},
+		Audit: &AuditOptions{
+			Sink: AuditSinkFunc(func(r AuditRecord) {
+				mut.Lock()
+				audited = append(audited, r)
+				mut.Unlock()
+			}),
+			Operations: map[string][]string{"redact-server": nil},
+		},
+		Redaction: redaction,
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer serverCh.Close()
+	require.NoError(t, serverCh.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+
+	testutils.RegisterFunc(t, serverCh, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	_, arg3, _, err := raw.Call(ctx, client, serverCh.PeerInfo().HostPort, "redact-server", "echo", []byte("h"), []byte("token=abc"))
+	require.NoError(t, err, "Call failed")
+	assert.Equal(t, []byte("token=abc"), arg3, "redaction should not modify the call")
+
+	require.True(t, testutils.WaitFor(time.Second, func() bool {
+		return len(serverCh.PayloadSamples()) == 1
+	}), "expected a single inbound sample")
+	sample := serverCh.PayloadSamples()[0]
+	assert.Equal(t, "redacted", sample.Headers["cn"], "sampled headers should be redacted")
+	assert.Equal(t, []byte("*****=abc"), sample.RequestArg3, "sampled request should be redacted")
+	assert.Equal(t, []byte("*****=abc"), sample.ResponseArg3, "sampled response should be redacted")
+	assert.Equal(t, []byte("h"), sample.RequestArg2, "arg2 should not be redacted")
+
+	require.True(t, testutils.WaitFor(time.Second, func() bool {
+		mut.Lock()
+		defer mut.Unlock()
+		return len(audited) == 1
+	}), "expected a single audit record")
+	mut.Lock()
+	defer mut.Unlock()
+	assert.Equal(t, "redacted", audited[0].Headers["cn"], "audited headers should be redacted")
+	assert.Equal(t, "raw", audited[0].Headers["as"], "other headers should be kept")
+}
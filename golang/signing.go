@@ -0,0 +1,151 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+)
+
+// ErrInvalidSignature is a SystemError indicating that the payload signature of an
+// inbound call is missing or does not match the payload.
+var ErrInvalidSignature = NewSystemError(ErrCodeBadRequest, "invalid payload signature")
+
+var errSignedArgTooLarge = NewSystemError(ErrCodeBadRequest, "signed argument too large")
+
+// defaultMaxSignedArgSize is the default limit on the size of each argument that is
+// buffered to verify a payload signature.
+const defaultMaxSignedArgSize = 4 * 1024 * 1024
+
+// PayloadSigningOptions configure end-to-end signing of call payloads, which protects
+// the arguments of calls from being modified by intermediate routers.
+type PayloadSigningOptions struct {
+	// Key is used to sign the payloads of outbound calls, and to verify the payloads
+	// of inbound calls.
+	Key []byte
+
+	// Required rejects inbound calls that do not have a payload signature. Otherwise,
+	// only calls that have a signature are verified. Only the raw package and callers that
+	// use SignPayload sign calls, so calls made using the json and thrift packages are
+	// rejected if Required is set.
+	Required bool
+
+	// MaxArgSize is the largest arg2 or arg3 that is buffered to verify the signature of
+	// an inbound call. Calls with larger arguments are rejected. Defaults to 4MB.
+	MaxArgSize int
+}
+
+// signPayload returns the signature for the arguments of a call.
+func signPayload(key []byte, serviceName, operation string, arg2, arg3 []byte) string {
+	mac := hmac.New(sha256.New, key)
+	for _, field := range [][]byte{[]byte(serviceName), []byte(operation), arg2, arg3} {
+		writeSignedField(mac, field)
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// writeSignedField writes a length-prefixed field so fields cannot be moved between arguments.
+func writeSignedField(mac hash.Hash, field []byte) {
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(field)))
+	mac.Write(size[:])
+	mac.Write(field)
+}
+
+// SignPayload returns the payload signature for a call with the given arguments, to be
+// sent using CallOptions.PayloadSignature. It returns an empty string if payload signing
+// is not enabled for the channel.
+func (ch *Channel) SignPayload(serviceName, operation string, arg2, arg3 []byte) string {
+	if ch.payloadSigning == nil {
+		return ""
+	}
+	return signPayload(ch.payloadSigning.Key, serviceName, operation, arg2, arg3)
+}
+
+// SignPayload returns the payload signature for a call using the subchannel with the
+// given arguments, to be sent using CallOptions.PayloadSignature.
+func (c *SubChannel) SignPayload(operation string, arg2, arg3 []byte) string {
+	return c.topChannel.SignPayload(c.serviceName, operation, arg2, arg3)
+}
+
+// verifyPayload reads the arguments of an inbound call and verifies them against the call's
+// payload signature. The arguments are buffered so that they can be read by the handler.
+func (c *Connection) verifyPayload(call *InboundCall) error {
+	opts := c.payloadSigning
+	if opts == nil {
+		return nil
+	}
+
+	signature, ok := call.headers[PayloadSignature]
+	if !ok {
+		if opts.Required {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+
+	maxSize := opts.MaxArgSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxSignedArgSize
+	}
+	arg2, err := readSignedArg(call.arg2Reader, maxSize)
+	if err != nil {
+		return err
+	}
+	arg3, err := readSignedArg(call.arg3Reader, maxSize)
+	if err != nil {
+		return err
+	}
+	call.bufferedArgs = [][]byte{arg2, arg3}
+
+	expected := signPayload(opts.Key, call.ServiceName(), string(call.Operation()), arg2, arg3)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// readSignedArg reads an argument that is buffered to verify the call's signature, and
+// fails if the argument is larger than maxSize.
+func readSignedArg(argReader func() (io.ReadCloser, error), maxSize int) ([]byte, error) {
+	reader, err := argReader()
+	if err != nil {
+		return nil, err
+	}
+	arg, err := ioutil.ReadAll(io.LimitReader(reader, int64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(arg) > maxSize {
+		return nil, errSignedArgTooLarge
+	}
+	return arg, reader.Close()
+}
+
+// bufferedArgReader returns a reader for an argument that was buffered before dispatch.
+func bufferedArgReader(arg []byte) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader(arg)), nil
+}
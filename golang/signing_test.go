@@ -0,0 +1,143 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func newSigningClient(t *testing.T, key string) *Channel {
+	opts := &testutils.ChannelOpts{ServiceName: "signing-client"}
+	if key != "" {
+		opts.PayloadSigning = &PayloadSigningOptions{Key: []byte(key)}
+	}
+	client, err := testutils.NewClient(opts)
+	require.NoError(t, err, "NewClient failed")
+	return client
+}
+
+func TestPayloadSigning(t *testing.T) {
+	server, err := testutils.NewServer(&testutils.ChannelOpts{
+		ServiceName:    "signed-svc",
+		PayloadSigning: &PayloadSigningOptions{Key: []byte("key"), Required: true},
+	})
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+	hostPort := server.PeerInfo().HostPort
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+
+	client := newSigningClient(t, "key")
+	defer client.Close()
+	arg2, arg3, _, err := raw.Call(ctx, client, hostPort, "signed-svc", "echo", []byte("headers"), []byte("body"))
+	require.NoError(t, err, "signed call failed")
+	assert.Equal(t, []byte("headers"), arg2, "arg2 mismatch")
+	assert.Equal(t, []byte("body"), arg3, "arg3 mismatch")
+
+	sc := client.GetSubChannel("signed-svc")
+	sc.Peers().Add(hostPort)
+	_, arg3, _, err = raw.CallSC(ctx, sc, "echo", nil, []byte("subchannel"))
+	require.NoError(t, err, "signed subchannel call failed")
+	assert.Equal(t, []byte("subchannel"), arg3, "arg3 mismatch")
+
+	// Arguments that do not match the signature are rejected.
+	call, err := client.BeginCall(ctx, hostPort, "signed-svc", "echo", &CallOptions{
+		PayloadSignature: client.SignPayload("signed-svc", "echo", nil, []byte("original")),
+	})
+	require.NoError(t, err, "BeginCall failed")
+	_, _, _, err = raw.WriteArgs(call, nil, []byte("tampered"))
+	assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(err), "tampered call should be rejected")
+
+	for _, key := range []string{"", "wrong"} {
+		other := newSigningClient(t, key)
+		_, _, _, err := raw.Call(ctx, other, hostPort, "signed-svc", "echo", nil, []byte("body"))
+		assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(err), "call with key %q should be rejected", key)
+		other.Close()
+	}
+}
+
+func TestPayloadSigningOptional(t *testing.T) {
+	server, err := testutils.NewServer(&testutils.ChannelOpts{
+		ServiceName:    "signed-svc",
+		PayloadSigning: &PayloadSigningOptions{Key: []byte("key")},
+	})
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+	hostPort := server.PeerInfo().HostPort
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+
+	unsigned := newSigningClient(t, "")
+	defer unsigned.Close()
+	assert.Equal(t, "", unsigned.SignPayload("signed-svc", "echo", nil, nil), "channels without a key should not sign")
+	_, _, _, err = raw.Call(ctx, unsigned, hostPort, "signed-svc", "echo", nil, []byte("body"))
+	assert.NoError(t, err, "unsigned calls should be allowed")
+
+	wrongKey := newSigningClient(t, "wrong")
+	defer wrongKey.Close()
+	_, _, _, err = raw.Call(ctx, wrongKey, hostPort, "signed-svc", "echo", nil, []byte("body"))
+	assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(err), "calls with an invalid signature should be rejected")
+}
+
+func TestPayloadSigningMaxArgSize(t *testing.T) {
+	server, err := testutils.NewServer(&testutils.ChannelOpts{
+		ServiceName:    "signed-svc",
+		PayloadSigning: &PayloadSigningOptions{Key: []byte("key"), MaxArgSize: 10},
+	})
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+	hostPort := server.PeerInfo().HostPort
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+
+	client := newSigningClient(t, "key")
+	defer client.Close()
+	_, _, _, err = raw.Call(ctx, client, hostPort, "signed-svc", "echo", nil, []byte("0123456789"))
+	assert.NoError(t, err, "arguments up to MaxArgSize should be verified")
+
+	for _, args := range [][2][]byte{
+		{[]byte("0123456789a"), nil},
+		{nil, []byte("0123456789a")},
+	} {
+		_, _, _, err := raw.Call(ctx, client, hostPort, "signed-svc", "echo", args[0], args[1])
+		assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(err), "arguments over MaxArgSize should be rejected")
+	}
+}
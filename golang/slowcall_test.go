@@ -0,0 +1,93 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestSlowCallLogging(t *testing.T) {
+	var serverLogs, clientLogs SyncBuffer
+	serverStats := newRecordingStatsReporter()
+	clientStats := newRecordingStatsReporter()
+
+	serverCh, err := NewChannel("slow-server", &ChannelOptions{
+		Logger:            NewLevelLogger(NewLogger(&serverLogs), LogLevelWarn),
+		StatsReporter:     serverStats,
+		SlowCallThreshold: 50 * time.Millisecond,
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer serverCh.Close()
+	require.NoError(t, serverCh.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	hostPort := serverCh.PeerInfo().HostPort
+
+	testutils.RegisterFunc(t, serverCh, "fast", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg3: args.Arg3}, nil
+	})
+	testutils.RegisterFunc(t, serverCh, "slow", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		time.Sleep(100 * time.Millisecond)
+		return &raw.Res{Arg3: args.Arg3}, nil
+	})
+
+	clientCh, err := NewChannel("slow-client", &ChannelOptions{
+		Logger:            NewLevelLogger(NewLogger(&clientLogs), LogLevelWarn),
+		StatsReporter:     clientStats,
+		SlowCallThreshold: 50 * time.Millisecond,
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer clientCh.Close()
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+
+	_, _, _, err = raw.Call(ctx, clientCh, hostPort, "slow-server", "fast", nil, []byte("body"))
+	require.NoError(t, err, "fast call failed")
+	assert.Equal(t, "", clientLogs.String(), "fast calls should not be logged")
+
+	_, _, _, err = raw.Call(ctx, clientCh, hostPort, "slow-server", "slow", nil, []byte("body"))
+	require.NoError(t, err, "slow call failed")
+
+	clientLog := clientLogs.String()
+	assert.Contains(t, clientLog, "Slow outbound call", "slow outbound call should be logged")
+	assert.Contains(t, clientLog, "{operation slow}", "log should contain the operation")
+	assert.Contains(t, clientLog, "{peer "+hostPort, "log should contain the peer")
+	assert.Contains(t, clientLog, "traceID", "log should contain the trace ID")
+	assert.NotContains(t, clientLog, "{operation fast}", "fast call should not be logged")
+
+	require.True(t, testutils.WaitFor(time.Second, func() bool {
+		return strings.Contains(serverLogs.String(), "Slow inbound call")
+	}), "slow inbound call should be logged")
+
+	clientSlow := clientStats.getStat("outbound.calls.slow", tagsForOutboundCall(serverCh, clientCh, "slow"))
+	assert.Equal(t, int64(1), clientSlow.count, "outbound slow call counter mismatch")
+	serverSlow := serverStats.getStat("inbound.calls.slow", tagsForInboundCall(serverCh, clientCh, "slow"))
+	assert.Equal(t, int64(1), serverSlow.count, "inbound slow call counter mismatch")
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	defaultDependencyWaitTimeout    = 30 * time.Second
+	defaultDependencyRetryInterval  = 500 * time.Millisecond
+	defaultDependencyConnectTimeout = time.Second
+)
+
+// DependencyWaitOptions configure WaitForDependencies.
+type DependencyWaitOptions struct {
+	// Timeout is the longest to wait for the dependencies to have a healthy peer.
+	// Defaults to 30 seconds.
+	Timeout time.Duration
+
+	// RetryInterval is the time between attempts to connect to the peers of a dependency
+	// that does not have a healthy peer. Defaults to 500 milliseconds.
+	RetryInterval time.Duration
+
+	// ConnectTimeout is the timeout for each attempt to connect to a peer. Defaults to 1 second.
+	ConnectTimeout time.Duration
+}
+
+// DependenciesUnavailableError is returned by WaitForDependencies if some dependencies
+// did not have a healthy peer before the timeout.
+type DependenciesUnavailableError struct {
+	// Services are the service names of the dependencies without a healthy peer.
+	Services []string
+}
+
+func (e DependenciesUnavailableError) Error() string {
+	return fmt.Sprintf("no healthy peers for %v", strings.Join(e.Services, ", "))
+}
+
+// WaitForDependencies blocks until each of the dependencies has a healthy peer, which is
+// a peer with an active connection and no open circuits for the dependency's service.
+// Connections are made to the peers of dependencies that do not have a healthy peer.
+//
+// It can be used to delay marking a service as ready, or advertising it to Hyperbahn or
+// service discovery, right after it starts, so that it does not fail calls while its
+// connections to downstream services are being established:
+//
+//	if err := tchannel.WaitForDependencies(ctx, nil, ch.GetSubChannel("db")); err != nil {
+//		log.Printf("starting without dependencies: %v", err)
+//	}
+//	server.SetReady(true)
+//	hyperbahnClient.Advertise()
+//
+// If the timeout passes or ctx is done first, a DependenciesUnavailableError is returned
+// with the dependencies that do not have a healthy peer, and callers should usually
+// continue starting up.
+func WaitForDependencies(ctx context.Context, opts *DependencyWaitOptions, dependencies ...*SubChannel) error {
+	var waitOpts DependencyWaitOptions
+	if opts != nil {
+		waitOpts = *opts
+	}
+	if waitOpts.Timeout <= 0 {
+		waitOpts.Timeout = defaultDependencyWaitTimeout
+	}
+	if waitOpts.RetryInterval <= 0 {
+		waitOpts.RetryInterval = defaultDependencyRetryInterval
+	}
+	if waitOpts.ConnectTimeout <= 0 {
+		waitOpts.ConnectTimeout = defaultDependencyConnectTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, waitOpts.Timeout)
+	defer cancel()
+
+	var (
+		wg          sync.WaitGroup
+		mut         sync.Mutex
+		unavailable []string
+	)
+	for _, sc := range dependencies {
+		wg.Add(1)
+		go func(sc *SubChannel) {
+			defer wg.Done()
+			if !sc.waitForHealthyPeer(ctx, &waitOpts) {
+				mut.Lock()
+				unavailable = append(unavailable, sc.ServiceName())
+				mut.Unlock()
+			}
+		}(sc)
+	}
+	wg.Wait()
+
+	if len(unavailable) > 0 {
+		sort.Strings(unavailable)
+		return DependenciesUnavailableError{Services: unavailable}
+	}
+	return nil
+}
+
+// waitForHealthyPeer connects to the subchannel's peers until one of them is healthy,
+// and returns whether a healthy peer was found before ctx was done.
+func (c *SubChannel) waitForHealthyPeer(ctx context.Context, opts *DependencyWaitOptions) bool {
+	clock := c.topChannel.clock
+	for {
+		if c.connectHealthyPeer(ctx, opts) {
+			return true
+		}
+
+		c.Logger().Debugf("Waiting for a healthy peer for %v", c.ServiceName())
+		select {
+		case <-clock.After(opts.RetryInterval):
+		case <-ctx.Done():
+			c.Logger().Warnf("No healthy peer for %v: %v", c.ServiceName(), ctx.Err())
+			return false
+		}
+	}
+}
+
+// connectHealthyPeer returns whether the subchannel has a healthy peer, connecting to
+// peers without an open circuit until one of the connections succeeds.
+func (c *SubChannel) connectHealthyPeer(ctx context.Context, opts *DependencyWaitOptions) bool {
+	open := c.topChannel.circuitBreakers.openPeers(c.ServiceName())
+
+	var candidates []*Peer
+	for hostPort, p := range c.Peers().Copy() {
+		if _, ok := open[hostPort]; ok {
+			continue
+		}
+		if len(p.getActive()) > 0 {
+			return true
+		}
+		candidates = append(candidates, p)
+	}
+
+	for _, p := range candidates {
+		connectCtx, cancel := context.WithTimeout(ctx, opts.ConnectTimeout)
+		_, err := p.Connect(connectCtx)
+		cancel()
+		if err == nil {
+			return true
+		}
+		c.Logger().Debugf("Failed to connect to %v for %v: %v", p.HostPort(), c.ServiceName(), err)
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func TestWaitForDependencies(t *testing.T) {
+	server, err := NewChannel("server-svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+	hostPort := server.PeerInfo().HostPort
+
+	client, err := NewChannel("client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	opts := &DependencyWaitOptions{Timeout: 50 * time.Millisecond, RetryInterval: 5 * time.Millisecond}
+	err = WaitForDependencies(context.Background(), opts, client.GetSubChannel("server-svc"))
+	assert.Equal(t, DependenciesUnavailableError{Services: []string{"server-svc"}}, err,
+		"dependency without peers should be unavailable")
+
+	// Peers added while waiting are connected to.
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		client.Peers().Add(hostPort)
+	}()
+	opts.Timeout = 2 * time.Second
+	assert.NoError(t, WaitForDependencies(context.Background(), opts, client.GetSubChannel("server-svc")),
+		"dependency should be available once its peer is added")
+
+	state := client.IntrospectState(nil)
+	assert.Len(t, state.Peers[hostPort].Connections, 1, "a connection should be made to the peer")
+}
+
+func TestWaitForDependenciesUnreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Listen failed")
+	unreachable := ln.Addr().String()
+	ln.Close()
+
+	ch, err := NewChannel("client", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+	ch.Peers().Add(unreachable)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = WaitForDependencies(ctx, &DependencyWaitOptions{RetryInterval: 5 * time.Millisecond},
+		ch.GetSubChannel("b"), ch.GetSubChannel("a"))
+	assert.Equal(t, DependenciesUnavailableError{Services: []string{"a", "b"}}, err,
+		"unreachable dependencies should be unavailable")
+	assert.Equal(t, "no healthy peers for a, b", err.Error(), "error message mismatch")
+}
@@ -41,6 +41,45 @@ func (nullStatsReporter) IncCounter(name string, tags map[string]string, value i
 func (nullStatsReporter) UpdateGauge(name string, tags map[string]string, value int64)     {}
 func (nullStatsReporter) RecordTimer(name string, tags map[string]string, d time.Duration) {}
 
+// taggedStatsReporter is a stats reporter that adds tags to all the stats it reports.
+type taggedStatsReporter struct {
+	reporter StatsReporter
+	tags     map[string]string
+}
+
+// newTaggedStatsReporter returns a StatsReporter that reports to reporter, adding a copy of
+// the given tags to every stat. Tags passed when reporting a stat take precedence.
+func newTaggedStatsReporter(reporter StatsReporter, tags map[string]string) StatsReporter {
+	copied := make(map[string]string, len(tags))
+	for k, v := range tags {
+		copied[k] = v
+	}
+	return taggedStatsReporter{reporter: reporter, tags: copied}
+}
+
+func (r taggedStatsReporter) withTags(tags map[string]string) map[string]string {
+	merged := make(map[string]string, len(r.tags)+len(tags))
+	for k, v := range r.tags {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return merged
+}
+
+func (r taggedStatsReporter) IncCounter(name string, tags map[string]string, value int64) {
+	r.reporter.IncCounter(name, r.withTags(tags), value)
+}
+
+func (r taggedStatsReporter) UpdateGauge(name string, tags map[string]string, value int64) {
+	r.reporter.UpdateGauge(name, r.withTags(tags), value)
+}
+
+func (r taggedStatsReporter) RecordTimer(name string, tags map[string]string, d time.Duration) {
+	r.reporter.RecordTimer(name, r.withTags(tags), d)
+}
+
 // SimpleStatsReporter is a stats reporter that reports stats to the log.
 var SimpleStatsReporter StatsReporter = simpleStatsReporter{}
 
@@ -62,6 +62,27 @@ func newRecordingStatsReporter() *recordingStatsReporter {
 	}
 }
 
+// counterValue returns the sum of the counter with the given name across all tags.
+func counterValue(stats *recordingStatsReporter, name string) int64 {
+	stats.Lock()
+	defer stats.Unlock()
+
+	var n int64
+	for _, v := range stats.Values[name] {
+		n += v.count
+	}
+	return n
+}
+
+// counterTags returns the tags that the metric with the given name was reported with,
+// as sorted strings formatted by tagsToString.
+func counterTags(stats *recordingStatsReporter, name string) []string {
+	stats.Lock()
+	defer stats.Unlock()
+
+	return keysMap(stats.Values[name])
+}
+
 // keysMap returns the keys of the given map as a sorted list of strings.
 // If the map is not of the type map[string]* then the function will panic.
 func keysMap(m interface{}) []string {
@@ -105,12 +126,16 @@ func (r *recordingStatsReporter) getStat(name string, tags map[string]string) *s
 
 func (r *recordingStatsReporter) IncCounter(name string, tags map[string]string, value int64) {
 	statVal := r.getStat(name, tags)
+	r.Lock()
 	statVal.count += value
+	r.Unlock()
 }
 
 func (r *recordingStatsReporter) RecordTimer(name string, tags map[string]string, d time.Duration) {
 	statVal := r.getStat(name, tags)
+	r.Lock()
 	statVal.timers = append(statVal.timers, d)
+	r.Unlock()
 }
 
 func (r *recordingStatsReporter) Validate(t *testing.T) {
@@ -0,0 +1,153 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package stream
+
+import (
+	"io"
+	"sync"
+
+	"github.com/uber/tchannel/golang"
+	"golang.org/x/net/context"
+)
+
+// ClientStream is the caller's side of a stream. Send and Recv may be called from
+// different goroutines, but Send (and CloseSend) must not be called concurrently
+// with each other, and neither may Recv.
+//
+// Since both directions share the connection, a caller that sends more than the
+// peer reads must receive concurrently, or the stream will stall until its deadline.
+type ClientStream struct {
+	ctx  context.Context
+	call *tchannel.OutboundCall
+
+	// sendMut serializes sends with CloseSend.
+	sendMut    sync.Mutex
+	writer     tchannel.ArgWriter
+	sendClosed bool
+
+	reader  io.ReadCloser
+	recvErr error
+}
+
+// Begin starts a stream to the given hostPort. The stream ends when both sides have
+// closed their sending side, or when the context's deadline is exceeded.
+func Begin(ctx context.Context, ch *tchannel.Channel, hostPort, serviceName, operation string) (*ClientStream, error) {
+	call, err := ch.BeginCall(ctx, hostPort, serviceName, operation, &tchannel.CallOptions{Format: tchannel.Raw})
+	if err != nil {
+		return nil, err
+	}
+	return newClientStream(ctx, call)
+}
+
+// BeginSC starts a stream using the given subchannel to choose a peer.
+// Streams are not retried, since messages may already have been consumed by the peer.
+func BeginSC(ctx context.Context, sc *tchannel.SubChannel, operation string) (*ClientStream, error) {
+	call, err := sc.BeginCall(ctx, operation, &tchannel.CallOptions{Format: tchannel.Raw})
+	if err != nil {
+		return nil, err
+	}
+	return newClientStream(ctx, call)
+}
+
+func newClientStream(ctx context.Context, call *tchannel.OutboundCall) (*ClientStream, error) {
+	if err := tchannel.NewArgWriter(call.Arg2Writer()).Write(nil); err != nil {
+		return nil, err
+	}
+
+	writer, err := call.Arg3Writer()
+	if err != nil {
+		return nil, err
+	}
+
+	// Flush the call so the handler starts before the first message is sent.
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	return &ClientStream{ctx: ctx, call: call, writer: writer}, nil
+}
+
+// Context returns the context the stream was started with.
+func (s *ClientStream) Context() context.Context {
+	return s.ctx
+}
+
+// Send sends a message to the handler. The message is flushed before Send returns.
+func (s *ClientStream) Send(msg []byte) error {
+	s.sendMut.Lock()
+	defer s.sendMut.Unlock()
+
+	if s.sendClosed {
+		return ErrSendClosed
+	}
+	return writeMessage(s.writer, msg)
+}
+
+// CloseSend closes the sending side of the stream. The handler receives io.EOF once
+// it has received all previously sent messages.
+func (s *ClientStream) CloseSend() error {
+	s.sendMut.Lock()
+	defer s.sendMut.Unlock()
+
+	if s.sendClosed {
+		return nil
+	}
+	s.sendClosed = true
+	return s.writer.Close()
+}
+
+// Recv receives the next message from the handler. It returns io.EOF once the
+// handler has returned and all of its messages have been received. If the handler
+// failed, the error is returned as a tchannel.SystemError.
+func (s *ClientStream) Recv() ([]byte, error) {
+	if s.recvErr != nil {
+		return nil, s.recvErr
+	}
+
+	msg, err := s.recv()
+	if err != nil {
+		s.recvErr = err
+	}
+	return msg, err
+}
+
+func (s *ClientStream) recv() ([]byte, error) {
+	if s.reader == nil {
+		response := s.call.Response()
+		var arg2 []byte
+		if err := tchannel.NewArgReader(response.Arg2Reader()).Read(&arg2); err != nil {
+			return nil, err
+		}
+
+		reader, err := response.Arg3Reader()
+		if err != nil {
+			return nil, err
+		}
+		s.reader = reader
+	}
+
+	msg, err := readMessage(s.reader)
+	if err == io.EOF {
+		if closeErr := s.reader.Close(); closeErr != nil {
+			return nil, closeErr
+		}
+	}
+	return msg, err
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package stream
+
+import (
+	"io"
+
+	"github.com/uber/tchannel/golang"
+	"golang.org/x/net/context"
+)
+
+// Handler is the interface for a stream handler.
+type Handler interface {
+	// Handle is called for each incoming stream. The stream's sending side is closed
+	// when Handle returns. If an error is returned, it is sent to the caller as a
+	// system error, and any messages the caller has not yet received are discarded.
+	Handle(ctx context.Context, stream *ServerStream) error
+	OnError(ctx context.Context, err error)
+}
+
+// ServerStream is the handler's side of a stream. Send and Recv may be called from
+// different goroutines, but each must not be called concurrently with itself.
+type ServerStream struct {
+	call     *tchannel.InboundCall
+	response *tchannel.InboundCallResponse
+	reader   io.ReadCloser
+	writer   tchannel.ArgWriter
+	recvErr  error
+}
+
+// Caller returns the name of the service that started the stream.
+func (s *ServerStream) Caller() string {
+	return s.call.CallerName()
+}
+
+// Operation returns the operation the stream was started for.
+func (s *ServerStream) Operation() string {
+	return string(s.call.Operation())
+}
+
+// Send sends a message to the caller. The message is flushed before Send returns.
+func (s *ServerStream) Send(msg []byte) error {
+	if err := s.startSending(); err != nil {
+		return err
+	}
+	return writeMessage(s.writer, msg)
+}
+
+// Recv receives the next message from the caller. It returns io.EOF once the caller
+// has closed its sending side and all of its messages have been received.
+func (s *ServerStream) Recv() ([]byte, error) {
+	if s.recvErr != nil {
+		return nil, s.recvErr
+	}
+
+	msg, err := readMessage(s.reader)
+	if err == io.EOF {
+		if closeErr := s.reader.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		s.recvErr = err
+	}
+	return msg, err
+}
+
+// startSending writes the response headers the first time the handler sends, so
+// that a handler that fails before sending anything can still return an error.
+func (s *ServerStream) startSending() error {
+	if s.writer != nil {
+		return nil
+	}
+
+	if err := tchannel.NewArgWriter(s.response.Arg2Writer()).Write(nil); err != nil {
+		return err
+	}
+
+	writer, err := s.response.Arg3Writer()
+	if err != nil {
+		return err
+	}
+	s.writer = writer
+	return nil
+}
+
+// closeSend ends the response once the handler has returned.
+func (s *ServerStream) closeSend() error {
+	if err := s.startSending(); err != nil {
+		return err
+	}
+	return s.writer.Close()
+}
+
+// Wrap wraps a Handler as a tchannel.Handler that can be passed to tchannel.Register.
+func Wrap(handler Handler) tchannel.Handler {
+	return WrapWithOptions(handler, nil)
+}
+
+// WrapWithOptions is like Wrap, but applies the given flow control options to each
+// stream, limiting how many of the caller's frames are buffered and failing streams
+// that stall.
+func WrapWithOptions(handler Handler, opts *tchannel.StreamOptions) tchannel.Handler {
+	return tchannel.HandlerFunc(func(ctx context.Context, call *tchannel.InboundCall) {
+		if opts != nil {
+			call.SetStreamOptions(opts)
+		}
+
+		var arg2 []byte
+		if err := tchannel.NewArgReader(call.Arg2Reader()).Read(&arg2); err != nil {
+			handler.OnError(ctx, err)
+			return
+		}
+
+		reader, err := call.Arg3Reader()
+		if err != nil {
+			handler.OnError(ctx, err)
+			return
+		}
+
+		stream := &ServerStream{
+			call:     call,
+			response: call.Response(),
+			reader:   reader,
+		}
+		if err := handler.Handle(ctx, stream); err != nil {
+			if err := stream.response.SendSystemError(err); err != nil {
+				handler.OnError(ctx, err)
+			}
+			return
+		}
+
+		if err := stream.closeSend(); err != nil {
+			handler.OnError(ctx, err)
+		}
+	})
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// Package stream provides bidirectional streaming calls over TChannel.
+//
+// A stream is a single call whose arg3 is written and read incrementally in both
+// directions: the caller keeps sending request messages while it receives response
+// messages, and the handler does the same in reverse. Each message is length-prefixed
+// within arg3 and flushed as soon as it is sent, so message boundaries are preserved
+// regardless of how the argument is fragmented.
+//
+// The deadline of the context used to begin a stream bounds the whole stream, and is
+// propagated to the handler as the call's TTL.
+//
+// A receiver that falls behind applies backpressure to the sender. Flow control is
+// configured using tchannel.StreamOptions: callers set them on the context using
+// ContextBuilder.SetStreamOptions, and handlers are registered using WrapWithOptions.
+//
+// Subscriptions are built on streams: Subscribe sends a single request, and the
+// Publisher registered using WrapPublisher pushes messages until either side ends it.
+package stream
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/uber/tchannel/golang"
+)
+
+// MaxMessageSize is the largest message that can be sent or received on a stream.
+const MaxMessageSize = 64 * 1024 * 1024
+
+const messageHeaderSize = 4
+
+var (
+	// ErrMessageTooLarge is returned when a message larger than MaxMessageSize is sent or received.
+	ErrMessageTooLarge = errors.New("stream message exceeds the maximum message size")
+
+	// ErrTruncatedMessage is returned when the peer ends the stream part way through a message.
+	ErrTruncatedMessage = errors.New("stream ended part way through a message")
+
+	// ErrSendClosed is returned when Send is called after the sending side of the stream is closed.
+	ErrSendClosed = errors.New("stream send side is closed")
+)
+
+// writeMessage writes a length-prefixed message and flushes it to the peer.
+func writeMessage(w tchannel.ArgWriter, msg []byte) error {
+	if len(msg) > MaxMessageSize {
+		return ErrMessageTooLarge
+	}
+
+	var header [messageHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(msg)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// readMessage reads a single length-prefixed message. It returns io.EOF if the
+// peer ended the stream on a message boundary.
+func readMessage(r io.Reader) ([]byte, error) {
+	var header [messageHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, ErrTruncatedMessage
+		}
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > MaxMessageSize {
+		return nil, ErrMessageTooLarge
+	}
+
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrTruncatedMessage
+		}
+		return nil, err
+	}
+	return msg, nil
+}
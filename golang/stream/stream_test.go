@@ -0,0 +1,325 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+type handlerFunc func(ctx context.Context, stream *ServerStream) error
+
+type testHandler struct {
+	t *testing.T
+	f handlerFunc
+}
+
+func (h testHandler) Handle(ctx context.Context, stream *ServerStream) error {
+	return h.f(ctx, stream)
+}
+
+func (h testHandler) OnError(ctx context.Context, err error) {
+	h.t.Errorf("OnError(%v)", err)
+}
+
+// withHandler registers h as the "stream" operation on a server and runs test with
+// a client channel and the server's hostPort.
+func withHandler(t *testing.T, h tchannel.Handler, test func(client *tchannel.Channel, hostPort string)) {
+	testutils.WithTestClientServer(t, nil, func(client, server *tchannel.Channel, hostPort string) {
+		server.Register(h, "stream")
+		test(client, hostPort)
+	})
+}
+
+// withFailingHandler is like withHandler, but does not check for leaks. Streams that
+// fail part way through abandon the fragments they were writing, which the leak checks
+// report as frames that were not released to the frame pool.
+func withFailingHandler(t *testing.T, h tchannel.Handler, test func(client *tchannel.Channel, hostPort string)) {
+	require.NoError(t, testutils.WithServer(nil, func(server *tchannel.Channel, hostPort string) {
+		server.Register(h, "stream")
+
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		test(client, hostPort)
+	}))
+}
+
+func withStream(t *testing.T, f handlerFunc, test func(client *tchannel.Channel, hostPort string)) {
+	withHandler(t, Wrap(testHandler{t, f}), test)
+}
+
+func withFailingStream(t *testing.T, f handlerFunc, test func(client *tchannel.Channel, hostPort string)) {
+	withFailingHandler(t, Wrap(testHandler{t, f}), test)
+}
+
+func echoHandler(ctx context.Context, stream *ServerStream) error {
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func TestStreamInterleaved(t *testing.T) {
+	withStream(t, echoHandler, func(client *tchannel.Channel, hostPort string) {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		defer cancel()
+
+		stream, err := Begin(ctx, client, hostPort, testutils.DefaultServerName, "stream")
+		require.NoError(t, err, "Begin failed")
+
+		// Each message must be echoed before the next is sent, which only works if
+		// both directions of the call are flushed as messages are sent.
+		for i := 0; i < 100; i++ {
+			msg := []byte(fmt.Sprintf("message %v", i))
+			require.NoError(t, stream.Send(msg), "Send failed")
+
+			got, err := stream.Recv()
+			require.NoError(t, err, "Recv failed")
+			assert.Equal(t, msg, got, "Unexpected echo")
+		}
+
+		require.NoError(t, stream.CloseSend(), "CloseSend failed")
+		assert.Equal(t, ErrSendClosed, stream.Send([]byte("late")), "Send after CloseSend should fail")
+
+		_, err = stream.Recv()
+		assert.Equal(t, io.EOF, err, "Recv should return EOF after the handler returns")
+		_, err = stream.Recv()
+		assert.Equal(t, io.EOF, err, "Recv should keep returning EOF")
+	})
+}
+
+func TestStreamConcurrentSendRecv(t *testing.T) {
+	const numMessages = 500
+
+	withStream(t, echoHandler, func(client *tchannel.Channel, hostPort string) {
+		ctx, cancel := tchannel.NewContext(5 * time.Second)
+		defer cancel()
+
+		stream, err := Begin(ctx, client, hostPort, testutils.DefaultServerName, "stream")
+		require.NoError(t, err, "Begin failed")
+
+		// Messages larger than a frame are fragmented, and still received whole.
+		msg := testutils.RandBytes(100 * 1024)
+		sendErr := make(chan error, 1)
+		go func() {
+			for i := 0; i < numMessages; i++ {
+				if err := stream.Send(msg); err != nil {
+					sendErr <- err
+					return
+				}
+			}
+			sendErr <- stream.CloseSend()
+		}()
+
+		received := 0
+		for {
+			got, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err, "Recv failed")
+			require.True(t, bytes.Equal(msg, got), "Unexpected echo")
+			received++
+		}
+		assert.NoError(t, <-sendErr, "Send failed")
+		assert.Equal(t, numMessages, received, "Unexpected number of messages")
+	})
+}
+
+func TestStreamServerSendsFirst(t *testing.T) {
+	handler := func(ctx context.Context, stream *ServerStream) error {
+		assert.Equal(t, "stream", stream.Operation(), "Unexpected operation")
+		if err := stream.Send([]byte(stream.Caller())); err != nil {
+			return err
+		}
+
+		count := 0
+		for {
+			if _, err := stream.Recv(); err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+			count++
+		}
+		return stream.Send([]byte(fmt.Sprint(count)))
+	}
+
+	withStream(t, handler, func(client *tchannel.Channel, hostPort string) {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		defer cancel()
+
+		stream, err := Begin(ctx, client, hostPort, testutils.DefaultServerName, "stream")
+		require.NoError(t, err, "Begin failed")
+
+		got, err := stream.Recv()
+		require.NoError(t, err, "Recv failed")
+		assert.Equal(t, client.PeerInfo().ServiceName, string(got), "Unexpected caller")
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, stream.Send(nil), "Send failed")
+		}
+		require.NoError(t, stream.CloseSend(), "CloseSend failed")
+
+		got, err = stream.Recv()
+		require.NoError(t, err, "Recv failed")
+		assert.Equal(t, "3", string(got), "Unexpected count")
+		_, err = stream.Recv()
+		assert.Equal(t, io.EOF, err, "Expected end of stream")
+	})
+}
+
+func TestStreamHandlerError(t *testing.T) {
+	handler := func(ctx context.Context, stream *ServerStream) error {
+		if err := stream.Send([]byte("first")); err != nil {
+			return err
+		}
+		if _, err := stream.Recv(); err != nil {
+			return err
+		}
+		return errors.New("handler failed")
+	}
+
+	withFailingStream(t, handler, func(client *tchannel.Channel, hostPort string) {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		defer cancel()
+
+		stream, err := Begin(ctx, client, hostPort, testutils.DefaultServerName, "stream")
+		require.NoError(t, err, "Begin failed")
+
+		got, err := stream.Recv()
+		require.NoError(t, err, "Recv failed")
+		assert.Equal(t, "first", string(got), "Unexpected message")
+
+		require.NoError(t, stream.Send([]byte("trigger")), "Send failed")
+		_, err = stream.Recv()
+		require.Error(t, err, "Recv should fail after the handler fails")
+		assert.Equal(t, tchannel.ErrCodeUnexpected, tchannel.GetSystemErrorCode(err), "Unexpected error code")
+		assert.Contains(t, err.Error(), "handler failed", "Error should contain the handler's error")
+	})
+}
+
+func TestStreamDeadline(t *testing.T) {
+	handlerErr := make(chan error, 1)
+	handler := func(ctx context.Context, stream *ServerStream) error {
+		<-ctx.Done()
+		handlerErr <- ctx.Err()
+		return ctx.Err()
+	}
+
+	withFailingStream(t, handler, func(client *tchannel.Channel, hostPort string) {
+		ctx, cancel := tchannel.NewContext(100 * time.Millisecond)
+		defer cancel()
+
+		stream, err := Begin(ctx, client, hostPort, testutils.DefaultServerName, "stream")
+		require.NoError(t, err, "Begin failed")
+
+		// Neither side sends, so the stream should end once its deadline passes, and the
+		// handler's context should carry the same deadline.
+		_, err = stream.Recv()
+		assert.Error(t, err, "Recv should fail after the deadline")
+		select {
+		case err := <-handlerErr:
+			assert.Equal(t, context.DeadlineExceeded, err, "Handler context should exceed its deadline")
+		case <-time.After(time.Second):
+			t.Errorf("Handler context was not done after the deadline")
+		}
+	})
+}
+
+func TestStreamStalled(t *testing.T) {
+	handler := func(ctx context.Context, stream *ServerStream) error {
+		// Frames are only flow controlled once the handler is running, so tell the
+		// caller to start sending, then stop receiving for longer than the stall timeout.
+		if err := stream.Send([]byte("ready")); err != nil {
+			return err
+		}
+		time.Sleep(150 * time.Millisecond)
+		for {
+			if _, err := stream.Recv(); err != nil {
+				return err
+			}
+		}
+	}
+	opts := &tchannel.StreamOptions{MaxBufferedFrames: 1, StallTimeout: 50 * time.Millisecond}
+
+	withFailingHandler(t, WrapWithOptions(testHandler{t, handler}, opts), func(client *tchannel.Channel, hostPort string) {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		defer cancel()
+
+		stream, err := Begin(ctx, client, hostPort, testutils.DefaultServerName, "stream")
+		require.NoError(t, err, "Begin failed")
+		got, err := stream.Recv()
+		require.NoError(t, err, "Recv failed")
+		assert.Equal(t, "ready", string(got), "Unexpected message")
+
+		msg := testutils.RandBytes(64 * 1024)
+		for i := 0; i < 32; i++ {
+			require.NoError(t, stream.Send(msg), "Send failed")
+		}
+		require.NoError(t, stream.CloseSend(), "CloseSend failed")
+
+		_, err = stream.Recv()
+		require.Error(t, err, "Recv should fail once the handler's stream stalls")
+		assert.Equal(t, tchannel.ErrCodeTimeout, tchannel.GetSystemErrorCode(err), "Unexpected error code")
+		assert.Contains(t, err.Error(), "stream stalled", "Unexpected error")
+	})
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		data    []byte
+		want    []byte
+		wantErr error
+	}{
+		{data: nil, wantErr: io.EOF},
+		{data: []byte{0, 0, 0, 0}, want: []byte{}},
+		{data: []byte{0, 0, 0, 2, 'h', 'i'}, want: []byte("hi")},
+		{data: []byte{0, 0}, wantErr: ErrTruncatedMessage},
+		{data: []byte{0, 0, 0, 3, 'h', 'i'}, wantErr: ErrTruncatedMessage},
+		{data: []byte{0xff, 0xff, 0xff, 0xff}, wantErr: ErrMessageTooLarge},
+	}
+
+	for _, tt := range tests {
+		got, err := readMessage(bytes.NewReader(tt.data))
+		assert.Equal(t, tt.wantErr, err, "readMessage(%v) error mismatch", tt.data)
+		assert.Equal(t, tt.want, got, "readMessage(%v) result mismatch", tt.data)
+	}
+}
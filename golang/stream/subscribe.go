@@ -0,0 +1,216 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/uber/tchannel/golang"
+	"golang.org/x/net/context"
+)
+
+// Subscriptions are streams where the subscriber sends a single request message, and
+// the publisher pushes messages until either side ends the subscription. Each pushed
+// message is prefixed with a byte that identifies it as a message, or as the end of
+// the subscription.
+//
+// When the publisher ends a subscription, it sends an end marker and waits for the
+// subscriber to close its sending side before completing the call. When the subscriber
+// cancels, it closes its sending side, which the publisher observes as Done. Both
+// directions of the call are closed in either case.
+const (
+	pushMessage byte = iota
+	pushEnd
+)
+
+var (
+	// ErrCancelled is returned by Subscriber.Send once the subscriber has cancelled.
+	ErrCancelled = errors.New("subscription was cancelled by the subscriber")
+
+	// ErrNoRequest is returned to the subscriber if it closes its sending side
+	// without sending a subscription request.
+	ErrNoRequest = errors.New("subscription request was not sent")
+)
+
+// Subscription is the subscriber's side of a subscription. Next must not be called
+// concurrently with itself, but Cancel may be called at any time.
+type Subscription struct {
+	stream *ClientStream
+}
+
+// Subscribe sends request to the publisher at hostPort and returns the subscription.
+// The subscription lasts until the publisher ends it, it is cancelled, or the
+// context's deadline is exceeded.
+func Subscribe(ctx context.Context, ch *tchannel.Channel, hostPort, serviceName, operation string,
+	request []byte) (*Subscription, error) {
+
+	stream, err := Begin(ctx, ch, hostPort, serviceName, operation)
+	if err != nil {
+		return nil, err
+	}
+	return newSubscription(stream, request)
+}
+
+// SubscribeSC subscribes using the given subchannel to choose a peer.
+func SubscribeSC(ctx context.Context, sc *tchannel.SubChannel, operation string, request []byte) (*Subscription, error) {
+	stream, err := BeginSC(ctx, sc, operation)
+	if err != nil {
+		return nil, err
+	}
+	return newSubscription(stream, request)
+}
+
+func newSubscription(stream *ClientStream, request []byte) (*Subscription, error) {
+	if err := stream.Send(request); err != nil {
+		return nil, err
+	}
+	return &Subscription{stream}, nil
+}
+
+// Next returns the next message pushed by the publisher. It returns io.EOF once the
+// subscription has ended and all pushed messages have been returned.
+func (s *Subscription) Next() ([]byte, error) {
+	for {
+		msg, err := s.stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if len(msg) == 0 {
+			return nil, errors.New("subscription message is missing its type")
+		}
+
+		switch msg[0] {
+		case pushMessage:
+			return msg[1:], nil
+		case pushEnd:
+			// Acknowledge the end of the subscription so the publisher can complete the call.
+			if err := s.stream.CloseSend(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("subscription message has unknown type %v", msg[0])
+		}
+	}
+}
+
+// Cancel asks the publisher to end the subscription. Messages that were pushed before
+// the publisher observed the cancellation are still returned by Next, followed by io.EOF.
+func (s *Subscription) Cancel() error {
+	return s.stream.CloseSend()
+}
+
+// Publisher is the interface for a subscription handler.
+type Publisher interface {
+	// Publish is called for each subscription with the subscriber's request. It pushes
+	// messages using sub.Send, and should return once sub.Done is closed. The subscription
+	// ends when Publish returns. If an error is returned, it is sent to the subscriber
+	// as a system error after any pushed messages.
+	Publish(ctx context.Context, request []byte, sub *Subscriber) error
+	OnError(ctx context.Context, err error)
+}
+
+// Subscriber is the publisher's side of a subscription.
+type Subscriber struct {
+	stream *ServerStream
+
+	// done is closed once the subscriber closes its sending side, or the stream fails.
+	done    chan struct{}
+	doneErr error
+}
+
+// Send pushes a message to the subscriber. Send must not be called concurrently with itself.
+func (s *Subscriber) Send(msg []byte) error {
+	select {
+	case <-s.done:
+		return ErrCancelled
+	default:
+	}
+
+	buf := make([]byte, len(msg)+1)
+	buf[0] = pushMessage
+	copy(buf[1:], msg)
+	return s.stream.Send(buf)
+}
+
+// Done returns a channel that is closed when the subscriber cancels the subscription,
+// or the subscription fails.
+func (s *Subscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+// watch waits for the subscriber to close its sending side.
+func (s *Subscriber) watch() {
+	for {
+		if _, err := s.stream.Recv(); err != nil {
+			s.doneErr = err
+			close(s.done)
+			return
+		}
+	}
+}
+
+type publisherHandler struct {
+	publisher Publisher
+}
+
+func (h publisherHandler) Handle(ctx context.Context, stream *ServerStream) error {
+	request, err := stream.Recv()
+	if err == io.EOF {
+		return ErrNoRequest
+	}
+	if err != nil {
+		return err
+	}
+
+	sub := &Subscriber{stream: stream, done: make(chan struct{})}
+	go sub.watch()
+
+	publishErr := h.publisher.Publish(ctx, request, sub)
+
+	// Wait for both sides to agree that the subscription has ended, so that the
+	// subscriber is no longer sending by the time the call completes.
+	select {
+	case <-sub.done:
+	default:
+		if err := stream.Send([]byte{pushEnd}); err != nil {
+			return err
+		}
+		<-sub.done
+	}
+
+	if publishErr != nil {
+		return publishErr
+	}
+	if sub.doneErr != io.EOF {
+		return sub.doneErr
+	}
+	return nil
+}
+
+func (h publisherHandler) OnError(ctx context.Context, err error) {
+	h.publisher.OnError(ctx, err)
+}
+
+// WrapPublisher wraps a Publisher as a tchannel.Handler that can be passed to tchannel.Register.
+func WrapPublisher(publisher Publisher) tchannel.Handler {
+	return Wrap(publisherHandler{publisher})
+}
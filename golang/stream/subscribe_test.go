@@ -0,0 +1,167 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+type publisherFunc func(ctx context.Context, request []byte, sub *Subscriber) error
+
+type testPublisher struct {
+	t *testing.T
+	f publisherFunc
+}
+
+func (p testPublisher) Publish(ctx context.Context, request []byte, sub *Subscriber) error {
+	return p.f(ctx, request, sub)
+}
+
+func (p testPublisher) OnError(ctx context.Context, err error) {
+	p.t.Errorf("OnError(%v)", err)
+}
+
+func subscribe(t *testing.T, ctx context.Context, client *tchannel.Channel, hostPort string, request string) *Subscription {
+	sub, err := Subscribe(ctx, client, hostPort, testutils.DefaultServerName, "stream", []byte(request))
+	require.NoError(t, err, "Subscribe failed")
+	return sub
+}
+
+func TestSubscribePublisherEnds(t *testing.T) {
+	publisher := func(ctx context.Context, request []byte, sub *Subscriber) error {
+		for i := 0; i < 10; i++ {
+			if err := sub.Send([]byte(fmt.Sprintf("%s %v", request, i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	withHandler(t, WrapPublisher(testPublisher{t, publisher}), func(client *tchannel.Channel, hostPort string) {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		defer cancel()
+
+		sub := subscribe(t, ctx, client, hostPort, "event")
+		for i := 0; i < 10; i++ {
+			msg, err := sub.Next()
+			require.NoError(t, err, "Next failed")
+			assert.Equal(t, fmt.Sprintf("event %v", i), string(msg), "Unexpected message")
+		}
+
+		_, err := sub.Next()
+		assert.Equal(t, io.EOF, err, "Subscription should end once the publisher returns")
+	})
+}
+
+func TestSubscribeCancel(t *testing.T) {
+	sendErr := make(chan error, 1)
+	publisher := func(ctx context.Context, request []byte, sub *Subscriber) error {
+		for {
+			select {
+			case <-sub.Done():
+				sendErr <- sub.Send(request)
+				return nil
+			default:
+			}
+
+			if err := sub.Send(request); err != nil && err != ErrCancelled {
+				return err
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	withHandler(t, WrapPublisher(testPublisher{t, publisher}), func(client *tchannel.Channel, hostPort string) {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		defer cancel()
+
+		sub := subscribe(t, ctx, client, hostPort, "tick")
+		for i := 0; i < 5; i++ {
+			msg, err := sub.Next()
+			require.NoError(t, err, "Next failed")
+			assert.Equal(t, "tick", string(msg), "Unexpected message")
+		}
+
+		require.NoError(t, sub.Cancel(), "Cancel failed")
+		for {
+			msg, err := sub.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err, "Next after Cancel should return pending messages")
+			assert.Equal(t, "tick", string(msg), "Unexpected message")
+		}
+		assert.Equal(t, ErrCancelled, <-sendErr, "Send after the subscriber cancels should fail")
+	})
+}
+
+func TestSubscribePublishError(t *testing.T) {
+	publisher := func(ctx context.Context, request []byte, sub *Subscriber) error {
+		if err := sub.Send([]byte("config")); err != nil {
+			return err
+		}
+		return errors.New("watch failed")
+	}
+
+	withFailingHandler(t, WrapPublisher(testPublisher{t, publisher}), func(client *tchannel.Channel, hostPort string) {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		defer cancel()
+
+		sub := subscribe(t, ctx, client, hostPort, "watch")
+		msg, err := sub.Next()
+		require.NoError(t, err, "Next failed")
+		assert.Equal(t, "config", string(msg), "Unexpected message")
+
+		_, err = sub.Next()
+		require.Error(t, err, "Next should fail after the publisher fails")
+		assert.Equal(t, tchannel.ErrCodeUnexpected, tchannel.GetSystemErrorCode(err), "Unexpected error code")
+		assert.Contains(t, err.Error(), "watch failed", "Error should contain the publisher's error")
+	})
+}
+
+func TestSubscribeWithoutRequest(t *testing.T) {
+	publisher := func(ctx context.Context, request []byte, sub *Subscriber) error {
+		t.Errorf("Publish should not be called without a request")
+		return nil
+	}
+
+	withFailingHandler(t, WrapPublisher(testPublisher{t, publisher}), func(client *tchannel.Channel, hostPort string) {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		defer cancel()
+
+		stream, err := Begin(ctx, client, hostPort, testutils.DefaultServerName, "stream")
+		require.NoError(t, err, "Begin failed")
+		require.NoError(t, stream.CloseSend(), "CloseSend failed")
+
+		_, err = stream.Recv()
+		require.Error(t, err, "Recv should fail without a subscription request")
+		assert.Contains(t, err.Error(), ErrNoRequest.Error(), "Unexpected error")
+	})
+}
@@ -23,9 +23,11 @@ package tchannel_test
 import (
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -33,6 +35,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
 	"github.com/uber/tchannel/golang/testutils"
 	"golang.org/x/net/context"
 )
@@ -206,3 +209,186 @@ func TestStreamSendError(t *testing.T) {
 		require.NoError(t, argWriter.Close(), "arg3 close failed")
 	})
 }
+
+// patternReader returns a reader for n bytes of a repeating pattern.
+func patternReader(n int64) io.Reader {
+	return io.LimitReader(patternSource{}, n)
+}
+
+type patternSource struct{}
+
+func (patternSource) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(i)
+	}
+	return len(p), nil
+}
+
+func TestStreamLargeArg(t *testing.T) {
+	// The arg is larger than the frames that can be buffered for a message exchange,
+	// so the readers must apply backpressure rather than failing the call.
+	const argSize = 36 * 1024 * 1024
+	expected := crc32.NewIEEE()
+	io.Copy(expected, patternReader(argSize))
+
+	defer testutils.SetTimeout(t, 20*time.Second)()
+	ctx, cancel := NewContext(15 * time.Second)
+	defer cancel()
+
+	WithVerifiedServer(t, nil, func(ch *Channel, hostPort string) {
+		ch.Register(HandlerFunc(func(ctx context.Context, call *InboundCall) {
+			var arg2 []byte
+			require.NoError(t, NewArgReader(call.Arg2Reader()).Read(&arg2), "Arg2Reader failed")
+
+			argReader, err := call.Arg3Reader()
+			require.NoError(t, err, "Arg3Reader failed")
+			time.Sleep(100 * time.Millisecond)
+
+			received := crc32.NewIEEE()
+			require.NoError(t, NewArgReader(argReader, nil).ReadTo(received), "ReadTo failed")
+			assert.Equal(t, expected.Sum32(), received.Sum32(), "request arg3 mismatch")
+
+			response := call.Response()
+			require.NoError(t, NewArgWriter(response.Arg2Writer()).Write(nil), "Arg2Writer failed")
+			require.NoError(t, NewArgWriter(response.Arg3Writer()).WriteFrom(patternReader(argSize)), "WriteFrom failed")
+		}), "upload")
+
+		call, err := ch.BeginCall(ctx, hostPort, ch.PeerInfo().ServiceName, "upload", nil)
+		require.NoError(t, err, "BeginCall failed")
+		require.NoError(t, NewArgWriter(call.Arg2Writer()).Write(nil), "Arg2Writer failed")
+		require.NoError(t, NewArgWriter(call.Arg3Writer()).WriteFrom(patternReader(argSize)), "WriteFrom failed")
+
+		response := call.Response()
+		var arg2 []byte
+		require.NoError(t, NewArgReader(response.Arg2Reader()).Read(&arg2), "Arg2Reader failed")
+
+		argReader, err := response.Arg3Reader()
+		require.NoError(t, err, "Arg3Reader failed")
+		time.Sleep(100 * time.Millisecond)
+
+		received := crc32.NewIEEE()
+		require.NoError(t, NewArgReader(argReader, nil).ReadTo(received), "ReadTo failed")
+		assert.Equal(t, expected.Sum32(), received.Sum32(), "response arg3 mismatch")
+	})
+}
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	atomic.AddInt64(&r.n, int64(n))
+	return n, err
+}
+
+func TestStreamStalledReaderDoesNotBlockConnection(t *testing.T) {
+	const argSize = 32 * 1024 * 1024
+	defer testutils.SetTimeout(t, 5*time.Second)()
+	ctx, cancel := NewContext(3 * time.Second)
+	defer cancel()
+
+	WithVerifiedServer(t, nil, func(ch *Channel, hostPort string) {
+		release := make(chan struct{})
+		ch.Register(HandlerFunc(func(ctx context.Context, call *InboundCall) {
+			var arg2 []byte
+			require.NoError(t, NewArgReader(call.Arg2Reader()).Read(&arg2), "Arg2Reader failed")
+			argReader, err := call.Arg3Reader()
+			require.NoError(t, err, "Arg3Reader failed")
+
+			// Stop reading arg3 until the other call has completed.
+			<-release
+			n, err := io.Copy(ioutil.Discard, argReader)
+			require.NoError(t, err, "Read arg3 failed")
+			assert.Equal(t, int64(argSize), n, "arg3 size mismatch")
+			require.NoError(t, argReader.Close(), "Close failed")
+
+			response := call.Response()
+			require.NoError(t, NewArgWriter(response.Arg2Writer()).Write(nil), "Arg2Writer failed")
+			require.NoError(t, NewArgWriter(response.Arg3Writer()).Write(nil), "Arg3Writer failed")
+		}), "upload")
+		testutils.RegisterFunc(t, ch, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+			return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+		})
+
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		peer := client.Peers().GetOrAdd(hostPort)
+		conn, err := peer.GetConnection(ctx)
+		require.NoError(t, err, "GetConnection failed")
+
+		call, err := peer.BeginCall(ctx, ch.PeerInfo().ServiceName, "upload", nil)
+		require.NoError(t, err, "BeginCall failed")
+		require.NoError(t, NewArgWriter(call.Arg2Writer()).Write(nil), "Arg2Writer failed")
+
+		arg3 := &countingReader{r: patternReader(argSize)}
+		uploaded := make(chan error, 1)
+		go func() {
+			uploaded <- NewArgWriter(call.Arg3Writer()).WriteFrom(arg3)
+		}()
+
+		// Wait for enough of arg3 to be sent that the writer is waiting for the reader.
+		require.True(t, testutils.WaitFor(time.Second, func() bool {
+			return atomic.LoadInt64(&arg3.n) >= 2*1024*1024
+		}), "arg3 was not sent")
+
+		// Calls on the same connection are not blocked by the stalled reader.
+		echo, err := peer.BeginCall(ctx, ch.PeerInfo().ServiceName, "echo", nil)
+		require.NoError(t, err, "BeginCall failed")
+		_, echoArg3, _, err := raw.WriteArgs(echo, nil, []byte("body"))
+		require.NoError(t, err, "Call failed while the arg3 reader is stalled")
+		assert.Equal(t, "body", string(echoArg3), "echo arg3 mismatch")
+		connAfter, err := peer.GetConnection(ctx)
+		require.NoError(t, err, "GetConnection failed")
+		assert.Equal(t, conn, connAfter, "calls should use the same connection")
+
+		close(release)
+		require.NoError(t, <-uploaded, "WriteFrom failed")
+		var resArg2, resArg3 []byte
+		response := call.Response()
+		require.NoError(t, NewArgReader(response.Arg2Reader()).Read(&resArg2), "Read arg2 failed")
+		require.NoError(t, NewArgReader(response.Arg3Reader()).Read(&resArg3), "Read arg3 failed")
+	})
+}
+
+func TestSendArg2BeforeArg3(t *testing.T) {
+	defer testutils.SetTimeout(t, 2*time.Second)()
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+
+	WithVerifiedServer(t, nil, func(ch *Channel, hostPort string) {
+		release := make(chan struct{})
+		ch.Register(HandlerFunc(func(ctx context.Context, call *InboundCall) {
+			var arg2, arg3 []byte
+			require.NoError(t, NewArgReader(call.Arg2Reader()).Read(&arg2), "Arg2Reader failed")
+			require.NoError(t, NewArgReader(call.Arg3Reader()).Read(&arg3), "Arg3Reader failed")
+
+			argWriter, err := call.Response().SendArg2([]byte("headers"))
+			require.NoError(t, err, "SendArg2 failed")
+
+			// arg3 is only written once the caller has read arg2.
+			<-release
+			require.NoError(t, NewArgWriter(argWriter, nil).Write([]byte("body")), "arg3 write failed")
+		}), "headers")
+
+		call, err := ch.BeginCall(ctx, hostPort, ch.PeerInfo().ServiceName, "headers", nil)
+		require.NoError(t, err, "BeginCall failed")
+		require.NoError(t, NewArgWriter(call.Arg2Writer()).Write(nil), "Arg2Writer failed")
+		require.NoError(t, NewArgWriter(call.Arg3Writer()).Write(nil), "Arg3Writer failed")
+
+		response := call.Response()
+		arg2, err := response.ReadArg2()
+		require.NoError(t, err, "ReadArg2 failed")
+		assert.Equal(t, "headers", string(arg2), "arg2 mismatch")
+		assert.False(t, response.ApplicationError(), "unexpected application error")
+
+		close(release)
+		var arg3 []byte
+		require.NoError(t, NewArgReader(response.Arg3Reader()).Read(&arg3), "Arg3Reader failed")
+		assert.Equal(t, "body", string(arg3), "arg3 mismatch")
+	})
+}
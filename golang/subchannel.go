@@ -21,6 +21,7 @@
 package tchannel
 
 import (
+	"sort"
 	"sync"
 
 	"golang.org/x/net/context"
@@ -37,6 +38,23 @@ type SubChannel struct {
 	handlers           *handlerMap
 	logger             Logger
 	statsReporter      StatsReporter
+	retryBudget        *retryBudget
+	interceptors       *interceptors
+
+	timeoutsMut sync.RWMutex
+	timeouts    TimeoutOptions
+
+	fallbackMut sync.RWMutex
+	fallback    FallbackFunc
+
+	cacheMut sync.RWMutex
+	cache    *responseCache
+
+	notFoundMut sync.RWMutex
+	notFound    Handler
+
+	maintenanceMut sync.RWMutex
+	maintenance    maintenanceState
 }
 
 // Map of subchannel and the corresponding service
@@ -47,14 +65,21 @@ type subChannelMap struct {
 
 func newSubChannel(serviceName string, ch *Channel) *SubChannel {
 	logger := ch.Logger().WithFields(LogField{"subchannel", serviceName})
-	return &SubChannel{
+	sc := &SubChannel{
 		serviceName:   serviceName,
 		peers:         ch.peers,
 		topChannel:    ch,
 		handlers:      &handlerMap{},
 		logger:        logger,
 		statsReporter: ch.StatsReporter(),
+		interceptors:  &interceptors{},
 	}
+	sc.handlers.onDuplicate = ch.duplicates.onDuplicate(logger)
+	sc.retryBudget = newRetryBudget(ch.retryBudgetOptions, sc.StatsReporter(), sc.StatsTags(), ch.clock)
+	if ch.profile != nil {
+		sc.setTimeouts(ch.profile.Timeouts)
+	}
+	return sc
 }
 
 // ServiceName returns the service name that this subchannel is for.
@@ -63,13 +88,30 @@ func (c *SubChannel) ServiceName() string {
 }
 
 // BeginCall starts a new call to a remote peer, returning an OutboundCall that can
-// be used to write the arguments of the call.
+// be used to write the arguments of the call. If the context does not have a deadline,
+// the subchannel's default timeout for the operation is used.
 func (c *SubChannel) BeginCall(ctx context.Context, operationName string, callOptions *CallOptions) (*OutboundCall, error) {
 	if callOptions == nil {
 		callOptions = defaultCallOptions
 	}
 
-	return c.peers.Get().BeginCall(ctx, c.ServiceName(), operationName, callOptions)
+	peer := c.peers.GetNew(currentRequestState(ctx).PrevSelectedPeers())
+	if peer == nil {
+		return nil, ErrNoPeers
+	}
+
+	ctx, cancel := c.withDefaultTimeout(ctx, operationName)
+	call, err := peer.BeginCall(ctx, c.ServiceName(), operationName, callOptions)
+	if cancel != nil {
+		if err != nil {
+			cancel()
+		} else {
+			// The call may fail while writing the request or reading the response, so
+			// release the context however the exchange ends.
+			call.conn.outbound.setRemovedHook(call.mex, cancel)
+		}
+	}
+	return call, err
 }
 
 // Peers returns the PeerList for this subchannel.
@@ -77,9 +119,60 @@ func (c *SubChannel) Peers() *PeerList {
 	return c.peers
 }
 
-// Register registers a handler on the subchannel for a service+operation pair
+// Draining returns whether the underlying channel is draining.
+func (c *SubChannel) Draining() bool {
+	return c.topChannel.Draining()
+}
+
+// Health returns the number of peers for the SubChannel and how many of them have an
+// open circuit, so that services can report when a critical dependency is unreachable.
+func (c *SubChannel) Health() SubChannelHealth {
+	hostPorts := c.Peers().hostPorts()
+	open := c.topChannel.circuitBreakers.openPeers(c.ServiceName())
+
+	health := SubChannelHealth{Peers: len(hostPorts)}
+	for _, hostPort := range hostPorts {
+		if _, ok := open[hostPort]; ok {
+			health.OpenCircuits++
+		}
+	}
+	return health
+}
+
+// Register registers a handler on the subchannel for a service+operation pair.
+// The operation name may be a pattern such as "admin::*", where a "*" matches any
+// sequence of characters. Handlers registered for an exact operation name take priority
+// over patterns, and more specific patterns (with more non-wildcard characters) take
+// priority over less specific ones. Registering an operation that already has a handler
+// replaces it, unless the channel's DuplicateRegistration option rejects duplicates.
 func (c *SubChannel) Register(h Handler, operationName string) {
-	c.handlers.register(h, c.ServiceName(), operationName)
+	c.RegisterOperation(h, OperationInfo{Name: operationName})
+}
+
+// RegisterOperation registers a handler for an operation, like Register, and records
+// the operation's arg scheme and metadata.
+func (c *SubChannel) RegisterOperation(h Handler, op OperationInfo) {
+	c.handlers.registerOperation(h, c.ServiceName(), op)
+}
+
+// Operations returns the operations registered on the subchannel, sorted by name.
+func (c *SubChannel) Operations() []OperationInfo {
+	return c.handlers.operationInfos(c.ServiceName())
+}
+
+// SetNotFoundHandler sets the handler used for calls to this subchannel's service
+// for operations that do not match any registered handler. By default, such calls
+// fail with a BadRequest error.
+func (c *SubChannel) SetNotFoundHandler(h Handler) {
+	c.notFoundMut.Lock()
+	c.notFound = h
+	c.notFoundMut.Unlock()
+}
+
+func (c *SubChannel) notFoundHandler() Handler {
+	c.notFoundMut.RLock()
+	defer c.notFoundMut.RUnlock()
+	return c.notFound
 }
 
 // Logger returns the logger for this subchannel.
@@ -108,6 +201,25 @@ func (subChMap *subChannelMap) find(serviceName string, operation []byte) Handle
 	return nil
 }
 
+// findNotFound returns the NotFound handler for the given service, if any.
+func (subChMap *subChannelMap) findNotFound(serviceName string) Handler {
+	if sc, ok := subChMap.get(serviceName); ok {
+		return sc.notFoundHandler()
+	}
+
+	return nil
+}
+
+// serves returns whether there is a subchannel for the given service which has handlers
+// registered, or a NotFound handler set.
+func (subChMap *subChannelMap) serves(serviceName string) bool {
+	sc, ok := subChMap.get(serviceName)
+	if !ok {
+		return false
+	}
+	return sc.handlers.hasHandlers(serviceName) || sc.notFoundHandler() != nil
+}
+
 // Register a new subchannel for the given serviceName
 func (subChMap *subChannelMap) registerNewSubChannel(serviceName string, ch *Channel) *SubChannel {
 	subChMap.mut.Lock()
@@ -134,6 +246,19 @@ func (subChMap *subChannelMap) get(serviceName string) (*SubChannel, bool) {
 	return sc, ok
 }
 
+// serviceNames returns the sorted service names of all subchannels in the map.
+func (subChMap *subChannelMap) serviceNames() []string {
+	subChMap.mut.RLock()
+	names := make([]string, 0, len(subChMap.subchannels))
+	for serviceName := range subChMap.subchannels {
+		names = append(names, serviceName)
+	}
+	subChMap.mut.RUnlock()
+
+	sort.Strings(names)
+	return names
+}
+
 // GetOrAdd a subchannel for the given serviceName on the map
 func (subChMap *subChannelMap) getOrAdd(serviceName string, ch *Channel) *SubChannel {
 	if sc, ok := subChMap.get(serviceName); ok {
@@ -33,6 +33,9 @@ type FakeIncomingCall struct {
 
 	// ShardKeyF is the intended destination for this call.
 	ShardKeyF string
+
+	// RoutingDelegateF is the routing delegate for this call.
+	RoutingDelegateF string
 }
 
 // CallerName returns the caller name as specified in the fake call.
@@ -45,6 +48,11 @@ func (f *FakeIncomingCall) ShardKey() string {
 	return f.ShardKeyF
 }
 
+// RoutingDelegate returns the routing delegate as specified in the fake call.
+func (f *FakeIncomingCall) RoutingDelegate() string {
+	return f.RoutingDelegateF
+}
+
 // NewIncomingCall creates an incoming call for tests.
 func NewIncomingCall(callerName string) tchannel.IncomingCall {
 	return &FakeIncomingCall{CallerNameF: callerName}
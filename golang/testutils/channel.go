@@ -24,6 +24,7 @@ package testutils
 // ensure it's only compiled with tests.
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"net"
@@ -63,6 +64,36 @@ type ChannelOpts struct {
 
 	// DefaultConnectionOptions specifies the channel's default connection options.
 	DefaultConnectionOptions tchannel.ConnectionOptions
+
+	// Dialer is used to create outbound connections, defaults to a TCP dial.
+	Dialer func(hostPort string) (net.Conn, error)
+
+	// Clock is the channel's source of time, defaults to tchannel.SystemClock.
+	Clock tchannel.Clock
+
+	// ConcurrencyLimiter specifies the channel's concurrency limiter options.
+	ConcurrencyLimiter *tchannel.ConcurrencyLimiterOptions
+
+	// TLS specifies the channel's TLS options.
+	TLS *tchannel.TLSOptions
+
+	// ServerTLSConfig makes NewServer serve over TLS using the given configuration.
+	ServerTLSConfig *tls.Config
+
+	// PayloadSigning specifies the channel's payload signing options.
+	PayloadSigning *tchannel.PayloadSigningOptions
+
+	// Encryption specifies the channel's encryption options.
+	Encryption *tchannel.EncryptionOptions
+
+	// EnableIntrospection enables the channel's introspection endpoint.
+	EnableIntrospection bool
+
+	// PayloadSampler specifies the channel's payload sampling options.
+	PayloadSampler *tchannel.PayloadSamplerOptions
+
+	// Proxy specifies the proxy used for the channel's outbound connections.
+	Proxy *tchannel.ProxyOptions
 }
 
 func defaultString(v string, defaultValue string) string {
@@ -84,6 +115,15 @@ func getChannelOptions(opts *ChannelOpts, processName string) *tchannel.ChannelO
 		DefaultConnectionOptions: opts.DefaultConnectionOptions,
 		StatsReporter:            opts.StatsReporter,
 		TraceReporter:            opts.TraceReporter,
+		Dialer:                   opts.Dialer,
+		Clock:                    opts.Clock,
+		ConcurrencyLimiter:       opts.ConcurrencyLimiter,
+		TLS:                      opts.TLS,
+		PayloadSigning:           opts.PayloadSigning,
+		Encryption:               opts.Encryption,
+		EnableIntrospection:      opts.EnableIntrospection,
+		PayloadSampler:           opts.PayloadSampler,
+		Proxy:                    opts.Proxy,
 	}
 }
 
@@ -120,7 +160,11 @@ func NewServer(opts *ChannelOpts) (*tchannel.Channel, error) {
 		return nil, fmt.Errorf("NewChannel failed: %v", err)
 	}
 
-	if err := ch.Serve(l); err != nil {
+	if opts.ServerTLSConfig != nil {
+		if err := ch.ServeTLS(l, opts.ServerTLSConfig); err != nil {
+			return nil, fmt.Errorf("ServeTLS failed: %v", err)
+		}
+	} else if err := ch.Serve(l); err != nil {
 		return nil, fmt.Errorf("Serve failed: %v", err)
 	}
 
@@ -0,0 +1,225 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// Package golden captures call exchanges into golden fixtures, and replays them against
+// servers and clients, so that protocol and codec changes can be validated against
+// known-good byte streams.
+//
+// Fixtures are captured using a Recorder set as a channel's FrameTap, and written to a
+// JSON file containing the raw request and response frames. Replay compares frames after
+// decoding them, ignoring the values that change between calls: message IDs, the
+// time-to-live, and tracing.
+package golden
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/typed"
+)
+
+// Message types used in call exchanges, see docs/protocol.md.
+const (
+	typeInitReq         = 0x01
+	typeInitRes         = 0x02
+	typeCallReq         = 0x03
+	typeCallRes         = 0x04
+	typeCallReqContinue = 0x13
+	typeCallResContinue = 0x14
+	typeError           = 0xff
+)
+
+var errFrameTooSmall = errors.New("frame is smaller than the frame header")
+
+// Frame is the bytes of a single frame, including the frame header. It is encoded in
+// fixtures as a hex string.
+type Frame []byte
+
+// MarshalText implements encoding.TextMarshaler.
+func (f Frame) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(f)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (f *Frame) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	*f = b
+	return nil
+}
+
+func (f Frame) messageType() byte {
+	if len(f) < tchannel.FrameHeaderSize {
+		return 0
+	}
+	return f[2]
+}
+
+// withID returns a copy of the frame with the given message ID.
+func (f Frame) withID(id uint32) Frame {
+	c := append(Frame(nil), f...)
+	c[4], c[5], c[6], c[7] = byte(id>>24), byte(id>>16), byte(id>>8), byte(id)
+	return c
+}
+
+func (f Frame) id() uint32 {
+	return uint32(f[4])<<24 | uint32(f[5])<<16 | uint32(f[6])<<8 | uint32(f[7])
+}
+
+// Fixture is a recorded call exchange.
+type Fixture struct {
+	// Service and Operation are the service and operation of the call.
+	Service   string `json:"service"`
+	Operation string `json:"operation"`
+
+	// Request contains the call request frames, and Response contains the call response
+	// or error frames.
+	Request  []Frame `json:"request"`
+	Response []Frame `json:"response"`
+}
+
+// ReadFile reads a fixture from a JSON file.
+func ReadFile(path string) (*Fixture, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Fixture{}
+	if err := json.Unmarshal(bs, f); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %v: %v", path, err)
+	}
+	if len(f.Request) == 0 || len(f.Response) == 0 {
+		return nil, fmt.Errorf("fixture %v must contain request and response frames", path)
+	}
+	return f, nil
+}
+
+// WriteFile writes the fixture to a JSON file.
+func (f *Fixture) WriteFile(path string) error {
+	bs, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(bs, '\n'), 0644)
+}
+
+// decodedFrame is a call frame with the fields that do not change between calls.
+type decodedFrame struct {
+	Type         byte
+	Flags        byte
+	Code         byte
+	Service      string
+	Headers      map[string]string
+	ChecksumType byte
+	Checksum     []byte
+	Chunks       []string
+	ErrorMessage string
+}
+
+func decodeFrame(f Frame) (*decodedFrame, error) {
+	if len(f) < tchannel.FrameHeaderSize {
+		return nil, errFrameTooSmall
+	}
+
+	d := &decodedFrame{Type: f.messageType()}
+	r := typed.NewReadBuffer(f[tchannel.FrameHeaderSize:])
+	if d.Type == typeError {
+		d.Code = r.ReadSingleByte()
+		r.ReadBytes(25) // tracing:25
+		d.ErrorMessage = r.ReadLen16String()
+		return d, r.Err()
+	}
+
+	d.Flags = r.ReadSingleByte()
+	switch d.Type {
+	case typeCallReq:
+		r.ReadUint32()  // ttl:4
+		r.ReadBytes(25) // tracing:25
+		d.Service = r.ReadLen8String()
+		d.Headers = readHeaders(r)
+	case typeCallRes:
+		d.Code = r.ReadSingleByte()
+		r.ReadBytes(25) // tracing:25
+		d.Headers = readHeaders(r)
+	case typeCallReqContinue, typeCallResContinue:
+	default:
+		return nil, fmt.Errorf("unexpected message type 0x%02x", d.Type)
+	}
+
+	d.ChecksumType = r.ReadSingleByte()
+	if d.ChecksumType != byte(tchannel.ChecksumTypeNone) {
+		d.Checksum = r.ReadBytes(4)
+	}
+	for r.Err() == nil && r.BytesRemaining() > 0 {
+		d.Chunks = append(d.Chunks, string(r.ReadBytes(int(r.ReadUint16()))))
+	}
+	return d, r.Err()
+}
+
+func readHeaders(r *typed.ReadBuffer) map[string]string {
+	headers := make(map[string]string)
+	nh := int(r.ReadSingleByte())
+	for i := 0; i < nh; i++ {
+		k := r.ReadLen8String()
+		headers[k] = r.ReadLen8String()
+	}
+	return headers
+}
+
+// Compare returns an error describing the first difference between the expected and
+// actual frames, ignoring message IDs, the time-to-live and tracing.
+func Compare(expected, actual []Frame) error {
+	for i := 0; i < len(expected) || i < len(actual); i++ {
+		if i >= len(actual) {
+			return fmt.Errorf("missing frame %v, expected %+v", i, mustDecode(expected[i]))
+		}
+		if i >= len(expected) {
+			return fmt.Errorf("unexpected frame %v: %+v", i, mustDecode(actual[i]))
+		}
+
+		e, err := decodeFrame(expected[i])
+		if err != nil {
+			return fmt.Errorf("failed to decode expected frame %v: %v", i, err)
+		}
+		a, err := decodeFrame(actual[i])
+		if err != nil {
+			return fmt.Errorf("failed to decode frame %v: %v", i, err)
+		}
+		if !reflect.DeepEqual(e, a) {
+			return fmt.Errorf("frame %v mismatch:\n expected: %+v\n   actual: %+v", i, e, a)
+		}
+	}
+	return nil
+}
+
+// mustDecode decodes a frame for an error message, falling back to the raw bytes.
+func mustDecode(f Frame) interface{} {
+	if d, err := decodeFrame(f); err == nil {
+		return d
+	}
+	return []byte(f)
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package golden_test
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"github.com/uber/tchannel/golang/testutils/golden"
+	"golang.org/x/net/context"
+)
+
+var update = flag.Bool("update", false, "Regenerates the golden fixtures in testdata")
+
+const (
+	echoFixture = "testdata/echo.json"
+	serverName  = "golden-server"
+	clientName  = "golden-client"
+)
+
+func echo(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+	return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+}
+
+func newEchoServer(t *testing.T) *Channel {
+	server, err := testutils.NewServer(&testutils.ChannelOpts{ServiceName: serverName})
+	require.NoError(t, err, "NewServer failed")
+	testutils.RegisterFunc(t, server, "echo", echo)
+	return server
+}
+
+func callEcho(t *testing.T, client *Channel, hostPort string) ([]byte, []byte, error) {
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+
+	arg2, arg3, _, err := raw.Call(ctx, client, hostPort, serverName, "echo", []byte("head"), []byte("body"))
+	return arg2, arg3, err
+}
+
+func loadEchoFixture(t *testing.T) *golden.Fixture {
+	if *update {
+		server := newEchoServer(t)
+		defer server.Close()
+
+		recorder := golden.NewRecorder()
+		client, err := NewChannel(clientName, &ChannelOptions{FrameTap: recorder.TapOptions()})
+		require.NoError(t, err, "NewChannel failed")
+		defer client.Close()
+
+		_, _, err = callEcho(t, client, server.PeerInfo().HostPort)
+		require.NoError(t, err, "echo call failed")
+
+		fixture, err := recorder.Fixture("echo")
+		require.NoError(t, err, "Fixture failed")
+		require.NoError(t, fixture.WriteFile(echoFixture), "WriteFile failed")
+	}
+
+	fixture, err := golden.ReadFile(echoFixture)
+	require.NoError(t, err, "ReadFile failed")
+	return fixture
+}
+
+func TestRecorder(t *testing.T) {
+	server := newEchoServer(t)
+	defer server.Close()
+
+	recorder := golden.NewRecorder()
+	client, err := NewChannel(clientName, &ChannelOptions{FrameTap: recorder.TapOptions()})
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	_, _, err = callEcho(t, client, server.PeerInfo().HostPort)
+	require.NoError(t, err, "echo call failed")
+
+	fixture, err := recorder.Fixture("echo")
+	require.NoError(t, err, "Fixture failed")
+	assert.Equal(t, serverName, fixture.Service)
+	assert.Equal(t, "echo", fixture.Operation)
+	assert.NoError(t, golden.Compare(loadEchoFixture(t).Request, fixture.Request), "request mismatch")
+	assert.NoError(t, golden.Compare(loadEchoFixture(t).Response, fixture.Response), "response mismatch")
+
+	_, err = recorder.Fixture("unknown")
+	assert.Error(t, err, "Fixture should fail for an operation that was not called")
+}
+
+func TestReplayServer(t *testing.T) {
+	fixture := loadEchoFixture(t)
+
+	server := newEchoServer(t)
+	defer server.Close()
+	assert.NoError(t, golden.ReplayServer(server.PeerInfo().HostPort, fixture), "ReplayServer failed")
+
+	changed, err := testutils.NewServer(&testutils.ChannelOpts{ServiceName: serverName})
+	require.NoError(t, err, "NewServer failed")
+	defer changed.Close()
+	testutils.RegisterFunc(t, changed, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: []byte("changed")}, nil
+	})
+	assert.Error(t, golden.ReplayServer(changed.PeerInfo().HostPort, fixture),
+		"ReplayServer should fail when the response changes")
+}
+
+func TestStub(t *testing.T) {
+	stub, err := golden.NewStub(loadEchoFixture(t))
+	require.NoError(t, err, "NewStub failed")
+	defer stub.Close()
+
+	client, err := NewChannel(clientName, nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	arg2, arg3, err := callEcho(t, client, stub.HostPort())
+	require.NoError(t, err, "echo call failed")
+	assert.Equal(t, "head", string(arg2))
+	assert.Equal(t, "body", string(arg3))
+	assert.NoError(t, stub.Err(), "stub should not record a mismatch")
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	_, _, _, err = raw.Call(ctx, client, stub.HostPort(), serverName, "echo", []byte("head"), []byte("other"))
+	assert.Equal(t, ErrCodeBadRequest, GetSystemErrorCode(err), "mismatched call should fail")
+	assert.Error(t, stub.Err(), "stub should record the mismatch")
+	assert.Equal(t, 2, stub.Calls())
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package golden
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/uber/tchannel/golang"
+)
+
+type exchangeKey struct {
+	connID uint32
+	msgID  uint32
+}
+
+// Recorder is a tchannel.FrameTap that records the call exchanges on a channel's
+// connections as fixtures. For example:
+//
+//	recorder := golden.NewRecorder()
+//	ch, err := tchannel.NewChannel("svc", &tchannel.ChannelOptions{FrameTap: recorder.TapOptions()})
+//	// make a call using ch
+//	fixture, err := recorder.Fixture("operation")
+//	err = fixture.WriteFile("testdata/operation.json")
+type Recorder struct {
+	mut       sync.Mutex
+	exchanges map[exchangeKey]*Fixture
+	order     []*Fixture
+}
+
+// NewRecorder returns a new Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{exchanges: make(map[exchangeKey]*Fixture)}
+}
+
+// TapOptions returns the options to use as tchannel.ChannelOptions.FrameTap.
+func (r *Recorder) TapOptions() *tchannel.FrameTapOptions {
+	return &tchannel.FrameTapOptions{Tap: r, IncludePayloads: true}
+}
+
+// OnFrame implements tchannel.FrameTap.
+func (r *Recorder) OnFrame(event tchannel.FrameEvent) {
+	f := tchannel.NewFrame(len(event.Payload))
+	f.Header = event.Header
+	copy(f.Payload, event.Payload)
+
+	var buf bytes.Buffer
+	if err := f.WriteOut(&buf); err != nil {
+		return
+	}
+	frame := Frame(buf.Bytes())
+
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	key := exchangeKey{event.ConnectionID, event.Header.ID}
+	switch frame.messageType() {
+	case typeCallReq:
+		fixture := &Fixture{Request: []Frame{frame}}
+		if d, err := decodeFrame(frame); err == nil && len(d.Chunks) > 0 {
+			fixture.Service, fixture.Operation = d.Service, d.Chunks[0]
+		}
+		r.exchanges[key] = fixture
+		r.order = append(r.order, fixture)
+	case typeCallReqContinue:
+		if fixture, ok := r.exchanges[key]; ok {
+			fixture.Request = append(fixture.Request, frame)
+		}
+	case typeCallRes, typeCallResContinue, typeError:
+		if fixture, ok := r.exchanges[key]; ok {
+			fixture.Response = append(fixture.Response, frame)
+		}
+	}
+}
+
+// Fixtures returns the call exchanges that have been recorded, in the order that
+// the calls were made.
+func (r *Recorder) Fixtures() []*Fixture {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	fixtures := make([]*Fixture, len(r.order))
+	for i, f := range r.order {
+		fixtures[i] = f.copy()
+	}
+	return fixtures
+}
+
+// Fixture returns the most recent call exchange recorded for the given operation.
+func (r *Recorder) Fixture(operation string) (*Fixture, error) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	for i := len(r.order) - 1; i >= 0; i-- {
+		if f := r.order[i]; f.Operation == operation && len(f.Response) > 0 {
+			return f.copy(), nil
+		}
+	}
+	return nil, fmt.Errorf("no call recorded for operation %q", operation)
+}
+
+func (f *Fixture) copy() *Fixture {
+	c := *f
+	c.Request = append([]Frame(nil), f.Request...)
+	c.Response = append([]Frame(nil), f.Response...)
+	return &c
+}
@@ -0,0 +1,286 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package golden
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/typed"
+)
+
+const (
+	// moreFragmentsFlag is set on call frames that are followed by continue frames.
+	moreFragmentsFlag = 0x01
+
+	// replayTimeout is the timeout for replaying a fixture against a server.
+	replayTimeout = 5 * time.Second
+)
+
+// readFrame reads a single frame from r.
+func readFrame(r io.Reader) (Frame, error) {
+	header := make([]byte, tchannel.FrameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	size := int(header[0])<<8 | int(header[1])
+	if size < tchannel.FrameHeaderSize {
+		return nil, errFrameTooSmall
+	}
+	frame := make(Frame, size)
+	copy(frame, header)
+	if _, err := io.ReadFull(r, frame[tchannel.FrameHeaderSize:]); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// isLastFrame returns whether the frame is the last frame of a call request or response.
+func isLastFrame(f Frame) bool {
+	if f.messageType() == typeError {
+		return true
+	}
+	return len(f) > tchannel.FrameHeaderSize && f[tchannel.FrameHeaderSize]&moreFragmentsFlag == 0
+}
+
+// newFrame returns a frame with the given message type, ID and payload.
+func newFrame(msgType byte, id uint32, payload func(w *typed.WriteBuffer)) (Frame, error) {
+	w := typed.NewWriteBuffer(make([]byte, tchannel.MaxFrameSize))
+	w.WriteUint16(0) // size:2, updated below
+	w.WriteSingleByte(msgType)
+	w.WriteSingleByte(0)
+	w.WriteUint32(id)
+	w.WriteBytes(make([]byte, 8))
+	payload(w)
+	if err := w.Err(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if _, err := w.FlushTo(&buf); err != nil {
+		return nil, err
+	}
+	frame := Frame(buf.Bytes())
+	frame[0], frame[1] = byte(len(frame)>>8), byte(len(frame))
+	return frame, nil
+}
+
+// initFrame returns an init request or response frame.
+func initFrame(msgType byte, id uint32, hostPort, processName string) (Frame, error) {
+	return newFrame(msgType, id, func(w *typed.WriteBuffer) {
+		w.WriteUint16(tchannel.CurrentProtocolVersion)
+		w.WriteUint16(2)
+		w.WriteLen16String(tchannel.InitParamHostPort)
+		w.WriteLen16String(hostPort)
+		w.WriteLen16String(tchannel.InitParamProcessName)
+		w.WriteLen16String(processName)
+	})
+}
+
+// ReplayServer sends the fixture's request frames to the server at hostPort over a new
+// connection, and compares the frames that the server responds with to the fixture's
+// response frames.
+func ReplayServer(hostPort string, fixture *Fixture) error {
+	conn, err := net.DialTimeout("tcp", hostPort, replayTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(replayTimeout))
+
+	initReq, err := initFrame(typeInitReq, 1, "0.0.0.0:0", "golden-replay")
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(initReq); err != nil {
+		return err
+	}
+	initRes, err := readFrame(conn)
+	if err != nil {
+		return fmt.Errorf("failed to read init response: %v", err)
+	}
+	if initRes.messageType() != typeInitRes {
+		return fmt.Errorf("expected init response, got message type 0x%02x", initRes.messageType())
+	}
+
+	const callID = 2
+	for _, f := range fixture.Request {
+		if _, err := conn.Write(f.withID(callID)); err != nil {
+			return err
+		}
+	}
+
+	var response []Frame
+	for {
+		f, err := readFrame(conn)
+		if err != nil {
+			return fmt.Errorf("failed to read response: %v", err)
+		}
+		if f.id() != callID {
+			continue
+		}
+		response = append(response, f)
+		if isLastFrame(f) {
+			break
+		}
+	}
+	return Compare(fixture.Response, response)
+}
+
+// Stub is a server that checks that the calls it receives match a fixture's request,
+// and responds with the fixture's response. It is used to test clients against a
+// fixture without running the real server.
+type Stub struct {
+	fixture  *Fixture
+	listener net.Listener
+
+	mut   sync.Mutex
+	calls int
+	err   error
+}
+
+// NewStub returns a Stub that is listening on a local port.
+func NewStub(fixture *Fixture) (*Stub, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Stub{fixture: fixture, listener: l}
+	go s.serve()
+	return s, nil
+}
+
+// HostPort returns the host:port that the stub is listening on.
+func (s *Stub) HostPort() string {
+	return s.listener.Addr().String()
+}
+
+// Calls returns the number of calls that the stub has received.
+func (s *Stub) Calls() int {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	return s.calls
+}
+
+// Err returns the first difference between a call's request and the fixture's request.
+// Calls with a mismatched request fail with a bad request error.
+func (s *Stub) Err() error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	return s.err
+}
+
+// Close stops the stub from accepting new connections.
+func (s *Stub) Close() error {
+	return s.listener.Close()
+}
+
+func (s *Stub) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Stub) handle(conn net.Conn) {
+	defer conn.Close()
+
+	initReq, err := readFrame(conn)
+	if err != nil || initReq.messageType() != typeInitReq {
+		return
+	}
+	initRes, err := initFrame(typeInitRes, initReq.id(), s.HostPort(), "golden-stub")
+	if err != nil {
+		return
+	}
+	if _, err := conn.Write(initRes); err != nil {
+		return
+	}
+
+	requests := make(map[uint32][]Frame)
+	for {
+		f, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+
+		switch f.messageType() {
+		case typeCallReq, typeCallReqContinue:
+		default:
+			continue
+		}
+
+		id := f.id()
+		requests[id] = append(requests[id], f)
+		if !isLastFrame(f) {
+			continue
+		}
+
+		request := requests[id]
+		delete(requests, id)
+		if err := s.respond(conn, id, request); err != nil {
+			return
+		}
+	}
+}
+
+// respond checks the request against the fixture, and writes the response.
+func (s *Stub) respond(conn net.Conn, id uint32, request []Frame) error {
+	mismatch := Compare(s.fixture.Request, request)
+
+	s.mut.Lock()
+	s.calls++
+	if mismatch != nil && s.err == nil {
+		s.err = mismatch
+	}
+	s.mut.Unlock()
+
+	if mismatch != nil {
+		errFrame, err := newFrame(typeError, id, func(w *typed.WriteBuffer) {
+			w.WriteSingleByte(byte(tchannel.ErrCodeBadRequest))
+			w.WriteBytes(make([]byte, 25)) // tracing:25
+			w.WriteLen16String("request does not match the golden fixture")
+		})
+		if err != nil {
+			return err
+		}
+		_, err = conn.Write(errFrame)
+		return err
+	}
+
+	for _, f := range s.fixture.Response {
+		if _, err := conn.Write(f.withID(id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package testutils
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uber/tchannel/golang"
+)
+
+// leakCheckTimeout is how long channels are given to shut down cleanly after they are
+// closed before any remaining resources are reported as leaks.
+const leakCheckTimeout = 2 * time.Second
+
+// tchannelFuncPrefix is the prefix for functions in the tchannel package in goroutine stacks.
+const tchannelFuncPrefix = "github.com/uber/tchannel/golang."
+
+// WithTestChannel creates a server channel using opts and runs f with it. After f returns,
+// the channel is closed and verified to have shut down cleanly: all connections closed,
+// all message exchanges completed, all frames returned to the frame pool, and no
+// goroutines started during f are left running in the tchannel package.
+// Any leaks are reported as errors on t.
+func WithTestChannel(t *testing.T, opts *ChannelOpts, f func(ch *tchannel.Channel, hostPort string)) {
+	before := goroutineStacks()
+
+	ch, err := NewServer(opts)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	f(ch, ch.PeerInfo().HostPort)
+	verifyNoLeaks(t, before, ch)
+}
+
+// WithTestClientServer is like WithTestChannel, but also creates a client channel using
+// opts with the default client service name. Both channels are verified after f returns.
+func WithTestClientServer(t *testing.T, opts *ChannelOpts, f func(client, server *tchannel.Channel, hostPort string)) {
+	before := goroutineStacks()
+
+	server, err := NewServer(opts)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+
+	var clientOpts ChannelOpts
+	if opts != nil {
+		clientOpts = *opts
+	}
+	clientOpts.ServiceName = ""
+	clientOpts.ProcessName = ""
+	client, err := NewClient(&clientOpts)
+	if err != nil {
+		server.Close()
+		t.Fatalf("NewClient failed: %v", err)
+	}
+
+	f(client, server, server.PeerInfo().HostPort)
+	verifyNoLeaks(t, before, client, server)
+}
+
+// verifyNoLeaks closes the given channels, and reports any resources that are not
+// released within leakCheckTimeout as errors on t.
+func verifyNoLeaks(t *testing.T, before map[int]string, channels ...*tchannel.Channel) {
+	for _, ch := range channels {
+		ch.Close()
+	}
+
+	var leaks []string
+	WaitFor(leakCheckTimeout, func() bool {
+		leaks = findLeaks(before, channels)
+		return len(leaks) == 0
+	})
+	for _, leak := range leaks {
+		t.Errorf("Leak detected in %v: %v", t.Name(), leak)
+	}
+}
+
+// findLeaks returns a description of each resource that has not been released by channels.
+func findLeaks(before map[int]string, channels []*tchannel.Channel) []string {
+	var leaks []string
+	for _, ch := range channels {
+		name := ch.PeerInfo().ServiceName
+		if state := ch.State(); state != tchannel.ChannelClosed {
+			leaks = append(leaks, fmt.Sprintf("channel %v is in state %v, expected closed", name, state))
+		}
+
+		state := ch.IntrospectState(&tchannel.IntrospectionOptions{IncludeExchanges: true})
+		for _, peer := range state.Peers {
+			for _, conn := range peer.Connections {
+				if conn.ConnectionState != "connectionClosed" {
+					leaks = append(leaks, fmt.Sprintf("channel %v connection %v to %v is in state %v",
+						name, conn.ID, conn.RemoteHostPort, conn.ConnectionState))
+				}
+				for _, mex := range []tchannel.ExchangeRuntimeState{conn.InboundExchange, conn.OutboundExchange} {
+					if mex.Count > 0 {
+						leaks = append(leaks, fmt.Sprintf("channel %v connection %v has %v %v exchanges: %+v",
+							name, conn.ID, mex.Count, mex.Name, mex.Exchanges))
+					}
+				}
+			}
+		}
+
+		if framePool := ch.Gauges().FramePool; framePool.Outstanding != 0 {
+			leaks = append(leaks, fmt.Sprintf("channel %v has %v frames that were not released to the frame pool",
+				name, framePool.Outstanding))
+		}
+	}
+
+	for id, stack := range goroutineStacks() {
+		if _, ok := before[id]; ok {
+			continue
+		}
+		if strings.Contains(stack, tchannelFuncPrefix) {
+			leaks = append(leaks, fmt.Sprintf("goroutine was not stopped:\n%v", stack))
+		}
+	}
+	return leaks
+}
+
+// goroutineStacks returns the stacks of all goroutines, keyed by goroutine ID.
+func goroutineStacks() map[int]string {
+	var buf []byte
+	for size := 1 << 16; ; size *= 2 {
+		buf = make([]byte, size)
+		if n := runtime.Stack(buf, true /* all */); n < size {
+			buf = buf[:n]
+			break
+		}
+	}
+
+	stacks := make(map[int]string)
+	for _, stack := range strings.Split(string(buf), "\n\n") {
+		// Each stack starts with a header that looks like: goroutine 643 [runnable]:
+		parts := strings.SplitN(stack, " ", 3)
+		if len(parts) < 3 || parts[0] != "goroutine" {
+			continue
+		}
+		if id, err := strconv.Atoi(parts[1]); err == nil {
+			stacks[id] = stack
+		}
+	}
+	return stacks
+}
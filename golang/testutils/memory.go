@@ -0,0 +1,169 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package testutils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/uber/tchannel/golang"
+)
+
+var (
+	errListenerClosed = errors.New("in-memory listener closed")
+	errNoListener     = errors.New("connection refused: no in-memory listener")
+)
+
+// memoryAddr is the address of an in-memory listener or connection.
+type memoryAddr string
+
+func (a memoryAddr) Network() string { return "memory" }
+func (a memoryAddr) String() string  { return string(a) }
+
+// MemoryNetwork is an in-memory network that channels can listen on and dial, so that
+// tests do not need real sockets. Connections are created using net.Pipe.
+type MemoryNetwork struct {
+	mut       sync.Mutex
+	listeners map[string]*memoryListener
+	nextPort  int
+}
+
+// NewMemoryNetwork returns a new in-memory network with no listeners.
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{listeners: make(map[string]*memoryListener)}
+}
+
+// Listen returns a listener with a unique host:port on the network.
+func (n *MemoryNetwork) Listen() net.Listener {
+	n.mut.Lock()
+	defer n.mut.Unlock()
+
+	n.nextPort++
+	l := &memoryListener{
+		network: n,
+		addr:    memoryAddr(fmt.Sprintf("inmemory:%v", n.nextPort)),
+		conns:   make(chan net.Conn),
+		closed:  make(chan struct{}),
+	}
+	n.listeners[l.addr.String()] = l
+	return l
+}
+
+// Dial connects to the listener with the given host:port. It can be used as the
+// Dialer in tchannel.ChannelOptions.
+func (n *MemoryNetwork) Dial(hostPort string) (net.Conn, error) {
+	n.mut.Lock()
+	l, ok := n.listeners[hostPort]
+	n.nextPort++
+	clientAddr := memoryAddr(fmt.Sprintf("inmemory-client:%v", n.nextPort))
+	n.mut.Unlock()
+	if !ok {
+		return nil, errNoListener
+	}
+
+	client, server := net.Pipe()
+	select {
+	case l.conns <- &memoryConn{server, l.addr, clientAddr}:
+		return &memoryConn{client, clientAddr, l.addr}, nil
+	case <-l.closed:
+		client.Close()
+		server.Close()
+		return nil, errNoListener
+	}
+}
+
+func (n *MemoryNetwork) remove(l *memoryListener) {
+	n.mut.Lock()
+	delete(n.listeners, l.addr.String())
+	n.mut.Unlock()
+}
+
+// memoryListener is a net.Listener that accepts connections made using MemoryNetwork.Dial.
+type memoryListener struct {
+	network   *MemoryNetwork
+	addr      memoryAddr
+	conns     chan net.Conn
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (l *memoryListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, errListenerClosed
+	}
+}
+
+func (l *memoryListener) Close() error {
+	l.closeOnce.Do(func() {
+		l.network.remove(l)
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *memoryListener) Addr() net.Addr {
+	return l.addr
+}
+
+// memoryConn is a net.Pipe connection that reports in-memory addresses.
+type memoryConn struct {
+	net.Conn
+	local, remote memoryAddr
+}
+
+func (c *memoryConn) LocalAddr() net.Addr  { return c.local }
+func (c *memoryConn) RemoteAddr() net.Addr { return c.remote }
+
+// NewClientServer creates a server channel that listens on an in-memory network, and a
+// client channel that dials the server over the same network, with the server added as a
+// peer. The server's service name and the options for both channels are taken from opts.
+func NewClientServer(opts *ChannelOpts) (client *tchannel.Channel, server *tchannel.Channel, err error) {
+	if opts == nil {
+		opts = &ChannelOpts{}
+	}
+	network := NewMemoryNetwork()
+
+	serviceName := defaultString(opts.ServiceName, DefaultServerName)
+	serverOpts := getChannelOptions(opts, serviceName+"-inmemory")
+	serverOpts.Dialer = network.Dial
+	server, err = tchannel.NewChannel(serviceName, serverOpts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("NewChannel failed: %v", err)
+	}
+	if err := server.Serve(network.Listen()); err != nil {
+		server.Close()
+		return nil, nil, fmt.Errorf("Serve failed: %v", err)
+	}
+
+	clientOpts := getChannelOptions(opts, DefaultClientName+"-inmemory")
+	clientOpts.Dialer = network.Dial
+	client, err = tchannel.NewChannel(DefaultClientName, clientOpts)
+	if err != nil {
+		server.Close()
+		return nil, nil, fmt.Errorf("NewChannel failed: %v", err)
+	}
+	client.Peers().Add(server.PeerInfo().HostPort)
+	return client, server, nil
+}
@@ -22,6 +22,7 @@ package mockhyperbahn
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 
 	"github.com/uber/tchannel/golang"
@@ -36,6 +37,7 @@ type Mock struct {
 	ch         *tchannel.Channel
 	respCh     chan int
 	advertised []string
+	discovery  map[string][]string
 }
 
 // New returns a mock Hyperbahn server that can be used for testing.
@@ -46,10 +48,12 @@ func New() (*Mock, error) {
 	}
 
 	mh := &Mock{
-		ch:     ch,
-		respCh: make(chan int),
+		ch:        ch,
+		respCh:    make(chan int),
+		discovery: make(map[string][]string),
 	}
-	if err := json.Register(ch, json.Handlers{"ad": mh.adHandler}, nil); err != nil {
+	handlers := json.Handlers{"ad": mh.adHandler, "discover": mh.discoverHandler}
+	if err := json.Register(ch, handlers, nil); err != nil {
 		return nil, err
 	}
 
@@ -83,6 +87,25 @@ func (h *Mock) adHandler(ctx json.Context, req *hyperbahn.AdRequest) (*hyperbahn
 	}
 }
 
+func (h *Mock) discoverHandler(ctx json.Context, req *hyperbahn.DiscoveryRequest) (*hyperbahn.DiscoveryResponse, error) {
+	h.RLock()
+	defer h.RUnlock()
+
+	peers, ok := h.discovery[req.ServiceName]
+	if !ok {
+		return nil, fmt.Errorf("no peers for service %v", req.ServiceName)
+	}
+	return &hyperbahn.DiscoveryResponse{Peers: peers}, nil
+}
+
+// SetDiscoveryResult sets the peers returned when the given service is discovered.
+func (h *Mock) SetDiscoveryResult(serviceName string, hostPorts []string) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.discovery[serviceName] = hostPorts
+}
+
 // GetAdvertised returns the list of services registered.
 func (h *Mock) GetAdvertised() []string {
 	h.RLock()
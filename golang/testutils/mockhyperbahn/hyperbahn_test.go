@@ -62,3 +62,24 @@ func TestMockHyperbahn(t *testing.T) {
 	require.NoError(t, setupServer(), "setupServer failed")
 	assert.Equal(t, []string{"myservice"}, mh.GetAdvertised())
 }
+
+func TestMockDiscovery(t *testing.T) {
+	mh, err := mockhyperbahn.New()
+	require.NoError(t, err, "mock hyperbahn failed")
+	defer mh.Close()
+
+	ch, err := tchannel.NewChannel("myclient", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer ch.Close()
+
+	client, err := hyperbahn.NewClient(ch, mh.Configuration(), nil)
+	require.NoError(t, err, "NewClient failed")
+
+	_, err = client.Discover("myservice")
+	assert.Error(t, err, "Discover should fail for unknown services")
+
+	mh.SetDiscoveryResult("myservice", []string{"1.1.1.1:1"})
+	peers, err := client.Discover("myservice")
+	require.NoError(t, err, "Discover failed")
+	assert.Equal(t, []string{"1.1.1.1:1"}, peers, "unexpected peers")
+}
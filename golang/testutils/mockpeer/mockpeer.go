@@ -0,0 +1,292 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package mockpeer provides a scripted fake peer that returns canned responses, errors,
+// delays and partial responses, so that client code (including retries and timeouts) can
+// be unit tested without running real servers.
+//
+// The peer is served over an in-memory network, and clients are created using NewClient:
+//
+//	peer, err := mockpeer.New("svc")
+//	peer.Expect("op",
+//		mockpeer.Response{SystemErr: tchannel.ErrServerBusy},
+//		mockpeer.Response{Arg3: []byte("ok")})
+//	client, err := peer.NewClient(nil)
+package mockpeer
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+// Response is a scripted response that the peer returns for a single call.
+type Response struct {
+	// Delay is how long the peer waits before responding.
+	Delay time.Duration
+
+	// SystemErr is sent as a system error if set. Errors that are not created using
+	// tchannel.NewSystemError are sent as unexpected errors.
+	SystemErr error
+
+	// ApplicationError marks the response as an application error.
+	ApplicationError bool
+
+	// Arg2 and Arg3 are the response arguments.
+	Arg2 []byte
+	Arg3 []byte
+
+	// Fragments are written to arg3 after Arg3, each flushed separately, with
+	// FragmentDelay before each fragment.
+	Fragments     [][]byte
+	FragmentDelay time.Duration
+
+	// Stall stops the peer after flushing the response written so far, without
+	// completing it, so the call fails once it times out.
+	Stall bool
+}
+
+// Call is a call received by the peer.
+type Call struct {
+	Caller    string
+	Format    tchannel.Format
+	Operation string
+	Arg2      []byte
+	Arg3      []byte
+}
+
+// Peer is a scripted fake peer.
+type Peer struct {
+	sync.Mutex
+
+	ch        *tchannel.Channel
+	network   *testutils.MemoryNetwork
+	scripts   map[string][]Response
+	defaults  map[string]Response
+	calls     []Call
+	listening map[string]bool
+}
+
+// New returns a scripted peer for the given service. Calls for operations that have
+// not been scripted fail with a bad request error.
+func New(serviceName string) (*Peer, error) {
+	network := testutils.NewMemoryNetwork()
+	ch, err := tchannel.NewChannel(serviceName, &tchannel.ChannelOptions{
+		ProcessName: serviceName + "-mockpeer",
+		Dialer:      network.Dial,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Peer{
+		ch:        ch,
+		network:   network,
+		scripts:   make(map[string][]Response),
+		defaults:  make(map[string]Response),
+		listening: make(map[string]bool),
+	}
+	if err := ch.Serve(network.Listen()); err != nil {
+		ch.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// Expect queues responses that are returned, in order, for calls to the given operation.
+func (p *Peer) Expect(operation string, responses ...Response) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.register(operation)
+	p.scripts[operation] = append(p.scripts[operation], responses...)
+}
+
+// SetDefault sets the response returned for calls to the given operation once all
+// expected responses have been returned.
+func (p *Peer) SetDefault(operation string, response Response) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.register(operation)
+	p.defaults[operation] = response
+}
+
+// register must be called with the lock held.
+func (p *Peer) register(operation string) {
+	if p.listening[operation] {
+		return
+	}
+	p.listening[operation] = true
+	p.ch.Register(tchannel.HandlerFunc(p.handle), operation)
+}
+
+// Pending returns the number of expected responses for the operation that have not
+// been returned yet.
+func (p *Peer) Pending(operation string) int {
+	p.Lock()
+	defer p.Unlock()
+
+	return len(p.scripts[operation])
+}
+
+// Calls returns the calls that the peer has received.
+func (p *Peer) Calls() []Call {
+	p.Lock()
+	defer p.Unlock()
+
+	return append([]Call(nil), p.calls...)
+}
+
+// ServiceName returns the service name of the peer.
+func (p *Peer) ServiceName() string {
+	return p.ch.PeerInfo().ServiceName
+}
+
+// HostPort returns the in-memory host:port of the peer.
+func (p *Peer) HostPort() string {
+	return p.ch.PeerInfo().HostPort
+}
+
+// Dialer returns a dialer that connects to the peer's in-memory network, for use
+// as tchannel.ChannelOptions.Dialer.
+func (p *Peer) Dialer() func(hostPort string) (net.Conn, error) {
+	return p.network.Dial
+}
+
+// NewClient returns a client channel that can reach the peer, with the peer added
+// as a peer of the channel and of the subchannel for the peer's service.
+func (p *Peer) NewClient(opts *testutils.ChannelOpts) (*tchannel.Channel, error) {
+	var clientOpts testutils.ChannelOpts
+	if opts != nil {
+		clientOpts = *opts
+	}
+	clientOpts.Dialer = p.network.Dial
+
+	client, err := testutils.NewClient(&clientOpts)
+	if err != nil {
+		return nil, err
+	}
+	client.Peers().Add(p.HostPort())
+	client.GetSubChannel(p.ServiceName()).Peers().Add(p.HostPort())
+	return client, nil
+}
+
+// Close stops the peer.
+func (p *Peer) Close() {
+	p.ch.Close()
+}
+
+// next records the call and returns the response for it.
+func (p *Peer) next(call Call) (Response, bool) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.calls = append(p.calls, call)
+	if script := p.scripts[call.Operation]; len(script) > 0 {
+		p.scripts[call.Operation] = script[1:]
+		return script[0], true
+	}
+	resp, ok := p.defaults[call.Operation]
+	return resp, ok
+}
+
+func (p *Peer) handle(ctx context.Context, inbound *tchannel.InboundCall) {
+	call := Call{
+		Caller:    inbound.CallerName(),
+		Format:    inbound.Format(),
+		Operation: string(inbound.Operation()),
+	}
+	if err := tchannel.NewArgReader(inbound.Arg2Reader()).Read(&call.Arg2); err != nil {
+		return
+	}
+	if err := tchannel.NewArgReader(inbound.Arg3Reader()).Read(&call.Arg3); err != nil {
+		return
+	}
+
+	response := inbound.Response()
+	resp, ok := p.next(call)
+	if !ok {
+		response.SendSystemError(tchannel.NewSystemError(tchannel.ErrCodeBadRequest,
+			"mockpeer: no response for %v", call.Operation))
+		return
+	}
+
+	if !sleep(ctx, resp.Delay) {
+		return
+	}
+	if resp.SystemErr != nil {
+		response.SendSystemError(resp.SystemErr)
+		return
+	}
+	if resp.ApplicationError {
+		if err := response.SetApplicationError(); err != nil {
+			return
+		}
+	}
+	if err := tchannel.NewArgWriter(response.Arg2Writer()).Write(resp.Arg2); err != nil {
+		return
+	}
+
+	w, err := response.Arg3Writer()
+	if err != nil {
+		return
+	}
+	if _, err := w.Write(resp.Arg3); err != nil {
+		return
+	}
+	for _, fragment := range resp.Fragments {
+		if err := w.Flush(); err != nil {
+			return
+		}
+		if !sleep(ctx, resp.FragmentDelay) {
+			return
+		}
+		if _, err := w.Write(fragment); err != nil {
+			return
+		}
+	}
+	if resp.Stall {
+		w.Flush()
+		<-ctx.Done()
+		return
+	}
+	w.Close()
+}
+
+// sleep waits for d, and returns false if the context is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
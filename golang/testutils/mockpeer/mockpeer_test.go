@@ -0,0 +1,154 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package mockpeer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils/mockpeer"
+	"golang.org/x/net/context"
+)
+
+func setup(t *testing.T) (*mockpeer.Peer, *tchannel.SubChannel, func()) {
+	peer, err := mockpeer.New("svc")
+	require.NoError(t, err, "mockpeer.New failed")
+	client, err := peer.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	return peer, client.GetSubChannel("svc"), func() {
+		client.Close()
+		peer.Close()
+	}
+}
+
+func call(sc *tchannel.SubChannel, timeout time.Duration) (string, *tchannel.OutboundCallResponse, error) {
+	ctx, cancel := tchannel.NewContext(timeout)
+	defer cancel()
+
+	call, err := sc.BeginCall(ctx, "op", &tchannel.CallOptions{Format: tchannel.Raw})
+	if err != nil {
+		return "", nil, err
+	}
+	_, arg3, resp, err := raw.WriteArgs(call, []byte("head"), []byte("body"))
+	return string(arg3), resp, err
+}
+
+func TestScriptedResponses(t *testing.T) {
+	peer, sc, cleanup := setup(t)
+	defer cleanup()
+
+	peer.Expect("op",
+		mockpeer.Response{Arg3: []byte("first")},
+		mockpeer.Response{ApplicationError: true, Arg3: []byte("app error")},
+		mockpeer.Response{SystemErr: tchannel.ErrServerBusy},
+	)
+	peer.SetDefault("op", mockpeer.Response{Arg3: []byte("default")})
+
+	arg3, resp, err := call(sc, time.Second)
+	require.NoError(t, err, "first call failed")
+	assert.Equal(t, "first", arg3)
+	assert.False(t, resp.ApplicationError(), "first call should succeed")
+
+	arg3, resp, err = call(sc, time.Second)
+	require.NoError(t, err, "second call failed")
+	assert.Equal(t, "app error", arg3)
+	assert.True(t, resp.ApplicationError(), "second call should be an application error")
+
+	_, _, err = call(sc, time.Second)
+	assert.Equal(t, tchannel.ErrCodeBusy, tchannel.GetSystemErrorCode(err), "third call should be busy")
+
+	arg3, _, err = call(sc, time.Second)
+	require.NoError(t, err, "default call failed")
+	assert.Equal(t, "default", arg3)
+
+	assert.Equal(t, 0, peer.Pending("op"), "all responses should be used")
+	calls := peer.Calls()
+	require.Len(t, calls, 4, "unexpected number of calls")
+	assert.Equal(t, "op", calls[0].Operation)
+	assert.Equal(t, "head", string(calls[0].Arg2))
+	assert.Equal(t, "body", string(calls[0].Arg3))
+}
+
+func TestUnscriptedCall(t *testing.T) {
+	_, sc, cleanup := setup(t)
+	defer cleanup()
+
+	_, _, err := call(sc, time.Second)
+	assert.Equal(t, tchannel.ErrCodeBadRequest, tchannel.GetSystemErrorCode(err), "unscripted calls should fail")
+}
+
+func TestRetryOnBusy(t *testing.T) {
+	peer, sc, cleanup := setup(t)
+	defer cleanup()
+
+	peer.Expect("op",
+		mockpeer.Response{SystemErr: tchannel.ErrServerBusy},
+		mockpeer.Response{SystemErr: tchannel.ErrServerBusy},
+		mockpeer.Response{Arg3: []byte("ok")},
+	)
+
+	ctx, cancel := tchannel.NewContextBuilder(time.Second).
+		SetRetryOptions(&tchannel.RetryOptions{MaxAttempts: 3, BackoffBase: time.Millisecond}).
+		Build()
+	defer cancel()
+
+	_, arg3, _, err := raw.CallSC(ctx, sc, "op", nil, nil)
+	require.NoError(t, err, "CallSC should succeed on the third attempt")
+	assert.Equal(t, "ok", string(arg3))
+	assert.Len(t, peer.Calls(), 3, "unexpected number of attempts")
+}
+
+func TestDelayTimeout(t *testing.T) {
+	peer, sc, cleanup := setup(t)
+	defer cleanup()
+
+	peer.Expect("op",
+		mockpeer.Response{Delay: time.Second},
+		mockpeer.Response{Delay: 10 * time.Millisecond, Arg3: []byte("ok")},
+	)
+
+	_, _, err := call(sc, 50*time.Millisecond)
+	assert.Equal(t, context.DeadlineExceeded, err, "delayed call should time out")
+
+	arg3, _, err := call(sc, time.Second)
+	require.NoError(t, err, "short delay should not time out")
+	assert.Equal(t, "ok", arg3)
+}
+
+func TestFragments(t *testing.T) {
+	peer, sc, cleanup := setup(t)
+	defer cleanup()
+
+	peer.Expect("op",
+		mockpeer.Response{Arg3: []byte("a"), Fragments: [][]byte{[]byte("b"), []byte("c")}, FragmentDelay: time.Millisecond},
+		mockpeer.Response{Arg3: []byte("partial"), Stall: true},
+	)
+
+	arg3, _, err := call(sc, time.Second)
+	require.NoError(t, err, "fragmented call failed")
+	assert.Equal(t, "abc", arg3)
+
+	_, _, err = call(sc, 50*time.Millisecond)
+	assert.Equal(t, context.DeadlineExceeded, err, "stalled call should time out")
+}
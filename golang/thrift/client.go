@@ -23,6 +23,7 @@ package thrift
 import (
 	"github.com/apache/thrift/lib/go/thrift"
 	"github.com/uber/tchannel/golang"
+	"golang.org/x/net/context"
 )
 
 // client implements TChanClient and makes outgoing Thrift calls.
@@ -36,6 +37,12 @@ type client struct {
 type ClientOptions struct {
 	// HostPort specifies a specific server to hit.
 	HostPort string
+
+	// CallOptions are used for every call made by the client. The Timeout and RetryOptions
+	// are applied using tchannel.WithCallOptions, and Headers are sent with the headers in
+	// the context. If RetryOptions is set and HostPort is not, calls are retried using the
+	// subchannel's RunWithRetry.
+	CallOptions *tchannel.CallOptions
 }
 
 // NewClient returns a Client that makes calls over the given tchannel to the given Hyperbahn service.
@@ -51,13 +58,44 @@ func NewClient(ch *tchannel.Channel, serviceName string, opts *ClientOptions) TC
 }
 
 func (c *client) Call(ctx Context, thriftService, methodName string, req, resp thrift.TStruct) (bool, error) {
-	var peer *tchannel.Peer
+	opts := c.opts.CallOptions
+	callCtx, cancel := tchannel.WithCallOptions(ctx, opts)
+	defer cancel()
+
+	var success bool
+	attempt := func(callCtx context.Context, _ *tchannel.RequestState) error {
+		var err error
+		success, err = c.call(ctx, callCtx, thriftService, methodName, req, resp)
+		return err
+	}
+
+	if opts == nil || opts.RetryOptions == nil || c.opts.HostPort != "" {
+		err := attempt(callCtx, nil)
+		return success, err
+	}
+	err := c.sc.RunWithRetry(callCtx, attempt)
+	return success, err
+}
+
+// call makes a single attempt of a call using callCtx. Headers are read from and
+// response headers are set on ctx.
+func (c *client) call(ctx Context, callCtx context.Context, thriftService, methodName string, req, resp thrift.TStruct) (bool, error) {
+	var (
+		call *tchannel.OutboundCall
+		err  error
+	)
+	operation := thriftService + "::" + methodName
+	callOptions := &tchannel.CallOptions{}
+	if c.opts.CallOptions != nil {
+		*callOptions = *c.opts.CallOptions
+	}
+	callOptions.Format = tchannel.Thrift
 	if c.opts.HostPort != "" {
-		peer = c.sc.Peers().GetOrAdd(c.opts.HostPort)
+		call, err = c.sc.Peers().GetOrAdd(c.opts.HostPort).BeginCall(callCtx, c.serviceName, operation, callOptions)
 	} else {
-		peer = c.sc.Peers().Get()
+		// The subchannel selects a peer that was not used by a previous attempt when retrying.
+		call, err = c.sc.BeginCall(callCtx, operation, callOptions)
 	}
-	call, err := peer.BeginCall(ctx, c.serviceName, thriftService+"::"+methodName, &tchannel.CallOptions{Format: tchannel.Thrift})
 	if err != nil {
 		return false, err
 	}
@@ -66,7 +104,8 @@ func (c *client) Call(ctx Context, thriftService, methodName string, req, resp t
 	if err != nil {
 		return false, err
 	}
-	if err := writeHeaders(writer, ctx.Headers()); err != nil {
+	headers := c.opts.CallOptions.AppHeaders(ctx.Headers())
+	if err := writeHeaders(writer, tchannel.InjectRequestID(ctx, headers)); err != nil {
 		return false, err
 	}
 	if err := writer.Close(); err != nil {
@@ -0,0 +1,68 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package thrift
+
+import (
+	"fmt"
+
+	tchannel "github.com/uber/tchannel/golang"
+)
+
+// DependencyHealthOptions configures how the state of a downstream SubChannel is
+// reflected in health checks.
+type DependencyHealthOptions struct {
+	// OpenCircuitThreshold is the fraction of peers with an open circuit at which the
+	// dependency is reported as unhealthy. Defaults to 1, so the dependency is only
+	// unhealthy once the circuit to every peer is open.
+	OpenCircuitThreshold float64
+
+	// IgnoreNoPeers stops an empty peer list from being reported as unhealthy.
+	IgnoreNoPeers bool
+}
+
+// SubChannelHealthCheck returns a HealthCheck that fails when the peer list of sc is
+// empty, or when the circuit is open for too many of its peers.
+func SubChannelHealthCheck(sc *tchannel.SubChannel, opts DependencyHealthOptions) HealthCheck {
+	threshold := opts.OpenCircuitThreshold
+	if threshold <= 0 || threshold > 1 {
+		threshold = 1
+	}
+
+	return func(ctx Context) error {
+		health := sc.Health()
+		if health.Peers == 0 {
+			if opts.IgnoreNoPeers {
+				return nil
+			}
+			return fmt.Errorf("no peers for %v", sc.ServiceName())
+		}
+		if float64(health.OpenCircuits) >= threshold*float64(health.Peers) {
+			return fmt.Errorf("circuit open for %v of %v peers for %v",
+				health.OpenCircuits, health.Peers, sc.ServiceName())
+		}
+		return nil
+	}
+}
+
+// RegisterDependency registers a health check for the downstream service of sc, so that
+// Traffic health checks fail while the service cannot be reached. See SubChannelHealthCheck.
+func (s *Server) RegisterDependency(sc *tchannel.SubChannel, opts DependencyHealthOptions) {
+	s.RegisterHealthCheck(sc.ServiceName(), SubChannelHealthCheck(sc, opts))
+}
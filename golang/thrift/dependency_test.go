@@ -0,0 +1,133 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package thrift
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestSubChannelHealthCheck(t *testing.T) {
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+
+	server, err := testutils.NewServer(&testutils.ChannelOpts{ServiceName: "downstream"})
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "op", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{SystemErr: tchannel.ErrServerBusy}, nil
+	})
+
+	client, err := tchannel.NewChannel("upstream", &tchannel.ChannelOptions{
+		CircuitBreaker: &tchannel.CircuitBreakerOptions{
+			MinRequests:  2,
+			OpenDuration: time.Minute,
+		},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	sc := client.GetSubChannel("downstream")
+	allPeers := SubChannelHealthCheck(sc, DependencyHealthOptions{})
+	halfPeers := SubChannelHealthCheck(sc, DependencyHealthOptions{OpenCircuitThreshold: 0.5})
+	ignoreNoPeers := SubChannelHealthCheck(sc, DependencyHealthOptions{IgnoreNoPeers: true})
+
+	if assert.Error(t, allPeers(ctx), "No peers should be unhealthy") {
+		assert.Equal(t, "no peers for downstream", allPeers(ctx).Error(), "Error message mismatch")
+	}
+	assert.NoError(t, ignoreNoPeers(ctx), "IgnoreNoPeers should ignore an empty peer list")
+
+	hostPort := server.PeerInfo().HostPort
+	sc.Peers().Add(hostPort)
+	sc.Peers().Add("1.1.1.1:1")
+	assert.NoError(t, allPeers(ctx), "Closed circuits should be healthy")
+	assert.NoError(t, halfPeers(ctx), "Closed circuits should be healthy")
+
+	for i := 0; i < 2; i++ {
+		callCtx, callCancel := tchannel.NewContext(time.Second)
+		_, _, _, err := raw.Call(callCtx, client, hostPort, "downstream", "op", nil, nil)
+		callCancel()
+		assert.Error(t, err, "Call should fail")
+	}
+	assert.NoError(t, allPeers(ctx), "One open circuit should be below the default threshold")
+	if assert.Error(t, halfPeers(ctx), "One open circuit should reach the 0.5 threshold") {
+		assert.Equal(t, "circuit open for 1 of 2 peers for downstream", halfPeers(ctx).Error(), "Error message mismatch")
+	}
+}
+
+func TestRegisterDependency(t *testing.T) {
+	withMetaSetup(t, func(ctx Context, c tchanMeta, server *Server) {
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		server.RegisterDependency(client.GetSubChannel("downstream"), DependencyHealthOptions{})
+		ok, message, components, err := CheckHealthDetails(ctx, c.(*tchanMetaClient).client)
+		require.NoError(t, err, "CheckHealthDetails failed")
+		assert.False(t, ok, "Unreachable dependency should fail readiness")
+		assert.Equal(t, "downstream: no peers for downstream", message, "Health message mismatch")
+		require.Equal(t, 1, len(components), "Expected a component for the dependency")
+		assert.Equal(t, "downstream", components[0].Name, "Component name mismatch")
+
+		ok, _, err = CheckHealthRequest(ctx, c.(*tchanMetaClient).client, HealthRequest{Type: Process})
+		require.NoError(t, err, "CheckHealthRequest failed")
+		assert.True(t, ok, "Unreachable dependency should not fail liveness")
+	})
+}
+
+func TestSetReadyWhenAvailable(t *testing.T) {
+	withMetaSetup(t, func(ctx Context, c tchanMeta, server *Server) {
+		downstream, err := testutils.NewServer(&testutils.ChannelOpts{ServiceName: "downstream"})
+		require.NoError(t, err, "NewServer failed")
+		defer downstream.Close()
+
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		ready := server.SetReadyWhenAvailable(&tchannel.DependencyWaitOptions{
+			Timeout:       2 * time.Second,
+			RetryInterval: 5 * time.Millisecond,
+		}, client.GetSubChannel("downstream"))
+
+		ok, message, err := CheckHealth(ctx, c.(*tchanMetaClient).client)
+		require.NoError(t, err, "CheckHealth failed")
+		assert.False(t, ok, "Service should not be ready without its dependency")
+		assert.Equal(t, "not ready", message, "Health message mismatch")
+
+		client.Peers().Add(downstream.PeerInfo().HostPort)
+		select {
+		case <-ready:
+		case <-time.After(time.Second):
+			t.Fatalf("Service was not marked ready once its dependency was available")
+		}
+
+		ok, _, err = CheckHealth(ctx, c.(*tchanMetaClient).client)
+		require.NoError(t, err, "CheckHealth failed")
+		assert.True(t, ok, "Service should be ready once its dependency is available")
+	})
+}
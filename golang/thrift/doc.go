@@ -39,6 +39,12 @@ To use a Thrift client use the generated TChan client:
 This client can be used similar to a standard Thrift client, except a Context
 is passed with options (such as timeout).
 
+Services can be exposed over HTTP+JSON using gateways generated by thrift-gen
+with -generateGateway:
+  gateway := thrift.NewGateway(nil)
+  gateway.Register(gen.NewTChan[SERVICE]Gateway(client))
+  http.ListenAndServe(":8080", gateway)
+
 TODO(prashant): Add and document header support.
 */
 package thrift
@@ -0,0 +1,674 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package dynamic
+
+// This file implements the Thrift binary protocol for JSON values, using the types in the IDL.
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/samuel/go-thrift/parser"
+)
+
+// Thrift binary protocol type IDs.
+const (
+	typeStop   byte = 0
+	typeBool   byte = 2
+	typeByte   byte = 3
+	typeDouble byte = 4
+	typeI16    byte = 6
+	typeI32    byte = 8
+	typeI64    byte = 10
+	typeString byte = 11
+	typeStruct byte = 12
+	typeMap    byte = 13
+	typeSet    byte = 14
+	typeList   byte = 15
+)
+
+// maxDepth limits the nesting of containers and structs read from untrusted input.
+const maxDepth = 64
+
+var errTooDeep = errors.New("value is nested too deeply")
+
+// rootType resolves typedefs and returns the underlying type.
+func (idl *IDL) rootType(t *parser.Type) *parser.Type {
+	for {
+		td, ok := idl.typedefs[t.Name]
+		if !ok {
+			return t
+		}
+		t = td
+	}
+}
+
+// typeID returns the Thrift binary protocol type ID for the given type.
+func (idl *IDL) typeID(t *parser.Type) (byte, error) {
+	t = idl.rootType(t)
+	switch t.Name {
+	case "bool":
+		return typeBool, nil
+	case "byte", "i8":
+		return typeByte, nil
+	case "double":
+		return typeDouble, nil
+	case "i16":
+		return typeI16, nil
+	case "i32":
+		return typeI32, nil
+	case "i64":
+		return typeI64, nil
+	case "string", "binary":
+		return typeString, nil
+	case "map":
+		return typeMap, nil
+	case "set":
+		return typeSet, nil
+	case "list":
+		return typeList, nil
+	}
+	if _, ok := idl.enums[t.Name]; ok {
+		return typeI32, nil
+	}
+	if _, ok := idl.structs[t.Name]; ok {
+		return typeStruct, nil
+	}
+	return 0, fmt.Errorf("unknown type %v", t.Name)
+}
+
+type writer struct {
+	buf bytes.Buffer
+	err error
+}
+
+func (w *writer) writeByte(b byte) {
+	w.buf.WriteByte(b)
+}
+
+func (w *writer) writeUint16(v uint16) {
+	var bs [2]byte
+	binary.BigEndian.PutUint16(bs[:], v)
+	w.buf.Write(bs[:])
+}
+
+func (w *writer) writeUint32(v uint32) {
+	var bs [4]byte
+	binary.BigEndian.PutUint32(bs[:], v)
+	w.buf.Write(bs[:])
+}
+
+func (w *writer) writeUint64(v uint64) {
+	var bs [8]byte
+	binary.BigEndian.PutUint64(bs[:], v)
+	w.buf.Write(bs[:])
+}
+
+func (w *writer) writeString(s string) {
+	w.writeUint32(uint32(len(s)))
+	w.buf.WriteString(s)
+}
+
+// writeFields writes a struct containing the given fields, using the values in the map.
+// Fields that are not in the map are not written.
+func (idl *IDL) writeFields(w *writer, fields []*parser.Field, values map[string]interface{}) error {
+	known := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		known[f.Name] = true
+		v, ok := values[f.Name]
+		if !ok || v == nil {
+			continue
+		}
+
+		id, err := idl.typeID(f.Type)
+		if err != nil {
+			return err
+		}
+		w.writeByte(id)
+		w.writeUint16(uint16(f.ID))
+		if err := idl.writeValue(w, f.Type, v); err != nil {
+			return fmt.Errorf("%v: %v", f.Name, err)
+		}
+	}
+	for name := range values {
+		if !known[name] {
+			return fmt.Errorf("unknown field %v", name)
+		}
+	}
+	w.writeByte(typeStop)
+	return nil
+}
+
+func (idl *IDL) writeValue(w *writer, t *parser.Type, v interface{}) error {
+	t = idl.rootType(t)
+	switch t.Name {
+	case "bool":
+		b, ok := v.(bool)
+		if !ok {
+			return fmt.Errorf("expected bool, got %v", v)
+		}
+		if b {
+			w.writeByte(1)
+		} else {
+			w.writeByte(0)
+		}
+		return nil
+	case "byte", "i8":
+		n, err := toInt(v, 8)
+		w.writeByte(byte(n))
+		return err
+	case "i16":
+		n, err := toInt(v, 16)
+		w.writeUint16(uint16(n))
+		return err
+	case "i32":
+		n, err := toInt(v, 32)
+		w.writeUint32(uint32(n))
+		return err
+	case "i64":
+		n, err := toInt(v, 64)
+		w.writeUint64(uint64(n))
+		return err
+	case "double":
+		f, err := toFloat(v)
+		w.writeUint64(math.Float64bits(f))
+		return err
+	case "string", "binary":
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("expected string, got %v", v)
+		}
+		w.writeString(s)
+		return nil
+	case "list", "set":
+		return idl.writeList(w, t.ValueType, v)
+	case "map":
+		return idl.writeMap(w, t.KeyType, t.ValueType, v)
+	}
+
+	if _, ok := idl.enums[t.Name]; ok {
+		n, err := toInt(v, 32)
+		w.writeUint32(uint32(n))
+		return err
+	}
+	if s, ok := idl.structs[t.Name]; ok {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected object for %v, got %v", t.Name, v)
+		}
+		return idl.writeFields(w, s.Fields, m)
+	}
+	return fmt.Errorf("unknown type %v", t.Name)
+}
+
+func (idl *IDL) writeList(w *writer, elemType *parser.Type, v interface{}) error {
+	list, ok := v.([]interface{})
+	if !ok {
+		return fmt.Errorf("expected array, got %v", v)
+	}
+	id, err := idl.typeID(elemType)
+	if err != nil {
+		return err
+	}
+
+	w.writeByte(id)
+	w.writeUint32(uint32(len(list)))
+	for _, elem := range list {
+		if err := idl.writeValue(w, elemType, elem); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMap writes a map from a JSON object. Keys that are not strings are parsed from
+// the object's keys.
+func (idl *IDL) writeMap(w *writer, keyType, valueType *parser.Type, v interface{}) error {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("expected object, got %v", v)
+	}
+	keyID, err := idl.typeID(keyType)
+	if err != nil {
+		return err
+	}
+	if !isKeyType(keyID) {
+		return fmt.Errorf("map keys of type %v are not supported", keyID)
+	}
+	valueID, err := idl.typeID(valueType)
+	if err != nil {
+		return err
+	}
+
+	// Sort the keys so that the encoding is deterministic.
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w.writeByte(keyID)
+	w.writeByte(valueID)
+	w.writeUint32(uint32(len(m)))
+	for _, k := range keys {
+		key, err := parseKey(keyID, k)
+		if err != nil {
+			return err
+		}
+		if err := idl.writeValue(w, keyType, key); err != nil {
+			return err
+		}
+		if err := idl.writeValue(w, valueType, m[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isKeyType returns whether map keys of the given type can be represented as JSON object keys.
+func isKeyType(id byte) bool {
+	switch id {
+	case typeString, typeBool, typeByte, typeI16, typeI32, typeI64, typeDouble:
+		return true
+	}
+	return false
+}
+
+// parseKey converts a JSON object key to a value of the given type.
+func parseKey(id byte, key string) (interface{}, error) {
+	switch id {
+	case typeString:
+		return key, nil
+	case typeBool:
+		return strconv.ParseBool(key)
+	}
+	return json.Number(key), nil
+}
+
+// toInt converts a JSON number to an integer that fits in the given number of bits.
+func toInt(v interface{}, bits int) (int64, error) {
+	var n int64
+	switch v := v.(type) {
+	case json.Number:
+		var err error
+		if n, err = strconv.ParseInt(string(v), 10, bits); err != nil {
+			return 0, fmt.Errorf("invalid i%v %v", bits, v)
+		}
+		return n, nil
+	case float64:
+		n = int64(v)
+		if float64(n) != v {
+			return 0, fmt.Errorf("invalid i%v %v", bits, v)
+		}
+	default:
+		return 0, fmt.Errorf("expected number, got %v", v)
+	}
+
+	if bits < 64 && (n < -1<<uint(bits-1) || n >= 1<<uint(bits-1)) {
+		return 0, fmt.Errorf("invalid i%v %v", bits, v)
+	}
+	return n, nil
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case json.Number:
+		return v.Float64()
+	case float64:
+		return v, nil
+	}
+	return 0, fmt.Errorf("expected number, got %v", v)
+}
+
+type reader struct {
+	buf   []byte
+	depth int
+}
+
+var errShortRead = errors.New("unexpected end of data")
+
+func (r *reader) read(n int) ([]byte, error) {
+	if n < 0 || n > len(r.buf) {
+		return nil, errShortRead
+	}
+	bs := r.buf[:n]
+	r.buf = r.buf[n:]
+	return bs, nil
+}
+
+func (r *reader) readByte() (byte, error) {
+	bs, err := r.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return bs[0], nil
+}
+
+func (r *reader) readUint16() (uint16, error) {
+	bs, err := r.read(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(bs), nil
+}
+
+func (r *reader) readUint32() (uint32, error) {
+	bs, err := r.read(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(bs), nil
+}
+
+func (r *reader) readUint64() (uint64, error) {
+	bs, err := r.read(8)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(bs), nil
+}
+
+// readLen reads a length prefix, and verifies that there are at least
+// minSize bytes remaining for each element.
+func (r *reader) readLen(minSize int) (int, error) {
+	n, err := r.readUint32()
+	if err != nil {
+		return 0, err
+	}
+	if minSize > 0 && int64(n)*int64(minSize) > int64(len(r.buf)) {
+		return 0, errShortRead
+	}
+	return int(n), nil
+}
+
+// readFields reads a struct with the given fields, and returns a map from field names to
+// values. Fields that are not known are skipped.
+func (idl *IDL) readFields(r *reader, fields []*parser.Field) (map[string]interface{}, error) {
+	if r.depth++; r.depth > maxDepth {
+		return nil, errTooDeep
+	}
+	defer func() { r.depth-- }()
+
+	byID := make(map[int]*parser.Field, len(fields))
+	for _, f := range fields {
+		byID[f.ID] = f
+	}
+
+	values := make(map[string]interface{})
+	for {
+		id, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+		if id == typeStop {
+			return values, nil
+		}
+		fieldID, err := r.readUint16()
+		if err != nil {
+			return nil, err
+		}
+
+		f, ok := byID[int(int16(fieldID))]
+		if ok {
+			if expected, err := idl.typeID(f.Type); err != nil || expected != id {
+				ok = false
+			}
+		}
+		if !ok {
+			if err := r.skip(id); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		v, err := idl.readValue(r, f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", f.Name, err)
+		}
+		values[f.Name] = v
+	}
+}
+
+func (idl *IDL) readValue(r *reader, t *parser.Type) (interface{}, error) {
+	t = idl.rootType(t)
+	switch t.Name {
+	case "bool":
+		b, err := r.readByte()
+		return b != 0, err
+	case "byte", "i8":
+		b, err := r.readByte()
+		return int8(b), err
+	case "i16":
+		n, err := r.readUint16()
+		return int16(n), err
+	case "i32":
+		n, err := r.readUint32()
+		return int32(n), err
+	case "i64":
+		n, err := r.readUint64()
+		return int64(n), err
+	case "double":
+		n, err := r.readUint64()
+		return math.Float64frombits(n), err
+	case "string", "binary":
+		n, err := r.readLen(1)
+		if err != nil {
+			return nil, err
+		}
+		bs, err := r.read(n)
+		return string(bs), err
+	case "list", "set":
+		return idl.readList(r, t.ValueType)
+	case "map":
+		return idl.readMap(r, t.KeyType, t.ValueType)
+	}
+
+	if _, ok := idl.enums[t.Name]; ok {
+		n, err := r.readUint32()
+		return int32(n), err
+	}
+	if s, ok := idl.structs[t.Name]; ok {
+		return idl.readFields(r, s.Fields)
+	}
+	return nil, fmt.Errorf("unknown type %v", t.Name)
+}
+
+func (idl *IDL) readList(r *reader, elemType *parser.Type) ([]interface{}, error) {
+	if r.depth++; r.depth > maxDepth {
+		return nil, errTooDeep
+	}
+	defer func() { r.depth-- }()
+
+	id, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	if expected, err := idl.typeID(elemType); err != nil || expected != id {
+		return nil, fmt.Errorf("unexpected element type %v", id)
+	}
+	n, err := r.readLen(minSize(id))
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := idl.readValue(r, elemType)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+// readMap reads a map as a JSON object, formatting keys that are not strings.
+func (idl *IDL) readMap(r *reader, keyType, valueType *parser.Type) (map[string]interface{}, error) {
+	if r.depth++; r.depth > maxDepth {
+		return nil, errTooDeep
+	}
+	defer func() { r.depth-- }()
+
+	keyID, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	valueID, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	if expected, err := idl.typeID(keyType); err != nil || expected != keyID {
+		return nil, fmt.Errorf("unexpected key type %v", keyID)
+	}
+	if expected, err := idl.typeID(valueType); err != nil || expected != valueID {
+		return nil, fmt.Errorf("unexpected value type %v", valueID)
+	}
+	if !isKeyType(keyID) {
+		return nil, fmt.Errorf("map keys of type %v are not supported", keyID)
+	}
+	n, err := r.readLen(minSize(keyID) + minSize(valueID))
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := idl.readValue(r, keyType)
+		if err != nil {
+			return nil, err
+		}
+		v, err := idl.readValue(r, valueType)
+		if err != nil {
+			return nil, err
+		}
+		m[fmt.Sprint(k)] = v
+	}
+	return m, nil
+}
+
+// skip skips over a value of the given type.
+func (r *reader) skip(id byte) error {
+	if r.depth++; r.depth > maxDepth {
+		return errTooDeep
+	}
+	defer func() { r.depth-- }()
+
+	if size := fixedSize(id); size > 0 {
+		_, err := r.read(size)
+		return err
+	}
+
+	switch id {
+	case typeString:
+		n, err := r.readLen(1)
+		if err != nil {
+			return err
+		}
+		_, err = r.read(n)
+		return err
+	case typeStruct:
+		for {
+			fieldType, err := r.readByte()
+			if err != nil || fieldType == typeStop {
+				return err
+			}
+			if _, err := r.readUint16(); err != nil {
+				return err
+			}
+			if err := r.skip(fieldType); err != nil {
+				return err
+			}
+		}
+	case typeList, typeSet:
+		elemType, err := r.readByte()
+		if err != nil {
+			return err
+		}
+		n, err := r.readLen(minSize(elemType))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := r.skip(elemType); err != nil {
+				return err
+			}
+		}
+		return nil
+	case typeMap:
+		keyType, err := r.readByte()
+		if err != nil {
+			return err
+		}
+		valueType, err := r.readByte()
+		if err != nil {
+			return err
+		}
+		n, err := r.readLen(minSize(keyType) + minSize(valueType))
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := r.skip(keyType); err != nil {
+				return err
+			}
+			if err := r.skip(valueType); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown type ID %v", id)
+}
+
+// fixedSize returns the encoded size of values of the given type, or 0 if the size varies.
+func fixedSize(id byte) int {
+	switch id {
+	case typeBool, typeByte:
+		return 1
+	case typeI16:
+		return 2
+	case typeI32:
+		return 4
+	case typeI64, typeDouble:
+		return 8
+	}
+	return 0
+}
+
+// minSize returns the minimum encoded size of values of the given type.
+func minSize(id byte) int {
+	if size := fixedSize(id); size > 0 {
+		return size
+	}
+	switch id {
+	case typeString:
+		return 4
+	case typeStruct:
+		return 1
+	}
+	// Containers have a type and a length.
+	return 5
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package dynamic
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/samuel/go-thrift/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const everythingJSON = `{
+	"b": true, "by": -1, "s": 300, "i": -70000, "l": 9007199254740993, "d": 1.5,
+	"str": "hello", "bin": "\u0000\u0001", "nums": [1, 2, 3], "names": ["a", "b"],
+	"byName": {"x": {"id": 1, "tags": ["t1"]}, "y": {"id": 2}},
+	"byID": {"1": "one", "-2": "minus two"},
+	"color": 2, "uuid": "abc", "inner": {"id": 4}
+}`
+
+func parseIDL(t *testing.T) *IDL {
+	idl, err := Parse("test.thrift")
+	require.NoError(t, err, "Parse failed")
+	return idl
+}
+
+func decodeJSON(t *testing.T, s string) map[string]interface{} {
+	var v map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader([]byte(s)))
+	d.UseNumber()
+	require.NoError(t, d.Decode(&v), "failed to decode JSON: %s", s)
+	return v
+}
+
+func assertJSONEqual(t *testing.T, expected, got interface{}, msg string) {
+	expectedBytes, err := json.Marshal(expected)
+	require.NoError(t, err, "Marshal failed")
+	gotBytes, err := json.Marshal(got)
+	require.NoError(t, err, "Marshal failed")
+	assert.Equal(t, string(expectedBytes), string(gotBytes), msg)
+}
+
+// encodeResult encodes a result struct for the method with the given field set.
+func encodeResult(t *testing.T, m *Method, field string, v interface{}) []byte {
+	fields := append([]*parser.Field{{ID: 0, Name: "success", Type: m.method.ReturnType}}, m.method.Exceptions...)
+	if m.method.ReturnType == nil {
+		fields = m.method.Exceptions
+	}
+
+	values := map[string]interface{}{}
+	if field != "" {
+		values[field] = v
+	}
+	w := &writer{}
+	require.NoError(t, m.idl.writeFields(w, fields, values), "writeFields failed")
+	return w.buf.Bytes()
+}
+
+func TestEncodeArgs(t *testing.T) {
+	idl := parseIDL(t)
+
+	ping, err := idl.Method("Test::Ping")
+	require.NoError(t, err, "Method failed")
+	encoded, err := ping.EncodeArgs(nil)
+	require.NoError(t, err, "EncodeArgs failed")
+	assert.Equal(t, []byte{0}, encoded, "Ping args mismatch")
+
+	echo, err := idl.Method("Test::Echo")
+	require.NoError(t, err, "Method failed")
+	encoded, err = echo.EncodeArgs(decodeJSON(t, `{"arg": {"b": true, "s": 2}}`))
+	require.NoError(t, err, "EncodeArgs failed")
+	expected := []byte{
+		0x0c, 0x00, 0x01, // arg: struct, field 1
+		0x02, 0x00, 0x01, 0x01, // b: bool, field 1, true
+		0x06, 0x00, 0x03, 0x00, 0x02, // s: i16, field 3, 2
+		0x00, // end of arg
+		0x00, // end of args
+	}
+	assert.Equal(t, expected, encoded, "Echo args mismatch")
+}
+
+func TestRoundTrip(t *testing.T) {
+	idl := parseIDL(t)
+	m, err := idl.Method("Test::Echo")
+	require.NoError(t, err, "Method failed")
+
+	args := map[string]interface{}{"arg": decodeJSON(t, everythingJSON)}
+	encoded, err := m.EncodeArgs(args)
+	require.NoError(t, err, "EncodeArgs failed")
+
+	decoded, err := idl.readFields(&reader{buf: encoded}, m.method.Arguments)
+	require.NoError(t, err, "readFields failed")
+	assertJSONEqual(t, args, decoded, "args mismatch after round trip")
+
+	success, result, err := m.DecodeResult(encodeResult(t, m, "success", args["arg"]))
+	require.NoError(t, err, "DecodeResult failed")
+	assert.True(t, success, "expected success")
+	assertJSONEqual(t, args["arg"], result, "result mismatch after round trip")
+}
+
+func TestDecodeResult(t *testing.T) {
+	idl := parseIDL(t)
+	echo, err := idl.Method("Test::Echo")
+	require.NoError(t, err, "Method failed")
+	ping, err := idl.Method("Test::Ping")
+	require.NoError(t, err, "Method failed")
+
+	success, result, err := echo.DecodeResult(encodeResult(t, echo, "notFound", decodeJSON(t, `{"message": "oops"}`)))
+	require.NoError(t, err, "DecodeResult failed")
+	assert.False(t, success, "expected exception")
+	assertJSONEqual(t, decodeJSON(t, `{"notFound": {"message": "oops"}}`), result, "exception mismatch")
+
+	success, result, err = ping.DecodeResult([]byte{0})
+	require.NoError(t, err, "DecodeResult failed")
+	assert.True(t, success, "expected success for void")
+	assert.Nil(t, result, "expected no result for void")
+
+	_, _, err = echo.DecodeResult([]byte{0})
+	assert.Error(t, err, "expected error for missing return value")
+}
+
+func TestDecodeSkipsUnknownFields(t *testing.T) {
+	idl := parseIDL(t)
+	m, err := idl.Method("Base::Health")
+	require.NoError(t, err, "Method failed")
+
+	data := []byte{
+		0x0f, 0x00, 0x05, 0x0b, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 'x', // field 5: list<string>
+		0x0d, 0x00, 0x06, 0x08, 0x0c, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, // field 6: map<i32, struct>
+		0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, // field 0 with the wrong type
+		0x0b, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 'o', 'k', // success: "ok"
+		0x00,
+	}
+	success, result, err := m.DecodeResult(data)
+	require.NoError(t, err, "DecodeResult failed")
+	assert.True(t, success, "expected success")
+	assert.Equal(t, "ok", result, "result mismatch")
+}
+
+func TestDecodeErrors(t *testing.T) {
+	idl := parseIDL(t)
+	m, err := idl.Method("Test::Echo")
+	require.NoError(t, err, "Method failed")
+
+	full := encodeResult(t, m, "success", decodeJSON(t, everythingJSON))
+	for i := 0; i < len(full); i++ {
+		_, _, err := m.DecodeResult(full[:i])
+		assert.Error(t, err, "expected error for data truncated to %v bytes", i)
+	}
+
+	// A list that claims more elements than the data could contain.
+	_, _, err = m.DecodeResult([]byte{0x0c, 0x00, 0x00, 0x0f, 0x00, 0x09, 0x08, 0x7f, 0xff, 0xff, 0xff})
+	assert.Error(t, err, "expected error for large list length")
+
+	// Deeply nested structs in an unknown field.
+	var nested []byte
+	for i := 0; i < 100; i++ {
+		nested = append(nested, 0x0c, 0x00, 0x09)
+	}
+	_, _, err = m.DecodeResult(nested)
+	require.Error(t, err, "expected error for deeply nested data")
+	assert.Contains(t, err.Error(), errTooDeep.Error(), "unexpected error for deeply nested data")
+}
+
+func TestEncodeErrors(t *testing.T) {
+	idl := parseIDL(t)
+	m, err := idl.Method("Test::Echo")
+	require.NoError(t, err, "Method failed")
+
+	tests := []string{
+		`{"unknown": 1}`,
+		`{"arg": {"unknown": 1}}`,
+		`{"arg": {"b": "true"}}`,
+		`{"arg": {"s": 40000}}`,
+		`{"arg": {"by": 1.5}}`,
+		`{"arg": {"str": 1}}`,
+		`{"arg": {"nums": {}}}`,
+		`{"arg": {"byID": {"a": "b"}}}`,
+		`{"arg": {"inner": []}}`,
+		`{"arg": 1}`,
+	}
+	for _, tt := range tests {
+		_, err := m.EncodeArgs(decodeJSON(t, tt))
+		assert.Error(t, err, "expected EncodeArgs(%v) to fail", tt)
+	}
+}
+
+func TestMethod(t *testing.T) {
+	idl := parseIDL(t)
+
+	m, err := idl.Method("Test::Health")
+	require.NoError(t, err, "Method should find methods in the base service")
+	assert.Equal(t, "Test::Health", m.Operation(), "Operation mismatch")
+
+	for _, op := range []string{"Test", "Test::Unknown", "Unknown::Echo", "Test::Echo::Echo"} {
+		_, err := idl.Method(op)
+		assert.Error(t, err, "Method(%v) should fail", op)
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	headers := map[string]string{"k1": "v1", "key2": "", "": "v3"}
+	encoded := EncodeHeaders(headers)
+	decoded, err := DecodeHeaders(encoded)
+	require.NoError(t, err, "DecodeHeaders failed")
+	assert.Equal(t, headers, decoded, "headers mismatch")
+
+	assert.Equal(t, []byte{0, 0}, EncodeHeaders(nil), "empty headers mismatch")
+	for i := 1; i < len(encoded); i++ {
+		_, err := DecodeHeaders(encoded[:i])
+		assert.Error(t, err, "expected error for headers truncated to %v bytes", i)
+	}
+}
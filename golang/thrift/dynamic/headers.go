@@ -0,0 +1,56 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package dynamic
+
+import "github.com/uber/tchannel/golang/typed"
+
+// EncodeHeaders encodes application headers as arg2 for a call using the Thrift arg scheme:
+// nh:2 (k~2 v~2){nh}
+func EncodeHeaders(headers map[string]string) []byte {
+	size := 2
+	for k, v := range headers {
+		size += 4 + len(k) + len(v)
+	}
+
+	buf := make([]byte, size)
+	wb := typed.NewWriteBuffer(buf)
+	wb.WriteUint16(uint16(len(headers)))
+	for k, v := range headers {
+		wb.WriteLen16String(k)
+		wb.WriteLen16String(v)
+	}
+	return buf[:wb.BytesWritten()]
+}
+
+// DecodeHeaders decodes application headers from arg2 of a call using the Thrift arg scheme.
+func DecodeHeaders(arg2 []byte) (map[string]string, error) {
+	if len(arg2) == 0 {
+		return nil, nil
+	}
+
+	rb := typed.NewReadBuffer(arg2)
+	n := int(rb.ReadUint16())
+	headers := make(map[string]string, n)
+	for i := 0; i < n && rb.Err() == nil; i++ {
+		k := rb.ReadLen16String()
+		headers[k] = rb.ReadLen16String()
+	}
+	return headers, rb.Err()
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// Package dynamic makes Thrift calls using an IDL file parsed at runtime, without any
+// generated code. Arguments and results are converted between JSON values and the
+// Thrift binary protocol, which makes it suitable for tools such as tcurl.
+package dynamic
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/samuel/go-thrift/parser"
+)
+
+// IDL is a parsed Thrift IDL file.
+type IDL struct {
+	typedefs map[string]*parser.Type
+	structs  map[string]*parser.Struct
+	enums    map[string]*parser.Enum
+	services map[string]*parser.Service
+}
+
+// Parse parses the given Thrift IDL file.
+func Parse(file string) (*IDL, error) {
+	p := &parser.Parser{}
+	parsed, name, err := p.ParseFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %v: %v", file, err)
+	}
+	v, ok := parsed[name]
+	if !ok {
+		return nil, fmt.Errorf("could not find parsed %v", file)
+	}
+	return newIDL(v), nil
+}
+
+func newIDL(v *parser.Thrift) *IDL {
+	idl := &IDL{
+		typedefs: v.Typedefs,
+		structs:  make(map[string]*parser.Struct),
+		enums:    v.Enums,
+		services: v.Services,
+	}
+	for name, s := range v.Structs {
+		idl.structs[name] = s
+	}
+	for name, s := range v.Exceptions {
+		idl.structs[name] = s
+	}
+	return idl
+}
+
+// Method returns the method for the given operation, which is specified as Service::method.
+// Methods that are inherited from a base service can be called using the derived service.
+func (idl *IDL) Method(operation string) (*Method, error) {
+	parts := strings.Split(operation, "::")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("operation %q must be of the form Service::method", operation)
+	}
+
+	svc, ok := idl.services[parts[0]]
+	for ok {
+		if m, ok := svc.Methods[parts[1]]; ok {
+			return &Method{idl: idl, service: parts[0], method: m}, nil
+		}
+		svc, ok = idl.services[svc.Extends]
+	}
+
+	if _, ok := idl.services[parts[0]]; !ok {
+		return nil, fmt.Errorf("service %v not found", parts[0])
+	}
+	return nil, fmt.Errorf("method %v not found in service %v", parts[1], parts[0])
+}
+
+// Method is a Thrift method that can encode arguments and decode results.
+type Method struct {
+	idl     *IDL
+	service string
+	method  *parser.Method
+}
+
+// Operation returns the operation name used to call this method.
+func (m *Method) Operation() string {
+	return m.service + "::" + m.method.Name
+}
+
+// EncodeArgs encodes args, which maps argument names to JSON values, as the method's
+// Thrift args struct.
+func (m *Method) EncodeArgs(args map[string]interface{}) ([]byte, error) {
+	w := &writer{}
+	if err := m.idl.writeFields(w, m.method.Arguments, args); err != nil {
+		return nil, fmt.Errorf("failed to encode arguments for %v: %v", m.Operation(), err)
+	}
+	return w.buf.Bytes(), w.err
+}
+
+// DecodeResult decodes the method's Thrift result struct. If the method returned
+// successfully, success is true and the return value is returned (or nil if the method
+// is void). Otherwise, the result is a map from the exception's name to its value.
+func (m *Method) DecodeResult(data []byte) (success bool, result interface{}, err error) {
+	fields := m.method.Exceptions
+	if m.method.ReturnType != nil {
+		fields = append([]*parser.Field{{ID: 0, Name: "success", Type: m.method.ReturnType}}, fields...)
+	}
+
+	r := &reader{buf: data}
+	values, err := m.idl.readFields(r, fields)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to decode result for %v: %v", m.Operation(), err)
+	}
+	if v, ok := values["success"]; ok && m.method.ReturnType != nil {
+		return true, v, nil
+	}
+	if len(values) > 0 {
+		return false, values, nil
+	}
+	if m.method.ReturnType != nil {
+		return false, nil, fmt.Errorf("result for %v is missing the return value", m.Operation())
+	}
+	return true, nil, nil
+}
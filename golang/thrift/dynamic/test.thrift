@@ -0,0 +1,42 @@
+typedef string UUID
+
+enum Color {
+  RED = 1,
+  GREEN = 2
+}
+
+struct Inner {
+  1: i64 id,
+  2: optional list<string> tags
+}
+
+struct Everything {
+  1: bool b,
+  2: byte by,
+  3: i16 s,
+  4: i32 i,
+  5: i64 l,
+  6: double d,
+  7: string str,
+  8: binary bin,
+  9: list<i32> nums,
+  10: set<string> names,
+  11: map<string, Inner> byName,
+  12: map<i32, string> byID,
+  13: Color color,
+  14: UUID uuid,
+  15: Inner inner
+}
+
+exception NotFound {
+  1: string message
+}
+
+service Base {
+  string Health()
+}
+
+service Test extends Base {
+  Everything Echo(1: Everything arg) throws (1: NotFound notFound)
+  void Ping()
+}
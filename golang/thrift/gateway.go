@@ -0,0 +1,163 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package thrift
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	tchttp "github.com/uber/tchannel/golang/http"
+)
+
+const defaultGatewayTimeout = time.Second
+
+// TChanGateway abstracts converting a decoded JSON request into a call on a Thrift client,
+// and is implemented by the gateway code that thrift-gen generates with -generateGateway.
+type TChanGateway interface {
+	// Handle should decode the method's arguments using decode and make the call.
+	// The arguments returned are success, the result or declared exception, unexpected error.
+	Handle(ctx Context, methodName string, decode func(args interface{}) error) (success bool, resp interface{}, err error)
+
+	// Service returns the service name.
+	Service() string
+
+	// Methods returns the method names handled by this gateway.
+	Methods() []string
+}
+
+// GatewayOptions are options to customize the gateway.
+type GatewayOptions struct {
+	// Timeout is the timeout used for each call. If it is zero, a timeout of 1 second is used.
+	Timeout time.Duration
+}
+
+// Gateway is an http.Handler that converts HTTP+JSON requests into Thrift calls over TChannel.
+// Requests are made using POST /{service}/{method}, with the method's arguments as a JSON
+// object keyed by the argument names in the IDL. The response body is the JSON result.
+//
+// Errors are returned as a JSON object with the status code set as follows:
+//
+//	400 with {"exception": {name: value}} for exceptions declared in the IDL.
+//	400 with {"error": message} if the request body cannot be decoded.
+//	404 if the service or method is not registered, 405 if the method is not POST.
+//	Other errors map their TChannel error code to a status code, e.g. timeouts return 504.
+type Gateway struct {
+	opts     GatewayOptions
+	mut      sync.RWMutex
+	gateways map[string]TChanGateway
+}
+
+// NewGateway returns a Gateway that does not have any services registered.
+func NewGateway(opts *GatewayOptions) *Gateway {
+	gw := &Gateway{gateways: make(map[string]TChanGateway)}
+	if opts != nil {
+		gw.opts = *opts
+	}
+	if gw.opts.Timeout == 0 {
+		gw.opts.Timeout = defaultGatewayTimeout
+	}
+	return gw
+}
+
+// Register registers the given TChanGateway to serve requests for its service.
+func (g *Gateway) Register(gw TChanGateway) {
+	g.mut.Lock()
+	g.gateways[gw.Service()] = gw
+	g.mut.Unlock()
+}
+
+func (g *Gateway) getGateway(service, method string) (TChanGateway, bool) {
+	g.mut.RLock()
+	gw, ok := g.gateways[service]
+	g.mut.RUnlock()
+	if !ok {
+		return nil, false
+	}
+
+	for _, m := range gw.Methods() {
+		if m == method {
+			return gw, true
+		}
+	}
+	return nil, false
+}
+
+// ServeHTTP implements http.Handler.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 2 {
+		writeJSONError(w, http.StatusNotFound, "path must be /{service}/{method}")
+		return
+	}
+	gw, ok := g.getGateway(parts[0], parts[1])
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "unknown method "+parts[0]+"::"+parts[1])
+		return
+	}
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "method must be POST")
+		return
+	}
+
+	ctx, cancel := NewContext(g.opts.Timeout)
+	defer cancel()
+
+	var decodeErr error
+	decode := func(args interface{}) error {
+		decodeErr = json.NewDecoder(r.Body).Decode(args)
+		if decodeErr == io.EOF {
+			// An empty body is treated as a call without arguments.
+			decodeErr = nil
+		}
+		return decodeErr
+	}
+
+	success, resp, err := gw.Handle(ctx, parts[1], decode)
+	switch {
+	case decodeErr != nil:
+		writeJSONError(w, http.StatusBadRequest, "failed to decode arguments: "+decodeErr.Error())
+	case err != nil:
+		writeJSONError(w, tchttp.StatusForError(err), err.Error())
+	case !success:
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{"exception": resp})
+	default:
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, statusCode int, msg string) {
+	writeJSON(w, statusCode, map[string]string{"error": msg})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		statusCode = http.StatusInternalServerError
+		bs, _ = json.Marshal(map[string]string{"error": "failed to encode response: " + err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(bs)
+}
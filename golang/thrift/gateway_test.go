@@ -0,0 +1,111 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package thrift_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/uber/tchannel/golang/thrift"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	gen "github.com/uber/tchannel/golang/thrift/gen-go/test"
+)
+
+func withGateway(t *testing.T, f func(args testArgs, url string)) {
+	withSetup(t, func(ctx Context, args testArgs) {
+		gw := NewGateway(nil)
+		gw.Register(gen.NewTChanSimpleServiceGateway(args.c1))
+		gw.Register(gen.NewTChanSecondServiceGateway(args.c2))
+
+		server := httptest.NewServer(gw)
+		defer server.Close()
+		f(args, server.URL)
+	})
+}
+
+func postJSON(t *testing.T, url, body string) (int, string) {
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	require.NoError(t, err, "Post failed")
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err, "ReadAll failed")
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"), "Content-Type mismatch")
+	return resp.StatusCode, strings.TrimSpace(string(respBody))
+}
+
+func TestGatewayCall(t *testing.T) {
+	withGateway(t, func(args testArgs, url string) {
+		arg := &gen.Data{B1: true, S2: "str", I3: 102}
+		ret := &gen.Data{B1: false, S2: "return-str", I3: 105}
+		args.s1.On("Call", ctxArg(), arg).Return(ret, nil)
+		args.s2.On("Echo", ctxArg(), "hello").Return("hello-echo", nil)
+		args.s1.On("Simple", ctxArg()).Return(nil)
+
+		status, body := postJSON(t, url+"/SimpleService/Call", `{"arg": {"b1": true, "s2": "str", "i3": 102}}`)
+		assert.Equal(t, http.StatusOK, status, "Call status mismatch")
+		assert.Equal(t, `{"b1":false,"s2":"return-str","i3":105}`, body, "Call body mismatch")
+
+		status, body = postJSON(t, url+"/SecondService/Echo", `{"arg": "hello"}`)
+		assert.Equal(t, http.StatusOK, status, "Echo status mismatch")
+		assert.Equal(t, `"hello-echo"`, body, "Echo body mismatch")
+
+		status, body = postJSON(t, url+"/SimpleService/Simple", "")
+		assert.Equal(t, http.StatusOK, status, "Simple status mismatch")
+		assert.Equal(t, "null", body, "Simple body mismatch")
+	})
+}
+
+func TestGatewayErrors(t *testing.T) {
+	withGateway(t, func(args testArgs, url string) {
+		args.s1.On("Simple", ctxArg()).Return(&gen.SimpleErr{Message: "simple failed"}).Once()
+		args.s1.On("Simple", ctxArg()).Return(errors.New("unexpected err")).Once()
+
+		status, body := postJSON(t, url+"/SimpleService/Simple", "{}")
+		assert.Equal(t, http.StatusBadRequest, status, "exception status mismatch")
+		assert.Equal(t, `{"exception":{"simpleErr":{"message":"simple failed"}}}`, body, "exception body mismatch")
+
+		status, body = postJSON(t, url+"/SimpleService/Simple", "{}")
+		assert.Equal(t, http.StatusInternalServerError, status, "unexpected error status mismatch")
+		assert.Contains(t, body, "unexpected err", "unexpected error body mismatch")
+
+		status, body = postJSON(t, url+"/SecondService/Echo", `{"arg": 1}`)
+		assert.Equal(t, http.StatusBadRequest, status, "bad request status mismatch")
+		assert.Contains(t, body, "failed to decode arguments", "bad request body mismatch")
+
+		status, _ = postJSON(t, url+"/SecondService/Unknown", "{}")
+		assert.Equal(t, http.StatusNotFound, status, "unknown method status mismatch")
+
+		status, _ = postJSON(t, url+"/UnknownService/Echo", "{}")
+		assert.Equal(t, http.StatusNotFound, status, "unknown service status mismatch")
+
+		resp, err := http.Get(url + "/SecondService/Echo")
+		require.NoError(t, err, "Get failed")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode, "GET status mismatch")
+		assert.Equal(t, "POST", resp.Header.Get("Allow"), "Allow header mismatch")
+	})
+}
@@ -15,7 +15,12 @@ var _ = fmt.Printf
 var _ = bytes.Equal
 
 type Meta interface {
-	Health() (r *HealthStatus, err error)
+	// Parameters:
+	//  - Hr
+	Health(hr *HealthRequest) (r *HealthStatus, err error)
+	HealthDetails() (r *DetailedHealthStatus, err error)
+	VersionInfo() (r *VersionInfo, err error)
+	InstanceInfo() (r *InstanceInfo, err error)
 }
 
 type MetaClient struct {
@@ -44,14 +49,16 @@ func NewMetaClientProtocol(t thrift.TTransport, iprot thrift.TProtocol, oprot th
 	}
 }
 
-func (p *MetaClient) Health() (r *HealthStatus, err error) {
-	if err = p.sendHealth(); err != nil {
+// Parameters:
+//  - Hr
+func (p *MetaClient) Health(hr *HealthRequest) (r *HealthStatus, err error) {
+	if err = p.sendHealth(hr); err != nil {
 		return
 	}
 	return p.recvHealth()
 }
 
-func (p *MetaClient) sendHealth() (err error) {
+func (p *MetaClient) sendHealth(hr *HealthRequest) (err error) {
 	oprot := p.OutputProtocol
 	if oprot == nil {
 		oprot = p.ProtocolFactory.GetProtocol(p.Transport)
@@ -61,156 +68,994 @@ func (p *MetaClient) sendHealth() (err error) {
 	if err = oprot.WriteMessageBegin("health", thrift.CALL, p.SeqId); err != nil {
 		return
 	}
-	args := HealthArgs{}
+	args := HealthArgs{
+		Hr: hr,
+	}
+	if err = args.Write(oprot); err != nil {
+		return
+	}
+	if err = oprot.WriteMessageEnd(); err != nil {
+		return
+	}
+	return oprot.Flush()
+}
+
+func (p *MetaClient) recvHealth() (value *HealthStatus, err error) {
+	iprot := p.InputProtocol
+	if iprot == nil {
+		iprot = p.ProtocolFactory.GetProtocol(p.Transport)
+		p.InputProtocol = iprot
+	}
+	_, mTypeId, seqId, err := iprot.ReadMessageBegin()
+	if err != nil {
+		return
+	}
+	if mTypeId == thrift.EXCEPTION {
+		error5 := thrift.NewTApplicationException(thrift.UNKNOWN_APPLICATION_EXCEPTION, "Unknown Exception")
+		var error6 error
+		error6, err = error5.Read(iprot)
+		if err != nil {
+			return
+		}
+		if err = iprot.ReadMessageEnd(); err != nil {
+			return
+		}
+		err = error6
+		return
+	}
+	if p.SeqId != seqId {
+		err = thrift.NewTApplicationException(thrift.BAD_SEQUENCE_ID, "health failed: out of sequence response")
+		return
+	}
+	result := HealthResult{}
+	if err = result.Read(iprot); err != nil {
+		return
+	}
+	if err = iprot.ReadMessageEnd(); err != nil {
+		return
+	}
+	value = result.GetSuccess()
+	return
+}
+
+func (p *MetaClient) HealthDetails() (r *DetailedHealthStatus, err error) {
+	if err = p.sendHealthDetails(); err != nil {
+		return
+	}
+	return p.recvHealthDetails()
+}
+
+func (p *MetaClient) sendHealthDetails() (err error) {
+	oprot := p.OutputProtocol
+	if oprot == nil {
+		oprot = p.ProtocolFactory.GetProtocol(p.Transport)
+		p.OutputProtocol = oprot
+	}
+	p.SeqId++
+	if err = oprot.WriteMessageBegin("healthDetails", thrift.CALL, p.SeqId); err != nil {
+		return
+	}
+	args := HealthDetailsArgs{}
+	if err = args.Write(oprot); err != nil {
+		return
+	}
+	if err = oprot.WriteMessageEnd(); err != nil {
+		return
+	}
+	return oprot.Flush()
+}
+
+func (p *MetaClient) recvHealthDetails() (value *DetailedHealthStatus, err error) {
+	iprot := p.InputProtocol
+	if iprot == nil {
+		iprot = p.ProtocolFactory.GetProtocol(p.Transport)
+		p.InputProtocol = iprot
+	}
+	_, mTypeId, seqId, err := iprot.ReadMessageBegin()
+	if err != nil {
+		return
+	}
+	if mTypeId == thrift.EXCEPTION {
+		error7 := thrift.NewTApplicationException(thrift.UNKNOWN_APPLICATION_EXCEPTION, "Unknown Exception")
+		var error8 error
+		error8, err = error7.Read(iprot)
+		if err != nil {
+			return
+		}
+		if err = iprot.ReadMessageEnd(); err != nil {
+			return
+		}
+		err = error8
+		return
+	}
+	if p.SeqId != seqId {
+		err = thrift.NewTApplicationException(thrift.BAD_SEQUENCE_ID, "healthDetails failed: out of sequence response")
+		return
+	}
+	result := HealthDetailsResult{}
+	if err = result.Read(iprot); err != nil {
+		return
+	}
+	if err = iprot.ReadMessageEnd(); err != nil {
+		return
+	}
+	value = result.GetSuccess()
+	return
+}
+
+func (p *MetaClient) VersionInfo() (r *VersionInfo, err error) {
+	if err = p.sendVersionInfo(); err != nil {
+		return
+	}
+	return p.recvVersionInfo()
+}
+
+func (p *MetaClient) sendVersionInfo() (err error) {
+	oprot := p.OutputProtocol
+	if oprot == nil {
+		oprot = p.ProtocolFactory.GetProtocol(p.Transport)
+		p.OutputProtocol = oprot
+	}
+	p.SeqId++
+	if err = oprot.WriteMessageBegin("versionInfo", thrift.CALL, p.SeqId); err != nil {
+		return
+	}
+	args := VersionInfoArgs{}
+	if err = args.Write(oprot); err != nil {
+		return
+	}
+	if err = oprot.WriteMessageEnd(); err != nil {
+		return
+	}
+	return oprot.Flush()
+}
+
+func (p *MetaClient) recvVersionInfo() (value *VersionInfo, err error) {
+	iprot := p.InputProtocol
+	if iprot == nil {
+		iprot = p.ProtocolFactory.GetProtocol(p.Transport)
+		p.InputProtocol = iprot
+	}
+	_, mTypeId, seqId, err := iprot.ReadMessageBegin()
+	if err != nil {
+		return
+	}
+	if mTypeId == thrift.EXCEPTION {
+		error9 := thrift.NewTApplicationException(thrift.UNKNOWN_APPLICATION_EXCEPTION, "Unknown Exception")
+		var error10 error
+		error10, err = error9.Read(iprot)
+		if err != nil {
+			return
+		}
+		if err = iprot.ReadMessageEnd(); err != nil {
+			return
+		}
+		err = error10
+		return
+	}
+	if p.SeqId != seqId {
+		err = thrift.NewTApplicationException(thrift.BAD_SEQUENCE_ID, "versionInfo failed: out of sequence response")
+		return
+	}
+	result := VersionInfoResult{}
+	if err = result.Read(iprot); err != nil {
+		return
+	}
+	if err = iprot.ReadMessageEnd(); err != nil {
+		return
+	}
+	value = result.GetSuccess()
+	return
+}
+
+func (p *MetaClient) InstanceInfo() (r *InstanceInfo, err error) {
+	if err = p.sendInstanceInfo(); err != nil {
+		return
+	}
+	return p.recvInstanceInfo()
+}
+
+func (p *MetaClient) sendInstanceInfo() (err error) {
+	oprot := p.OutputProtocol
+	if oprot == nil {
+		oprot = p.ProtocolFactory.GetProtocol(p.Transport)
+		p.OutputProtocol = oprot
+	}
+	p.SeqId++
+	if err = oprot.WriteMessageBegin("instanceInfo", thrift.CALL, p.SeqId); err != nil {
+		return
+	}
+	args := InstanceInfoArgs{}
 	if err = args.Write(oprot); err != nil {
 		return
 	}
-	if err = oprot.WriteMessageEnd(); err != nil {
-		return
+	if err = oprot.WriteMessageEnd(); err != nil {
+		return
+	}
+	return oprot.Flush()
+}
+
+func (p *MetaClient) recvInstanceInfo() (value *InstanceInfo, err error) {
+	iprot := p.InputProtocol
+	if iprot == nil {
+		iprot = p.ProtocolFactory.GetProtocol(p.Transport)
+		p.InputProtocol = iprot
+	}
+	_, mTypeId, seqId, err := iprot.ReadMessageBegin()
+	if err != nil {
+		return
+	}
+	if mTypeId == thrift.EXCEPTION {
+		error11 := thrift.NewTApplicationException(thrift.UNKNOWN_APPLICATION_EXCEPTION, "Unknown Exception")
+		var error12 error
+		error12, err = error11.Read(iprot)
+		if err != nil {
+			return
+		}
+		if err = iprot.ReadMessageEnd(); err != nil {
+			return
+		}
+		err = error12
+		return
+	}
+	if p.SeqId != seqId {
+		err = thrift.NewTApplicationException(thrift.BAD_SEQUENCE_ID, "instanceInfo failed: out of sequence response")
+		return
+	}
+	result := InstanceInfoResult{}
+	if err = result.Read(iprot); err != nil {
+		return
+	}
+	if err = iprot.ReadMessageEnd(); err != nil {
+		return
+	}
+	value = result.GetSuccess()
+	return
+}
+
+type MetaProcessor struct {
+	processorMap map[string]thrift.TProcessorFunction
+	handler      Meta
+}
+
+func (p *MetaProcessor) AddToProcessorMap(key string, processor thrift.TProcessorFunction) {
+	p.processorMap[key] = processor
+}
+
+func (p *MetaProcessor) GetProcessorFunction(key string) (processor thrift.TProcessorFunction, ok bool) {
+	processor, ok = p.processorMap[key]
+	return processor, ok
+}
+
+func (p *MetaProcessor) ProcessorMap() map[string]thrift.TProcessorFunction {
+	return p.processorMap
+}
+
+func NewMetaProcessor(handler Meta) *MetaProcessor {
+
+	self13 := &MetaProcessor{handler: handler, processorMap: make(map[string]thrift.TProcessorFunction)}
+	self13.processorMap["health"] = &metaProcessorHealth{handler: handler}
+	self13.processorMap["healthDetails"] = &metaProcessorHealthDetails{handler: handler}
+	self13.processorMap["versionInfo"] = &metaProcessorVersionInfo{handler: handler}
+	self13.processorMap["instanceInfo"] = &metaProcessorInstanceInfo{handler: handler}
+	return self13
+}
+
+func (p *MetaProcessor) Process(iprot, oprot thrift.TProtocol) (success bool, err thrift.TException) {
+	name, _, seqId, err := iprot.ReadMessageBegin()
+	if err != nil {
+		return false, err
+	}
+	if processor, ok := p.GetProcessorFunction(name); ok {
+		return processor.Process(seqId, iprot, oprot)
+	}
+	iprot.Skip(thrift.STRUCT)
+	iprot.ReadMessageEnd()
+	x14 := thrift.NewTApplicationException(thrift.UNKNOWN_METHOD, "Unknown function "+name)
+	oprot.WriteMessageBegin(name, thrift.EXCEPTION, seqId)
+	x14.Write(oprot)
+	oprot.WriteMessageEnd()
+	oprot.Flush()
+	return false, x14
+
+}
+
+type metaProcessorHealth struct {
+	handler Meta
+}
+
+func (p *metaProcessorHealth) Process(seqId int32, iprot, oprot thrift.TProtocol) (success bool, err thrift.TException) {
+	args := HealthArgs{}
+	if err = args.Read(iprot); err != nil {
+		iprot.ReadMessageEnd()
+		x := thrift.NewTApplicationException(thrift.PROTOCOL_ERROR, err.Error())
+		oprot.WriteMessageBegin("health", thrift.EXCEPTION, seqId)
+		x.Write(oprot)
+		oprot.WriteMessageEnd()
+		oprot.Flush()
+		return false, err
+	}
+
+	iprot.ReadMessageEnd()
+	result := HealthResult{}
+	var retval *HealthStatus
+	var err2 error
+	if retval, err2 = p.handler.Health(args.Hr); err2 != nil {
+		x := thrift.NewTApplicationException(thrift.INTERNAL_ERROR, "Internal error processing health: "+err2.Error())
+		oprot.WriteMessageBegin("health", thrift.EXCEPTION, seqId)
+		x.Write(oprot)
+		oprot.WriteMessageEnd()
+		oprot.Flush()
+		return true, err2
+	} else {
+		result.Success = retval
+	}
+	if err2 = oprot.WriteMessageBegin("health", thrift.REPLY, seqId); err2 != nil {
+		err = err2
+	}
+	if err2 = result.Write(oprot); err == nil && err2 != nil {
+		err = err2
+	}
+	if err2 = oprot.WriteMessageEnd(); err == nil && err2 != nil {
+		err = err2
+	}
+	if err2 = oprot.Flush(); err == nil && err2 != nil {
+		err = err2
+	}
+	if err != nil {
+		return
+	}
+	return true, err
+}
+
+type metaProcessorHealthDetails struct {
+	handler Meta
+}
+
+func (p *metaProcessorHealthDetails) Process(seqId int32, iprot, oprot thrift.TProtocol) (success bool, err thrift.TException) {
+	args := HealthDetailsArgs{}
+	if err = args.Read(iprot); err != nil {
+		iprot.ReadMessageEnd()
+		x := thrift.NewTApplicationException(thrift.PROTOCOL_ERROR, err.Error())
+		oprot.WriteMessageBegin("healthDetails", thrift.EXCEPTION, seqId)
+		x.Write(oprot)
+		oprot.WriteMessageEnd()
+		oprot.Flush()
+		return false, err
+	}
+
+	iprot.ReadMessageEnd()
+	result := HealthDetailsResult{}
+	var retval *DetailedHealthStatus
+	var err2 error
+	if retval, err2 = p.handler.HealthDetails(); err2 != nil {
+		x := thrift.NewTApplicationException(thrift.INTERNAL_ERROR, "Internal error processing healthDetails: "+err2.Error())
+		oprot.WriteMessageBegin("healthDetails", thrift.EXCEPTION, seqId)
+		x.Write(oprot)
+		oprot.WriteMessageEnd()
+		oprot.Flush()
+		return true, err2
+	} else {
+		result.Success = retval
+	}
+	if err2 = oprot.WriteMessageBegin("healthDetails", thrift.REPLY, seqId); err2 != nil {
+		err = err2
+	}
+	if err2 = result.Write(oprot); err == nil && err2 != nil {
+		err = err2
+	}
+	if err2 = oprot.WriteMessageEnd(); err == nil && err2 != nil {
+		err = err2
+	}
+	if err2 = oprot.Flush(); err == nil && err2 != nil {
+		err = err2
+	}
+	if err != nil {
+		return
+	}
+	return true, err
+}
+
+type metaProcessorVersionInfo struct {
+	handler Meta
+}
+
+func (p *metaProcessorVersionInfo) Process(seqId int32, iprot, oprot thrift.TProtocol) (success bool, err thrift.TException) {
+	args := VersionInfoArgs{}
+	if err = args.Read(iprot); err != nil {
+		iprot.ReadMessageEnd()
+		x := thrift.NewTApplicationException(thrift.PROTOCOL_ERROR, err.Error())
+		oprot.WriteMessageBegin("versionInfo", thrift.EXCEPTION, seqId)
+		x.Write(oprot)
+		oprot.WriteMessageEnd()
+		oprot.Flush()
+		return false, err
+	}
+
+	iprot.ReadMessageEnd()
+	result := VersionInfoResult{}
+	var retval *VersionInfo
+	var err2 error
+	if retval, err2 = p.handler.VersionInfo(); err2 != nil {
+		x := thrift.NewTApplicationException(thrift.INTERNAL_ERROR, "Internal error processing versionInfo: "+err2.Error())
+		oprot.WriteMessageBegin("versionInfo", thrift.EXCEPTION, seqId)
+		x.Write(oprot)
+		oprot.WriteMessageEnd()
+		oprot.Flush()
+		return true, err2
+	} else {
+		result.Success = retval
+	}
+	if err2 = oprot.WriteMessageBegin("versionInfo", thrift.REPLY, seqId); err2 != nil {
+		err = err2
+	}
+	if err2 = result.Write(oprot); err == nil && err2 != nil {
+		err = err2
+	}
+	if err2 = oprot.WriteMessageEnd(); err == nil && err2 != nil {
+		err = err2
+	}
+	if err2 = oprot.Flush(); err == nil && err2 != nil {
+		err = err2
+	}
+	if err != nil {
+		return
+	}
+	return true, err
+}
+
+type metaProcessorInstanceInfo struct {
+	handler Meta
+}
+
+func (p *metaProcessorInstanceInfo) Process(seqId int32, iprot, oprot thrift.TProtocol) (success bool, err thrift.TException) {
+	args := InstanceInfoArgs{}
+	if err = args.Read(iprot); err != nil {
+		iprot.ReadMessageEnd()
+		x := thrift.NewTApplicationException(thrift.PROTOCOL_ERROR, err.Error())
+		oprot.WriteMessageBegin("instanceInfo", thrift.EXCEPTION, seqId)
+		x.Write(oprot)
+		oprot.WriteMessageEnd()
+		oprot.Flush()
+		return false, err
+	}
+
+	iprot.ReadMessageEnd()
+	result := InstanceInfoResult{}
+	var retval *InstanceInfo
+	var err2 error
+	if retval, err2 = p.handler.InstanceInfo(); err2 != nil {
+		x := thrift.NewTApplicationException(thrift.INTERNAL_ERROR, "Internal error processing instanceInfo: "+err2.Error())
+		oprot.WriteMessageBegin("instanceInfo", thrift.EXCEPTION, seqId)
+		x.Write(oprot)
+		oprot.WriteMessageEnd()
+		oprot.Flush()
+		return true, err2
+	} else {
+		result.Success = retval
+	}
+	if err2 = oprot.WriteMessageBegin("instanceInfo", thrift.REPLY, seqId); err2 != nil {
+		err = err2
+	}
+	if err2 = result.Write(oprot); err == nil && err2 != nil {
+		err = err2
+	}
+	if err2 = oprot.WriteMessageEnd(); err == nil && err2 != nil {
+		err = err2
+	}
+	if err2 = oprot.Flush(); err == nil && err2 != nil {
+		err = err2
+	}
+	if err != nil {
+		return
+	}
+	return true, err
+}
+
+// HELPER FUNCTIONS AND STRUCTURES
+
+type HealthArgs struct {
+	Hr *HealthRequest `thrift:"hr,1" json:"hr"`
+}
+
+func NewHealthArgs() *HealthArgs {
+	return &HealthArgs{}
+}
+
+var HealthArgs_Hr_DEFAULT *HealthRequest
+
+func (p *HealthArgs) GetHr() *HealthRequest {
+	if !p.IsSetHr() {
+		return HealthArgs_Hr_DEFAULT
+	}
+	return p.Hr
+}
+func (p *HealthArgs) IsSetHr() bool {
+	return p.Hr != nil
+}
+
+func (p *HealthArgs) Read(iprot thrift.TProtocol) error {
+	if _, err := iprot.ReadStructBegin(); err != nil {
+		return fmt.Errorf("%T read error: %s", p, err)
+	}
+	for {
+		_, fieldTypeId, fieldId, err := iprot.ReadFieldBegin()
+		if err != nil {
+			return fmt.Errorf("%T field %d read error: %s", p, fieldId, err)
+		}
+		if fieldTypeId == thrift.STOP {
+			break
+		}
+		switch fieldId {
+		case 1:
+			if err := p.ReadField1(iprot); err != nil {
+				return err
+			}
+		default:
+			if err := iprot.Skip(fieldTypeId); err != nil {
+				return err
+			}
+		}
+		if err := iprot.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := iprot.ReadStructEnd(); err != nil {
+		return fmt.Errorf("%T read struct end error: %s", p, err)
+	}
+	return nil
+}
+
+func (p *HealthArgs) ReadField1(iprot thrift.TProtocol) error {
+	p.Hr = &HealthRequest{}
+	if err := p.Hr.Read(iprot); err != nil {
+		return fmt.Errorf("%T error reading struct: %s", p.Hr, err)
+	}
+	return nil
+}
+
+func (p *HealthArgs) Write(oprot thrift.TProtocol) error {
+	if err := oprot.WriteStructBegin("health_args"); err != nil {
+		return fmt.Errorf("%T write struct begin error: %s", p, err)
+	}
+	if err := p.writeField1(oprot); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldStop(); err != nil {
+		return fmt.Errorf("write field stop error: %s", err)
+	}
+	if err := oprot.WriteStructEnd(); err != nil {
+		return fmt.Errorf("write struct stop error: %s", err)
+	}
+	return nil
+}
+
+func (p *HealthArgs) writeField1(oprot thrift.TProtocol) (err error) {
+	if err := oprot.WriteFieldBegin("hr", thrift.STRUCT, 1); err != nil {
+		return fmt.Errorf("%T write field begin error 1:hr: %s", p, err)
+	}
+	if err := p.Hr.Write(oprot); err != nil {
+		return fmt.Errorf("%T error writing struct: %s", p.Hr, err)
+	}
+	if err := oprot.WriteFieldEnd(); err != nil {
+		return fmt.Errorf("%T write field end error 1:hr: %s", p, err)
+	}
+	return err
+}
+
+func (p *HealthArgs) String() string {
+	if p == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("HealthArgs(%+v)", *p)
+}
+
+type HealthResult struct {
+	Success *HealthStatus `thrift:"success,0" json:"success"`
+}
+
+func NewHealthResult() *HealthResult {
+	return &HealthResult{}
+}
+
+var HealthResult_Success_DEFAULT *HealthStatus
+
+func (p *HealthResult) GetSuccess() *HealthStatus {
+	if !p.IsSetSuccess() {
+		return HealthResult_Success_DEFAULT
+	}
+	return p.Success
+}
+func (p *HealthResult) IsSetSuccess() bool {
+	return p.Success != nil
+}
+
+func (p *HealthResult) Read(iprot thrift.TProtocol) error {
+	if _, err := iprot.ReadStructBegin(); err != nil {
+		return fmt.Errorf("%T read error: %s", p, err)
+	}
+	for {
+		_, fieldTypeId, fieldId, err := iprot.ReadFieldBegin()
+		if err != nil {
+			return fmt.Errorf("%T field %d read error: %s", p, fieldId, err)
+		}
+		if fieldTypeId == thrift.STOP {
+			break
+		}
+		switch fieldId {
+		case 0:
+			if err := p.ReadField0(iprot); err != nil {
+				return err
+			}
+		default:
+			if err := iprot.Skip(fieldTypeId); err != nil {
+				return err
+			}
+		}
+		if err := iprot.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := iprot.ReadStructEnd(); err != nil {
+		return fmt.Errorf("%T read struct end error: %s", p, err)
+	}
+	return nil
+}
+
+func (p *HealthResult) ReadField0(iprot thrift.TProtocol) error {
+	p.Success = &HealthStatus{}
+	if err := p.Success.Read(iprot); err != nil {
+		return fmt.Errorf("%T error reading struct: %s", p.Success, err)
+	}
+	return nil
+}
+
+func (p *HealthResult) Write(oprot thrift.TProtocol) error {
+	if err := oprot.WriteStructBegin("health_result"); err != nil {
+		return fmt.Errorf("%T write struct begin error: %s", p, err)
+	}
+	if err := p.writeField0(oprot); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldStop(); err != nil {
+		return fmt.Errorf("write field stop error: %s", err)
+	}
+	if err := oprot.WriteStructEnd(); err != nil {
+		return fmt.Errorf("write struct stop error: %s", err)
+	}
+	return nil
+}
+
+func (p *HealthResult) writeField0(oprot thrift.TProtocol) (err error) {
+	if p.IsSetSuccess() {
+		if err := oprot.WriteFieldBegin("success", thrift.STRUCT, 0); err != nil {
+			return fmt.Errorf("%T write field begin error 0:success: %s", p, err)
+		}
+		if err := p.Success.Write(oprot); err != nil {
+			return fmt.Errorf("%T error writing struct: %s", p.Success, err)
+		}
+		if err := oprot.WriteFieldEnd(); err != nil {
+			return fmt.Errorf("%T write field end error 0:success: %s", p, err)
+		}
+	}
+	return err
+}
+
+func (p *HealthResult) String() string {
+	if p == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("HealthResult(%+v)", *p)
+}
+
+type HealthDetailsArgs struct {
+}
+
+func NewHealthDetailsArgs() *HealthDetailsArgs {
+	return &HealthDetailsArgs{}
+}
+
+func (p *HealthDetailsArgs) Read(iprot thrift.TProtocol) error {
+	if _, err := iprot.ReadStructBegin(); err != nil {
+		return fmt.Errorf("%T read error: %s", p, err)
+	}
+	for {
+		_, fieldTypeId, fieldId, err := iprot.ReadFieldBegin()
+		if err != nil {
+			return fmt.Errorf("%T field %d read error: %s", p, fieldId, err)
+		}
+		if fieldTypeId == thrift.STOP {
+			break
+		}
+		if err := iprot.Skip(fieldTypeId); err != nil {
+			return err
+		}
+		if err := iprot.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := iprot.ReadStructEnd(); err != nil {
+		return fmt.Errorf("%T read struct end error: %s", p, err)
+	}
+	return nil
+}
+
+func (p *HealthDetailsArgs) Write(oprot thrift.TProtocol) error {
+	if err := oprot.WriteStructBegin("healthDetails_args"); err != nil {
+		return fmt.Errorf("%T write struct begin error: %s", p, err)
+	}
+	if err := oprot.WriteFieldStop(); err != nil {
+		return fmt.Errorf("write field stop error: %s", err)
+	}
+	if err := oprot.WriteStructEnd(); err != nil {
+		return fmt.Errorf("write struct stop error: %s", err)
+	}
+	return nil
+}
+
+func (p *HealthDetailsArgs) String() string {
+	if p == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("HealthDetailsArgs(%+v)", *p)
+}
+
+type HealthDetailsResult struct {
+	Success *DetailedHealthStatus `thrift:"success,0" json:"success"`
+}
+
+func NewHealthDetailsResult() *HealthDetailsResult {
+	return &HealthDetailsResult{}
+}
+
+var HealthDetailsResult_Success_DEFAULT *DetailedHealthStatus
+
+func (p *HealthDetailsResult) GetSuccess() *DetailedHealthStatus {
+	if !p.IsSetSuccess() {
+		return HealthDetailsResult_Success_DEFAULT
+	}
+	return p.Success
+}
+func (p *HealthDetailsResult) IsSetSuccess() bool {
+	return p.Success != nil
+}
+
+func (p *HealthDetailsResult) Read(iprot thrift.TProtocol) error {
+	if _, err := iprot.ReadStructBegin(); err != nil {
+		return fmt.Errorf("%T read error: %s", p, err)
+	}
+	for {
+		_, fieldTypeId, fieldId, err := iprot.ReadFieldBegin()
+		if err != nil {
+			return fmt.Errorf("%T field %d read error: %s", p, fieldId, err)
+		}
+		if fieldTypeId == thrift.STOP {
+			break
+		}
+		switch fieldId {
+		case 0:
+			if err := p.ReadField0(iprot); err != nil {
+				return err
+			}
+		default:
+			if err := iprot.Skip(fieldTypeId); err != nil {
+				return err
+			}
+		}
+		if err := iprot.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := iprot.ReadStructEnd(); err != nil {
+		return fmt.Errorf("%T read struct end error: %s", p, err)
 	}
-	return oprot.Flush()
+	return nil
 }
 
-func (p *MetaClient) recvHealth() (value *HealthStatus, err error) {
-	iprot := p.InputProtocol
-	if iprot == nil {
-		iprot = p.ProtocolFactory.GetProtocol(p.Transport)
-		p.InputProtocol = iprot
-	}
-	_, mTypeId, seqId, err := iprot.ReadMessageBegin()
-	if err != nil {
-		return
+func (p *HealthDetailsResult) ReadField0(iprot thrift.TProtocol) error {
+	p.Success = &DetailedHealthStatus{}
+	if err := p.Success.Read(iprot); err != nil {
+		return fmt.Errorf("%T error reading struct: %s", p.Success, err)
 	}
-	if mTypeId == thrift.EXCEPTION {
-		error0 := thrift.NewTApplicationException(thrift.UNKNOWN_APPLICATION_EXCEPTION, "Unknown Exception")
-		var error1 error
-		error1, err = error0.Read(iprot)
-		if err != nil {
-			return
-		}
-		if err = iprot.ReadMessageEnd(); err != nil {
-			return
-		}
-		err = error1
-		return
+	return nil
+}
+
+func (p *HealthDetailsResult) Write(oprot thrift.TProtocol) error {
+	if err := oprot.WriteStructBegin("healthDetails_result"); err != nil {
+		return fmt.Errorf("%T write struct begin error: %s", p, err)
 	}
-	if p.SeqId != seqId {
-		err = thrift.NewTApplicationException(thrift.BAD_SEQUENCE_ID, "health failed: out of sequence response")
-		return
+	if err := p.writeField0(oprot); err != nil {
+		return err
 	}
-	result := HealthResult{}
-	if err = result.Read(iprot); err != nil {
-		return
+	if err := oprot.WriteFieldStop(); err != nil {
+		return fmt.Errorf("write field stop error: %s", err)
 	}
-	if err = iprot.ReadMessageEnd(); err != nil {
-		return
+	if err := oprot.WriteStructEnd(); err != nil {
+		return fmt.Errorf("write struct stop error: %s", err)
 	}
-	value = result.GetSuccess()
-	return
+	return nil
 }
 
-type MetaProcessor struct {
-	processorMap map[string]thrift.TProcessorFunction
-	handler      Meta
+func (p *HealthDetailsResult) writeField0(oprot thrift.TProtocol) (err error) {
+	if p.IsSetSuccess() {
+		if err := oprot.WriteFieldBegin("success", thrift.STRUCT, 0); err != nil {
+			return fmt.Errorf("%T write field begin error 0:success: %s", p, err)
+		}
+		if err := p.Success.Write(oprot); err != nil {
+			return fmt.Errorf("%T error writing struct: %s", p.Success, err)
+		}
+		if err := oprot.WriteFieldEnd(); err != nil {
+			return fmt.Errorf("%T write field end error 0:success: %s", p, err)
+		}
+	}
+	return err
 }
 
-func (p *MetaProcessor) AddToProcessorMap(key string, processor thrift.TProcessorFunction) {
-	p.processorMap[key] = processor
+func (p *HealthDetailsResult) String() string {
+	if p == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("HealthDetailsResult(%+v)", *p)
 }
 
-func (p *MetaProcessor) GetProcessorFunction(key string) (processor thrift.TProcessorFunction, ok bool) {
-	processor, ok = p.processorMap[key]
-	return processor, ok
+type VersionInfoArgs struct {
 }
 
-func (p *MetaProcessor) ProcessorMap() map[string]thrift.TProcessorFunction {
-	return p.processorMap
+func NewVersionInfoArgs() *VersionInfoArgs {
+	return &VersionInfoArgs{}
 }
 
-func NewMetaProcessor(handler Meta) *MetaProcessor {
-
-	self2 := &MetaProcessor{handler: handler, processorMap: make(map[string]thrift.TProcessorFunction)}
-	self2.processorMap["health"] = &metaProcessorHealth{handler: handler}
-	return self2
+func (p *VersionInfoArgs) Read(iprot thrift.TProtocol) error {
+	if _, err := iprot.ReadStructBegin(); err != nil {
+		return fmt.Errorf("%T read error: %s", p, err)
+	}
+	for {
+		_, fieldTypeId, fieldId, err := iprot.ReadFieldBegin()
+		if err != nil {
+			return fmt.Errorf("%T field %d read error: %s", p, fieldId, err)
+		}
+		if fieldTypeId == thrift.STOP {
+			break
+		}
+		if err := iprot.Skip(fieldTypeId); err != nil {
+			return err
+		}
+		if err := iprot.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := iprot.ReadStructEnd(); err != nil {
+		return fmt.Errorf("%T read struct end error: %s", p, err)
+	}
+	return nil
 }
 
-func (p *MetaProcessor) Process(iprot, oprot thrift.TProtocol) (success bool, err thrift.TException) {
-	name, _, seqId, err := iprot.ReadMessageBegin()
-	if err != nil {
-		return false, err
+func (p *VersionInfoArgs) Write(oprot thrift.TProtocol) error {
+	if err := oprot.WriteStructBegin("versionInfo_args"); err != nil {
+		return fmt.Errorf("%T write struct begin error: %s", p, err)
 	}
-	if processor, ok := p.GetProcessorFunction(name); ok {
-		return processor.Process(seqId, iprot, oprot)
+	if err := oprot.WriteFieldStop(); err != nil {
+		return fmt.Errorf("write field stop error: %s", err)
 	}
-	iprot.Skip(thrift.STRUCT)
-	iprot.ReadMessageEnd()
-	x3 := thrift.NewTApplicationException(thrift.UNKNOWN_METHOD, "Unknown function "+name)
-	oprot.WriteMessageBegin(name, thrift.EXCEPTION, seqId)
-	x3.Write(oprot)
-	oprot.WriteMessageEnd()
-	oprot.Flush()
-	return false, x3
+	if err := oprot.WriteStructEnd(); err != nil {
+		return fmt.Errorf("write struct stop error: %s", err)
+	}
+	return nil
+}
 
+func (p *VersionInfoArgs) String() string {
+	if p == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("VersionInfoArgs(%+v)", *p)
 }
 
-type metaProcessorHealth struct {
-	handler Meta
+type VersionInfoResult struct {
+	Success *VersionInfo `thrift:"success,0" json:"success"`
 }
 
-func (p *metaProcessorHealth) Process(seqId int32, iprot, oprot thrift.TProtocol) (success bool, err thrift.TException) {
-	args := HealthArgs{}
-	if err = args.Read(iprot); err != nil {
-		iprot.ReadMessageEnd()
-		x := thrift.NewTApplicationException(thrift.PROTOCOL_ERROR, err.Error())
-		oprot.WriteMessageBegin("health", thrift.EXCEPTION, seqId)
-		x.Write(oprot)
-		oprot.WriteMessageEnd()
-		oprot.Flush()
-		return false, err
+func NewVersionInfoResult() *VersionInfoResult {
+	return &VersionInfoResult{}
+}
+
+var VersionInfoResult_Success_DEFAULT *VersionInfo
+
+func (p *VersionInfoResult) GetSuccess() *VersionInfo {
+	if !p.IsSetSuccess() {
+		return VersionInfoResult_Success_DEFAULT
 	}
+	return p.Success
+}
+func (p *VersionInfoResult) IsSetSuccess() bool {
+	return p.Success != nil
+}
 
-	iprot.ReadMessageEnd()
-	result := HealthResult{}
-	var retval *HealthStatus
-	var err2 error
-	if retval, err2 = p.handler.Health(); err2 != nil {
-		x := thrift.NewTApplicationException(thrift.INTERNAL_ERROR, "Internal error processing health: "+err2.Error())
-		oprot.WriteMessageBegin("health", thrift.EXCEPTION, seqId)
-		x.Write(oprot)
-		oprot.WriteMessageEnd()
-		oprot.Flush()
-		return true, err2
-	} else {
-		result.Success = retval
+func (p *VersionInfoResult) Read(iprot thrift.TProtocol) error {
+	if _, err := iprot.ReadStructBegin(); err != nil {
+		return fmt.Errorf("%T read error: %s", p, err)
 	}
-	if err2 = oprot.WriteMessageBegin("health", thrift.REPLY, seqId); err2 != nil {
-		err = err2
+	for {
+		_, fieldTypeId, fieldId, err := iprot.ReadFieldBegin()
+		if err != nil {
+			return fmt.Errorf("%T field %d read error: %s", p, fieldId, err)
+		}
+		if fieldTypeId == thrift.STOP {
+			break
+		}
+		switch fieldId {
+		case 0:
+			if err := p.ReadField0(iprot); err != nil {
+				return err
+			}
+		default:
+			if err := iprot.Skip(fieldTypeId); err != nil {
+				return err
+			}
+		}
+		if err := iprot.ReadFieldEnd(); err != nil {
+			return err
+		}
 	}
-	if err2 = result.Write(oprot); err == nil && err2 != nil {
-		err = err2
+	if err := iprot.ReadStructEnd(); err != nil {
+		return fmt.Errorf("%T read struct end error: %s", p, err)
 	}
-	if err2 = oprot.WriteMessageEnd(); err == nil && err2 != nil {
-		err = err2
+	return nil
+}
+
+func (p *VersionInfoResult) ReadField0(iprot thrift.TProtocol) error {
+	p.Success = &VersionInfo{}
+	if err := p.Success.Read(iprot); err != nil {
+		return fmt.Errorf("%T error reading struct: %s", p.Success, err)
 	}
-	if err2 = oprot.Flush(); err == nil && err2 != nil {
-		err = err2
+	return nil
+}
+
+func (p *VersionInfoResult) Write(oprot thrift.TProtocol) error {
+	if err := oprot.WriteStructBegin("versionInfo_result"); err != nil {
+		return fmt.Errorf("%T write struct begin error: %s", p, err)
 	}
-	if err != nil {
-		return
+	if err := p.writeField0(oprot); err != nil {
+		return err
 	}
-	return true, err
+	if err := oprot.WriteFieldStop(); err != nil {
+		return fmt.Errorf("write field stop error: %s", err)
+	}
+	if err := oprot.WriteStructEnd(); err != nil {
+		return fmt.Errorf("write struct stop error: %s", err)
+	}
+	return nil
 }
 
-// HELPER FUNCTIONS AND STRUCTURES
+func (p *VersionInfoResult) writeField0(oprot thrift.TProtocol) (err error) {
+	if p.IsSetSuccess() {
+		if err := oprot.WriteFieldBegin("success", thrift.STRUCT, 0); err != nil {
+			return fmt.Errorf("%T write field begin error 0:success: %s", p, err)
+		}
+		if err := p.Success.Write(oprot); err != nil {
+			return fmt.Errorf("%T error writing struct: %s", p.Success, err)
+		}
+		if err := oprot.WriteFieldEnd(); err != nil {
+			return fmt.Errorf("%T write field end error 0:success: %s", p, err)
+		}
+	}
+	return err
+}
 
-type HealthArgs struct {
+func (p *VersionInfoResult) String() string {
+	if p == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("VersionInfoResult(%+v)", *p)
 }
 
-func NewHealthArgs() *HealthArgs {
-	return &HealthArgs{}
+type InstanceInfoArgs struct {
 }
 
-func (p *HealthArgs) Read(iprot thrift.TProtocol) error {
+func NewInstanceInfoArgs() *InstanceInfoArgs {
+	return &InstanceInfoArgs{}
+}
+
+func (p *InstanceInfoArgs) Read(iprot thrift.TProtocol) error {
 	if _, err := iprot.ReadStructBegin(); err != nil {
 		return fmt.Errorf("%T read error: %s", p, err)
 	}
@@ -235,8 +1080,8 @@ func (p *HealthArgs) Read(iprot thrift.TProtocol) error {
 	return nil
 }
 
-func (p *HealthArgs) Write(oprot thrift.TProtocol) error {
-	if err := oprot.WriteStructBegin("health_args"); err != nil {
+func (p *InstanceInfoArgs) Write(oprot thrift.TProtocol) error {
+	if err := oprot.WriteStructBegin("instanceInfo_args"); err != nil {
 		return fmt.Errorf("%T write struct begin error: %s", p, err)
 	}
 	if err := oprot.WriteFieldStop(); err != nil {
@@ -248,34 +1093,34 @@ func (p *HealthArgs) Write(oprot thrift.TProtocol) error {
 	return nil
 }
 
-func (p *HealthArgs) String() string {
+func (p *InstanceInfoArgs) String() string {
 	if p == nil {
 		return "<nil>"
 	}
-	return fmt.Sprintf("HealthArgs(%+v)", *p)
+	return fmt.Sprintf("InstanceInfoArgs(%+v)", *p)
 }
 
-type HealthResult struct {
-	Success *HealthStatus `thrift:"success,0" json:"success"`
+type InstanceInfoResult struct {
+	Success *InstanceInfo `thrift:"success,0" json:"success"`
 }
 
-func NewHealthResult() *HealthResult {
-	return &HealthResult{}
+func NewInstanceInfoResult() *InstanceInfoResult {
+	return &InstanceInfoResult{}
 }
 
-var HealthResult_Success_DEFAULT *HealthStatus
+var InstanceInfoResult_Success_DEFAULT *InstanceInfo
 
-func (p *HealthResult) GetSuccess() *HealthStatus {
+func (p *InstanceInfoResult) GetSuccess() *InstanceInfo {
 	if !p.IsSetSuccess() {
-		return HealthResult_Success_DEFAULT
+		return InstanceInfoResult_Success_DEFAULT
 	}
 	return p.Success
 }
-func (p *HealthResult) IsSetSuccess() bool {
+func (p *InstanceInfoResult) IsSetSuccess() bool {
 	return p.Success != nil
 }
 
-func (p *HealthResult) Read(iprot thrift.TProtocol) error {
+func (p *InstanceInfoResult) Read(iprot thrift.TProtocol) error {
 	if _, err := iprot.ReadStructBegin(); err != nil {
 		return fmt.Errorf("%T read error: %s", p, err)
 	}
@@ -307,16 +1152,16 @@ func (p *HealthResult) Read(iprot thrift.TProtocol) error {
 	return nil
 }
 
-func (p *HealthResult) ReadField0(iprot thrift.TProtocol) error {
-	p.Success = &HealthStatus{}
+func (p *InstanceInfoResult) ReadField0(iprot thrift.TProtocol) error {
+	p.Success = &InstanceInfo{}
 	if err := p.Success.Read(iprot); err != nil {
 		return fmt.Errorf("%T error reading struct: %s", p.Success, err)
 	}
 	return nil
 }
 
-func (p *HealthResult) Write(oprot thrift.TProtocol) error {
-	if err := oprot.WriteStructBegin("health_result"); err != nil {
+func (p *InstanceInfoResult) Write(oprot thrift.TProtocol) error {
+	if err := oprot.WriteStructBegin("instanceInfo_result"); err != nil {
 		return fmt.Errorf("%T write struct begin error: %s", p, err)
 	}
 	if err := p.writeField0(oprot); err != nil {
@@ -331,7 +1176,7 @@ func (p *HealthResult) Write(oprot thrift.TProtocol) error {
 	return nil
 }
 
-func (p *HealthResult) writeField0(oprot thrift.TProtocol) (err error) {
+func (p *InstanceInfoResult) writeField0(oprot thrift.TProtocol) (err error) {
 	if p.IsSetSuccess() {
 		if err := oprot.WriteFieldBegin("success", thrift.STRUCT, 0); err != nil {
 			return fmt.Errorf("%T write field begin error 0:success: %s", p, err)
@@ -346,9 +1191,9 @@ func (p *HealthResult) writeField0(oprot thrift.TProtocol) (err error) {
 	return err
 }
 
-func (p *HealthResult) String() string {
+func (p *InstanceInfoResult) String() string {
 	if p == nil {
 		return "<nil>"
 	}
-	return fmt.Sprintf("HealthResult(%+v)", *p)
+	return fmt.Sprintf("InstanceInfoResult(%+v)", *p)
 }
@@ -16,6 +16,135 @@ var _ = bytes.Equal
 
 var GoUnusedProtection__ int
 
+type HealthRequestType int64
+
+const (
+	HealthRequestType_PROCESS HealthRequestType = 0
+	HealthRequestType_TRAFFIC HealthRequestType = 1
+)
+
+func (p HealthRequestType) String() string {
+	switch p {
+	case HealthRequestType_PROCESS:
+		return "HealthRequestType_PROCESS"
+	case HealthRequestType_TRAFFIC:
+		return "HealthRequestType_TRAFFIC"
+	}
+	return "<UNSET>"
+}
+
+func HealthRequestTypeFromString(s string) (HealthRequestType, error) {
+	switch s {
+	case "HealthRequestType_PROCESS":
+		return HealthRequestType_PROCESS, nil
+	case "HealthRequestType_TRAFFIC":
+		return HealthRequestType_TRAFFIC, nil
+	}
+	return HealthRequestType(0), fmt.Errorf("not a valid HealthRequestType string")
+}
+
+func HealthRequestTypePtr(v HealthRequestType) *HealthRequestType { return &v }
+
+type HealthRequest struct {
+	Type *HealthRequestType `thrift:"type,1" json:"type"`
+}
+
+func NewHealthRequest() *HealthRequest {
+	return &HealthRequest{}
+}
+
+var HealthRequest_Type_DEFAULT HealthRequestType
+
+func (p *HealthRequest) GetType() HealthRequestType {
+	if !p.IsSetType() {
+		return HealthRequest_Type_DEFAULT
+	}
+	return *p.Type
+}
+func (p *HealthRequest) IsSetType() bool {
+	return p.Type != nil
+}
+
+func (p *HealthRequest) Read(iprot thrift.TProtocol) error {
+	if _, err := iprot.ReadStructBegin(); err != nil {
+		return fmt.Errorf("%T read error: %s", p, err)
+	}
+	for {
+		_, fieldTypeId, fieldId, err := iprot.ReadFieldBegin()
+		if err != nil {
+			return fmt.Errorf("%T field %d read error: %s", p, fieldId, err)
+		}
+		if fieldTypeId == thrift.STOP {
+			break
+		}
+		switch fieldId {
+		case 1:
+			if err := p.ReadField1(iprot); err != nil {
+				return err
+			}
+		default:
+			if err := iprot.Skip(fieldTypeId); err != nil {
+				return err
+			}
+		}
+		if err := iprot.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := iprot.ReadStructEnd(); err != nil {
+		return fmt.Errorf("%T read struct end error: %s", p, err)
+	}
+	return nil
+}
+
+func (p *HealthRequest) ReadField1(iprot thrift.TProtocol) error {
+	if v, err := iprot.ReadI32(); err != nil {
+		return fmt.Errorf("error reading field 1: %s", err)
+	} else {
+		temp := HealthRequestType(v)
+		p.Type = &temp
+	}
+	return nil
+}
+
+func (p *HealthRequest) Write(oprot thrift.TProtocol) error {
+	if err := oprot.WriteStructBegin("HealthRequest"); err != nil {
+		return fmt.Errorf("%T write struct begin error: %s", p, err)
+	}
+	if err := p.writeField1(oprot); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldStop(); err != nil {
+		return fmt.Errorf("write field stop error: %s", err)
+	}
+	if err := oprot.WriteStructEnd(); err != nil {
+		return fmt.Errorf("write struct stop error: %s", err)
+	}
+	return nil
+}
+
+func (p *HealthRequest) writeField1(oprot thrift.TProtocol) (err error) {
+	if p.IsSetType() {
+		if err := oprot.WriteFieldBegin("type", thrift.I32, 1); err != nil {
+			return fmt.Errorf("%T write field begin error 1:type: %s", p, err)
+		}
+		if err := oprot.WriteI32(int32(*p.Type)); err != nil {
+			return fmt.Errorf("%T.type (1) field write error: %s", p, err)
+		}
+		if err := oprot.WriteFieldEnd(); err != nil {
+			return fmt.Errorf("%T write field end error 1:type: %s", p, err)
+		}
+	}
+	return err
+}
+
+func (p *HealthRequest) String() string {
+	if p == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("HealthRequest(%+v)", *p)
+}
+
 type HealthStatus struct {
 	Ok      bool    `thrift:"ok,1,required" json:"ok"`
 	Message *string `thrift:"message,2" json:"message"`
@@ -148,3 +277,842 @@ func (p *HealthStatus) String() string {
 	}
 	return fmt.Sprintf("HealthStatus(%+v)", *p)
 }
+
+type ComponentHealth struct {
+	Name          string  `thrift:"name,1,required" json:"name"`
+	Ok            bool    `thrift:"ok,2,required" json:"ok"`
+	Message       *string `thrift:"message,3" json:"message"`
+	LatencyMicros int64   `thrift:"latencyMicros,4,required" json:"latencyMicros"`
+}
+
+func NewComponentHealth() *ComponentHealth {
+	return &ComponentHealth{}
+}
+
+func (p *ComponentHealth) GetName() string {
+	return p.Name
+}
+
+func (p *ComponentHealth) GetOk() bool {
+	return p.Ok
+}
+
+var ComponentHealth_Message_DEFAULT string
+
+func (p *ComponentHealth) GetMessage() string {
+	if !p.IsSetMessage() {
+		return ComponentHealth_Message_DEFAULT
+	}
+	return *p.Message
+}
+
+func (p *ComponentHealth) GetLatencyMicros() int64 {
+	return p.LatencyMicros
+}
+func (p *ComponentHealth) IsSetMessage() bool {
+	return p.Message != nil
+}
+
+func (p *ComponentHealth) Read(iprot thrift.TProtocol) error {
+	if _, err := iprot.ReadStructBegin(); err != nil {
+		return fmt.Errorf("%T read error: %s", p, err)
+	}
+	for {
+		_, fieldTypeId, fieldId, err := iprot.ReadFieldBegin()
+		if err != nil {
+			return fmt.Errorf("%T field %d read error: %s", p, fieldId, err)
+		}
+		if fieldTypeId == thrift.STOP {
+			break
+		}
+		switch fieldId {
+		case 1:
+			if err := p.ReadField1(iprot); err != nil {
+				return err
+			}
+		case 2:
+			if err := p.ReadField2(iprot); err != nil {
+				return err
+			}
+		case 3:
+			if err := p.ReadField3(iprot); err != nil {
+				return err
+			}
+		case 4:
+			if err := p.ReadField4(iprot); err != nil {
+				return err
+			}
+		default:
+			if err := iprot.Skip(fieldTypeId); err != nil {
+				return err
+			}
+		}
+		if err := iprot.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := iprot.ReadStructEnd(); err != nil {
+		return fmt.Errorf("%T read struct end error: %s", p, err)
+	}
+	return nil
+}
+
+func (p *ComponentHealth) ReadField1(iprot thrift.TProtocol) error {
+	if v, err := iprot.ReadString(); err != nil {
+		return fmt.Errorf("error reading field 1: %s", err)
+	} else {
+		p.Name = v
+	}
+	return nil
+}
+
+func (p *ComponentHealth) ReadField2(iprot thrift.TProtocol) error {
+	if v, err := iprot.ReadBool(); err != nil {
+		return fmt.Errorf("error reading field 2: %s", err)
+	} else {
+		p.Ok = v
+	}
+	return nil
+}
+
+func (p *ComponentHealth) ReadField3(iprot thrift.TProtocol) error {
+	if v, err := iprot.ReadString(); err != nil {
+		return fmt.Errorf("error reading field 3: %s", err)
+	} else {
+		p.Message = &v
+	}
+	return nil
+}
+
+func (p *ComponentHealth) ReadField4(iprot thrift.TProtocol) error {
+	if v, err := iprot.ReadI64(); err != nil {
+		return fmt.Errorf("error reading field 4: %s", err)
+	} else {
+		p.LatencyMicros = v
+	}
+	return nil
+}
+
+func (p *ComponentHealth) Write(oprot thrift.TProtocol) error {
+	if err := oprot.WriteStructBegin("ComponentHealth"); err != nil {
+		return fmt.Errorf("%T write struct begin error: %s", p, err)
+	}
+	if err := p.writeField1(oprot); err != nil {
+		return err
+	}
+	if err := p.writeField2(oprot); err != nil {
+		return err
+	}
+	if err := p.writeField3(oprot); err != nil {
+		return err
+	}
+	if err := p.writeField4(oprot); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldStop(); err != nil {
+		return fmt.Errorf("write field stop error: %s", err)
+	}
+	if err := oprot.WriteStructEnd(); err != nil {
+		return fmt.Errorf("write struct stop error: %s", err)
+	}
+	return nil
+}
+
+func (p *ComponentHealth) writeField1(oprot thrift.TProtocol) (err error) {
+	if err := oprot.WriteFieldBegin("name", thrift.STRING, 1); err != nil {
+		return fmt.Errorf("%T write field begin error 1:name: %s", p, err)
+	}
+	if err := oprot.WriteString(string(p.Name)); err != nil {
+		return fmt.Errorf("%T.name (1) field write error: %s", p, err)
+	}
+	if err := oprot.WriteFieldEnd(); err != nil {
+		return fmt.Errorf("%T write field end error 1:name: %s", p, err)
+	}
+	return err
+}
+
+func (p *ComponentHealth) writeField2(oprot thrift.TProtocol) (err error) {
+	if err := oprot.WriteFieldBegin("ok", thrift.BOOL, 2); err != nil {
+		return fmt.Errorf("%T write field begin error 2:ok: %s", p, err)
+	}
+	if err := oprot.WriteBool(bool(p.Ok)); err != nil {
+		return fmt.Errorf("%T.ok (2) field write error: %s", p, err)
+	}
+	if err := oprot.WriteFieldEnd(); err != nil {
+		return fmt.Errorf("%T write field end error 2:ok: %s", p, err)
+	}
+	return err
+}
+
+func (p *ComponentHealth) writeField3(oprot thrift.TProtocol) (err error) {
+	if p.IsSetMessage() {
+		if err := oprot.WriteFieldBegin("message", thrift.STRING, 3); err != nil {
+			return fmt.Errorf("%T write field begin error 3:message: %s", p, err)
+		}
+		if err := oprot.WriteString(string(*p.Message)); err != nil {
+			return fmt.Errorf("%T.message (3) field write error: %s", p, err)
+		}
+		if err := oprot.WriteFieldEnd(); err != nil {
+			return fmt.Errorf("%T write field end error 3:message: %s", p, err)
+		}
+	}
+	return err
+}
+
+func (p *ComponentHealth) writeField4(oprot thrift.TProtocol) (err error) {
+	if err := oprot.WriteFieldBegin("latencyMicros", thrift.I64, 4); err != nil {
+		return fmt.Errorf("%T write field begin error 4:latencyMicros: %s", p, err)
+	}
+	if err := oprot.WriteI64(int64(p.LatencyMicros)); err != nil {
+		return fmt.Errorf("%T.latencyMicros (4) field write error: %s", p, err)
+	}
+	if err := oprot.WriteFieldEnd(); err != nil {
+		return fmt.Errorf("%T write field end error 4:latencyMicros: %s", p, err)
+	}
+	return err
+}
+
+func (p *ComponentHealth) String() string {
+	if p == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("ComponentHealth(%+v)", *p)
+}
+
+type DetailedHealthStatus struct {
+	Ok         bool               `thrift:"ok,1,required" json:"ok"`
+	Message    *string            `thrift:"message,2" json:"message"`
+	Components []*ComponentHealth `thrift:"components,3,required" json:"components"`
+}
+
+func NewDetailedHealthStatus() *DetailedHealthStatus {
+	return &DetailedHealthStatus{}
+}
+
+func (p *DetailedHealthStatus) GetOk() bool {
+	return p.Ok
+}
+
+var DetailedHealthStatus_Message_DEFAULT string
+
+func (p *DetailedHealthStatus) GetMessage() string {
+	if !p.IsSetMessage() {
+		return DetailedHealthStatus_Message_DEFAULT
+	}
+	return *p.Message
+}
+
+func (p *DetailedHealthStatus) GetComponents() []*ComponentHealth {
+	return p.Components
+}
+func (p *DetailedHealthStatus) IsSetMessage() bool {
+	return p.Message != nil
+}
+
+func (p *DetailedHealthStatus) Read(iprot thrift.TProtocol) error {
+	if _, err := iprot.ReadStructBegin(); err != nil {
+		return fmt.Errorf("%T read error: %s", p, err)
+	}
+	for {
+		_, fieldTypeId, fieldId, err := iprot.ReadFieldBegin()
+		if err != nil {
+			return fmt.Errorf("%T field %d read error: %s", p, fieldId, err)
+		}
+		if fieldTypeId == thrift.STOP {
+			break
+		}
+		switch fieldId {
+		case 1:
+			if err := p.ReadField1(iprot); err != nil {
+				return err
+			}
+		case 2:
+			if err := p.ReadField2(iprot); err != nil {
+				return err
+			}
+		case 3:
+			if err := p.ReadField3(iprot); err != nil {
+				return err
+			}
+		default:
+			if err := iprot.Skip(fieldTypeId); err != nil {
+				return err
+			}
+		}
+		if err := iprot.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := iprot.ReadStructEnd(); err != nil {
+		return fmt.Errorf("%T read struct end error: %s", p, err)
+	}
+	return nil
+}
+
+func (p *DetailedHealthStatus) ReadField1(iprot thrift.TProtocol) error {
+	if v, err := iprot.ReadBool(); err != nil {
+		return fmt.Errorf("error reading field 1: %s", err)
+	} else {
+		p.Ok = v
+	}
+	return nil
+}
+
+func (p *DetailedHealthStatus) ReadField2(iprot thrift.TProtocol) error {
+	if v, err := iprot.ReadString(); err != nil {
+		return fmt.Errorf("error reading field 2: %s", err)
+	} else {
+		p.Message = &v
+	}
+	return nil
+}
+
+func (p *DetailedHealthStatus) ReadField3(iprot thrift.TProtocol) error {
+	_, size, err := iprot.ReadListBegin()
+	if err != nil {
+		return fmt.Errorf("error reading list begin: %s", err)
+	}
+	tSlice := make([]*ComponentHealth, 0, size)
+	p.Components = tSlice
+	for i := 0; i < size; i++ {
+		_elem0 := &ComponentHealth{}
+		if err := _elem0.Read(iprot); err != nil {
+			return fmt.Errorf("%T error reading struct: %s", _elem0, err)
+		}
+		p.Components = append(p.Components, _elem0)
+	}
+	if err := iprot.ReadListEnd(); err != nil {
+		return fmt.Errorf("error reading list end: %s", err)
+	}
+	return nil
+}
+
+func (p *DetailedHealthStatus) Write(oprot thrift.TProtocol) error {
+	if err := oprot.WriteStructBegin("DetailedHealthStatus"); err != nil {
+		return fmt.Errorf("%T write struct begin error: %s", p, err)
+	}
+	if err := p.writeField1(oprot); err != nil {
+		return err
+	}
+	if err := p.writeField2(oprot); err != nil {
+		return err
+	}
+	if err := p.writeField3(oprot); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldStop(); err != nil {
+		return fmt.Errorf("write field stop error: %s", err)
+	}
+	if err := oprot.WriteStructEnd(); err != nil {
+		return fmt.Errorf("write struct stop error: %s", err)
+	}
+	return nil
+}
+
+func (p *DetailedHealthStatus) writeField1(oprot thrift.TProtocol) (err error) {
+	if err := oprot.WriteFieldBegin("ok", thrift.BOOL, 1); err != nil {
+		return fmt.Errorf("%T write field begin error 1:ok: %s", p, err)
+	}
+	if err := oprot.WriteBool(bool(p.Ok)); err != nil {
+		return fmt.Errorf("%T.ok (1) field write error: %s", p, err)
+	}
+	if err := oprot.WriteFieldEnd(); err != nil {
+		return fmt.Errorf("%T write field end error 1:ok: %s", p, err)
+	}
+	return err
+}
+
+func (p *DetailedHealthStatus) writeField2(oprot thrift.TProtocol) (err error) {
+	if p.IsSetMessage() {
+		if err := oprot.WriteFieldBegin("message", thrift.STRING, 2); err != nil {
+			return fmt.Errorf("%T write field begin error 2:message: %s", p, err)
+		}
+		if err := oprot.WriteString(string(*p.Message)); err != nil {
+			return fmt.Errorf("%T.message (2) field write error: %s", p, err)
+		}
+		if err := oprot.WriteFieldEnd(); err != nil {
+			return fmt.Errorf("%T write field end error 2:message: %s", p, err)
+		}
+	}
+	return err
+}
+
+func (p *DetailedHealthStatus) writeField3(oprot thrift.TProtocol) (err error) {
+	if err := oprot.WriteFieldBegin("components", thrift.LIST, 3); err != nil {
+		return fmt.Errorf("%T write field begin error 3:components: %s", p, err)
+	}
+	if err := oprot.WriteListBegin(thrift.STRUCT, len(p.Components)); err != nil {
+		return fmt.Errorf("error writing list begin: %s", err)
+	}
+	for _, v := range p.Components {
+		if err := v.Write(oprot); err != nil {
+			return fmt.Errorf("%T error writing struct: %s", v, err)
+		}
+	}
+	if err := oprot.WriteListEnd(); err != nil {
+		return fmt.Errorf("error writing list end: %s", err)
+	}
+	if err := oprot.WriteFieldEnd(); err != nil {
+		return fmt.Errorf("%T write field end error 3:components: %s", p, err)
+	}
+	return err
+}
+
+func (p *DetailedHealthStatus) String() string {
+	if p == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("DetailedHealthStatus(%+v)", *p)
+}
+
+type VersionInfo struct {
+	Language        string   `thrift:"language,1,required" json:"language"`
+	LanguageVersion string   `thrift:"languageVersion,2,required" json:"languageVersion"`
+	Version         string   `thrift:"version,3,required" json:"version"`
+	ProtocolVersion int32    `thrift:"protocolVersion,4,required" json:"protocolVersion"`
+	Features        []string `thrift:"features,5,required" json:"features"`
+}
+
+func NewVersionInfo() *VersionInfo {
+	return &VersionInfo{}
+}
+
+func (p *VersionInfo) GetLanguage() string {
+	return p.Language
+}
+
+func (p *VersionInfo) GetLanguageVersion() string {
+	return p.LanguageVersion
+}
+
+func (p *VersionInfo) GetVersion() string {
+	return p.Version
+}
+
+func (p *VersionInfo) GetProtocolVersion() int32 {
+	return p.ProtocolVersion
+}
+
+func (p *VersionInfo) GetFeatures() []string {
+	return p.Features
+}
+func (p *VersionInfo) Read(iprot thrift.TProtocol) error {
+	if _, err := iprot.ReadStructBegin(); err != nil {
+		return fmt.Errorf("%T read error: %s", p, err)
+	}
+	for {
+		_, fieldTypeId, fieldId, err := iprot.ReadFieldBegin()
+		if err != nil {
+			return fmt.Errorf("%T field %d read error: %s", p, fieldId, err)
+		}
+		if fieldTypeId == thrift.STOP {
+			break
+		}
+		switch fieldId {
+		case 1:
+			if err := p.ReadField1(iprot); err != nil {
+				return err
+			}
+		case 2:
+			if err := p.ReadField2(iprot); err != nil {
+				return err
+			}
+		case 3:
+			if err := p.ReadField3(iprot); err != nil {
+				return err
+			}
+		case 4:
+			if err := p.ReadField4(iprot); err != nil {
+				return err
+			}
+		case 5:
+			if err := p.ReadField5(iprot); err != nil {
+				return err
+			}
+		default:
+			if err := iprot.Skip(fieldTypeId); err != nil {
+				return err
+			}
+		}
+		if err := iprot.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := iprot.ReadStructEnd(); err != nil {
+		return fmt.Errorf("%T read struct end error: %s", p, err)
+	}
+	return nil
+}
+
+func (p *VersionInfo) ReadField1(iprot thrift.TProtocol) error {
+	if v, err := iprot.ReadString(); err != nil {
+		return fmt.Errorf("error reading field 1: %s", err)
+	} else {
+		p.Language = v
+	}
+	return nil
+}
+
+func (p *VersionInfo) ReadField2(iprot thrift.TProtocol) error {
+	if v, err := iprot.ReadString(); err != nil {
+		return fmt.Errorf("error reading field 2: %s", err)
+	} else {
+		p.LanguageVersion = v
+	}
+	return nil
+}
+
+func (p *VersionInfo) ReadField3(iprot thrift.TProtocol) error {
+	if v, err := iprot.ReadString(); err != nil {
+		return fmt.Errorf("error reading field 3: %s", err)
+	} else {
+		p.Version = v
+	}
+	return nil
+}
+
+func (p *VersionInfo) ReadField4(iprot thrift.TProtocol) error {
+	if v, err := iprot.ReadI32(); err != nil {
+		return fmt.Errorf("error reading field 4: %s", err)
+	} else {
+		p.ProtocolVersion = v
+	}
+	return nil
+}
+
+func (p *VersionInfo) ReadField5(iprot thrift.TProtocol) error {
+	_, size, err := iprot.ReadListBegin()
+	if err != nil {
+		return fmt.Errorf("error reading list begin: %s", err)
+	}
+	tSlice := make([]string, 0, size)
+	p.Features = tSlice
+	for i := 0; i < size; i++ {
+		var _elem1 string
+		if v, err := iprot.ReadString(); err != nil {
+			return fmt.Errorf("error reading field 0: %s", err)
+		} else {
+			_elem1 = v
+		}
+		p.Features = append(p.Features, _elem1)
+	}
+	if err := iprot.ReadListEnd(); err != nil {
+		return fmt.Errorf("error reading list end: %s", err)
+	}
+	return nil
+}
+
+func (p *VersionInfo) Write(oprot thrift.TProtocol) error {
+	if err := oprot.WriteStructBegin("VersionInfo"); err != nil {
+		return fmt.Errorf("%T write struct begin error: %s", p, err)
+	}
+	if err := p.writeField1(oprot); err != nil {
+		return err
+	}
+	if err := p.writeField2(oprot); err != nil {
+		return err
+	}
+	if err := p.writeField3(oprot); err != nil {
+		return err
+	}
+	if err := p.writeField4(oprot); err != nil {
+		return err
+	}
+	if err := p.writeField5(oprot); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldStop(); err != nil {
+		return fmt.Errorf("write field stop error: %s", err)
+	}
+	if err := oprot.WriteStructEnd(); err != nil {
+		return fmt.Errorf("write struct stop error: %s", err)
+	}
+	return nil
+}
+
+func (p *VersionInfo) writeField1(oprot thrift.TProtocol) (err error) {
+	if err := oprot.WriteFieldBegin("language", thrift.STRING, 1); err != nil {
+		return fmt.Errorf("%T write field begin error 1:language: %s", p, err)
+	}
+	if err := oprot.WriteString(string(p.Language)); err != nil {
+		return fmt.Errorf("%T.language (1) field write error: %s", p, err)
+	}
+	if err := oprot.WriteFieldEnd(); err != nil {
+		return fmt.Errorf("%T write field end error 1:language: %s", p, err)
+	}
+	return err
+}
+
+func (p *VersionInfo) writeField2(oprot thrift.TProtocol) (err error) {
+	if err := oprot.WriteFieldBegin("languageVersion", thrift.STRING, 2); err != nil {
+		return fmt.Errorf("%T write field begin error 2:languageVersion: %s", p, err)
+	}
+	if err := oprot.WriteString(string(p.LanguageVersion)); err != nil {
+		return fmt.Errorf("%T.languageVersion (2) field write error: %s", p, err)
+	}
+	if err := oprot.WriteFieldEnd(); err != nil {
+		return fmt.Errorf("%T write field end error 2:languageVersion: %s", p, err)
+	}
+	return err
+}
+
+func (p *VersionInfo) writeField3(oprot thrift.TProtocol) (err error) {
+	if err := oprot.WriteFieldBegin("version", thrift.STRING, 3); err != nil {
+		return fmt.Errorf("%T write field begin error 3:version: %s", p, err)
+	}
+	if err := oprot.WriteString(string(p.Version)); err != nil {
+		return fmt.Errorf("%T.version (3) field write error: %s", p, err)
+	}
+	if err := oprot.WriteFieldEnd(); err != nil {
+		return fmt.Errorf("%T write field end error 3:version: %s", p, err)
+	}
+	return err
+}
+
+func (p *VersionInfo) writeField4(oprot thrift.TProtocol) (err error) {
+	if err := oprot.WriteFieldBegin("protocolVersion", thrift.I32, 4); err != nil {
+		return fmt.Errorf("%T write field begin error 4:protocolVersion: %s", p, err)
+	}
+	if err := oprot.WriteI32(int32(p.ProtocolVersion)); err != nil {
+		return fmt.Errorf("%T.protocolVersion (4) field write error: %s", p, err)
+	}
+	if err := oprot.WriteFieldEnd(); err != nil {
+		return fmt.Errorf("%T write field end error 4:protocolVersion: %s", p, err)
+	}
+	return err
+}
+
+func (p *VersionInfo) writeField5(oprot thrift.TProtocol) (err error) {
+	if err := oprot.WriteFieldBegin("features", thrift.LIST, 5); err != nil {
+		return fmt.Errorf("%T write field begin error 5:features: %s", p, err)
+	}
+	if err := oprot.WriteListBegin(thrift.STRING, len(p.Features)); err != nil {
+		return fmt.Errorf("error writing list begin: %s", err)
+	}
+	for _, v := range p.Features {
+		if err := oprot.WriteString(string(v)); err != nil {
+			return fmt.Errorf("%T. (0) field write error: %s", p, err)
+		}
+	}
+	if err := oprot.WriteListEnd(); err != nil {
+		return fmt.Errorf("error writing list end: %s", err)
+	}
+	if err := oprot.WriteFieldEnd(); err != nil {
+		return fmt.Errorf("%T write field end error 5:features: %s", p, err)
+	}
+	return err
+}
+
+func (p *VersionInfo) String() string {
+	if p == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("VersionInfo(%+v)", *p)
+}
+
+type InstanceInfo struct {
+	UptimeMicros int64             `thrift:"uptimeMicros,1,required" json:"uptimeMicros"`
+	BuildInfo    map[string]string `thrift:"buildInfo,2,required" json:"buildInfo"`
+	Endpoints    []string          `thrift:"endpoints,3,required" json:"endpoints"`
+}
+
+func NewInstanceInfo() *InstanceInfo {
+	return &InstanceInfo{}
+}
+
+func (p *InstanceInfo) GetUptimeMicros() int64 {
+	return p.UptimeMicros
+}
+
+func (p *InstanceInfo) GetBuildInfo() map[string]string {
+	return p.BuildInfo
+}
+
+func (p *InstanceInfo) GetEndpoints() []string {
+	return p.Endpoints
+}
+func (p *InstanceInfo) Read(iprot thrift.TProtocol) error {
+	if _, err := iprot.ReadStructBegin(); err != nil {
+		return fmt.Errorf("%T read error: %s", p, err)
+	}
+	for {
+		_, fieldTypeId, fieldId, err := iprot.ReadFieldBegin()
+		if err != nil {
+			return fmt.Errorf("%T field %d read error: %s", p, fieldId, err)
+		}
+		if fieldTypeId == thrift.STOP {
+			break
+		}
+		switch fieldId {
+		case 1:
+			if err := p.ReadField1(iprot); err != nil {
+				return err
+			}
+		case 2:
+			if err := p.ReadField2(iprot); err != nil {
+				return err
+			}
+		case 3:
+			if err := p.ReadField3(iprot); err != nil {
+				return err
+			}
+		default:
+			if err := iprot.Skip(fieldTypeId); err != nil {
+				return err
+			}
+		}
+		if err := iprot.ReadFieldEnd(); err != nil {
+			return err
+		}
+	}
+	if err := iprot.ReadStructEnd(); err != nil {
+		return fmt.Errorf("%T read struct end error: %s", p, err)
+	}
+	return nil
+}
+
+func (p *InstanceInfo) ReadField1(iprot thrift.TProtocol) error {
+	if v, err := iprot.ReadI64(); err != nil {
+		return fmt.Errorf("error reading field 1: %s", err)
+	} else {
+		p.UptimeMicros = v
+	}
+	return nil
+}
+
+func (p *InstanceInfo) ReadField2(iprot thrift.TProtocol) error {
+	_, _, size, err := iprot.ReadMapBegin()
+	if err != nil {
+		return fmt.Errorf("error reading map begin: %s", err)
+	}
+	tMap := make(map[string]string, size)
+	p.BuildInfo = tMap
+	for i := 0; i < size; i++ {
+		var _key2 string
+		if v, err := iprot.ReadString(); err != nil {
+			return fmt.Errorf("error reading field 0: %s", err)
+		} else {
+			_key2 = v
+		}
+		var _val3 string
+		if v, err := iprot.ReadString(); err != nil {
+			return fmt.Errorf("error reading field 0: %s", err)
+		} else {
+			_val3 = v
+		}
+		p.BuildInfo[_key2] = _val3
+	}
+	if err := iprot.ReadMapEnd(); err != nil {
+		return fmt.Errorf("error reading map end: %s", err)
+	}
+	return nil
+}
+
+func (p *InstanceInfo) ReadField3(iprot thrift.TProtocol) error {
+	_, size, err := iprot.ReadListBegin()
+	if err != nil {
+		return fmt.Errorf("error reading list begin: %s", err)
+	}
+	tSlice := make([]string, 0, size)
+	p.Endpoints = tSlice
+	for i := 0; i < size; i++ {
+		var _elem4 string
+		if v, err := iprot.ReadString(); err != nil {
+			return fmt.Errorf("error reading field 0: %s", err)
+		} else {
+			_elem4 = v
+		}
+		p.Endpoints = append(p.Endpoints, _elem4)
+	}
+	if err := iprot.ReadListEnd(); err != nil {
+		return fmt.Errorf("error reading list end: %s", err)
+	}
+	return nil
+}
+
+func (p *InstanceInfo) Write(oprot thrift.TProtocol) error {
+	if err := oprot.WriteStructBegin("InstanceInfo"); err != nil {
+		return fmt.Errorf("%T write struct begin error: %s", p, err)
+	}
+	if err := p.writeField1(oprot); err != nil {
+		return err
+	}
+	if err := p.writeField2(oprot); err != nil {
+		return err
+	}
+	if err := p.writeField3(oprot); err != nil {
+		return err
+	}
+	if err := oprot.WriteFieldStop(); err != nil {
+		return fmt.Errorf("write field stop error: %s", err)
+	}
+	if err := oprot.WriteStructEnd(); err != nil {
+		return fmt.Errorf("write struct stop error: %s", err)
+	}
+	return nil
+}
+
+func (p *InstanceInfo) writeField1(oprot thrift.TProtocol) (err error) {
+	if err := oprot.WriteFieldBegin("uptimeMicros", thrift.I64, 1); err != nil {
+		return fmt.Errorf("%T write field begin error 1:uptimeMicros: %s", p, err)
+	}
+	if err := oprot.WriteI64(int64(p.UptimeMicros)); err != nil {
+		return fmt.Errorf("%T.uptimeMicros (1) field write error: %s", p, err)
+	}
+	if err := oprot.WriteFieldEnd(); err != nil {
+		return fmt.Errorf("%T write field end error 1:uptimeMicros: %s", p, err)
+	}
+	return err
+}
+
+func (p *InstanceInfo) writeField2(oprot thrift.TProtocol) (err error) {
+	if err := oprot.WriteFieldBegin("buildInfo", thrift.MAP, 2); err != nil {
+		return fmt.Errorf("%T write field begin error 2:buildInfo: %s", p, err)
+	}
+	if err := oprot.WriteMapBegin(thrift.STRING, thrift.STRING, len(p.BuildInfo)); err != nil {
+		return fmt.Errorf("error writing map begin: %s", err)
+	}
+	for k, v := range p.BuildInfo {
+		if err := oprot.WriteString(string(k)); err != nil {
+			return fmt.Errorf("%T. (0) field write error: %s", p, err)
+		}
+		if err := oprot.WriteString(string(v)); err != nil {
+			return fmt.Errorf("%T. (0) field write error: %s", p, err)
+		}
+	}
+	if err := oprot.WriteMapEnd(); err != nil {
+		return fmt.Errorf("error writing map end: %s", err)
+	}
+	if err := oprot.WriteFieldEnd(); err != nil {
+		return fmt.Errorf("%T write field end error 2:buildInfo: %s", p, err)
+	}
+	return err
+}
+
+func (p *InstanceInfo) writeField3(oprot thrift.TProtocol) (err error) {
+	if err := oprot.WriteFieldBegin("endpoints", thrift.LIST, 3); err != nil {
+		return fmt.Errorf("%T write field begin error 3:endpoints: %s", p, err)
+	}
+	if err := oprot.WriteListBegin(thrift.STRING, len(p.Endpoints)); err != nil {
+		return fmt.Errorf("error writing list begin: %s", err)
+	}
+	for _, v := range p.Endpoints {
+		if err := oprot.WriteString(string(v)); err != nil {
+			return fmt.Errorf("%T. (0) field write error: %s", p, err)
+		}
+	}
+	if err := oprot.WriteListEnd(); err != nil {
+		return fmt.Errorf("error writing list end: %s", err)
+	}
+	if err := oprot.WriteFieldEnd(); err != nil {
+		return fmt.Errorf("%T write field end error 3:endpoints: %s", p, err)
+	}
+	return err
+}
+
+func (p *InstanceInfo) String() string {
+	if p == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("InstanceInfo(%+v)", *p)
+}
@@ -81,12 +81,56 @@ func (s *tchanSecondServiceServer) handleEcho(ctx thrift.Context, protocol athri
 
 	if err != nil {
 		return false, nil, err
+	} else {
+		res.Success = &r
 	}
-	res.Success = &r
 
 	return err == nil, &res, nil
 }
 
+type tchanSecondServiceGateway struct {
+	client TChanSecondService
+}
+
+func NewTChanSecondServiceGateway(client TChanSecondService) thrift.TChanGateway {
+	return &tchanSecondServiceGateway{client}
+}
+
+func (g *tchanSecondServiceGateway) Service() string {
+	return "SecondService"
+}
+
+func (g *tchanSecondServiceGateway) Methods() []string {
+	return []string{
+		"Echo",
+	}
+}
+
+func (g *tchanSecondServiceGateway) Handle(ctx thrift.Context, methodName string, decode func(args interface{}) error) (bool, interface{}, error) {
+	switch methodName {
+	case "Echo":
+		return g.handleEcho(ctx, decode)
+	default:
+		return false, nil, fmt.Errorf("method %v not found in service %v", methodName, g.Service())
+	}
+}
+
+func (g *tchanSecondServiceGateway) handleEcho(ctx thrift.Context, decode func(args interface{}) error) (bool, interface{}, error) {
+	var req EchoArgs
+	if err := decode(&req); err != nil {
+		return false, nil, err
+	}
+
+	r, err :=
+		g.client.Echo(ctx, req.Arg)
+
+	if err != nil {
+		return false, nil, err
+	}
+
+	return true, r, nil
+}
+
 type tchanSimpleServiceClient struct {
 	client thrift.TChanClient
 }
@@ -163,8 +207,9 @@ func (s *tchanSimpleServiceServer) handleCall(ctx thrift.Context, protocol athri
 
 	if err != nil {
 		return false, nil, err
+	} else {
+		res.Success = r
 	}
-	res.Success = r
 
 	return err == nil, &res, nil
 }
@@ -187,7 +232,75 @@ func (s *tchanSimpleServiceServer) handleSimple(ctx thrift.Context, protocol ath
 		default:
 			return false, nil, err
 		}
+	} else {
 	}
 
 	return err == nil, &res, nil
 }
+
+type tchanSimpleServiceGateway struct {
+	client TChanSimpleService
+}
+
+func NewTChanSimpleServiceGateway(client TChanSimpleService) thrift.TChanGateway {
+	return &tchanSimpleServiceGateway{client}
+}
+
+func (g *tchanSimpleServiceGateway) Service() string {
+	return "SimpleService"
+}
+
+func (g *tchanSimpleServiceGateway) Methods() []string {
+	return []string{
+		"Call",
+		"Simple",
+	}
+}
+
+func (g *tchanSimpleServiceGateway) Handle(ctx thrift.Context, methodName string, decode func(args interface{}) error) (bool, interface{}, error) {
+	switch methodName {
+	case "Call":
+		return g.handleCall(ctx, decode)
+	case "Simple":
+		return g.handleSimple(ctx, decode)
+	default:
+		return false, nil, fmt.Errorf("method %v not found in service %v", methodName, g.Service())
+	}
+}
+
+func (g *tchanSimpleServiceGateway) handleCall(ctx thrift.Context, decode func(args interface{}) error) (bool, interface{}, error) {
+	var req CallArgs
+	if err := decode(&req); err != nil {
+		return false, nil, err
+	}
+
+	r, err :=
+		g.client.Call(ctx, req.Arg)
+
+	if err != nil {
+		return false, nil, err
+	}
+
+	return true, r, nil
+}
+
+func (g *tchanSimpleServiceGateway) handleSimple(ctx thrift.Context, decode func(args interface{}) error) (bool, interface{}, error) {
+	var req SimpleArgs
+	if err := decode(&req); err != nil {
+		return false, nil, err
+	}
+
+	err :=
+		g.client.Simple(ctx)
+
+	if err != nil {
+		switch v := err.(type) {
+		case *SimpleErr:
+			return false, map[string]interface{}{"simpleErr": v}, nil
+		default:
+			return false, nil, err
+		}
+	}
+
+	return true, nil, nil
+}
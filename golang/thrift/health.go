@@ -20,36 +20,258 @@
 
 package thrift
 
-import "github.com/uber/tchannel/golang/thrift/gen-go/meta"
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uber/tchannel/golang/thrift/gen-go/meta"
+)
 
 // HealthFunc is the interface for custom health endpoints.
 // ok is whether the service health is OK, and message is optional additional information for the health result.
 type HealthFunc func(ctx Context) (ok bool, message string)
 
+// HealthRequestType is the type of health check being made.
+type HealthRequestType int
+
+const (
+	// Process health checks whether the process is up, and is used for liveness probes.
+	Process HealthRequestType = iota
+	// Traffic health checks whether the process is ready to receive traffic, and is used
+	// for readiness probes. It fails while the channel is draining, while the server is
+	// not marked as ready, or if any registered component check fails.
+	Traffic
+)
+
+// HealthRequest contains the parameters of a health check.
+type HealthRequest struct {
+	Type HealthRequestType
+}
+
+// HealthRequestFunc is like HealthFunc, but is passed the type of health check being made.
+type HealthRequestFunc func(ctx Context, r HealthRequest) (ok bool, message string)
+
+// HealthCheck checks a single component the service depends on, such as a database,
+// a cache or a downstream service. A nil error means the component is healthy.
+type HealthCheck func(ctx Context) error
+
+// ComponentStatus is the result of a single named health check.
+type ComponentStatus struct {
+	Name    string
+	OK      bool
+	Message string
+	Latency time.Duration
+}
+
 // healthHandler implements the default health check enpoint.
 type healthHandler struct {
-	handler HealthFunc
+	sync.RWMutex
+
+	handler  HealthRequestFunc
+	checks   map[string]HealthCheck
+	notReady bool
+	draining func() bool
 }
 
-// newHealthHandler return a new HealthHandler instance.
-func newHealthHandler() *healthHandler {
-	return &healthHandler{handler: defaultHealth}
+// newHealthHandler return a new HealthHandler instance. draining is used by Traffic
+// health checks to report the service as not ready while the channel is draining.
+func newHealthHandler(draining func() bool) *healthHandler {
+	return &healthHandler{
+		handler:  defaultHealth,
+		checks:   make(map[string]HealthCheck),
+		draining: draining,
+	}
 }
 
-// Health returns true as default Health endpoint.
-func (h *healthHandler) Health(ctx Context) (*meta.HealthStatus, error) {
-	ok, message := h.handler(ctx)
+// Health returns the health of the service for the requested health check type. Requests
+// that do not specify a type, such as those from older clients, are treated as Traffic checks.
+func (h *healthHandler) Health(ctx Context, hr *meta.HealthRequest) (*meta.HealthStatus, error) {
+	r := HealthRequest{Type: Traffic}
+	if hr != nil && hr.IsSetType() {
+		r.Type = healthRequestTypeFromThrift(hr.GetType())
+	}
+	ok, message, _ := h.check(ctx, r)
 	if message == "" {
 		return &meta.HealthStatus{Ok: ok}, nil
 	}
 	return &meta.HealthStatus{Ok: ok, Message: &message}, nil
 }
 
-func defaultHealth(ctx Context) (bool, string) {
+// HealthDetails returns the aggregated health along with the result of each component check.
+func (h *healthHandler) HealthDetails(ctx Context) (*meta.DetailedHealthStatus, error) {
+	ok, message, components := h.check(ctx, HealthRequest{Type: Traffic})
+	status := &meta.DetailedHealthStatus{
+		Ok:         ok,
+		Components: make([]*meta.ComponentHealth, len(components)),
+	}
+	if message != "" {
+		status.Message = &message
+	}
+	for i, c := range components {
+		status.Components[i] = componentToThrift(c)
+	}
+	return status, nil
+}
+
+// check runs the health handler, and for Traffic checks, the readiness conditions and all
+// component checks. The service is only healthy if every check passes, and the message
+// lists the failures.
+func (h *healthHandler) check(ctx Context, r HealthRequest) (bool, string, []ComponentStatus) {
+	h.RLock()
+	handler := h.handler
+	notReady := h.notReady
+	checks := make(map[string]HealthCheck, len(h.checks))
+	for name, c := range h.checks {
+		checks[name] = c
+	}
+	h.RUnlock()
+
+	ok, message := handler(ctx, r)
+	if r.Type != Traffic {
+		return ok, message, nil
+	}
+
+	var messages []string
+	if h.draining != nil && h.draining() {
+		ok = false
+		messages = append(messages, "draining")
+	} else if notReady {
+		ok = false
+		messages = append(messages, "not ready")
+	}
+	if message != "" {
+		messages = append(messages, message)
+	}
+
+	components := runHealthChecks(ctx, checks)
+	for _, c := range components {
+		if !c.OK {
+			ok = false
+			messages = append(messages, c.Name+": "+c.Message)
+		}
+	}
+	return ok, strings.Join(messages, "; "), components
+}
+
+// runHealthChecks runs all the given checks concurrently and returns the results sorted by name.
+func runHealthChecks(ctx Context, checks map[string]HealthCheck) []ComponentStatus {
+	results := make([]ComponentStatus, 0, len(checks))
+	resultsCh := make(chan ComponentStatus, len(checks))
+	for name, c := range checks {
+		go func(name string, c HealthCheck) {
+			start := time.Now()
+			err := c(ctx)
+			status := ComponentStatus{Name: name, OK: err == nil, Latency: time.Since(start)}
+			if err != nil {
+				status.Message = err.Error()
+			}
+			resultsCh <- status
+		}(name, c)
+	}
+	for range checks {
+		results = append(results, <-resultsCh)
+	}
+	sort.Sort(byComponentName(results))
+	return results
+}
+
+type byComponentName []ComponentStatus
+
+func (s byComponentName) Len() int           { return len(s) }
+func (s byComponentName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s byComponentName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func componentToThrift(c ComponentStatus) *meta.ComponentHealth {
+	component := &meta.ComponentHealth{
+		Name:          c.Name,
+		Ok:            c.OK,
+		LatencyMicros: int64(c.Latency / time.Microsecond),
+	}
+	if c.Message != "" {
+		component.Message = &c.Message
+	}
+	return component
+}
+
+func componentFromThrift(c *meta.ComponentHealth) ComponentStatus {
+	return ComponentStatus{
+		Name:    c.Name,
+		OK:      c.Ok,
+		Message: c.GetMessage(),
+		Latency: time.Duration(c.LatencyMicros) * time.Microsecond,
+	}
+}
+
+func healthRequestTypeFromThrift(t meta.HealthRequestType) HealthRequestType {
+	if t == meta.HealthRequestType_PROCESS {
+		return Process
+	}
+	return Traffic
+}
+
+func healthRequestTypeToThrift(t HealthRequestType) meta.HealthRequestType {
+	if t == Process {
+		return meta.HealthRequestType_PROCESS
+	}
+	return meta.HealthRequestType_TRAFFIC
+}
+
+func defaultHealth(ctx Context, r HealthRequest) (bool, string) {
 	return true, ""
 }
 
 // SetHandler sets customized handler for health endpoint.
-func (h *healthHandler) setHandler(f HealthFunc) {
+func (h *healthHandler) setHandler(f HealthRequestFunc) {
+	h.Lock()
 	h.handler = f
+	h.Unlock()
+}
+
+// setReady sets whether Traffic health checks should report the service as ready.
+func (h *healthHandler) setReady(ready bool) {
+	h.Lock()
+	h.notReady = !ready
+	h.Unlock()
+}
+
+// registerCheck adds a named component check, replacing any existing check with the same name.
+func (h *healthHandler) registerCheck(name string, check HealthCheck) {
+	h.Lock()
+	h.checks[name] = check
+	h.Unlock()
+}
+
+// CheckHealth makes a Traffic health check by calling the Meta::health endpoint using the
+// given client. It returns whether the service is healthy, and the optional message returned
+// by the health endpoint.
+func CheckHealth(ctx Context, client TChanClient) (ok bool, message string, err error) {
+	return CheckHealthRequest(ctx, client, HealthRequest{Type: Traffic})
+}
+
+// CheckHealthRequest is like CheckHealth, but makes the given type of health check.
+func CheckHealthRequest(ctx Context, client TChanClient, r HealthRequest) (ok bool, message string, err error) {
+	t := healthRequestTypeToThrift(r.Type)
+	status, err := newTChanMetaClient(client).Health(ctx, &meta.HealthRequest{Type: &t})
+	if err != nil {
+		return false, "", err
+	}
+	if status.Message != nil {
+		message = *status.Message
+	}
+	return status.Ok, message, nil
+}
+
+// CheckHealthDetails calls the Meta::healthDetails endpoint using the given client. In addition
+// to the aggregated result returned by CheckHealth, it returns the status of each component.
+func CheckHealthDetails(ctx Context, client TChanClient) (ok bool, message string, components []ComponentStatus, err error) {
+	status, err := newTChanMetaClient(client).HealthDetails(ctx)
+	if err != nil {
+		return false, "", nil, err
+	}
+	for _, c := range status.Components {
+		components = append(components, componentFromThrift(c))
+	}
+	return status.Ok, status.GetMessage(), components, nil
 }
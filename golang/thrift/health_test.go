@@ -21,6 +21,7 @@
 package thrift
 
 import (
+	"errors"
 	"net"
 	"testing"
 	"time"
@@ -29,11 +30,12 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/thrift/gen-go/meta"
 )
 
 func TestDefaultHealth(t *testing.T) {
 	withMetaSetup(t, func(ctx Context, c tchanMeta, server *Server) {
-		ret, err := c.Health(ctx)
+		ret, err := c.Health(ctx, &meta.HealthRequest{})
 		if assert.NoError(t, err, "Health endpoint failed") {
 			assert.True(t, ret.Ok, "Health status mismatch")
 			assert.Nil(t, ret.Message, "Health message mismatch")
@@ -48,7 +50,7 @@ func customHealthEmpty(ctx Context) (bool, string) {
 func TestCustomHealthEmpty(t *testing.T) {
 	withMetaSetup(t, func(ctx Context, c tchanMeta, server *Server) {
 		server.RegisterHealthHandler(customHealthEmpty)
-		ret, err := c.Health(ctx)
+		ret, err := c.Health(ctx, &meta.HealthRequest{})
 		if assert.NoError(t, err, "Health endpoint failed") {
 			assert.False(t, ret.Ok, "Health status mismatch")
 			assert.Nil(t, ret.Message, "Health message mismatch")
@@ -63,7 +65,7 @@ func customHealthNoEmpty(ctx Context) (bool, string) {
 func TestCustomHealthNoEmpty(t *testing.T) {
 	withMetaSetup(t, func(ctx Context, c tchanMeta, server *Server) {
 		server.RegisterHealthHandler(customHealthNoEmpty)
-		ret, err := c.Health(ctx)
+		ret, err := c.Health(ctx, &meta.HealthRequest{})
 		if assert.NoError(t, err, "Health endpoint failed") {
 			assert.False(t, ret.Ok, "Health status mismatch")
 			assert.Equal(t, ret.Message, thrift.StringPtr("from me"), "Health message mismatch")
@@ -71,6 +73,133 @@ func TestCustomHealthNoEmpty(t *testing.T) {
 	})
 }
 
+func TestCheckHealth(t *testing.T) {
+	withMetaSetup(t, func(ctx Context, c tchanMeta, server *Server) {
+		client := c.(*tchanMetaClient).client
+
+		ok, message, err := CheckHealth(ctx, client)
+		require.NoError(t, err, "CheckHealth failed")
+		assert.True(t, ok, "Health status mismatch")
+		assert.Equal(t, "", message, "Health message mismatch")
+
+		server.RegisterHealthHandler(customHealthNoEmpty)
+		ok, message, err = CheckHealth(ctx, client)
+		require.NoError(t, err, "CheckHealth failed")
+		assert.False(t, ok, "Health status mismatch")
+		assert.Equal(t, "from me", message, "Health message mismatch")
+	})
+}
+
+func TestHealthChecks(t *testing.T) {
+	withMetaSetup(t, func(ctx Context, c tchanMeta, server *Server) {
+		client := c.(*tchanMetaClient).client
+
+		server.RegisterHealthCheck("db", func(ctx Context) error {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})
+		server.RegisterHealthCheck("cache", func(ctx Context) error {
+			return nil
+		})
+
+		ok, message, err := CheckHealth(ctx, client)
+		require.NoError(t, err, "CheckHealth failed")
+		assert.True(t, ok, "Health status mismatch")
+		assert.Equal(t, "", message, "Health message mismatch")
+
+		server.RegisterHealthCheck("cache", func(ctx Context) error {
+			return errors.New("connection refused")
+		})
+		ok, message, err = CheckHealth(ctx, client)
+		require.NoError(t, err, "CheckHealth failed")
+		assert.False(t, ok, "Health status should include failing components")
+		assert.Equal(t, "cache: connection refused", message, "Health message mismatch")
+
+		server.RegisterHealthHandler(customHealthNoEmpty)
+		ok, message, components, err := CheckHealthDetails(ctx, client)
+		require.NoError(t, err, "CheckHealthDetails failed")
+		assert.False(t, ok, "Health status mismatch")
+		assert.Equal(t, "from me; cache: connection refused", message, "Health message mismatch")
+		require.Equal(t, 2, len(components), "Expected a result per component")
+		assert.Equal(t, "cache", components[0].Name, "Components should be sorted by name")
+		assert.False(t, components[0].OK, "cache status mismatch")
+		assert.Equal(t, "connection refused", components[0].Message, "cache message mismatch")
+		assert.Equal(t, "db", components[1].Name, "Components should be sorted by name")
+		assert.True(t, components[1].OK, "db status mismatch")
+		assert.Equal(t, "", components[1].Message, "db message mismatch")
+		assert.True(t, components[1].Latency >= 10*time.Millisecond,
+			"db latency %v should include the check duration", components[1].Latency)
+	})
+}
+
+func TestHealthRequestTypes(t *testing.T) {
+	withMetaSetup(t, func(ctx Context, c tchanMeta, server *Server) {
+		client := c.(*tchanMetaClient).client
+		liveness := HealthRequest{Type: Process}
+		readiness := HealthRequest{Type: Traffic}
+
+		var requests []HealthRequest
+		server.RegisterHealthRequestHandler(func(ctx Context, r HealthRequest) (bool, string) {
+			requests = append(requests, r)
+			return true, ""
+		})
+		server.RegisterHealthCheck("db", func(ctx Context) error {
+			return errors.New("unreachable")
+		})
+
+		ok, message, err := CheckHealthRequest(ctx, client, liveness)
+		require.NoError(t, err, "CheckHealthRequest failed")
+		assert.True(t, ok, "Liveness should not depend on component checks")
+		assert.Equal(t, "", message, "Health message mismatch")
+
+		ok, message, err = CheckHealthRequest(ctx, client, readiness)
+		require.NoError(t, err, "CheckHealthRequest failed")
+		assert.False(t, ok, "Readiness should depend on component checks")
+		assert.Equal(t, "db: unreachable", message, "Health message mismatch")
+
+		// Requests from older clients that don't set a type are readiness checks.
+		ret, err := c.Health(ctx, &meta.HealthRequest{})
+		require.NoError(t, err, "Health endpoint failed")
+		assert.False(t, ret.Ok, "Health status mismatch")
+		assert.Equal(t, []HealthRequest{liveness, readiness, readiness}, requests, "Handler requests mismatch")
+
+		server.RegisterHealthCheck("db", func(ctx Context) error {
+			return nil
+		})
+		server.SetReady(false)
+		ok, message, err = CheckHealthRequest(ctx, client, readiness)
+		require.NoError(t, err, "CheckHealthRequest failed")
+		assert.False(t, ok, "Readiness should fail until the server is ready")
+		assert.Equal(t, "not ready", message, "Health message mismatch")
+
+		server.SetReady(true)
+		ok, _, err = CheckHealthRequest(ctx, client, readiness)
+		require.NoError(t, err, "CheckHealthRequest failed")
+		assert.True(t, ok, "Readiness should pass once the server is ready")
+
+		server.ch.(*tchannel.Channel).StartDrain()
+		ok, message, err = CheckHealthRequest(ctx, client, readiness)
+		require.NoError(t, err, "CheckHealthRequest failed")
+		assert.False(t, ok, "Readiness should fail while draining")
+		assert.Equal(t, "draining", message, "Health message mismatch")
+
+		ok, _, err = CheckHealthRequest(ctx, client, liveness)
+		require.NoError(t, err, "CheckHealthRequest failed")
+		assert.True(t, ok, "Liveness should not depend on draining")
+	})
+}
+
+func TestHealthDetailsNoChecks(t *testing.T) {
+	withMetaSetup(t, func(ctx Context, c tchanMeta, server *Server) {
+		ret, err := c.HealthDetails(ctx)
+		if assert.NoError(t, err, "HealthDetails endpoint failed") {
+			assert.True(t, ret.Ok, "Health status mismatch")
+			assert.Nil(t, ret.Message, "Health message mismatch")
+			assert.Empty(t, ret.Components, "Expected no components")
+		}
+	})
+}
+
 func withMetaSetup(t *testing.T, f func(ctx Context, c tchanMeta, server *Server)) {
 	ctx, cancel := NewContext(time.Second * 10)
 	defer cancel()
@@ -0,0 +1,148 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package thrift
+
+import (
+	"sync"
+	"time"
+
+	tchannel "github.com/uber/tchannel/golang"
+)
+
+// HealthCacheOptions controls how often an expensive health check is evaluated. Results are
+// shared between concurrent health probes, so a burst of probes from many routers only
+// evaluates the check once.
+type HealthCacheOptions struct {
+	// TTL is how long a result is reused before the check is evaluated again.
+	TTL time.Duration
+
+	// MaxRate is the maximum number of evaluations per second. If it allows fewer
+	// evaluations than TTL, results are reused for longer than TTL. 0 means no limit.
+	MaxRate float64
+
+	// Clock is used to expire cached results. Defaults to tchannel.SystemClock.
+	Clock tchannel.Clock
+}
+
+// CachedHealthCheck returns a HealthCheck that evaluates check at most once per TTL,
+// and at most MaxRate times a second, returning the last result in between.
+func CachedHealthCheck(check HealthCheck, opts HealthCacheOptions) HealthCheck {
+	cache := newHealthCache(opts)
+	return func(ctx Context) error {
+		res := cache.get(ctx, 0, func() healthResult {
+			return healthResult{err: check(ctx)}
+		})
+		return res.err
+	}
+}
+
+// CachedHealthFunc returns a HealthRequestFunc that evaluates f at most once per TTL,
+// and at most MaxRate times a second for each type of health check, returning the last
+// result in between.
+func CachedHealthFunc(f HealthRequestFunc, opts HealthCacheOptions) HealthRequestFunc {
+	cache := newHealthCache(opts)
+	return func(ctx Context, r HealthRequest) (bool, string) {
+		res := cache.get(ctx, r.Type, func() healthResult {
+			ok, message := f(ctx, r)
+			return healthResult{ok: ok, message: message}
+		})
+		return res.ok, res.message
+	}
+}
+
+type healthResult struct {
+	ok      bool
+	message string
+	err     error
+}
+
+type healthCacheEntry struct {
+	result    healthResult
+	evaluated time.Time
+	// pending is non-nil while an evaluation is in progress, and is closed once it completes.
+	pending chan struct{}
+}
+
+type healthCache struct {
+	sync.Mutex
+
+	clock    tchannel.Clock
+	interval time.Duration
+	entries  map[HealthRequestType]*healthCacheEntry
+}
+
+func newHealthCache(opts HealthCacheOptions) *healthCache {
+	interval := opts.TTL
+	if opts.MaxRate > 0 {
+		if minInterval := time.Duration(float64(time.Second) / opts.MaxRate); minInterval > interval {
+			interval = minInterval
+		}
+	}
+	clock := opts.Clock
+	if clock == nil {
+		clock = tchannel.SystemClock
+	}
+	return &healthCache{
+		clock:    clock,
+		interval: interval,
+		entries:  make(map[HealthRequestType]*healthCacheEntry),
+	}
+}
+
+// get returns the cached result for key if it has not expired. Otherwise, it evaluates the
+// check, unless another caller is already evaluating it, in which case it waits for that result.
+func (c *healthCache) get(ctx Context, key HealthRequestType, evaluate func() healthResult) healthResult {
+	c.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &healthCacheEntry{}
+		c.entries[key] = entry
+	}
+	if pending := entry.pending; pending != nil {
+		c.Unlock()
+		select {
+		case <-pending:
+		case <-ctx.Done():
+			return healthResult{message: ctx.Err().Error(), err: ctx.Err()}
+		}
+		c.Lock()
+		result := entry.result
+		c.Unlock()
+		return result
+	}
+	if !entry.evaluated.IsZero() && c.clock.Now().Sub(entry.evaluated) < c.interval {
+		result := entry.result
+		c.Unlock()
+		return result
+	}
+	pending := make(chan struct{})
+	entry.pending = pending
+	c.Unlock()
+
+	result := evaluate()
+
+	c.Lock()
+	entry.result = result
+	entry.evaluated = c.clock.Now()
+	entry.pending = nil
+	c.Unlock()
+	close(pending)
+	return result
+}
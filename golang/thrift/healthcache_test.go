@@ -0,0 +1,117 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package thrift
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uber/tchannel/golang/testutils"
+)
+
+func TestCachedHealthCheck(t *testing.T) {
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+
+	tests := []struct {
+		opts     HealthCacheOptions
+		interval time.Duration
+	}{
+		{HealthCacheOptions{TTL: time.Second}, time.Second},
+		{HealthCacheOptions{MaxRate: 2}, 500 * time.Millisecond},
+		{HealthCacheOptions{TTL: time.Second, MaxRate: 0.5}, 2 * time.Second},
+		{HealthCacheOptions{TTL: 2 * time.Second, MaxRate: 10}, 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		clock := testutils.NewFakeClock(time.Unix(1, 0))
+		tt.opts.Clock = clock
+
+		var calls int32
+		checkErr := errors.New("unreachable")
+		check := CachedHealthCheck(func(ctx Context) error {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				return checkErr
+			}
+			return nil
+		}, tt.opts)
+
+		assert.Equal(t, checkErr, check(ctx), "%+v: first evaluation should return the error", tt.opts)
+		clock.Advance(tt.interval - time.Millisecond)
+		assert.Equal(t, checkErr, check(ctx), "%+v: result should be cached", tt.opts)
+		assert.EqualValues(t, 1, atomic.LoadInt32(&calls), "%+v: check should be evaluated once", tt.opts)
+
+		clock.Advance(time.Millisecond)
+		assert.NoError(t, check(ctx), "%+v: expired result should be evaluated again", tt.opts)
+		assert.EqualValues(t, 2, atomic.LoadInt32(&calls), "%+v: check should be evaluated again", tt.opts)
+	}
+}
+
+func TestCachedHealthCheckConcurrent(t *testing.T) {
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+
+	var calls int32
+	unblock := make(chan struct{})
+	check := CachedHealthCheck(func(ctx Context) error {
+		atomic.AddInt32(&calls, 1)
+		<-unblock
+		return nil
+	}, HealthCacheOptions{TTL: time.Minute})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, check(ctx), "check failed")
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(unblock)
+	wg.Wait()
+	assert.EqualValues(t, 1, atomic.LoadInt32(&calls), "Concurrent probes should share one evaluation")
+}
+
+func TestCachedHealthFunc(t *testing.T) {
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+
+	calls := make(map[HealthRequestType]int)
+	f := CachedHealthFunc(func(ctx Context, r HealthRequest) (bool, string) {
+		calls[r.Type]++
+		return r.Type == Process, "checked"
+	}, HealthCacheOptions{TTL: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		ok, message := f(ctx, HealthRequest{Type: Process})
+		assert.True(t, ok, "Process result mismatch")
+		assert.Equal(t, "checked", message, "Process message mismatch")
+
+		ok, _ = f(ctx, HealthRequest{Type: Traffic})
+		assert.False(t, ok, "Traffic result should be cached separately")
+	}
+	assert.Equal(t, map[HealthRequestType]int{Process: 1, Traffic: 1}, calls,
+		"Each health check type should be evaluated once")
+}
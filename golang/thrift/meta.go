@@ -0,0 +1,123 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package thrift
+
+import (
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	tchannel "github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/thrift/gen-go/meta"
+)
+
+// processStart is used to report the process uptime in Meta::instanceInfo.
+var processStart = time.Now()
+
+// VersionInfo is the version information returned by the Meta::versionInfo endpoint.
+type VersionInfo struct {
+	Language        string
+	LanguageVersion string
+	Version         string
+	ProtocolVersion int
+	Features        []string
+}
+
+// InstanceInfo is the instance information returned by the Meta::instanceInfo endpoint.
+type InstanceInfo struct {
+	Uptime    time.Duration
+	BuildInfo map[string]string
+	Endpoints []string
+}
+
+// metaHandler implements the Meta service.
+type metaHandler struct {
+	*healthHandler
+
+	server *Server
+}
+
+func newMetaHandler(server *Server, healthHandler *healthHandler) *metaHandler {
+	return &metaHandler{healthHandler: healthHandler, server: server}
+}
+
+// VersionInfo returns the library version and the protocol features it supports.
+func (h *metaHandler) VersionInfo(ctx Context) (*meta.VersionInfo, error) {
+	return &meta.VersionInfo{
+		Language:        "go",
+		LanguageVersion: strings.TrimPrefix(runtime.Version(), "go"),
+		Version:         tchannel.VersionInfo,
+		ProtocolVersion: tchannel.CurrentProtocolVersion,
+		Features:        tchannel.ProtocolFeatures(),
+	}, nil
+}
+
+// InstanceInfo returns the process uptime, build information and registered endpoints.
+func (h *metaHandler) InstanceInfo(ctx Context) (*meta.InstanceInfo, error) {
+	return &meta.InstanceInfo{
+		UptimeMicros: int64(time.Since(processStart) / time.Microsecond),
+		BuildInfo:    h.server.getBuildInfo(),
+		Endpoints:    h.server.endpoints(),
+	}, nil
+}
+
+// endpoints returns the sorted list of "Service::method" endpoints registered on the server.
+func (s *Server) endpoints() []string {
+	s.mut.RLock()
+	var endpoints []string
+	for service, svr := range s.handlers {
+		for _, m := range svr.Methods() {
+			endpoints = append(endpoints, service+"::"+m)
+		}
+	}
+	s.mut.RUnlock()
+
+	sort.Strings(endpoints)
+	return endpoints
+}
+
+// GetVersionInfo calls the Meta::versionInfo endpoint using the given client.
+func GetVersionInfo(ctx Context, client TChanClient) (*VersionInfo, error) {
+	info, err := newTChanMetaClient(client).VersionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &VersionInfo{
+		Language:        info.Language,
+		LanguageVersion: info.LanguageVersion,
+		Version:         info.Version,
+		ProtocolVersion: int(info.ProtocolVersion),
+		Features:        info.Features,
+	}, nil
+}
+
+// GetInstanceInfo calls the Meta::instanceInfo endpoint using the given client.
+func GetInstanceInfo(ctx Context, client TChanClient) (*InstanceInfo, error) {
+	info, err := newTChanMetaClient(client).InstanceInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &InstanceInfo{
+		Uptime:    time.Duration(info.UptimeMicros) * time.Microsecond,
+		BuildInfo: info.BuildInfo,
+		Endpoints: info.Endpoints,
+	}, nil
+}
@@ -1,8 +1,49 @@
+enum HealthRequestType {
+    // PROCESS checks whether the process is up (liveness).
+    PROCESS = 0
+    // TRAFFIC checks whether the process is ready to receive traffic (readiness).
+    TRAFFIC = 1
+}
+
+struct HealthRequest {
+    1: optional HealthRequestType type
+}
+
 struct HealthStatus {
     1: required bool ok
     2: optional string message
 }
 
+struct ComponentHealth {
+    1: required string name
+    2: required bool ok
+    3: optional string message
+    4: required i64 latencyMicros
+}
+
+struct DetailedHealthStatus {
+    1: required bool ok
+    2: optional string message
+    3: required list<ComponentHealth> components
+}
+
+struct VersionInfo {
+    1: required string language
+    2: required string languageVersion
+    3: required string version
+    4: required i32 protocolVersion
+    5: required list<string> features
+}
+
+struct InstanceInfo {
+    1: required i64 uptimeMicros
+    2: required map<string, string> buildInfo
+    3: required list<string> endpoints
+}
+
 service Meta {
-    HealthStatus health()
+    HealthStatus health(1: HealthRequest hr)
+    DetailedHealthStatus healthDetails()
+    VersionInfo versionInfo()
+    InstanceInfo instanceInfo()
 }
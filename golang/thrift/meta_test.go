@@ -0,0 +1,105 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package thrift
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	athrift "github.com/apache/thrift/lib/go/thrift"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+)
+
+func TestVersionInfo(t *testing.T) {
+	withMetaSetup(t, func(ctx Context, c tchanMeta, server *Server) {
+		info, err := GetVersionInfo(ctx, c.(*tchanMetaClient).client)
+		require.NoError(t, err, "GetVersionInfo failed")
+		assert.Equal(t, "go", info.Language, "Language mismatch")
+		assert.Equal(t, runtime.Version(), "go"+info.LanguageVersion, "LanguageVersion mismatch")
+		assert.Equal(t, tchannel.VersionInfo, info.Version, "Version mismatch")
+		assert.Equal(t, tchannel.CurrentProtocolVersion, info.ProtocolVersion, "ProtocolVersion mismatch")
+		assert.Equal(t, tchannel.ProtocolFeatures(), info.Features, "Features mismatch")
+	})
+}
+
+func TestInstanceInfo(t *testing.T) {
+	withMetaSetup(t, func(ctx Context, c tchanMeta, server *Server) {
+		client := c.(*tchanMetaClient).client
+
+		info, err := GetInstanceInfo(ctx, client)
+		require.NoError(t, err, "GetInstanceInfo failed")
+		assert.True(t, info.Uptime > 0, "Uptime should be positive")
+		assert.Empty(t, info.BuildInfo, "BuildInfo should be empty by default")
+		assert.Equal(t, []string{
+			"Meta::health",
+			"Meta::healthDetails",
+			"Meta::instanceInfo",
+			"Meta::versionInfo",
+		}, info.Endpoints, "Endpoints mismatch")
+
+		buildInfo := map[string]string{"commit": "abc123", "buildTime": "2015-10-01"}
+		server.SetBuildInfo(buildInfo)
+		buildInfo["commit"] = "modified"
+		server.Register(fakeServer{"Second", []string{"Echo"}})
+
+		info, err = GetInstanceInfo(ctx, client)
+		require.NoError(t, err, "GetInstanceInfo failed")
+		assert.Equal(t, map[string]string{"commit": "abc123", "buildTime": "2015-10-01"}, info.BuildInfo,
+			"BuildInfo mismatch")
+		assert.Contains(t, info.Endpoints, "Second::Echo", "Endpoints should include registered services")
+	})
+}
+
+func TestMultipleServersOnChannel(t *testing.T) {
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+
+	tchan, err := tchannel.NewChannel("meta", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer tchan.Close()
+
+	// Each server registers the Meta endpoints, so the second replaces the first's handlers.
+	NewServer(tchan)
+	second := NewServer(tchan)
+	second.Register(fakeServer{"Second", []string{"Echo"}})
+	require.NoError(t, tchan.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+
+	c, err := getMetaClient(tchan.PeerInfo().HostPort)
+	require.NoError(t, err, "getMetaClient failed")
+	info, err := GetInstanceInfo(ctx, c.(*tchanMetaClient).client)
+	require.NoError(t, err, "GetInstanceInfo failed")
+	assert.Contains(t, info.Endpoints, "Second::Echo", "Meta endpoints should be served by the second server")
+}
+
+// fakeServer is a TChanServer that only reports its service and methods.
+type fakeServer struct {
+	service string
+	methods []string
+}
+
+func (s fakeServer) Service() string   { return s.service }
+func (s fakeServer) Methods() []string { return s.methods }
+
+func (s fakeServer) Handle(ctx Context, methodName string, protocol athrift.TProtocol) (bool, athrift.TStruct, error) {
+	return false, nil, nil
+}
@@ -9,18 +9,84 @@ type TChanMeta struct {
 	mock.Mock
 }
 
-func (_m *TChanMeta) Health(ctx thrift.Context) (*meta.HealthStatus, error) {
-	ret := _m.Called(ctx)
+func (_m *TChanMeta) Health(ctx thrift.Context, hr *meta.HealthRequest) (*meta.HealthStatus, error) {
+	ret := _m.Called(ctx, hr)
 
 	var r0 *meta.HealthStatus
-	if rf, ok := ret.Get(0).(func(thrift.Context) *meta.HealthStatus); ok {
-		r0 = rf(ctx)
+	if rf, ok := ret.Get(0).(func(thrift.Context, *meta.HealthRequest) *meta.HealthStatus); ok {
+		r0 = rf(ctx, hr)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*meta.HealthStatus)
 		}
 	}
 
+	var r1 error
+	if rf, ok := ret.Get(1).(func(thrift.Context, *meta.HealthRequest) error); ok {
+		r1 = rf(ctx, hr)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+func (_m *TChanMeta) HealthDetails(ctx thrift.Context) (*meta.DetailedHealthStatus, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *meta.DetailedHealthStatus
+	if rf, ok := ret.Get(0).(func(thrift.Context) *meta.DetailedHealthStatus); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*meta.DetailedHealthStatus)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(thrift.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+func (_m *TChanMeta) InstanceInfo(ctx thrift.Context) (*meta.InstanceInfo, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *meta.InstanceInfo
+	if rf, ok := ret.Get(0).(func(thrift.Context) *meta.InstanceInfo); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*meta.InstanceInfo)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(thrift.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+func (_m *TChanMeta) VersionInfo(ctx thrift.Context) (*meta.VersionInfo, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *meta.VersionInfo
+	if rf, ok := ret.Get(0).(func(thrift.Context) *meta.VersionInfo); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*meta.VersionInfo)
+		}
+	}
+
 	var r1 error
 	if rf, ok := ret.Get(1).(func(thrift.Context) error); ok {
 		r1 = rf(ctx)
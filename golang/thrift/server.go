@@ -37,11 +37,16 @@ type Server struct {
 	mut           sync.RWMutex
 	handlers      map[string]TChanServer
 	healthHandler *healthHandler
+	buildInfo     map[string]string
 }
 
 // NewServer returns a server that can serve thrift services over TChannel.
 func NewServer(registrar tchannel.Registrar) *Server {
-	healthHandler := newHealthHandler()
+	var draining func() bool
+	if d, ok := registrar.(drainer); ok {
+		draining = d.Draining
+	}
+	healthHandler := newHealthHandler(draining)
 	server := &Server{
 		ch:            registrar,
 		log:           registrar.Logger(),
@@ -49,7 +54,7 @@ func NewServer(registrar tchannel.Registrar) *Server {
 		healthHandler: healthHandler,
 	}
 
-	server.Register(newTChanMetaServer(healthHandler))
+	server.Register(newTChanMetaServer(newMetaHandler(server, healthHandler)))
 	return server
 }
 
@@ -63,15 +68,90 @@ func (s *Server) Register(svr TChanServer) {
 	s.mut.Unlock()
 
 	for _, m := range svr.Methods() {
-		s.ch.Register(s, service+"::"+m)
+		tchannel.RegisterOperation(s.ch, s, tchannel.OperationInfo{
+			Name:     service + "::" + m,
+			Format:   tchannel.Thrift,
+			Metadata: map[string]string{"thrift.service": service},
+		})
 	}
 }
 
+// drainer is implemented by registrars that can report whether they are draining.
+type drainer interface {
+	Draining() bool
+}
+
 // RegisterHealthHandler uses the user-specified function f for the Health endpoint.
 func (s *Server) RegisterHealthHandler(f HealthFunc) {
+	s.healthHandler.setHandler(func(ctx Context, _ HealthRequest) (bool, string) {
+		return f(ctx)
+	})
+}
+
+// RegisterHealthRequestHandler uses the user-specified function f for the Health endpoint.
+// Unlike RegisterHealthHandler, f is passed the type of health check, so it can report
+// liveness (Process) and readiness (Traffic) separately.
+func (s *Server) RegisterHealthRequestHandler(f HealthRequestFunc) {
 	s.healthHandler.setHandler(f)
 }
 
+// SetReady sets whether the service is ready to receive traffic. Services that need to
+// warm up before serving can call SetReady(false) before they start listening, and
+// SetReady(true) once they are ready. Services are ready by default.
+func (s *Server) SetReady(ready bool) {
+	s.healthHandler.setReady(ready)
+}
+
+// SetReadyWhenAvailable marks the service as not ready until each of the dependencies has
+// a healthy peer, or the timeout in opts passes, see tchannel.WaitForDependencies. The
+// returned channel is closed once the service is marked ready, so that other startup work
+// such as advertising to Hyperbahn can wait for it.
+func (s *Server) SetReadyWhenAvailable(opts *tchannel.DependencyWaitOptions, dependencies ...*tchannel.SubChannel) <-chan struct{} {
+	s.SetReady(false)
+
+	ready := make(chan struct{})
+	go func() {
+		if err := tchannel.WaitForDependencies(context.Background(), opts, dependencies...); err != nil {
+			s.log.Warnf("Marking service as ready without dependencies: %v", err)
+		}
+		s.SetReady(true)
+		close(ready)
+	}()
+	return ready
+}
+
+// RegisterHealthCheck adds a named component check (e.g. "db" or "cache") to the health endpoint.
+// Traffic health checks are only OK if every registered check passes, and Meta::healthDetails
+// returns the status and latency of each check. Registering a name again replaces its check.
+// Expensive checks can be wrapped with CachedHealthCheck to limit how often they run.
+func (s *Server) RegisterHealthCheck(name string, check HealthCheck) {
+	s.healthHandler.registerCheck(name, check)
+}
+
+// SetBuildInfo sets the build information, such as the commit or build time, that is
+// returned by the Meta::instanceInfo endpoint.
+func (s *Server) SetBuildInfo(info map[string]string) {
+	buildInfo := make(map[string]string, len(info))
+	for k, v := range info {
+		buildInfo[k] = v
+	}
+
+	s.mut.Lock()
+	s.buildInfo = buildInfo
+	s.mut.Unlock()
+}
+
+func (s *Server) getBuildInfo() map[string]string {
+	s.mut.RLock()
+	defer s.mut.RUnlock()
+
+	buildInfo := make(map[string]string, len(s.buildInfo))
+	for k, v := range s.buildInfo {
+		buildInfo[k] = v
+	}
+	return buildInfo
+}
+
 func (s *Server) onError(err error) {
 	// TODO(prashant): Expose incoming call errors through options for NewServer.
 	s.log.Errorf("thrift Server error: %v", err)
@@ -95,7 +175,7 @@ func (s *Server) handle(origCtx context.Context, handler TChanServer, method str
 		return err
 	}
 
-	ctx := WithHeaders(origCtx, headers)
+	ctx := WithHeaders(origCtx, tchannel.ExtractRequestID(origCtx, headers))
 	protocol := thrift.NewTBinaryProtocolTransport(&readWriterTransport{Reader: reader})
 	success, resp, err := handler.Handle(ctx, method, protocol)
 	if err != nil {
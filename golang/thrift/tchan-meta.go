@@ -9,7 +9,10 @@ import (
 
 // tchanMeta is interface for the service and client for the services defined in the IDL.
 type tchanMeta interface {
-	Health(ctx Context) (*meta.HealthStatus, error)
+	Health(ctx Context, hr *meta.HealthRequest) (*meta.HealthStatus, error)
+	HealthDetails(ctx Context) (*meta.DetailedHealthStatus, error)
+	InstanceInfo(ctx Context) (*meta.InstanceInfo, error)
+	VersionInfo(ctx Context) (*meta.VersionInfo, error)
 }
 
 // Implementation of a client and service handler.
@@ -23,9 +26,11 @@ func newTChanMetaClient(client TChanClient) tchanMeta {
 	return &tchanMetaClient{client: client}
 }
 
-func (c *tchanMetaClient) Health(ctx Context) (*meta.HealthStatus, error) {
+func (c *tchanMetaClient) Health(ctx Context, hr *meta.HealthRequest) (*meta.HealthStatus, error) {
 	var resp meta.HealthResult
-	args := meta.HealthArgs{}
+	args := meta.HealthArgs{
+		Hr: hr,
+	}
 	success, err := c.client.Call(ctx, "Meta", "health", &args, &resp)
 	if err == nil && !success {
 	}
@@ -33,6 +38,36 @@ func (c *tchanMetaClient) Health(ctx Context) (*meta.HealthStatus, error) {
 	return resp.GetSuccess(), err
 }
 
+func (c *tchanMetaClient) HealthDetails(ctx Context) (*meta.DetailedHealthStatus, error) {
+	var resp meta.HealthDetailsResult
+	args := meta.HealthDetailsArgs{}
+	success, err := c.client.Call(ctx, "Meta", "healthDetails", &args, &resp)
+	if err == nil && !success {
+	}
+
+	return resp.GetSuccess(), err
+}
+
+func (c *tchanMetaClient) InstanceInfo(ctx Context) (*meta.InstanceInfo, error) {
+	var resp meta.InstanceInfoResult
+	args := meta.InstanceInfoArgs{}
+	success, err := c.client.Call(ctx, "Meta", "instanceInfo", &args, &resp)
+	if err == nil && !success {
+	}
+
+	return resp.GetSuccess(), err
+}
+
+func (c *tchanMetaClient) VersionInfo(ctx Context) (*meta.VersionInfo, error) {
+	var resp meta.VersionInfoResult
+	args := meta.VersionInfoArgs{}
+	success, err := c.client.Call(ctx, "Meta", "versionInfo", &args, &resp)
+	if err == nil && !success {
+	}
+
+	return resp.GetSuccess(), err
+}
+
 type tchanMetaServer struct {
 	handler tchanMeta
 }
@@ -49,6 +84,9 @@ func (s *tchanMetaServer) Service() string {
 func (s *tchanMetaServer) Methods() []string {
 	return []string{
 		"health",
+		"healthDetails",
+		"instanceInfo",
+		"versionInfo",
 	}
 }
 
@@ -56,6 +94,12 @@ func (s *tchanMetaServer) Handle(ctx Context, methodName string, protocol athrif
 	switch methodName {
 	case "health":
 		return s.handleHealth(ctx, protocol)
+	case "healthDetails":
+		return s.handleHealthDetails(ctx, protocol)
+	case "instanceInfo":
+		return s.handleInstanceInfo(ctx, protocol)
+	case "versionInfo":
+		return s.handleVersionInfo(ctx, protocol)
 	default:
 		return false, nil, fmt.Errorf("method %v not found in service %v", methodName, s.Service())
 	}
@@ -70,7 +114,67 @@ func (s *tchanMetaServer) handleHealth(ctx Context, protocol athrift.TProtocol)
 	}
 
 	r, err :=
-		s.handler.Health(ctx)
+		s.handler.Health(ctx, req.Hr)
+
+	if err != nil {
+		return false, nil, err
+	}
+
+	res.Success = r
+
+	return err == nil, &res, nil
+}
+
+func (s *tchanMetaServer) handleHealthDetails(ctx Context, protocol athrift.TProtocol) (bool, athrift.TStruct, error) {
+	var req meta.HealthDetailsArgs
+	var res meta.HealthDetailsResult
+
+	if err := req.Read(protocol); err != nil {
+		return false, nil, err
+	}
+
+	r, err :=
+		s.handler.HealthDetails(ctx)
+
+	if err != nil {
+		return false, nil, err
+	}
+
+	res.Success = r
+
+	return err == nil, &res, nil
+}
+
+func (s *tchanMetaServer) handleInstanceInfo(ctx Context, protocol athrift.TProtocol) (bool, athrift.TStruct, error) {
+	var req meta.InstanceInfoArgs
+	var res meta.InstanceInfoResult
+
+	if err := req.Read(protocol); err != nil {
+		return false, nil, err
+	}
+
+	r, err :=
+		s.handler.InstanceInfo(ctx)
+
+	if err != nil {
+		return false, nil, err
+	}
+
+	res.Success = r
+
+	return err == nil, &res, nil
+}
+
+func (s *tchanMetaServer) handleVersionInfo(ctx Context, protocol athrift.TProtocol) (bool, athrift.TStruct, error) {
+	var req meta.VersionInfoArgs
+	var res meta.VersionInfoResult
+
+	if err := req.Read(protocol); err != nil {
+		return false, nil, err
+	}
+
+	r, err :=
+		s.handler.VersionInfo(ctx)
 
 	if err != nil {
 		return false, nil, err
@@ -102,3 +102,10 @@ func runTest(t *testing.T, thriftFile string) error {
 	os.RemoveAll(tempDir)
 	return nil
 }
+
+func TestAllThriftWithGateway(t *testing.T) {
+	*generateGateway = true
+	defer func() { *generateGateway = false }()
+
+	TestAllThrift(t)
+}
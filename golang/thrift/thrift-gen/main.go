@@ -43,6 +43,7 @@ const tchannelThriftImport = "github.com/uber/tchannel/golang/thrift"
 
 var (
 	generateThrift     = flag.Bool("generateThrift", false, "Whether to generate all Thrift go code")
+	generateGateway    = flag.Bool("generateGateway", false, "Whether to generate an HTTP+JSON gateway for each service")
 	apacheThriftImport = flag.String("thriftImport", "github.com/apache/thrift/lib/go/thrift", "Go package to use for the Thrift import")
 	inputFile          = flag.String("inputFile", "", "The .thrift file to generate a client for")
 	outputFile         = flag.String("outputFile", "", "The output file to generate go code to")
@@ -55,6 +56,7 @@ type TemplateData struct {
 	Services       []*Service
 	ThriftImport   string
 	TChannelImport string
+	Gateway        bool
 }
 
 func main() {
@@ -115,6 +117,7 @@ func generateCode(outputFile string, tmpl *template.Template, pkg string, parsed
 		Services:       wrappedServices,
 		ThriftImport:   *apacheThriftImport,
 		TChannelImport: tchannelThriftImport,
+		Gateway:        *generateGateway,
 	}
 	if err := tmpl.Execute(buf, td); err != nil {
 		return fmt.Errorf("failed to execute template: %v", err)
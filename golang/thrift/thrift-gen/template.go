@@ -129,5 +129,76 @@ func (s *{{ .ServerStruct }}) Handle(ctx {{ contextType }}, methodName string, p
 
 {{ end }}
 
+{{ if $.Gateway }}
+type {{ .GatewayStruct }} struct {
+	client {{ .Interface }}
+}
+
+func {{ .GatewayConstructor }}(client {{ .Interface }}) thrift.TChanGateway {
+	return &{{ .GatewayStruct }}{client}
+}
+
+func (g *{{ .GatewayStruct }}) Service() string {
+	return "{{ .ThriftName }}"
+}
+
+func (g *{{ .GatewayStruct }}) Methods() []string {
+	return []string{
+		{{ range .Methods }}
+			"{{ .ThriftName }}",
+		{{ end }}
+	}
+}
+
+func (g *{{ .GatewayStruct }}) Handle(ctx {{ contextType }}, methodName string, decode func(args interface{}) error) (bool, interface{}, error) {
+	switch methodName {
+		{{ range .Methods }}
+			case "{{ .ThriftName }}":
+				return g.{{ .HandleFunc }}(ctx, decode)
+		{{ end }}
+		default:
+			return false, nil, fmt.Errorf("method %v not found in service %v", methodName, g.Service())
+	}
+}
+
+{{ range .Methods }}
+	func (g *{{ $svc.GatewayStruct }}) {{ .HandleFunc }}(ctx {{ contextType }}, decode func(args interface{}) error) (bool, interface{}, error) {
+		var req {{ .ArgsType }}
+		if err := decode(&req); err != nil {
+			return false, nil, err
+		}
+
+		{{ if .HasReturn }}
+			r, err :=
+		{{ else }}
+			err :=
+		{{ end }}
+				g.client.{{ .Name }}({{ .CallList "req" }})
+
+		if err != nil {
+			{{ if .HasExceptions }}
+			switch v := err.(type) {
+				{{ range .Exceptions }}
+					case {{ .ArgType }}:
+						return false, map[string]interface{}{"{{ .ThriftName }}": v}, nil
+				{{ end }}
+					default:
+						return false, nil, err
+			}
+			{{ else }}
+				return false, nil, err
+			{{ end }}
+		}
+
+		{{ if .HasReturn }}
+			return true, r, nil
+		{{ else }}
+			return true, nil, nil
+		{{ end }}
+	}
+
+{{ end }}
+{{ end }}
+
 {{ end }}
 `
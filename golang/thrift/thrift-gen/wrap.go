@@ -91,6 +91,16 @@ func (s *Service) ServerConstructor() string {
 	return "NewTChan" + goPublicName(s.Name) + "Server"
 }
 
+// GatewayStruct returns the name of the unexported struct that satisfies TChanGateway.
+func (s *Service) GatewayStruct() string {
+	return "tchan" + goPublicName(s.Name) + "Gateway"
+}
+
+// GatewayConstructor returns the name of the constructor used to create the TChanGateway interface.
+func (s *Service) GatewayConstructor() string {
+	return "NewTChan" + goPublicName(s.Name) + "Gateway"
+}
+
 type byMethodName []*Method
 
 func (l byMethodName) Len() int           { return len(l) }
@@ -225,6 +235,11 @@ func (a *Field) Declaration() string {
 	return fmt.Sprintf("%s %s", a.Name(), a.ArgType())
 }
 
+// ThriftName returns the thrift identifier for this field.
+func (a *Field) ThriftName() string {
+	return a.Field.Name
+}
+
 // Name returns the field name.
 func (a *Field) Name() string {
 	return goName(a.Field.Name)
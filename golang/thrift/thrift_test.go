@@ -130,7 +130,9 @@ func TestUnknownError(t *testing.T) {
 		args.s1.On("Simple", ctxArg()).Return(errors.New("unexpected err"))
 		got := args.c1.Simple(ctx)
 		require.Error(t, got)
-		require.Equal(t, tchannel.NewSystemError(tchannel.ErrCodeUnexpected, "unexpected err"), got)
+		assert.True(t, errors.Is(got, tchannel.NewSystemError(tchannel.ErrCodeUnexpected, "unexpected err")),
+			"unexpected error: %v", got)
+		assert.Contains(t, got.Error(), "request ID", "error should contain the server's request ID")
 	})
 }
 
@@ -0,0 +1,111 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+import (
+	"sync"
+	"time"
+)
+
+// throughputRateInterval is the minimum interval over which byte rates are measured.
+const throughputRateInterval = time.Second
+
+// Throughput is the number of bytes sent and received over connections. Bytes are counted
+// at the frame level, so they include frame headers but not TLS or encryption overhead.
+type Throughput struct {
+	BytesSent  int64 `json:"bytesSent"`
+	BytesRecvd int64 `json:"bytesRecvd"`
+
+	// SendRate and RecvRate are the bytes per second sent and received. Rates are measured
+	// between reads of the throughput that are at least a second apart, and are 0 until
+	// they have been measured.
+	SendRate float64 `json:"sendRate"`
+	RecvRate float64 `json:"recvRate"`
+}
+
+func (t Throughput) add(other Throughput) Throughput {
+	return Throughput{
+		BytesSent:  t.BytesSent + other.BytesSent,
+		BytesRecvd: t.BytesRecvd + other.BytesRecvd,
+		SendRate:   t.SendRate + other.SendRate,
+		RecvRate:   t.RecvRate + other.RecvRate,
+	}
+}
+
+// byteMeter counts bytes, and measures the rate between reads.
+type byteMeter struct {
+	mut          sync.Mutex
+	total        int64
+	sampledAt    time.Time
+	sampledTotal int64
+	rate         float64
+}
+
+func (m *byteMeter) add(n int) {
+	m.mut.Lock()
+	m.total += int64(n)
+	m.mut.Unlock()
+}
+
+// get returns the total bytes and the rate, which is updated if at least
+// throughputRateInterval has passed since it was last measured.
+func (m *byteMeter) get(now time.Time) (total int64, rate float64) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	if m.sampledAt.IsZero() {
+		m.sampledAt = now
+		m.sampledTotal = m.total
+	} else if elapsed := now.Sub(m.sampledAt); elapsed >= throughputRateInterval {
+		m.rate = float64(m.total-m.sampledTotal) / elapsed.Seconds()
+		m.sampledAt = now
+		m.sampledTotal = m.total
+	}
+	return m.total, m.rate
+}
+
+// connectionThroughput counts the bytes sent and received over a connection.
+type connectionThroughput struct {
+	sent  byteMeter
+	recvd byteMeter
+}
+
+// Throughput returns the bytes sent and received over the connection.
+func (c *Connection) Throughput() Throughput {
+	now := c.clock.Now()
+	var t Throughput
+	t.BytesSent, t.SendRate = c.throughput.sent.get(now)
+	t.BytesRecvd, t.RecvRate = c.throughput.recvd.get(now)
+	return t
+}
+
+// Throughput returns the bytes sent and received over all connections to the peer,
+// including connections that have been closed.
+func (p *Peer) Throughput() Throughput {
+	p.mut.RLock()
+	defer p.mut.RUnlock()
+
+	var t Throughput
+	for _, c := range p.connections {
+		t = t.add(c.Throughput())
+	}
+	return t
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+func TestThroughput(t *testing.T) {
+	clock := testutils.NewFakeClock(time.Unix(1000, 0))
+	server, err := NewChannel("svc", &ChannelOptions{Clock: clock})
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, server.ListenAndServe("127.0.0.1:0"), "ListenAndServe failed")
+	defer server.Close()
+	hostPort := server.PeerInfo().HostPort
+	testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg3: args.Arg3}, nil
+	})
+
+	client, err := NewChannel("client", &ChannelOptions{Clock: clock})
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	payload := make([]byte, 1000)
+	call := func() {
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		_, _, _, err := raw.Call(ctx, client, hostPort, "svc", "echo", nil, payload)
+		require.NoError(t, err, "Call failed")
+	}
+
+	call()
+	peer := client.Peers().GetOrAdd(hostPort)
+	first := peer.Throughput()
+	assert.True(t, first.BytesSent > int64(len(payload)), "sent bytes should include the payload")
+	assert.True(t, first.BytesRecvd > int64(len(payload)), "received bytes should include the echoed payload")
+	assert.Equal(t, 0.0, first.SendRate, "rate should not be measured on the first read")
+
+	call()
+	clock.Advance(2 * time.Second)
+	second := peer.Throughput()
+	assert.Equal(t, float64(second.BytesSent-first.BytesSent)/2, second.SendRate, "send rate mismatch")
+	assert.Equal(t, float64(second.BytesRecvd-first.BytesRecvd)/2, second.RecvRate, "recv rate mismatch")
+
+	state := client.IntrospectState(nil)
+	peerState := state.Peers[hostPort]
+	require.Len(t, peerState.Connections, 1, "expected a single connection")
+	assert.Equal(t, second.BytesSent, peerState.Throughput.BytesSent, "peer state throughput mismatch")
+	assert.Equal(t, second.BytesSent, peerState.Connections[0].Throughput.BytesSent,
+		"connection state throughput mismatch")
+
+	serverGauges := server.Gauges()
+	assert.True(t, serverGauges.Throughput.BytesRecvd >= 2*int64(len(payload)),
+		"server should count the received payloads")
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// TimeoutOptions configure the default timeouts for a subchannel's service.
+type TimeoutOptions struct {
+	// Default is the timeout used for outbound calls made using the subchannel
+	// when the caller's context does not have a deadline.
+	Default time.Duration
+
+	// PerOperation overrides Default for specific operations.
+	PerOperation map[string]time.Duration
+
+	// MaxInbound caps the time to live of inbound calls to the service, regardless of the
+	// timeout set by the caller. Inbound calls are not capped if this is zero.
+	MaxInbound time.Duration
+}
+
+// SetTimeouts sets the default timeouts for the subchannel's service. The timeouts are
+// stored in the channel's RuntimeOptions.
+func (c *SubChannel) SetTimeouts(opts TimeoutOptions) {
+	c.topChannel.UpdateRuntimeOptions(func(runtimeOpts *RuntimeOptions) {
+		runtimeOpts.Timeouts[c.serviceName] = opts
+	})
+}
+
+func (c *SubChannel) setTimeouts(opts TimeoutOptions) {
+	perOperation := make(map[string]time.Duration, len(opts.PerOperation))
+	for op, timeout := range opts.PerOperation {
+		perOperation[op] = timeout
+	}
+	opts.PerOperation = perOperation
+
+	c.timeoutsMut.Lock()
+	c.timeouts = opts
+	c.timeoutsMut.Unlock()
+}
+
+// defaultTimeout returns the timeout to use for outbound calls to the given operation
+// when the caller's context has no deadline, or 0 if there is no default.
+func (c *SubChannel) defaultTimeout(operation string) time.Duration {
+	c.timeoutsMut.RLock()
+	defer c.timeoutsMut.RUnlock()
+
+	if timeout, ok := c.timeouts.PerOperation[operation]; ok {
+		return timeout
+	}
+	return c.timeouts.Default
+}
+
+// withDefaultTimeout returns a context with the default timeout for the operation if the
+// given context does not have a deadline. The returned cancel function is nil if the
+// context was not modified.
+func (c *SubChannel) withDefaultTimeout(ctx context.Context, operation string) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, nil
+	}
+
+	timeout := c.defaultTimeout(operation)
+	if timeout <= 0 {
+		return ctx, nil
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	if headerCtx, ok := ctx.(ContextWithHeaders); ok {
+		return WrapWithHeaders(timeoutCtx, headerCtx.Headers()), cancel
+	}
+	return timeoutCtx, cancel
+}
+
+// maxInboundTimeout returns the cap on the time to live of inbound calls to the given
+// service, or 0 if there is no cap.
+func (subChMap *subChannelMap) maxInboundTimeout(serviceName string) time.Duration {
+	sc, ok := subChMap.get(serviceName)
+	if !ok {
+		return 0
+	}
+
+	sc.timeoutsMut.RLock()
+	defer sc.timeoutsMut.RUnlock()
+	return sc.timeouts.MaxInbound
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+// newDeadlineServer creates a server for "timeout-svc" whose handlers return the
+// remaining time to live for the call.
+func newDeadlineServer(t *testing.T) *Channel {
+	server, err := testutils.NewServer(&testutils.ChannelOpts{ServiceName: "timeout-svc"})
+	require.NoError(t, err, "NewServer failed")
+	handler := func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok, "inbound calls should have a deadline")
+		return &raw.Res{Arg3: []byte(deadline.Sub(time.Now()).String())}, nil
+	}
+	testutils.RegisterFunc(t, server, "op", handler)
+	testutils.RegisterFunc(t, server, "slow", handler)
+	return server
+}
+
+// callForTTL makes a call using the subchannel, and returns the time to live seen by the server.
+func callForTTL(t *testing.T, ctx context.Context, sc *SubChannel, operation string) time.Duration {
+	call, err := sc.BeginCall(ctx, operation, nil)
+	require.NoError(t, err, "BeginCall failed")
+	_, arg3, _, err := raw.WriteArgs(call, nil, nil)
+	require.NoError(t, err, "call failed")
+	ttl, err := time.ParseDuration(string(arg3))
+	require.NoError(t, err, "failed to parse TTL")
+	return ttl
+}
+
+func TestSubChannelDefaultTimeouts(t *testing.T) {
+	server := newDeadlineServer(t)
+	defer server.Close()
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	sc := client.GetSubChannel("timeout-svc")
+	sc.Peers().Add(server.PeerInfo().HostPort)
+
+	_, err = sc.BeginCall(context.Background(), "op", nil)
+	assert.Equal(t, ErrTimeoutRequired, err, "calls without a deadline or default timeout should fail")
+
+	sc.SetTimeouts(TimeoutOptions{
+		Default:      100 * time.Millisecond,
+		PerOperation: map[string]time.Duration{"slow": 500 * time.Millisecond},
+	})
+
+	ttl := callForTTL(t, context.Background(), sc, "op")
+	assert.True(t, ttl > 50*time.Millisecond && ttl <= 100*time.Millisecond, "unexpected TTL for op: %v", ttl)
+
+	ttl = callForTTL(t, context.Background(), sc, "slow")
+	assert.True(t, ttl > 400*time.Millisecond && ttl <= 500*time.Millisecond, "unexpected TTL for slow: %v", ttl)
+
+	// The default is not used if the caller's context has a deadline.
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	ttl = callForTTL(t, ctx, sc, "op")
+	assert.True(t, ttl > 500*time.Millisecond, "the caller's deadline should be used, got TTL %v", ttl)
+}
+
+func TestSubChannelMaxInboundTimeout(t *testing.T) {
+	server := newDeadlineServer(t)
+	defer server.Close()
+	server.GetSubChannel("timeout-svc").SetTimeouts(TimeoutOptions{MaxInbound: 100 * time.Millisecond})
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+	sc := client.GetSubChannel("timeout-svc")
+	sc.Peers().Add(server.PeerInfo().HostPort)
+
+	ctx, cancel := NewContext(time.Second)
+	defer cancel()
+	ttl := callForTTL(t, ctx, sc, "op")
+	assert.True(t, ttl <= 100*time.Millisecond, "inbound TTL should be capped, got %v", ttl)
+}
+
+func TestSubChannelDefaultTimeoutReleased(t *testing.T) {
+	server, err := testutils.NewServer(&testutils.ChannelOpts{ServiceName: "timeout-svc"})
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "busy", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{SystemErr: ErrServerBusy}, nil
+	})
+
+	client, err := testutils.NewClient(nil)
+	require.NoError(t, err, "NewClient failed")
+	defer client.Close()
+
+	sc := client.GetSubChannel("timeout-svc")
+	sc.Peers().Add(server.PeerInfo().HostPort)
+	sc.SetTimeouts(TimeoutOptions{Default: time.Minute})
+
+	// The context created for the default timeout is released when the call fails.
+	call, err := sc.BeginCall(context.Background(), "busy", nil)
+	require.NoError(t, err, "BeginCall failed")
+	_, _, _, err = raw.WriteArgs(call, nil, nil)
+	assert.Equal(t, ErrCodeBusy, GetSystemErrorCode(err), "Unexpected error: %v", err)
+	assert.Equal(t, context.Canceled, OutboundCallContext(call).Err(), "default timeout context should be released")
+}
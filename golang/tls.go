@@ -0,0 +1,296 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// TLSNextProto is the ALPN protocol name used by TLS connections carrying TChannel traffic.
+const TLSNextProto = "tchannel"
+
+const defaultTLSHandshakeTimeout = 10 * time.Second
+
+var errTLSNoCertificate = errors.New("TLS configuration has no certificate")
+
+// TLSOptions configure TLS for a channel's connections.
+type TLSOptions struct {
+	// Config is the TLS configuration for outbound connections. Outbound connections
+	// do not use TLS if Config is nil, unless there is a configuration in PeerConfigs.
+	Config *tls.Config
+
+	// PeerConfigs overrides Config for outbound connections to specific peers,
+	// keyed by the peer's host:port.
+	PeerConfigs map[string]*tls.Config
+
+	// HandshakeTimeout is the time allowed for connecting and completing the TLS
+	// handshake, for both inbound and outbound connections. Defaults to 10 seconds.
+	HandshakeTimeout time.Duration
+
+	// ClientCAs enables mutual TLS for connections accepted by ListenTLS. Clients must
+	// present a certificate signed by one of these CAs, and the certificate's identity
+	// is available to handlers using CallerIdentity.
+	ClientCAs *x509.CertPool
+
+	// Identity maps a verified client certificate to the caller's identity. Defaults
+	// to the certificate's SPIFFE ID, or its first URI or DNS name, or its common name.
+	Identity func(cert *x509.Certificate) string
+
+	// Authorization maps a service name to the authorization policies for its operations.
+	// Calls to operations without a policy are allowed.
+	Authorization map[string]map[string]AuthorizationPolicy
+
+	// Certificates provides the certificate for both inbound and outbound TLS connections,
+	// replacing any certificates in Config, PeerConfigs and the configuration passed to
+	// ListenTLS. Use RotateCertificates to reload it.
+	Certificates *CertificateReloader
+
+	// CycleConnections gracefully closes existing TLS connections when RotateCertificates
+	// loads a new certificate, so that long-lived connections use the new certificate.
+	CycleConnections bool
+}
+
+// AuthorizationPolicy returns whether a caller with the given identity may call an operation.
+// The identity is empty if the caller did not connect using mutual TLS.
+type AuthorizationPolicy func(identity string) bool
+
+// AllowIdentities returns a policy that allows callers with any of the given identities.
+func AllowIdentities(identities ...string) AuthorizationPolicy {
+	allowed := make(map[string]struct{}, len(identities))
+	for _, identity := range identities {
+		allowed[identity] = struct{}{}
+	}
+	return func(identity string) bool {
+		if identity == "" {
+			return false
+		}
+		_, ok := allowed[identity]
+		return ok
+	}
+}
+
+// CallerIdentity returns the identity from the verified TLS client certificate of the
+// inbound call for the given context, or an empty string if there is none.
+func CallerIdentity(ctx context.Context) string {
+	if call, ok := CurrentCall(ctx).(*InboundCall); ok {
+		return call.CallerIdentity()
+	}
+	return ""
+}
+
+// certIdentity returns the default identity for a certificate.
+func certIdentity(cert *x509.Certificate) string {
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			return uri.String()
+		}
+	}
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return cert.Subject.CommonName
+}
+
+// peerIdentity returns the identity of the remote peer's verified certificate, or
+// an empty string if the connection does not use TLS or the peer has no certificate.
+func (o *TLSOptions) peerIdentity(conn net.Conn) string {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return ""
+	}
+	chains := tlsConn.ConnectionState().VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return ""
+	}
+
+	cert := chains[0][0]
+	if o != nil && o.Identity != nil {
+		return o.Identity(cert)
+	}
+	return certIdentity(cert)
+}
+
+// authorized returns whether the inbound call is allowed by the authorization policies.
+func (o *TLSOptions) authorized(call *InboundCall) bool {
+	if o == nil {
+		return true
+	}
+	policy, ok := o.Authorization[call.ServiceName()][string(call.Operation())]
+	if !ok {
+		return true
+	}
+	return policy(call.CallerIdentity())
+}
+
+// serverConfig returns the configuration used for connections accepted by ListenTLS.
+func (o *TLSOptions) serverConfig(config *tls.Config) *tls.Config {
+	config = o.withCertificates(withNextProto(config))
+	if o != nil && o.ClientCAs != nil {
+		config.ClientCAs = o.ClientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config
+}
+
+func (o *TLSOptions) handshakeTimeout() time.Duration {
+	if o == nil || o.HandshakeTimeout <= 0 {
+		return defaultTLSHandshakeTimeout
+	}
+	return o.HandshakeTimeout
+}
+
+// configFor returns the TLS configuration for outbound connections to the given
+// peer, or nil if connections to the peer do not use TLS.
+func (o *TLSOptions) configFor(hostPort string) *tls.Config {
+	if o == nil {
+		return nil
+	}
+	if config, ok := o.PeerConfigs[hostPort]; ok {
+		return config
+	}
+	return o.Config
+}
+
+// withNextProto returns a copy of the config that advertises the TChannel ALPN protocol.
+func withNextProto(config *tls.Config) *tls.Config {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	config = config.Clone()
+	for _, proto := range config.NextProtos {
+		if proto == TLSNextProto {
+			return config
+		}
+	}
+	config.NextProtos = append(config.NextProtos, TLSNextProto)
+	return config
+}
+
+// dial creates a connection to the given peer using the channel's Dialer, or TCP if
+// there is none, through the peer's proxy if there is one, and uses TLS if it is
+// configured for the peer.
+func (ch *Channel) dial(hostPort string) (net.Conn, error) {
+	config := ch.tlsOptions.configFor(hostPort)
+	proxy := ch.proxyOptions.proxyFor(hostPort)
+	if ch.dialer == nil && proxy == nil {
+		if config == nil {
+			return net.Dial("tcp", hostPort)
+		}
+
+		dialer := &net.Dialer{Timeout: ch.tlsOptions.handshakeTimeout()}
+		conn, err := tls.DialWithDialer(dialer, "tcp", hostPort, ch.tlsOptions.withCertificates(withNextProto(config)))
+		if err != nil {
+			ch.statsReporter.IncCounter("outbound.tls.handshake-failed", ch.commonStatsTags, 1)
+			return nil, err
+		}
+		return conn, nil
+	}
+
+	var conn net.Conn
+	var err error
+	if proxy != nil {
+		if conn, err = ch.proxyOptions.dial(proxy, hostPort, ch.dialer); err != nil {
+			ch.statsReporter.IncCounter("outbound.proxy.connect-failed", ch.commonStatsTags, 1)
+		}
+	} else {
+		conn, err = ch.dialer(hostPort)
+	}
+	if err != nil || config == nil {
+		return conn, err
+	}
+
+	config = ch.tlsOptions.withCertificates(withNextProto(config))
+	if config.ServerName == "" {
+		if host, _, err := net.SplitHostPort(hostPort); err == nil {
+			config = config.Clone()
+			config.ServerName = host
+		}
+	}
+	tlsConn := tls.Client(conn, config)
+	tlsConn.SetDeadline(time.Now().Add(ch.tlsOptions.handshakeTimeout()))
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		ch.statsReporter.IncCounter("outbound.tls.handshake-failed", ch.commonStatsTags, 1)
+		return nil, err
+	}
+	tlsConn.SetDeadline(time.Time{})
+	return tlsConn, nil
+}
+
+// ListenTLS listens on the given address and serves incoming requests over TLS
+// using the given configuration, which must include a certificate unless the channel's
+// TLS options set Certificates. Client certificates are required if the channel's TLS
+// options set ClientCAs.
+// This method does not block as the handling of connections is done in a goroutine.
+func (ch *Channel) ListenTLS(hostPort string, config *tls.Config) error {
+	mutable := &ch.mutable
+	mutable.mut.RLock()
+
+	if mutable.l != nil {
+		mutable.mut.RUnlock()
+		return errAlreadyListening
+	}
+
+	l, err := net.Listen("tcp", hostPort)
+	if err != nil {
+		mutable.mut.RUnlock()
+		return err
+	}
+
+	mutable.mut.RUnlock()
+	if err := ch.ServeTLS(l, config); err != nil {
+		l.Close()
+		return err
+	}
+	return nil
+}
+
+// ServeTLS serves incoming requests over TLS using the provided listener, which is
+// configured the same way as ListenTLS.
+func (ch *Channel) ServeTLS(l net.Listener, config *tls.Config) error {
+	config = ch.tlsOptions.serverConfig(config)
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return errTLSNoCertificate
+	}
+	return ch.Serve(tls.NewListener(l, config))
+}
+
+// serveTLSConnection completes the TLS handshake for an accepted connection before
+// creating a Connection for it.
+func (ch *Channel) serveTLSConnection(conn *tls.Conn) {
+	conn.SetDeadline(time.Now().Add(ch.tlsOptions.handshakeTimeout()))
+	if err := conn.Handshake(); err != nil {
+		ch.log.Warnf("TLS handshake with %v failed: %v", conn.RemoteAddr(), err)
+		ch.statsReporter.IncCounter("inbound.tls.handshake-failed", ch.commonStatsTags, 1)
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	ch.serveConnection(conn)
+}
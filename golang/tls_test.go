@@ -0,0 +1,289 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package tchannel_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/uber/tchannel/golang"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+// testCA is a certificate authority for issuing test certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "GenerateKey failed")
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err, "CreateCertificate failed")
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err, "ParseCertificate failed")
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue returns a certificate for 127.0.0.1 with the given URI SANs, which can be
+// used by both servers and clients.
+func (ca *testCA) issue(t *testing.T, uris ...string) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "GenerateKey failed")
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		require.NoError(t, err, "failed to parse URI")
+		template.URIs = append(template.URIs, u)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err, "CreateCertificate failed")
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func callTLSServer(client, server *Channel) error {
+	_, err := callWithTimeout(client, server.PeerInfo().HostPort, "tls-svc", "echo", []byte("arg2"), []byte("arg3"))
+	return err
+}
+
+func TestTLS(t *testing.T) {
+	ca := newTestCA(t)
+	server, err := testutils.NewServer(&testutils.ChannelOpts{
+		ServiceName:     "tls-svc",
+		ServerTLSConfig: &tls.Config{Certificates: []tls.Certificate{ca.issue(t)}},
+	})
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+
+	client, err := NewChannel("tls-client", &ChannelOptions{
+		TLS: &TLSOptions{Config: &tls.Config{RootCAs: ca.pool}},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+	assert.NoError(t, callTLSServer(client, server), "call over TLS failed")
+
+	// Clients that only use TLS for specific peers.
+	peerClient, err := NewChannel("tls-client", &ChannelOptions{
+		TLS: &TLSOptions{PeerConfigs: map[string]*tls.Config{
+			server.PeerInfo().HostPort: {RootCAs: ca.pool},
+		}},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer peerClient.Close()
+	assert.NoError(t, callTLSServer(peerClient, server), "call using a per-peer TLS config failed")
+
+	// Clients that do not trust the server's certificate cannot connect.
+	untrustedClient, err := NewChannel("tls-client", &ChannelOptions{
+		TLS: &TLSOptions{Config: &tls.Config{RootCAs: newTestCA(t).pool}},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer untrustedClient.Close()
+	assert.Error(t, callTLSServer(untrustedClient, server), "call with an untrusted certificate should fail")
+}
+
+func TestListenTLS(t *testing.T) {
+	ca := newTestCA(t)
+	server, err := NewChannel("tls-svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	defer server.Close()
+
+	assert.Error(t, server.ListenTLS("127.0.0.1:0", &tls.Config{}), "ListenTLS without a certificate should fail")
+	require.NoError(t, server.ListenTLS("127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{ca.issue(t)}}),
+		"ListenTLS failed")
+	testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+
+	client, err := NewChannel("tls-client", &ChannelOptions{
+		TLS: &TLSOptions{Config: &tls.Config{RootCAs: ca.pool}},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+	assert.NoError(t, callTLSServer(client, server), "call over TLS failed")
+}
+
+func TestTLSNextProto(t *testing.T) {
+	ca := newTestCA(t)
+	server, err := testutils.NewServer(&testutils.ChannelOpts{
+		ServiceName:     "tls-svc",
+		ServerTLSConfig: &tls.Config{Certificates: []tls.Certificate{ca.issue(t)}},
+	})
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+
+	conn, err := tls.Dial("tcp", server.PeerInfo().HostPort, &tls.Config{
+		RootCAs:    ca.pool,
+		NextProtos: []string{"h2", TLSNextProto},
+	})
+	require.NoError(t, err, "tls.Dial failed")
+	defer conn.Close()
+	assert.Equal(t, TLSNextProto, conn.ConnectionState().NegotiatedProtocol, "ALPN protocol mismatch")
+}
+
+func TestTLSHandshakeTimeout(t *testing.T) {
+	ca := newTestCA(t)
+	stats := newRecordingStatsReporter()
+	server, err := testutils.NewServer(&testutils.ChannelOpts{
+		ServiceName:     "tls-svc",
+		StatsReporter:   stats,
+		TLS:             &TLSOptions{HandshakeTimeout: 50 * time.Millisecond},
+		ServerTLSConfig: &tls.Config{Certificates: []tls.Certificate{ca.issue(t)}},
+	})
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+
+	// Connect without starting a handshake, the server should close the connection.
+	conn, err := net.Dial("tcp", server.PeerInfo().HostPort)
+	require.NoError(t, err, "Dial failed")
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(time.Second))
+	started := time.Now()
+	_, err = ioutil.ReadAll(conn)
+	assert.NoError(t, err, "server should close the connection")
+	assert.True(t, time.Since(started) < 500*time.Millisecond, "connection closed after %v", time.Since(started))
+
+	stats.Lock()
+	_, failed := stats.Values["inbound.tls.handshake-failed"]
+	stats.Unlock()
+	assert.True(t, failed, "handshake failure should be counted")
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	server, err := testutils.NewServer(&testutils.ChannelOpts{
+		ServiceName: "tls-svc",
+		TLS: &TLSOptions{
+			ClientCAs: ca.pool,
+			Authorization: map[string]map[string]AuthorizationPolicy{
+				"tls-svc": {"secret": AllowIdentities("spiffe://test/allowed")},
+			},
+		},
+		ServerTLSConfig: &tls.Config{Certificates: []tls.Certificate{ca.issue(t)}},
+	})
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+	whoami := func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg3: []byte(CallerIdentity(ctx))}, nil
+	}
+	testutils.RegisterFunc(t, server, "whoami", whoami)
+	testutils.RegisterFunc(t, server, "secret", whoami)
+
+	newClient := func(certs ...tls.Certificate) *Channel {
+		client, err := NewChannel("tls-client", &ChannelOptions{
+			TLS: &TLSOptions{Config: &tls.Config{RootCAs: ca.pool, Certificates: certs}},
+		})
+		require.NoError(t, err, "NewChannel failed")
+		return client
+	}
+	call := func(client *Channel, operation string) (string, error) {
+		ctx, cancel := NewContext(time.Second)
+		defer cancel()
+		_, arg3, _, err := raw.Call(ctx, client, server.PeerInfo().HostPort, "tls-svc", operation, nil, nil)
+		return string(arg3), err
+	}
+
+	allowed := newClient(ca.issue(t, "spiffe://test/allowed", "https://example.com"))
+	defer allowed.Close()
+	identity, err := call(allowed, "whoami")
+	require.NoError(t, err, "whoami failed")
+	assert.Equal(t, "spiffe://test/allowed", identity, "caller identity should be the SPIFFE ID")
+	_, err = call(allowed, "secret")
+	assert.NoError(t, err, "allowed caller should be authorized")
+
+	other := newClient(ca.issue(t, "spiffe://test/other"))
+	defer other.Close()
+	identity, err = call(other, "whoami")
+	require.NoError(t, err, "whoami failed")
+	assert.Equal(t, "spiffe://test/other", identity, "caller identity mismatch")
+	_, err = call(other, "secret")
+	assert.True(t, IsPermissionDenied(err), "other caller should not be authorized, got %v", err)
+
+	noCert := newClient()
+	defer noCert.Close()
+	_, err = call(noCert, "whoami")
+	assert.Error(t, err, "callers without a client certificate should be rejected")
+}
+
+func TestTLSWithDialer(t *testing.T) {
+	ca := newTestCA(t)
+	server, err := testutils.NewServer(&testutils.ChannelOpts{
+		ServiceName:     "tls-svc",
+		ServerTLSConfig: &tls.Config{Certificates: []tls.Certificate{ca.issue(t)}},
+	})
+	require.NoError(t, err, "NewServer failed")
+	defer server.Close()
+	testutils.RegisterFunc(t, server, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+
+	var dialed []string
+	client, err := NewChannel("tls-client", &ChannelOptions{
+		TLS: &TLSOptions{Config: &tls.Config{RootCAs: ca.pool}},
+		Dialer: func(hostPort string) (net.Conn, error) {
+			dialed = append(dialed, hostPort)
+			return net.Dial("tcp", hostPort)
+		},
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+	assert.NoError(t, callTLSServer(client, server), "call over TLS using a Dialer failed")
+	assert.Equal(t, []string{server.PeerInfo().HostPort}, dialed, "Dialer should be used to connect")
+}
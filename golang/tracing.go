@@ -53,18 +53,19 @@ func (s Span) String() string {
 	return fmt.Sprintf("TraceID=%d,ParentID=%d,SpanID=%d", s.traceID, s.parentID, s.spanID)
 }
 
+// Spans are encoded as spanid:8 parentid:8 traceid:8 flags:1, as described in the protocol.
 func (s *Span) read(r *typed.ReadBuffer) error {
-	s.traceID = r.ReadUint64()
-	s.parentID = r.ReadUint64()
 	s.spanID = r.ReadUint64()
+	s.parentID = r.ReadUint64()
+	s.traceID = r.ReadUint64()
 	s.flags = r.ReadSingleByte()
 	return r.Err()
 }
 
 func (s *Span) write(w *typed.WriteBuffer) error {
-	w.WriteUint64(s.traceID)
-	w.WriteUint64(s.parentID)
 	w.WriteUint64(s.spanID)
+	w.WriteUint64(s.parentID)
+	w.WriteUint64(s.traceID)
 	w.WriteSingleByte(s.flags)
 	return w.Err()
 }
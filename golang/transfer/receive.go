@@ -0,0 +1,228 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/uber/tchannel/golang"
+	"golang.org/x/net/context"
+)
+
+// Receiver stores the files sent to a transfer handler.
+type Receiver interface {
+	// Received returns the number of bytes of the described file that have already
+	// been received, which is where a resumed transfer should start.
+	Received(ctx context.Context, meta *Metadata) (int64, error)
+
+	// Writer returns a writer for the described file, positioned at meta.Offset.
+	// Only chunks that pass their checksum are written. The writer is closed once
+	// the transfer ends, including when it fails part way through.
+	Writer(ctx context.Context, meta *Metadata) (io.WriteCloser, error)
+}
+
+// ReceiveOptions are options for a transfer handler.
+type ReceiveOptions struct {
+	// Progress is called after each chunk is received, with the number of bytes of the
+	// file received so far and the size of the file (-1 if unknown).
+	Progress func(name string, received, size int64)
+
+	// OnError is called if the response to a transfer cannot be sent.
+	OnError func(ctx context.Context, err error)
+}
+
+func (o *ReceiveOptions) progress(name string, received, size int64) {
+	if o != nil && o.Progress != nil {
+		o.Progress(name, received, size)
+	}
+}
+
+func (o *ReceiveOptions) onError(ctx context.Context, err error) {
+	if o != nil && o.OnError != nil {
+		o.OnError(ctx, err)
+	}
+}
+
+// Wrap wraps a Receiver as a tchannel.Handler that can be passed to tchannel.Register.
+func Wrap(receiver Receiver, opts *ReceiveOptions) tchannel.Handler {
+	return tchannel.HandlerFunc(func(ctx context.Context, call *tchannel.InboundCall) {
+		response := call.Response()
+
+		var meta Metadata
+		if err := tchannel.NewArgReader(call.Arg2Reader()).ReadJSON(&meta); err != nil {
+			err = tchannel.NewBadRequestError("invalid transfer metadata", err)
+			if err := response.SendSystemError(err); err != nil {
+				opts.onError(ctx, err)
+			}
+			return
+		}
+
+		reader, err := call.Arg3Reader()
+		if err != nil {
+			opts.onError(ctx, err)
+			return
+		}
+
+		result, err := receive(ctx, receiver, &meta, reader, opts)
+		if err != nil {
+			// The sender writes the whole file before reading the response, so read
+			// and discard the rest of it rather than leaving it buffered.
+			io.Copy(ioutil.Discard, reader)
+			reader.Close()
+		}
+		if err := respond(response, result, err); err != nil {
+			opts.onError(ctx, err)
+		}
+	})
+}
+
+func receive(ctx context.Context, receiver Receiver, meta *Metadata, reader io.ReadCloser,
+	opts *ReceiveOptions) (*Result, error) {
+
+	result := &Result{Name: meta.Name}
+	if meta.Query {
+		if err := reader.Close(); err != nil {
+			return result, err
+		}
+		var err error
+		result.Received, err = receiver.Received(ctx, meta)
+		return result, err
+	}
+
+	writer, err := receiver.Writer(ctx, meta)
+	if err != nil {
+		return result, err
+	}
+
+	result.Received = meta.Offset
+	var buf []byte
+	for {
+		data, err := readChunk(reader, buf, result.Received)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writer.Close()
+			return result, err
+		}
+		buf = data
+
+		if _, err := writer.Write(data); err != nil {
+			writer.Close()
+			return result, err
+		}
+		result.Received += int64(len(data))
+		result.Chunks++
+		opts.progress(meta.Name, result.Received, meta.Size)
+	}
+
+	if err := reader.Close(); err != nil {
+		writer.Close()
+		return result, err
+	}
+	return result, writer.Close()
+}
+
+// respond writes the result of a transfer. If the transfer failed, the response is
+// an application error with the error message as arg3.
+func respond(response *tchannel.InboundCallResponse, result *Result, err error) error {
+	var arg3 []byte
+	if err != nil {
+		if err := response.SetApplicationError(); err != nil {
+			return err
+		}
+		arg3 = []byte(err.Error())
+	}
+
+	if err := tchannel.NewArgWriter(response.Arg2Writer()).WriteJSON(result); err != nil {
+		return err
+	}
+	return tchannel.NewArgWriter(response.Arg3Writer()).Write(arg3)
+}
+
+type dirReceiver struct {
+	dir string
+}
+
+// NewDirReceiver returns a Receiver that stores files in the given directory, using
+// the name in the transfer's metadata. Names must not contain path separators.
+func NewDirReceiver(dir string) Receiver {
+	return dirReceiver{dir}
+}
+
+func (r dirReceiver) path(name string) (string, error) {
+	if name == "" || name == "." || name == ".." || name != filepath.Base(name) {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+	return filepath.Join(r.dir, name), nil
+}
+
+func (r dirReceiver) Received(ctx context.Context, meta *Metadata) (int64, error) {
+	path, err := r.path(meta.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (r dirReceiver) Writer(ctx context.Context, meta *Metadata) (io.WriteCloser, error) {
+	path, err := r.path(meta.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if meta.Offset > info.Size() {
+		f.Close()
+		return nil, fmt.Errorf("cannot resume %q at offset %v, only %v bytes have been received",
+			meta.Name, meta.Offset, info.Size())
+	}
+
+	if err := f.Truncate(meta.Offset); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(meta.Offset, os.SEEK_SET); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/uber/tchannel/golang"
+	"golang.org/x/net/context"
+)
+
+// ApplicationError is returned when the receiver fails a transfer, such as when a chunk
+// fails its checksum or the file cannot be written. The Result returned alongside it
+// reports how much of the file the receiver has, so the transfer can be resumed.
+type ApplicationError struct {
+	Message string
+}
+
+func (e ApplicationError) Error() string {
+	return fmt.Sprintf("transfer failed: %v", e.Message)
+}
+
+// Send sends the contents of r as the file described by meta to the given hostPort.
+// r must be positioned at meta.Offset. If the receiver fails the transfer, the error
+// is an ApplicationError, and the returned Result is still valid.
+func Send(ctx context.Context, ch *tchannel.Channel, hostPort, serviceName, operation string,
+	meta *Metadata, r io.Reader, opts *SendOptions) (*Result, error) {
+
+	call, err := ch.BeginCall(ctx, hostPort, serviceName, operation, &tchannel.CallOptions{Format: tchannel.Raw})
+	if err != nil {
+		return nil, err
+	}
+	return send(call, meta, r, opts)
+}
+
+// SendSC is like Send, but uses the given subchannel to choose a peer.
+func SendSC(ctx context.Context, sc *tchannel.SubChannel, operation string,
+	meta *Metadata, r io.Reader, opts *SendOptions) (*Result, error) {
+
+	call, err := sc.BeginCall(ctx, operation, &tchannel.CallOptions{Format: tchannel.Raw})
+	if err != nil {
+		return nil, err
+	}
+	return send(call, meta, r, opts)
+}
+
+// Received asks the receiver at hostPort how many bytes of the named file it has.
+func Received(ctx context.Context, ch *tchannel.Channel, hostPort, serviceName, operation, name string) (int64, error) {
+	result, err := Send(ctx, ch, hostPort, serviceName, operation, &Metadata{Name: name, Size: -1, Query: true}, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	return result.Received, nil
+}
+
+// SendFile sends the file at path to the given hostPort, named by the base of path.
+// If the receiver already has part of the file, the transfer resumes from there.
+func SendFile(ctx context.Context, ch *tchannel.Channel, hostPort, serviceName, operation, path string,
+	opts *SendOptions) (*Result, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &Metadata{Name: filepath.Base(path), Size: info.Size()}
+	return SendResumable(ctx, ch, hostPort, serviceName, operation, meta, f, opts)
+}
+
+// SendResumable sends the contents of r as the file described by meta, starting from
+// the number of bytes the receiver already has, so meta.Offset is ignored. If
+// opts.Resume is set and the transfer fails part way through, it is resumed from the
+// number of bytes the receiver has received.
+func SendResumable(ctx context.Context, ch *tchannel.Channel, hostPort, serviceName, operation string,
+	meta *Metadata, r io.ReadSeeker, opts *SendOptions) (*Result, error) {
+
+	for resumed := 0; ; resumed++ {
+		result, err := sendFromReceived(ctx, ch, hostPort, serviceName, operation, meta, r, opts)
+		if err == nil || !opts.shouldResume(err, resumed) {
+			return result, err
+		}
+
+		select {
+		case <-time.After(opts.Resume.Backoff):
+		case <-ctx.Done():
+			return nil, err
+		}
+	}
+}
+
+// sendFromReceived asks the receiver how much of the file it has, and sends the rest.
+func sendFromReceived(ctx context.Context, ch *tchannel.Channel, hostPort, serviceName, operation string,
+	meta *Metadata, r io.ReadSeeker, opts *SendOptions) (*Result, error) {
+
+	attempt := *meta
+	var err error
+	if attempt.Offset, err = Received(ctx, ch, hostPort, serviceName, operation, attempt.Name); err != nil {
+		return nil, err
+	}
+	if attempt.Size >= 0 && attempt.Offset > attempt.Size {
+		return nil, fmt.Errorf("receiver has %v bytes of %v, which is larger than the file (%v bytes)",
+			attempt.Offset, attempt.Name, attempt.Size)
+	}
+	if _, err := r.Seek(attempt.Offset, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+
+	return Send(ctx, ch, hostPort, serviceName, operation, &attempt, r, opts)
+}
+
+func send(call *tchannel.OutboundCall, meta *Metadata, r io.Reader, opts *SendOptions) (*Result, error) {
+	if err := tchannel.NewArgWriter(call.Arg2Writer()).WriteJSON(meta); err != nil {
+		return nil, err
+	}
+
+	writer, err := call.Arg3Writer()
+	if err != nil {
+		return nil, err
+	}
+
+	if !meta.Query {
+		buf := make([]byte, opts.chunkSize())
+		transferred := meta.Offset
+		for {
+			n, err := io.ReadFull(r, buf)
+			if n > 0 {
+				if err := writeChunk(writer, buf[:n]); err != nil {
+					return nil, err
+				}
+				transferred += int64(n)
+				opts.progress(meta.Name, transferred, meta.Size)
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	response := call.Response()
+	result := &Result{}
+	if err := tchannel.NewArgReader(response.Arg2Reader()).ReadJSON(result); err != nil {
+		return nil, err
+	}
+
+	var arg3 []byte
+	if err := tchannel.NewArgReader(response.Arg3Reader()).Read(&arg3); err != nil {
+		return nil, err
+	}
+	if response.ApplicationError() {
+		return result, ApplicationError{Message: string(arg3)}
+	}
+	return result, nil
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+// Package transfer sends files and other blobs over TChannel.
+//
+// A transfer is a single call whose arg2 is a JSON encoded Metadata describing the
+// file, and whose arg3 streams the file contents as a sequence of chunks. Each chunk
+// is length-prefixed and followed by a CRC-32 (Castagnoli) checksum of its contents,
+// so a corrupted chunk is detected before it is written. The receiver only writes
+// chunks that pass their checksum, so a transfer that fails part way through can be
+// resumed from the number of bytes the receiver reports having received. Setting
+// SendOptions.Resume does this automatically, so a transfer interrupted by a lost
+// connection continues on a new connection rather than starting again.
+//
+// Handlers are created using Wrap with a Receiver, such as the one returned by
+// NewDirReceiver, and files are sent using Send or SendFile.
+package transfer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/uber/tchannel/golang"
+)
+
+const (
+	// DefaultChunkSize is the chunk size used if SendOptions does not specify one.
+	DefaultChunkSize = 64 * 1024
+
+	// MaxChunkSize is the largest chunk that can be sent or received.
+	MaxChunkSize = 16 * 1024 * 1024
+
+	chunkHeaderSize   = 4
+	chunkChecksumSize = 4
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// ErrChunkTooLarge is returned when a chunk larger than MaxChunkSize is received.
+	ErrChunkTooLarge = errors.New("transfer chunk exceeds the maximum chunk size")
+
+	// ErrTruncatedChunk is returned when the sender ends a transfer part way through a chunk.
+	ErrTruncatedChunk = errors.New("transfer ended part way through a chunk")
+)
+
+// Metadata describes a transfer, and is sent as arg2 of the call.
+type Metadata struct {
+	// Name is the name of the file being transferred.
+	Name string `json:"name"`
+
+	// Size is the total size of the file, or -1 if it is not known.
+	Size int64 `json:"size"`
+
+	// Offset is the offset in the file that the transfer starts at. It is non-zero
+	// when resuming a transfer that previously failed.
+	Offset int64 `json:"offset"`
+
+	// Query is set when the sender only wants to know how much of the file the
+	// receiver already has. No file contents are sent.
+	Query bool `json:"query,omitempty"`
+
+	// Headers are application specific key-value pairs.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Result is returned by the receiver once a transfer completes, and is sent as arg2
+// of the response.
+type Result struct {
+	// Name is the name of the file that was transferred.
+	Name string `json:"name"`
+
+	// Received is the number of bytes of the file the receiver has, including any
+	// bytes received by earlier transfers that this transfer resumed.
+	Received int64 `json:"received"`
+
+	// Chunks is the number of chunks received by this transfer.
+	Chunks int `json:"chunks"`
+}
+
+// SendOptions are options for sending a transfer.
+type SendOptions struct {
+	// ChunkSize is the number of bytes of the file sent in each chunk.
+	// If it is not set, DefaultChunkSize is used.
+	ChunkSize int
+
+	// Progress is called after each chunk is sent, with the number of bytes of the
+	// file sent so far (including any bytes sent by the transfers this one resumes)
+	// and the size of the file (-1 if unknown).
+	Progress func(name string, transferred, size int64)
+
+	// Resume enables resuming transfers sent using SendFile or SendResumable if they
+	// fail part way through, such as when the connection to the receiver is lost.
+	// Transfers are not resumed if it is not set.
+	Resume *ResumeOptions
+}
+
+// ResumeOptions configure how a transfer that fails part way through is resumed. The
+// transfer is resumed on a new call, and so on a new connection if the previous one
+// was lost, from the number of bytes the receiver reports having received. All attempts
+// share the deadline of the context used to start the transfer.
+type ResumeOptions struct {
+	// MaxAttempts is the maximum number of times the transfer is resumed.
+	// If it is not set, DefaultMaxResumeAttempts is used.
+	MaxAttempts int
+
+	// Backoff is the time to wait before each attempt to resume the transfer.
+	Backoff time.Duration
+
+	// ShouldResume returns whether a transfer that failed with err should be resumed.
+	// If it is not set, transfers are resumed after network errors, such as when the
+	// connection is lost, but not after the receiver fails the transfer.
+	ShouldResume func(err error) bool
+}
+
+// DefaultMaxResumeAttempts is the number of times a transfer is resumed if ResumeOptions
+// does not specify MaxAttempts.
+const DefaultMaxResumeAttempts = 3
+
+// shouldResume returns whether a transfer that failed with err should be resumed, given
+// the number of times it has already been resumed.
+func (o *SendOptions) shouldResume(err error, resumed int) bool {
+	if o == nil || o.Resume == nil {
+		return false
+	}
+
+	maxAttempts := o.Resume.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxResumeAttempts
+	}
+	if resumed >= maxAttempts {
+		return false
+	}
+
+	if o.Resume.ShouldResume != nil {
+		return o.Resume.ShouldResume(err)
+	}
+	return err == tchannel.ErrConnectionClosed || tchannel.GetSystemErrorCode(err) == tchannel.ErrCodeNetwork
+}
+
+func (o *SendOptions) chunkSize() int {
+	if o == nil || o.ChunkSize <= 0 {
+		return DefaultChunkSize
+	}
+	if o.ChunkSize > MaxChunkSize {
+		return MaxChunkSize
+	}
+	return o.ChunkSize
+}
+
+func (o *SendOptions) progress(name string, transferred, size int64) {
+	if o != nil && o.Progress != nil {
+		o.Progress(name, transferred, size)
+	}
+}
+
+// ChecksumError is returned when a chunk's contents do not match its checksum.
+type ChecksumError struct {
+	// Offset is the offset in the file of the first byte of the chunk.
+	Offset int64
+
+	Expected, Actual uint32
+}
+
+func (e ChecksumError) Error() string {
+	return fmt.Sprintf("transfer chunk at offset %v has checksum %x, expected %x", e.Offset, e.Actual, e.Expected)
+}
+
+// writeChunk writes a single chunk containing data.
+func writeChunk(w io.Writer, data []byte) error {
+	var header [chunkHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(data)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+
+	var checksum [chunkChecksumSize]byte
+	binary.BigEndian.PutUint32(checksum[:], crc32.Checksum(data, crcTable))
+	_, err := w.Write(checksum[:])
+	return err
+}
+
+// readChunk reads a single chunk into buf, growing it if required, and verifies its
+// checksum. It returns io.EOF if the sender ended the transfer on a chunk boundary.
+func readChunk(r io.Reader, buf []byte, offset int64) ([]byte, error) {
+	var header [chunkHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, ErrTruncatedChunk
+		}
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > MaxChunkSize {
+		return nil, ErrChunkTooLarge
+	}
+	if cap(buf) < int(size)+chunkChecksumSize {
+		buf = make([]byte, int(size)+chunkChecksumSize)
+	}
+	buf = buf[:int(size)+chunkChecksumSize]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrTruncatedChunk
+		}
+		return nil, err
+	}
+
+	data := buf[:size]
+	expected := binary.BigEndian.Uint32(buf[size:])
+	if actual := crc32.Checksum(data, crcTable); actual != expected {
+		return nil, ChecksumError{Offset: offset, Expected: expected, Actual: actual}
+	}
+	return data, nil
+}
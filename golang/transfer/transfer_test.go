@@ -0,0 +1,335 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package transfer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+)
+
+const fileSize = 1024 * 1024
+
+// withReceiver runs f with a server that stores transferred files in a temporary
+// directory, and a file of fileSize random bytes to send.
+func withReceiver(t *testing.T, opts *ReceiveOptions, f func(client *tchannel.Channel, hostPort, srcPath, dstDir string)) {
+	dir, err := ioutil.TempDir("", "transfer")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	srcPath := filepath.Join(dir, "file")
+	require.NoError(t, ioutil.WriteFile(srcPath, testutils.RandBytes(fileSize), 0644), "WriteFile failed")
+	dstDir := filepath.Join(dir, "received")
+	require.NoError(t, os.Mkdir(dstDir, 0755), "Mkdir failed")
+
+	testutils.WithTestClientServer(t, nil, func(client, server *tchannel.Channel, hostPort string) {
+		server.Register(Wrap(NewDirReceiver(dstDir), opts), "transfer")
+		f(client, hostPort, srcPath, dstDir)
+	})
+}
+
+func readFile(t *testing.T, path string) []byte {
+	contents, err := ioutil.ReadFile(path)
+	require.NoError(t, err, "ReadFile failed")
+	return contents
+}
+
+func TestSendFile(t *testing.T) {
+	var received []int64
+	receiveOpts := &ReceiveOptions{
+		Progress: func(name string, n, size int64) {
+			assert.Equal(t, "file", name, "Unexpected name in receive progress")
+			assert.Equal(t, int64(fileSize), size, "Unexpected size in receive progress")
+			received = append(received, n)
+		},
+	}
+
+	withReceiver(t, receiveOpts, func(client *tchannel.Channel, hostPort, srcPath, dstDir string) {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		defer cancel()
+
+		var sent []int64
+		sendOpts := &SendOptions{
+			ChunkSize: 16 * 1024,
+			Progress: func(name string, n, size int64) {
+				sent = append(sent, n)
+			},
+		}
+		result, err := SendFile(ctx, client, hostPort, testutils.DefaultServerName, "transfer", srcPath, sendOpts)
+		require.NoError(t, err, "SendFile failed")
+		assert.Equal(t, &Result{Name: "file", Received: fileSize, Chunks: 64}, result, "Unexpected result")
+		assert.Equal(t, readFile(t, srcPath), readFile(t, filepath.Join(dstDir, "file")), "File contents mismatch")
+
+		require.Len(t, sent, 64, "Unexpected number of send progress calls")
+		assert.Equal(t, int64(16*1024), sent[0], "Unexpected first send progress")
+		assert.Equal(t, int64(fileSize), sent[63], "Unexpected last send progress")
+		assert.Equal(t, sent, received, "Send and receive progress should match")
+	})
+}
+
+func TestSendFileResume(t *testing.T) {
+	withReceiver(t, nil, func(client *tchannel.Channel, hostPort, srcPath, dstDir string) {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		defer cancel()
+
+		// Simulate a transfer that failed after some of the file was received.
+		contents := readFile(t, srcPath)
+		const partial = 300 * 1024
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dstDir, "file"), contents[:partial], 0644), "WriteFile failed")
+
+		n, err := Received(ctx, client, hostPort, testutils.DefaultServerName, "transfer", "file")
+		require.NoError(t, err, "Received failed")
+		assert.Equal(t, int64(partial), n, "Unexpected received bytes")
+
+		var first int64
+		sendOpts := &SendOptions{Progress: func(name string, n, size int64) {
+			if first == 0 {
+				first = n
+			}
+		}}
+		result, err := SendFile(ctx, client, hostPort, testutils.DefaultServerName, "transfer", srcPath, sendOpts)
+		require.NoError(t, err, "SendFile failed")
+		assert.Equal(t, int64(fileSize), result.Received, "Unexpected received bytes")
+		assert.Equal(t, 12, result.Chunks, "Only the remainder of the file should be sent")
+		assert.Equal(t, int64(partial+DefaultChunkSize), first, "Progress should include resumed bytes")
+		assert.Equal(t, contents, readFile(t, filepath.Join(dstDir, "file")), "File contents mismatch")
+	})
+}
+
+// dropProxy forwards connections to a target, and can drop all of its connections
+// to simulate the network failing part way through a call.
+type dropProxy struct {
+	ln     net.Listener
+	target string
+
+	mut   sync.Mutex
+	conns []net.Conn
+}
+
+func newDropProxy(t *testing.T, target string) *dropProxy {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Listen failed")
+
+	p := &dropProxy{ln: ln, target: target}
+	go p.accept()
+	return p
+}
+
+func (p *dropProxy) accept() {
+	for {
+		src, err := p.ln.Accept()
+		if err != nil {
+			return
+		}
+		dst, err := net.Dial("tcp", p.target)
+		if err != nil {
+			src.Close()
+			continue
+		}
+
+		p.mut.Lock()
+		p.conns = append(p.conns, src, dst)
+		p.mut.Unlock()
+		go io.Copy(src, dst)
+		go io.Copy(dst, src)
+	}
+}
+
+// drop closes all connections through the proxy.
+func (p *dropProxy) drop() {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	for _, c := range p.conns {
+		c.Close()
+	}
+	p.conns = nil
+}
+
+func (p *dropProxy) close() {
+	p.ln.Close()
+	p.drop()
+}
+
+// withDropProxy is like withReceiver, but the client connects to the server through a
+// dropProxy, which drops the connection the first time the receiver has half of the
+// file. Dropped connections leave frames unreleased, so the server is not leak checked.
+func withDropProxy(t *testing.T, f func(client *tchannel.Channel, hostPort, srcPath, dstDir string)) {
+	dir, err := ioutil.TempDir("", "transfer")
+	require.NoError(t, err, "TempDir failed")
+	defer os.RemoveAll(dir)
+
+	srcPath := filepath.Join(dir, "file")
+	require.NoError(t, ioutil.WriteFile(srcPath, testutils.RandBytes(fileSize), 0644), "WriteFile failed")
+	dstDir := filepath.Join(dir, "received")
+	require.NoError(t, os.Mkdir(dstDir, 0755), "Mkdir failed")
+
+	require.NoError(t, testutils.WithServer(nil, func(server *tchannel.Channel, hostPort string) {
+		proxy := newDropProxy(t, hostPort)
+		defer proxy.close()
+
+		var dropOnce sync.Once
+		server.Register(Wrap(NewDirReceiver(dstDir), &ReceiveOptions{
+			Progress: func(name string, n, size int64) {
+				if n >= fileSize/2 {
+					dropOnce.Do(proxy.drop)
+				}
+			},
+		}), "transfer")
+
+		client, err := testutils.NewClient(nil)
+		require.NoError(t, err, "NewClient failed")
+		defer client.Close()
+
+		f(client, proxy.ln.Addr().String(), srcPath, dstDir)
+	}))
+}
+
+func TestSendFileResumeAfterConnectionLost(t *testing.T) {
+	withDropProxy(t, func(client *tchannel.Channel, hostPort, srcPath, dstDir string) {
+		ctx, cancel := tchannel.NewContext(5 * time.Second)
+		defer cancel()
+
+		var (
+			sent    []int64
+			resumed int
+		)
+		sendOpts := &SendOptions{
+			ChunkSize: 16 * 1024,
+			Progress:  func(name string, n, size int64) { sent = append(sent, n) },
+			Resume: &ResumeOptions{
+				Backoff: 10 * time.Millisecond,
+				ShouldResume: func(err error) bool {
+					resumed++
+					return tchannel.GetSystemErrorCode(err) == tchannel.ErrCodeNetwork
+				},
+			},
+		}
+		result, err := SendFile(ctx, client, hostPort, testutils.DefaultServerName, "transfer", srcPath, sendOpts)
+		require.NoError(t, err, "SendFile failed")
+		assert.Equal(t, 1, resumed, "Transfer should be resumed once")
+		assert.Equal(t, int64(fileSize), result.Received, "Unexpected received bytes")
+		assert.Equal(t, readFile(t, srcPath), readFile(t, filepath.Join(dstDir, "file")), "File contents mismatch")
+
+		// The receiver had half the file when the connection was dropped, so the resumed
+		// transfer should start after that rather than from the beginning.
+		for i := 1; i < len(sent); i++ {
+			if sent[i] <= sent[i-1] {
+				assert.True(t, sent[i] > fileSize/2, "Transfer restarted too early, progress: %v", sent)
+			}
+		}
+	})
+}
+
+func TestSendFileWithoutResume(t *testing.T) {
+	withDropProxy(t, func(client *tchannel.Channel, hostPort, srcPath, dstDir string) {
+		ctx, cancel := tchannel.NewContext(5 * time.Second)
+		defer cancel()
+
+		started := time.Now()
+		_, err := SendFile(ctx, client, hostPort, testutils.DefaultServerName, "transfer", srcPath, nil)
+		assert.Equal(t, tchannel.ErrCodeNetwork, tchannel.GetSystemErrorCode(err), "Unexpected error: %v", err)
+		assert.True(t, time.Since(started) < time.Second, "Transfer should fail as soon as the connection is lost")
+	})
+}
+
+func TestSendChecksumMismatch(t *testing.T) {
+	withReceiver(t, nil, func(client *tchannel.Channel, hostPort, srcPath, dstDir string) {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		defer cancel()
+
+		// Send two chunks, where the second is corrupted after its checksum is computed.
+		first, second := []byte("first chunk"), []byte("second chunk")
+		arg3 := &bytes.Buffer{}
+		require.NoError(t, writeChunk(arg3, first), "writeChunk failed")
+		require.NoError(t, writeChunk(arg3, second), "writeChunk failed")
+		corrupted := arg3.Bytes()
+		corrupted[len(corrupted)-chunkChecksumSize-1] ^= 0xff
+
+		arg2, err := json.Marshal(&Metadata{Name: "file", Size: -1})
+		require.NoError(t, err, "Marshal failed")
+
+		respArg2, respArg3, resp, err := raw.Call(ctx, client, hostPort, testutils.DefaultServerName, "transfer", arg2, corrupted)
+		require.NoError(t, err, "Call failed")
+		assert.True(t, resp.ApplicationError(), "Corrupted chunk should fail the transfer")
+		assert.Contains(t, string(respArg3), "checksum", "Unexpected error message")
+
+		var result Result
+		require.NoError(t, json.Unmarshal(respArg2, &result), "Unmarshal failed")
+		assert.Equal(t, Result{Name: "file", Received: int64(len(first)), Chunks: 1}, result, "Unexpected result")
+		assert.Equal(t, first, readFile(t, filepath.Join(dstDir, "file")), "Only verified chunks should be written")
+	})
+}
+
+func TestSendInvalidName(t *testing.T) {
+	withReceiver(t, nil, func(client *tchannel.Channel, hostPort, srcPath, dstDir string) {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		defer cancel()
+
+		for _, name := range []string{"", ".", "..", "../file", "dir/file"} {
+			meta := &Metadata{Name: name, Size: 1}
+			_, err := Send(ctx, client, hostPort, testutils.DefaultServerName, "transfer", meta, bytes.NewReader([]byte{1}), nil)
+			_, ok := err.(ApplicationError)
+			assert.True(t, ok, "Send with name %q should fail with an ApplicationError, got %v", name, err)
+		}
+
+		_, err := Received(ctx, client, hostPort, testutils.DefaultServerName, "transfer", "../file")
+		_, ok := err.(ApplicationError)
+		assert.True(t, ok, "Received with an invalid name should fail with an ApplicationError, got %v", err)
+	})
+}
+
+func TestReadChunk(t *testing.T) {
+	valid := &bytes.Buffer{}
+	require.NoError(t, writeChunk(valid, []byte("hello")), "writeChunk failed")
+
+	tests := []struct {
+		data    []byte
+		want    []byte
+		wantErr error
+	}{
+		{data: nil, wantErr: io.EOF},
+		{data: valid.Bytes(), want: []byte("hello")},
+		{data: valid.Bytes()[:2], wantErr: ErrTruncatedChunk},
+		{data: valid.Bytes()[:7], wantErr: ErrTruncatedChunk},
+		{data: []byte{0xff, 0xff, 0xff, 0xff}, wantErr: ErrChunkTooLarge},
+		{data: []byte{0, 0, 0, 0, 0, 0, 0, 1}, wantErr: ChecksumError{Offset: 10, Expected: 1, Actual: 0}},
+	}
+
+	for _, tt := range tests {
+		got, err := readChunk(bytes.NewReader(tt.data), nil, 10)
+		assert.Equal(t, tt.wantErr, err, "readChunk(%v) error mismatch", tt.data)
+		if tt.want != nil {
+			assert.Equal(t, tt.want, got, "readChunk(%v) result mismatch", tt.data)
+		}
+	}
+}
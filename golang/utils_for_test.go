@@ -25,15 +25,26 @@ package tchannel
 
 import (
 	"net"
+	"sync/atomic"
 	"time"
+
+	"golang.org/x/net/context"
 )
 
+// MessageIDCycleThreshold is the message ID at which connections are replaced.
+const MessageIDCycleThreshold = messageIDCycleThreshold
+
 // OutboundConnection returns the underlying connection for an outbound call.
 func OutboundConnection(call *OutboundCall) (*Connection, net.Conn) {
 	conn := call.conn
 	return conn, conn.conn
 }
 
+// OutboundCallContext returns the context used for an outbound call's exchange.
+func OutboundCallContext(call *OutboundCall) context.Context {
+	return call.mex.ctx
+}
+
 // GetConnections returns all connections for a channel.
 func GetConnections(ch *Channel) []*Connection {
 	var connections []*Connection
@@ -49,3 +60,8 @@ func GetConnections(ch *Channel) []*Connection {
 func GetTimeNow() *func() time.Time {
 	return &timeNow
 }
+
+// SetLastMessageID sets the last message ID reserved on the connection.
+func SetLastMessageID(c *Connection, id uint32) {
+	atomic.StoreUint32(&c.nextMessageID, id)
+}
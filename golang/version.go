@@ -0,0 +1,44 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tchannel
+
+// VersionInfo identifies the version of the TChannel library.
+// It is reported to peers and debugging tools through introspection.
+const VersionInfo = "0.1.0-dev"
+
+// protocolFeatures are the optional protocol features supported by this library.
+var protocolFeatures = []string{
+	"auth-token",
+	"call-progress",
+	"checksum-crc32",
+	"checksum-crc32c",
+	"checksum-farmhash",
+	"drain-notice",
+	"flow-control",
+	"fragmentation",
+	"ping",
+}
+
+// ProtocolFeatures returns the optional protocol features supported by this library,
+// so that peers and tools can check for a feature without relying on version numbers.
+func ProtocolFeatures() []string {
+	return append([]string(nil), protocolFeatures...)
+}
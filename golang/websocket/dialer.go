@@ -0,0 +1,83 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package websocket
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const defaultHandshakeTimeout = 10 * time.Second
+
+// DialOptions configure outbound WebSocket connections.
+type DialOptions struct {
+	// Path is the path of the WebSocket endpoint on each peer. Defaults to "/".
+	Path string
+
+	// TLS, if set, connects to peers using wss instead of ws.
+	TLS *tls.Config
+
+	// Header is added to each handshake request, such as for authentication with a
+	// gateway in front of the peers.
+	Header http.Header
+
+	// HandshakeTimeout is the timeout for connecting and completing the WebSocket
+	// handshake. Defaults to 10 seconds.
+	HandshakeTimeout time.Duration
+}
+
+// Dialer returns a function to use as the ChannelOptions.Dialer, which connects to
+// each peer's host:port over WebSocket.
+func Dialer(opts *DialOptions) func(hostPort string) (net.Conn, error) {
+	var o DialOptions
+	if opts != nil {
+		o = *opts
+	}
+	if o.Path == "" {
+		o.Path = "/"
+	}
+	if o.HandshakeTimeout <= 0 {
+		o.HandshakeTimeout = defaultHandshakeTimeout
+	}
+
+	scheme := "ws"
+	if o.TLS != nil {
+		scheme = "wss"
+	}
+	dialer := &websocket.Dialer{
+		HandshakeTimeout: o.HandshakeTimeout,
+		TLSClientConfig:  o.TLS,
+	}
+
+	return func(hostPort string) (net.Conn, error) {
+		u := url.URL{Scheme: scheme, Host: hostPort, Path: o.Path}
+		ws, resp, err := dialer.Dial(u.String(), o.Header)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		return newConn(ws), nil
+	}
+}
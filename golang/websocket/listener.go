@@ -0,0 +1,113 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package websocket
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+var errListenerClosed = errors.New("websocket listener closed")
+
+// Listener is an http.Handler that upgrades requests to WebSocket connections, and a
+// net.Listener that returns those connections. Serve it over HTTP, and pass it to
+// Channel.Serve to handle the connections.
+type Listener struct {
+	addr     net.Addr
+	upgrader websocket.Upgrader
+	conns    chan net.Conn
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// ListenerOptions configure a Listener.
+type ListenerOptions struct {
+	// CheckOrigin returns whether to accept a request based on its Origin header. By
+	// default, requests with an Origin header that does not match the Host are rejected.
+	CheckOrigin func(r *http.Request) bool
+}
+
+// NewListener returns a Listener. The hostPort is the address that the channel
+// advertises to its peers, which is usually the address of the HTTP server.
+func NewListener(hostPort string, opts *ListenerOptions) (*Listener, error) {
+	addr, err := net.ResolveTCPAddr("tcp", hostPort)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Listener{
+		addr:   addr,
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+	if opts != nil {
+		l.upgrader.CheckOrigin = opts.CheckOrigin
+	}
+	return l, nil
+}
+
+// ServeHTTP upgrades the request and passes the connection to Accept.
+func (l *Listener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-l.closed:
+		http.Error(w, errListenerClosed.Error(), http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	// Upgrade writes an error response if it fails.
+	ws, err := l.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	select {
+	case l.conns <- newConn(ws):
+	case <-l.closed:
+		ws.Close()
+	}
+}
+
+// Accept waits for the next WebSocket connection.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, errListenerClosed
+	}
+}
+
+// Close stops accepting connections. Requests that are received after the Listener is
+// closed fail with a 503.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+// Addr returns the address that the Listener was created with.
+func (l *Listener) Addr() net.Addr {
+	return l.addr
+}
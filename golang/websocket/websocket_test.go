@@ -0,0 +1,108 @@
+// Copyright (c) 2015 Uber Technologies, Inc.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber/tchannel/golang"
+	"github.com/uber/tchannel/golang/raw"
+	"github.com/uber/tchannel/golang/testutils"
+	"golang.org/x/net/context"
+)
+
+// newServer returns a channel that serves connections from a WebSocket endpoint at
+// /tchannel on an HTTP server.
+func newServer(t *testing.T) (*tchannel.Channel, *httptest.Server) {
+	mux := http.NewServeMux()
+	httpServer := httptest.NewServer(mux)
+
+	l, err := NewListener(httpServer.Listener.Addr().String(), nil)
+	require.NoError(t, err, "NewListener failed")
+	mux.Handle("/tchannel", l)
+
+	ch, err := tchannel.NewChannel("svc", nil)
+	require.NoError(t, err, "NewChannel failed")
+	require.NoError(t, ch.Serve(l), "Serve failed")
+	testutils.RegisterFunc(t, ch, "echo", func(ctx context.Context, args *raw.Args) (*raw.Res, error) {
+		return &raw.Res{Arg2: args.Arg2, Arg3: args.Arg3}, nil
+	})
+	return ch, httpServer
+}
+
+func TestWebSocket(t *testing.T) {
+	server, httpServer := newServer(t)
+	defer httpServer.Close()
+	defer server.Close()
+
+	client, err := tchannel.NewChannel("client", &tchannel.ChannelOptions{
+		Dialer: Dialer(&DialOptions{Path: "/tchannel"}),
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	// Send a payload larger than a frame, to test fragments spanning messages.
+	arg3 := []byte(strings.Repeat("a", 100000))
+	for i := 0; i < 3; i++ {
+		ctx, cancel := tchannel.NewContext(time.Second)
+		arg2, resArg3, _, err := raw.Call(ctx, client, server.PeerInfo().HostPort, "svc", "echo", []byte("arg2"), arg3)
+		cancel()
+		require.NoError(t, err, "call over WebSocket failed")
+		assert.Equal(t, []byte("arg2"), arg2, "arg2 mismatch")
+		assert.Equal(t, arg3, resArg3, "arg3 mismatch")
+	}
+}
+
+func TestWebSocketDialFails(t *testing.T) {
+	server, httpServer := newServer(t)
+	defer httpServer.Close()
+	defer server.Close()
+
+	client, err := tchannel.NewChannel("client", &tchannel.ChannelOptions{
+		Dialer: Dialer(&DialOptions{Path: "/unknown"}),
+	})
+	require.NoError(t, err, "NewChannel failed")
+	defer client.Close()
+
+	ctx, cancel := tchannel.NewContext(time.Second)
+	defer cancel()
+	_, _, _, err = raw.Call(ctx, client, server.PeerInfo().HostPort, "svc", "echo", nil, nil)
+	assert.Error(t, err, "call to an endpoint that is not a WebSocket should fail")
+}
+
+func TestListenerClose(t *testing.T) {
+	l, err := NewListener("127.0.0.1:1234", nil)
+	require.NoError(t, err, "NewListener failed")
+	assert.Equal(t, "127.0.0.1:1234", l.Addr().String(), "Addr mismatch")
+
+	require.NoError(t, l.Close(), "Close failed")
+	_, err = l.Accept()
+	assert.Equal(t, errListenerClosed, err, "Accept should fail after Close")
+
+	w := httptest.NewRecorder()
+	l.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "requests should fail after Close")
+}